@@ -0,0 +1,63 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+	specErr  error
+)
+
+// YAML returns the OpenAPI specification as written
+func YAML() []byte {
+	return specYAML
+}
+
+// JSON returns the OpenAPI specification converted to JSON. It is converted
+// once and cached.
+func JSON() ([]byte, error) {
+	specOnce.Do(func() {
+		var doc interface{}
+		if err := yaml.Unmarshal(specYAML, &doc); err != nil {
+			specErr = fmt.Errorf("parse openapi spec: %w", err)
+			return
+		}
+		specJSON, specErr = json.Marshal(jsonValue(doc))
+	})
+	return specJSON, specErr
+}
+
+// jsonValue converts YAML maps with non-string keys (e.g. unquoted response
+// codes) into maps JSON can encode
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/health"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// schemaModels maps the spec's component schemas to the types encoded for them
+var schemaModels = map[string]interface{}{
+	"UploadTicketRequest":    models.UploadTicketRequest{},
+	"RequestInfo":            models.RequestInfo{},
+	"ResponseInfo":           models.ResponseInfo{},
+	"FileInfo":               models.FileInfo{},
+	"ArtifactsInfo":          models.ArtifactsInfo{},
+	"ArtifactInfo":           models.ArtifactInfo{},
+	"ArtifactPresence":       models.ArtifactPresence{},
+	"ClientInfo":             models.ClientInfo{},
+	"UploadTicketResponse":   models.UploadTicketResponse{},
+	"UploadURLs":             models.UploadURLs{},
+	"PresignedUpload":        models.PresignedUpload{},
+	"FailedUpload":           models.FailedUpload{},
+	"PresignRetryRequest":    models.PresignRetryRequest{},
+	"PresignRetryResponse":   models.PresignRetryResponse{},
+	"UploadCompleteRequest":  models.UploadCompleteRequest{},
+	"Encryption":             models.Encryption{},
+	"UploadCompleteResponse": models.UploadCompleteResponse{},
+	"RestoreRequest":         models.RestoreRequest{},
+	"ReplayRequest":          models.ReplayRequest{},
+	"ReplayResponse":         models.ReplayResponse{},
+	"AckRequest":             models.AckRequest{},
+	"AckResponse":            models.AckResponse{},
+	"TicketResponse":         models.TicketResponse{},
+	"TicketUploads":          models.TicketUploads{},
+	"PresignedPost":          models.PresignedPost{},
+	"CompleteTicketRequest":  models.CompleteTicketRequest{},
+	"ArtifactUploadResponse": models.ArtifactUploadResponse{},
+	"RestoreResponse":        models.RestoreResponse{},
+	"ReleaseRequest":         models.ReleaseRequest{},
+	"ReleaseResponse":        models.ReleaseResponse{},
+	"UserErasureRequest":     models.UserErasureRequest{},
+	"UserErasureResponse":    models.UserErasureResponse{},
+	"FailureResponse":        models.FailureResponse{},
+	"Envelope":               models.Envelope{},
+	"DeleteFailureResponse":  models.DeleteFailureResponse{},
+	"FailureSummary":         models.FailureSummary{},
+	"Thumbnail":              models.Thumbnail{},
+	"FailuresResponse":       models.FailuresResponse{},
+	"ArtifactDownload":       models.ArtifactDownload{},
+	"DownloadsResponse":      models.DownloadsResponse{},
+	"Group":                  models.Group{},
+	"GroupsResponse":         models.GroupsResponse{},
+	"StatsResponse":          models.StatsResponse{},
+	"UsageCounts":            models.UsageCounts{},
+	"KeyUsageResponse":       models.KeyUsageResponse{},
+	"AdminProjectsResponse":  models.AdminProjectsResponse{},
+	"ProjectConfigResponse":  models.ProjectConfigResponse{},
+	"PurgeResponse":          models.PurgeResponse{},
+	"StorageUsageResponse":   models.StorageUsageResponse{},
+	"APIKeyInfo":             models.APIKeyInfo{},
+	"APIKeysResponse":        models.APIKeysResponse{},
+	"CreateAPIKeyRequest":    models.CreateAPIKeyRequest{},
+	"RotateAPIKeyRequest":    models.RotateAPIKeyRequest{},
+	"CreateAPIKeyResponse":   models.CreateAPIKeyResponse{},
+	"NotificationRoute":      models.NotificationRoute{},
+	"RoutesResponse":         models.RoutesResponse{},
+	"VersionResponse":        buildinfo.Info{},
+	"ReadinessResponse":      health.Report{},
+	"DependencyCheck":        health.Result{},
+	"Problem":                apierror.Problem{},
+}
+
+// schema is the subset of an OpenAPI schema object the drift check reads
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	AllOf                []*schema          `json:"allOf"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+}
+
+type spec struct {
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) *spec {
+	t.Helper()
+	b, err := JSON()
+	if err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	var s spec
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	return &s
+}
+
+func TestJSON(t *testing.T) {
+	b, err := JSON()
+	if err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("JSON() is not a JSON object: %v", err)
+	}
+	if !strings.HasPrefix(doc["openapi"].(string), "3.") || doc["paths"] == nil {
+		t.Errorf("JSON() = %.200s", b)
+	}
+}
+
+// TestModelsMatchSpec fails when a model field is missing from its schema or
+// a schema property has no model field, so the spec cannot drift from the code
+func TestModelsMatchSpec(t *testing.T) {
+	s := loadSpec(t)
+
+	for name, model := range schemaModels {
+		sc, ok := s.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing from the spec", name)
+			continue
+		}
+		compare(t, s, name, sc, reflect.TypeOf(model))
+	}
+}
+
+// compare checks the properties of sc against the JSON fields of typ,
+// descending into inline object schemas
+func compare(t *testing.T, s *spec, path string, sc *schema, typ reflect.Type) {
+	t.Helper()
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	sc = resolve(s, sc)
+
+	switch typ.Kind() {
+	case reflect.Slice:
+		if sc.Items != nil && typ.Elem().Kind() != reflect.Uint8 {
+			compare(t, s, path+"[]", sc.Items, typ.Elem())
+		}
+		return
+	case reflect.Map:
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	if typ.PkgPath() == "time" {
+		return
+	}
+
+	props := properties(s, sc)
+	if props == nil {
+		return
+	}
+	fields := jsonFields(typ)
+
+	var missing, extra []string
+	for name, f := range fields {
+		p, ok := props[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		// Referenced schemas are checked under their own name
+		if p.Ref == "" {
+			compare(t, s, path+"."+name, p, f.Type)
+		}
+	}
+	for name := range props {
+		if _, ok := fields[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	if len(missing) > 0 {
+		t.Errorf("%s: fields missing from the spec: %v", path, missing)
+	}
+	if len(extra) > 0 {
+		t.Errorf("%s: spec properties without a field: %v", path, extra)
+	}
+}
+
+// resolve follows a $ref to its component schema
+func resolve(s *spec, sc *schema) *schema {
+	for sc.Ref != "" {
+		sc = s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")]
+	}
+	return sc
+}
+
+// properties merges the properties of sc and its allOf parts; nil when sc
+// describes no object properties
+func properties(s *spec, sc *schema) map[string]*schema {
+	if sc.Properties == nil && len(sc.AllOf) == 0 {
+		return nil
+	}
+	props := make(map[string]*schema)
+	for name, p := range sc.Properties {
+		props[name] = p
+	}
+	for _, part := range sc.AllOf {
+		for name, p := range properties(s, resolve(s, part)) {
+			props[name] = p
+		}
+	}
+	return props
+}
+
+// jsonFields returns the JSON-encoded fields of a struct, including those of
+// embedded structs
+func jsonFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			for n, ef := range jsonFields(f.Type) {
+				fields[n] = ef
+			}
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/autocomplete"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/verify"
+)
+
+// sweepInterval is how often the polling worker completes timed-out tickets
+const sweepInterval = time.Minute
+
+// Completes tickets from the S3 ObjectCreated events of their uploads, queuing
+// each completion to VERIFY_QUEUE_URL for the API to process. Deployed to
+// Lambda it handles the events of AUTO_COMPLETE_QUEUE_URL, direct S3 or
+// EventBridge events, and EventBridge schedules that sweep timed-out tickets;
+// otherwise it polls the queue and sweeps every minute until interrupted.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	if cfg.VerifyQueueURL == "" {
+		logging.Error().Msg("VERIFY_QUEUE_URL is required")
+		os.Exit(1)
+	}
+
+	// Tickets are read from S3 and their uploads checked in each failure's bucket
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	client, err := queue.NewClient(ctx, cfg.AWSRegion)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize SQS client")
+		os.Exit(1)
+	}
+	worker := autocomplete.New(presigner, verify.NewPublisher(client, cfg.VerifyQueueURL), cfg.AutoCompleteTimeout)
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			resp, err := worker.Handle(ctx, payload)
+			if ferr := metrics.FlushEMF(); ferr != nil {
+				logging.Warn().Err(ferr).Msg("failed to emit metrics")
+			}
+			return resp, err
+		})
+		return
+	}
+
+	if cfg.AutoCompleteQueueURL == "" {
+		logging.Error().Msg("AUTO_COMPLETE_QUEUE_URL is required")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logging.Info().
+		Str("queue", cfg.AutoCompleteQueueURL).
+		Dur("timeout", cfg.AutoCompleteTimeout).
+		Msg("completing tickets from object events")
+	go worker.SweepEvery(ctx, sweepInterval)
+	worker.Poll(ctx, client, cfg.AutoCompleteQueueURL)
+	logging.Info().Msg("auto-completion worker stopped")
+}
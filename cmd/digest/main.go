@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/digest"
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/links"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/sesevents"
+)
+
+// Runs once from the command line, or as a Lambda handler for an
+// EventBridge (CloudWatch Events) schedule when deployed to Lambda.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	period := flag.String("period", cfg.DigestPeriod, "digest period: daily or weekly")
+	flag.Parse()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	window, err := digest.Period(*period)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid digest period")
+		os.Exit(1)
+	}
+
+	// Digest entries are read from S3, and envelopes presigned in each failure's bucket when
+	// there are no short links
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	// Link envelopes through signed short links when PUBLIC_URL is set
+	linkSigner, err := links.Load(cfg.PublicURL, cfg.LinkSecret, cfg.LinkTTL)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize link signing")
+		os.Exit(1)
+	}
+
+	// Initialize email sender
+	emailer, err := email.NewSender(ctx, email.Options{
+		Provider:         cfg.EmailProvider,
+		From:             cfg.SESFrom,
+		To:               cfg.SESTo,
+		Region:           cfg.AWSRegion,
+		ConfigurationSet: cfg.SESConfigurationSet,
+		Policy:           cfg.AWSPolicy("ses", cfg.SESTimeout),
+		SMTPAddr:         cfg.SMTPAddr,
+		SMTPUsername:     cfg.SMTPUsername,
+		SMTPPassword:     cfg.SMTPPassword,
+		SendGridAPIKey:   cfg.SendGridAPIKey,
+	})
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize email sender")
+		os.Exit(1)
+	}
+	emailer.WithSuppressions(sesevents.NewList(presigner))
+
+	run := func(ctx context.Context, now time.Time) error {
+		logging.Info().
+			Str("bucket", cfg.BucketName).
+			Str("period", *period).
+			Msg("sending failure digests")
+		return digest.Run(ctx, presigner, emailer, window, now.UTC(), linkSigner)
+	}
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+			if event.Time.IsZero() {
+				return run(ctx, time.Now())
+			}
+			return run(ctx, event.Time)
+		})
+		return
+	}
+
+	if err := run(ctx, time.Now()); err != nil {
+		logging.Error().Err(err).Msg("digest run failed")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/ack"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+)
+
+// Re-notifies unacknowledged failures via the escalation webhook once from the
+// command line, or as a Lambda handler for an EventBridge schedule when deployed to Lambda.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	if cfg.EscalationWebhookURL == "" {
+		logging.Error().Msg("ESCALATION_WEBHOOK_URL is required")
+		os.Exit(1)
+	}
+
+	// Acknowledgment records are read from and updated in S3
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	escalator := ack.NewWebhook(cfg.EscalationWebhookURL)
+
+	run := func(ctx context.Context, now time.Time) error {
+		logging.Info().
+			Str("bucket", cfg.BucketName).
+			Dur("window", cfg.EscalationWindow).
+			Msg("escalating unacknowledged failures")
+		return ack.Run(ctx, presigner, escalator, cfg.EscalationWindow, now.UTC())
+	}
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+			if event.Time.IsZero() {
+				return run(ctx, time.Now())
+			}
+			return run(ctx, event.Time)
+		})
+		return
+	}
+
+	if err := run(ctx, time.Now()); err != nil {
+		logging.Error().Err(err).Msg("escalation run failed")
+		os.Exit(1)
+	}
+}
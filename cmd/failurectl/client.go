@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/validation"
+)
+
+// client calls the service's read and admin APIs
+type client struct {
+	profile Profile
+	http    *http.Client
+}
+
+func newClient(p Profile) *client {
+	return &client{profile: p, http: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// do sends a request and decodes a JSON response into out. Error responses
+// are reported with their problem detail.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}, admin bool) error {
+	u := strings.TrimRight(c.profile.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case admin:
+		if c.profile.AdminKey == "" {
+			return fmt.Errorf("%s %s needs an admin key (FAILURECTL_ADMIN_KEY or the profile's adminKey)", method, path)
+		}
+		req.Header.Set(middleware.AdminKeyHeader, c.profile.AdminKey)
+	case c.profile.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.profile.Token)
+	case c.profile.APIKey != "":
+		req.Header.Set(middleware.APIKeyHeader, c.profile.APIKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var p apierror.Problem
+		if json.Unmarshal(b, &p) != nil || p.Title == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		msg := p.Title
+		if p.Detail != "" {
+			msg = p.Detail
+		}
+		for _, e := range p.Errors {
+			msg += fmt.Sprintf("; %s: %s", e.Field, e.Message)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// failurePath returns the API path of a failure, with an optional suffix
+func failurePath(failureID, suffix string) string {
+	return "/v1/failures/" + url.PathEscape(failureID) + suffix
+}
+
+// locator identifies a failure the way the read API looks it up
+type locator struct {
+	FailureID string
+	Project   string
+	Env       string
+	Prefix    string
+}
+
+func (l locator) query() url.Values {
+	return url.Values{"project": {l.Project}, "env": {l.Env}, "prefix": {l.Prefix}}
+}
+
+// locate fills in a missing prefix by searching the failure among the
+// project's recent failures
+func (c *client) locate(ctx context.Context, l locator) (locator, error) {
+	if l.Project == "" || l.Env == "" {
+		return l, fmt.Errorf("project and env are required (-project, -env or the profile)")
+	}
+	if l.Prefix != "" {
+		return l, nil
+	}
+
+	var list models.FailuresResponse
+	q := url.Values{"project": {l.Project}, "env": {l.Env}, "days": {fmt.Sprint(validation.MaxListDays)}, "limit": {fmt.Sprint(validation.MaxListLimit)}}
+	if err := c.do(ctx, http.MethodGet, "/v1/failures", q, nil, &list, false); err != nil {
+		return l, err
+	}
+	for _, f := range list.Failures {
+		if f.FailureID == l.FailureID {
+			l.Prefix = f.S3Prefix
+			return l, nil
+		}
+	}
+	return l, fmt.Errorf("failure %s not found among the last %d days of %s/%s; pass -prefix", l.FailureID, validation.MaxListDays, l.Project, l.Env)
+}
+
+// fetch downloads a presigned URL to path
+func (c *client) fetch(ctx context.Context, rawURL, path string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("download returned %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
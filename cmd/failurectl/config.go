@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds the connection settings of one service deployment
+type Profile struct {
+	URL string `yaml:"url"`
+	// APIKey or Token authenticates the read API; AdminKey the admin API
+	APIKey   string `yaml:"apiKey"`
+	Token    string `yaml:"token"`
+	AdminKey string `yaml:"adminKey"`
+	// Project and Env are defaults for commands that take them
+	Project string `yaml:"project"`
+	Env     string `yaml:"env"`
+}
+
+// profilesFile is the profile config file
+// Format:
+//
+//	default: prod
+//	profiles:
+//	  prod:
+//	    url: https://failures.example.com
+//	    apiKey: ...
+type profilesFile struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// configPath returns $FAILURECTL_CONFIG, or failurectl/config.yaml in the
+// user's config directory
+func configPath() string {
+	if p := os.Getenv("FAILURECTL_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "failurectl", "config.yaml")
+}
+
+// loadProfile reads the named profile, or the file's default one when name is
+// empty. A missing config file yields an empty profile unless a name was given.
+// Environment variables override the profile's fields.
+func loadProfile(name string) (Profile, error) {
+	var p Profile
+	path := configPath()
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) || path == "":
+		if name != "" {
+			return p, fmt.Errorf("profile %q: no config file at %s", name, path)
+		}
+	case err != nil:
+		return p, err
+	default:
+		var f profilesFile
+		if err := yaml.Unmarshal(b, &f); err != nil {
+			return p, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if name == "" {
+			name = f.Default
+		}
+		if name != "" {
+			var ok bool
+			if p, ok = f.Profiles[name]; !ok {
+				return p, fmt.Errorf("profile %q not found in %s", name, path)
+			}
+		}
+	}
+
+	for env, field := range map[string]*string{
+		"FAILURECTL_URL":       &p.URL,
+		"FAILURECTL_API_KEY":   &p.APIKey,
+		"FAILURECTL_TOKEN":     &p.Token,
+		"FAILURECTL_ADMIN_KEY": &p.AdminKey,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+	if p.URL == "" {
+		p.URL = "http://localhost:8080"
+	}
+	return p, nil
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+const usageText = `failurectl talks to a failure-uploader deployment.
+
+Usage:
+  failurectl list     [flags]                list recent failures of a project and env
+  failurectl get      <failureId> [flags]    show a failure's envelope and curl command
+  failurectl download <failureId> [flags]    download every artifact of a failure
+  failurectl replay   <failureId> [flags]    re-send a captured request (admin scope)
+  failurectl purge    <failureId> -yes       delete one failure (admin scope)
+  failurectl purge    -project p -yes        apply a project's retention now (admin key)
+
+Common flags:
+  -profile name   profile from the config file (FAILURECTL_PROFILE)
+  -url url        service base URL (FAILURECTL_URL)
+  -project p      project (defaults to the profile's)
+  -env e          env (defaults to the profile's)
+  -o table|json   output format (default table)
+
+Credentials come from FAILURECTL_API_KEY or FAILURECTL_TOKEN, and
+FAILURECTL_ADMIN_KEY for the admin API, overriding the profile's apiKey,
+token and adminKey. Profiles are read from $FAILURECTL_CONFIG or
+failurectl/config.yaml in the user config directory.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usageText)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	run, ok := commands[name]
+	if !ok {
+		if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+			fmt.Print(usageText)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "failurectl: unknown command %q\n\n%s", name, usageText)
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), os.Args[2:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "failurectl %s: %v\n", name, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// commands are the subcommands, which write their output to stdout
+var commands = map[string]func(ctx context.Context, args []string, stdout io.Writer) error{
+	"list":     runList,
+	"get":      runGet,
+	"download": runDownload,
+	"replay":   runReplay,
+	"purge":    runPurge,
+}
+
+// options are the flags every command accepts
+type options struct {
+	fs      *flag.FlagSet
+	profile string
+	url     string
+	project string
+	env     string
+	output  string
+}
+
+func newOptions(name string) *options {
+	o := &options{fs: flag.NewFlagSet("failurectl "+name, flag.ContinueOnError)}
+	o.fs.StringVar(&o.profile, "profile", os.Getenv("FAILURECTL_PROFILE"), "profile from the config file")
+	o.fs.StringVar(&o.url, "url", "", "service base URL")
+	o.fs.StringVar(&o.project, "project", "", "project")
+	o.fs.StringVar(&o.env, "env", "", "env")
+	o.fs.StringVar(&o.output, "o", formatTable, "output format: table or json")
+	return o
+}
+
+// parse parses args, allowing flags before and after positional arguments,
+// and returns the positional ones
+func (o *options) parse(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := o.fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if o.fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, o.fs.Arg(0))
+		args = o.fs.Args()[1:]
+	}
+	if o.output != formatTable && o.output != formatJSON {
+		return nil, fmt.Errorf("-o must be table or json")
+	}
+	return positional, nil
+}
+
+// client loads the profile, applies flag overrides and returns an API client
+func (o *options) client() (*client, error) {
+	p, err := loadProfile(o.profile)
+	if err != nil {
+		return nil, err
+	}
+	if o.url != "" {
+		p.URL = o.url
+	}
+	if o.project == "" {
+		o.project = p.Project
+	}
+	if o.env == "" {
+		o.env = p.Env
+	}
+	return newClient(p), nil
+}
+
+// failureArg returns the single failure ID argument
+func failureArg(positional []string) (string, error) {
+	if len(positional) != 1 {
+		return "", errors.New("expected exactly one failure ID")
+	}
+	return positional[0], nil
+}
+
+// listFilter selects the failures list shows
+type listFilter struct {
+	days     int
+	limit    int
+	severity string
+	tags     tagFlags
+}
+
+// query returns the /v1/failures query of the failures of project/env
+// matching f
+func (f listFilter) query(project, env string) url.Values {
+	q := url.Values{"project": {project}, "env": {env}, "days": {strconv.Itoa(f.days)}, "limit": {strconv.Itoa(f.limit)}}
+	if f.severity != "" {
+		q.Set("severity", f.severity)
+	}
+	for _, t := range f.tags {
+		q.Add("tag", t)
+	}
+	return q
+}
+
+func runList(ctx context.Context, args []string, stdout io.Writer) error {
+	o := newOptions("list")
+	var f listFilter
+	o.fs.IntVar(&f.days, "days", 7, "UTC days to search back")
+	o.fs.IntVar(&f.limit, "limit", 50, "maximum failures to list")
+	o.fs.StringVar(&f.severity, "severity", "", "only failures of this severity: info, warning, error or critical")
+	o.fs.Var(&f.tags, "tag", "only failures carrying a tag, key:value or key (repeatable)")
+	if _, err := o.parse(args); err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	if o.project == "" || o.env == "" {
+		return errors.New("project and env are required (-project, -env or the profile)")
+	}
+
+	var resp models.FailuresResponse
+	if err := c.do(ctx, http.MethodGet, "/v1/failures", f.query(o.project, o.env), nil, &resp, false); err != nil {
+		return err
+	}
+	return printFailures(stdout, o.output, resp)
+}
+
+func runGet(ctx context.Context, args []string, stdout io.Writer) error {
+	o := newOptions("get")
+	prefix := o.fs.String("prefix", "", "the failure's s3Prefix (looked up when omitted)")
+	positional, err := o.parse(args)
+	if err != nil {
+		return err
+	}
+	id, err := failureArg(positional)
+	if err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	loc, err := c.locate(ctx, locator{FailureID: id, Project: o.project, Env: o.env, Prefix: *prefix})
+	if err != nil {
+		return err
+	}
+
+	var resp models.FailureResponse
+	if err := c.do(ctx, http.MethodGet, failurePath(id, ""), loc.query(), nil, &resp, false); err != nil {
+		return err
+	}
+	return printFailure(stdout, o.output, resp, loc.Prefix)
+}
+
+func runDownload(ctx context.Context, args []string, stdout io.Writer) error {
+	o := newOptions("download")
+	prefix := o.fs.String("prefix", "", "the failure's s3Prefix (looked up when omitted)")
+	dir := o.fs.String("dir", ".", "directory to download into; artifacts go to {dir}/{failureId}/")
+	positional, err := o.parse(args)
+	if err != nil {
+		return err
+	}
+	id, err := failureArg(positional)
+	if err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	loc, err := c.locate(ctx, locator{FailureID: id, Project: o.project, Env: o.env, Prefix: *prefix})
+	if err != nil {
+		return err
+	}
+
+	var resp models.DownloadsResponse
+	if err := c.do(ctx, http.MethodGet, failurePath(id, "/downloads"), loc.query(), nil, &resp, false); err != nil {
+		return err
+	}
+
+	root := filepath.Join(*dir, id)
+	paths, err := artifactPaths(root, resp.Artifacts)
+	if err != nil {
+		return err
+	}
+	var files []downloaded
+	for i, a := range resp.Artifacts {
+		n, err := c.fetch(ctx, a.URL, paths[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.Name, err)
+		}
+		files = append(files, downloaded{Name: a.Name, Bytes: n, Path: paths[i]})
+	}
+	return printDownloads(stdout, o.output, files, resp.Encryption)
+}
+
+// artifactPaths returns where each artifact is downloaded to under root.
+// Names come from the server; none may point outside root.
+func artifactPaths(root string, artifacts []models.ArtifactDownload) ([]string, error) {
+	paths := make([]string, len(artifacts))
+	for i, a := range artifacts {
+		if !filepath.IsLocal(filepath.FromSlash(a.Name)) {
+			return nil, fmt.Errorf("refusing to write artifact %q outside %s", a.Name, root)
+		}
+		paths[i] = filepath.Join(root, filepath.FromSlash(a.Name))
+	}
+	return paths, nil
+}
+
+// tagFlags collects repeated -tag filters
+type tagFlags []string
+
+func (t *tagFlags) String() string { return strings.Join(*t, ",") }
+
+func (t *tagFlags) Set(v string) error {
+	*t = append(*t, v)
+	return nil
+}
+
+// headerFlags collects repeated -header Name=value flags
+type headerFlags map[string]string
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return errors.New("must be Name=value")
+	}
+	h[name] = value
+	return nil
+}
+
+func runReplay(ctx context.Context, args []string, stdout io.Writer) error {
+	o := newOptions("replay")
+	prefix := o.fs.String("prefix", "", "the failure's s3Prefix (looked up when omitted)")
+	baseURL := o.fs.String("base-url", "", "replace the captured scheme and host, e.g. a staging server")
+	dryRun := o.fs.Bool("dry-run", false, "show the request without sending it")
+	headers := headerFlags{}
+	o.fs.Var(headers, "header", "override a captured header, Name=value; an empty value removes it (repeatable)")
+	positional, err := o.parse(args)
+	if err != nil {
+		return err
+	}
+	id, err := failureArg(positional)
+	if err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	loc, err := c.locate(ctx, locator{FailureID: id, Project: o.project, Env: o.env, Prefix: *prefix})
+	if err != nil {
+		return err
+	}
+
+	var resp models.ReplayResponse
+	if err := c.do(ctx, http.MethodPost, failurePath(id, "/replay"), nil, replayRequest(loc, *baseURL, *dryRun, headers), &resp, false); err != nil {
+		return err
+	}
+	return printReplay(stdout, o.output, resp)
+}
+
+// replayRequest returns the replay of the failure at loc, sent to baseURL
+// when set, with headers overriding the captured ones
+func replayRequest(loc locator, baseURL string, dryRun bool, headers headerFlags) models.ReplayRequest {
+	req := models.ReplayRequest{Project: loc.Project, Env: loc.Env, S3Prefix: loc.Prefix, BaseURL: baseURL, DryRun: dryRun}
+	if len(headers) > 0 {
+		req.Headers = headers
+	}
+	return req
+}
+
+func runPurge(ctx context.Context, args []string, stdout io.Writer) error {
+	o := newOptions("purge")
+	prefix := o.fs.String("prefix", "", "the failure's s3Prefix (looked up when omitted)")
+	yes := o.fs.Bool("yes", false, "confirm the deletion")
+	positional, err := o.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return errors.New("expected at most one failure ID")
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+
+	// Without a failure ID, the project's retention policy is applied now
+	if len(positional) == 0 {
+		if o.project == "" {
+			return errors.New("a failure ID or -project is required")
+		}
+		if !*yes {
+			return fmt.Errorf("purging project %s deletes every failure past its retention; pass -yes to confirm", o.project)
+		}
+		var resp models.PurgeResponse
+		if err := c.do(ctx, http.MethodPost, "/admin/projects/"+url.PathEscape(o.project)+"/purge", nil, nil, &resp, true); err != nil {
+			return err
+		}
+		return printPurge(stdout, o.output, resp)
+	}
+
+	id := positional[0]
+	loc, err := c.locate(ctx, locator{FailureID: id, Project: o.project, Env: o.env, Prefix: *prefix})
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("deleting failure %s at %s cannot be undone; pass -yes to confirm", id, loc.Prefix)
+	}
+	var resp models.DeleteFailureResponse
+	if err := c.do(ctx, http.MethodDelete, failurePath(id, ""), loc.query(), nil, &resp, false); err != nil {
+		return err
+	}
+	return printDeleted(stdout, o.output, id, resp)
+}
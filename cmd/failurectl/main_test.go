@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+const prefix = "failures/myapp/prod/2024/03/15/abc/"
+
+// fakeService serves the read and admin APIs for failure abc of myapp/prod
+// and records the last request to each path
+type fakeService struct {
+	t        *testing.T
+	srv      *httptest.Server
+	requests map[string]*http.Request
+	bodies   map[string][]byte
+}
+
+func newFakeService(t *testing.T) *fakeService {
+	f := &fakeService{t: t, requests: make(map[string]*http.Request), bodies: make(map[string][]byte)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/failures", func(w http.ResponseWriter, r *http.Request) {
+		f.write(w, r, models.FailuresResponse{Failures: []models.FailureSummary{{
+			FailureID:  "abc",
+			Project:    "myapp",
+			Env:        "prod",
+			S3Prefix:   prefix,
+			CreatedAt:  time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC),
+			Method:     "POST",
+			URL:        "https://api.example.com/checkout",
+			StatusCode: 500,
+			Severity:   "critical",
+		}}})
+	})
+	mux.HandleFunc("GET /v1/failures/abc", func(w http.ResponseWriter, r *http.Request) {
+		f.write(w, r, models.FailureResponse{
+			Envelope: models.Envelope{
+				FailureID: "abc",
+				Project:   "myapp",
+				Env:       "prod",
+				Request:   models.RequestInfo{Method: "POST", URL: "https://api.example.com/checkout"},
+				Response:  &models.ResponseInfo{StatusCode: 500},
+			},
+			Curl: "curl -X POST https://api.example.com/checkout",
+		})
+	})
+	mux.HandleFunc("GET /v1/failures/abc/downloads", func(w http.ResponseWriter, r *http.Request) {
+		f.write(w, r, models.DownloadsResponse{Artifacts: []models.ArtifactDownload{
+			{Name: "envelope.json", URL: f.srv.URL + "/objects/envelope.json"},
+			{Name: "files/dump.txt", URL: f.srv.URL + "/objects/dump.txt"},
+		}})
+	})
+	mux.HandleFunc("GET /objects/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("contents of " + r.PathValue("name")))
+	})
+	mux.HandleFunc("POST /v1/failures/abc/replay", func(w http.ResponseWriter, r *http.Request) {
+		f.write(w, r, models.ReplayResponse{
+			Request:  models.ReplayedRequest{Method: "POST", URL: "https://staging.example.com/checkout", BodyBytes: 12},
+			Response: &models.ReplayResult{StatusCode: 200, DurationMs: 42, Body: `{"ok":true}`},
+		})
+	})
+	mux.HandleFunc("DELETE /v1/failures/abc", func(w http.ResponseWriter, r *http.Request) {
+		f.write(w, r, models.DeleteFailureResponse{Status: "deleted", Objects: 5, Records: 2})
+	})
+	mux.HandleFunc("POST /admin/projects/myapp/purge", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(middleware.AdminKeyHeader) != "admin-secret" {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"title":"Unauthorized","detail":"invalid admin key"}`))
+			return
+		}
+		f.write(w, r, models.PurgeResponse{Project: "myapp", Purged: 3, Audit: "audit/retention/1.json"})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+
+	t.Setenv("FAILURECTL_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	t.Setenv("FAILURECTL_PROFILE", "")
+	t.Setenv("FAILURECTL_URL", f.srv.URL)
+	t.Setenv("FAILURECTL_API_KEY", "read-secret")
+	t.Setenv("FAILURECTL_TOKEN", "")
+	t.Setenv("FAILURECTL_ADMIN_KEY", "")
+	return f
+}
+
+func (f *fakeService) write(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body := new(bytes.Buffer)
+	body.ReadFrom(r.Body)
+	f.requests[r.Method+" "+r.URL.Path] = r
+	f.bodies[r.Method+" "+r.URL.Path] = body.Bytes()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// run runs command with args and returns its output
+func run(t *testing.T, command string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := commands[command](context.Background(), args, &out)
+	return out.String(), err
+}
+
+func TestList(t *testing.T) {
+	f := newFakeService(t)
+	out, err := run(t, "list", "-project", "myapp", "-env", "prod", "-days", "3", "-severity", "critical", "-tag", "feature:checkout", "-tag", "beta")
+	if err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+
+	r := f.requests["GET /v1/failures"]
+	if got := r.Header.Get(middleware.APIKeyHeader); got != "read-secret" {
+		t.Errorf("API key = %q", got)
+	}
+	q := r.URL.Query()
+	if q.Get("project") != "myapp" || q.Get("env") != "prod" || q.Get("days") != "3" || q.Get("limit") != "50" || q.Get("severity") != "critical" {
+		t.Errorf("query = %v", q)
+	}
+	if want := []string{"feature:checkout", "beta"}; !reflect.DeepEqual(q["tag"], want) {
+		t.Errorf("tags = %v, want %v", q["tag"], want)
+	}
+	for _, want := range []string{"CREATED", "2024-03-15T10:00:00Z", "abc", "POST https://api.example.com/checkout", "HTTP 500", "critical"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestList_JSON(t *testing.T) {
+	newFakeService(t)
+	out, err := run(t, "list", "-project", "myapp", "-env", "prod", "-o", "json")
+	if err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+	var resp models.FailuresResponse
+	if err := json.Unmarshal([]byte(out), &resp); err != nil || len(resp.Failures) != 1 || resp.Failures[0].S3Prefix != prefix {
+		t.Errorf("output = %s (%v)", out, err)
+	}
+}
+
+func TestGet_LocatesPrefix(t *testing.T) {
+	f := newFakeService(t)
+	out, err := run(t, "get", "abc", "-project", "myapp", "-env", "prod")
+	if err != nil {
+		t.Fatalf("get error = %v", err)
+	}
+	if got := f.requests["GET /v1/failures/abc"].URL.Query().Get("prefix"); got != prefix {
+		t.Errorf("prefix = %q, want the listed failure's", got)
+	}
+	for _, want := range []string{"Failure:", "myapp/prod", "HTTP 500", "Prefix:", prefix, "curl -X POST"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	newFakeService(t)
+	dir := t.TempDir()
+	out, err := run(t, "download", "abc", "-project", "myapp", "-env", "prod", "-prefix", prefix, "-dir", dir)
+	if err != nil {
+		t.Fatalf("download error = %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "abc", "files", "dump.txt"))
+	if err != nil || string(b) != "contents of dump.txt" {
+		t.Errorf("downloaded %q, %v", b, err)
+	}
+	if !strings.Contains(out, "files/dump.txt") || !strings.Contains(out, "20") {
+		t.Errorf("output = %s", out)
+	}
+}
+
+func TestArtifactPaths(t *testing.T) {
+	paths, err := artifactPaths("out/abc", []models.ArtifactDownload{{Name: "files/a.txt"}})
+	if err != nil || !reflect.DeepEqual(paths, []string{filepath.Join("out", "abc", "files", "a.txt")}) {
+		t.Errorf("artifactPaths() = %v, %v", paths, err)
+	}
+	for _, name := range []string{"../escape", "/etc/passwd", "files/../../escape"} {
+		if _, err := artifactPaths("out/abc", []models.ArtifactDownload{{Name: name}}); err == nil {
+			t.Errorf("artifactPaths(%q) error = nil", name)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	f := newFakeService(t)
+	out, err := run(t, "replay", "abc", "-project", "myapp", "-env", "prod", "-prefix", prefix,
+		"-base-url", "https://staging.example.com", "-header", "Authorization=Bearer test", "-header", "Cookie=")
+	if err != nil {
+		t.Fatalf("replay error = %v", err)
+	}
+
+	var req models.ReplayRequest
+	if err := json.Unmarshal(f.bodies["POST /v1/failures/abc/replay"], &req); err != nil {
+		t.Fatal(err)
+	}
+	want := models.ReplayRequest{
+		Project:  "myapp",
+		Env:      "prod",
+		S3Prefix: prefix,
+		BaseURL:  "https://staging.example.com",
+		Headers:  map[string]string{"Authorization": "Bearer test", "Cookie": ""},
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("replay request = %+v, want %+v", req, want)
+	}
+	for _, want := range []string{"https://staging.example.com/checkout", "12 bytes", "HTTP 200", "42 ms", `{"ok":true}`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	f := newFakeService(t)
+	if _, err := run(t, "purge", "abc", "-project", "myapp", "-env", "prod", "-prefix", prefix); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Errorf("purge without -yes error = %v", err)
+	}
+	if _, ok := f.requests["DELETE /v1/failures/abc"]; ok {
+		t.Fatal("purge without -yes deleted the failure")
+	}
+
+	out, err := run(t, "purge", "abc", "-project", "myapp", "-env", "prod", "-prefix", prefix, "-yes")
+	if err != nil {
+		t.Fatalf("purge error = %v", err)
+	}
+	if got := f.requests["DELETE /v1/failures/abc"].URL.Query().Get("prefix"); got != prefix {
+		t.Errorf("prefix = %q", got)
+	}
+	if !strings.Contains(out, "deleted") || !strings.Contains(out, "5") {
+		t.Errorf("output = %s", out)
+	}
+}
+
+func TestPurge_Project(t *testing.T) {
+	newFakeService(t)
+	if _, err := run(t, "purge", "-project", "myapp", "-yes"); err == nil || !strings.Contains(err.Error(), "admin key") {
+		t.Errorf("purge without an admin key error = %v", err)
+	}
+
+	// Problem details of error responses are reported
+	t.Setenv("FAILURECTL_ADMIN_KEY", "wrong")
+	if _, err := run(t, "purge", "-project", "myapp", "-yes"); err == nil || !strings.Contains(err.Error(), "invalid admin key") {
+		t.Errorf("purge with a wrong admin key error = %v", err)
+	}
+
+	t.Setenv("FAILURECTL_ADMIN_KEY", "admin-secret")
+	out, err := run(t, "purge", "-project", "myapp", "-yes")
+	if err != nil {
+		t.Fatalf("purge error = %v", err)
+	}
+	if !strings.Contains(out, "Purged:") || !strings.Contains(out, "audit/retention/1.json") {
+		t.Errorf("output = %s", out)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// printJSON writes v as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table writes aligned columns
+type table struct {
+	tw *tabwriter.Writer
+}
+
+func newTable(w io.Writer, headers ...string) *table {
+	t := &table{tw: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	t.row(headers...)
+	return t
+}
+
+func (t *table) row(cols ...string) {
+	for i, c := range cols {
+		// Tabs and newlines would break the alignment
+		cols[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(c)
+	}
+	fmt.Fprintln(t.tw, strings.Join(cols, "\t"))
+}
+
+func (t *table) flush() error {
+	return t.tw.Flush()
+}
+
+// facts writes name/value pairs, skipping empty values
+func facts(w io.Writer, pairs ...string) error {
+	t := &table{tw: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			t.row(pairs[i]+":", pairs[i+1])
+		}
+	}
+	return t.flush()
+}
+
+// artifactSlots lists the artifact slots a failure has, in a fixed order
+func artifactSlots(a *models.ArtifactPresence) string {
+	if a == nil {
+		return ""
+	}
+	var slots []string
+	for _, slot := range []struct {
+		name    string
+		present bool
+	}{{"logs", a.Logs}, {"screenshot", a.Screenshot}, {"console", a.Console}} {
+		if slot.present {
+			slots = append(slots, slot.name)
+		}
+	}
+	return strings.Join(slots, ", ")
+}
+
+// outcome describes how a failed request ended
+func outcome(statusCode int, errorClass string) string {
+	switch {
+	case statusCode > 0:
+		return fmt.Sprintf("HTTP %d", statusCode)
+	case errorClass != "":
+		return errorClass
+	default:
+		return "no response"
+	}
+}
+
+// truncate shortens s to n runes for table cells
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// printFailures writes the failures of list in format
+func printFailures(w io.Writer, format string, resp models.FailuresResponse) error {
+	if format == formatJSON {
+		return printJSON(w, resp)
+	}
+	t := newTable(w, "CREATED", "FAILURE", "REQUEST", "OUTCOME", "SEVERITY", "APP")
+	for _, f := range resp.Failures {
+		app := strings.TrimSpace(f.AppVersion + " " + f.Platform)
+		t.row(f.CreatedAt.UTC().Format(time.RFC3339), f.FailureID, truncate(f.Method+" "+f.URL, 60),
+			outcome(f.StatusCode, f.ErrorClass), f.Severity, app)
+	}
+	return t.flush()
+}
+
+// printFailure writes the failure of get, stored under prefix, in format
+func printFailure(w io.Writer, format string, resp models.FailureResponse, prefix string) error {
+	if format == formatJSON {
+		return printJSON(w, resp)
+	}
+
+	env := resp.Envelope
+	var status int
+	var errorClass, errorMessage string
+	if env.Response != nil {
+		status, errorClass, errorMessage = env.Response.StatusCode, env.Response.ErrorClass, env.Response.ErrorMessage
+	}
+	err := facts(w,
+		"Failure", env.FailureID,
+		"Project", env.Project+"/"+env.Env,
+		"Created", env.CreatedAt.UTC().Format(time.RFC3339),
+		"Request", env.Request.Method+" "+env.Request.URL,
+		"Outcome", outcome(status, errorClass),
+		"Error", errorMessage,
+		"Severity", env.Severity,
+		"Tags", strings.Join(sortedTags(env.Tags), ", "),
+		"Artifacts", artifactSlots(env.Artifacts),
+		"Group", env.GroupID,
+		"App", strings.TrimSpace(env.Client.AppVersion+" "+env.Client.Platform),
+		"Trace", strings.TrimSpace(env.Request.TraceID+" "+env.Request.SpanID),
+		"Request ID", env.Request.RequestID,
+		"Prefix", prefix,
+	)
+	if err != nil {
+		return err
+	}
+	if env.Description != "" {
+		fmt.Fprintf(w, "\n%s\n", env.Description)
+	}
+	if resp.Curl != "" {
+		fmt.Fprintf(w, "\n%s\n", resp.Curl)
+	}
+	return nil
+}
+
+// sortedTags returns tags as sorted key=value pairs
+func sortedTags(tags map[string]string) []string {
+	list := make([]string, 0, len(tags))
+	for k, v := range tags {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// downloaded is an artifact written by download
+type downloaded struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Path  string `json:"path"`
+}
+
+// printDownloads writes the downloaded files in format, with how to decrypt
+// them when enc is set
+func printDownloads(w io.Writer, format string, files []downloaded, enc *models.Encryption) error {
+	if format == formatJSON {
+		return printJSON(w, map[string]interface{}{"files": files, "encryption": enc})
+	}
+	t := newTable(w, "ARTIFACT", "BYTES", "PATH")
+	for _, f := range files {
+		t.row(f.Name, strconv.FormatInt(f.Bytes, 10), f.Path)
+	}
+	if err := t.flush(); err != nil {
+		return err
+	}
+	if enc != nil {
+		fmt.Fprintf(w, "\nArtifacts are encrypted client-side: %s, key %s, iv %s\n", enc.Algorithm, enc.KeyID, enc.IV)
+	}
+	return nil
+}
+
+// printReplay writes the outcome of replay in format
+func printReplay(w io.Writer, format string, resp models.ReplayResponse) error {
+	if format == formatJSON {
+		return printJSON(w, resp)
+	}
+	pairs := []string{
+		"Request", resp.Request.Method + " " + resp.Request.URL,
+		"Body", strconv.Itoa(resp.Request.BodyBytes) + " bytes",
+	}
+	if resp.DryRun {
+		pairs = append(pairs, "Sent", "no (dry run)")
+	} else if r := resp.Response; r != nil {
+		pairs = append(pairs,
+			"Outcome", outcome(r.StatusCode, r.Error),
+			"Duration", strconv.FormatInt(r.DurationMs, 10)+" ms",
+		)
+	}
+	if err := facts(w, pairs...); err != nil {
+		return err
+	}
+	if r := resp.Response; r != nil && r.Body != "" {
+		fmt.Fprintf(w, "\n%s\n", r.Body)
+	}
+	return nil
+}
+
+// printPurge writes the outcome of a project purge in format
+func printPurge(w io.Writer, format string, resp models.PurgeResponse) error {
+	if format == formatJSON {
+		return printJSON(w, resp)
+	}
+	return facts(w,
+		"Project", resp.Project,
+		"Purged", strconv.Itoa(resp.Purged),
+		"Failed", strconv.Itoa(resp.Failed),
+		"Audit", resp.Audit,
+	)
+}
+
+// printDeleted writes the outcome of deleting failure id in format
+func printDeleted(w io.Writer, format, id string, resp models.DeleteFailureResponse) error {
+	if format == formatJSON {
+		return printJSON(w, resp)
+	}
+	return facts(w,
+		"Failure", id,
+		"Status", resp.Status,
+		"Objects", strconv.Itoa(resp.Objects),
+		"Records", strconv.Itoa(resp.Records),
+	)
+}
@@ -2,168 +2,483 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"time"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/apigw"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/athena"
+	"github.com/yourorg/failure-uploader/internal/audit"
+	"github.com/yourorg/failure-uploader/internal/budget"
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/canary"
 	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/dedup"
 	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/eventbus"
+	"github.com/yourorg/failure-uploader/internal/github"
 	"github.com/yourorg/failure-uploader/internal/handlers"
+	"github.com/yourorg/failure-uploader/internal/headers"
+	"github.com/yourorg/failure-uploader/internal/health"
+	"github.com/yourorg/failure-uploader/internal/ipacl"
+	"github.com/yourorg/failure-uploader/internal/jwtauth"
+	"github.com/yourorg/failure-uploader/internal/links"
 	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/pagerduty"
+	"github.com/yourorg/failure-uploader/internal/placement"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/queue/consumer"
+	"github.com/yourorg/failure-uploader/internal/quota"
+	"github.com/yourorg/failure-uploader/internal/ratelimit"
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/reload"
+	"github.com/yourorg/failure-uploader/internal/replay"
+	"github.com/yourorg/failure-uploader/internal/retention"
 	"github.com/yourorg/failure-uploader/internal/router"
+	"github.com/yourorg/failure-uploader/internal/routing"
 	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/sentry"
+	"github.com/yourorg/failure-uploader/internal/sesevents"
+	"github.com/yourorg/failure-uploader/internal/signing"
+	"github.com/yourorg/failure-uploader/internal/thumbs"
+	"github.com/yourorg/failure-uploader/internal/usage"
+	"github.com/yourorg/failure-uploader/internal/verify"
 )
 
 var httpHandler http.Handler
 
+// auditRec buffers the audit records of an invocation; nil when auditing is off
+var auditRec *audit.Recorder
+
+// completions processes the SQS events of VERIFY_QUEUE_URL; nil unless it is set
+var completions verify.Processor
+
+// streaming streams Function URL responses (LAMBDA_RESPONSE_STREAMING)
+var streaming bool
+
+// spill stores buffered responses over Lambda's payload limit in S3
+var spill apigw.Spill
+
 func init() {
 	ctx := context.Background()
 
 	// Load configuration
-	cfg := config.Load()
+	cfg, cfgErr := config.Load()
 
 	// Initialize logging
-	logging.Init(cfg.Stage)
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		panic(cfgErr)
+	}
 
 	logging.Info().
 		Str("bucket", cfg.BucketName).
 		Str("region", cfg.AWSRegion).
 		Str("stage", cfg.Stage).
 		Bool("authEnabled", cfg.AuthEnabled).
+		Str("authMode", cfg.AuthMode).
+		Interface("build", buildinfo.Get()).
 		Msg("initializing failure-uploader")
 
-	// Initialize S3 presigner
-	presigner, err := s3client.NewPresigner(ctx, cfg.BucketName, cfg.AWSRegion, cfg.PresignTTL)
+	streaming = cfg.LambdaResponseStreaming
+
+	// Load API key registry
+	registry, err := apikeys.Load(cfg.APIKeysJSON, cfg.APIKey)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to load API keys")
+		panic(err)
+	}
+
+	// Load admin API credentials; the admin API is only mounted when some are set
+	adminRegistry, err := apikeys.LoadAdmin(cfg.AdminAPIKeys)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to load admin API keys")
+		panic(err)
+	}
+
+	// Configure bearer token verification (optional). API Gateway authorizer
+	// claims are mapped with the same options.
+	jwtOpts := jwtauth.Options{
+		Issuer:        cfg.JWTIssuer,
+		Audience:      cfg.JWTAudience,
+		ProjectClaim:  cfg.JWTProjectClaim,
+		TenantClaim:   cfg.JWTTenantClaim,
+		DefaultScopes: jwtauth.ParseScopes(cfg.JWTDefaultScopes),
+	}
+	var verifier *jwtauth.Verifier
+	if cfg.JWKSURL != "" {
+		verifier = jwtauth.NewVerifier(jwtauth.NewKeySet(cfg.JWKSURL, time.Hour), jwtOpts)
+	}
+
+	// Load HMAC signing keys (optional). Signed bodies are buffered to be
+	// verified, so they may be as large as the largest upload.
+	signatures, err := signing.Load(cfg.SigningKeys, cfg.SignatureMaxSkew, max(cfg.MaxBodyBytes, cfg.MaxFileBytes))
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to load signing keys")
+		panic(err)
+	}
+
+	// Sign the short and acknowledgment links of notifications when PUBLIC_URL is set
+	linkSigner, err := links.Load(cfg.PublicURL, cfg.LinkSecret, cfg.LinkTTL)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize link signing")
+		panic(err)
+	}
+
+	// Initialize rate limiters (disabled unless a rate is configured)
+	ipLimiter, err := ratelimit.New(ctx, cfg.RateLimitBackend, cfg.AWSRegion, cfg.RateLimitTable, "ip#", cfg.RateLimitIPRate, cfg.RateLimitIPBurst)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize IP rate limiter")
+		panic(err)
+	}
+	keyLimiter, err := ratelimit.New(ctx, cfg.RateLimitBackend, cfg.AWSRegion, cfg.RateLimitTable, "key#", cfg.RateLimitKeyRate, cfg.RateLimitKeyBurst)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize API key rate limiter")
+		panic(err)
+	}
+
+	// Initialize per-key usage analytics
+	usageStore, err := usage.New(ctx, cfg.UsageBackend, cfg.AWSRegion, cfg.UsageTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize usage store")
+		panic(err)
+	}
+
+	// Initialize per-project daily quota counters
+	quotaStore, err := quota.New(ctx, cfg.QuotaBackend, cfg.AWSRegion, cfg.QuotaTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize quota store")
+		panic(err)
+	}
+
+	// Initialize per-project stored byte counters for storage budgets
+	budgetStore, err := budget.New(ctx, cfg.StorageBudgetBackend, cfg.AWSRegion, cfg.StorageBudgetTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize storage budget store")
+		panic(err)
+	}
+
+	// Initialize S3 presigner with the storage destinations and KMS keys
+	store := cfg.StoreOptions()
+	presigner, err := s3client.New(ctx, store)
 	if err != nil {
 		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
 		panic(err)
 	}
 
-	// Initialize email sender (optional - may fail in dev)
-	var emailer *email.Sender
-	emailer, err = email.NewSender(ctx, cfg.AWSRegion, cfg.SESFrom, cfg.SESTo)
+	// Tag uploads and pick their storage class when presigning
+	placementPolicy, err := placement.New(cfg.ObjectTagging, cfg.LargeObjectStorageClass, cfg.LargeObjectMinBytes)
 	if err != nil {
-		logging.Warn().Err(err).Msg("failed to initialize email sender - notifications disabled")
-		emailer = nil
+		logging.Error().Err(err).Msg("invalid upload placement configuration")
+		panic(err)
 	}
+	presigner.WithPlacement(placementPolicy)
+	spill = apigw.NewSpill(presigner)
 
-	// Create handler and router
-	h := handlers.NewHandler(cfg, presigner, emailer)
-	httpHandler = router.New(cfg, h)
-}
+	// Load per-project email templates; an invalid template stops startup
+	var templates *email.Templates
+	if cfg.EmailTemplateBucket != "" {
+		templateStore, err := s3client.NewPresigner(ctx, cfg.EmailTemplateBucket, cfg.AWSRegion, cfg.PresignTTL, store.Endpoint)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize email template store")
+			panic(err)
+		}
+		templates, err = email.LoadTemplates(ctx, templateStore)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid email templates")
+			panic(err)
+		}
+		logging.Info().Int("projects", templates.Projects()).Msg("loaded email templates")
+	}
 
-func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	// Convert API Gateway request to http.Request
-	httpReq, err := convertRequest(ctx, req)
+	// Initialize email sender (optional - may fail in dev)
+	var emailer email.Notifier
+	sesPolicy := cfg.AWSPolicy("ses", cfg.SESTimeout)
+	sender, err := email.NewSender(ctx, email.Options{
+		Provider:         cfg.EmailProvider,
+		From:             cfg.SESFrom,
+		To:               cfg.SESTo,
+		Region:           cfg.AWSRegion,
+		ConfigurationSet: cfg.SESConfigurationSet,
+		Policy:           sesPolicy,
+		SMTPAddr:         cfg.SMTPAddr,
+		SMTPUsername:     cfg.SMTPUsername,
+		SMTPPassword:     cfg.SMTPPassword,
+		SendGridAPIKey:   cfg.SendGridAPIKey,
+	})
 	if err != nil {
-		logging.Error().Err(err).Msg("failed to convert request")
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       `{"error":"Internal server error"}`,
-			Headers:    map[string]string{"Content-Type": "application/json"},
-		}, nil
+		logging.Warn().Err(err).Msg("failed to initialize email sender - notifications disabled")
+	} else {
+		emailer = sender.WithSuppressions(sesevents.NewList(presigner)).WithTemplates(templates)
 	}
 
-	// Create response writer
-	rw := &responseWriter{
-		headers: make(http.Header),
-		body:    make([]byte, 0),
-		status:  200,
+	// Per-project upload limits, notification routes and API keys can be
+	// reloaded without a restart; requests read them from one snapshot
+	snapshots, err := reload.New(cfg, registry, adminRegistry)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid project profile or notification routing configuration")
+		panic(err)
 	}
 
-	// Handle request
-	httpHandler.ServeHTTP(rw, httpReq)
+	// Route failure notifications per project; unrouted failures are emailed to SES_TO
+	notifier := emailer
+	var routes routing.Editor
+	if cfg.NotifyRoutes != "" || cfg.NotifyRoutesBackend == "dynamodb" {
+		routes, err = routing.New(ctx, cfg.NotifyRoutesBackend, cfg.AWSRegion, cfg.NotifyRoutesTable, cfg.NotifyRoutes)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid notification routing configuration")
+			panic(err)
+		}
+		if _, static := routes.(*routing.Table); static {
+			routes = snapshots.Routes()
+		}
+		dispatcher := routing.NewDispatcher(routes, emailer)
+		if cfg.SlackBotToken != "" {
+			dispatcher.WithSlack(routing.NewSlack(cfg.SlackBotToken))
+		}
+		topics, err := routing.NewSNS(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize SNS publisher")
+			panic(err)
+		}
+		dispatcher.WithSNS(topics)
+		tokens, err := github.NewTokenSource(cfg.GitHubAPIURL, cfg.GitHubToken, cfg.GitHubAppID, cfg.GitHubAppInstallationID, cfg.GitHubAppPrivateKey)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid GitHub configuration")
+			panic(err)
+		}
+		if tokens != nil {
+			dispatcher.WithGitHub(github.NewIssues(github.NewClient(cfg.GitHubAPIURL, tokens), presigner))
+		}
+		dispatcher.WithPagerDuty(pagerduty.New(presigner, pagerduty.Options{
+			EventsURL: cfg.PagerDutyEventsURL,
+			Threshold: cfg.PagerDutyThreshold,
+			Window:    cfg.PagerDutyWindow,
+		}))
+		notifier = dispatcher
+	}
 
-	// Convert response
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: rw.status,
-		Body:       string(rw.body),
-		Headers:    flattenHeaders(rw.headers),
-	}, nil
-}
+	// Enqueue notifications for cmd/notifier instead of delivering them in the
+	// request; critical ones are still delivered inline
+	if cfg.NotifyQueueURL != "" {
+		sqsClient, err := queue.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize notification queue")
+			panic(err)
+		}
+		notifier = queue.NewPublisher(sqsClient, cfg.NotifyQueueURL).WithInline(notifier)
+	}
 
-func main() {
-	lambda.Start(handler)
-}
+	// Parse canary project routing
+	canarySelector, err := canary.Parse(cfg.CanaryProjects)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid canary configuration")
+		panic(err)
+	}
 
-// convertRequest converts API Gateway request to http.Request
-func convertRequest(ctx context.Context, req events.APIGatewayV2HTTPRequest) (*http.Request, error) {
-	httpReq, err := http.NewRequestWithContext(
-		ctx,
-		req.RequestContext.HTTP.Method,
-		req.RawPath,
-		nil,
-	)
+	// Parse per-route-group IP allow and deny lists
+	ipACLs, err := ipacl.Parse(cfg.IPACLs)
 	if err != nil {
-		return nil, err
+		logging.Error().Err(err).Msg("invalid IP ACL configuration")
+		panic(err)
 	}
 
-	// Set headers
-	for k, v := range req.Headers {
-		httpReq.Header.Set(k, v)
+	// Build redaction rules for stored metadata
+	redactRules, err := redact.ParseRules(cfg.RedactHeaders, cfg.RedactJSONFields, cfg.RedactPatterns)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid redaction configuration")
+		panic(err)
+	}
+	redactor, err := redact.New(redactRules)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid redaction configuration")
+		panic(err)
 	}
 
-	// Set body
-	if req.Body != "" {
-		httpReq.Body = &stringReader{s: req.Body, i: 0}
+	// Build per-project header capture policies
+	headerPolicies, err := headers.ParsePolicies(cfg.HeaderPolicies)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid header policy configuration")
+		panic(err)
 	}
 
-	// Set query parameters
-	q := httpReq.URL.Query()
-	for k, v := range req.QueryStringParameters {
-		q.Set(k, v)
+	// Parse retention policies for purges triggered through the admin API
+	retentionPolicies, err := retention.Parse(cfg.RetentionPolicies, cfg.RetentionDays)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid retention configuration")
+		panic(err)
 	}
-	httpReq.URL.RawQuery = q.Encode()
 
-	return httpReq, nil
-}
+	// Load API keys managed through the admin API and re-read them periodically
+	if err := registry.Sync(ctx, presigner); err != nil {
+		logging.Warn().Err(err).Msg("failed to load managed API keys")
+	}
+	if cfg.APIKeySyncInterval > 0 {
+		go registry.Watch(ctx, presigner, cfg.APIKeySyncInterval)
+	}
 
-// responseWriter implements http.ResponseWriter for Lambda
-type responseWriter struct {
-	headers http.Header
-	body    []byte
-	status  int
-}
+	// Re-read API keys kept in Secrets Manager or SSM, so rotated keys take
+	// effect without a restart
+	if cfg.SecretsRefreshInterval > 0 {
+		go cfg.Secrets.Watch(ctx, "API_KEYS", cfg.SecretsRefreshInterval, func(keysJSON string) error {
+			next, err := apikeys.Load(keysJSON, cfg.APIKey)
+			if err != nil {
+				return err
+			}
+			registry.SetConfigured(next)
+			return nil
+		})
+		go cfg.Secrets.Watch(ctx, "ADMIN_API_KEYS", cfg.SecretsRefreshInterval, func(keysJSON string) error {
+			next, err := apikeys.LoadAdmin(keysJSON)
+			if err != nil {
+				return err
+			}
+			adminRegistry.SetConfigured(next)
+			return nil
+		})
+	}
 
-func (rw *responseWriter) Header() http.Header {
-	return rw.headers
-}
+	// Reload periodically; the environment of a Lambda is fixed, so settings
+	// change through secret references, which are re-read on each reload
+	if cfg.ConfigReloadInterval > 0 {
+		go snapshots.Watch(ctx, cfg.ConfigReloadInterval)
+	}
 
-func (rw *responseWriter) Write(b []byte) (int, error) {
-	rw.body = append(rw.body, b...)
-	return len(b), nil
-}
+	// Record auth failures, admin actions and usage (optional)
+	auditRec, err = audit.New(cfg.AuditSink, presigner)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid audit configuration")
+		panic(err)
+	}
 
-func (rw *responseWriter) WriteHeader(status int) {
-	rw.status = status
-}
+	// Readiness checks S3 and, optionally, the SES account and sender identity
+	checks := []health.Check{{Name: "s3", Critical: true, Run: presigner.HeadBucket, Breaker: store.Endpoint.Policy.Breaker.State}}
+	if cfg.HealthCheckSES && sender != nil {
+		checks = append(checks, health.Check{Name: "ses", Run: sender.Check, Breaker: sesPolicy.Breaker.State})
+	}
 
-// stringReader implements io.ReadCloser for request body
-type stringReader struct {
-	s string
-	i int
-}
+	// Email projects nearing their daily quotas to SES_TO
+	var quotaAlerts quota.Notifier
+	if emailer != nil {
+		quotaAlerts = sender
+	}
 
-func (sr *stringReader) Read(p []byte) (n int, err error) {
-	if sr.i >= len(sr.s) {
-		return 0, nil
+	// Create handler and router
+	h := handlers.NewHandler(cfg, presigner, notifier).
+		WithCanary(canarySelector).
+		WithRedactor(redactor).
+		WithHeaderPolicies(headerPolicies).
+		WithReload(snapshots).
+		WithUsage(usageStore).
+		WithQuotas(quota.NewEnforcer(quotaStore, quotaAlerts, cfg.QuotaAlertPercent)).
+		WithStorageBudget(budget.NewTracker(budgetStore)).
+		WithReplayer(replay.New(cfg.ReplayAllowedHosts, cfg.ReplayTimeout)).
+		WithAPIKeys(registry).
+		WithRoutes(routes).
+		WithRetention(retentionPolicies).
+		WithLinks(linkSigner).
+		WithHealth(health.New(cfg.HealthCheckTimeout, checks...))
+	// Re-check uploads that are not visible yet; in async mode queue completions
+	// and verify them from the verification queue, which also carries the
+	// completions of cmd/autocomplete
+	h.WithVerification(verify.New(cfg.VerifyAttempts, cfg.VerifyRetryWindow))
+	if cfg.VerifyQueueURL != "" {
+		sqsClient, err := queue.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize verification queue")
+			panic(err)
+		}
+		if cfg.VerifyMode == verify.ModeAsync {
+			h.WithPendingVerification(verify.NewPublisher(sqsClient, cfg.VerifyQueueURL))
+		}
+		completions = h
 	}
-	n = copy(p, sr.s[sr.i:])
-	sr.i += n
-	return n, nil
-}
+	if cfg.DedupWindow > 0 {
+		h.WithDedup(dedup.New(presigner, cfg.DedupWindow))
+	}
+	if cfg.SESEventsTopicARN != "" {
+		h.WithSESEvents(sesevents.NewVerifier())
+	}
+	if cfg.EventBusName != "" {
+		eventsClient, err := eventbus.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize event bus")
+			panic(err)
+		}
+		h.WithEvents(eventbus.New(eventsClient, cfg.EventBusName, cfg.EventSource))
+	}
+	if cfg.SentryDSN != "" {
+		dsn, err := sentry.ParseDSN(cfg.SentryDSN)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid SENTRY_DSN")
+			panic(err)
+		}
+		h.WithSentry(sentry.New(dsn))
+	}
+	if cfg.ThumbnailQueueURL != "" {
+		sqsClient, err := queue.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize thumbnail queue")
+			panic(err)
+		}
+		h.WithThumbnails(thumbs.NewPublisher(sqsClient, cfg.ThumbnailQueueURL))
+	}
+	if cfg.MetadataIndex && cfg.GlueDatabase != "" {
+		catalog, err := athena.NewCatalog(ctx, cfg.AWSRegion, cfg.GlueDatabase, cfg.GlueTable, presigner.Bucket())
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize glue catalog")
+			panic(err)
+		}
+		h.WithCatalog(catalog)
+	}
+	httpHandler = router.New(cfg, h, router.Deps{
+		Registry:   registry,
+		Verifier:   verifier,
+		IPLimiter:  ipLimiter,
+		KeyLimiter: keyLimiter,
+		Usage:      usageStore,
+		Signatures: signatures,
+		Authorizer: jwtauth.NewAuthorizer(jwtOpts),
 
-func (sr *stringReader) Close() error {
-	return nil
+		AdminRegistry: adminRegistry,
+		Audit:         auditRec,
+		IPACLs:        ipACLs,
+	})
 }
 
-// flattenHeaders converts http.Header to map[string]string
-func flattenHeaders(h http.Header) map[string]string {
-	result := make(map[string]string)
-	for k, v := range h {
-		if len(v) > 0 {
-			result[k] = v[0]
+// handler serves API Gateway v2, Lambda Function URL and ALB events, and the
+// verification queue's SQS events when it is configured, and emits
+// the invocation's metrics in CloudWatch Embedded Metric Format. Buffered
+// responses over Lambda's payload limit are stored in S3 and redirected to. Audit
+// records are written before the response ends, since a frozen or recycled
+// execution environment would lose them.
+func handler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	flush := func() {
+		if err := metrics.FlushEMF(); err != nil {
+			logging.Warn().Err(err).Msg("failed to emit metrics")
 		}
+		if err := auditRec.Flush(ctx); err != nil {
+			logging.Error().Err(err).Msg("failed to write audit records")
+		}
+	}
+	if event, ok := consumer.SQSEvent(payload); ok && completions != nil {
+		defer flush()
+		return verify.Handle(ctx, completions, event), nil
 	}
-	return result
+	if streaming {
+		// Streamed responses outlive this call; flush runs once the handler is done
+		return apigw.ServeStream(ctx, httpHandler, payload, spill, flush)
+	}
+	defer flush()
+	return apigw.Serve(ctx, httpHandler, payload, spill)
+}
+
+func main() {
+	lambda.Start(handler)
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/archive"
+	"github.com/yourorg/failure-uploader/internal/budget"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/eventbus"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/retention"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/sesevents"
+)
+
+// Runs the daily archive transition and expiry notices once from the command
+// line, or as a Lambda handler for an EventBridge schedule when deployed to Lambda.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	storageClass, err := archive.ParseStorageClass(cfg.ArchiveStorageClass)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid archive configuration")
+		os.Exit(1)
+	}
+
+	retentionPolicies, err := retention.Parse(cfg.RetentionPolicies, cfg.RetentionDays)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid retention configuration")
+		os.Exit(1)
+	}
+
+	policy := archive.Policy{
+		RetentionDays:    cfg.RetentionDays,
+		ArchiveAfterDays: cfg.ArchiveAfterDays,
+		NoticeDays:       cfg.ExpiryNoticeDays,
+		StorageClass:     storageClass,
+		Retention:        retentionPolicies,
+	}
+
+	// Failures are archived, expired and purged in every storage destination
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	// Initialize email sender (optional - notices are skipped without it)
+	var notifier archive.Notifier
+	emailer, err := email.NewSender(ctx, email.Options{
+		Provider:         cfg.EmailProvider,
+		From:             cfg.SESFrom,
+		To:               cfg.SESTo,
+		Region:           cfg.AWSRegion,
+		ConfigurationSet: cfg.SESConfigurationSet,
+		Policy:           cfg.AWSPolicy("ses", cfg.SESTimeout),
+		SMTPAddr:         cfg.SMTPAddr,
+		SMTPUsername:     cfg.SMTPUsername,
+		SMTPPassword:     cfg.SMTPPassword,
+		SendGridAPIKey:   cfg.SendGridAPIKey,
+	})
+	if err != nil {
+		logging.Warn().Err(err).Msg("failed to initialize email sender - expiry notices disabled")
+	} else {
+		notifier = emailer.WithSuppressions(sesevents.NewList(presigner))
+	}
+
+	// Publish a failure.purged event per purged failure (optional)
+	var bus *eventbus.Bus
+	if cfg.EventBusName != "" {
+		eventsClient, err := eventbus.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize event bus")
+			os.Exit(1)
+		}
+		bus = eventbus.New(eventsClient, cfg.EventBusName, cfg.EventSource)
+	}
+
+	// Uncount purged failures from the projects' stored bytes
+	budgetStore, err := budget.New(ctx, cfg.StorageBudgetBackend, cfg.AWSRegion, cfg.StorageBudgetTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize storage budget store")
+		os.Exit(1)
+	}
+	storage := budget.NewTracker(budgetStore)
+
+	run := func(ctx context.Context, now time.Time) error {
+		logging.Info().
+			Str("bucket", cfg.BucketName).
+			Int("retentionDays", policy.RetentionDays).
+			Int("archiveAfterDays", policy.ArchiveAfterDays).
+			Int("noticeDays", policy.NoticeDays).
+			Ints("retentionPeriods", retentionPolicies.Periods()).
+			Msg("running lifecycle job")
+		if err := archive.Run(ctx, presigner, notifier, policy, now); err != nil {
+			return err
+		}
+		if len(retentionPolicies.Periods()) == 0 {
+			return nil
+		}
+		audit, err := retention.Purge(ctx, presigner, retentionPolicies, now)
+		for project, bytes := range audit.BytesByProject() {
+			storage.Release(ctx, project, bytes)
+		}
+		if perr := bus.Publish(ctx, eventbus.RetentionPurges(audit)...); perr != nil {
+			logging.Warn().Err(perr).Msg("failed to publish purge events")
+		}
+		return err
+	}
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+			if event.Time.IsZero() {
+				return run(ctx, time.Now())
+			}
+			return run(ctx, event.Time)
+		})
+		return
+	}
+
+	if err := run(ctx, time.Now()); err != nil {
+		logging.Error().Err(err).Msg("lifecycle job failed")
+		os.Exit(1)
+	}
+}
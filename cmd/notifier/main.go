@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/github"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/pagerduty"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/routing"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/sesevents"
+)
+
+// Delivers the failure notifications the API enqueued to NOTIFY_QUEUE_URL.
+// Deployed to Lambda it handles the queue's SQS events; otherwise it polls the
+// queue until interrupted.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	// S3 holds the bounce suppression list and the GitHub and PagerDuty state of routed
+	// notifications
+	store := cfg.StoreOptions()
+	presigner, err := s3client.New(ctx, store)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	// Load per-project email templates; an invalid template stops startup
+	var templates *email.Templates
+	if cfg.EmailTemplateBucket != "" {
+		templateStore, err := s3client.NewPresigner(ctx, cfg.EmailTemplateBucket, cfg.AWSRegion, cfg.PresignTTL, store.Endpoint)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize email template store")
+			os.Exit(1)
+		}
+		templates, err = email.LoadTemplates(ctx, templateStore)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid email templates")
+			os.Exit(1)
+		}
+	}
+
+	// Initialize email sender (optional when every route uses other channels)
+	var emailer email.Notifier
+	sender, err := email.NewSender(ctx, email.Options{
+		Provider:         cfg.EmailProvider,
+		From:             cfg.SESFrom,
+		To:               cfg.SESTo,
+		Region:           cfg.AWSRegion,
+		ConfigurationSet: cfg.SESConfigurationSet,
+		Policy:           cfg.AWSPolicy("ses", cfg.SESTimeout),
+		SMTPAddr:         cfg.SMTPAddr,
+		SMTPUsername:     cfg.SMTPUsername,
+		SMTPPassword:     cfg.SMTPPassword,
+		SendGridAPIKey:   cfg.SendGridAPIKey,
+	})
+	if err != nil {
+		logging.Warn().Err(err).Msg("failed to initialize email sender - only routed channels can be notified")
+	} else {
+		emailer = sender.WithSuppressions(sesevents.NewList(presigner)).WithTemplates(templates)
+	}
+
+	// Route failure notifications per project; unrouted failures are emailed to SES_TO
+	routes, err := routing.New(ctx, cfg.NotifyRoutesBackend, cfg.AWSRegion, cfg.NotifyRoutesTable, cfg.NotifyRoutes)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid notification routing configuration")
+		os.Exit(1)
+	}
+	dispatcher := routing.NewDispatcher(routes, emailer)
+	if cfg.SlackBotToken != "" {
+		dispatcher.WithSlack(routing.NewSlack(cfg.SlackBotToken))
+	}
+	topics, err := routing.NewSNS(ctx, cfg.AWSRegion)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize SNS publisher")
+		os.Exit(1)
+	}
+	dispatcher.WithSNS(topics)
+	tokens, err := github.NewTokenSource(cfg.GitHubAPIURL, cfg.GitHubToken, cfg.GitHubAppID, cfg.GitHubAppInstallationID, cfg.GitHubAppPrivateKey)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid GitHub configuration")
+		os.Exit(1)
+	}
+	if tokens != nil {
+		dispatcher.WithGitHub(github.NewIssues(github.NewClient(cfg.GitHubAPIURL, tokens), presigner))
+	}
+	dispatcher.WithPagerDuty(pagerduty.New(presigner, pagerduty.Options{
+		EventsURL: cfg.PagerDutyEventsURL,
+		Threshold: cfg.PagerDutyThreshold,
+		Window:    cfg.PagerDutyWindow,
+	}))
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+			resp := queue.Handle(ctx, dispatcher, event)
+			if ferr := metrics.FlushEMF(); ferr != nil {
+				logging.Warn().Err(ferr).Msg("failed to emit metrics")
+			}
+			return resp, nil
+		})
+		return
+	}
+
+	if cfg.NotifyQueueURL == "" {
+		logging.Error().Msg("NOTIFY_QUEUE_URL is required")
+		os.Exit(1)
+	}
+	client, err := queue.NewClient(ctx, cfg.AWSRegion)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize notification queue")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logging.Info().Str("queue", cfg.NotifyQueueURL).Msg("delivering queued notifications")
+	queue.Poll(ctx, client, cfg.NotifyQueueURL, dispatcher)
+	logging.Info().Msg("notification worker stopped")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+// Deletes the partial uploads of abandoned tickets once from the command line,
+// or as a Lambda handler for an EventBridge schedule when deployed to Lambda.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	// Tickets are read from S3 and abandoned uploads deleted from each failure's bucket
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	run := func(ctx context.Context, now time.Time) error {
+		logging.Info().
+			Str("bucket", cfg.BucketName).
+			Dur("maxAge", cfg.TicketMaxAge).
+			Msg("reaping abandoned tickets")
+		_, err := tickets.Reap(ctx, presigner, cfg.TicketMaxAge, now.UTC())
+		if ferr := metrics.FlushEMF(); ferr != nil {
+			logging.Warn().Err(ferr).Msg("failed to emit metrics")
+		}
+		return err
+	}
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+			if event.Time.IsZero() {
+				return run(ctx, time.Now())
+			}
+			return run(ctx, event.Time)
+		})
+		return
+	}
+
+	if err := run(ctx, time.Now()); err != nil {
+		logging.Error().Err(err).Msg("reaper run failed")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/scan"
+)
+
+// Applies malware scan results to uploaded objects, quarantining infected
+// ones. Deployed to Lambda it handles the events of SCAN_QUEUE_URL, or
+// GuardDuty and ClamAV results delivered directly by EventBridge or SNS;
+// otherwise it polls the queue until interrupted.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	// Infected objects are quarantined in their failure's bucket under its KMS key
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	worker := scan.NewWorker(presigner)
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			resp, err := worker.Handle(ctx, payload)
+			if ferr := metrics.FlushEMF(); ferr != nil {
+				logging.Warn().Err(ferr).Msg("failed to emit metrics")
+			}
+			return resp, err
+		})
+		return
+	}
+
+	if cfg.ScanQueueURL == "" {
+		logging.Error().Msg("SCAN_QUEUE_URL is required")
+		os.Exit(1)
+	}
+	client, err := queue.NewClient(ctx, cfg.AWSRegion)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize SQS client")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logging.Info().Str("queue", cfg.ScanQueueURL).Msg("applying malware scan results")
+	worker.Poll(ctx, client, cfg.ScanQueueURL)
+	logging.Info().Msg("scan result worker stopped")
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// endpoint is a representative failing request. Failures are drawn from a
+// small fixed set so repeated occurrences of the same endpoint form groups.
+type endpoint struct {
+	method      string
+	url         string
+	contentType string
+	status      int
+}
+
+var endpoints = []endpoint{
+	{method: "POST", url: "https://api.example.com/v1/orders", contentType: "application/json", status: 500},
+	{method: "GET", url: "https://api.example.com/v1/profile", contentType: "", status: 503},
+	{method: "PUT", url: "https://api.example.com/v1/profile/avatar", contentType: "multipart/form-data", status: 413},
+	{method: "POST", url: "https://api.example.com/v1/auth/refresh", contentType: "application/json", status: 401},
+	{method: "DELETE", url: "https://api.example.com/v1/cart/items/42", contentType: "", status: 404},
+}
+
+var (
+	platforms   = []string{"ios", "android", "web", "desktop"}
+	appVersions = []string{"1.0.0", "1.1.0", "1.2.3", "2.0.0-beta.1"}
+)
+
+func main() {
+	baseURL := flag.String("base-url", "http://localhost:8080", "failure-uploader base URL")
+	apiKey := flag.String("api-key", os.Getenv("API_KEY"), "API key sent in the X-Api-Key header")
+	projects := flag.String("projects", "myapp,checkout,internal-tools", "comma-separated projects to seed")
+	envs := flag.String("envs", "dev,staging,prod", "comma-separated envs to seed")
+	count := flag.Int("count", 10, "failures to create per project/env")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed for reproducible fixtures")
+	flag.Parse()
+
+	logging.Init(logging.Options{Stage: "dev"})
+
+	s := &seeder{
+		baseURL: strings.TrimRight(*baseURL, "/"),
+		apiKey:  *apiKey,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		rnd:     rand.New(rand.NewSource(*seed)),
+	}
+
+	ctx := context.Background()
+	var created, failed int
+	for _, project := range splitList(*projects) {
+		for _, env := range splitList(*envs) {
+			for i := 0; i < *count; i++ {
+				failureID, err := s.seedFailure(ctx, project, env)
+				if err != nil {
+					failed++
+					logging.Error().Err(err).Str("project", project).Str("env", env).Msg("failed to seed failure")
+					continue
+				}
+				created++
+				logging.Debug().Str("failureId", failureID).Str("project", project).Str("env", env).Msg("seeded failure")
+			}
+		}
+	}
+
+	logging.Info().Int("created", created).Int("failed", failed).Msg("seeding finished")
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// artifact is a single object to PUT to its presigned URL
+type artifact struct {
+	upload      models.PresignedUpload
+	contentType string
+	data        []byte
+}
+
+type seeder struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+	rnd     *rand.Rand
+}
+
+// seedFailure runs the full ticket -> upload -> complete flow for one failure
+func (s *seeder) seedFailure(ctx context.Context, project, env string) (string, error) {
+	ep := endpoints[s.rnd.Intn(len(endpoints))]
+	client := models.ClientInfo{
+		AppVersion: appVersions[s.rnd.Intn(len(appVersions))],
+		Platform:   platforms[s.rnd.Intn(len(platforms))],
+	}
+
+	body := []byte(fmt.Sprintf(`{"seed":true,"n":%d}`, s.rnd.Intn(100000)))
+	if ep.contentType == "" {
+		body = nil
+	}
+
+	var files []models.FileInfo
+	var fileData [][]byte
+	if ep.contentType == "multipart/form-data" {
+		data := bytes.Repeat([]byte{0xFF}, 1024+s.rnd.Intn(4096))
+		files = append(files, models.FileInfo{Name: "avatar", Filename: "avatar.jpg", ContentType: "image/jpeg", Bytes: int64(len(data))})
+		fileData = append(fileData, data)
+	}
+
+	ticketReq := models.UploadTicketRequest{
+		Project: project,
+		Env:     env,
+		Request: models.RequestInfo{
+			Method:      ep.method,
+			URL:         ep.url,
+			ContentType: ep.contentType,
+			BodyBytes:   int64(len(body)),
+			Files:       files,
+		},
+		Client: client,
+	}
+
+	var ticket models.UploadTicketResponse
+	if err := s.postJSON(ctx, "/v1/upload-ticket", ticketReq, &ticket); err != nil {
+		return "", fmt.Errorf("upload ticket: %w", err)
+	}
+
+	envelope, err := json.Marshal(models.Envelope{
+		FailureID: ticket.FailureID,
+		Project:   project,
+		Env:       env,
+		Request:   ticketReq.Request,
+		Client:    client,
+		CreatedAt: time.Now().UTC(),
+		S3Prefix:  ticket.S3Prefix,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	headers := []byte(`{"Accept":["application/json"],"User-Agent":["seed/1.0"]}`)
+	response := []byte(fmt.Sprintf(`{"error":"seeded failure","status":%d}`, ep.status))
+
+	requestCT := ep.contentType
+	if requestCT == "" {
+		requestCT = "application/octet-stream"
+	}
+
+	artifacts := []artifact{
+		{ticket.Uploads.Envelope, "application/json", envelope},
+		{ticket.Uploads.RequestRaw, requestCT, body},
+		{ticket.Uploads.RequestHeaders, "application/json", headers},
+		{ticket.Uploads.ResponseRaw, "application/octet-stream", response},
+	}
+	for i, f := range ticket.Uploads.Files {
+		artifacts = append(artifacts, artifact{f, files[i].ContentType, fileData[i]})
+	}
+
+	sums := make(map[string]string, len(artifacts))
+	for _, a := range artifacts {
+		sum := sha256.Sum256(a.data)
+		sums[a.upload.Key] = hex.EncodeToString(sum[:])
+	}
+
+	checksums, err := json.Marshal(sums)
+	if err != nil {
+		return "", err
+	}
+	artifacts = append(artifacts, artifact{ticket.Uploads.Checksums, "application/json", checksums})
+
+	var uploaded []string
+	for _, a := range artifacts {
+		if err := s.put(ctx, a.upload, a.contentType, a.data); err != nil {
+			return "", fmt.Errorf("upload %s: %w", a.upload.Key, err)
+		}
+		uploaded = append(uploaded, a.upload.Key)
+	}
+
+	completeReq := models.UploadCompleteRequest{
+		FailureID:    ticket.FailureID,
+		Project:      project,
+		Env:          env,
+		UploadedKeys: uploaded,
+		SHA256:       sums,
+	}
+	var completeResp models.UploadCompleteResponse
+	if err := s.postJSON(ctx, "/v1/upload-complete", completeReq, &completeResp); err != nil {
+		return "", fmt.Errorf("upload complete: %w", err)
+	}
+
+	return ticket.FailureID, nil
+}
+
+func (s *seeder) postJSON(ctx context.Context, path string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set(middleware.APIKeyHeader, s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// put uploads data with the headers signed into the presigned URL, such as
+// the SSE-KMS ones, which S3 rejects the PUT without
+func (s *seeder) put(ctx context.Context, upload models.PresignedUpload, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, upload.PutURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for h, v := range upload.Headers {
+		req.Header.Set(h, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("PUT returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -2,65 +2,458 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/athena"
+	"github.com/yourorg/failure-uploader/internal/audit"
+	"github.com/yourorg/failure-uploader/internal/budget"
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/canary"
 	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/dedup"
 	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/eventbus"
+	"github.com/yourorg/failure-uploader/internal/github"
+	"github.com/yourorg/failure-uploader/internal/grpcapi"
 	"github.com/yourorg/failure-uploader/internal/handlers"
+	"github.com/yourorg/failure-uploader/internal/headers"
+	"github.com/yourorg/failure-uploader/internal/health"
+	"github.com/yourorg/failure-uploader/internal/ipacl"
+	"github.com/yourorg/failure-uploader/internal/jwtauth"
+	"github.com/yourorg/failure-uploader/internal/links"
 	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/pagerduty"
+	"github.com/yourorg/failure-uploader/internal/placement"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/quota"
+	"github.com/yourorg/failure-uploader/internal/ratelimit"
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/reload"
+	"github.com/yourorg/failure-uploader/internal/replay"
+	"github.com/yourorg/failure-uploader/internal/retention"
 	"github.com/yourorg/failure-uploader/internal/router"
+	"github.com/yourorg/failure-uploader/internal/routing"
 	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/sentry"
+	"github.com/yourorg/failure-uploader/internal/sesevents"
+	"github.com/yourorg/failure-uploader/internal/signing"
+	"github.com/yourorg/failure-uploader/internal/thumbs"
+	"github.com/yourorg/failure-uploader/internal/usage"
+	"github.com/yourorg/failure-uploader/internal/verify"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
 )
 
 func main() {
 	ctx := context.Background()
 
 	// Load configuration
-	cfg := config.Load()
+	cfg, cfgErr := config.Load()
 
 	// Initialize logging
-	logging.Init(cfg.Stage)
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
 
 	logging.Info().
 		Str("bucket", cfg.BucketName).
 		Str("region", cfg.AWSRegion).
 		Str("stage", cfg.Stage).
 		Bool("authEnabled", cfg.AuthEnabled).
+		Str("authMode", cfg.AuthMode).
+		Interface("build", buildinfo.Get()).
 		Msg("starting failure-uploader server")
+	if cfg.AuthEnabled && cfg.AuthMode == middleware.AuthModeAuthorizer {
+		logging.Warn().Msg("AUTH_MODE=authorizer needs API Gateway authorizer claims, which only the Lambda receives; unsigned requests will be rejected")
+	}
+
+	// Load API key registry
+	registry, err := apikeys.Load(cfg.APIKeysJSON, cfg.APIKey)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to load API keys")
+		os.Exit(1)
+	}
+
+	// Load admin API credentials; the admin API is only mounted when some are set
+	adminRegistry, err := apikeys.LoadAdmin(cfg.AdminAPIKeys)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to load admin API keys")
+		os.Exit(1)
+	}
+
+	// Configure bearer token verification (optional). API Gateway authorizer
+	// claims are mapped with the same options.
+	jwtOpts := jwtauth.Options{
+		Issuer:        cfg.JWTIssuer,
+		Audience:      cfg.JWTAudience,
+		ProjectClaim:  cfg.JWTProjectClaim,
+		TenantClaim:   cfg.JWTTenantClaim,
+		DefaultScopes: jwtauth.ParseScopes(cfg.JWTDefaultScopes),
+	}
+	var verifier *jwtauth.Verifier
+	if cfg.JWKSURL != "" {
+		verifier = jwtauth.NewVerifier(jwtauth.NewKeySet(cfg.JWKSURL, time.Hour), jwtOpts)
+	}
+
+	// Load HMAC signing keys (optional). Signed bodies are buffered to be
+	// verified, so they may be as large as the largest upload.
+	signatures, err := signing.Load(cfg.SigningKeys, cfg.SignatureMaxSkew, max(cfg.MaxBodyBytes, cfg.MaxFileBytes))
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to load signing keys")
+		os.Exit(1)
+	}
+
+	// Sign the short and acknowledgment links of notifications when PUBLIC_URL is set
+	linkSigner, err := links.Load(cfg.PublicURL, cfg.LinkSecret, cfg.LinkTTL)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize link signing")
+		os.Exit(1)
+	}
+
+	// Initialize rate limiters (disabled unless a rate is configured)
+	ipLimiter, err := ratelimit.New(ctx, cfg.RateLimitBackend, cfg.AWSRegion, cfg.RateLimitTable, "ip#", cfg.RateLimitIPRate, cfg.RateLimitIPBurst)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize IP rate limiter")
+		os.Exit(1)
+	}
+	keyLimiter, err := ratelimit.New(ctx, cfg.RateLimitBackend, cfg.AWSRegion, cfg.RateLimitTable, "key#", cfg.RateLimitKeyRate, cfg.RateLimitKeyBurst)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize API key rate limiter")
+		os.Exit(1)
+	}
 
-	// Initialize S3 presigner
-	presigner, err := s3client.NewPresigner(ctx, cfg.BucketName, cfg.AWSRegion, cfg.PresignTTL)
+	// Initialize per-key usage analytics
+	usageStore, err := usage.New(ctx, cfg.UsageBackend, cfg.AWSRegion, cfg.UsageTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize usage store")
+		os.Exit(1)
+	}
+
+	// Initialize per-project daily quota counters
+	quotaStore, err := quota.New(ctx, cfg.QuotaBackend, cfg.AWSRegion, cfg.QuotaTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize quota store")
+		os.Exit(1)
+	}
+
+	// Initialize per-project stored byte counters for storage budgets
+	budgetStore, err := budget.New(ctx, cfg.StorageBudgetBackend, cfg.AWSRegion, cfg.StorageBudgetTable)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize storage budget store")
+		os.Exit(1)
+	}
+
+	// Initialize S3 presigner with the storage destinations and KMS keys
+	store := cfg.StoreOptions()
+	presigner, err := s3client.New(ctx, store)
 	if err != nil {
 		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
 		os.Exit(1)
 	}
 
+	// Tag uploads and pick their storage class when presigning
+	placementPolicy, err := placement.New(cfg.ObjectTagging, cfg.LargeObjectStorageClass, cfg.LargeObjectMinBytes)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid upload placement configuration")
+		os.Exit(1)
+	}
+	presigner.WithPlacement(placementPolicy)
+
+	// Load per-project email templates; an invalid template stops startup
+	var templates *email.Templates
+	if cfg.EmailTemplateBucket != "" {
+		templateStore, err := s3client.NewPresigner(ctx, cfg.EmailTemplateBucket, cfg.AWSRegion, cfg.PresignTTL, store.Endpoint)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize email template store")
+			os.Exit(1)
+		}
+		templates, err = email.LoadTemplates(ctx, templateStore)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid email templates")
+			os.Exit(1)
+		}
+		logging.Info().Int("projects", templates.Projects()).Msg("loaded email templates")
+	}
+
 	// Initialize email sender (optional - may fail in dev)
-	var emailer *email.Sender
-	emailer, err = email.NewSender(ctx, cfg.AWSRegion, cfg.SESFrom, cfg.SESTo)
+	var emailer email.Notifier
+	sesPolicy := cfg.AWSPolicy("ses", cfg.SESTimeout)
+	sender, err := email.NewSender(ctx, email.Options{
+		Provider:         cfg.EmailProvider,
+		From:             cfg.SESFrom,
+		To:               cfg.SESTo,
+		Region:           cfg.AWSRegion,
+		ConfigurationSet: cfg.SESConfigurationSet,
+		Policy:           sesPolicy,
+		SMTPAddr:         cfg.SMTPAddr,
+		SMTPUsername:     cfg.SMTPUsername,
+		SMTPPassword:     cfg.SMTPPassword,
+		SendGridAPIKey:   cfg.SendGridAPIKey,
+	})
 	if err != nil {
 		logging.Warn().Err(err).Msg("failed to initialize email sender - notifications disabled")
-		emailer = nil
+	} else {
+		emailer = sender.WithSuppressions(sesevents.NewList(presigner)).WithTemplates(templates)
 	}
 
-	// Create handler and router
-	h := handlers.NewHandler(cfg, presigner, emailer)
-	httpHandler := router.New(cfg, h)
+	// Per-project upload limits, notification routes and API keys can be
+	// reloaded without a restart; requests read them from one snapshot
+	snapshots, err := reload.New(cfg, registry, adminRegistry)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid project profile or notification routing configuration")
+		os.Exit(1)
+	}
 
-	// Get port from environment or default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Route failure notifications per project; unrouted failures are emailed to SES_TO
+	notifier := emailer
+	var routes routing.Editor
+	if cfg.NotifyRoutes != "" || cfg.NotifyRoutesBackend == "dynamodb" {
+		routes, err = routing.New(ctx, cfg.NotifyRoutesBackend, cfg.AWSRegion, cfg.NotifyRoutesTable, cfg.NotifyRoutes)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid notification routing configuration")
+			os.Exit(1)
+		}
+		if _, static := routes.(*routing.Table); static {
+			routes = snapshots.Routes()
+		}
+		dispatcher := routing.NewDispatcher(routes, emailer)
+		if cfg.SlackBotToken != "" {
+			dispatcher.WithSlack(routing.NewSlack(cfg.SlackBotToken))
+		}
+		topics, err := routing.NewSNS(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize SNS publisher")
+			os.Exit(1)
+		}
+		dispatcher.WithSNS(topics)
+		tokens, err := github.NewTokenSource(cfg.GitHubAPIURL, cfg.GitHubToken, cfg.GitHubAppID, cfg.GitHubAppInstallationID, cfg.GitHubAppPrivateKey)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid GitHub configuration")
+			os.Exit(1)
+		}
+		if tokens != nil {
+			dispatcher.WithGitHub(github.NewIssues(github.NewClient(cfg.GitHubAPIURL, tokens), presigner))
+		}
+		dispatcher.WithPagerDuty(pagerduty.New(presigner, pagerduty.Options{
+			EventsURL: cfg.PagerDutyEventsURL,
+			Threshold: cfg.PagerDutyThreshold,
+			Window:    cfg.PagerDutyWindow,
+		}))
+		notifier = dispatcher
+	}
+
+	// Enqueue notifications for cmd/notifier instead of delivering them in the
+	// request; critical ones are still delivered inline
+	if cfg.NotifyQueueURL != "" {
+		sqsClient, err := queue.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize notification queue")
+			os.Exit(1)
+		}
+		notifier = queue.NewPublisher(sqsClient, cfg.NotifyQueueURL).WithInline(notifier)
 	}
 
+	// Parse canary project routing
+	canarySelector, err := canary.Parse(cfg.CanaryProjects)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid canary configuration")
+		os.Exit(1)
+	}
+
+	// Parse per-route-group IP allow and deny lists
+	ipACLs, err := ipacl.Parse(cfg.IPACLs)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid IP ACL configuration")
+		os.Exit(1)
+	}
+
+	// Build redaction rules for stored metadata
+	redactRules, err := redact.ParseRules(cfg.RedactHeaders, cfg.RedactJSONFields, cfg.RedactPatterns)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid redaction configuration")
+		os.Exit(1)
+	}
+	redactor, err := redact.New(redactRules)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid redaction configuration")
+		os.Exit(1)
+	}
+
+	// Build per-project header capture policies
+	headerPolicies, err := headers.ParsePolicies(cfg.HeaderPolicies)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid header policy configuration")
+		os.Exit(1)
+	}
+
+	// Parse retention policies for purges triggered through the admin API
+	retentionPolicies, err := retention.Parse(cfg.RetentionPolicies, cfg.RetentionDays)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid retention configuration")
+		os.Exit(1)
+	}
+
+	// Load API keys managed through the admin API and re-read them periodically
+	if err := registry.Sync(ctx, presigner); err != nil {
+		logging.Warn().Err(err).Msg("failed to load managed API keys")
+	}
+	if cfg.APIKeySyncInterval > 0 {
+		go registry.Watch(ctx, presigner, cfg.APIKeySyncInterval)
+	}
+
+	// Re-read API keys kept in Secrets Manager or SSM, so rotated keys take
+	// effect without a restart
+	if cfg.SecretsRefreshInterval > 0 {
+		go cfg.Secrets.Watch(ctx, "API_KEYS", cfg.SecretsRefreshInterval, func(keysJSON string) error {
+			next, err := apikeys.Load(keysJSON, cfg.APIKey)
+			if err != nil {
+				return err
+			}
+			registry.SetConfigured(next)
+			return nil
+		})
+		go cfg.Secrets.Watch(ctx, "ADMIN_API_KEYS", cfg.SecretsRefreshInterval, func(keysJSON string) error {
+			next, err := apikeys.LoadAdmin(keysJSON)
+			if err != nil {
+				return err
+			}
+			adminRegistry.SetConfigured(next)
+			return nil
+		})
+	}
+
+	// Reload on SIGHUP and, optionally, periodically
+	go snapshots.Notify(ctx, syscall.SIGHUP)
+	if cfg.ConfigReloadInterval > 0 {
+		go snapshots.Watch(ctx, cfg.ConfigReloadInterval)
+	}
+
+	// Record auth failures, admin actions and usage (optional)
+	auditRec, err := audit.New(cfg.AuditSink, presigner)
+	if err != nil {
+		logging.Error().Err(err).Msg("invalid audit configuration")
+		os.Exit(1)
+	}
+	if auditRec != nil && cfg.AuditFlushInterval > 0 {
+		go auditRec.Run(ctx, cfg.AuditFlushInterval)
+	}
+
+	// Readiness checks S3 and, optionally, the SES account and sender identity
+	checks := []health.Check{{Name: "s3", Critical: true, Run: presigner.HeadBucket, Breaker: store.Endpoint.Policy.Breaker.State}}
+	if cfg.HealthCheckSES && sender != nil {
+		checks = append(checks, health.Check{Name: "ses", Run: sender.Check, Breaker: sesPolicy.Breaker.State})
+	}
+
+	// Email projects nearing their daily quotas to SES_TO
+	var quotaAlerts quota.Notifier
+	if emailer != nil {
+		quotaAlerts = sender
+	}
+
+	// Create handler and router
+	h := handlers.NewHandler(cfg, presigner, notifier).
+		WithCanary(canarySelector).
+		WithRedactor(redactor).
+		WithHeaderPolicies(headerPolicies).
+		WithReload(snapshots).
+		WithUsage(usageStore).
+		WithQuotas(quota.NewEnforcer(quotaStore, quotaAlerts, cfg.QuotaAlertPercent)).
+		WithStorageBudget(budget.NewTracker(budgetStore)).
+		WithReplayer(replay.New(cfg.ReplayAllowedHosts, cfg.ReplayTimeout)).
+		WithAPIKeys(registry).
+		WithRoutes(routes).
+		WithRetention(retentionPolicies).
+		WithLinks(linkSigner).
+		WithHealth(health.New(cfg.HealthCheckTimeout, checks...))
+	// Re-check uploads that are not visible yet; in async mode queue completions
+	// and verify them from the verification queue, which also carries the
+	// completions of cmd/autocomplete
+	h.WithVerification(verify.New(cfg.VerifyAttempts, cfg.VerifyRetryWindow))
+	if cfg.VerifyQueueURL != "" {
+		sqsClient, err := queue.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize verification queue")
+			os.Exit(1)
+		}
+		if cfg.VerifyMode == verify.ModeAsync {
+			h.WithPendingVerification(verify.NewPublisher(sqsClient, cfg.VerifyQueueURL))
+		}
+		go verify.Poll(ctx, sqsClient, cfg.VerifyQueueURL, h)
+	}
+	if cfg.DedupWindow > 0 {
+		h.WithDedup(dedup.New(presigner, cfg.DedupWindow))
+	}
+	if cfg.SESEventsTopicARN != "" {
+		h.WithSESEvents(sesevents.NewVerifier())
+	}
+	if cfg.EventBusName != "" {
+		eventsClient, err := eventbus.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize event bus")
+			os.Exit(1)
+		}
+		h.WithEvents(eventbus.New(eventsClient, cfg.EventBusName, cfg.EventSource))
+	}
+	if cfg.SentryDSN != "" {
+		dsn, err := sentry.ParseDSN(cfg.SentryDSN)
+		if err != nil {
+			logging.Error().Err(err).Msg("invalid SENTRY_DSN")
+			os.Exit(1)
+		}
+		h.WithSentry(sentry.New(dsn))
+	}
+	if cfg.ThumbnailQueueURL != "" {
+		sqsClient, err := queue.NewClient(ctx, cfg.AWSRegion)
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize thumbnail queue")
+			os.Exit(1)
+		}
+		h.WithThumbnails(thumbs.NewPublisher(sqsClient, cfg.ThumbnailQueueURL))
+	}
+	if cfg.MetadataIndex && cfg.GlueDatabase != "" {
+		catalog, err := athena.NewCatalog(ctx, cfg.AWSRegion, cfg.GlueDatabase, cfg.GlueTable, presigner.Bucket())
+		if err != nil {
+			logging.Error().Err(err).Msg("failed to initialize glue catalog")
+			os.Exit(1)
+		}
+		h.WithCatalog(catalog)
+	}
+	authorizer := jwtauth.NewAuthorizer(jwtOpts)
+	httpHandler := router.New(cfg, h, router.Deps{
+		Registry:   registry,
+		Verifier:   verifier,
+		IPLimiter:  ipLimiter,
+		KeyLimiter: keyLimiter,
+		Usage:      usageStore,
+		Signatures: signatures,
+		Authorizer: authorizer,
+
+		AdminRegistry: adminRegistry,
+		Audit:         auditRec,
+		IPACLs:        ipACLs,
+	})
+
+	// Expose Prometheus metrics next to the API
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", httpHandler)
+
 	// Create server
 	server := &http.Server{
-		Addr:         ":" + port,
-		Handler:      httpHandler,
+		Addr:         ":" + cfg.Port,
+		Handler:      mux,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -75,6 +468,36 @@ func main() {
 		}
 	}()
 
+	// Serve the ticket, complete and read APIs over gRPC (optional), sharing
+	// the handler's service layer and the API's credentials
+	var grpcServer *grpc.Server
+	var grpcHealth *grpchealth.Server
+	if cfg.GRPCPort != "" {
+		grpcAuth := grpcapi.NewAuthenticator(cfg.AuthMode, middleware.Authenticators{
+			Registry:   registry,
+			Verifier:   verifier,
+			Signatures: signatures,
+			Authorizer: authorizer,
+		}, cfg.AuthEnabled, cfg.MultiTenant).WithAudit(auditRec)
+		if !grpcAuth.Supported() {
+			logging.Warn().Str("authMode", cfg.AuthMode).Msg("gRPC calls cannot authenticate in this auth mode and will be rejected")
+		}
+		grpcServer, grpcHealth = grpcapi.New(h, grpcAuth)
+
+		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			logging.Error().Err(err).Str("port", cfg.GRPCPort).Msg("failed to listen for gRPC")
+			os.Exit(1)
+		}
+		go func() {
+			logging.Info().Str("addr", lis.Addr().String()).Msg("gRPC server listening")
+			if err := grpcServer.Serve(lis); err != nil {
+				logging.Error().Err(err).Msg("gRPC server error")
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -86,10 +509,29 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if grpcServer != nil {
+		// Report NOT_SERVING so load balancers drain, then let in-flight calls finish
+		grpcHealth.Shutdown()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
 		logging.Error().Err(err).Msg("server forced to shutdown")
 		os.Exit(1)
 	}
 
+	if err := auditRec.Flush(ctx); err != nil {
+		logging.Error().Err(err).Msg("failed to write audit records")
+	}
+
 	logging.Info().Msg("server stopped")
 }
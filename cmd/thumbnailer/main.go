@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/thumbs"
+)
+
+// Generates thumbnails of the image attachments that upload-complete queues
+// to THUMBNAIL_QUEUE_URL. Deployed to Lambda it handles the queue's events;
+// otherwise it polls the queue until interrupted.
+func main() {
+	ctx := context.Background()
+
+	// Load configuration
+	cfg, cfgErr := config.Load()
+
+	// Initialize logging
+	if err := logging.Init(cfg.LogOptions()); err != nil {
+		logging.Warn().Err(err).Msg("invalid logging configuration - using defaults")
+	}
+	if cfgErr != nil {
+		logging.Error().Err(cfgErr).Msg("invalid configuration")
+		os.Exit(1)
+	}
+
+	// Images are read from, and thumbnails written to, each failure's bucket under its KMS key
+	presigner, err := s3client.New(ctx, cfg.StoreOptions())
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize S3 presigner")
+		os.Exit(1)
+	}
+
+	worker := thumbs.NewWorker(presigner, cfg.ThumbnailSize)
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+			resp := worker.Handle(ctx, event)
+			if ferr := metrics.FlushEMF(); ferr != nil {
+				logging.Warn().Err(ferr).Msg("failed to emit metrics")
+			}
+			return resp, nil
+		})
+		return
+	}
+
+	if cfg.ThumbnailQueueURL == "" {
+		logging.Error().Msg("THUMBNAIL_QUEUE_URL is required")
+		os.Exit(1)
+	}
+	client, err := queue.NewClient(ctx, cfg.AWSRegion)
+	if err != nil {
+		logging.Error().Err(err).Msg("failed to initialize SQS client")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logging.Info().Str("queue", cfg.ThumbnailQueueURL).Int("size", cfg.ThumbnailSize).Msg("generating thumbnails")
+	worker.Poll(ctx, client, cfg.ThumbnailQueueURL)
+	logging.Info().Msg("thumbnail worker stopped")
+}
@@ -0,0 +1,161 @@
+package ack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// Prefix is the S3 prefix under which acknowledgment records are stored
+const Prefix = "notifications/acks/"
+
+// ErrNotFound is returned when no notification was tracked for a failure
+var ErrNotFound = errors.New("no notification tracked for failure")
+
+// Store is the subset of S3 operations acknowledgment tracking needs
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Record tracks a sent failure notification until someone acknowledges it
+type Record struct {
+	FailureID   string    `json:"failureId"`
+	Project     string    `json:"project"`
+	Env         string    `json:"env"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	EnvelopeKey string    `json:"envelopeKey"`
+	NotifiedAt  time.Time `json:"notifiedAt"`
+
+	AckedBy     string     `json:"ackedBy,omitempty"`
+	AckedAt     *time.Time `json:"ackedAt,omitempty"`
+	EscalatedAt *time.Time `json:"escalatedAt,omitempty"`
+}
+
+// Key returns the record key
+// Format: notifications/acks/{failureId}.json
+func Key(failureID string) string {
+	return Prefix + failureID + ".json"
+}
+
+// Acked reports whether the notification was acknowledged
+func (r *Record) Acked() bool {
+	return r.AckedAt != nil
+}
+
+// Due reports whether the record should be escalated at now: it is unacknowledged,
+// not yet escalated and was notified at least window ago
+func (r *Record) Due(window time.Duration, now time.Time) bool {
+	return !r.Acked() && r.EscalatedAt == nil && !now.Before(r.NotifiedAt.Add(window))
+}
+
+// Track records that a notification was sent for a failure
+func Track(ctx context.Context, store Store, r Record) error {
+	return put(ctx, store, &r)
+}
+
+// Get loads the record for failureID, returning ErrNotFound if none was tracked
+func Get(ctx context.Context, store Store, failureID string) (*Record, error) {
+	key := Key(failureID)
+	exists, err := store.ObjectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return load(ctx, store, key)
+}
+
+// Acknowledge marks the notification for failureID as acknowledged by principal at now.
+// Acknowledging twice keeps the first acknowledgment.
+func Acknowledge(ctx context.Context, store Store, failureID, principal string, now time.Time) (*Record, error) {
+	r, err := Get(ctx, store, failureID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Acked() {
+		return r, nil
+	}
+
+	r.AckedBy = principal
+	r.AckedAt = &now
+	if err := put(ctx, store, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Escalator re-notifies about an unacknowledged failure via a secondary channel
+type Escalator interface {
+	Escalate(ctx context.Context, r Record) error
+}
+
+// Run escalates every record that has gone unacknowledged for window. Each record
+// is escalated at most once.
+func Run(ctx context.Context, store Store, escalator Escalator, window time.Duration, now time.Time) error {
+	keys, err := store.ListKeys(ctx, Prefix)
+	if err != nil {
+		return fmt.Errorf("list acknowledgments: %w", err)
+	}
+
+	var escalated, failed int
+	for _, key := range keys {
+		r, err := load(ctx, store, key)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("skipping unreadable acknowledgment record")
+			continue
+		}
+		if !r.Due(window, now) {
+			continue
+		}
+
+		if err := escalator.Escalate(ctx, *r); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", r.FailureID).Msg("failed to escalate notification")
+			failed++
+			continue
+		}
+
+		r.EscalatedAt = &now
+		if err := put(ctx, store, r); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("failureId", r.FailureID).Msg("failed to record escalation")
+		}
+		escalated++
+
+		logging.FromContext(ctx).Info().Str("failureId", r.FailureID).Str("project", r.Project).Msg("notification escalated")
+	}
+
+	logging.FromContext(ctx).Info().Int("escalated", escalated).Int("failed", failed).Msg("escalation run finished")
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d escalations failed", failed, failed+escalated)
+	}
+	return nil
+}
+
+func load(ctx context.Context, store Store, key string) (*Record, error) {
+	b, err := store.GetObjectBytes(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	var r Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", key, err)
+	}
+	return &r, nil
+}
+
+func put(ctx context.Context, store Store, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return store.PutObjectBytes(ctx, Key(r.FailureID), "application/json", b)
+}
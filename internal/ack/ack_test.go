@@ -0,0 +1,136 @@
+package ack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+// recordingEscalator collects escalated records and optionally fails
+type recordingEscalator struct {
+	escalated []string
+	err       error
+}
+
+func (e *recordingEscalator) Escalate(_ context.Context, r Record) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.escalated = append(e.escalated, r.FailureID)
+	return nil
+}
+
+func TestAcknowledge(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	notified := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	if _, err := Acknowledge(ctx, store, "missing", "key:ops", notified); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Acknowledge() error = %v, want ErrNotFound", err)
+	}
+
+	if err := Track(ctx, store, Record{FailureID: "f1", Project: "myapp", Env: "prod", NotifiedAt: notified}); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	first := notified.Add(5 * time.Minute)
+	r, err := Acknowledge(ctx, store, "f1", "key:ops", first)
+	if err != nil {
+		t.Fatalf("Acknowledge() error = %v", err)
+	}
+	if r.AckedBy != "key:ops" || !r.AckedAt.Equal(first) {
+		t.Errorf("ack = %s at %v", r.AckedBy, r.AckedAt)
+	}
+
+	// A second acknowledgment keeps the first
+	r, err = Acknowledge(ctx, store, "f1", "key:other", first.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Acknowledge() error = %v", err)
+	}
+	if r.AckedBy != "key:ops" || !r.AckedAt.Equal(first) {
+		t.Errorf("second ack overwrote first: %s at %v", r.AckedBy, r.AckedAt)
+	}
+
+	stored, err := Get(ctx, store, "f1")
+	if err != nil || !stored.Acked() {
+		t.Errorf("Get() = %+v, %v", stored, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	window := 30 * time.Minute
+
+	Track(ctx, store, Record{FailureID: "old", Project: "myapp", NotifiedAt: now.Add(-time.Hour)})
+	Track(ctx, store, Record{FailureID: "recent", Project: "myapp", NotifiedAt: now.Add(-10 * time.Minute)})
+	Track(ctx, store, Record{FailureID: "acked", Project: "myapp", NotifiedAt: now.Add(-time.Hour)})
+	Acknowledge(ctx, store, "acked", "key:ops", now.Add(-50*time.Minute))
+	store.Put(Prefix+"broken.json", "application/json", []byte("{"))
+
+	esc := &recordingEscalator{}
+	if err := Run(ctx, store, esc, window, now); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(esc.escalated) != 1 || esc.escalated[0] != "old" {
+		t.Errorf("escalated = %v, want [old]", esc.escalated)
+	}
+
+	r, _ := Get(ctx, store, "old")
+	if r.EscalatedAt == nil || !r.EscalatedAt.Equal(now) {
+		t.Errorf("EscalatedAt = %v, want %v", r.EscalatedAt, now)
+	}
+
+	// Escalated records are not escalated again
+	esc = &recordingEscalator{}
+	Run(ctx, store, esc, window, now.Add(time.Hour))
+	if len(esc.escalated) != 1 || esc.escalated[0] != "recent" {
+		t.Errorf("second run escalated = %v, want [recent]", esc.escalated)
+	}
+}
+
+func TestRun_EscalationFailure(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	Track(ctx, store, Record{FailureID: "f1", NotifiedAt: now.Add(-time.Hour)})
+
+	if err := Run(ctx, store, &recordingEscalator{err: errors.New("down")}, time.Minute, now); err == nil {
+		t.Fatal("Run() expected error")
+	}
+	if r, _ := Get(ctx, store, "f1"); r.EscalatedAt != nil {
+		t.Error("failed escalation should be retried on the next run")
+	}
+}
+
+func TestWebhook_Escalate(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	r := Record{FailureID: "f1", Project: "myapp", Env: "prod", Method: "GET", URL: "https://api.example.com/x"}
+	if err := NewWebhook(srv.URL).Escalate(context.Background(), r); err != nil {
+		t.Fatalf("Escalate() error = %v", err)
+	}
+	if got.FailureID != "f1" || !strings.Contains(got.Text, "myapp/prod") {
+		t.Errorf("payload = %+v", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := NewWebhook(failing.URL).Escalate(context.Background(), r); err == nil {
+		t.Error("Escalate() expected error for non-2xx response")
+	}
+}
@@ -0,0 +1,67 @@
+package ack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook escalates by POSTing a JSON message to a URL. The payload carries a
+// "text" field so Slack and Teams incoming webhooks can consume it directly.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook creates an escalator that posts to url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// webhookPayload is the body posted for an escalation
+type webhookPayload struct {
+	Text       string    `json:"text"`
+	FailureID  string    `json:"failureId"`
+	Project    string    `json:"project"`
+	Env        string    `json:"env"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	NotifiedAt time.Time `json:"notifiedAt"`
+}
+
+// Escalate posts the unacknowledged failure to the webhook
+func (w *Webhook) Escalate(ctx context.Context, r Record) error {
+	b, err := json.Marshal(webhookPayload{
+		Text: fmt.Sprintf("[%s/%s] Failure %s (%s %s) has not been acknowledged since %s",
+			r.Project, r.Env, r.FailureID, r.Method, r.URL, r.NotifiedAt.UTC().Format(time.RFC3339)),
+		FailureID:  r.FailureID,
+		Project:    r.Project,
+		Env:        r.Env,
+		Method:     r.Method,
+		URL:        r.URL,
+		NotifiedAt: r.NotifiedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// ContentType is the media type of problem details responses (RFC 7807)
+const ContentType = "application/problem+json"
+
+// RequestIDHeader echoes the request ID so callers can quote it to support
+const RequestIDHeader = "X-Request-Id"
+
+// typePrefix builds the problem type URI from the error code
+const typePrefix = "urn:failure-uploader:error:"
+
+// Code is a stable machine-readable error code. Clients may switch on it;
+// codes are never renamed once released.
+type Code string
+
+const (
+	CodeInternal            Code = "internal_error"
+	CodeInvalidJSON         Code = "invalid_json"
+	CodeValidation          Code = "validation_error"
+	CodeUnauthorized        Code = "unauthorized"
+	CodeForbidden           Code = "forbidden"
+	CodeNotFound            Code = "not_found"
+	CodeTooLarge            Code = "too_large"
+	CodeInvalidRange        Code = "invalid_range"
+	CodeResponseTooLarge    Code = "response_too_large"
+	CodeRateLimited         Code = "rate_limited"
+	CodeQuotaExceeded       Code = "quota_exceeded"
+	CodeBudgetExceeded      Code = "budget_exceeded"
+	CodeMissingObjects      Code = "missing_objects"
+	CodeChecksumMismatch    Code = "checksum_mismatch"
+	CodeContentMismatch     Code = "content_mismatch"
+	CodePresignFailed       Code = "presign_failed"
+	CodeVerificationFailed  Code = "verification_failed"
+	CodeChecksumFailed      Code = "checksum_failed"
+	CodeUploadFailed        Code = "upload_failed"
+	CodeRestoreFailed       Code = "restore_failed"
+	CodeAckFailed           Code = "ack_failed"
+	CodeLinkFailed          Code = "link_failed"
+	CodeListFailed          Code = "list_failed"
+	CodeUsageFailed         Code = "usage_failed"
+	CodeDeleteFailed        Code = "delete_failed"
+	CodeEventFailed         Code = "event_failed"
+	CodeReadFailed          Code = "read_failed"
+	CodeEncrypted           Code = "encrypted"
+	CodeReplayFailed        Code = "replay_failed"
+	CodeNoTicket            Code = "no_ticket"
+	CodeUnsupportedSchema   Code = "unsupported_schema_version"
+	CodeTicketFailed        Code = "ticket_failed"
+	CodeMethodNotAllowed    Code = "method_not_allowed"
+	CodeUnsupportedEncoding Code = "unsupported_encoding"
+	CodeInvalidEncoding     Code = "invalid_encoding"
+	CodeQuarantined         Code = "quarantined"
+	CodeScanPending         Code = "scan_pending"
+
+	CodeAlreadyCompleted     Code = "already_completed"
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+	CodeCompletionInProgress Code = "completion_in_progress"
+	CodeSizeMismatch         Code = "size_mismatch"
+
+	CodeKeyExists    Code = "key_exists"
+	CodeReadOnly     Code = "read_only"
+	CodeUpdateFailed Code = "update_failed"
+)
+
+// FieldError is a validation failure of a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Code identifies rule-specific failures such as too_many_files
+	Code string `json:"code,omitempty"`
+}
+
+// Problem is an RFC 7807 problem details object with the service's extensions
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Code      Code         `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	// Retryable tells clients the same request may succeed later
+	Retryable bool `json:"retryable"`
+	// RetryAfterSeconds is the minimum wait before retrying, also sent as Retry-After
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+}
+
+// New creates a problem with the given status, code and human-readable title
+func New(status int, code Code, title string) *Problem {
+	return &Problem{
+		Type:   typePrefix + string(code),
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+// WithDetail sets an explanation specific to this occurrence
+func (p *Problem) WithDetail(format string, args ...interface{}) *Problem {
+	p.Detail = fmt.Sprintf(format, args...)
+	return p
+}
+
+// WithRetry marks the problem retryable after d, rounded up to whole seconds (at least one)
+func (p *Problem) WithRetry(d time.Duration) *Problem {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	p.Retryable = true
+	p.RetryAfterSeconds = seconds
+	return p
+}
+
+// InvalidJSON reports a request body that could not be decoded
+func InvalidJSON(err error) *Problem {
+	return New(http.StatusBadRequest, CodeInvalidJSON, "Failed to parse request body").WithDetail("%s", err)
+}
+
+// InvalidEncoding reports a compressed request body that could not be inflated
+func InvalidEncoding(err error) *Problem {
+	return New(http.StatusBadRequest, CodeInvalidEncoding, "Failed to decompress request body").WithDetail("%s", err)
+}
+
+// Validation reports the fields that failed validation
+func Validation(errs []FieldError) *Problem {
+	p := New(http.StatusBadRequest, CodeValidation, "Validation failed")
+	p.Errors = errs
+	return p
+}
+
+// BadRequest reports a client error other than validation
+func BadRequest(code Code, title string) *Problem {
+	return New(http.StatusBadRequest, code, title)
+}
+
+// Unauthorized reports missing or invalid credentials
+func Unauthorized(title string) *Problem {
+	return New(http.StatusUnauthorized, CodeUnauthorized, title)
+}
+
+// Forbidden reports a principal that may not perform the request
+func Forbidden(title string) *Problem {
+	return New(http.StatusForbidden, CodeForbidden, title)
+}
+
+// NotFound reports a missing resource
+func NotFound(title string) *Problem {
+	return New(http.StatusNotFound, CodeNotFound, title)
+}
+
+// TooLarge reports a body over limit bytes
+func TooLarge(title string, limit int64) *Problem {
+	return New(http.StatusRequestEntityTooLarge, CodeTooLarge, title).WithDetail("limit is %d bytes", limit)
+}
+
+// RateLimited reports an exhausted rate limit bucket that refills after retryAfter
+func RateLimited(retryAfter time.Duration) *Problem {
+	return New(http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded").WithRetry(retryAfter)
+}
+
+// QuotaExceeded reports a project out of its daily quota until it resets
+// after resetsIn
+func QuotaExceeded(resetsIn time.Duration) *Problem {
+	return New(http.StatusTooManyRequests, CodeQuotaExceeded, "Daily quota exceeded").WithRetry(resetsIn)
+}
+
+// BudgetExceeded reports a project that has reached its storage budget.
+// Retrying does not help until failures are purged or the budget is raised.
+func BudgetExceeded() *Problem {
+	return New(http.StatusInsufficientStorage, CodeBudgetExceeded, "Storage budget exceeded")
+}
+
+// ScanRetryAfter is the suggested wait for a malware scan verdict
+const ScanRetryAfter = 30 * time.Second
+
+// Quarantined reports an artifact the malware scan found infected; it can
+// only be downloaded once an admin releases it
+func Quarantined() *Problem {
+	return New(http.StatusForbidden, CodeQuarantined, "Artifact is quarantined")
+}
+
+// ScanPending reports an artifact the malware scan has not cleared yet
+func ScanPending() *Problem {
+	return New(http.StatusConflict, CodeScanPending, "Artifact is awaiting a malware scan").WithRetry(ScanRetryAfter)
+}
+
+// Internal reports a server-side failure that retrying will not fix. Details of
+// the cause are logged, never returned.
+func Internal(code Code, title string) *Problem {
+	return New(http.StatusInternalServerError, code, title)
+}
+
+// DependencyRetryAfter is the suggested wait after a failed call to S3, SES or DynamoDB
+const DependencyRetryAfter = 2 * time.Second
+
+// Dependency reports a failed call to a backing service as 502 Bad Gateway;
+// such failures are usually transient
+func Dependency(code Code, title string) *Problem {
+	return New(http.StatusBadGateway, code, title).WithRetry(DependencyRetryAfter)
+}
+
+// Write sends p as application/problem+json, filling in the request path and ID
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if id := chimiddleware.GetReqID(r.Context()); id != "" {
+		p.RequestID = id
+		w.Header().Set(RequestIDHeader, id)
+	}
+
+	if p.RetryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.RetryAfterSeconds))
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
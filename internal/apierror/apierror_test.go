@@ -0,0 +1,132 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+func TestWrite(t *testing.T) {
+	h := chimiddleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, Validation([]FieldError{
+			{Field: "project", Message: "required"},
+			{Field: "env", Message: "invalid format"},
+		}))
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/upload-ticket", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Type != "urn:failure-uploader:error:validation_error" || p.Code != CodeValidation || p.Status != 400 {
+		t.Errorf("problem = %+v", p)
+	}
+	if p.Instance != "/v1/upload-ticket" {
+		t.Errorf("instance = %q", p.Instance)
+	}
+	if p.RequestID == "" || rec.Header().Get(RequestIDHeader) != p.RequestID {
+		t.Errorf("requestId = %q, header = %q", p.RequestID, rec.Header().Get(RequestIDHeader))
+	}
+	if len(p.Errors) != 2 || p.Errors[0].Field != "project" || p.Errors[1].Message != "invalid format" {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
+
+func TestWrite_WithoutRequestID(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodGet, "/r/abc/envelope.json", nil), NotFound("Unknown failure"))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, ok := body["requestId"]; ok {
+		t.Error("requestId present without a request ID")
+	}
+	if _, ok := body["errors"]; ok {
+		t.Error("errors present on a non-validation problem")
+	}
+	if body["code"] != "not_found" || body["title"] != "Unknown failure" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      *Problem
+		status int
+		code   Code
+		detail string
+	}{
+		{"invalid json", InvalidJSON(errors.New("unexpected EOF")), 400, CodeInvalidJSON, "unexpected EOF"},
+		{"too large", TooLarge("Artifact exceeds maximum allowed size", 1024), 413, CodeTooLarge, "limit is 1024 bytes"},
+		{"rate limited", RateLimited(time.Second), 429, CodeRateLimited, ""},
+		{"unauthorized", Unauthorized("Missing API key"), 401, CodeUnauthorized, ""},
+		{"internal", Internal(CodeUploadFailed, "Failed to store artifact"), 500, CodeUploadFailed, ""},
+		{"dependency", Dependency(CodeVerificationFailed, "Failed to verify uploaded objects"), 502, CodeVerificationFailed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.p.Status != tt.status || tt.p.Code != tt.code || tt.p.Detail != tt.detail {
+				t.Errorf("got %d %s %q, want %d %s %q", tt.p.Status, tt.p.Code, tt.p.Detail, tt.status, tt.code, tt.detail)
+			}
+		})
+	}
+}
+
+func TestRetryHints(t *testing.T) {
+	tests := []struct {
+		name      string
+		p         *Problem
+		retryable bool
+		after     int
+	}{
+		{"rate limited rounds up", RateLimited(1500 * time.Millisecond), true, 2},
+		{"rate limited at least one second", RateLimited(10 * time.Millisecond), true, 1},
+		{"dependency", Dependency(CodePresignFailed, "Failed to generate presigned URLs"), true, 2},
+		{"internal", Internal(CodeUploadFailed, "Failed to store artifact"), false, 0},
+		{"validation", Validation(nil), false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Write(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.p)
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body["retryable"] != tt.retryable {
+				t.Errorf("retryable = %v, want %v", body["retryable"], tt.retryable)
+			}
+			if tt.after == 0 {
+				if _, ok := body["retryAfterSeconds"]; ok || rec.Header().Get("Retry-After") != "" {
+					t.Errorf("unexpected retry hint: %v, header %q", body["retryAfterSeconds"], rec.Header().Get("Retry-After"))
+				}
+				return
+			}
+			if body["retryAfterSeconds"] != float64(tt.after) || rec.Header().Get("Retry-After") != strconv.Itoa(tt.after) {
+				t.Errorf("retryAfterSeconds = %v, header %q, want %d", body["retryAfterSeconds"], rec.Header().Get("Retry-After"), tt.after)
+			}
+		})
+	}
+}
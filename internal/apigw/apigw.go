@@ -0,0 +1,343 @@
+package apigw
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/yourorg/failure-uploader/internal/requestid"
+)
+
+// incoming is the event-independent form of a Lambda HTTP request
+type incoming struct {
+	method   string
+	path     string
+	rawQuery string
+	query    map[string]string
+	header   http.Header
+	host     string
+	sourceIP string
+	body     string
+	base64   bool
+	// reqID is API Gateway's ID for the request
+	reqID string
+	// claims were validated by an API Gateway authorizer
+	claims map[string]interface{}
+}
+
+// NewRequest converts an API Gateway HTTP API (payload v2) event to an http.Request.
+// API Gateway joins repeated headers with commas and moves cookies to a separate
+// list; both are carried over so handlers see every value. Claims from a JWT or
+// Lambda authorizer are available through AuthorizerClaims. API Gateway's
+// request ID replaces any X-Request-Id header so responses and logs match the
+// API Gateway access log.
+func NewRequest(ctx context.Context, req events.APIGatewayV2HTTPRequest) (*http.Request, error) {
+	return build(ctx, incoming{
+		method:   req.RequestContext.HTTP.Method,
+		path:     req.RawPath,
+		rawQuery: req.RawQueryString,
+		query:    req.QueryStringParameters,
+		header:   v2Header(req.Headers, req.Cookies),
+		host:     req.RequestContext.DomainName,
+		sourceIP: req.RequestContext.HTTP.SourceIP,
+		body:     req.Body,
+		base64:   req.IsBase64Encoded,
+		claims:   authorizerClaims(req.RequestContext.Authorizer),
+		reqID:    req.RequestContext.RequestID,
+	})
+}
+
+// NewFunctionURLRequest converts a Lambda Function URL event to an http.Request.
+// Function URLs use the same payload layout as API Gateway v2, request ID included.
+func NewFunctionURLRequest(ctx context.Context, req events.LambdaFunctionURLRequest) (*http.Request, error) {
+	return build(ctx, incoming{
+		method:   req.RequestContext.HTTP.Method,
+		path:     req.RawPath,
+		rawQuery: req.RawQueryString,
+		query:    req.QueryStringParameters,
+		header:   v2Header(req.Headers, req.Cookies),
+		host:     req.RequestContext.DomainName,
+		sourceIP: req.RequestContext.HTTP.SourceIP,
+		body:     req.Body,
+		base64:   req.IsBase64Encoded,
+		reqID:    req.RequestContext.RequestID,
+	})
+}
+
+// NewALBRequest converts an Application Load Balancer target group event to an
+// http.Request. Multi-value headers and query parameters are used when the target
+// group has them enabled. ALB passes query values through still percent-encoded,
+// and the caller's address only arrives as the last X-Forwarded-For entry;
+// earlier entries are whatever the caller sent.
+func NewALBRequest(ctx context.Context, req events.ALBTargetGroupRequest) (*http.Request, error) {
+	header := make(http.Header)
+	if len(req.MultiValueHeaders) > 0 {
+		for k, vs := range req.MultiValueHeaders {
+			for _, v := range vs {
+				header.Add(k, v)
+			}
+		}
+	} else {
+		for k, v := range req.Headers {
+			header.Add(k, v)
+		}
+	}
+
+	var pairs []string
+	if len(req.MultiValueQueryStringParameters) > 0 {
+		for k, vs := range req.MultiValueQueryStringParameters {
+			for _, v := range vs {
+				pairs = append(pairs, k+"="+v)
+			}
+		}
+	} else {
+		for k, v := range req.QueryStringParameters {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+
+	var sourceIP string
+	if xff := header.Values("X-Forwarded-For"); len(xff) > 0 {
+		entries := strings.Split(xff[len(xff)-1], ",")
+		sourceIP = entries[len(entries)-1]
+	}
+
+	return build(ctx, incoming{
+		method:   req.HTTPMethod,
+		path:     req.Path,
+		rawQuery: strings.Join(pairs, "&"),
+		header:   header,
+		sourceIP: strings.TrimSpace(sourceIP),
+		body:     req.Body,
+		base64:   req.IsBase64Encoded,
+	})
+}
+
+// dropForwardedFor removes the last X-Forwarded-For entry when it is ip
+func dropForwardedFor(header http.Header, ip string) {
+	xff := header.Values("X-Forwarded-For")
+	if len(xff) == 0 {
+		return
+	}
+	last := xff[len(xff)-1]
+	i := strings.LastIndex(last, ",")
+	if strings.TrimSpace(last[i+1:]) != ip {
+		return
+	}
+	rest := slices.Clone(xff[:len(xff)-1])
+	if i >= 0 {
+		rest = append(rest, strings.TrimSpace(last[:i]))
+	}
+	header.Del("X-Forwarded-For")
+	for _, v := range rest {
+		header.Add("X-Forwarded-For", v)
+	}
+}
+
+// v2Header builds request headers from a payload v2 header map and cookie list
+func v2Header(headers map[string]string, cookies []string) http.Header {
+	header := make(http.Header, len(headers)+1)
+	for k, v := range headers {
+		header.Add(k, v)
+	}
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return header
+}
+
+// build creates the http.Request shared by all event types
+func build(ctx context.Context, in incoming) (*http.Request, error) {
+	target := in.path
+	if target == "" {
+		target = "/"
+	}
+	if in.rawQuery != "" {
+		target += "?" + in.rawQuery
+	} else if len(in.query) > 0 {
+		q := url.Values{}
+		for k, v := range in.query {
+			q.Set(k, v)
+		}
+		target += "?" + q.Encode()
+	}
+
+	var body []byte
+	if in.body != "" {
+		body = []byte(in.body)
+		if in.base64 {
+			decoded, err := base64.StdEncoding.DecodeString(in.body)
+			if err != nil {
+				return nil, fmt.Errorf("decode base64 body: %w", err)
+			}
+			body = decoded
+		}
+	}
+
+	if in.claims != nil {
+		ctx = WithAuthorizerClaims(ctx, in.claims)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, in.method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header = in.header
+	if in.reqID != "" {
+		httpReq.Header.Set(requestid.Header, in.reqID)
+	}
+
+	httpReq.Host = in.host
+	if host := httpReq.Header.Get("Host"); host != "" {
+		httpReq.Host = host
+		httpReq.Header.Del("Host")
+	}
+	httpReq.URL.Host = httpReq.Host
+
+	// Preserve the caller's address for per-IP rate limiting and logging.
+	// API Gateway and ALB also append it to X-Forwarded-For; it is dropped so
+	// the header only lists the proxies in front of them, as it would for a
+	// request that connected to the server directly.
+	if in.sourceIP != "" {
+		httpReq.RemoteAddr = net.JoinHostPort(in.sourceIP, "0")
+		dropForwardedFor(httpReq.Header, in.sourceIP)
+	}
+	httpReq.RequestURI = httpReq.URL.RequestURI()
+
+	return httpReq, nil
+}
+
+// ResponseWriter buffers a handler's response for return to Lambda
+type ResponseWriter struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+// NewResponseWriter creates an empty response writer with status 200
+func NewResponseWriter() *ResponseWriter {
+	return &ResponseWriter{header: make(http.Header), status: http.StatusOK}
+}
+
+// Header returns the response headers
+func (rw *ResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+// Write appends b to the response body
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	return rw.body.Write(b)
+}
+
+// WriteHeader records the status code; only the first call takes effect
+func (rw *ResponseWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = status
+	rw.wroteHeader = true
+}
+
+// Response builds the API Gateway response. Repeated headers are joined with
+// commas, Set-Cookie values go to Cookies, and compressed bodies or bodies
+// that are not valid UTF-8 are base64 encoded.
+func (rw *ResponseWriter) Response() events.APIGatewayV2HTTPResponse {
+	headers, cookies := rw.v2Headers()
+	body, isBase64 := rw.encodedBody()
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      rw.status,
+		Headers:         headers,
+		Cookies:         cookies,
+		Body:            body,
+		IsBase64Encoded: isBase64,
+	}
+}
+
+// FunctionURLResponse builds the Lambda Function URL response, encoded like Response
+func (rw *ResponseWriter) FunctionURLResponse() events.LambdaFunctionURLResponse {
+	headers, cookies := rw.v2Headers()
+	body, isBase64 := rw.encodedBody()
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      rw.status,
+		Headers:         headers,
+		Cookies:         cookies,
+		Body:            body,
+		IsBase64Encoded: isBase64,
+	}
+}
+
+// ALBResponse builds the load balancer response. multiValue must match whether
+// the target group has multi-value headers enabled, which is signalled by the
+// request carrying MultiValueHeaders.
+func (rw *ResponseWriter) ALBResponse(multiValue bool) events.ALBTargetGroupResponse {
+	body, isBase64 := rw.encodedBody()
+	resp := events.ALBTargetGroupResponse{
+		StatusCode:        rw.status,
+		StatusDescription: fmt.Sprintf("%d %s", rw.status, http.StatusText(rw.status)),
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}
+
+	if multiValue {
+		resp.MultiValueHeaders = make(map[string][]string, len(rw.header))
+		for k, v := range rw.header {
+			if len(v) > 0 {
+				resp.MultiValueHeaders[k] = v
+			}
+		}
+		return resp
+	}
+
+	// Without multi-value support only one Set-Cookie can be returned
+	resp.Headers = make(map[string]string, len(rw.header))
+	for k, v := range rw.header {
+		if len(v) == 0 {
+			continue
+		}
+		if k == "Set-Cookie" {
+			resp.Headers[k] = v[0]
+			continue
+		}
+		resp.Headers[k] = strings.Join(v, ",")
+	}
+	return resp
+}
+
+// v2Headers joins repeated headers with commas and splits out Set-Cookie values
+func (rw *ResponseWriter) v2Headers() (map[string]string, []string) {
+	return v2Headers(rw.header)
+}
+
+func v2Headers(header http.Header) (map[string]string, []string) {
+	headers := make(map[string]string, len(header))
+	var cookies []string
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+		if k == "Set-Cookie" {
+			cookies = append(cookies, v...)
+			continue
+		}
+		headers[k] = strings.Join(v, ",")
+	}
+	return headers, cookies
+}
+
+// encodedBody returns the body, base64 encoded when it is compressed or not
+// valid UTF-8
+func (rw *ResponseWriter) encodedBody() (string, bool) {
+	if rw.header.Get("Content-Encoding") == "" && utf8.Valid(rw.body.Bytes()) {
+		return rw.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(rw.body.Bytes()), true
+}
@@ -0,0 +1,508 @@
+package apigw
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/keys"
+)
+
+func newEvent(method, path string) events.APIGatewayV2HTTPRequest {
+	req := events.APIGatewayV2HTTPRequest{RawPath: path}
+	req.RequestContext.HTTP.Method = method
+	req.RequestContext.HTTP.SourceIP = "203.0.113.7"
+	req.RequestContext.DomainName = "api.example.com"
+	return req
+}
+
+func TestNewRequest_Base64Body(t *testing.T) {
+	payload := []byte{0x00, 0xff, 0x10, 0x80}
+	ev := newEvent(http.MethodPut, "/v1/failures/abc/artifacts/request.raw")
+	ev.Body = base64.StdEncoding.EncodeToString(payload)
+	ev.IsBase64Encoded = true
+
+	r, err := NewRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	got, _ := io.ReadAll(r.Body)
+	if string(got) != string(payload) {
+		t.Errorf("body = %x, want %x", got, payload)
+	}
+	if r.ContentLength != int64(len(payload)) {
+		t.Errorf("ContentLength = %d, want %d", r.ContentLength, len(payload))
+	}
+
+	ev.Body = "not base64!"
+	if _, err := NewRequest(context.Background(), ev); err == nil {
+		t.Error("NewRequest() expected error for invalid base64")
+	}
+}
+
+func TestNewRequest_HeadersCookiesAndQuery(t *testing.T) {
+	ev := newEvent(http.MethodGet, "/v1/groups")
+	ev.RawQueryString = "project=myapp&env=prod&tag=a&tag=b"
+	ev.Headers = map[string]string{
+		"host":            "failures.example.com",
+		"x-api-key":       "secret",
+		"accept":          "application/json,text/plain",
+		"x-forwarded-for": "198.51.100.1, 203.0.113.7",
+	}
+	ev.Cookies = []string{"a=1", "b=2"}
+
+	r, err := NewRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if r.Host != "failures.example.com" {
+		t.Errorf("Host = %q", r.Host)
+	}
+	if r.RemoteAddr != "203.0.113.7:0" {
+		t.Errorf("RemoteAddr = %q", r.RemoteAddr)
+	}
+	if got := r.Header.Get("X-Forwarded-For"); got != "198.51.100.1" {
+		t.Errorf("X-Forwarded-For = %q, want the source IP API Gateway appended dropped", got)
+	}
+	if got := r.Header.Get("X-Api-Key"); got != "secret" {
+		t.Errorf("X-Api-Key = %q", got)
+	}
+	if got := r.Header.Get("Accept"); got != "application/json,text/plain" {
+		t.Errorf("Accept = %q", got)
+	}
+	if c, err := r.Cookie("b"); err != nil || c.Value != "2" {
+		t.Errorf("Cookie(b) = %v, %v", c, err)
+	}
+	if tags := r.URL.Query()["tag"]; len(tags) != 2 {
+		t.Errorf("tag = %v, want both values", tags)
+	}
+	if r.URL.Path != "/v1/groups" {
+		t.Errorf("Path = %q", r.URL.Path)
+	}
+}
+
+func TestNewRequest_AuthorizerClaims(t *testing.T) {
+	ev := newEvent(http.MethodPost, "/v1/upload-ticket")
+	ev.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{
+			Claims: map[string]string{"sub": "user-1", "cognito:groups": "[myapp other]"},
+			Scopes: []string{"ticket:create"},
+		},
+	}
+
+	r, err := NewRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	claims, ok := AuthorizerClaims(r.Context())
+	if !ok {
+		t.Fatal("AuthorizerClaims() found none")
+	}
+	if claims["sub"] != "user-1" || claims["scope"] != "ticket:create" {
+		t.Errorf("claims = %v", claims)
+	}
+	if groups, _ := claims["cognito:groups"].([]interface{}); len(groups) != 2 || groups[1] != "other" {
+		t.Errorf("cognito:groups = %#v, want a list", claims["cognito:groups"])
+	}
+
+	r, _ = NewRequest(context.Background(), newEvent(http.MethodGet, "/health"))
+	if _, ok := AuthorizerClaims(r.Context()); ok {
+		t.Error("AuthorizerClaims() found claims without an authorizer")
+	}
+}
+
+func TestNewRequest_FallbackHostAndQuery(t *testing.T) {
+	ev := newEvent(http.MethodGet, "/health")
+	ev.QueryStringParameters = map[string]string{"project": "myapp"}
+
+	r, err := NewRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if r.Host != "api.example.com" {
+		t.Errorf("Host = %q, want domain name", r.Host)
+	}
+	if got := r.URL.Query().Get("project"); got != "myapp" {
+		t.Errorf("project = %q", got)
+	}
+	if r.Body != http.NoBody {
+		t.Error("empty body should be http.NoBody")
+	}
+}
+
+func TestNewRequest_RequestID(t *testing.T) {
+	ev := newEvent(http.MethodGet, "/health")
+	ev.Headers = map[string]string{"x-request-id": "client-chosen"}
+	ev.RequestContext.RequestID = "Jd5xbgGjoAMEJ8w="
+
+	r, err := NewRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if got := r.Header.Values("X-Request-Id"); len(got) != 1 || got[0] != "Jd5xbgGjoAMEJ8w=" {
+		t.Errorf("X-Request-Id = %q, want API Gateway request ID", got)
+	}
+}
+
+func TestResponseWriter_Response(t *testing.T) {
+	rw := NewResponseWriter()
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Add("Vary", "Origin")
+	rw.Header().Add("Vary", "Accept")
+	rw.Header().Add("Set-Cookie", "a=1")
+	rw.Header().Add("Set-Cookie", "b=2")
+	rw.WriteHeader(http.StatusCreated)
+	rw.WriteHeader(http.StatusInternalServerError)
+	rw.Write([]byte(`{"ok":true}`))
+
+	resp := rw.Response()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("StatusCode = %d, want first status", resp.StatusCode)
+	}
+	if resp.Headers["Vary"] != "Origin,Accept" {
+		t.Errorf("Vary = %q", resp.Headers["Vary"])
+	}
+	if _, ok := resp.Headers["Set-Cookie"]; ok || len(resp.Cookies) != 2 {
+		t.Errorf("cookies = %v, headers = %v", resp.Cookies, resp.Headers)
+	}
+	if resp.IsBase64Encoded || resp.Body != `{"ok":true}` {
+		t.Errorf("body = %q, base64 = %v", resp.Body, resp.IsBase64Encoded)
+	}
+}
+
+func TestResponseWriter_BinaryBody(t *testing.T) {
+	rw := NewResponseWriter()
+	rw.Write([]byte{0xff, 0xfe})
+
+	resp := rw.Response()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d", resp.StatusCode)
+	}
+	if !resp.IsBase64Encoded || resp.Body != base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe}) {
+		t.Errorf("body = %q, base64 = %v", resp.Body, resp.IsBase64Encoded)
+	}
+}
+
+func TestResponseWriter_EncodedBody(t *testing.T) {
+	// Content-Encoding marks the body binary even when it happens to be valid UTF-8
+	rw := NewResponseWriter()
+	rw.Header().Set("Content-Encoding", "gzip")
+	rw.Write([]byte("plain"))
+
+	resp := rw.Response()
+	if !resp.IsBase64Encoded || resp.Body != base64.StdEncoding.EncodeToString([]byte("plain")) || resp.Headers["Content-Encoding"] != "gzip" {
+		t.Errorf("response = %+v, want the encoded body in base64", resp)
+	}
+}
+
+func TestNewFunctionURLRequest(t *testing.T) {
+	ev := events.LambdaFunctionURLRequest{
+		RawPath:        "/v1/upload-ticket",
+		RawQueryString: "a=1",
+		Headers:        map[string]string{"content-type": "application/json"},
+		Cookies:        []string{"s=1"},
+		Body:           `{"project":"myapp"}`,
+	}
+	ev.RequestContext.HTTP.Method = http.MethodPost
+	ev.RequestContext.HTTP.SourceIP = "198.51.100.2"
+	ev.RequestContext.DomainName = "abc123.lambda-url.us-east-1.on.aws"
+
+	r, err := NewFunctionURLRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewFunctionURLRequest() error = %v", err)
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/upload-ticket" || r.URL.Query().Get("a") != "1" {
+		t.Errorf("request = %s %s", r.Method, r.URL)
+	}
+	if r.Host != ev.RequestContext.DomainName || r.RemoteAddr != "198.51.100.2:0" {
+		t.Errorf("Host = %q, RemoteAddr = %q", r.Host, r.RemoteAddr)
+	}
+	if c, err := r.Cookie("s"); err != nil || c.Value != "1" {
+		t.Errorf("Cookie(s) = %v, %v", c, err)
+	}
+	body, _ := io.ReadAll(r.Body)
+	if string(body) != `{"project":"myapp"}` {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestNewALBRequest(t *testing.T) {
+	ev := events.ALBTargetGroupRequest{
+		HTTPMethod:            http.MethodGet,
+		Path:                  "/v1/groups",
+		QueryStringParameters: map[string]string{"project": "myapp", "q": "a%20b"},
+		Headers: map[string]string{
+			"host":            "lb.example.com",
+			"x-forwarded-for": "203.0.113.9, 10.0.0.1",
+		},
+	}
+
+	r, err := NewALBRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewALBRequest() error = %v", err)
+	}
+	// The ALB appends the caller's address; earlier entries came from the caller
+	if r.Host != "lb.example.com" || r.RemoteAddr != "10.0.0.1:0" {
+		t.Errorf("Host = %q, RemoteAddr = %q", r.Host, r.RemoteAddr)
+	}
+	if got := r.Header.Get("X-Forwarded-For"); got != "203.0.113.9" {
+		t.Errorf("X-Forwarded-For = %q, want the caller's own entries", got)
+	}
+	if got := r.URL.Query().Get("q"); got != "a b" {
+		t.Errorf("q = %q, want percent-decoded value", got)
+	}
+}
+
+func TestNewALBRequest_MultiValue(t *testing.T) {
+	payload := []byte{0x89, 'P', 'N', 'G'}
+	ev := events.ALBTargetGroupRequest{
+		HTTPMethod: http.MethodPut,
+		Path:       "/v1/failures/abc/artifacts/files/a.png",
+		MultiValueQueryStringParameters: map[string][]string{
+			"tag": {"a", "b"},
+		},
+		MultiValueHeaders: map[string][]string{
+			"x-custom": {"one", "two"},
+		},
+		Body:            base64.StdEncoding.EncodeToString(payload),
+		IsBase64Encoded: true,
+	}
+
+	r, err := NewALBRequest(context.Background(), ev)
+	if err != nil {
+		t.Fatalf("NewALBRequest() error = %v", err)
+	}
+	if got := r.Header.Values("X-Custom"); len(got) != 2 {
+		t.Errorf("X-Custom = %v, want both values", got)
+	}
+	if tags := r.URL.Query()["tag"]; len(tags) != 2 {
+		t.Errorf("tag = %v, want both values", tags)
+	}
+	body, _ := io.ReadAll(r.Body)
+	if string(body) != string(payload) {
+		t.Errorf("body = %x, want %x", body, payload)
+	}
+}
+
+func TestResponseWriter_ALBResponse(t *testing.T) {
+	rw := NewResponseWriter()
+	rw.Header().Add("Set-Cookie", "a=1")
+	rw.Header().Add("Set-Cookie", "b=2")
+	rw.WriteHeader(http.StatusNotFound)
+
+	single := rw.ALBResponse(false)
+	if single.StatusDescription != "404 Not Found" {
+		t.Errorf("StatusDescription = %q", single.StatusDescription)
+	}
+	if single.Headers["Set-Cookie"] != "a=1" || single.MultiValueHeaders != nil {
+		t.Errorf("single-value headers = %v / %v", single.Headers, single.MultiValueHeaders)
+	}
+
+	multi := rw.ALBResponse(true)
+	if len(multi.MultiValueHeaders["Set-Cookie"]) != 2 || multi.Headers != nil {
+		t.Errorf("multi-value headers = %v / %v", multi.MultiValueHeaders, multi.Headers)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    EventType
+		wantErr bool
+	}{
+		{name: "api gateway v2", payload: `{"version":"2.0","requestContext":{"domainName":"id.execute-api.us-east-1.amazonaws.com"}}`, want: EventAPIGatewayV2},
+		{name: "function url", payload: `{"version":"2.0","requestContext":{"domainName":"id.lambda-url.us-east-1.on.aws"}}`, want: EventFunctionURL},
+		{name: "alb", payload: `{"httpMethod":"GET","requestContext":{"elb":{"targetGroupArn":"arn"}}}`, want: EventALB},
+		{name: "api gateway v1", payload: `{"httpMethod":"GET","requestContext":{"stage":"prod"}}`, wantErr: true},
+		{name: "invalid json", payload: `{`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Detect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	tests := []struct {
+		name    string
+		payload string
+		check   func(t *testing.T, resp interface{})
+	}{
+		{
+			name:    "api gateway v2",
+			payload: `{"version":"2.0","rawPath":"/health","requestContext":{"domainName":"id.execute-api.us-east-1.amazonaws.com","http":{"method":"GET"}}}`,
+			check: func(t *testing.T, resp interface{}) {
+				r, ok := resp.(events.APIGatewayV2HTTPResponse)
+				if !ok || r.StatusCode != http.StatusAccepted || r.Headers["X-Path"] != "/health" {
+					t.Errorf("response = %#v", resp)
+				}
+			},
+		},
+		{
+			name:    "function url",
+			payload: `{"version":"2.0","rawPath":"/health","requestContext":{"domainName":"id.lambda-url.us-east-1.on.aws","http":{"method":"GET"}}}`,
+			check: func(t *testing.T, resp interface{}) {
+				r, ok := resp.(events.LambdaFunctionURLResponse)
+				if !ok || r.StatusCode != http.StatusAccepted || r.Headers["X-Path"] != "/health" {
+					t.Errorf("response = %#v", resp)
+				}
+			},
+		},
+		{
+			name:    "alb multi-value",
+			payload: `{"httpMethod":"GET","path":"/health","multiValueHeaders":{"accept":["*/*"]},"requestContext":{"elb":{"targetGroupArn":"arn"}}}`,
+			check: func(t *testing.T, resp interface{}) {
+				r, ok := resp.(events.ALBTargetGroupResponse)
+				if !ok || r.StatusCode != http.StatusAccepted || len(r.MultiValueHeaders["X-Path"]) != 1 {
+					t.Errorf("response = %#v", resp)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Serve(context.Background(), echo, []byte(tt.payload), nil)
+			if err != nil {
+				t.Fatalf("Serve() error = %v", err)
+			}
+			tt.check(t, resp)
+		})
+	}
+
+	if _, err := Serve(context.Background(), echo, []byte(`{"source":"aws.events"}`), nil); err == nil {
+		t.Error("Serve() expected error for non-HTTP event")
+	}
+}
+
+func TestServeStream(t *testing.T) {
+	flushed := false
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte{0xff, 0x00})
+		w.Write([]byte("tail"))
+	})
+	done := func() { flushed = true }
+
+	payload := `{"version":"2.0","rawPath":"/v1/failures/f1/artifacts/request.raw","requestContext":{"domainName":"id.lambda-url.us-east-1.on.aws","http":{"method":"GET"}}}`
+	resp, err := ServeStream(context.Background(), stream, []byte(payload), nil, done)
+	if err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	r, ok := resp.(*events.LambdaFunctionURLStreamingResponse)
+	if !ok || r.StatusCode != http.StatusPartialContent || r.Headers["Content-Type"] != "application/octet-stream" || len(r.Cookies) != 1 {
+		t.Fatalf("response = %#v", resp)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil || string(body) != "\xff\x00tail" {
+		t.Errorf("body = %q, %v; want the raw bytes", body, err)
+	}
+	if !flushed {
+		t.Error("done not called before the stream ended")
+	}
+
+	// Other events are buffered
+	flushed = false
+	resp, err = ServeStream(context.Background(), stream, []byte(`{"version":"2.0","rawPath":"/health","requestContext":{"domainName":"id.execute-api.us-east-1.amazonaws.com","http":{"method":"GET"}}}`), nil, done)
+	if _, ok := resp.(events.APIGatewayV2HTTPResponse); !ok || err != nil || !flushed {
+		t.Errorf("ServeStream(api gateway) = %#v, %v", resp, err)
+	}
+}
+
+func TestServe_Oversized(t *testing.T) {
+	big := func(w http.ResponseWriter, r *http.Request) {
+		if ResponseLimit(r.Context()) == 0 {
+			t.Error("ResponseLimit() = 0 for a buffered response")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + strings.Repeat("x", MaxResponseBytes) + `"`))
+	}
+	payload := []byte(`{"version":"2.0","rawPath":"/v1/failures","requestContext":{"domainName":"id.execute-api.us-east-1.amazonaws.com","http":{"method":"GET"}}}`)
+
+	var stored []byte
+	spill := func(_ context.Context, contentType string, body []byte) (string, error) {
+		stored = body
+		return "https://storage.test/responses/r1", nil
+	}
+	resp, _ := Serve(context.Background(), http.HandlerFunc(big), payload, spill)
+	r := resp.(events.APIGatewayV2HTTPResponse)
+	if r.StatusCode != http.StatusSeeOther || r.Headers["Location"] != "https://storage.test/responses/r1" || len(stored) != MaxResponseBytes+2 {
+		t.Errorf("response = %d %v, want a redirect to the stored body", r.StatusCode, r.Headers)
+	}
+
+	resp, _ = Serve(context.Background(), http.HandlerFunc(big), payload, nil)
+	r = resp.(events.APIGatewayV2HTTPResponse)
+	if r.StatusCode != http.StatusInternalServerError || !strings.Contains(r.Body, "response_too_large") {
+		t.Errorf("response = %d %.200s, want response_too_large without spill", r.StatusCode, r.Body)
+	}
+
+	// Handlers serving a failure's data spill it to that failure's bucket
+	scoped := func(w http.ResponseWriter, r *http.Request) {
+		SetSpillScope(r.Context(), "myapp", "prod")
+		big(w, r)
+	}
+	var project, env string
+	spill = func(ctx context.Context, _ string, _ []byte) (string, error) {
+		project, env, _ = keys.ScopeFrom(ctx)
+		return "https://storage.test/responses/r2", nil
+	}
+	Serve(context.Background(), http.HandlerFunc(scoped), payload, spill)
+	if project != "myapp" || env != "prod" {
+		t.Errorf("spilled with scope %q/%q, want myapp/prod", project, env)
+	}
+
+	// Bodies within the limit once encoded are left alone
+	small := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("\xff", maxBodyBytes)))
+	})
+	resp, _ = Serve(context.Background(), small, payload, nil)
+	if r := resp.(events.APIGatewayV2HTTPResponse); r.StatusCode != http.StatusOK || !r.IsBase64Encoded {
+		t.Errorf("response = %d, want the binary body returned", r.StatusCode)
+	}
+}
+
+func TestServe_ConversionFailure(t *testing.T) {
+	ev := newEvent(http.MethodPost, "/v1/upload-ticket")
+	ev.Version = "2.0"
+	ev.RequestContext.RequestID = "req-abc123"
+	ev.Body, ev.IsBase64Encoded = "not base64!", true
+	payload, _ := json.Marshal(ev)
+
+	resp, err := Serve(context.Background(), http.NotFoundHandler(), payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := resp.(events.APIGatewayV2HTTPResponse)
+	var p apierror.Problem
+	if err := json.Unmarshal([]byte(r.Body), &p); err != nil {
+		t.Fatalf("body %q is not a problem: %v", r.Body, err)
+	}
+	if r.StatusCode != http.StatusInternalServerError || r.Headers["Content-Type"] != apierror.ContentType {
+		t.Errorf("response = %d %v, want a 500 problem", r.StatusCode, r.Headers)
+	}
+	if p.Code != apierror.CodeInternal || p.RequestID != "req-abc123" || p.Instance != "/v1/upload-ticket" {
+		t.Errorf("problem = %+v, want internal_error with the event's request ID and path", p)
+	}
+}
@@ -0,0 +1,59 @@
+package apigw
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type authorizerContextKey struct{}
+
+// WithAuthorizerClaims returns a copy of ctx carrying claims validated by an
+// API Gateway authorizer
+func WithAuthorizerClaims(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, authorizerContextKey{}, claims)
+}
+
+// AuthorizerClaims returns the authorizer claims of the request, if API
+// Gateway sent any. They come from the event, never from request headers.
+func AuthorizerClaims(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(authorizerContextKey{}).(map[string]interface{})
+	return claims, ok && len(claims) > 0
+}
+
+// authorizerClaims flattens the authorizer description of a payload v2 event.
+// JWT authorizers pass every claim as a string, rendering arrays as "[a b]";
+// those are turned back into lists. The authorization scopes of the route fill
+// the scope claim when the token has none. Lambda authorizer context is used as is.
+func authorizerClaims(a *events.APIGatewayV2HTTPRequestContextAuthorizerDescription) map[string]interface{} {
+	if a == nil {
+		return nil
+	}
+	if a.JWT != nil {
+		claims := make(map[string]interface{}, len(a.JWT.Claims)+1)
+		for k, v := range a.JWT.Claims {
+			claims[k] = claimValue(v)
+		}
+		if _, ok := claims["scope"]; !ok && len(a.JWT.Scopes) > 0 {
+			claims["scope"] = strings.Join(a.JWT.Scopes, " ")
+		}
+		return claims
+	}
+	if len(a.Lambda) > 0 {
+		return a.Lambda
+	}
+	return nil
+}
+
+// claimValue decodes API Gateway's "[a b c]" rendering of an array claim
+func claimValue(v string) interface{} {
+	if len(v) < 2 || v[0] != '[' || v[len(v)-1] != ']' {
+		return v
+	}
+	items := []interface{}{}
+	for _, f := range strings.Fields(v[1 : len(v)-1]) {
+		items = append(items, f)
+	}
+	return items
+}
@@ -0,0 +1,136 @@
+package apigw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// MaxResponseBytes is Lambda's limit on buffered responses. It applies to the
+// whole response event, so headers and base64 encoding count against it.
+const MaxResponseBytes = 6 * 1024 * 1024
+
+// maxBodyBytes is the largest binary body certain to fit a buffered response
+// once base64 encoded, leaving room for the headers. Text bodies are escaped
+// as JSON strings instead, which may grow them further.
+const maxBodyBytes = (MaxResponseBytes - 64*1024) / 4 * 3
+
+// SpillPrefix is the S3 prefix oversized responses are stored under; a bucket
+// lifecycle rule should expire them after a day
+const SpillPrefix = "responses/"
+
+// Spill stores the body of an oversized response and returns a URL it can be
+// fetched from instead
+type Spill func(ctx context.Context, contentType string, body []byte) (string, error)
+
+// Store is the subset of S3 operations spilling responses needs
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	PresignGet(ctx context.Context, key string) (string, error)
+}
+
+// NewSpill returns a Spill storing bodies in store under SpillPrefix and
+// returning presigned URLs of them
+func NewSpill(store Store) Spill {
+	return func(ctx context.Context, contentType string, body []byte) (string, error) {
+		key := SpillKey(time.Now())
+		if err := store.PutObjectBytes(ctx, key, contentType, body); err != nil {
+			return "", err
+		}
+		return store.PresignGet(ctx, key)
+	}
+}
+
+// SpillKey returns a new key to store an oversized response at
+// Format: responses/YYYY-MM-DD/{random}
+func SpillKey(now time.Time) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return SpillPrefix + now.UTC().Format("2006-01-02") + "/" + hex.EncodeToString(b)
+}
+
+type limitKey struct{}
+
+// withResponseLimit marks ctx as serving a buffered response
+func withResponseLimit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, limitKey{}, int64(maxBodyBytes))
+}
+
+// ResponseLimit returns the largest body the response to a request with ctx
+// can carry, or 0 when it is not limited. Bodies of buffered Lambda responses
+// are limited; handlers serving large objects should redirect to them beyond
+// the limit rather than read them into memory.
+func ResponseLimit(ctx context.Context) int64 {
+	n, _ := ctx.Value(limitKey{}).(int64)
+	return n
+}
+
+// oversized reports whether resp, the Lambda response built from rw, exceeds
+// MaxResponseBytes
+func (rw *ResponseWriter) oversized(resp interface{}) bool {
+	switch n := rw.body.Len(); {
+	case n <= maxBodyBytes/2:
+		return false
+	case n > MaxResponseBytes:
+		return true
+	}
+	b, err := json.Marshal(resp)
+	return err != nil || len(b) > MaxResponseBytes
+}
+
+type spillScopeKey struct{}
+
+// spillScope is the project and env of the failure a response holds data of
+type spillScope struct {
+	project string
+	env     string
+}
+
+// withSpillScope lets the handler serving ctx's request name the failure its
+// response holds data of
+func withSpillScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, spillScopeKey{}, &spillScope{})
+}
+
+// SetSpillScope records that the response to the request of ctx holds data of
+// a failure of project and env, so it is spilled to that failure's bucket if
+// oversized. Outside Serve it does nothing.
+func SetSpillScope(ctx context.Context, project, env string) {
+	if s, ok := ctx.Value(spillScopeKey{}).(*spillScope); ok {
+		s.project, s.env = project, env
+	}
+}
+
+// spillResponse replaces the oversized response in rw: a successful,
+// uncompressed one is stored with spill and answered with a redirect to it,
+// anything else with a problem explaining the limit
+func spillResponse(ctx context.Context, r *http.Request, rw *ResponseWriter, spill Spill) *ResponseWriter {
+	size := rw.body.Len()
+	out := NewResponseWriter()
+	if spill != nil && rw.status == http.StatusOK && rw.header.Get("Content-Encoding") == "" {
+		if s, ok := ctx.Value(spillScopeKey{}).(*spillScope); ok && s.project != "" {
+			ctx = keys.WithScope(ctx, s.project, s.env)
+		}
+		url, err := spill(ctx, rw.header.Get("Content-Type"), rw.body.Bytes())
+		if err == nil {
+			logging.FromContext(ctx).Info().Str("path", r.URL.Path).Int("bytes", size).Msg("oversized response redirected")
+			out.Header().Set("Location", url)
+			out.Header().Set("Cache-Control", "no-store")
+			out.WriteHeader(http.StatusSeeOther)
+			return out
+		}
+		logging.FromContext(ctx).Error().Err(err).Str("path", r.URL.Path).Msg("failed to store oversized response")
+	}
+
+	logging.FromContext(ctx).Error().Str("path", r.URL.Path).Int("status", rw.status).Int("bytes", size).Msg("response exceeds the Lambda payload limit")
+	apierror.Write(out, r, apierror.New(http.StatusInternalServerError, apierror.CodeResponseTooLarge, "Response too large").
+		WithDetail("the %d byte response exceeds Lambda's %d byte limit; narrow the request or use a Function URL with response streaming", size, MaxResponseBytes))
+	return out
+}
@@ -0,0 +1,142 @@
+package apigw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/requestid"
+)
+
+// EventType identifies the shape of a Lambda HTTP event
+type EventType string
+
+const (
+	EventAPIGatewayV2 EventType = "apigw-v2"
+	EventFunctionURL  EventType = "function-url"
+	EventALB          EventType = "alb"
+)
+
+// ErrUnknownEvent is returned for payloads that are not a supported HTTP event
+var ErrUnknownEvent = errors.New("unsupported Lambda event")
+
+// Detect reports which HTTP event shape payload is. ALB events carry
+// requestContext.elb; payload v2 events come from API Gateway or, when the
+// domain is a lambda-url domain, from a Function URL.
+func Detect(payload []byte) (EventType, error) {
+	var probe struct {
+		Version        string `json:"version"`
+		RequestContext struct {
+			ELB        json.RawMessage `json:"elb"`
+			DomainName string          `json:"domainName"`
+		} `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(probe.RequestContext.ELB) > 0:
+		return EventALB, nil
+	case probe.Version == "2.0" && strings.Contains(probe.RequestContext.DomainName, ".lambda-url."):
+		return EventFunctionURL, nil
+	case probe.Version == "2.0":
+		return EventAPIGatewayV2, nil
+	default:
+		return "", ErrUnknownEvent
+	}
+}
+
+// Serve runs handler for an API Gateway v2, Function URL or ALB event and returns
+// the response in the matching shape. Responses over Lambda's payload limit
+// are stored with spill and answered with a redirect to them; without spill,
+// or when storing fails, they become a response_too_large problem.
+func Serve(ctx context.Context, handler http.Handler, payload json.RawMessage, spill Spill) (interface{}, error) {
+	kind, err := Detect(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		httpReq *http.Request
+		respond func(*ResponseWriter) interface{}
+	)
+	ctx = withSpillScope(withResponseLimit(ctx))
+	switch kind {
+	case EventALB:
+		var ev events.ALBTargetGroupRequest
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			return nil, err
+		}
+		multiValue := len(ev.MultiValueHeaders) > 0
+		httpReq, err = NewALBRequest(ctx, ev)
+		respond = func(rw *ResponseWriter) interface{} { return rw.ALBResponse(multiValue) }
+	case EventFunctionURL:
+		var ev events.LambdaFunctionURLRequest
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			return nil, err
+		}
+		httpReq, err = NewFunctionURLRequest(ctx, ev)
+		respond = func(rw *ResponseWriter) interface{} { return rw.FunctionURLResponse() }
+	default:
+		var ev events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			return nil, err
+		}
+		httpReq, err = NewRequest(ctx, ev)
+		respond = func(rw *ResponseWriter) interface{} { return rw.Response() }
+	}
+
+	rw := NewResponseWriter()
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("event", string(kind)).Msg("failed to convert request")
+		writeConversionFailure(ctx, rw, payload)
+		return respond(rw), nil
+	}
+
+	handler.ServeHTTP(rw, httpReq)
+	resp := respond(rw)
+	if rw.oversized(resp) {
+		resp = respond(spillResponse(ctx, httpReq, rw, spill))
+	}
+	return resp, nil
+}
+
+// writeConversionFailure answers an event that could not be converted to a
+// request with an internal problem, carrying the event's path and request ID
+// as the handlers' problems do
+func writeConversionFailure(ctx context.Context, w http.ResponseWriter, payload json.RawMessage) {
+	var probe struct {
+		RawPath        string `json:"rawPath"`
+		Path           string `json:"path"`
+		RequestContext struct {
+			RequestID string `json:"requestId"`
+		} `json:"requestContext"`
+	}
+	_ = json.Unmarshal(payload, &probe)
+
+	id := probe.RequestContext.RequestID
+	if !requestid.Valid(id) {
+		id = ""
+		if lc, ok := lambdacontext.FromContext(ctx); ok {
+			id = lc.AwsRequestID
+		}
+	}
+	if id != "" {
+		ctx = context.WithValue(ctx, chimiddleware.RequestIDKey, id)
+	}
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if probe.RawPath != "" {
+		r.URL.Path = probe.RawPath
+	} else if probe.Path != "" {
+		r.URL.Path = probe.Path
+	}
+	apierror.Write(w, r, apierror.Internal(apierror.CodeInternal, "Internal server error"))
+}
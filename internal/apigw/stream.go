@@ -0,0 +1,103 @@
+package apigw
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ServeStream is Serve for functions whose Function URL uses the
+// RESPONSE_STREAM invoke mode: Function URL responses stream to the client as
+// the handler writes them, so downloads are neither buffered in memory nor
+// held to MaxResponseBytes. Other events are served by Serve, spilling
+// oversized responses with spill. done runs once the handler returned, before
+// the response ends, so work such as flushing metrics finishes within the
+// invocation.
+func ServeStream(ctx context.Context, handler http.Handler, payload json.RawMessage, spill Spill, done func()) (interface{}, error) {
+	kind, err := Detect(payload)
+	if err != nil || kind != EventFunctionURL {
+		defer done()
+		return Serve(ctx, handler, payload, spill)
+	}
+
+	var ev events.LambdaFunctionURLRequest
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		defer done()
+		return nil, err
+	}
+	httpReq, err := NewFunctionURLRequest(ctx, ev)
+	if err != nil {
+		// Serve answers requests that cannot be converted
+		defer done()
+		return Serve(ctx, handler, payload, spill)
+	}
+
+	body, pw := io.Pipe()
+	sw := newStreamWriter(pw)
+	go func() {
+		defer func() {
+			sw.WriteHeader(http.StatusOK)
+			done()
+			pw.Close()
+		}()
+		handler.ServeHTTP(sw, httpReq)
+	}()
+
+	// The runtime cancels ctx once the response was sent or failed; unblock a
+	// handler still writing to a stream nobody reads
+	go func() {
+		<-ctx.Done()
+		body.CloseWithError(ctx.Err())
+	}()
+
+	<-sw.ready
+	headers, cookies := v2Headers(sw.sent)
+	return &events.LambdaFunctionURLStreamingResponse{
+		StatusCode: sw.status,
+		Headers:    headers,
+		Cookies:    cookies,
+		Body:       body,
+	}, nil
+}
+
+// streamWriter passes a handler's response body on as it is written. The
+// status and headers are fixed by the first Write or WriteHeader call.
+type streamWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+
+	once   sync.Once
+	ready  chan struct{}
+	status int
+	sent   http.Header
+}
+
+func newStreamWriter(body *io.PipeWriter) *streamWriter {
+	return &streamWriter{header: make(http.Header), body: body, ready: make(chan struct{})}
+}
+
+// Header returns the response headers
+func (sw *streamWriter) Header() http.Header {
+	return sw.header
+}
+
+// Write streams b to the client
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	sw.WriteHeader(http.StatusOK)
+	return sw.body.Write(b)
+}
+
+// WriteHeader sends the status code and headers; only the first call takes effect
+func (sw *streamWriter) WriteHeader(status int) {
+	sw.once.Do(func() {
+		sw.status, sw.sent = status, sw.header.Clone()
+		close(sw.ready)
+	})
+}
+
+// Flush is a no-op: written bytes are passed on unbuffered
+func (sw *streamWriter) Flush() {}
@@ -0,0 +1,297 @@
+package apikeys
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+)
+
+// Scope is a permission granted to an API key
+type Scope string
+
+const (
+	ScopeTicketCreate Scope = "ticket:create"
+	ScopeFailureRead  Scope = "failure:read"
+	ScopeAdmin        Scope = "admin"
+	// ScopeCritical lets a key's requests marked critical draw from their own
+	// rate limit bucket; the header alone grants nothing
+	ScopeCritical Scope = "ticket:critical"
+)
+
+// reservedProject is the project name no failure can be stored under, so no
+// key may be scoped to it
+const reservedProject = keys.ReservedProject
+
+// Wildcard matches any project when present in Key.Projects
+const Wildcard = "*"
+
+// Key describes a single API key and what it may access
+type Key struct {
+	ID     string `json:"id"`
+	Secret string `json:"key,omitempty"`
+	// SecretHash is the hex SHA-256 of the secret, so API_KEYS need not hold
+	// the secret itself; set either it or Secret
+	SecretHash string   `json:"keyHash,omitempty"`
+	Projects   []string `json:"projects"`
+	Scopes     []Scope  `json:"scopes"`
+	// Tenant is the org the key belongs to; with MULTI_TENANT set, its
+	// failures are stored and read under the tenant's prefix only
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Identity returns the key ID
+func (k *Key) Identity() string {
+	return k.ID
+}
+
+// TenantID returns the tenant the key belongs to, or an empty string
+func (k *Key) TenantID() string {
+	return k.Tenant
+}
+
+// AllowsProject reports whether the key may act on the given project
+func (k *Key) AllowsProject(project string) bool {
+	for _, p := range k.Projects {
+		if p == Wildcard || p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the key was granted the given scope.
+// The admin scope implies every other scope.
+func (k *Key) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry maps API key secrets to their definitions. Only secret hashes are
+// kept. Keys configured at startup are replaced by SetConfigured; managed keys
+// are replaced by SetManaged.
+type Registry struct {
+	mu      sync.RWMutex
+	keys    []entry
+	managed []entry
+}
+
+// entry is one secret that authenticates key until expiresAt (zero = never)
+type entry struct {
+	hash      [sha256.Size]byte
+	key       *Key
+	expiresAt time.Time
+}
+
+// NewRegistry creates a registry from a list of keys. Plaintext secrets are
+// hashed and dropped.
+func NewRegistry(keys []Key) (*Registry, error) {
+	r := &Registry{keys: make([]entry, 0, len(keys))}
+	seen := make(map[[sha256.Size]byte]bool, len(keys))
+	for i := range keys {
+		k := keys[i]
+		if k.ID == "" {
+			return nil, fmt.Errorf("api key %d: id is required", i)
+		}
+		var hash [sha256.Size]byte
+		switch {
+		case k.Secret != "" && k.SecretHash != "":
+			return nil, fmt.Errorf("api key %q: set key or keyHash, not both", k.ID)
+		case k.Secret != "":
+			hash = sha256.Sum256([]byte(k.Secret))
+		case k.SecretHash != "":
+			var ok bool
+			if hash, ok = parseHash(k.SecretHash); !ok {
+				return nil, fmt.Errorf("api key %q: keyHash must be a hex SHA-256", k.ID)
+			}
+		default:
+			return nil, fmt.Errorf("api key %d: key or keyHash is required", i)
+		}
+		if slices.Contains(k.Projects, reservedProject) {
+			return nil, fmt.Errorf("api key %q: project %q is reserved", k.ID, reservedProject)
+		}
+		if seen[hash] {
+			return nil, fmt.Errorf("api key %q: duplicate key", k.ID)
+		}
+		seen[hash] = true
+		k.Secret, k.SecretHash = "", ""
+		r.keys = append(r.keys, entry{hash: hash, key: &k})
+	}
+	return r, nil
+}
+
+// parseHash decodes a hex SHA-256, optionally prefixed with "sha256:"
+func parseHash(s string) ([sha256.Size]byte, bool) {
+	var hash [sha256.Size]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "sha256:"))
+	if err != nil || len(b) != sha256.Size {
+		return hash, false
+	}
+	copy(hash[:], b)
+	return hash, true
+}
+
+// ParseJSON builds a registry from a JSON array of keys, e.g.
+// [{"id":"ios","key":"secret","projects":["myapp"],"scopes":["ticket:create"]}]
+func ParseJSON(data []byte) (*Registry, error) {
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse api keys: %w", err)
+	}
+	return NewRegistry(keys)
+}
+
+// Load builds a registry from the JSON key list, falling back to the legacy
+// single key, which is granted every project and scope.
+func Load(keysJSON, legacyKey string) (*Registry, error) {
+	if keysJSON != "" {
+		return ParseJSON([]byte(keysJSON))
+	}
+	if legacyKey != "" {
+		return NewRegistry([]Key{{
+			ID:       "default",
+			Secret:   legacyKey,
+			Projects: []string{Wildcard},
+			Scopes:   []Scope{ScopeAdmin},
+		}})
+	}
+	return NewRegistry(nil)
+}
+
+// LoadAdmin builds the registry of admin API credentials from a JSON key list.
+// Admin keys are granted every project and scope; they only authenticate the
+// admin API, never client routes.
+func LoadAdmin(keysJSON string) (*Registry, error) {
+	if keysJSON == "" {
+		return NewRegistry(nil)
+	}
+	var keys []Key
+	if err := json.Unmarshal([]byte(keysJSON), &keys); err != nil {
+		return nil, fmt.Errorf("parse admin api keys: %w", err)
+	}
+	for i := range keys {
+		keys[i].Projects = []string{Wildcard}
+		keys[i].Scopes = []Scope{ScopeAdmin}
+	}
+	return NewRegistry(keys)
+}
+
+// Lookup returns the key matching the provided secret. The secret's hash is
+// compared in constant time against every registered secret, so response
+// timing reveals neither whether nor which key matched.
+func (r *Registry) Lookup(secret string) (*Key, bool) {
+	if r == nil {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(secret))
+	now := time.Now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found *Key
+	for _, entries := range [][]entry{r.keys, r.managed} {
+		for _, e := range entries {
+			match := subtle.ConstantTimeCompare(e.hash[:], hash[:]) == 1
+			if match && (e.expiresAt.IsZero() || now.Before(e.expiresAt)) && found == nil {
+				found = e.key
+			}
+		}
+	}
+	return found, found != nil
+}
+
+// Configured returns the keys configured at startup without their secrets,
+// sorted by ID
+func (r *Registry) Configured() []Key {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Key, 0, len(r.keys))
+	for _, e := range r.keys {
+		out = append(out, *e.key)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// IsConfigured reports whether id belongs to a key configured at startup
+func (r *Registry) IsConfigured(id string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, e := range r.keys {
+		if e.key.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SetConfigured replaces the keys configured at startup with those of next,
+// e.g. after their secret was rotated. Managed keys are kept.
+func (r *Registry) SetConfigured(next *Registry) {
+	next.mu.RLock()
+	keys := next.keys
+	next.mu.RUnlock()
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+}
+
+// SetManaged replaces the managed keys. Disabled keys, malformed secrets and
+// keys whose ID is taken by a configured key are skipped.
+func (r *Registry) SetManaged(keys []Managed) {
+	var managed []entry
+	for _, m := range keys {
+		if m.Disabled || r.IsConfigured(m.ID) {
+			continue
+		}
+		k := &Key{ID: m.ID, Projects: m.Projects, Scopes: m.Scopes, Tenant: m.Tenant}
+		for _, s := range m.Secrets {
+			hash, ok := parseHash(s.Hash)
+			if !ok {
+				continue
+			}
+			e := entry{hash: hash, key: k}
+			if s.ExpiresAt != nil {
+				e.expiresAt = *s.ExpiresAt
+			}
+			managed = append(managed, e)
+		}
+	}
+	r.mu.Lock()
+	r.managed = managed
+	r.mu.Unlock()
+}
+
+// Len returns the number of registered keys
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make(map[string]bool)
+	for _, entries := range [][]entry{r.keys, r.managed} {
+		for _, e := range entries {
+			ids[e.key.ID] = true
+		}
+	}
+	return len(ids)
+}
@@ -0,0 +1,249 @@
+package apikeys
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	r, err := ParseJSON([]byte(`[
+		{"id":"ios","key":"s1","projects":["myapp"],"scopes":["ticket:create"]},
+		{"id":"ops","key":"s2","projects":["*"],"scopes":["admin"]}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	if r.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", r.Len())
+	}
+
+	k, ok := r.Lookup("s1")
+	if !ok || k.ID != "ios" {
+		t.Fatalf("Lookup(s1) = %v, %v", k, ok)
+	}
+	if _, ok := r.Lookup("nope"); ok {
+		t.Error("Lookup(nope) should fail")
+	}
+}
+
+func TestParseJSON_KeyHash(t *testing.T) {
+	r, err := ParseJSON([]byte(`[{"id":"ios","keyHash":"sha256:` + HashSecret("s1") + `","projects":["myapp"],"scopes":["ticket:create"]}]`))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	if k, ok := r.Lookup("s1"); !ok || k.ID != "ios" {
+		t.Errorf("Lookup(s1) = %v, %v", k, ok)
+	}
+	if got := r.Configured(); got[0].Secret != "" || got[0].SecretHash != "" {
+		t.Errorf("Configured() = %+v, want no secrets", got)
+	}
+}
+
+func TestParseJSON_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "malformed", json: `{`},
+		{name: "missing key", json: `[{"id":"a"}]`},
+		{name: "missing id", json: `[{"key":"s"}]`},
+		{name: "duplicate key", json: `[{"id":"a","key":"s"},{"id":"b","key":"s"}]`},
+		{name: "duplicate hash", json: `[{"id":"a","key":"s"},{"id":"b","keyHash":"` + HashSecret("s") + `"}]`},
+		{name: "key and hash", json: `[{"id":"a","key":"s","keyHash":"` + HashSecret("s") + `"}]`},
+		{name: "malformed hash", json: `[{"id":"a","keyHash":"abc"}]`},
+		{name: "reserved project", json: `[{"id":"a","key":"s","projects":["v2"]}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJSON([]byte(tt.json)); err == nil {
+				t.Error("ParseJSON() expected error")
+			}
+		})
+	}
+}
+
+func TestKey_Permissions(t *testing.T) {
+	k := &Key{ID: "ios", Projects: []string{"myapp"}, Scopes: []Scope{ScopeTicketCreate}}
+
+	if !k.AllowsProject("myapp") {
+		t.Error("AllowsProject(myapp) = false, want true")
+	}
+	if k.AllowsProject("other") {
+		t.Error("AllowsProject(other) = true, want false")
+	}
+	if !k.HasScope(ScopeTicketCreate) {
+		t.Error("HasScope(ticket:create) = false, want true")
+	}
+	if k.HasScope(ScopeFailureRead) {
+		t.Error("HasScope(failure:read) = true, want false")
+	}
+
+	admin := &Key{Projects: []string{Wildcard}, Scopes: []Scope{ScopeAdmin}}
+	if !admin.AllowsProject("anything") || !admin.HasScope(ScopeFailureRead) {
+		t.Error("admin key should allow every project and scope")
+	}
+}
+
+func TestLoad_LegacyKey(t *testing.T) {
+	r, err := Load("", "legacy")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	k, ok := r.Lookup("legacy")
+	if !ok {
+		t.Fatal("legacy key not registered")
+	}
+	if !k.AllowsProject("myapp") || !k.HasScope(ScopeTicketCreate) {
+		t.Error("legacy key should be unrestricted")
+	}
+}
+
+func TestRegistry_SetConfigured(t *testing.T) {
+	r, _ := ParseJSON([]byte(`[{"id":"ios","key":"old"}]`))
+	r.SetManaged([]Managed{{ID: "ci", Secrets: []Secret{{Hash: HashSecret("managed")}}}})
+	next, _ := ParseJSON([]byte(`[{"id":"ios","key":"new"}]`))
+	r.SetConfigured(next)
+
+	if _, ok := r.Lookup("old"); ok {
+		t.Error("Lookup(old) should fail after the keys were replaced")
+	}
+	for _, secret := range []string{"new", "managed"} {
+		if _, ok := r.Lookup(secret); !ok {
+			t.Errorf("Lookup(%s) failed", secret)
+		}
+	}
+}
+
+func TestLoadAdmin(t *testing.T) {
+	r, err := LoadAdmin(`[{"id":"ops","key":"a1","projects":["myapp"],"scopes":["failure:read"]}]`)
+	if err != nil {
+		t.Fatalf("LoadAdmin() error = %v", err)
+	}
+	k, ok := r.Lookup("a1")
+	if !ok || !k.AllowsProject("other") || !k.HasScope(ScopeAdmin) {
+		t.Errorf("Lookup(a1) = %+v, %v; want an unrestricted admin key", k, ok)
+	}
+	if r, _ := LoadAdmin(""); r.Len() != 0 {
+		t.Error("LoadAdmin(\"\") registered keys")
+	}
+}
+
+// memStore is an in-memory Store for tests
+type memStore struct {
+	objects map[string][]byte
+}
+
+func (m *memStore) PutObjectBytes(_ context.Context, key, _ string, data []byte) error {
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memStore) GetObjectBytes(_ context.Context, key string) ([]byte, error) {
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", key)
+	}
+	return b, nil
+}
+
+func (m *memStore) ListKeys(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memStore) DeleteObjects(_ context.Context, keys []string) error {
+	for _, k := range keys {
+		delete(m.objects, k)
+	}
+	return nil
+}
+
+func TestRegistry_Sync(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{objects: make(map[string][]byte)}
+	r, _ := ParseJSON([]byte(`[{"id":"ios","key":"s1","projects":["myapp"],"scopes":["ticket:create"]}]`))
+
+	secret, err := GenerateSecret()
+	if err != nil || !strings.HasPrefix(secret, secretPrefix) {
+		t.Fatalf("GenerateSecret() = %q, %v", secret, err)
+	}
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	for _, m := range []Managed{
+		{ID: "web", Secrets: []Secret{{Hash: HashSecret(secret)}}, Projects: []string{"myapp"}, Scopes: []Scope{ScopeFailureRead}, CreatedAt: now},
+		{ID: "ios", Secrets: []Secret{{Hash: HashSecret("shadow")}}, Projects: []string{Wildcard}, Scopes: []Scope{ScopeAdmin}, CreatedAt: now},
+		{ID: "off", Secrets: []Secret{{Hash: HashSecret("off")}}, Projects: []string{Wildcard}, Scopes: []Scope{ScopeAdmin}, Disabled: true},
+	} {
+		if err := SaveManaged(ctx, store, m); err != nil {
+			t.Fatalf("SaveManaged() error = %v", err)
+		}
+	}
+
+	if err := r.Sync(ctx, store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if k, ok := r.Lookup(secret); !ok || k.ID != "web" || !k.HasScope(ScopeFailureRead) {
+		t.Errorf("Lookup(managed) = %+v, %v", k, ok)
+	}
+	if _, ok := r.Lookup("shadow"); ok {
+		t.Error("managed key shadowing a configured ID was registered")
+	}
+	if _, ok := r.Lookup("off"); ok {
+		t.Error("disabled key authenticated")
+	}
+	if r.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", r.Len())
+	}
+	if got := r.Configured(); len(got) != 1 || got[0].ID != "ios" || got[0].Secret != "" {
+		t.Errorf("Configured() = %+v", got)
+	}
+
+	if err := DeleteManaged(ctx, store, "web"); err != nil {
+		t.Fatalf("DeleteManaged() error = %v", err)
+	}
+	_ = r.Sync(ctx, store)
+	if _, ok := r.Lookup(secret); ok {
+		t.Error("revoked key still authenticates")
+	}
+}
+
+func TestManaged_Rotate(t *testing.T) {
+	now := time.Now().UTC()
+	m := &Managed{ID: "web", Secrets: []Secret{{Hash: HashSecret("old"), CreatedAt: now.Add(-time.Hour)}}, Projects: []string{"myapp"}, Scopes: []Scope{ScopeTicketCreate}}
+
+	m.Rotate(HashSecret("new"), time.Hour, now)
+	if len(m.Secrets) != 2 || m.Secrets[0].ExpiresAt == nil || !m.Secrets[0].ExpiresAt.Equal(now.Add(time.Hour)) || m.Secrets[1].ExpiresAt != nil {
+		t.Fatalf("Rotate() secrets = %+v", m.Secrets)
+	}
+
+	// Both secrets work during the overlap
+	r, _ := NewRegistry(nil)
+	r.SetManaged([]Managed{*m})
+	for _, secret := range []string{"old", "new"} {
+		if _, ok := r.Lookup(secret); !ok {
+			t.Errorf("Lookup(%s) failed during the overlap", secret)
+		}
+	}
+
+	// A rotation without overlap drops the previous secrets at once
+	m.Rotate(HashSecret("newer"), 0, now)
+	if len(m.Secrets) != 1 || m.Secrets[0].Hash != HashSecret("newer") {
+		t.Errorf("Rotate(0) secrets = %+v", m.Secrets)
+	}
+
+	expired := now.Add(-time.Minute)
+	r.SetManaged([]Managed{{ID: "web", Secrets: []Secret{{Hash: HashSecret("old"), ExpiresAt: &expired}}}})
+	if _, ok := r.Lookup("old"); ok {
+		t.Error("expired secret authenticated")
+	}
+}
@@ -0,0 +1,200 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/storage"
+)
+
+// Prefix is the S3 prefix under which managed keys are stored
+const Prefix = "apikeys/"
+
+// secretPrefix marks generated secrets so leaked keys are easy to scan for
+const secretPrefix = "fu_"
+
+// Store is the subset of S3 operations managed keys need
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	DeleteObjects(ctx context.Context, keys []string) error
+}
+
+// Rotation overlap: how long a rotated-out secret keeps working by default, and at most
+const (
+	DefaultOverlap = 24 * time.Hour
+	MaxOverlap     = 30 * 24 * time.Hour
+)
+
+// Managed is an API key created through the admin API. Only the SHA-256 of
+// its secrets is stored; a secret is shown once, when it is generated.
+type Managed struct {
+	ID        string    `json:"id"`
+	Secrets   []Secret  `json:"secrets"`
+	Projects  []string  `json:"projects"`
+	Scopes    []Scope   `json:"scopes"`
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	// Disabled keys stay stored but authenticate nothing until re-enabled
+	Disabled  bool       `json:"disabled,omitempty"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+}
+
+// Secret is one secret of a managed key, valid until ExpiresAt when set
+type Secret struct {
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Active returns the secrets still valid at now
+func (m *Managed) Active(now time.Time) []Secret {
+	var active []Secret
+	for _, s := range m.Secrets {
+		if s.ExpiresAt == nil || now.Before(*s.ExpiresAt) {
+			active = append(active, s)
+		}
+	}
+	return active
+}
+
+// Rotate adds a secret hashed as hash. Secrets that are still valid expire
+// after overlap, or earlier if they already expire sooner, so clients can
+// switch over; expired secrets are dropped.
+func (m *Managed) Rotate(hash string, overlap time.Duration, now time.Time) {
+	now = now.UTC()
+	until := now.Add(overlap)
+	secrets := []Secret{}
+	for _, s := range m.Active(now) {
+		if s.ExpiresAt == nil || s.ExpiresAt.After(until) {
+			s.ExpiresAt = &until
+		}
+		if s.ExpiresAt.After(now) {
+			secrets = append(secrets, s)
+		}
+	}
+	m.Secrets = append(secrets, Secret{Hash: hash, CreatedAt: now})
+	m.RotatedAt = &now
+}
+
+// ManagedKey returns the object key of a managed key
+// Format: apikeys/{id}.json
+func ManagedKey(id string) string {
+	return Prefix + id + ".json"
+}
+
+// HashSecret returns the hex SHA-256 of secret, as stored for managed keys
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateSecret returns a new random API key secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SaveManaged stores m, replacing any managed key with the same ID
+func SaveManaged(ctx context.Context, store Store, m Managed) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := store.PutObjectBytes(ctx, ManagedKey(m.ID), "application/json", b); err != nil {
+		return fmt.Errorf("write api key %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// LoadManagedKey returns the managed key id, or an error wrapping
+// storage.ErrNotFound when there is none
+func LoadManagedKey(ctx context.Context, store Store, id string) (*Managed, error) {
+	b, err := store.GetObjectBytes(ctx, ManagedKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("read api key %s: %w", id, err)
+	}
+	var m Managed
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse api key %s: %w", id, err)
+	}
+	return &m, nil
+}
+
+// DeleteManaged removes the managed key id
+func DeleteManaged(ctx context.Context, store Store, id string) error {
+	if err := store.DeleteObjects(ctx, []string{ManagedKey(id)}); err != nil {
+		return fmt.Errorf("delete api key %s: %w", id, err)
+	}
+	return nil
+}
+
+// LoadManaged returns every stored managed key. Keys deleted while listing are skipped.
+func LoadManaged(ctx context.Context, store Store) ([]Managed, error) {
+	objKeys, err := store.ListKeys(ctx, Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+
+	var keys []Managed
+	for _, k := range objKeys {
+		if !strings.HasSuffix(k, ".json") {
+			continue
+		}
+		b, err := store.GetObjectBytes(ctx, k)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read api key %s: %w", k, err)
+		}
+		var m Managed
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("parse api key %s: %w", k, err)
+		}
+		keys = append(keys, m)
+	}
+	return keys, nil
+}
+
+// Sync replaces the registry's managed keys with those in store
+func (r *Registry) Sync(ctx context.Context, store Store) error {
+	keys, err := LoadManaged(ctx, store)
+	if err != nil {
+		return err
+	}
+	r.SetManaged(keys)
+	return nil
+}
+
+// Watch syncs managed keys every interval until ctx is done, so keys created
+// or revoked on another instance take effect here. Failed syncs keep the
+// previous keys.
+func (r *Registry) Watch(ctx context.Context, store Store, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Sync(ctx, store); err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Msg("failed to sync managed api keys")
+			}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+const (
+	failuresPrefix   = "failures/"
+	failuresV2Prefix = "failures/v2/"
+)
+
+// Store is the subset of S3 operations used for archiving and restores
+type Store interface {
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+	SetStorageClass(ctx context.Context, key string, storageClass types.StorageClass) error
+	RestoreObject(ctx context.Context, key string, days int32) error
+}
+
+// Failure is a single captured failure and the objects stored for it
+type Failure struct {
+	Tenant    string
+	Project   string
+	Env       string
+	FailureID string
+	Prefix    string
+	Keys      []string
+}
+
+// Policy controls archive transitions and expiry notices
+type Policy struct {
+	// RetentionDays is the age at which failures are deleted (0 = kept forever)
+	RetentionDays int
+	// ArchiveAfterDays is the age at which failures move to StorageClass (0 = never)
+	ArchiveAfterDays int
+	// NoticeDays is how long before deletion the expiry notice is sent
+	NoticeDays   int
+	StorageClass types.StorageClass
+	// Retention overrides RetentionDays per project and env when set
+	Retention Retention
+}
+
+// Retention resolves retention periods per project and env
+type Retention interface {
+	// DaysFor returns the retention of project/env in days (0 = kept forever)
+	DaysFor(project, env string) int
+	// Periods returns every distinct positive retention period in use
+	Periods() []int
+}
+
+// Notice lists a project's failures that will be deleted on ExpiresOn
+type Notice struct {
+	Tenant    string
+	Project   string
+	ExpiresOn time.Time
+	Failures  []Failure
+}
+
+// Notifier delivers expiry notices
+type Notifier interface {
+	SendExpiryNotice(ctx context.Context, n Notice) error
+}
+
+// ParseStorageClass validates an archive storage class name
+func ParseStorageClass(name string) (types.StorageClass, error) {
+	switch sc := types.StorageClass(strings.ToUpper(name)); sc {
+	case types.StorageClassGlacier, types.StorageClassDeepArchive, types.StorageClassGlacierIr:
+		return sc, nil
+	default:
+		return "", fmt.Errorf("unsupported archive storage class %q", name)
+	}
+}
+
+// PrefixLister lists the immediate child prefixes under a prefix
+type PrefixLister interface {
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ProjectEnv is a project and env with stored failures. Tenant is set for
+// failures stored under a tenant prefix.
+type ProjectEnv struct {
+	Tenant  string
+	Project string
+	Env     string
+}
+
+// Prefixes returns the prefixes holding the failures of p
+func (p ProjectEnv) Prefixes() []string {
+	return keys.EnvPrefixes(p.Tenant, p.Project, p.Env)
+}
+
+// ProjectEnvs lists every project/env pair that has stored failures, across
+// key schemes and tenants
+func ProjectEnvs(ctx context.Context, store PrefixLister) ([]ProjectEnv, error) {
+	var pairs []ProjectEnv
+	seen := make(map[ProjectEnv]bool)
+	add := func(tenant, root string) error {
+		projects, err := store.ListPrefixes(ctx, root)
+		if err != nil {
+			return err
+		}
+		for _, pp := range projects {
+			if root == failuresPrefix && (pp == failuresV2Prefix || strings.HasPrefix(pp, keys.TenantsPrefix)) {
+				continue
+			}
+			envs, err := store.ListPrefixes(ctx, pp)
+			if err != nil {
+				return err
+			}
+			project := strings.TrimSuffix(strings.TrimPrefix(pp, root), "/")
+			for _, ep := range envs {
+				pair := ProjectEnv{Tenant: tenant, Project: project, Env: strings.TrimSuffix(strings.TrimPrefix(ep, pp), "/")}
+				if !seen[pair] {
+					seen[pair] = true
+					pairs = append(pairs, pair)
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, root := range []string{failuresPrefix, failuresV2Prefix} {
+		if err := add("", root); err != nil {
+			return nil, err
+		}
+	}
+	tenants, err := store.ListPrefixes(ctx, keys.TenantsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, tp := range tenants {
+		if err := add(strings.TrimSuffix(strings.TrimPrefix(tp, keys.TenantsPrefix), "/"), tp); err != nil {
+			return nil, err
+		}
+	}
+
+	return pairs, nil
+}
+
+// FailuresOn lists all failures stored for day, across tenants, projects, envs and key schemes
+func FailuresOn(ctx context.Context, store Store, day time.Time) ([]Failure, error) {
+	pairs, err := ProjectEnvs(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+
+	var failures []Failure
+	for _, pair := range pairs {
+		for _, dayPrefix := range keys.DayPrefixes(pair.Tenant, pair.Project, pair.Env, day.UTC()) {
+			objKeys, err := store.ListKeys(ctx, dayPrefix)
+			if err != nil {
+				return nil, err
+			}
+
+			byID := make(map[string]*Failure)
+			var order []string
+			for _, k := range objKeys {
+				id, _, ok := strings.Cut(strings.TrimPrefix(k, dayPrefix), "/")
+				if !ok {
+					continue
+				}
+				f, exists := byID[id]
+				if !exists {
+					f = &Failure{Tenant: pair.Tenant, Project: pair.Project, Env: pair.Env, FailureID: id, Prefix: dayPrefix + id + "/"}
+					byID[id] = f
+					order = append(order, id)
+				}
+				f.Keys = append(f.Keys, k)
+			}
+			for _, id := range order {
+				failures = append(failures, *byID[id])
+			}
+		}
+	}
+
+	return failures, nil
+}
+
+// Archive transitions every object of the given failures to storageClass
+func Archive(ctx context.Context, store Store, failures []Failure, storageClass types.StorageClass) (int, error) {
+	var moved int
+	for _, f := range failures {
+		for _, k := range f.Keys {
+			if err := store.SetStorageClass(ctx, k, storageClass); err != nil {
+				return moved, fmt.Errorf("archive %s: %w", k, err)
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// Restore requests a temporary restore of every object under a failure prefix
+func Restore(ctx context.Context, store Store, prefix string, days int32) (int, error) {
+	objKeys, err := store.ListKeys(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var restored int
+	for _, k := range objKeys {
+		if err := store.RestoreObject(ctx, k, days); err != nil {
+			return restored, fmt.Errorf("restore %s: %w", k, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// Run applies the archive policy for now: failures reaching ArchiveAfterDays are
+// transitioned, and projects with failures reaching the notice threshold are notified.
+func Run(ctx context.Context, store Store, notifier Notifier, policy Policy, now time.Time) error {
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	if policy.ArchiveAfterDays > 0 {
+		day := today.AddDate(0, 0, -policy.ArchiveAfterDays)
+		failures, err := FailuresOn(ctx, store, day)
+		if err != nil {
+			return fmt.Errorf("list failures to archive: %w", err)
+		}
+		moved, err := Archive(ctx, store, failures, policy.StorageClass)
+		if err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info().
+			Time("day", day).
+			Int("failures", len(failures)).
+			Int("objects", moved).
+			Str("storageClass", string(policy.StorageClass)).
+			Msg("archived failures")
+	}
+
+	if policy.NoticeDays <= 0 || notifier == nil {
+		return nil
+	}
+
+	periods := []int{policy.RetentionDays}
+	daysFor := func(string, string) int { return policy.RetentionDays }
+	if policy.Retention != nil {
+		periods = policy.Retention.Periods()
+		daysFor = policy.Retention.DaysFor
+	}
+
+	for _, days := range periods {
+		if days <= 0 {
+			continue
+		}
+		day := today.AddDate(0, 0, -(days - policy.NoticeDays))
+		failures, err := FailuresOn(ctx, store, day)
+		if err != nil {
+			return fmt.Errorf("list expiring failures: %w", err)
+		}
+
+		// Tenants' projects of the same name are noticed separately
+		byProject := make(map[[2]string][]Failure)
+		for _, f := range failures {
+			if daysFor(f.Project, f.Env) == days {
+				p := [2]string{f.Tenant, f.Project}
+				byProject[p] = append(byProject[p], f)
+			}
+		}
+		projects := make([][2]string, 0, len(byProject))
+		for p := range byProject {
+			projects = append(projects, p)
+		}
+		sort.Slice(projects, func(i, j int) bool {
+			if projects[i][0] != projects[j][0] {
+				return projects[i][0] < projects[j][0]
+			}
+			return projects[i][1] < projects[j][1]
+		})
+
+		expiresOn := day.AddDate(0, 0, days)
+		for _, p := range projects {
+			n := Notice{Tenant: p[0], Project: p[1], ExpiresOn: expiresOn, Failures: byProject[p]}
+			if err := notifier.SendExpiryNotice(ctx, n); err != nil {
+				logging.FromContext(ctx).Error().Err(err).Str("tenant", p[0]).Str("project", p[1]).Msg("failed to send expiry notice")
+			}
+		}
+	}
+
+	return nil
+}
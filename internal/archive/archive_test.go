@@ -0,0 +1,154 @@
+package archive_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/yourorg/failure-uploader/internal/archive"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+type recordingNotifier struct {
+	notices []archive.Notice
+}
+
+func (n *recordingNotifier) SendExpiryNotice(_ context.Context, notice archive.Notice) error {
+	n.notices = append(n.notices, notice)
+	return nil
+}
+
+func TestFailuresOn(t *testing.T) {
+	store := testsupport.NewStore()
+	store.Touch(
+		"failures/myapp/prod/2024/03/15/a/envelope.json",
+		"failures/myapp/prod/2024/03/15/a/request.raw",
+		"failures/myapp/prod/2024/03/16/b/envelope.json",
+		"failures/v2/myapp/prod/dt=2024-03-15/c/envelope.json",
+		"failures/other/dev/2024/03/15/d/envelope.json",
+		"failures/tenant=acme/myapp/prod/dt=2024-03-15/e/envelope.json",
+		"failures/tenant=acme/myapp/prod/dt=2024-03-16/f/envelope.json",
+	)
+
+	failures, err := archive.FailuresOn(context.Background(), store, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("FailuresOn() error = %v", err)
+	}
+
+	got := make(map[string]int)
+	for _, f := range failures {
+		got[f.FailureID] = len(f.Keys)
+	}
+	want := map[string]int{"a": 2, "c": 1, "d": 1, "e": 1}
+	if len(got) != len(want) {
+		t.Fatalf("FailuresOn() = %v, want %v", got, want)
+	}
+	for id, n := range want {
+		if got[id] != n {
+			t.Errorf("failure %s has %d keys, want %d", id, got[id], n)
+		}
+	}
+	for _, f := range failures {
+		if (f.FailureID == "e") != (f.Tenant == "acme") || (f.Tenant == "acme" && f.Project != "myapp") {
+			t.Errorf("failure %s = %+v", f.FailureID, f)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := testsupport.NewStore()
+	store.Touch(
+		"failures/myapp/prod/2024/02/15/old/envelope.json",
+		"failures/myapp/prod/2024/01/23/expiring/envelope.json",
+		"failures/myapp/prod/2024/03/14/fresh/envelope.json",
+	)
+	n := &recordingNotifier{}
+	policy := archive.Policy{RetentionDays: 60, ArchiveAfterDays: 30, NoticeDays: 7, StorageClass: types.StorageClassGlacier}
+	now := time.Date(2024, 3, 16, 3, 0, 0, 0, time.UTC)
+
+	if err := archive.Run(context.Background(), store, n, policy, now); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if obj, _ := store.Object("failures/myapp/prod/2024/02/15/old/envelope.json"); obj.StorageClass != types.StorageClassGlacier {
+		t.Errorf("30-day-old failure storage class = %q, want GLACIER", obj.StorageClass)
+	}
+	if obj, _ := store.Object("failures/myapp/prod/2024/03/14/fresh/envelope.json"); obj.StorageClass != "" {
+		t.Errorf("fresh failure storage class = %q, want it unchanged", obj.StorageClass)
+	}
+
+	if len(n.notices) != 1 {
+		t.Fatalf("sent %d notices, want 1", len(n.notices))
+	}
+	notice := n.notices[0]
+	if notice.Project != "myapp" || len(notice.Failures) != 1 || notice.Failures[0].FailureID != "expiring" {
+		t.Errorf("notice = %+v", notice)
+	}
+	if want := time.Date(2024, 3, 23, 0, 0, 0, 0, time.UTC); !notice.ExpiresOn.Equal(want) {
+		t.Errorf("ExpiresOn = %v, want %v", notice.ExpiresOn, want)
+	}
+}
+
+// projectRetention keeps "short" for 14 days and everything else for 60
+type projectRetention struct{}
+
+func (projectRetention) DaysFor(project, _ string) int {
+	if project == "short" {
+		return 14
+	}
+	return 60
+}
+
+func (projectRetention) Periods() []int { return []int{14, 60} }
+
+func TestRun_PerProjectRetention(t *testing.T) {
+	store := testsupport.NewStore()
+	store.Touch(
+		"failures/myapp/prod/2024/01/23/expiring/envelope.json",
+		"failures/short/prod/2024/03/09/expiring/envelope.json",
+		"failures/short/prod/2024/01/23/gone/envelope.json",
+	)
+	n := &recordingNotifier{}
+	policy := archive.Policy{NoticeDays: 7, Retention: projectRetention{}}
+	now := time.Date(2024, 3, 16, 3, 0, 0, 0, time.UTC)
+
+	if err := archive.Run(context.Background(), store, n, policy, now); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(n.notices) != 2 {
+		t.Fatalf("sent %d notices, want 2", len(n.notices))
+	}
+	for _, notice := range n.notices {
+		if len(notice.Failures) != 1 || notice.Failures[0].FailureID != "expiring" {
+			t.Errorf("notice for %s = %+v", notice.Project, notice.Failures)
+		}
+		if want := time.Date(2024, 3, 23, 0, 0, 0, 0, time.UTC); !notice.ExpiresOn.Equal(want) {
+			t.Errorf("%s ExpiresOn = %v, want %v", notice.Project, notice.ExpiresOn, want)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store := testsupport.NewStore()
+	store.Touch(
+		"failures/myapp/prod/2024/03/15/a/envelope.json",
+		"failures/myapp/prod/2024/03/15/a/request.raw",
+		"failures/myapp/prod/2024/03/15/b/envelope.json",
+	)
+
+	n, err := archive.Restore(context.Background(), store, "failures/myapp/prod/2024/03/15/a/", 7)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	var restored int
+	for _, k := range store.Keys("") {
+		if obj, _ := store.Object(k); obj.RestoreDays == 7 {
+			restored++
+		}
+	}
+	if n != 2 || restored != 2 {
+		t.Errorf("Restore() restored %d objects, want 2", n)
+	}
+}
@@ -0,0 +1,162 @@
+package athena
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func TestWrite(t *testing.T) {
+	store := testsupport.NewStore()
+	completed := time.Date(2024, 5, 1, 23, 30, 0, 0, time.FixedZone("", -2*3600))
+	env := &models.Envelope{
+		FailureID: "f-1",
+		Tenant:    "acme",
+		Project:   "myapp",
+		Env:       "prod",
+		Request:   models.RequestInfo{Method: "post", URL: "https://api.example.com/v1/orders/12345?x=1"},
+		Response:  &models.ResponseInfo{StatusCode: 503, DurationMs: 120},
+		Client:    models.ClientInfo{AppVersion: "2.1.0", Platform: "ios"},
+		CreatedAt: completed.Add(-time.Minute),
+		S3Prefix:  "tenant=acme/myapp/prod/2024/05/02/f-1/",
+		GroupID:   "g-1",
+	}
+
+	key, err := Write(context.Background(), store, Entry{Envelope: env, EnvelopeKey: env.S3Prefix + "envelope.json", Occurrences: 3, CompletedAt: completed})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// Partitioned by the UTC completion day
+	if want := "index/tenant=acme/project=myapp/dt=2024-05-02/f-1.json"; key != want {
+		t.Fatalf("key = %q, want %q", key, want)
+	}
+	obj, ok := store.Object(key)
+	if !ok {
+		t.Fatalf("no row written at %q", key)
+	}
+	b := obj.Data
+	if !strings.HasSuffix(string(b), "}\n") || strings.Count(string(b), "\n") != 1 {
+		t.Errorf("row is not a single JSON line: %q", b)
+	}
+
+	var row Row
+	if err := json.Unmarshal(b, &row); err != nil {
+		t.Fatal(err)
+	}
+	if row.Method != "POST" || row.Host != "api.example.com" || row.Path != "/v1/orders/{id}" {
+		t.Errorf("request columns = %q %q %q", row.Method, row.Host, row.Path)
+	}
+	if row.StatusCode != 503 || row.DurationMs != 120 || row.Occurrences != 3 || row.CompletedAt != "2024-05-02T01:30:00Z" {
+		t.Errorf("row = %+v", row)
+	}
+}
+
+func TestColumnsMatchRow(t *testing.T) {
+	typ := reflect.TypeOf(Row{})
+	if typ.NumField() != len(Columns) {
+		t.Fatalf("Row has %d fields, Columns has %d", typ.NumField(), len(Columns))
+	}
+	for i, col := range Columns {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if name != col.Name {
+			t.Errorf("column %d = %q, Row field is %q", i, col.Name, name)
+		}
+	}
+}
+
+func TestCatalogRegister(t *testing.T) {
+	var mu sync.Mutex
+	var ops []string
+	var partitions []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			t.Errorf("request is not signed")
+		}
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSGlue.")
+		body, _ := io.ReadAll(r.Body)
+		var in map[string]interface{}
+		_ = json.Unmarshal(body, &in)
+
+		mu.Lock()
+		ops = append(ops, op)
+		if op == "CreatePartition" {
+			partitions = append(partitions, in["PartitionInput"].(map[string]interface{}))
+		}
+		mu.Unlock()
+
+		if op == "CreateTable" {
+			// Created by another instance
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"AlreadyExistsException","message":"Table already exists."}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	creds := credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	c := newCatalog(srv.URL, "us-east-1", creds, "failures_db", "failures", "bucket")
+	ctx := context.Background()
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if err := c.Register(ctx, "", "myapp", day); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	if err := c.Register(ctx, "", "myapp", day.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	want := []string{"CreateTable", "CreatePartition", "CreatePartition"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("ops = %v, want %v", ops, want)
+	}
+	sd := partitions[0]["StorageDescriptor"].(map[string]interface{})
+	if loc := sd["Location"]; loc != "s3://bucket/index/project=myapp/dt=2024-05-01/" {
+		t.Errorf("partition location = %v", loc)
+	}
+	if vals := partitions[1]["Values"]; !reflect.DeepEqual(vals, []interface{}{"myapp", "2024-05-02"}) {
+		t.Errorf("partition values = %v", vals)
+	}
+}
+
+func TestCatalogRegister_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"EntityNotFoundException","message":"Database failures_db not found."}`))
+	}))
+	defer srv.Close()
+
+	creds := credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	c := newCatalog(srv.URL, "us-east-1", creds, "failures_db", "failures", "bucket")
+	err := c.Register(context.Background(), "", "myapp", time.Now())
+	if err == nil || !strings.Contains(err.Error(), "EntityNotFoundException") {
+		t.Fatalf("err = %v", err)
+	}
+	// Nothing was remembered, so the next failure retries
+	if c.isRegistered("failures") {
+		t.Error("table marked registered after an error")
+	}
+}
+
+func TestCatalogTableName(t *testing.T) {
+	c := newCatalog("", "", nil, "db", "failures", "bucket")
+	if got := c.TableName(""); got != "failures" {
+		t.Errorf("TableName(\"\") = %q", got)
+	}
+	if got := c.TableName("Acme-EU.1"); got != "failures_acme_eu_1" {
+		t.Errorf("TableName = %q", got)
+	}
+}
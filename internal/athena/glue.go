@@ -0,0 +1,213 @@
+package athena
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Hive formats of the JSON-lines index
+const (
+	inputFormat  = "org.apache.hadoop.mapred.TextInputFormat"
+	outputFormat = "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat"
+	serde        = "org.openx.data.jsonserde.JsonSerDe"
+)
+
+// Catalog registers the index's tables and partitions in the Glue Data Catalog,
+// so Athena can query a partition as soon as its first row is written. Calls
+// are idempotent; what was registered is remembered for the process lifetime.
+// A nil *Catalog registers nothing.
+type Catalog struct {
+	database string
+	table    string
+	bucket   string
+
+	endpoint string
+	region   string
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	http     *http.Client
+	now      func() time.Time
+
+	mu         sync.Mutex
+	registered map[string]bool
+}
+
+// NewCatalog creates a catalog registering tables named table in database for
+// the index in bucket, using the default AWS credentials for region
+func NewCatalog(ctx context.Context, region, database, table, bucket string) (*Catalog, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return newCatalog(fmt.Sprintf("https://glue.%s.amazonaws.com/", region), region, cfg.Credentials, database, table, bucket), nil
+}
+
+func newCatalog(endpoint, region string, creds aws.CredentialsProvider, database, table, bucket string) *Catalog {
+	return &Catalog{
+		database:   database,
+		table:      table,
+		bucket:     bucket,
+		endpoint:   endpoint,
+		region:     region,
+		creds:      creds,
+		signer:     v4.NewSigner(),
+		http:       &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+		registered: make(map[string]bool),
+	}
+}
+
+// TableName returns the table of a tenant's index: table itself, or
+// table_{tenant} with the tenant lowercased and reduced to [a-z0-9_]
+func (c *Catalog) TableName(tenant string) string {
+	if tenant == "" {
+		return c.table
+	}
+	name := []byte(strings.ToLower(tenant))
+	for i, ch := range name {
+		if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') {
+			name[i] = '_'
+		}
+	}
+	return c.table + "_" + string(name)
+}
+
+// Register ensures the table of tenant's index and the partition of project
+// on day exist
+func (c *Catalog) Register(ctx context.Context, tenant, project string, day time.Time) error {
+	if c == nil {
+		return nil
+	}
+	table := c.TableName(tenant)
+	dt := day.UTC().Format(DateLayout)
+	partition := table + "/" + project + "/" + dt
+	if c.isRegistered(partition) {
+		return nil
+	}
+
+	if !c.isRegistered(table) {
+		err := c.call(ctx, "CreateTable", map[string]interface{}{
+			"DatabaseName": c.database,
+			"TableInput": map[string]interface{}{
+				"Name":              table,
+				"Description":       "Failure metadata index written at upload-complete",
+				"TableType":         "EXTERNAL_TABLE",
+				"Parameters":        map[string]string{"classification": "json", "EXTERNAL": "TRUE"},
+				"PartitionKeys":     glueColumns(PartitionKeys),
+				"StorageDescriptor": c.storage(Root(tenant)),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("create table %s: %w", table, err)
+		}
+		c.markRegistered(table)
+	}
+
+	err := c.call(ctx, "CreatePartition", map[string]interface{}{
+		"DatabaseName": c.database,
+		"TableName":    table,
+		"PartitionInput": map[string]interface{}{
+			"Values":            []string{project, dt},
+			"StorageDescriptor": c.storage(PartitionPrefix(tenant, project, day)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create partition %s: %w", partition, err)
+	}
+	c.markRegistered(partition)
+	return nil
+}
+
+func (c *Catalog) isRegistered(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.registered[name]
+}
+
+func (c *Catalog) markRegistered(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.registered[name] = true
+}
+
+// storage describes the JSON-lines objects under prefix
+func (c *Catalog) storage(prefix string) map[string]interface{} {
+	return map[string]interface{}{
+		"Columns":      glueColumns(Columns),
+		"Location":     "s3://" + c.bucket + "/" + prefix,
+		"InputFormat":  inputFormat,
+		"OutputFormat": outputFormat,
+		"SerdeInfo": map[string]interface{}{
+			"SerializationLibrary": serde,
+			"Parameters":           map[string]string{"ignore.malformed.json": "true"},
+		},
+	}
+}
+
+func glueColumns(cols []Column) []map[string]string {
+	out := make([]map[string]string, 0, len(cols))
+	for _, col := range cols {
+		out = append(out, map[string]string{"Name": col.Name, "Type": col.Type})
+	}
+	return out
+}
+
+// call invokes a Glue JSON API operation. AlreadyExistsException counts as
+// success, which makes creating tables and partitions idempotent.
+func (c *Catalog) call(ctx context.Context, op string, in interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSGlue."+op)
+
+	creds, err := c.creds.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieve credentials: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "glue", c.region, c.now()); err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	var apiErr struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(msg, &apiErr)
+	if strings.HasSuffix(apiErr.Type, "AlreadyExistsException") {
+		return nil
+	}
+	if apiErr.Type != "" {
+		return fmt.Errorf("glue %s: %s: %s", op, apiErr.Type, apiErr.Message)
+	}
+	return fmt.Errorf("glue %s returned %s", op, resp.Status)
+}
@@ -0,0 +1,178 @@
+package athena
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/fingerprint"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Prefix is the S3 prefix under which the metadata index is stored
+const Prefix = "index/"
+
+// DateLayout is the format of the dt partition
+const DateLayout = "2006-01-02"
+
+// Store is the subset of S3 operations used for the index
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+}
+
+// Row is the flattened metadata of one completed failure, written as a single
+// JSON line. Columns are snake_case for Athena; project and dt are partition
+// keys taken from the key, so they are not repeated in the row.
+type Row struct {
+	FailureID   string `json:"failure_id"`
+	Tenant      string `json:"tenant,omitempty"`
+	Env         string `json:"env"`
+	GroupID     string `json:"group_id,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	Critical    bool   `json:"critical"`
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Host        string `json:"host,omitempty"`
+	Path        string `json:"path"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ErrorClass  string `json:"error_class,omitempty"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	AppVersion  string `json:"app_version,omitempty"`
+	Platform    string `json:"platform,omitempty"`
+	Occurrences int    `json:"occurrences,omitempty"`
+	// CreatedAt and CompletedAt are RFC 3339; query with from_iso8601_timestamp
+	CreatedAt   string `json:"created_at"`
+	CompletedAt string `json:"completed_at"`
+	S3Prefix    string `json:"s3_prefix"`
+	EnvelopeKey string `json:"envelope_key"`
+	Encrypted   bool   `json:"encrypted"`
+	// ContentMismatches counts artifacts whose bytes contradict their declared type
+	ContentMismatches int `json:"content_mismatches,omitempty"`
+}
+
+// Column is a table column with its Hive type
+type Column struct {
+	Name string
+	Type string
+}
+
+// Columns are the table columns, in Row order
+var Columns = []Column{
+	{"failure_id", "string"},
+	{"tenant", "string"},
+	{"env", "string"},
+	{"group_id", "string"},
+	{"severity", "string"},
+	{"critical", "boolean"},
+	{"method", "string"},
+	{"url", "string"},
+	{"host", "string"},
+	{"path", "string"},
+	{"status_code", "int"},
+	{"error_class", "string"},
+	{"duration_ms", "bigint"},
+	{"app_version", "string"},
+	{"platform", "string"},
+	{"occurrences", "int"},
+	{"created_at", "string"},
+	{"completed_at", "string"},
+	{"s3_prefix", "string"},
+	{"envelope_key", "string"},
+	{"encrypted", "boolean"},
+	{"content_mismatches", "int"},
+}
+
+// PartitionKeys are the partition columns, in key order
+var PartitionKeys = []Column{
+	{"project", "string"},
+	{"dt", "string"},
+}
+
+// Entry is a completed failure to index
+type Entry struct {
+	Envelope    *models.Envelope
+	EnvelopeKey string
+	Critical    bool
+	Occurrences int
+	Encrypted   bool
+	CompletedAt time.Time
+}
+
+// NewRow flattens e into a row
+func NewRow(e Entry) Row {
+	env := e.Envelope
+	row := Row{
+		FailureID:   env.FailureID,
+		Tenant:      env.Tenant,
+		Env:         env.Env,
+		GroupID:     env.GroupID,
+		Severity:    env.Severity,
+		Critical:    e.Critical,
+		Method:      strings.ToUpper(env.Request.Method),
+		URL:         env.Request.URL,
+		Path:        fingerprint.NormalizePath(env.Request.URL),
+		AppVersion:  env.Client.AppVersion,
+		Platform:    env.Client.Platform,
+		Occurrences: e.Occurrences,
+		CreatedAt:   env.CreatedAt.UTC().Format(time.RFC3339),
+		CompletedAt: e.CompletedAt.UTC().Format(time.RFC3339),
+		S3Prefix:    env.S3Prefix,
+		EnvelopeKey: e.EnvelopeKey,
+		Encrypted:   e.Encrypted,
+
+		ContentMismatches: len(env.ContentMismatches),
+	}
+	if row.S3Prefix == "" && e.EnvelopeKey != "" {
+		row.S3Prefix = path.Dir(e.EnvelopeKey) + "/"
+	}
+	if u, err := url.Parse(env.Request.URL); err == nil {
+		row.Host = u.Hostname()
+	}
+	if env.Response != nil {
+		row.StatusCode = env.Response.StatusCode
+		row.ErrorClass = env.Response.ErrorClass
+		row.DurationMs = env.Response.DurationMs
+	}
+	return row
+}
+
+// Root returns the index root of a tenant, the location of its table
+// Format: index/
+// Format with a tenant: index/tenant={tenant}/
+func Root(tenant string) string {
+	if tenant != "" {
+		return Prefix + "tenant=" + tenant + "/"
+	}
+	return Prefix
+}
+
+// PartitionPrefix returns the Hive-style prefix of a project's partition on day
+// Format: {root}project={project}/dt={yyyy-mm-dd}/
+func PartitionPrefix(tenant, project string, day time.Time) string {
+	return fmt.Sprintf("%sproject=%s/dt=%s/", Root(tenant), project, day.UTC().Format(DateLayout))
+}
+
+// Key returns the index object of a failure. Each failure is its own
+// single-line object, since S3 objects cannot be appended to.
+func Key(tenant, project string, day time.Time, failureID string) string {
+	return PartitionPrefix(tenant, project, day) + failureID + ".json"
+}
+
+// Write stores e's row in its partition, dated by its completion, and returns the key
+func Write(ctx context.Context, store Store, e Entry) (string, error) {
+	b, err := json.Marshal(NewRow(e))
+	if err != nil {
+		return "", err
+	}
+	key := Key(e.Envelope.Tenant, e.Envelope.Project, e.CompletedAt, e.Envelope.FailureID)
+	ctx = keys.WithScope(ctx, e.Envelope.Project, e.Envelope.Env)
+	if err := store.PutObjectBytes(ctx, key, "application/x-ndjson", append(b, '\n')); err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,342 @@
+// Package audit records security-relevant actions as append-only records:
+// rejected credentials and permissions, admin changes to keys, routes and
+// stored failures, and per-principal usage. Records are buffered and written
+// in batches, to S3 under Prefix or to the log.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/requestid"
+	"github.com/yourorg/failure-uploader/internal/usage"
+)
+
+// Prefix is the S3 prefix under which audit batches are stored
+const Prefix = "audit/events/"
+
+// MaxBatch is how many records are buffered before a write is forced
+const MaxBatch = 500
+
+// maxPending bounds the records kept across failed writes
+const maxPending = 10 * MaxBatch
+
+// Action names an audited action
+type Action string
+
+const (
+	// ActionAuthDenied is a request rejected with 401 or 403
+	ActionAuthDenied Action = "auth.denied"
+
+	ActionKeyCreate  Action = "apikey.create"
+	ActionKeyRotate  Action = "apikey.rotate"
+	ActionKeyDisable Action = "apikey.disable"
+	ActionKeyEnable  Action = "apikey.enable"
+	ActionKeyRevoke  Action = "apikey.revoke"
+
+	ActionRoutePut    Action = "route.put"
+	ActionRouteDelete Action = "route.delete"
+
+	ActionProjectPurge   Action = "project.purge"
+	ActionFailureDelete  Action = "failure.delete"
+	ActionFailureRelease Action = "failure.release"
+	ActionUserErase      Action = "user.erase"
+
+	// ActionUsage summarizes a principal's requests since the previous batch
+	ActionUsage Action = "usage"
+)
+
+// Outcome is how an audited action ended
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeDenied  Outcome = "denied"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event is one audit record
+type Event struct {
+	Time      time.Time `json:"time"`
+	Action    Action    `json:"action"`
+	Outcome   Outcome   `json:"outcome"`
+	Principal string    `json:"principal,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	SourceIP  string    `json:"sourceIp,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	// Target is what the action was applied to: a key ID, project or failure ID
+	Target  string            `json:"target,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	// Usage is set on ActionUsage records
+	Usage *usage.Counts `json:"usage,omitempty"`
+}
+
+// Sink persists batches of records
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+}
+
+// Store is the subset of S3 operations the S3 sink needs
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+}
+
+// S3Sink writes each batch as a new JSON Lines object under Prefix. Objects
+// are never rewritten; deny s3:DeleteObject on the prefix or enable Object
+// Lock to make the log tamper-evident.
+type S3Sink struct {
+	store Store
+}
+
+// NewS3Sink creates a sink writing to store
+func NewS3Sink(store Store) *S3Sink {
+	return &S3Sink{store: store}
+}
+
+// Key returns the object key of a batch written at t
+// Format: audit/events/YYYY-MM-DD/{RFC3339 time}-{random}.jsonl
+func Key(t time.Time) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	t = t.UTC()
+	return Prefix + t.Format("2006-01-02") + "/" + t.Format(time.RFC3339Nano) + "-" + hex.EncodeToString(b[:]) + ".jsonl"
+}
+
+// Write stores events as one object
+func (s *S3Sink) Write(ctx context.Context, events []Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return s.store.PutObjectBytes(ctx, Key(time.Now()), "application/x-ndjson", buf.Bytes())
+}
+
+// LogSink writes each record as a log line, for deployments that collect
+// audit records from CloudWatch Logs. The lines bypass level and sampling.
+type LogSink struct{}
+
+// Write logs events
+func (LogSink) Write(ctx context.Context, events []Event) error {
+	for _, ev := range events {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		logging.Log().Str("audit", string(ev.Action)).RawJSON("event", b).Msg("audit record")
+	}
+	return nil
+}
+
+// New creates a recorder for the configured sink: "s3" writes to store,
+// "log" to the process log and "" disables auditing, returning nil
+func New(sink string, store Store) (*Recorder, error) {
+	switch sink {
+	case "":
+		return nil, nil
+	case "s3":
+		return NewRecorder(NewS3Sink(store)), nil
+	case "log":
+		return NewRecorder(LogSink{}), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", sink)
+	}
+}
+
+// Recorder buffers records and writes them to its sink in batches. A nil
+// Recorder discards everything, so callers need not check whether auditing
+// is enabled.
+type Recorder struct {
+	sink Sink
+	now  func() time.Time
+
+	mu      sync.Mutex
+	pending []Event
+	usage   map[usageKey]*usage.Counts
+}
+
+// usageKey identifies whose usage is being summed
+type usageKey struct {
+	principal, tenant string
+}
+
+// NewRecorder creates a recorder writing to sink
+func NewRecorder(sink Sink) *Recorder {
+	return &Recorder{sink: sink, now: time.Now, usage: make(map[usageKey]*usage.Counts)}
+}
+
+// Record buffers ev, filling in its time, request ID and, when the request's
+// principal is known from WithRecorder's scope, who performed it. A full
+// buffer is written at once.
+func (r *Recorder) Record(ctx context.Context, ev Event) {
+	if r == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = r.now().UTC()
+	}
+	if ev.RequestID == "" {
+		ev.RequestID = requestid.FromContext(ctx)
+	}
+	if s := scopeFrom(ctx); s != nil && ev.Principal == "" {
+		ev.Principal, ev.Tenant = s.principal, s.tenant
+	}
+
+	r.mu.Lock()
+	r.pending = append(r.pending, ev)
+	full := len(r.pending) >= MaxBatch
+	r.mu.Unlock()
+
+	if full {
+		if err := r.Flush(context.WithoutCancel(ctx)); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("failed to write audit records")
+		}
+	}
+}
+
+// AddUsage adds a request's counts to the principal's usage since the last
+// write. Requests without a principal are not counted.
+func (r *Recorder) AddUsage(principal, tenant string, c usage.Counts) {
+	if r == nil || principal == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := usageKey{principal, tenant}
+	if r.usage[k] == nil {
+		r.usage[k] = &usage.Counts{}
+	}
+	r.usage[k].Add(c)
+}
+
+// Flush writes the buffered records and a usage record per principal. Records
+// of a failed write are kept for the next one, up to a bound.
+func (r *Recorder) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	events := r.pending
+	now := r.now().UTC()
+	keys := make([]usageKey, 0, len(r.usage))
+	for k := range r.usage {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].principal < keys[j].principal })
+	for _, k := range keys {
+		events = append(events, Event{
+			Time:      now,
+			Action:    ActionUsage,
+			Outcome:   OutcomeSuccess,
+			Principal: k.principal,
+			Tenant:    k.tenant,
+			Usage:     r.usage[k],
+		})
+	}
+	r.pending = nil
+	r.usage = make(map[usageKey]*usage.Counts)
+	r.mu.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+	err := r.sink.Write(ctx, events)
+	if err == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(events, r.pending...)
+	if dropped := len(r.pending) - maxPending; dropped > 0 {
+		r.pending = r.pending[dropped:]
+		return fmt.Errorf("%w (dropped %d audit records)", err, dropped)
+	}
+	return err
+}
+
+// Run writes buffered records every interval until ctx is done, then once more
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				logging.Error().Err(err).Msg("failed to write audit records")
+			}
+		case <-ctx.Done():
+			if err := r.Flush(context.WithoutCancel(ctx)); err != nil {
+				logging.Error().Err(err).Msg("failed to write audit records")
+			}
+			return
+		}
+	}
+}
+
+// scope carries the recorder through a request, along with the principal
+// once authentication has identified it
+type scope struct {
+	rec       *Recorder
+	principal string
+	tenant    string
+}
+
+type ctxKey struct{}
+
+// WithRecorder returns a copy of ctx carrying rec for Record and SetPrincipal
+func WithRecorder(ctx context.Context, rec *Recorder) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &scope{rec: rec})
+}
+
+func scopeFrom(ctx context.Context) *scope {
+	s, _ := ctx.Value(ctxKey{}).(*scope)
+	return s
+}
+
+// FromContext returns the recorder carried by ctx, or nil
+func FromContext(ctx context.Context) *Recorder {
+	if s := scopeFrom(ctx); s != nil {
+		return s.rec
+	}
+	return nil
+}
+
+// SetPrincipal notes who the request is authenticated as. The scope is
+// shared, so middleware that wrapped the request before authentication ran
+// also sees it.
+func SetPrincipal(ctx context.Context, principal, tenant string) {
+	if s := scopeFrom(ctx); s != nil {
+		s.principal, s.tenant = principal, tenant
+	}
+}
+
+// Principal returns the principal noted by SetPrincipal, and its tenant
+func Principal(ctx context.Context) (string, string) {
+	if s := scopeFrom(ctx); s != nil {
+		return s.principal, s.tenant
+	}
+	return "", ""
+}
+
+// Record buffers ev with the recorder carried by ctx
+func Record(ctx context.Context, ev Event) {
+	FromContext(ctx).Record(ctx, ev)
+}
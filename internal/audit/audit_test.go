@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/usage"
+)
+
+type fakeStore struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (s *fakeStore) PutObjectBytes(_ context.Context, key, contentType string, data []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[key] = data
+	return nil
+}
+
+// decode returns the records of every stored object
+func (s *fakeStore) decode(t *testing.T) []Event {
+	t.Helper()
+	var events []Event
+	for _, data := range s.objects {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			var ev Event
+			if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+				t.Fatalf("invalid record %q: %v", sc.Text(), err)
+			}
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func TestKey(t *testing.T) {
+	at := time.Date(2024, 3, 15, 10, 4, 5, 0, time.UTC)
+	key := Key(at)
+	if !regexp.MustCompile(`^audit/events/2024-03-15/2024-03-15T10:04:05Z-[0-9a-f]{8}\.jsonl$`).MatchString(key) {
+		t.Errorf("Key() = %q", key)
+	}
+	if Key(at) == key {
+		t.Error("Key() returned the same key twice")
+	}
+}
+
+func TestRecorder_Flush(t *testing.T) {
+	store := &fakeStore{}
+	rec := NewRecorder(NewS3Sink(store))
+	ctx := WithRecorder(context.Background(), rec)
+	SetPrincipal(ctx, "admin", "acme")
+
+	Record(ctx, Event{Action: ActionKeyRevoke, Outcome: OutcomeSuccess, Target: "k1"})
+	rec.AddUsage("ios", "acme", usage.Request(200, 10, 20))
+	rec.AddUsage("ios", "acme", usage.Request(500, 5, 0))
+	rec.AddUsage("", "", usage.Request(401, 0, 0))
+
+	if len(store.objects) != 0 {
+		t.Fatal("records written before Flush")
+	}
+	if err := rec.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if len(store.objects) != 1 {
+		t.Fatalf("wrote %d objects, want 1", len(store.objects))
+	}
+
+	events := store.decode(t)
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want a revoke and a usage record", events)
+	}
+	if ev := events[0]; ev.Action != ActionKeyRevoke || ev.Principal != "admin" || ev.Tenant != "acme" || ev.Time.IsZero() {
+		t.Errorf("revoke record = %+v", ev)
+	}
+	if ev := events[1]; ev.Action != ActionUsage || ev.Principal != "ios" || ev.Usage == nil ||
+		ev.Usage.Requests != 2 || ev.Usage.ServerErrors != 1 || ev.Usage.BytesIn != 15 {
+		t.Errorf("usage record = %+v", ev)
+	}
+
+	store.objects = nil
+	if err := rec.Flush(context.Background()); err != nil || len(store.objects) != 0 {
+		t.Errorf("second Flush() wrote %d objects, err = %v", len(store.objects), err)
+	}
+}
+
+func TestRecorder_FlushFailure(t *testing.T) {
+	store := &fakeStore{err: errors.New("s3 unavailable")}
+	rec := NewRecorder(NewS3Sink(store))
+	rec.Record(context.Background(), Event{Action: ActionAuthDenied, Outcome: OutcomeDenied})
+
+	if err := rec.Flush(context.Background()); err == nil {
+		t.Fatal("Flush() error = nil, want the store error")
+	}
+
+	store.err = nil
+	rec.Record(context.Background(), Event{Action: ActionRouteDelete, Outcome: OutcomeSuccess})
+	if err := rec.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	events := store.decode(t)
+	if len(events) != 2 || events[0].Action != ActionAuthDenied || events[1].Action != ActionRouteDelete {
+		t.Errorf("events = %+v, want the failed batch kept in order", events)
+	}
+}
+
+func TestRecorder_FullBatch(t *testing.T) {
+	store := &fakeStore{}
+	rec := NewRecorder(NewS3Sink(store))
+	for i := 0; i < MaxBatch; i++ {
+		rec.Record(context.Background(), Event{Action: ActionAuthDenied, Outcome: OutcomeDenied})
+	}
+	if len(store.objects) != 1 || len(store.decode(t)) != MaxBatch {
+		t.Errorf("wrote %d objects, want one full batch", len(store.objects))
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var rec *Recorder
+	ctx := WithRecorder(context.Background(), rec)
+	Record(ctx, Event{Action: ActionAuthDenied})
+	Record(context.Background(), Event{Action: ActionAuthDenied})
+	rec.AddUsage("ios", "", usage.Request(200, 0, 0))
+	if err := rec.Flush(ctx); err != nil {
+		t.Errorf("Flush() error = %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if rec, err := New("", nil); rec != nil || err != nil {
+		t.Errorf(`New("") = %v, %v; want nil, nil`, rec, err)
+	}
+	if rec, err := New("s3", &fakeStore{}); rec == nil || err != nil {
+		t.Errorf(`New("s3") = %v, %v`, rec, err)
+	}
+	if _, err := New("kinesis", nil); err == nil {
+		t.Error(`New("kinesis") error = nil`)
+	}
+}
@@ -0,0 +1,200 @@
+// Package autocomplete completes uploads from S3 ObjectCreated events instead
+// of trusting clients to call upload-complete. Each event is matched to its
+// ticket; once every upload the ticket expects is stored, or the ticket is
+// older than the timeout, the completion is queued to the verification queue,
+// where the API processes it like an async upload-complete.
+package autocomplete
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+// IdempotencyKey is the key completions are queued under, so a client that
+// still calls upload-complete afterwards is told the failure was already
+// completed instead of notifying it twice
+const IdempotencyKey = "auto-complete"
+
+// Triggers of a queued completion, as recorded in metrics
+const (
+	TriggerArrived = "arrived"
+	TriggerTimeout = "timeout"
+)
+
+// Store is the subset of S3 operations the worker needs
+type Store interface {
+	tickets.Store
+	VerifyObjectsExist(ctx context.Context, keys []string) ([]string, error)
+}
+
+// Enqueuer queues a completion for the API to process; *verify.Publisher
+// implements it
+type Enqueuer interface {
+	Enqueue(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string, criticalAllowed bool) error
+}
+
+// Worker queues the completions of tickets whose uploads have arrived
+type Worker struct {
+	store   Store
+	queue   Enqueuer
+	timeout time.Duration
+}
+
+// New creates a worker completing tickets once their expected uploads are
+// stored, or timeout after they were issued
+func New(store Store, queue Enqueuer, timeout time.Duration) *Worker {
+	return &Worker{store: store, queue: queue, timeout: timeout}
+}
+
+// Arrived handles the ObjectCreated event of key, queuing the completion of
+// its ticket when key was the last expected upload to arrive. Keys outside a
+// failure prefix and failures without a pending ticket are ignored.
+func (w *Worker) Arrived(ctx context.Context, key string) error {
+	loc, ok := keys.Parse(key)
+	if !ok {
+		return nil
+	}
+	r, err := tickets.Get(ctx, w.store, loc.FailureID)
+	if errors.Is(err, tickets.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Tickets issued before their expected uploads were tracked are left to
+	// the client or the timeout
+	if !w.pending(r, time.Now()) || len(r.Expected) == 0 {
+		return nil
+	}
+
+	missing, err := w.store.VerifyObjectsExist(ctx, r.Expected)
+	if err != nil {
+		return fmt.Errorf("check uploads of %s: %w", r.FailureID, err)
+	}
+	if len(missing) > 0 {
+		logging.FromContext(ctx).Debug().
+			Str("failureId", r.FailureID).
+			Str("key", key).
+			Int("missing", len(missing)).
+			Msg("upload arrived, waiting for the rest")
+		return nil
+	}
+	_, err = w.complete(ctx, r, TriggerArrived)
+	return err
+}
+
+// Result summarizes a sweep
+type Result struct {
+	// Queued is the number of timed-out tickets whose completion was queued
+	Queued int
+	Failed int
+}
+
+// Sweep queues the completion of every pending ticket issued at least the
+// timeout before now, with whichever uploads arrived. Tickets without any
+// upload are left for the reaper to expire.
+func (w *Worker) Sweep(ctx context.Context, now time.Time) (Result, error) {
+	var res Result
+
+	recordKeys, err := w.store.ListKeys(ctx, tickets.Prefix)
+	if err != nil {
+		return res, fmt.Errorf("list tickets: %w", err)
+	}
+
+	for _, key := range recordKeys {
+		failureID := strings.TrimSuffix(strings.TrimPrefix(key, tickets.Prefix), ".json")
+		r, err := tickets.Get(ctx, w.store, failureID)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("skipping unreadable ticket record")
+			continue
+		}
+		if !w.pending(r, now) || now.Before(r.IssuedAt.Add(w.timeout)) {
+			continue
+		}
+		queued, err := w.complete(ctx, r, TriggerTimeout)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", r.FailureID).Msg("failed to auto-complete timed-out ticket")
+			res.Failed++
+			continue
+		}
+		if queued {
+			res.Queued++
+		}
+	}
+
+	logging.FromContext(ctx).Info().
+		Int("queued", res.Queued).
+		Int("failed", res.Failed).
+		Msg("auto-completion sweep finished")
+
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d of %d timed-out tickets could not be completed", res.Failed, res.Failed+res.Queued)
+	}
+	return res, nil
+}
+
+// pending reports whether r still awaits completion: it is issued, the client
+// has not started completing it, and the worker has not queued its completion
+// within the timeout. A completion queued longer ago is presumed lost, e.g.
+// dropped by the queue, and may be queued again.
+func (w *Worker) pending(r *tickets.Record, now time.Time) bool {
+	if r.State != tickets.StateIssued || r.Completion != nil {
+		return false
+	}
+	return r.QueuedAt == nil || !now.Before(r.QueuedAt.Add(w.timeout))
+}
+
+// complete queues the completion of r with the uploads stored under its
+// prefix, reporting false when nothing was uploaded. The ticket is marked
+// queued first, since the completion rewrites the record once processed; if
+// queuing fails the mark is cleared again.
+func (w *Worker) complete(ctx context.Context, r *tickets.Record, trigger string) (bool, error) {
+	stored, err := w.store.ListKeys(ctx, r.S3Prefix)
+	if err != nil {
+		return false, fmt.Errorf("list %s: %w", r.S3Prefix, err)
+	}
+	if len(stored) == 0 {
+		return false, nil
+	}
+
+	req := &models.UploadCompleteRequest{
+		FailureID:    r.FailureID,
+		Project:      r.Project,
+		Env:          r.Env,
+		UploadedKeys: stored,
+		// Clients that gave up before uploading the envelope still get one,
+		// generated from the ticket
+		GenerateEnvelope: !slices.Contains(stored, r.S3Prefix+"envelope.json"),
+	}
+
+	now := time.Now().UTC()
+	if err := tickets.SetQueued(ctx, w.store, r, &now); err != nil {
+		return false, fmt.Errorf("mark %s queued: %w", r.FailureID, err)
+	}
+	if err := w.queue.Enqueue(ctx, req, IdempotencyKey, r.CriticalAllowed); err != nil {
+		if cerr := tickets.SetQueued(ctx, w.store, r, nil); cerr != nil {
+			logging.FromContext(ctx).Warn().Err(cerr).Str("failureId", r.FailureID).Msg("failed to clear queued mark")
+		}
+		return false, err
+	}
+	metrics.AutoCompletions.Inc(r.Project, trigger)
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", r.FailureID).
+		Str("project", r.Project).
+		Str("trigger", trigger).
+		Int("uploads", len(stored)).
+		Bool("generateEnvelope", req.GenerateEnvelope).
+		Msg("completion queued")
+	return true, nil
+}
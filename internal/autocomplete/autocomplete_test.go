@@ -0,0 +1,215 @@
+package autocomplete
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+const prefix = "failures/myapp/prod/2026/10/16/f1/"
+
+// fakeQueue records queued completions, failing while err is set
+type fakeQueue struct {
+	queued []models.UploadCompleteRequest
+	keys   []string
+	err    error
+}
+
+func (q *fakeQueue) Enqueue(_ context.Context, req *models.UploadCompleteRequest, idempotencyKey string, _ bool) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.queued = append(q.queued, *req)
+	q.keys = append(q.keys, idempotencyKey)
+	return nil
+}
+
+func newWorker(t *testing.T, issuedAt time.Time) (*Worker, *testsupport.Store, *fakeQueue) {
+	t.Helper()
+	store := testsupport.NewStore()
+	err := tickets.Issue(context.Background(), store, tickets.Record{
+		FailureID: "f1",
+		Project:   "myapp",
+		Env:       "prod",
+		S3Prefix:  prefix,
+		IssuedAt:  issuedAt,
+		Expected:  []string{prefix + "envelope.json", prefix + "request.raw"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := &fakeQueue{}
+	return New(store, q, 15*time.Minute), store, q
+}
+
+func ticket(t *testing.T, store *testsupport.Store) *tickets.Record {
+	t.Helper()
+	r, err := tickets.Get(context.Background(), store, "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestArrived(t *testing.T) {
+	w, store, q := newWorker(t, time.Now().UTC())
+	ctx := context.Background()
+
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+	if err := w.Arrived(ctx, prefix+"request.raw"); err != nil || len(q.queued) != 0 {
+		t.Fatalf("Arrived() = %v, queued %d; want to wait for the envelope", err, len(q.queued))
+	}
+
+	store.Put(prefix+"envelope.json", "application/json", []byte("{}"))
+	if err := w.Arrived(ctx, prefix+"envelope.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.queued) != 1 || q.keys[0] != IdempotencyKey {
+		t.Fatalf("queued = %+v, want one completion", q.queued)
+	}
+	req := q.queued[0]
+	if req.FailureID != "f1" || req.Project != "myapp" || len(req.UploadedKeys) != 2 || req.GenerateEnvelope {
+		t.Errorf("queued request = %+v", req)
+	}
+	if ticket(t, store).QueuedAt == nil {
+		t.Error("ticket not marked queued")
+	}
+
+	// Redelivered events do not queue the completion again
+	if err := w.Arrived(ctx, prefix+"envelope.json"); err != nil || len(q.queued) != 1 {
+		t.Errorf("redelivered event queued %d completions, want 1", len(q.queued))
+	}
+	// Neither do keys outside a failure prefix
+	if err := w.Arrived(ctx, tickets.Key("f1")); err != nil || len(q.queued) != 1 {
+		t.Errorf("ticket record event queued %d completions, want 1", len(q.queued))
+	}
+}
+
+func TestArrived_EnqueueFailure(t *testing.T) {
+	w, store, q := newWorker(t, time.Now().UTC())
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+	store.Put(prefix+"envelope.json", "application/json", []byte("{}"))
+	q.err = errors.New("queue unavailable")
+
+	if err := w.Arrived(context.Background(), prefix+"envelope.json"); err == nil {
+		t.Fatal("Arrived() error = nil, want the enqueue error so the event is retried")
+	}
+	if ticket(t, store).QueuedAt != nil {
+		t.Error("queued mark kept after the completion could not be queued")
+	}
+}
+
+func TestArrived_ClientCompleting(t *testing.T) {
+	w, store, q := newWorker(t, time.Now().UTC())
+	r := ticket(t, store)
+	if _, err := tickets.Claim(context.Background(), store, r, "client-key", "hash", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+	store.Put(prefix+"envelope.json", "application/json", []byte("{}"))
+
+	if err := w.Arrived(context.Background(), prefix+"envelope.json"); err != nil || len(q.queued) != 0 {
+		t.Errorf("Arrived() = %v, queued %d; want tickets the client is completing left alone", err, len(q.queued))
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Now().UTC()
+	w, store, q := newWorker(t, now.Add(-time.Hour))
+	ctx := context.Background()
+
+	// Nothing uploaded: left for the reaper
+	if res, err := w.Sweep(ctx, now); err != nil || res.Queued != 0 {
+		t.Fatalf("Sweep() = %+v, %v; want nothing queued without uploads", res, err)
+	}
+
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+	res, err := w.Sweep(ctx, now)
+	if err != nil || res.Queued != 1 {
+		t.Fatalf("Sweep() = %+v, %v; want the timed-out ticket queued", res, err)
+	}
+	if req := q.queued[0]; len(req.UploadedKeys) != 1 || !req.GenerateEnvelope {
+		t.Errorf("queued request = %+v, want the arrived upload with a generated envelope", req)
+	}
+
+	// Queued completions are only queued again once presumed lost
+	if res, _ := w.Sweep(ctx, now.Add(time.Minute)); res.Queued != 0 {
+		t.Errorf("second sweep queued %d, want 0", res.Queued)
+	}
+	if res, _ := w.Sweep(ctx, now.Add(time.Hour)); res.Queued != 1 {
+		t.Errorf("sweep after the timeout queued %d, want the lost completion queued again", res.Queued)
+	}
+}
+
+func TestSweep_NotTimedOut(t *testing.T) {
+	now := time.Now().UTC()
+	w, store, q := newWorker(t, now.Add(-time.Minute))
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+
+	if res, err := w.Sweep(context.Background(), now); err != nil || res.Queued != 0 || len(q.queued) != 0 {
+		t.Errorf("Sweep() = %+v, %v; want recent tickets left waiting", res, err)
+	}
+}
+
+func TestObjectKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "s3 notification",
+			payload: `{"Records":[{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"object":{"key":"failures/myapp/files/a+b%281%29.png"}}},{"eventSource":"aws:s3","eventName":"ObjectRemoved:Delete","s3":{"object":{"key":"gone"}}}]}`,
+			want:    []string{"failures/myapp/files/a b(1).png"},
+		},
+		{
+			name:    "eventbridge",
+			payload: `{"source":"aws.s3","detail-type":"Object Created","detail":{"bucket":{"name":"b"},"object":{"key":"failures/myapp/request.raw"}}}`,
+			want:    []string{"failures/myapp/request.raw"},
+		},
+		{name: "s3 test event", payload: `{"Service":"Amazon S3","Event":"s3:TestEvent"}`},
+		{name: "eventbridge without key", payload: `{"detail-type":"Object Created","detail":{}}`, wantErr: true},
+		{name: "not json", payload: `nope`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ObjectKeys([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ObjectKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("ObjectKeys() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	w, store, q := newWorker(t, time.Now().UTC().Add(-time.Hour))
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+	store.Put(prefix+"envelope.json", "application/json", []byte("{}"))
+	ctx := context.Background()
+
+	notification := `{"Records":[{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"object":{"key":"` + prefix + `envelope.json"}}}]}`
+	payload, _ := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "m1", EventSource: "aws:sqs", Body: notification},
+		{MessageId: "m2", EventSource: "aws:sqs", Body: "not json"},
+	}})
+	resp, err := w.Handle(ctx, payload)
+	if err != nil || len(resp.(events.SQSEventResponse).BatchItemFailures) != 0 || len(q.queued) != 1 {
+		t.Fatalf("Handle(SQS) = %+v, %v; queued %d", resp, err, len(q.queued))
+	}
+
+	// A schedule sweeps; the ticket was already queued
+	if _, err := w.Handle(ctx, json.RawMessage(`{"detail-type":"Scheduled Event","source":"aws.events","time":"2026-10-16T12:00:00Z"}`)); err != nil || len(q.queued) != 1 {
+		t.Errorf("Handle(schedule) = %v, queued %d; want nothing queued again", err, len(q.queued))
+	}
+}
@@ -0,0 +1,126 @@
+package autocomplete
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/queue/consumer"
+)
+
+// EventBridge detail types the worker handles
+const (
+	detailObjectCreated = "Object Created"
+	detailScheduled     = "Scheduled Event"
+)
+
+// ObjectKeys returns the keys of the objects created in an S3 event
+// notification, or in an EventBridge "Object Created" event. Other events,
+// such as the s3:TestEvent S3 sends when notifications are configured, hold
+// no keys.
+func ObjectKeys(payload []byte) ([]string, error) {
+	var probe struct {
+		Records    json.RawMessage `json:"Records"`
+		DetailType string          `json:"detail-type"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, consumer.Malformed(err)
+	}
+
+	switch {
+	case probe.Records != nil:
+		var event events.S3Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, consumer.Malformed(err)
+		}
+		var created []string
+		for _, rec := range event.Records {
+			if rec.EventSource == "aws:s3" && strings.HasPrefix(rec.EventName, "ObjectCreated:") {
+				created = append(created, rec.S3.Object.URLDecodedKey)
+			}
+		}
+		return created, nil
+	case probe.DetailType == detailObjectCreated:
+		var event events.CloudWatchEvent
+		var detail struct {
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, consumer.Malformed(err)
+		}
+		if err := json.Unmarshal(event.Detail, &detail); err != nil || detail.Object.Key == "" {
+			return nil, consumer.Malformed(errors.New("object created event without a key"))
+		}
+		return []string{detail.Object.Key}, nil
+	}
+	return nil, nil
+}
+
+// process handles the object events in body
+func (w *Worker) process(ctx context.Context, id, body string) error {
+	created, err := ObjectKeys([]byte(body))
+	if err != nil {
+		return err
+	}
+	for _, key := range created {
+		if err := w.Arrived(ctx, key); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("messageId", id).Str("key", key).Msg("object event will be retried")
+			return err
+		}
+	}
+	return nil
+}
+
+// consumer returns the consumer of the object event queue
+func (w *Worker) consumer() consumer.Consumer {
+	return consumer.New("object events", w.process)
+}
+
+// Handle processes a Lambda invocation: the SQS events of the object event
+// queue, S3 event notifications and EventBridge "Object Created" events
+// delivered directly, and EventBridge schedules, which run a sweep. Failed SQS
+// messages are reported as batch item failures so only those are retried.
+func (w *Worker) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	if sqsEvent, ok := consumer.SQSEvent(payload); ok {
+		return w.consumer().Handle(ctx, sqsEvent), nil
+	}
+
+	var event events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &event); err == nil && event.DetailType == detailScheduled {
+		now := event.Time
+		if now.IsZero() {
+			now = time.Now()
+		}
+		_, err := w.Sweep(ctx, now.UTC())
+		return nil, err
+	}
+
+	return nil, w.process(ctx, event.ID, string(payload))
+}
+
+// Poll consumes object events from the queue at queueURL; see consumer.Consumer.Poll
+func (w *Worker) Poll(ctx context.Context, client consumer.Receiver, queueURL string) {
+	w.consumer().Poll(ctx, client, queueURL)
+}
+
+// SweepEvery runs a sweep each interval until ctx is done
+func (w *Worker) SweepEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := w.Sweep(ctx, now.UTC()); err != nil {
+				logging.FromContext(ctx).Error().Err(err).Msg("auto-completion sweep failed")
+			}
+		}
+	}
+}
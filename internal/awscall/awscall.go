@@ -0,0 +1,156 @@
+// Package awscall bounds calls to AWS with per-call timeouts, adaptive
+// retries and a circuit breaker, so a struggling dependency fails requests
+// fast instead of holding them for the whole Lambda duration
+package awscall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// DefaultMaxAttempts bounds the tries of a call when a policy sets none
+const DefaultMaxAttempts = 5
+
+// ErrTimeout is returned, wrapped, for calls that exceeded their policy's
+// timeout. It matches context.DeadlineExceeded.
+var ErrTimeout = fmt.Errorf("aws call timed out: %w", context.DeadlineExceeded)
+
+// middlewareID names the policy's middleware in an operation's stack
+const middlewareID = "CallPolicy"
+
+// Policy bounds the calls of one client. Throttling, 5xx responses and
+// network errors are retried in adaptive mode, which also slows the client
+// down while AWS throttles it. The zero value only sets the retries.
+type Policy struct {
+	// Name is the dependency, e.g. s3, labelling the policy's metrics
+	Name string
+	// Timeout bounds each call including its retries; 0 disables it. The
+	// body of a streaming response, such as GetObject's, is read without it.
+	Timeout time.Duration
+	// MaxAttempts bounds the tries of each call, DefaultMaxAttempts when 0
+	MaxAttempts int
+	// Breaker, when set, fails calls fast while the dependency keeps failing
+	Breaker *Breaker
+}
+
+// LoadOptions applies the policy to clients created from the loaded config
+func (p Policy) LoadOptions() []func(*config.LoadOptions) error {
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	return []func(*config.LoadOptions) error{
+		config.WithRetryMode(aws.RetryModeAdaptive),
+		config.WithRetryMaxAttempts(attempts),
+		config.WithAPIOptions([]func(*middleware.Stack) error{p.APIOption}),
+	}
+}
+
+// APIOption adds the timeout and breaker to an operation's stack. Add it to
+// a client with config.WithAPIOptions; LoadOptions does.
+func (p Policy) APIOption(stack *middleware.Stack) error {
+	if p.Timeout <= 0 && p.Breaker == nil {
+		return nil
+	}
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(middlewareID, p.handle), middleware.Before)
+}
+
+// Skip removes the policy from an operation's stack. Presigning makes no
+// call, so presign clients add it to stay usable while the breaker is open.
+func Skip(stack *middleware.Stack) error {
+	_, _ = stack.Initialize.Remove(middlewareID)
+	return nil
+}
+
+func (p Policy) handle(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if err := p.Breaker.allow(); err != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, err
+	}
+	if p.Timeout <= 0 {
+		out, md, err := next.HandleInitialize(ctx, in)
+		p.Breaker.record(classify(ctx, err))
+		return out, md, err
+	}
+
+	// A timer rather than a deadline, so a streaming body can still be read
+	// once the call has returned
+	callCtx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(p.Timeout, func() { cancel(ErrTimeout) })
+	out, md, err := next.HandleInitialize(callCtx, in)
+	timer.Stop()
+
+	if err != nil && errors.Is(context.Cause(callCtx), ErrTimeout) {
+		metrics.AWSCallTimeouts.Inc(p.Name)
+		err = fmt.Errorf("%w after %s: %w", ErrTimeout, p.Timeout, err)
+	}
+	p.Breaker.record(classify(ctx, err))
+	if err != nil || !releaseOnClose(out.Result, func() { cancel(nil) }) {
+		cancel(nil)
+	}
+	return out, md, err
+}
+
+// classify tells whether err says the dependency is failing. Error
+// responses below 500 other than throttling are the caller's problem, and
+// canceled calls say nothing.
+func classify(ctx context.Context, err error) outcome {
+	var (
+		resp   *smithyhttp.ResponseError
+		params smithy.InvalidParamsError
+	)
+	switch {
+	case err == nil:
+		return succeeded
+	case errors.Is(err, ErrTimeout):
+		return failed
+	case ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.As(err, &params):
+		return ignored
+	case errors.As(err, &resp):
+		if code := resp.HTTPStatusCode(); code < http.StatusInternalServerError && code != http.StatusTooManyRequests {
+			return succeeded
+		}
+	}
+	return failed
+}
+
+// readCloserType is the type of streaming output bodies
+var readCloserType = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+
+// releaseOnClose defers release until the Body of a streaming output is
+// closed, reporting whether result has one
+func releaseOnClose(result interface{}, release func()) bool {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	body := v.Elem().FieldByName("Body")
+	if !body.IsValid() || !body.CanSet() || body.Type() != readCloserType || body.IsNil() {
+		return false
+	}
+	body.Set(reflect.ValueOf(io.ReadCloser(&releasingBody{ReadCloser: body.Interface().(io.ReadCloser), release: release})))
+	return true
+}
+
+// releasingBody calls release when closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
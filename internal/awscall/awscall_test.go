@@ -0,0 +1,185 @@
+package awscall
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	b := NewBreaker("test", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	call := func(o outcome) error {
+		if err := b.allow(); err != nil {
+			return err
+		}
+		b.record(o)
+		return nil
+	}
+
+	call(failed)
+	call(succeeded)
+	call(failed)
+	if b.State() != StateClosed {
+		t.Fatalf("State() = %q, want closed: failures must be consecutive", b.State())
+	}
+	call(failed)
+	if b.State() != StateOpen {
+		t.Fatalf("State() = %q, want open", b.State())
+	}
+	if err := call(succeeded); !errors.Is(err, ErrOpen) {
+		t.Fatalf("call on open breaker error = %v, want ErrOpen", err)
+	}
+
+	now = now.Add(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("State() = %q, want half-open after the cooldown", b.State())
+	}
+	// One trial at a time
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial call error = %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("second call during the trial error = %v, want ErrOpen", err)
+	}
+	b.record(failed)
+	if b.State() != StateOpen {
+		t.Fatalf("State() = %q, want open after a failed trial", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	call(ignored)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("State() = %q, want half-open after an ignored trial", b.State())
+	}
+	call(succeeded)
+	if b.State() != StateClosed {
+		t.Errorf("State() = %q, want closed after a successful trial", b.State())
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b := NewBreaker("test", 0, time.Minute)
+	if b != nil {
+		t.Fatal("NewBreaker() with no threshold should be nil")
+	}
+	b.record(failed)
+	if err := b.allow(); err != nil || b.State() != StateClosed {
+		t.Errorf("nil breaker: allow() = %v, State() = %q", err, b.State())
+	}
+}
+
+// newClient creates an S3 client for handler with policy applied
+func newClient(t *testing.T, policy Policy, handler http.HandlerFunc) *s3.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(srv.URL),
+		UsePathStyle:     true,
+		Credentials:      credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		APIOptions:       []func(*middleware.Stack) error{policy.APIOption},
+		RetryMaxAttempts: 1,
+	})
+}
+
+func head(client *s3.Client) error {
+	_, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: aws.String("b"), Key: aws.String("k")})
+	return err
+}
+
+func TestPolicy_Breaker(t *testing.T) {
+	var calls atomic.Int32
+	policy := Policy{Name: "s3", Breaker: NewBreaker("s3", 2, time.Hour)}
+	client := newClient(t, policy, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	head(client)
+	head(client)
+	if err := head(client); !errors.Is(err, ErrOpen) {
+		t.Fatalf("HeadObject() error = %v, want ErrOpen", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server called %d times, want the open breaker to fail fast", calls.Load())
+	}
+
+	// Presigning makes no call and ignores the breaker
+	presign := s3.NewPresignClient(client, func(o *s3.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, Skip)
+		})
+	})
+	if _, err := presign.PresignGetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("k")}); err != nil {
+		t.Errorf("PresignGetObject() error = %v", err)
+	}
+}
+
+func TestPolicy_ClientErrorsDoNotOpen(t *testing.T) {
+	policy := Policy{Name: "s3", Breaker: NewBreaker("s3", 1, time.Hour)}
+	client := newClient(t, policy, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	head(client)
+	head(client)
+	if policy.Breaker.State() != StateClosed {
+		t.Errorf("State() = %q, want not-found responses to keep the breaker closed", policy.Breaker.State())
+	}
+}
+
+func TestPolicy_Timeout(t *testing.T) {
+	policy := Policy{Name: "s3", Timeout: 20 * time.Millisecond, Breaker: NewBreaker("s3", 1, time.Hour)}
+	client := newClient(t, policy, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	start := time.Now()
+	err := head(client)
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("HeadObject() error = %v, want ErrTimeout", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("HeadObject() took %s, want it bounded by the timeout", time.Since(start))
+	}
+	if policy.Breaker.State() != StateOpen {
+		t.Errorf("State() = %q, want timeouts to count as failures", policy.Breaker.State())
+	}
+}
+
+func TestPolicy_StreamingBody(t *testing.T) {
+	policy := Policy{Name: "s3", Timeout: 20 * time.Millisecond}
+	client := newClient(t, policy, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(" second"))
+	})
+
+	out, err := client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("k")})
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	defer out.Body.Close()
+	b, err := io.ReadAll(out.Body)
+	if err != nil || string(b) != "first second" {
+		t.Errorf("body = %q, %v; want it readable past the timeout", b, err)
+	}
+}
@@ -0,0 +1,143 @@
+package awscall
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// ErrOpen is returned, wrapped, for calls rejected by an open breaker
+var ErrOpen = errors.New("circuit breaker open")
+
+// Breaker states
+const (
+	StateClosed   = "closed"
+	StateHalfOpen = "half-open"
+	StateOpen     = "open"
+)
+
+// stateValues are the values of metrics.BreakerState
+var stateValues = map[string]float64{StateClosed: 0, StateHalfOpen: 1, StateOpen: 2}
+
+// outcome is how a call counts towards the breaker
+type outcome int
+
+const (
+	succeeded outcome = iota
+	failed
+	// ignored calls, e.g. canceled by the caller, say nothing about AWS
+	ignored
+)
+
+// Breaker opens after threshold consecutive failed calls and rejects calls
+// for cooldown. Then it is half-open: one trial call goes through, closing
+// the breaker when it succeeds and reopening it when it fails. A nil Breaker
+// never opens.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// probing is set while the trial call of a half-open breaker runs
+	probing bool
+}
+
+// NewBreaker creates a closed breaker for the dependency name, or nil when
+// threshold is not positive
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	b := &Breaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now, state: StateClosed}
+	metrics.BreakerState.Set(stateValues[StateClosed], name)
+	return b
+}
+
+// Name returns the dependency the breaker guards
+func (b *Breaker) Name() string {
+	if b == nil {
+		return ""
+	}
+	return b.name
+}
+
+// State returns the breaker's state; an open breaker whose cooldown has
+// passed reports half-open. A nil Breaker is always closed.
+func (b *Breaker) State() string {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpen()
+	return b.state
+}
+
+// allow reports whether a call may go ahead, returning an ErrOpen error if not
+func (b *Breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpen()
+	switch {
+	case b.state == StateOpen, b.state == StateHalfOpen && b.probing:
+		metrics.BreakerRejections.Inc(b.name)
+		return fmt.Errorf("%s: %w", b.name, ErrOpen)
+	case b.state == StateHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// record counts the outcome of a call that allow let through
+func (b *Breaker) record(o outcome) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	trial := b.probing
+	b.probing = false
+
+	switch o {
+	case succeeded:
+		b.failures = 0
+		if b.state != StateClosed {
+			b.setState(StateClosed)
+		}
+	case failed:
+		b.failures++
+		if trial || (b.state == StateClosed && b.failures >= b.threshold) {
+			b.openedAt = b.now()
+			b.setState(StateOpen)
+		}
+	}
+}
+
+// halfOpen moves an open breaker whose cooldown has passed to half-open
+func (b *Breaker) halfOpen() {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.setState(StateHalfOpen)
+	}
+}
+
+func (b *Breaker) setState(state string) {
+	b.state = state
+	metrics.BreakerState.Set(stateValues[state], b.name)
+	event := logging.Info()
+	if state == StateOpen {
+		event = logging.Warn().Int("failures", b.failures).Dur("cooldown", b.cooldown)
+	}
+	event.Str("dependency", b.name).Str("state", state).Msg("circuit breaker state changed")
+}
@@ -0,0 +1,134 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// ErrExceeded is returned for large uploads of a project at or over its
+// storage budget
+var ErrExceeded = errors.New("storage budget exceeded")
+
+// Store keeps the bytes each project has stored
+type Store interface {
+	// Add adds delta, which is negative for deleted objects, to project's
+	// stored bytes and returns the new total
+	Add(ctx context.Context, project string, delta int64) (int64, error)
+	// Stored returns project's stored bytes, 0 when none were recorded
+	Stored(ctx context.Context, project string) (int64, error)
+}
+
+// Tracker maintains the stored bytes of each project as failures are completed
+// and purged, and checks new uploads against the projects' budgets
+type Tracker struct {
+	store Store
+}
+
+// NewTracker creates a tracker counting stored bytes in store
+func NewTracker(store Store) *Tracker {
+	return &Tracker{store: store}
+}
+
+// Stored returns the bytes project has stored. Totals are never negative,
+// though deletions of objects stored before tracking began may drive the
+// counter below zero.
+func (t *Tracker) Stored(ctx context.Context, project string) (int64, error) {
+	if t == nil {
+		return 0, nil
+	}
+	n, err := t.store.Stored(ctx, project)
+	return max(n, 0), err
+}
+
+// Check returns the bytes project has stored and ErrExceeded when they have
+// reached limit and the upload of bytes is larger than exempt. A nil tracker
+// or a limit of 0 allows every upload.
+func (t *Tracker) Check(ctx context.Context, project string, bytes, limit, exempt int64) (int64, error) {
+	if t == nil || limit <= 0 || bytes <= exempt {
+		return 0, nil
+	}
+	stored, err := t.Stored(ctx, project)
+	if err != nil {
+		return 0, fmt.Errorf("read stored bytes: %w", err)
+	}
+	if stored < limit {
+		return stored, nil
+	}
+	metrics.BudgetRejections.Inc(project)
+	logging.FromContext(ctx).Warn().
+		Int64("storedBytes", stored).
+		Int64("budgetBytes", limit).
+		Int64("bytes", bytes).
+		Msg("storage budget exceeded")
+	return stored, ErrExceeded
+}
+
+// Record counts bytes newly stored by project. Errors are logged: a missed
+// update only skews the total, which must not fail the upload.
+func (t *Tracker) Record(ctx context.Context, project string, bytes int64) {
+	t.add(ctx, project, bytes)
+}
+
+// Release uncounts bytes project no longer stores, logging errors like Record
+func (t *Tracker) Release(ctx context.Context, project string, bytes int64) {
+	t.add(ctx, project, -bytes)
+}
+
+func (t *Tracker) add(ctx context.Context, project string, delta int64) {
+	if t == nil || delta == 0 {
+		return
+	}
+	if _, err := t.store.Add(ctx, project, delta); err != nil {
+		logging.FromContext(ctx).Error().Err(err).
+			Str("project", project).
+			Int64("delta", delta).
+			Msg("failed to update stored bytes")
+	}
+}
+
+// MemoryStore keeps stored bytes in process. Totals start at zero on every
+// restart, so it suits development and single servers only.
+type MemoryStore struct {
+	mu     sync.Mutex
+	stored map[string]int64
+}
+
+// NewMemoryStore creates an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{stored: make(map[string]int64)}
+}
+
+// Add adds delta to project's stored bytes
+func (s *MemoryStore) Add(_ context.Context, project string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored[project] += delta
+	return s.stored[project], nil
+}
+
+// Stored returns project's stored bytes
+func (s *MemoryStore) Stored(_ context.Context, project string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stored[project], nil
+}
+
+// New builds a store for the configured backend ("memory" or "dynamodb")
+func New(ctx context.Context, backend, region, table string) (Store, error) {
+	switch backend {
+	case "dynamodb":
+		if table == "" {
+			return nil, fmt.Errorf("storage budget backend dynamodb requires a table name")
+		}
+		return NewDynamoStore(ctx, region, table)
+	case "memory", "":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage budget backend %q", backend)
+	}
+}
@@ -0,0 +1,53 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTracker_Check(t *testing.T) {
+	ctx := context.Background()
+	tr := NewTracker(NewMemoryStore())
+	tr.Record(ctx, "myapp", 900)
+
+	if stored, err := tr.Check(ctx, "myapp", 500, 1000, 64); err != nil || stored != 900 {
+		t.Fatalf("Check() = %d, %v; want uploads allowed under budget", stored, err)
+	}
+	tr.Record(ctx, "myapp", 100)
+	if _, err := tr.Check(ctx, "myapp", 500, 1000, 64); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("Check() error = %v, want ErrExceeded at the budget", err)
+	}
+	// Small uploads and other projects are still accepted
+	if _, err := tr.Check(ctx, "myapp", 64, 1000, 64); err != nil {
+		t.Errorf("Check(small upload) error = %v", err)
+	}
+	if _, err := tr.Check(ctx, "billing", 500, 1000, 64); err != nil {
+		t.Errorf("Check(billing) error = %v", err)
+	}
+
+	tr.Release(ctx, "myapp", 300)
+	if _, err := tr.Check(ctx, "myapp", 500, 1000, 64); err != nil {
+		t.Errorf("Check() after release error = %v, want the upload allowed", err)
+	}
+	if _, err := tr.Check(ctx, "myapp", 500, 0, 64); err != nil {
+		t.Errorf("Check(no budget) error = %v", err)
+	}
+}
+
+func TestTracker_Stored(t *testing.T) {
+	ctx := context.Background()
+	tr := NewTracker(NewMemoryStore())
+	tr.Record(ctx, "myapp", 100)
+	// Objects stored before tracking began are released too
+	tr.Release(ctx, "myapp", 250)
+	if n, err := tr.Stored(ctx, "myapp"); err != nil || n != 0 {
+		t.Errorf("Stored() = %d, %v; want totals floored at 0", n, err)
+	}
+
+	var nilTracker *Tracker
+	nilTracker.Record(ctx, "myapp", 100)
+	if _, err := nilTracker.Check(ctx, "myapp", 500, 1, 0); err != nil {
+		t.Errorf("nil tracker Check() error = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package budget
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoStore keeps stored bytes in DynamoDB with one atomic counter item per
+// project, so every Lambda instance and the lifecycle job share the totals.
+// The table needs a string partition key "pk". Counters have no expiry.
+type DynamoStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoStore creates a DynamoDB-backed storage budget store
+func NewDynamoStore(ctx context.Context, region, table string) (*DynamoStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return &DynamoStore{client: dynamodb.NewFromConfig(cfg), table: table}, nil
+}
+
+func key(project string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "storage#" + project},
+	}
+}
+
+// Add atomically adds delta to project's counter
+func (s *DynamoStore) Add(ctx context.Context, project string, delta int64) (int64, error) {
+	out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              key(project),
+		UpdateExpression: aws.String("ADD storedBytes :d SET updatedAt = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":d":   &types.AttributeValueMemberN{Value: strconv.FormatInt(delta, 10)},
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return storedBytes(out.Attributes), nil
+}
+
+// Stored reads project's counter with a strongly consistent read
+func (s *DynamoStore) Stored(ctx context.Context, project string) (int64, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            key(project),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return storedBytes(out.Item), nil
+}
+
+func storedBytes(item map[string]types.AttributeValue) int64 {
+	if v, ok := item["storedBytes"].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
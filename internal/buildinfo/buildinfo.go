@@ -0,0 +1,79 @@
+// Package buildinfo reports which build is running. Version, Commit and
+// BuildTime are set at link time (see the Makefile's LDFLAGS):
+//
+//	go build -ldflags "-X github.com/yourorg/failure-uploader/internal/buildinfo.Commit=$(git rev-parse HEAD)" ./cmd/server
+//
+// Builds without them fall back to the VCS stamp the go command records.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set with -ldflags "-X"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+	// Modified is set when the build had uncommitted changes, as far as the
+	// VCS stamp tells
+	Modified bool `json:"modified,omitempty"`
+}
+
+// Get returns the running build's info
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if info.Commit != "" {
+		return info
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// ShortCommit is the first 12 characters of the commit, or "unknown"
+func (i Info) ShortCommit() string {
+	if i.Commit == "" {
+		return "unknown"
+	}
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
+
+// String describes the build in one line, e.g. "v1.4.0 (3f2a9c1d0b7e, built 2024-03-15T10:30:00Z)"
+func (i Info) String() string {
+	parts := []string{i.ShortCommit()}
+	if i.Modified {
+		parts[0] += "-dirty"
+	}
+	if i.BuildTime != "" {
+		parts = append(parts, "built "+i.BuildTime)
+	}
+	return i.Version + " (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,34 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	defer func(v, c, b string) { Version, Commit, BuildTime = v, c, b }(Version, Commit, BuildTime)
+	Version, Commit, BuildTime = "v1.4.0", "3f2a9c1d0b7e44aa", "2024-03-15T10:30:00Z"
+
+	info := Get()
+	if info.Version != "v1.4.0" || info.Commit != "3f2a9c1d0b7e44aa" || info.BuildTime != "2024-03-15T10:30:00Z" || info.GoVersion != runtime.Version() {
+		t.Errorf("Get() = %+v", info)
+	}
+	if got, want := info.String(), "v1.4.0 (3f2a9c1d0b7e, built 2024-03-15T10:30:00Z)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestInfo_String(t *testing.T) {
+	tests := []struct {
+		info Info
+		want string
+	}{
+		{Info{Version: "dev"}, "dev (unknown)"},
+		{Info{Version: "dev", Commit: "abc123", Modified: true}, "dev (abc123-dirty)"},
+	}
+	for _, tt := range tests {
+		if got := tt.info.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
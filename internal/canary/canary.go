@@ -0,0 +1,98 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// Selector decides which requests are routed to experimental code paths
+type Selector struct {
+	percent map[string]int
+}
+
+// Parse builds a selector from a comma-separated list of project[:percent]
+// entries, e.g. "myapp:100,checkout:10". A missing percent means 100.
+func Parse(spec string) (*Selector, error) {
+	s := &Selector{percent: make(map[string]int)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		project, pct, hasPct := strings.Cut(item, ":")
+		percent := 100
+		if hasPct {
+			n, err := strconv.Atoi(pct)
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("canary %q: percent must be 0-100", item)
+			}
+			percent = n
+		}
+		s.percent[project] = percent
+	}
+	return s, nil
+}
+
+// Enabled reports whether unit (e.g. a failure ID) of project falls in the
+// canary slice. The decision is stable for a given unit.
+func (s *Selector) Enabled(project, unit string) bool {
+	if s == nil {
+		return false
+	}
+	pct, ok := s.percent[project]
+	if !ok || pct == 0 {
+		return false
+	}
+	if pct >= 100 {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(project + "/" + unit))
+	return int(h.Sum32()%100) < pct
+}
+
+// Run executes control, and for canary units also candidate, logging whether
+// their results match. Canary units are served the candidate result unless the
+// candidate fails, in which case they fall back to control.
+func Run[T any](ctx context.Context, s *Selector, name, project, unit string, control, candidate func(context.Context) (T, error), equal func(a, b T) bool) (T, error) {
+	if !s.Enabled(project, unit) {
+		return control(ctx)
+	}
+
+	start := time.Now()
+	want, controlErr := control(ctx)
+	controlDur := time.Since(start)
+
+	start = time.Now()
+	got, candidateErr := candidate(ctx)
+	candidateDur := time.Since(start)
+
+	log := logging.FromContext(logging.With(ctx, "project", project))
+	event := log.Info()
+	match := controlErr == nil && candidateErr == nil && equal(want, got)
+	if !match {
+		event = log.Warn()
+	}
+	event.
+		Str("experiment", name).
+		Str("unit", unit).
+		Bool("match", match).
+		Dur("controlDuration", controlDur).
+		Dur("candidateDuration", candidateDur).
+		AnErr("controlError", controlErr).
+		AnErr("candidateError", candidateErr).
+		Msg("canary comparison")
+
+	if candidateErr != nil {
+		return want, controlErr
+	}
+	return got, nil
+}
@@ -0,0 +1,74 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("myapp, checkout:10,off:0")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if s.percent["myapp"] != 100 || s.percent["checkout"] != 10 || s.percent["off"] != 0 {
+		t.Errorf("percent = %v", s.percent)
+	}
+
+	for _, bad := range []string{"myapp:abc", "myapp:101", "myapp:-1"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) expected error", bad)
+		}
+	}
+}
+
+func TestSelector_Enabled(t *testing.T) {
+	s, _ := Parse("all:100,none:0,some:30")
+
+	if !s.Enabled("all", "x") {
+		t.Error("100% project should always be enabled")
+	}
+	if s.Enabled("none", "x") || s.Enabled("unlisted", "x") {
+		t.Error("0% and unlisted projects should never be enabled")
+	}
+
+	var enabled int
+	for i := 0; i < 1000; i++ {
+		unit := fmt.Sprintf("unit-%d", i)
+		first := s.Enabled("some", unit)
+		if first != s.Enabled("some", unit) {
+			t.Fatalf("decision for %s is not stable", unit)
+		}
+		if first {
+			enabled++
+		}
+	}
+	if enabled < 200 || enabled > 400 {
+		t.Errorf("30%% canary enabled %d of 1000 units", enabled)
+	}
+
+	var nilSelector *Selector
+	if nilSelector.Enabled("all", "x") {
+		t.Error("nil selector should never be enabled")
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	s, _ := Parse("canary")
+	eq := func(a, b string) bool { return a == b }
+	control := func(context.Context) (string, error) { return "control", nil }
+	candidate := func(context.Context) (string, error) { return "candidate", nil }
+	failing := func(context.Context) (string, error) { return "", errors.New("boom") }
+
+	if got, _ := Run(ctx, s, "exp", "stable", "u", control, candidate, eq); got != "control" {
+		t.Errorf("non-canary project got %q, want control", got)
+	}
+	if got, _ := Run(ctx, s, "exp", "canary", "u", control, candidate, eq); got != "candidate" {
+		t.Errorf("canary project got %q, want candidate", got)
+	}
+	if got, err := Run(ctx, s, "exp", "canary", "u", control, failing, eq); got != "control" || err != nil {
+		t.Errorf("failing candidate got %q, %v; want control fallback", got, err)
+	}
+}
@@ -1,65 +1,641 @@
 package config
 
 import (
+	"errors"
 	"os"
-	"strconv"
+	"strings"
 	"time"
+
+	"github.com/yourorg/failure-uploader/internal/awscall"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/s3client"
 )
 
 type Config struct {
-	BucketName    string
-	AWSRegion     string
-	SESFrom       string
-	SESTo         string
-	PresignTTL    time.Duration
-	APIKey        string
-	Stage         string
-	MaxBodyBytes  int64
-	MaxFileBytes  int64
-	MaxTotalBytes int64
-	AuthEnabled   bool
+	BucketName       string
+	AWSRegion        string
+	SESFrom          string
+	SESTo            string
+	PresignTTL       time.Duration
+	APIKey           string
+	APIKeysJSON      string
+	AuthMode         string
+	JWKSURL          string
+	JWTIssuer        string
+	JWTAudience      string
+	JWTProjectClaim  string
+	JWTTenantClaim   string
+	JWTDefaultScopes string
+	Stage            string
+	MaxBodyBytes     int64
+	MaxFileBytes     int64
+	MaxTotalBytes    int64
+	MaxFiles         int
+	ProjectProfiles  string
+
+	// MaxLogsBytes, MaxScreenshotBytes and MaxConsoleBytes cap the logs.txt,
+	// screenshot.png and console.json artifact slots
+	MaxLogsBytes       int64
+	MaxScreenshotBytes int64
+	MaxConsoleBytes    int64
+
+	// MaxRequestBytes caps the JSON bodies of API requests; proxied artifact
+	// uploads are capped by the limits above instead
+	MaxRequestBytes int64
+	// GzipLevel compresses responses for clients accepting gzip, 1 (fastest)
+	// to 9 (smallest); 0 disables compression
+	GzipLevel int
+
+	AuthEnabled  bool
+	ProxyUploads bool
+	// LambdaResponseStreaming streams the responses of Function URL events,
+	// for functions whose Function URL uses the RESPONSE_STREAM invoke mode
+	LambdaResponseStreaming bool
+	// StrictSchema rejects requests and envelopes of a schema version newer
+	// than the service supports instead of reading what it can
+	StrictSchema bool
+
+	// LogLevel, LogFormat, LogInfoSampleN and LogDebugProjects configure
+	// logging; see logging.Options
+	LogLevel         string
+	LogFormat        string
+	LogInfoSampleN   int
+	LogDebugProjects string
+
+	// GRPCPort serves the ticket, complete and read APIs over gRPC next to
+	// HTTP; no gRPC server is started when it is empty
+	GRPCPort string
+
+	// MultiTenant stores each principal's failures under its tenant's prefix
+	// and rejects principals without a tenant
+	MultiTenant bool
+
+	// CORSAllowedOrigins lists the comma-separated origins browsers may call
+	// the API from, exact or with a wildcard subdomain ("https://*.example.com");
+	// "*" allows any origin and is only accepted in dev
+	CORSAllowedOrigins   string
+	CORSAllowedMethods   string
+	CORSAllowedHeaders   string
+	CORSMaxAge           time.Duration
+	CORSAllowCredentials bool
+
+	// IPACLs restricts the route groups (api, admin, dashboard) to JSON allow
+	// and deny lists of CIDRs; TrustedProxyDepth is the number of proxies in
+	// front of the service whose X-Forwarded-For entries are trusted
+	IPACLs            string
+	TrustedProxyDepth int
+
+	// SigningKeys holds the shared secrets of HMAC-signed requests; signatures
+	// with timestamps more than SignatureMaxSkew off are rejected
+	SigningKeys      string
+	SignatureMaxSkew time.Duration
+
+	// UploadSizeTolerancePercent is how far an upload may exceed the size its
+	// ticket declared before upload-complete rejects it
+	UploadSizeTolerancePercent int
+
+	// AllowedContentTypes and DeniedContentTypes are comma-separated media
+	// types ("image/*" matches a whole type) applied to every project
+	AllowedContentTypes string
+	DeniedContentTypes  string
+	// ContentMismatchAction is what upload-complete does with artifacts whose
+	// bytes contradict their declared type: "record" them in the envelope,
+	// "reject_executables" or "reject" every mismatch
+	ContentMismatchAction string
+
+	CanaryProjects string
+
+	EncryptedProjects string
+
+	RedactHeaders    string
+	RedactJSONFields string
+	RedactPatterns   string
+	HeaderPolicies   string
+
+	NotifyMode   string
+	DigestPeriod string
+	DedupWindow  time.Duration
+
+	PublicURL string
+	// LinkSecret signs the short and acknowledgment links of notifications,
+	// which are valid for LinkTTL; it is required when PublicURL is set
+	LinkSecret           string
+	LinkTTL              time.Duration
+	EscalationWindow     time.Duration
+	EscalationWebhookURL string
+
+	RetentionDays       int
+	RetentionPolicies   string
+	ArchiveAfterDays    int
+	ArchiveStorageClass string
+	ExpiryNoticeDays    int
+	RestoreDays         int
+
+	// ReplayAllowedHosts lists the hosts failures may be replayed against; only
+	// dry runs are possible when empty
+	ReplayAllowedHosts string
+	ReplayTimeout      time.Duration
+
+	// ObjectTagging tags uploads with their failure and stage; uploads declared
+	// at least LargeObjectMinBytes long go to LargeObjectStorageClass
+	ObjectTagging           bool
+	LargeObjectStorageClass string
+	LargeObjectMinBytes     int64
+
+	TicketMaxAge time.Duration
+	// UserIDHashKey keys the HMAC applied to client.userId; plain SHA-256 when empty
+	UserIDHashKey string
+
+	// StorageDestinations maps envs and project/envs to their own bucket and
+	// region, e.g. to keep prod data in the EU; see s3client.ParseDestinations
+	StorageDestinations string
+
+	// SSEKMSKeyARN encrypts failure objects with SSE-KMS; SSEKMSKeys overrides it per project
+	SSEKMSKeyARN string
+	SSEKMSKeys   string
+
+	// S3Endpoint targets an S3-compatible service such as MinIO or LocalStack
+	S3Endpoint        string
+	S3UsePathStyle    bool
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// S3Accelerate and S3DualStack make presigned URLs use the Transfer
+	// Acceleration and dual-stack (IPv6) endpoints
+	S3Accelerate bool
+	S3DualStack  bool
+
+	// S3Timeout and SESTimeout bound each call including its retries, which
+	// AWSMaxAttempts bounds. BreakerThreshold consecutive failures open a
+	// dependency's circuit breaker for BreakerCooldown; 0 disables breakers.
+	S3Timeout        time.Duration
+	SESTimeout       time.Duration
+	AWSMaxAttempts   int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// EmailProvider selects ses, smtp or sendgrid; SES_FROM/SES_TO apply to all
+	EmailProvider  string
+	SMTPAddr       string
+	SMTPUsername   string
+	SMTPPassword   string
+	SendGridAPIKey string
+	// EmailTemplateBucket holds per-project templates/{project}.html overrides
+	EmailTemplateBucket string
+
+	// SESConfigurationSet publishes bounces and complaints to SESEventsTopicARN
+	SESConfigurationSet string
+	SESEventsTopicARN   string
+
+	// NotifyRoutes maps project/env to email, Slack and webhook destinations;
+	// unrouted failures are emailed to SES_TO
+	NotifyRoutes        string
+	NotifyRoutesBackend string
+	NotifyRoutesTable   string
+	SlackBotToken       string
+
+	// GitHub issues for routed repositories, authenticated with GitHubToken
+	// or, when GitHubAppID is set, as the app's installation
+	GitHubAPIURL            string
+	GitHubToken             string
+	GitHubAppID             string
+	GitHubAppInstallationID string
+	GitHubAppPrivateKey     string
+
+	// PagerDuty pages critical failures and, when PagerDutyThreshold is set,
+	// groups occurring that many times within PagerDutyWindow
+	PagerDutyEventsURL string
+	PagerDutyThreshold int
+	PagerDutyWindow    time.Duration
+
+	// NotifyQueueURL moves notification delivery out of upload-complete: the
+	// API enqueues notifications to this SQS queue and cmd/notifier sends them
+	NotifyQueueURL string
+
+	// VerifyMode "sync" verifies uploads in upload-complete, checking missing
+	// keys up to VerifyAttempts times within VerifyRetryWindow; "async"
+	// accepts the completion as pending and verifies it from VerifyQueueURL
+	VerifyMode        string
+	VerifyAttempts    int
+	VerifyRetryWindow time.Duration
+	VerifyQueueURL    string
+
+	// AutoCompleteQueueURL is the SQS queue of S3 ObjectCreated events that
+	// cmd/autocomplete polls to complete tickets whose uploads have all
+	// arrived; tickets still missing some after AutoCompleteTimeout are
+	// completed with what arrived. Completions go through VerifyQueueURL.
+	AutoCompleteQueueURL string
+	AutoCompleteTimeout  time.Duration
+
+	// MalwareScan withholds download links of completed failures until a
+	// scanner has cleared every uploaded object. cmd/scanner applies the
+	// verdicts it receives from ScanQueueURL, quarantining infected objects.
+	MalwareScan  bool
+	ScanQueueURL string
+
+	// ThumbnailQueueURL is the SQS queue upload-complete sends image
+	// attachments to; cmd/thumbnailer stores thumbnails of at most
+	// ThumbnailSize pixels a side. No thumbnails are made when it is empty.
+	ThumbnailQueueURL string
+	ThumbnailSize     int
+
+	// EventBusName publishes failure lifecycle events to EventBridge with
+	// source EventSource; no events are published when it is empty
+	EventBusName string
+	EventSource  string
+
+	// Dashboard serves the embedded web dashboard at /ui
+	Dashboard bool
+
+	// SentryDSN forwards each completed failure to Sentry as a condensed event
+	SentryDSN string
+
+	// MetadataIndex writes a flattened row per completed failure under index/
+	// for Athena. With GlueDatabase set, tables named GlueTable and their
+	// partitions are registered in the Glue Data Catalog as rows are written.
+	MetadataIndex bool
+	GlueDatabase  string
+	GlueTable     string
+
+	RateLimitBackend  string
+	RateLimitTable    string
+	RateLimitIPRate   float64
+	RateLimitIPBurst  int
+	RateLimitKeyRate  float64
+	RateLimitKeyBurst int
+
+	UsageBackend string
+	UsageTable   string
+
+	// QuotaDailyFailures and QuotaDailyBytes cap each project's tickets and
+	// declared upload bytes per UTC day (0 is unlimited; profiles override
+	// them). Projects are alerted once at QuotaAlertPercent of a quota.
+	QuotaDailyFailures int64
+	QuotaDailyBytes    int64
+	QuotaAlertPercent  int
+	QuotaBackend       string
+	QuotaTable         string
+
+	// StorageBudgetBytes caps the bytes each project keeps stored (0 is
+	// unlimited; profiles override it). Over budget, tickets declaring more
+	// than StorageBudgetExemptBytes are refused.
+	StorageBudgetBytes       int64
+	StorageBudgetExemptBytes int64
+	StorageBudgetBackend     string
+	StorageBudgetTable       string
+
+	// AdminAPIKeys authenticates the /admin API, which is not mounted without
+	// them; API keys managed through it are re-read every APIKeySyncInterval
+	AdminAPIKeys       string
+	APIKeySyncInterval time.Duration
+
+	// AuditSink writes audit records to "s3" (under audit/events/ in the
+	// bucket) or "log"; empty disables auditing. Buffered records are written
+	// every AuditFlushInterval.
+	AuditSink          string
+	AuditFlushInterval time.Duration
+
+	// HealthCheckSES adds the SES account and sender identity to the
+	// readiness checks; each check is abandoned after HealthCheckTimeout
+	HealthCheckSES     bool
+	HealthCheckTimeout time.Duration
+
+	// Secrets resolved the settings given as secret references (see
+	// secrets.go); nil when there were none. The API key registries re-read
+	// theirs every SecretsRefreshInterval (0 disables).
+	Secrets                *Secrets
+	SecretsRefreshInterval time.Duration
+
+	// ConfigReloadInterval is how often per-project limits, notification
+	// routes and API keys are reloaded (0 disables); cmd/server also reloads
+	// them on SIGHUP
+	ConfigReloadInterval time.Duration
+
+	// Port is the HTTP port of cmd/server
+	Port string
 }
 
-func Load() *Config {
-	presignTTL := getEnvInt("PRESIGN_TTL_SECONDS", 900)
-	apiKey := os.Getenv("API_KEY")
-
-	return &Config{
-		BucketName:    getEnv("BUCKET_NAME", "failure-uploads"),
-		AWSRegion:     getEnv("AWS_REGION", "us-east-1"),
-		SESFrom:       getEnv("SES_FROM", "noreply@example.com"),
-		SESTo:         getEnv("SES_TO", "owner@example.com"),
-		PresignTTL:    time.Duration(presignTTL) * time.Second,
-		APIKey:        apiKey,
-		Stage:         getEnv("STAGE", "dev"),
-		MaxBodyBytes:  getEnvInt64("MAX_BODY_BYTES", 10*1024*1024),   // 10MB default
-		MaxFileBytes:  getEnvInt64("MAX_FILE_BYTES", 50*1024*1024),   // 50MB default
-		MaxTotalBytes: getEnvInt64("MAX_TOTAL_BYTES", 100*1024*1024), // 100MB default
-		AuthEnabled:   apiKey != "" && getEnv("STAGE", "dev") != "dev",
+// Load reads the configuration from the environment and, when CONFIG_FILE
+// names one, from a YAML file (see file.go) whose values the environment
+// overrides. Settings may reference secrets in Secrets Manager or SSM
+// Parameter Store, which are fetched here. Every malformed, out of range or
+// missing required value is reported. The Config is always returned, so that
+// logging can be set up to report the error, but must not be used otherwise
+// when the error is non-nil.
+func Load() (*Config, error) {
+	src := newSource(os.Getenv("CONFIG_FILE"))
+
+	presignTTL := src.int("PRESIGN_TTL_SECONDS", 900)
+	apiKey := src.str("API_KEY", "")
+	apiKeysJSON := src.str("API_KEYS", "")
+	authMode := src.str("AUTH_MODE", "apikey")
+	jwksURL := src.str("JWKS_URL", "")
+	stage := src.str("STAGE", "dev")
+	// Admin keys can create API keys at runtime, so they enable key auth too
+	adminAPIKeys := src.str("ADMIN_API_KEYS", "")
+	signingKeys := src.str("SIGNING_KEYS", "")
+
+	cfg := &Config{
+		BucketName:       src.str("BUCKET_NAME", "failure-uploads"),
+		AWSRegion:        src.str("AWS_REGION", "us-east-1"),
+		SESFrom:          src.str("SES_FROM", "noreply@example.com"),
+		SESTo:            src.str("SES_TO", "owner@example.com"),
+		PresignTTL:       time.Duration(presignTTL) * time.Second,
+		APIKey:           apiKey,
+		APIKeysJSON:      apiKeysJSON,
+		AuthMode:         authMode,
+		JWKSURL:          jwksURL,
+		JWTIssuer:        src.str("JWT_ISSUER", ""),
+		JWTAudience:      src.str("JWT_AUDIENCE", ""),
+		JWTProjectClaim:  src.str("JWT_PROJECT_CLAIM", "project"),
+		JWTTenantClaim:   src.str("JWT_TENANT_CLAIM", "tenant"),
+		JWTDefaultScopes: src.str("JWT_DEFAULT_SCOPES", "ticket:create"),
+		Stage:            stage,
+		MaxBodyBytes:     src.int64("MAX_BODY_BYTES", 10*1024*1024),   // 10MB default
+		MaxFileBytes:     src.int64("MAX_FILE_BYTES", 50*1024*1024),   // 50MB default
+		MaxTotalBytes:    src.int64("MAX_TOTAL_BYTES", 100*1024*1024), // 100MB default
+		MaxFiles:         src.int("MAX_FILES", 20),
+		ProjectProfiles:  src.str("PROJECT_PROFILES", ""),
+
+		MaxLogsBytes:       src.int64("MAX_LOGS_BYTES", 1024*1024),         // 1MB default
+		MaxScreenshotBytes: src.int64("MAX_SCREENSHOT_BYTES", 5*1024*1024), // 5MB default
+		MaxConsoleBytes:    src.int64("MAX_CONSOLE_BYTES", 1024*1024),      // 1MB default
+		MaxRequestBytes:    src.int64("MAX_REQUEST_BYTES", 1024*1024),      // 1MB default
+		GzipLevel:          src.int("GZIP_LEVEL", 5),
+
+		AuthEnabled: stage != "dev" && authConfigured(authMode, apiKey != "" || apiKeysJSON != "" || adminAPIKeys != "", jwksURL != "", signingKeys != ""),
+
+		ProxyUploads: src.bool("PROXY_UPLOADS"),
+		StrictSchema: src.bool("STRICT_SCHEMA_VERSION"),
+
+		LambdaResponseStreaming: src.bool("LAMBDA_RESPONSE_STREAMING"),
+
+		LogLevel:         src.str("LOG_LEVEL", ""),
+		LogFormat:        src.str("LOG_FORMAT", ""),
+		LogInfoSampleN:   src.int("LOG_INFO_SAMPLE_N", 0),
+		LogDebugProjects: src.str("LOG_DEBUG_PROJECTS", ""),
+
+		GRPCPort: src.str("GRPC_PORT", ""),
+
+		MultiTenant: src.bool("MULTI_TENANT"),
+
+		CORSAllowedOrigins:   src.str("CORS_ALLOWED_ORIGINS", defaultCORSOrigins(stage)),
+		CORSAllowedMethods:   src.str("CORS_ALLOWED_METHODS", "GET, POST, PUT, DELETE, OPTIONS"),
+		CORSAllowedHeaders:   src.str("CORS_ALLOWED_HEADERS", "Content-Type, Content-Encoding, X-Api-Key, Authorization, Idempotency-Key, X-Failure-Priority, X-Key-Id, X-Timestamp, X-Signature"),
+		CORSMaxAge:           time.Duration(src.int("CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+		CORSAllowCredentials: src.bool("CORS_ALLOW_CREDENTIALS"),
+
+		IPACLs:            src.str("IP_ACLS", ""),
+		TrustedProxyDepth: src.int("TRUSTED_PROXY_DEPTH", 0),
+
+		SigningKeys:      signingKeys,
+		SignatureMaxSkew: time.Duration(src.int("SIGNATURE_MAX_SKEW_SECONDS", 300)) * time.Second,
+
+		UploadSizeTolerancePercent: src.int("UPLOAD_SIZE_TOLERANCE_PERCENT", 10),
+
+		AllowedContentTypes: src.str("ALLOWED_CONTENT_TYPES", ""),
+		DeniedContentTypes:  src.str("DENIED_CONTENT_TYPES", DefaultDeniedContentTypes),
+
+		ContentMismatchAction: src.str("CONTENT_MISMATCH_ACTION", "record"),
+
+		CanaryProjects: src.str("CANARY_PROJECTS", ""),
+
+		EncryptedProjects: src.str("ENCRYPTED_PROJECTS", ""),
+
+		RedactHeaders:    src.str("REDACT_HEADERS", ""),
+		RedactJSONFields: src.str("REDACT_JSON_FIELDS", ""),
+		RedactPatterns:   src.str("REDACT_PATTERNS", ""),
+		HeaderPolicies:   src.str("HEADER_POLICIES", ""),
+
+		NotifyMode:   src.str("NOTIFY_MODE", "immediate"),
+		DigestPeriod: src.str("DIGEST_PERIOD", "daily"),
+		DedupWindow:  time.Duration(src.int("NOTIFY_DEDUP_WINDOW_SECONDS", 0)) * time.Second,
+
+		PublicURL:            src.str("PUBLIC_URL", ""),
+		LinkSecret:           src.str("LINK_SECRET", ""),
+		LinkTTL:              time.Duration(src.int("LINK_TTL_DAYS", 30)) * 24 * time.Hour,
+		EscalationWindow:     time.Duration(src.int("ESCALATION_WINDOW_MINUTES", 60)) * time.Minute,
+		EscalationWebhookURL: src.str("ESCALATION_WEBHOOK_URL", ""),
+
+		RetentionDays:       src.int("RETENTION_DAYS", 0),
+		RetentionPolicies:   src.str("RETENTION_POLICIES", ""),
+		ArchiveAfterDays:    src.int("ARCHIVE_AFTER_DAYS", 0),
+		ArchiveStorageClass: src.str("ARCHIVE_STORAGE_CLASS", "GLACIER"),
+		ExpiryNoticeDays:    src.int("EXPIRY_NOTICE_DAYS", 7),
+		RestoreDays:         src.int("RESTORE_DAYS", 7),
+
+		ReplayAllowedHosts: src.str("REPLAY_ALLOWED_HOSTS", ""),
+		ReplayTimeout:      time.Duration(src.int("REPLAY_TIMEOUT_SECONDS", 30)) * time.Second,
+
+		ObjectTagging:           src.bool("OBJECT_TAGGING"),
+		LargeObjectStorageClass: src.str("LARGE_OBJECT_STORAGE_CLASS", ""),
+		LargeObjectMinBytes:     src.int64("LARGE_OBJECT_MIN_BYTES", 128<<10),
+
+		TicketMaxAge:  time.Duration(src.int("TICKET_MAX_AGE_HOURS", 24)) * time.Hour,
+		UserIDHashKey: src.str("USER_ID_HASH_KEY", ""),
+
+		SSEKMSKeyARN: src.str("SSE_KMS_KEY_ARN", ""),
+		SSEKMSKeys:   src.str("SSE_KMS_KEYS", ""),
+
+		StorageDestinations: src.str("STORAGE_DESTINATIONS", ""),
+
+		S3Endpoint:        src.str("S3_ENDPOINT", ""),
+		S3UsePathStyle:    src.bool("S3_USE_PATH_STYLE"),
+		S3AccessKeyID:     src.str("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: src.str("S3_SECRET_ACCESS_KEY", ""),
+		S3Accelerate:      src.bool("S3_ACCELERATE"),
+		S3DualStack:       src.bool("S3_DUALSTACK"),
+
+		S3Timeout:        time.Duration(src.int("S3_TIMEOUT_SECONDS", 10)) * time.Second,
+		SESTimeout:       time.Duration(src.int("SES_TIMEOUT_SECONDS", 10)) * time.Second,
+		AWSMaxAttempts:   src.int("AWS_MAX_ATTEMPTS", awscall.DefaultMaxAttempts),
+		BreakerThreshold: src.int("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerCooldown:  time.Duration(src.int("BREAKER_COOLDOWN_SECONDS", 30)) * time.Second,
+
+		EmailProvider:  src.str("EMAIL_PROVIDER", "ses"),
+		SMTPAddr:       src.str("SMTP_ADDR", ""),
+		SMTPUsername:   src.str("SMTP_USERNAME", ""),
+		SMTPPassword:   src.str("SMTP_PASSWORD", ""),
+		SendGridAPIKey: src.str("SENDGRID_API_KEY", ""),
+
+		EmailTemplateBucket: src.str("EMAIL_TEMPLATE_BUCKET", ""),
+
+		SESConfigurationSet: src.str("SES_CONFIGURATION_SET", ""),
+		SESEventsTopicARN:   src.str("SES_EVENTS_TOPIC_ARN", ""),
+
+		NotifyRoutes:        src.str("NOTIFY_ROUTES", ""),
+		NotifyRoutesBackend: src.str("NOTIFY_ROUTES_BACKEND", "config"),
+		NotifyRoutesTable:   src.str("NOTIFY_ROUTES_TABLE", ""),
+		SlackBotToken:       src.str("SLACK_BOT_TOKEN", ""),
+
+		GitHubAPIURL:            src.str("GITHUB_API_URL", "https://api.github.com"),
+		GitHubToken:             src.str("GITHUB_TOKEN", ""),
+		GitHubAppID:             src.str("GITHUB_APP_ID", ""),
+		GitHubAppInstallationID: src.str("GITHUB_APP_INSTALLATION_ID", ""),
+		GitHubAppPrivateKey:     src.str("GITHUB_APP_PRIVATE_KEY", ""),
+
+		PagerDutyEventsURL: src.str("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue"),
+		PagerDutyThreshold: src.int("PAGERDUTY_OCCURRENCE_THRESHOLD", 0),
+		PagerDutyWindow:    time.Duration(src.int("PAGERDUTY_WINDOW_SECONDS", 3600)) * time.Second,
+
+		NotifyQueueURL: src.str("NOTIFY_QUEUE_URL", ""),
+
+		VerifyMode:        src.str("VERIFY_MODE", "sync"),
+		VerifyAttempts:    src.int("VERIFY_ATTEMPTS", 3),
+		VerifyRetryWindow: time.Duration(src.int("VERIFY_RETRY_WINDOW_MS", 2000)) * time.Millisecond,
+		VerifyQueueURL:    src.str("VERIFY_QUEUE_URL", ""),
+
+		AutoCompleteQueueURL: src.str("AUTO_COMPLETE_QUEUE_URL", ""),
+		AutoCompleteTimeout:  time.Duration(src.int("AUTO_COMPLETE_TIMEOUT_SECONDS", 900)) * time.Second,
+
+		MalwareScan:  src.bool("MALWARE_SCAN"),
+		ScanQueueURL: src.str("SCAN_QUEUE_URL", ""),
+
+		ThumbnailQueueURL: src.str("THUMBNAIL_QUEUE_URL", ""),
+		ThumbnailSize:     src.int("THUMBNAIL_SIZE", 320),
+
+		EventBusName: src.str("EVENT_BUS_NAME", ""),
+		EventSource:  src.str("EVENT_SOURCE", "failure-uploader"),
+
+		Dashboard: src.bool("DASHBOARD_ENABLED"),
+
+		SentryDSN: src.str("SENTRY_DSN", ""),
+
+		MetadataIndex: src.bool("METADATA_INDEX"),
+		GlueDatabase:  src.str("GLUE_DATABASE", ""),
+		GlueTable:     src.str("GLUE_TABLE", "failures"),
+
+		RateLimitBackend:  src.str("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitTable:    src.str("RATE_LIMIT_TABLE", ""),
+		RateLimitIPRate:   src.float("RATE_LIMIT_IP_RPS", 0),
+		RateLimitIPBurst:  src.int("RATE_LIMIT_IP_BURST", 20),
+		RateLimitKeyRate:  src.float("RATE_LIMIT_KEY_RPS", 0),
+		RateLimitKeyBurst: src.int("RATE_LIMIT_KEY_BURST", 50),
+
+		UsageBackend: src.str("USAGE_BACKEND", "memory"),
+		UsageTable:   src.str("USAGE_TABLE", src.str("RATE_LIMIT_TABLE", "")),
+
+		QuotaDailyFailures: src.int64("QUOTA_DAILY_FAILURES", 0),
+		QuotaDailyBytes:    src.int64("QUOTA_DAILY_BYTES", 0),
+		QuotaAlertPercent:  src.int("QUOTA_ALERT_PERCENT", 80),
+		QuotaBackend:       src.str("QUOTA_BACKEND", "memory"),
+		QuotaTable:         src.str("QUOTA_TABLE", src.str("RATE_LIMIT_TABLE", "")),
+
+		StorageBudgetBytes:       src.int64("STORAGE_BUDGET_BYTES", 0),
+		StorageBudgetExemptBytes: src.int64("STORAGE_BUDGET_EXEMPT_BYTES", 64<<10),
+		StorageBudgetBackend:     src.str("STORAGE_BUDGET_BACKEND", "memory"),
+		StorageBudgetTable:       src.str("STORAGE_BUDGET_TABLE", src.str("RATE_LIMIT_TABLE", "")),
+
+		AdminAPIKeys:       adminAPIKeys,
+		APIKeySyncInterval: time.Duration(src.int("API_KEY_SYNC_SECONDS", 60)) * time.Second,
+
+		AuditSink:          src.str("AUDIT_SINK", ""),
+		AuditFlushInterval: time.Duration(src.int("AUDIT_FLUSH_SECONDS", 60)) * time.Second,
+
+		HealthCheckSES:     src.bool("HEALTH_CHECK_SES"),
+		HealthCheckTimeout: time.Duration(src.int("HEALTH_CHECK_TIMEOUT_SECONDS", 2)) * time.Second,
+
+		SecretsRefreshInterval: time.Duration(src.int("SECRETS_REFRESH_SECONDS", 0)) * time.Second,
+		ConfigReloadInterval:   time.Duration(src.int("CONFIG_RELOAD_SECONDS", 0)) * time.Second,
+
+		Port: src.str("PORT", "8080"),
 	}
+	cfg.Secrets = src.secrets
+
+	errs := append(src.errs, cfg.validate(src)...)
+	errs = append(errs, src.unused()...)
+	return cfg, errors.Join(errs...)
 }
 
-func getEnv(key, defaultVal string) string {
-	if val := os.Getenv(key); val != "" {
-		return val
+// defaultCORSOrigins allows any origin in dev; deployed stages allow none
+// until CORS_ALLOWED_ORIGINS lists them
+func defaultCORSOrigins(stage string) string {
+	if stage == "dev" {
+		return "*"
 	}
-	return defaultVal
+	return ""
 }
 
-func getEnvInt(key string, defaultVal int) int {
-	if val := os.Getenv(key); val != "" {
-		if i, err := strconv.Atoi(val); err == nil {
-			return i
+// LogOptions returns the logging configuration
+func (c *Config) LogOptions() logging.Options {
+	opts := logging.Options{
+		Stage:       c.Stage,
+		Level:       c.LogLevel,
+		Format:      c.LogFormat,
+		InfoSampleN: c.LogInfoSampleN,
+	}
+	for _, p := range strings.Split(c.LogDebugProjects, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			opts.DebugProjects = append(opts.DebugProjects, p)
 		}
 	}
-	return defaultVal
+	return opts
+}
+
+// AWSPolicy returns the call policy of the dependency name, e.g. s3, with
+// its own circuit breaker. Call it once per dependency and share the policy
+// between that dependency's clients.
+func (c *Config) AWSPolicy(name string, timeout time.Duration) awscall.Policy {
+	return awscall.Policy{
+		Name:        name,
+		Timeout:     timeout,
+		MaxAttempts: c.AWSMaxAttempts,
+		Breaker:     awscall.NewBreaker(name, c.BreakerThreshold, c.BreakerCooldown),
+	}
 }
 
-func getEnvInt64(key string, defaultVal int64) int64 {
-	if val := os.Getenv(key); val != "" {
-		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
-			return i
+// StoreOptions returns the options of the failure store (see s3client.New)
+// with the s3 call policy. Call it once per binary and reuse its Endpoint for
+// other buckets, so they share the circuit breaker.
+func (c *Config) StoreOptions() s3client.Options {
+	return s3client.Options{
+		Bucket: c.BucketName,
+		Region: c.AWSRegion,
+		TTL:    c.PresignTTL,
+		Endpoint: s3client.Endpoint{
+			URL:             c.S3Endpoint,
+			UsePathStyle:    c.S3UsePathStyle,
+			AccessKeyID:     c.S3AccessKeyID,
+			SecretAccessKey: c.S3SecretAccessKey,
+			Accelerate:      c.S3Accelerate,
+			DualStack:       c.S3DualStack,
+			Policy:          c.AWSPolicy("s3", c.S3Timeout),
+		},
+		Destinations:  c.StorageDestinations,
+		KMSKeys:       c.SSEKMSKeys,
+		DefaultKMSKey: c.SSEKMSKeyARN,
+	}
+}
+
+// RequiresEncryption reports whether project is listed in ENCRYPTED_PROJECTS, so
+// its artifacts must be encrypted client-side
+func (c *Config) RequiresEncryption(project string) bool {
+	for _, p := range strings.Split(c.EncryptedProjects, ",") {
+		if strings.TrimSpace(p) == project {
+			return true
 		}
 	}
-	return defaultVal
+	return false
 }
+
+// authConfigured reports whether the selected auth mode has credentials to check against
+func authConfigured(mode string, keysConfigured, jwtConfigured, signingConfigured bool) bool {
+	switch mode {
+	case "authorizer":
+		// API Gateway validates the credentials before the request arrives
+		return true
+	case "hmac":
+		return signingConfigured
+	case "jwt":
+		return jwtConfigured || signingConfigured
+	case "any":
+		return keysConfigured || jwtConfigured || signingConfigured
+	default:
+		return keysConfigured || signingConfigured
+	}
+}
+
+// DefaultDeniedContentTypes rejects executables and scripts unless
+// DENIED_CONTENT_TYPES overrides it
+const DefaultDeniedContentTypes = "application/x-msdownload,application/x-dosexec,application/vnd.microsoft.portable-executable," +
+	"application/x-executable,application/x-elf,application/x-mach-binary,application/x-sharedlib," +
+	"application/x-msi,application/x-sh,text/x-shellscript,application/x-bat"
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Stage != "dev" || cfg.BucketName != "failure-uploads" || cfg.PresignTTL != 15*time.Minute || cfg.Port != "8080" {
+		t.Errorf("Load() = %+v", cfg)
+	}
+}
+
+func TestLoad_File(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, `
+stage: prod
+storage:
+  bucket: from-file
+  presignTTL: 5m
+  usePathStyle: true
+limits:
+  maxFiles: 3
+  allowedContentTypes: [application/json, image/*]
+projects:
+  myapp: {maxFiles: 2, platforms: [ios]}
+notifications:
+  to: oncall@example.com
+  routes:
+    default: {slackChannels: ["#failures"]}
+settings:
+  RATE_LIMIT_IP_RPS: 2.5
+  API_KEYS: [{id: ios, key: secret}]
+`))
+	t.Setenv("BUCKET_NAME", "from-env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BucketName != "from-env" {
+		t.Errorf("BucketName = %q, want the environment to override the file", cfg.BucketName)
+	}
+	if cfg.Stage != "prod" || cfg.PresignTTL != 5*time.Minute || !cfg.S3UsePathStyle || cfg.MaxFiles != 3 {
+		t.Errorf("Load() = %+v", cfg)
+	}
+	if cfg.AllowedContentTypes != "application/json,image/*" || cfg.SESTo != "oncall@example.com" || cfg.RateLimitIPRate != 2.5 {
+		t.Errorf("Load() = %+v", cfg)
+	}
+	if cfg.ProjectProfiles != `{"myapp":{"maxFiles":2,"platforms":["ios"]}}` {
+		t.Errorf("ProjectProfiles = %s", cfg.ProjectProfiles)
+	}
+	if cfg.NotifyRoutes != `{"default":{"slackChannels":["#failures"]}}` {
+		t.Errorf("NotifyRoutes = %s", cfg.NotifyRoutes)
+	}
+	if cfg.APIKeysJSON != `[{"id":"ios","key":"secret"}]` || !cfg.AuthEnabled {
+		t.Errorf("APIKeysJSON = %s, AuthEnabled = %v", cfg.APIKeysJSON, cfg.AuthEnabled)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+		want []string
+	}{
+		{
+			name: "malformed values",
+			env:  map[string]string{"MAX_BODY_BYTES": "10MB", "OBJECT_TAGGING": "yes", "RATE_LIMIT_IP_RPS": "fast"},
+			want: []string{`MAX_BODY_BYTES: "10MB" is not an integer`, `OBJECT_TAGGING: "yes" is not true or false`, "RATE_LIMIT_IP_RPS"},
+		},
+		{
+			name: "out of range",
+			env:  map[string]string{"PRESIGN_TTL_SECONDS": "-1", "MAX_FILES": "-2", "RETENTION_DAYS": "-30"},
+			want: []string{"PRESIGN_TTL_SECONDS: must be between", "MAX_FILES: must not be negative", "RETENTION_DAYS"},
+		},
+		{
+			name: "artifact slot limits",
+			env:  map[string]string{"MAX_LOGS_BYTES": "0", "MAX_SCREENSHOT_BYTES": "-1"},
+			want: []string{"MAX_LOGS_BYTES: must be positive", "MAX_SCREENSHOT_BYTES: must be positive"},
+		},
+		{
+			name: "unknown choices",
+			env:  map[string]string{"AUTH_MODE": "basic", "NOTIFY_MODE": "weekly", "EMAIL_PROVIDER": "pigeon", "CONTENT_MISMATCH_ACTION": "quarantine"},
+			want: []string{"AUTH_MODE", "NOTIFY_MODE", "EMAIL_PROVIDER", "CONTENT_MISMATCH_ACTION"},
+		},
+		{
+			name: "bucket required outside dev",
+			env:  map[string]string{"STAGE": "prod"},
+			want: []string{"BUCKET_NAME: required"},
+		},
+		{
+			name: "auth mode without credentials",
+			env:  map[string]string{"STAGE": "prod", "BUCKET_NAME": "b", "AUTH_MODE": "jwt"},
+			want: []string{"AUTH_MODE: jwt has no credentials"},
+		},
+		{
+			name: "cors",
+			env:  map[string]string{"STAGE": "prod", "BUCKET_NAME": "b", "CORS_ALLOWED_ORIGINS": "*, https://app.example.com, app.example.com, https://*.example.com/path"},
+			want: []string{"CORS_ALLOWED_ORIGINS: * is only allowed", `"app.example.com" is not an origin`, `"https://*.example.com/path" is not an origin`},
+		},
+		{
+			name: "quotas",
+			env:  map[string]string{"QUOTA_DAILY_FAILURES": "-1", "QUOTA_ALERT_PERCENT": "120"},
+			want: []string{"QUOTA_DAILY_FAILURES: must not be negative", "QUOTA_ALERT_PERCENT: must be between 0 and 100"},
+		},
+		{
+			name: "storage budget",
+			env:  map[string]string{"STORAGE_BUDGET_BYTES": "-1", "STORAGE_BUDGET_EXEMPT_BYTES": "-1"},
+			want: []string{"STORAGE_BUDGET_BYTES: must not be negative", "STORAGE_BUDGET_EXEMPT_BYTES: must not be negative"},
+		},
+		{
+			name: "thumbnails",
+			env:  map[string]string{"THUMBNAIL_SIZE": "8"},
+			want: []string{"THUMBNAIL_SIZE: must be between 32 and 1024, got 8"},
+		},
+		{
+			name: "call policy",
+			env:  map[string]string{"AWS_MAX_ATTEMPTS": "0", "S3_TIMEOUT_SECONDS": "-1", "BREAKER_COOLDOWN_SECONDS": "0"},
+			want: []string{"AWS_MAX_ATTEMPTS: must be positive", "S3_TIMEOUT_SECONDS: must not be negative", "BREAKER_COOLDOWN_SECONDS: must be positive"},
+		},
+		{
+			name: "verification",
+			env:  map[string]string{"VERIFY_MODE": "async", "VERIFY_ATTEMPTS": "0", "AUTO_COMPLETE_TIMEOUT_SECONDS": "0"},
+			want: []string{"VERIFY_ATTEMPTS: must be between 1 and 10", "VERIFY_QUEUE_URL: required when VERIFY_MODE is async", "AUTO_COMPLETE_TIMEOUT_SECONDS: must be positive"},
+		},
+		{
+			name: "links",
+			env:  map[string]string{"PUBLIC_URL": "https://api.example.com", "LINK_SECRET": "short", "LINK_TTL_DAYS": "0"},
+			want: []string{"LINK_SECRET: must be at least 16 characters when PUBLIC_URL is set", "LINK_TTL_DAYS: must be positive"},
+		},
+		{
+			name: "endpoint options with a custom endpoint",
+			env:  map[string]string{"S3_ENDPOINT": "http://localhost:9000", "S3_USE_PATH_STYLE": "true", "S3_ACCELERATE": "true", "S3_DUALSTACK": "true"},
+			want: []string{"S3_ACCELERATE: cannot be combined with S3_ENDPOINT", "S3_DUALSTACK: cannot be combined with S3_ENDPOINT", "S3_ACCELERATE: cannot be combined with S3_USE_PATH_STYLE"},
+		},
+		{
+			name: "access key without its secret",
+			env:  map[string]string{"S3_ACCESS_KEY_ID": "minioadmin"},
+			want: []string{"S3_SECRET_ACCESS_KEY: required when S3_ACCESS_KEY_ID is set"},
+		},
+		{
+			name: "secret without its access key",
+			env:  map[string]string{"S3_SECRET_ACCESS_KEY": "minioadmin"},
+			want: []string{"S3_ACCESS_KEY_ID: required when S3_SECRET_ACCESS_KEY is set"},
+		},
+		{
+			name: "unknown file keys",
+			file: "storage:\n  bucket: b\n  bukket: c\n",
+			want: []string{"field bukket not found"},
+		},
+		{
+			name: "unknown setting",
+			file: "settings:\n  RETENTON_DAYS: 3\n",
+			want: []string{"RETENTON_DAYS: unknown setting in config file"},
+		},
+		{
+			name: "set twice in the file",
+			file: "storage:\n  bucket: a\nsettings:\n  BUCKET_NAME: b\n",
+			want: []string{"storage.bucket and settings.BUCKET_NAME"},
+		},
+		{
+			name: "missing file",
+			env:  map[string]string{"CONFIG_FILE": "/nonexistent/config.yaml"},
+			want: []string{"read config file"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, tt.file))
+			}
+			cfg, err := Load()
+			if cfg == nil {
+				t.Fatal("Load() returned no config")
+			}
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("Load() error = %v, want it to mention %q", err, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of the YAML file named by CONFIG_FILE. Its
+// sections hold the settings that are awkward as environment variables;
+// settings sets any other by its environment variable name, with objects and
+// lists standing in for JSON values:
+//
+//	stage: prod
+//	storage:
+//	  bucket: failure-uploads-prod
+//	  presignTTL: 15m
+//	limits:
+//	  maxFileBytes: 52428800
+//	projects:             # PROJECT_PROFILES
+//	  myapp: {maxFiles: 5}
+//	notifications:
+//	  to: oncall@example.com
+//	  routes:             # NOTIFY_ROUTES
+//	    default: {slackChannels: ["#failures"]}
+//	settings:
+//	  RATE_LIMIT_IP_RPS: 5
+//	  RETENTION_POLICIES: {default: {days: 90}}
+//
+// Unknown keys are errors. Environment variables override the file.
+type fileConfig struct {
+	Stage         string                 `yaml:"stage"`
+	Storage       fileStorage            `yaml:"storage"`
+	Limits        fileLimits             `yaml:"limits"`
+	Projects      map[string]interface{} `yaml:"projects"`
+	Notifications fileNotifications      `yaml:"notifications"`
+	Settings      map[string]interface{} `yaml:"settings"`
+}
+
+type fileStorage struct {
+	Bucket       string            `yaml:"bucket"`
+	Region       string            `yaml:"region"`
+	Endpoint     string            `yaml:"endpoint"`
+	UsePathStyle *bool             `yaml:"usePathStyle"`
+	Accelerate   *bool             `yaml:"accelerate"`
+	DualStack    *bool             `yaml:"dualStack"`
+	PresignTTL   *time.Duration    `yaml:"presignTTL"`
+	KMSKeyARN    string            `yaml:"kmsKeyArn"`
+	KMSKeys      map[string]string `yaml:"kmsKeys"`
+	// Destinations maps envs and project/envs to buckets
+	Destinations map[string]interface{} `yaml:"destinations"`
+}
+
+type fileLimits struct {
+	MaxBodyBytes        *int64   `yaml:"maxBodyBytes"`
+	MaxFileBytes        *int64   `yaml:"maxFileBytes"`
+	MaxTotalBytes       *int64   `yaml:"maxTotalBytes"`
+	MaxFiles            *int     `yaml:"maxFiles"`
+	MaxLogsBytes        *int64   `yaml:"maxLogsBytes"`
+	MaxScreenshotBytes  *int64   `yaml:"maxScreenshotBytes"`
+	MaxConsoleBytes     *int64   `yaml:"maxConsoleBytes"`
+	AllowedContentTypes []string `yaml:"allowedContentTypes"`
+	DeniedContentTypes  []string `yaml:"deniedContentTypes"`
+}
+
+type fileNotifications struct {
+	From   string                 `yaml:"from"`
+	To     string                 `yaml:"to"`
+	Mode   string                 `yaml:"mode"`
+	Routes map[string]interface{} `yaml:"routes"`
+}
+
+// loadFile reads the config file at path as settings keyed by environment
+// variable name
+func loadFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var f fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	values, err := f.values()
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// values flattens the file into settings. A setting given both in a section
+// and under settings is an error, since either would silently win.
+func (f *fileConfig) values() (map[string]string, error) {
+	values := make(map[string]string, len(f.Settings))
+	for key, v := range f.Settings {
+		s, err := settingValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("settings.%s: %w", key, err)
+		}
+		values[key] = s
+	}
+
+	var errs []error
+	set := func(key, field, value string) {
+		if value == "" {
+			return
+		}
+		if _, ok := values[key]; ok {
+			errs = append(errs, fmt.Errorf("%s and settings.%s set the same value", field, key))
+			return
+		}
+		values[key] = value
+	}
+	setJSON := func(key, field string, v interface{}) {
+		s, err := settingValue(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		set(key, field, s)
+	}
+
+	set("STAGE", "stage", f.Stage)
+
+	set("BUCKET_NAME", "storage.bucket", f.Storage.Bucket)
+	set("AWS_REGION", "storage.region", f.Storage.Region)
+	set("S3_ENDPOINT", "storage.endpoint", f.Storage.Endpoint)
+	if f.Storage.UsePathStyle != nil {
+		set("S3_USE_PATH_STYLE", "storage.usePathStyle", strconv.FormatBool(*f.Storage.UsePathStyle))
+	}
+	if f.Storage.Accelerate != nil {
+		set("S3_ACCELERATE", "storage.accelerate", strconv.FormatBool(*f.Storage.Accelerate))
+	}
+	if f.Storage.DualStack != nil {
+		set("S3_DUALSTACK", "storage.dualStack", strconv.FormatBool(*f.Storage.DualStack))
+	}
+	if f.Storage.PresignTTL != nil {
+		set("PRESIGN_TTL_SECONDS", "storage.presignTTL", strconv.Itoa(int(*f.Storage.PresignTTL/time.Second)))
+	}
+	set("SSE_KMS_KEY_ARN", "storage.kmsKeyArn", f.Storage.KMSKeyARN)
+	if len(f.Storage.KMSKeys) > 0 {
+		setJSON("SSE_KMS_KEYS", "storage.kmsKeys", f.Storage.KMSKeys)
+	}
+	if len(f.Storage.Destinations) > 0 {
+		setJSON("STORAGE_DESTINATIONS", "storage.destinations", f.Storage.Destinations)
+	}
+
+	if f.Limits.MaxBodyBytes != nil {
+		set("MAX_BODY_BYTES", "limits.maxBodyBytes", strconv.FormatInt(*f.Limits.MaxBodyBytes, 10))
+	}
+	if f.Limits.MaxFileBytes != nil {
+		set("MAX_FILE_BYTES", "limits.maxFileBytes", strconv.FormatInt(*f.Limits.MaxFileBytes, 10))
+	}
+	if f.Limits.MaxTotalBytes != nil {
+		set("MAX_TOTAL_BYTES", "limits.maxTotalBytes", strconv.FormatInt(*f.Limits.MaxTotalBytes, 10))
+	}
+	if f.Limits.MaxFiles != nil {
+		set("MAX_FILES", "limits.maxFiles", strconv.Itoa(*f.Limits.MaxFiles))
+	}
+	if f.Limits.MaxLogsBytes != nil {
+		set("MAX_LOGS_BYTES", "limits.maxLogsBytes", strconv.FormatInt(*f.Limits.MaxLogsBytes, 10))
+	}
+	if f.Limits.MaxScreenshotBytes != nil {
+		set("MAX_SCREENSHOT_BYTES", "limits.maxScreenshotBytes", strconv.FormatInt(*f.Limits.MaxScreenshotBytes, 10))
+	}
+	if f.Limits.MaxConsoleBytes != nil {
+		set("MAX_CONSOLE_BYTES", "limits.maxConsoleBytes", strconv.FormatInt(*f.Limits.MaxConsoleBytes, 10))
+	}
+	set("ALLOWED_CONTENT_TYPES", "limits.allowedContentTypes", strings.Join(f.Limits.AllowedContentTypes, ","))
+	set("DENIED_CONTENT_TYPES", "limits.deniedContentTypes", strings.Join(f.Limits.DeniedContentTypes, ","))
+
+	if len(f.Projects) > 0 {
+		setJSON("PROJECT_PROFILES", "projects", f.Projects)
+	}
+
+	set("SES_FROM", "notifications.from", f.Notifications.From)
+	set("SES_TO", "notifications.to", f.Notifications.To)
+	set("NOTIFY_MODE", "notifications.mode", f.Notifications.Mode)
+	if len(f.Notifications.Routes) > 0 {
+		setJSON("NOTIFY_ROUTES", "notifications.routes", f.Notifications.Routes)
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// settingValue converts a YAML value to the string its environment variable
+// would hold: scalars as written, objects and lists as JSON
+func settingValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
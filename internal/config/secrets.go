@@ -0,0 +1,321 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// Prefixes of settings whose value is a reference to a secret:
+//
+//	API_KEYS=secretsmanager:failure-uploader/prod/api-keys
+//	SLACK_BOT_TOKEN=secretsmanager:failure-uploader/prod#slackBotToken
+//	GITHUB_TOKEN=ssm:/failure-uploader/prod/github-token
+//
+// A Secrets Manager reference resolves to the secret's string value, or with
+// #field to that field of a JSON object secret. An SSM reference resolves to
+// the decrypted parameter. Names may be ARNs, whose region is used.
+const (
+	SecretsManagerPrefix = "secretsmanager:"
+	SSMPrefix            = "ssm:"
+)
+
+// secretFetchTimeout bounds each call to Secrets Manager or SSM
+const secretFetchTimeout = 10 * time.Second
+
+// secretRef is a parsed secret reference
+type secretRef struct {
+	service string // "secretsmanager" or "ssm"
+	name    string
+	field   string
+}
+
+// parseSecretRef parses value as a secret reference
+func parseSecretRef(value string) (secretRef, bool, error) {
+	var ref secretRef
+	switch {
+	case strings.HasPrefix(value, SecretsManagerPrefix):
+		ref.service = "secretsmanager"
+		ref.name, ref.field, _ = strings.Cut(strings.TrimPrefix(value, SecretsManagerPrefix), "#")
+	case strings.HasPrefix(value, SSMPrefix):
+		ref.service = "ssm"
+		ref.name = strings.TrimPrefix(value, SSMPrefix)
+	default:
+		return ref, false, nil
+	}
+	if ref.name == "" {
+		return ref, true, fmt.Errorf("%q names no secret", value)
+	}
+	return ref, true, nil
+}
+
+// String returns the reference without its field
+func (r secretRef) String() string {
+	return r.service + ":" + r.name
+}
+
+// region returns the region of an ARN name, or fallback
+func (r secretRef) region(fallback string) string {
+	if parts := strings.SplitN(r.name, ":", 6); len(parts) == 6 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3]
+	}
+	return fallback
+}
+
+// cachedSecret is a fetched secret value
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// Secrets resolves secret references in settings from AWS Secrets Manager and
+// SSM Parameter Store. Each secret is fetched once however many settings
+// refer to it; Watch refetches to pick up rotated values. A nil *Secrets
+// resolves nothing.
+type Secrets struct {
+	region string
+	// endpoint returns the API endpoint of a service in a region
+	endpoint func(service, region string) string
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	http     *http.Client
+	now      func() time.Time
+
+	credsOnce sync.Once
+	credsErr  error
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+	refs  map[string]string // setting → reference
+}
+
+// NewSecrets creates a resolver using the default AWS credentials, calling
+// region unless a reference names another. Credentials are loaded on first
+// use, so configurations without references never touch AWS.
+func NewSecrets(region string) *Secrets {
+	return &Secrets{
+		region: region,
+		endpoint: func(service, region string) string {
+			return fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+		},
+		signer: v4.NewSigner(),
+		http:   &http.Client{Timeout: secretFetchTimeout},
+		now:    time.Now,
+		cache:  make(map[string]cachedSecret),
+		refs:   make(map[string]string),
+	}
+}
+
+// resolve returns the value of setting key: value itself, or the secret it
+// references
+func (s *Secrets) resolve(ctx context.Context, key, value string) (string, error) {
+	ref, ok, err := parseSecretRef(value)
+	if !ok || err != nil {
+		return value, err
+	}
+	if s == nil {
+		return "", fmt.Errorf("%s: secrets are not available", ref)
+	}
+	s.mu.Lock()
+	s.refs[key] = value
+	s.mu.Unlock()
+	return s.get(ctx, ref, 0)
+}
+
+// IsSecret reports whether setting key was resolved from a secret
+func (s *Secrets) IsSecret(key string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.refs[key]
+	return ok
+}
+
+// Refresh refetches the secret behind setting key unless it was fetched less
+// than maxAge ago, and returns its value. It fails for settings not resolved
+// from a secret.
+func (s *Secrets) Refresh(ctx context.Context, key string, maxAge time.Duration) (string, error) {
+	if !s.IsSecret(key) {
+		return "", fmt.Errorf("%s is not a secret reference", key)
+	}
+	s.mu.Lock()
+	value := s.refs[key]
+	s.mu.Unlock()
+	ref, _, _ := parseSecretRef(value)
+	return s.get(ctx, ref, maxAge)
+}
+
+// Watch refreshes the secret behind setting key every interval until ctx is
+// done, calling apply whenever its value changes. A failed refresh or apply
+// keeps the previous value. Watch returns at once for settings not resolved
+// from a secret.
+func (s *Secrets) Watch(ctx context.Context, key string, interval time.Duration, apply func(value string) error) {
+	if !s.IsSecret(key) || interval <= 0 {
+		return
+	}
+	last, err := s.Refresh(ctx, key, interval)
+	if err != nil {
+		last = ""
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			value, err := s.Refresh(ctx, key, interval)
+			if err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Str("setting", key).Msg("failed to refresh secret")
+				continue
+			}
+			if value == last {
+				continue
+			}
+			if err := apply(value); err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Str("setting", key).Msg("failed to apply refreshed secret")
+				continue
+			}
+			last = value
+			logging.FromContext(ctx).Info().Str("setting", key).Msg("applied refreshed secret")
+		}
+	}
+}
+
+// get returns the value of ref, fetching the secret unless it was fetched
+// less than maxAge ago (with maxAge 0, ever)
+func (s *Secrets) get(ctx context.Context, ref secretRef, maxAge time.Duration) (string, error) {
+	cacheKey := ref.String()
+	s.mu.Lock()
+	cached, ok := s.cache[cacheKey]
+	s.mu.Unlock()
+	if !ok || (maxAge > 0 && s.now().Sub(cached.fetchedAt) >= maxAge) {
+		value, err := s.fetch(ctx, ref)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", ref, err)
+		}
+		cached = cachedSecret{value: value, fetchedAt: s.now()}
+		s.mu.Lock()
+		s.cache[cacheKey] = cached
+		s.mu.Unlock()
+	}
+	if ref.field == "" {
+		return cached.value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(cached.value), &fields); err != nil {
+		return "", fmt.Errorf("%s: field %q: secret is not a JSON object", ref, ref.field)
+	}
+	v, ok := fields[ref.field]
+	if !ok {
+		return "", fmt.Errorf("%s: secret has no field %q", ref, ref.field)
+	}
+	if str, ok := v.(string); ok {
+		return str, nil
+	}
+	// Objects and lists stand in for JSON settings, as in the config file
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// fetch reads the secret behind ref from AWS
+func (s *Secrets) fetch(ctx context.Context, ref secretRef) (string, error) {
+	if ref.service == "ssm" {
+		var out struct {
+			Parameter struct {
+				Value string
+			}
+		}
+		err := s.call(ctx, ref, "AmazonSSM.GetParameter", map[string]interface{}{"Name": ref.name, "WithDecryption": true}, &out)
+		return out.Parameter.Value, err
+	}
+	var out struct {
+		SecretString *string
+	}
+	if err := s.call(ctx, ref, "secretsmanager.GetSecretValue", map[string]string{"SecretId": ref.name}, &out); err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("binary secrets are not supported")
+	}
+	return *out.SecretString, nil
+}
+
+// call invokes a JSON API operation of ref's service
+func (s *Secrets) call(ctx context.Context, ref secretRef, target string, in, out interface{}) error {
+	s.credsOnce.Do(func() {
+		if s.creds != nil {
+			return
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(s.region))
+		s.creds, s.credsErr = cfg.Credentials, err
+	})
+	if s.credsErr != nil {
+		return fmt.Errorf("load AWS config: %w", s.credsErr)
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	region := ref.region(s.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint(ref.service, region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	creds, err := s.creds.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieve credentials: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	if err := s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), ref.service, region, s.now()); err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(msg, &apiErr)
+		if apiErr.Type != "" {
+			// The type may be qualified, e.g. "com.amazonaws...#ResourceNotFoundException"
+			typ := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+			return fmt.Errorf("%s: %s", typ, apiErr.Message)
+		}
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.Unmarshal(msg, out)
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// fakeSecrets serves GetSecretValue and GetParameter from values, keyed by
+// secret ID or parameter name
+type fakeSecrets struct {
+	mu     sync.Mutex
+	values map[string]string
+	calls  int
+}
+
+func (f *fakeSecrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	var in struct {
+		SecretId string
+		Name     string
+	}
+	_ = json.NewDecoder(r.Body).Decode(&in)
+
+	var out interface{}
+	switch r.Header.Get("X-Amz-Target") {
+	case "secretsmanager.GetSecretValue":
+		if v, ok := f.values[in.SecretId]; ok {
+			out = map[string]string{"SecretString": v}
+		}
+	case "AmazonSSM.GetParameter":
+		if v, ok := f.values[in.Name]; ok {
+			out = map[string]interface{}{"Parameter": map[string]string{"Value": v}}
+		}
+	}
+	if out == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeSecrets) set(name, value string) {
+	f.mu.Lock()
+	f.values[name] = value
+	f.mu.Unlock()
+}
+
+func newFakeSecrets(t *testing.T, values map[string]string) (*Secrets, *fakeSecrets) {
+	t.Helper()
+	fake := &fakeSecrets{values: values}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			t.Errorf("request is not signed")
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := NewSecrets("us-east-1")
+	s.endpoint = func(string, string) string { return srv.URL }
+	s.creds = credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	return s, fake
+}
+
+func TestSecrets_Resolve(t *testing.T) {
+	s, fake := newFakeSecrets(t, map[string]string{
+		"prod/app":         `{"slackBotToken":"xoxb-1","apiKeys":[{"id":"ios","key":"k"}]}`,
+		"prod/plain":       "plain-value",
+		"/prod/github":     "ghp_1",
+		"prod/not-a-table": "text",
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"literal", "literal", ""},
+		{"secretsmanager:prod/plain", "plain-value", ""},
+		{"secretsmanager:prod/app#slackBotToken", "xoxb-1", ""},
+		{"secretsmanager:prod/app#apiKeys", `[{"id":"ios","key":"k"}]`, ""},
+		{"ssm:/prod/github", "ghp_1", ""},
+		{"secretsmanager:prod/app#missing", "", `has no field "missing"`},
+		{"secretsmanager:prod/not-a-table#field", "", "not a JSON object"},
+		{"secretsmanager:prod/unknown", "", "ResourceNotFoundException: not found"},
+		{"ssm:", "", "names no secret"},
+	}
+	for _, tt := range tests {
+		got, err := s.resolve(ctx, "KEY", tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolve(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolve(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	// prod/app, prod/plain, /prod/github, prod/not-a-table and prod/unknown
+	if fake.calls != 5 {
+		t.Errorf("fetched %d times, want each secret once", fake.calls)
+	}
+}
+
+func TestSecretRef_Region(t *testing.T) {
+	ref, _, _ := parseSecretRef("secretsmanager:arn:aws:secretsmanager:eu-central-1:123456789012:secret:prod/app-AbCdEf#token")
+	if got := ref.region("us-east-1"); got != "eu-central-1" {
+		t.Errorf("region() = %q, want the ARN's region", got)
+	}
+	if ref.field != "token" {
+		t.Errorf("field = %q", ref.field)
+	}
+	ref, _, _ = parseSecretRef("ssm:/prod/github")
+	if got := ref.region("us-east-1"); got != "us-east-1" {
+		t.Errorf("region() = %q, want the fallback", got)
+	}
+}
+
+func TestSecrets_Refresh(t *testing.T) {
+	s, fake := newFakeSecrets(t, map[string]string{"prod/keys": "v1"})
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := s.resolve(ctx, "API_KEYS", "secretsmanager:prod/keys"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsSecret("API_KEYS") || s.IsSecret("SES_FROM") {
+		t.Error("IsSecret() does not track resolved settings")
+	}
+	if _, err := s.Refresh(ctx, "SES_FROM", time.Minute); err == nil {
+		t.Error("Refresh(SES_FROM) error = nil")
+	}
+
+	fake.set("prod/keys", "v2")
+	if v, _ := s.Refresh(ctx, "API_KEYS", time.Minute); v != "v1" {
+		t.Errorf("Refresh() = %q, want the cached value", v)
+	}
+	now = now.Add(time.Minute)
+	if v, _ := s.Refresh(ctx, "API_KEYS", time.Minute); v != "v2" {
+		t.Errorf("Refresh() = %q, want the rotated value", v)
+	}
+}
+
+func TestSource_SecretReference(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "secretsmanager:prod/app#slackBotToken")
+	t.Setenv("GITHUB_TOKEN", "ssm:/prod/missing")
+	s, _ := newFakeSecrets(t, map[string]string{"prod/app": `{"slackBotToken":"xoxb-1"}`})
+	src := newSource("")
+	src.secrets = s
+
+	if v := src.str("SLACK_BOT_TOKEN", ""); v != "xoxb-1" {
+		t.Errorf("SLACK_BOT_TOKEN = %q", v)
+	}
+	if src.isSet("GITHUB_TOKEN") || src.str("GITHUB_TOKEN", "") != "" {
+		t.Error("an unresolved reference should count as unset")
+	}
+	if len(src.errs) != 1 || !strings.Contains(src.errs[0].Error(), "GITHUB_TOKEN: ssm:/prod/missing") {
+		t.Errorf("errs = %v, want one error for GITHUB_TOKEN", src.errs)
+	}
+}
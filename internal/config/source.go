@@ -0,0 +1,178 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// source looks settings up in the environment, then in the config file, and
+// resolves secret references (see secrets.go). Malformed values are recorded
+// as errors instead of falling back to the default, so a typo cannot silently
+// change behavior.
+type source struct {
+	file     map[string]string
+	read     map[string]bool
+	secrets  *Secrets
+	resolved map[string]resolvedSecret
+	errs     []error
+}
+
+// resolvedSecret is the outcome of resolving a setting's secret reference
+type resolvedSecret struct {
+	value string
+	ok    bool
+}
+
+// newSource creates a source backed by the environment and, when path is
+// set, the config file at path. A file that cannot be read is reported
+// with the other errors.
+func newSource(path string) *source {
+	s := &source{read: make(map[string]bool), resolved: make(map[string]resolvedSecret)}
+	if path == "" {
+		return s
+	}
+	file, err := loadFile(path)
+	if err != nil {
+		s.errs = append(s.errs, err)
+	}
+	s.file = file
+	return s
+}
+
+// lookup returns the value of key and whether it is set. Empty values count
+// as unset, as do secret references that cannot be resolved.
+func (s *source) lookup(key string) (string, bool) {
+	s.read[key] = true
+	v := s.raw(key)
+	if v == "" {
+		return "", false
+	}
+	return s.resolve(key, v)
+}
+
+// raw returns the value of key without resolving secret references
+func (s *source) raw(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return s.file[key]
+}
+
+// resolve returns value, or the secret it references. Each setting is
+// resolved once, so a failure is reported once.
+func (s *source) resolve(key, value string) (string, bool) {
+	if r, ok := s.resolved[key]; ok {
+		return r.value, r.ok
+	}
+	if _, isRef, _ := parseSecretRef(value); !isRef {
+		return value, true
+	}
+	if s.secrets == nil {
+		region := s.raw("AWS_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		s.secrets = NewSecrets(region)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	v, err := s.secrets.resolve(ctx, key, value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", key, err))
+	}
+	r := resolvedSecret{value: v, ok: err == nil && v != ""}
+	s.resolved[key] = r
+	return r.value, r.ok
+}
+
+// isSet reports whether key has a value
+func (s *source) isSet(key string) bool {
+	_, ok := s.lookup(key)
+	return ok
+}
+
+func (s *source) invalid(key, value, want string) {
+	s.errs = append(s.errs, fmt.Errorf("%s: %q is not %s", key, value, want))
+}
+
+func (s *source) str(key, defaultVal string) string {
+	if v, ok := s.lookup(key); ok {
+		return v
+	}
+	return defaultVal
+}
+
+func (s *source) int(key string, defaultVal int) int {
+	v, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		s.invalid(key, v, "an integer")
+		return defaultVal
+	}
+	return i
+}
+
+func (s *source) int64(key string, defaultVal int64) int64 {
+	v, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		s.invalid(key, v, "an integer")
+		return defaultVal
+	}
+	return i
+}
+
+func (s *source) float(key string, defaultVal float64) float64 {
+	v, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		s.invalid(key, v, "a number")
+		return defaultVal
+	}
+	return f
+}
+
+// bool reads an opt-in flag, false when unset
+func (s *source) bool(key string) bool {
+	v, ok := s.lookup(key)
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		s.invalid(key, v, "true or false")
+		return false
+	}
+	return b
+}
+
+// unused reports config file settings that Load never read: typos, or
+// settings of another version
+func (s *source) unused() []error {
+	var keys []string
+	for k := range s.file {
+		if !s.read[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	errs := make([]error, 0, len(keys))
+	for _, k := range keys {
+		errs = append(errs, fmt.Errorf("%s: unknown setting in config file", k))
+	}
+	return errs
+}
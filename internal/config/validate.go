@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxPresignTTL is the longest validity S3 accepts for a presigned URL
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// maxVerifyAttempts bounds VERIFY_ATTEMPTS; the retry delays double, so more
+// attempts only make the first ones shorter
+const maxVerifyAttempts = 10
+
+// Bounds of THUMBNAIL_SIZE: smaller thumbnails show nothing, larger ones are
+// no longer a glance
+const (
+	minThumbnailSize = 32
+	maxThumbnailSize = 1024
+)
+
+// validate reports settings that parse but cannot work. Backends and JSON
+// settings are checked by the packages that build them.
+func (c *Config) validate(src *source) []error {
+	var errs []error
+	add := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+	}
+
+	// Outside dev the built-in bucket name would point at whatever bucket
+	// happens to carry it
+	if c.Stage != "dev" && !src.isSet("BUCKET_NAME") {
+		add("BUCKET_NAME", "required when STAGE is %q", c.Stage)
+	}
+	if c.BucketName == "" {
+		add("BUCKET_NAME", "must not be empty")
+	}
+	if c.PresignTTL <= 0 || c.PresignTTL > maxPresignTTL {
+		add("PRESIGN_TTL_SECONDS", "must be between 1 and %d, got %d", int(maxPresignTTL/time.Second), int(c.PresignTTL/time.Second))
+	}
+
+	positive := []struct {
+		key string
+		n   int64
+	}{
+		{"MAX_BODY_BYTES", c.MaxBodyBytes},
+		{"MAX_FILE_BYTES", c.MaxFileBytes},
+		{"MAX_TOTAL_BYTES", c.MaxTotalBytes},
+		{"MAX_LOGS_BYTES", c.MaxLogsBytes},
+		{"MAX_SCREENSHOT_BYTES", c.MaxScreenshotBytes},
+		{"MAX_CONSOLE_BYTES", c.MaxConsoleBytes},
+		{"MAX_REQUEST_BYTES", c.MaxRequestBytes},
+		{"TICKET_MAX_AGE_HOURS", int64(c.TicketMaxAge)},
+		{"RESTORE_DAYS", int64(c.RestoreDays)},
+		{"HEALTH_CHECK_TIMEOUT_SECONDS", int64(c.HealthCheckTimeout)},
+		{"AWS_MAX_ATTEMPTS", int64(c.AWSMaxAttempts)},
+		{"AUTO_COMPLETE_TIMEOUT_SECONDS", int64(c.AutoCompleteTimeout)},
+		{"LINK_TTL_DAYS", int64(c.LinkTTL)},
+	}
+	for _, p := range positive {
+		if p.n <= 0 {
+			add(p.key, "must be positive")
+		}
+	}
+
+	// Notification links are followed without credentials, so they must be signed
+	if c.PublicURL != "" && len(c.LinkSecret) < 16 {
+		add("LINK_SECRET", "must be at least 16 characters when PUBLIC_URL is set")
+	}
+	if c.RateLimitIPRate > 0 && c.RateLimitIPBurst <= 0 {
+		add("RATE_LIMIT_IP_BURST", "must be positive when RATE_LIMIT_IP_RPS is set")
+	}
+	if c.RateLimitKeyRate > 0 && c.RateLimitKeyBurst <= 0 {
+		add("RATE_LIMIT_KEY_BURST", "must be positive when RATE_LIMIT_KEY_RPS is set")
+	}
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		add("BREAKER_COOLDOWN_SECONDS", "must be positive when BREAKER_FAILURE_THRESHOLD is set")
+	}
+	if c.VerifyAttempts < 1 || c.VerifyAttempts > maxVerifyAttempts {
+		add("VERIFY_ATTEMPTS", "must be between 1 and %d, got %d", maxVerifyAttempts, c.VerifyAttempts)
+	}
+	for _, origin := range strings.Split(c.CORSAllowedOrigins, ",") {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "":
+		case origin == "*":
+			if c.Stage != "dev" {
+				add("CORS_ALLOWED_ORIGINS", "* is only allowed when STAGE is dev; list the allowed origins")
+			} else if c.CORSAllowCredentials {
+				add("CORS_ALLOWED_ORIGINS", "* cannot be combined with CORS_ALLOW_CREDENTIALS")
+			}
+		case !validOrigin(origin):
+			add("CORS_ALLOWED_ORIGINS", "%q is not an origin like https://app.example.com or https://*.example.com", origin)
+		}
+	}
+	if c.QuotaAlertPercent < 0 || c.QuotaAlertPercent > 100 {
+		add("QUOTA_ALERT_PERCENT", "must be between 0 and 100, got %d", c.QuotaAlertPercent)
+	}
+	if c.GzipLevel < 0 || c.GzipLevel > 9 {
+		add("GZIP_LEVEL", "must be between 0 and 9, got %d", c.GzipLevel)
+	}
+	if c.ThumbnailSize < minThumbnailSize || c.ThumbnailSize > maxThumbnailSize {
+		add("THUMBNAIL_SIZE", "must be between %d and %d, got %d", minThumbnailSize, maxThumbnailSize, c.ThumbnailSize)
+	}
+	if c.VerifyMode == "async" && c.VerifyQueueURL == "" {
+		add("VERIFY_QUEUE_URL", "required when VERIFY_MODE is async")
+	}
+
+	nonNegative := []struct {
+		key string
+		n   float64
+	}{
+		{"MAX_FILES", float64(c.MaxFiles)},
+		{"LOG_INFO_SAMPLE_N", float64(c.LogInfoSampleN)},
+		{"SIGNATURE_MAX_SKEW_SECONDS", float64(c.SignatureMaxSkew)},
+		{"UPLOAD_SIZE_TOLERANCE_PERCENT", float64(c.UploadSizeTolerancePercent)},
+		{"NOTIFY_DEDUP_WINDOW_SECONDS", float64(c.DedupWindow)},
+		{"ESCALATION_WINDOW_MINUTES", float64(c.EscalationWindow)},
+		{"RETENTION_DAYS", float64(c.RetentionDays)},
+		{"ARCHIVE_AFTER_DAYS", float64(c.ArchiveAfterDays)},
+		{"EXPIRY_NOTICE_DAYS", float64(c.ExpiryNoticeDays)},
+		{"REPLAY_TIMEOUT_SECONDS", float64(c.ReplayTimeout)},
+		{"LARGE_OBJECT_MIN_BYTES", float64(c.LargeObjectMinBytes)},
+		{"PAGERDUTY_OCCURRENCE_THRESHOLD", float64(c.PagerDutyThreshold)},
+		{"PAGERDUTY_WINDOW_SECONDS", float64(c.PagerDutyWindow)},
+		{"RATE_LIMIT_IP_RPS", c.RateLimitIPRate},
+		{"RATE_LIMIT_KEY_RPS", c.RateLimitKeyRate},
+		{"API_KEY_SYNC_SECONDS", float64(c.APIKeySyncInterval)},
+		{"AUDIT_FLUSH_SECONDS", float64(c.AuditFlushInterval)},
+		{"SECRETS_REFRESH_SECONDS", float64(c.SecretsRefreshInterval)},
+		{"CONFIG_RELOAD_SECONDS", float64(c.ConfigReloadInterval)},
+		{"S3_TIMEOUT_SECONDS", float64(c.S3Timeout)},
+		{"SES_TIMEOUT_SECONDS", float64(c.SESTimeout)},
+		{"BREAKER_FAILURE_THRESHOLD", float64(c.BreakerThreshold)},
+		{"VERIFY_RETRY_WINDOW_MS", float64(c.VerifyRetryWindow)},
+		{"CORS_MAX_AGE_SECONDS", float64(c.CORSMaxAge)},
+		{"TRUSTED_PROXY_DEPTH", float64(c.TrustedProxyDepth)},
+		{"QUOTA_DAILY_FAILURES", float64(c.QuotaDailyFailures)},
+		{"QUOTA_DAILY_BYTES", float64(c.QuotaDailyBytes)},
+		{"STORAGE_BUDGET_BYTES", float64(c.StorageBudgetBytes)},
+		{"STORAGE_BUDGET_EXEMPT_BYTES", float64(c.StorageBudgetExemptBytes)},
+	}
+	for _, n := range nonNegative {
+		if n.n < 0 {
+			add(n.key, "must not be negative")
+		}
+	}
+
+	oneOf := []struct {
+		key, value string
+		allowed    []string
+	}{
+		{"AUTH_MODE", c.AuthMode, []string{"apikey", "jwt", "any", "hmac", "authorizer"}},
+		{"NOTIFY_MODE", c.NotifyMode, []string{"immediate", "digest"}},
+		{"DIGEST_PERIOD", c.DigestPeriod, []string{"daily", "weekly"}},
+		{"EMAIL_PROVIDER", c.EmailProvider, []string{"ses", "smtp", "sendgrid"}},
+		{"VERIFY_MODE", c.VerifyMode, []string{"sync", "async"}},
+		{"CONTENT_MISMATCH_ACTION", c.ContentMismatchAction, []string{"record", "reject_executables", "reject"}},
+	}
+	for _, o := range oneOf {
+		if !contains(o.allowed, o.value) {
+			add(o.key, "%q is not one of %v", o.value, o.allowed)
+		}
+	}
+
+	// Acceleration and dual-stack are AWS endpoints, which a custom endpoint
+	// replaces
+	if c.S3Endpoint != "" {
+		if c.S3Accelerate {
+			add("S3_ACCELERATE", "cannot be combined with S3_ENDPOINT")
+		}
+		if c.S3DualStack {
+			add("S3_DUALSTACK", "cannot be combined with S3_ENDPOINT")
+		}
+	}
+	if c.S3Accelerate && c.S3UsePathStyle {
+		add("S3_ACCELERATE", "cannot be combined with S3_USE_PATH_STYLE")
+	}
+
+	// Half of a static key pair would sign every request with an empty secret
+	// or fall back to the default credential chain unnoticed
+	if c.S3AccessKeyID != "" && c.S3SecretAccessKey == "" {
+		add("S3_SECRET_ACCESS_KEY", "required when S3_ACCESS_KEY_ID is set")
+	}
+	if c.S3SecretAccessKey != "" && c.S3AccessKeyID == "" {
+		add("S3_ACCESS_KEY_ID", "required when S3_SECRET_ACCESS_KEY is set")
+	}
+
+	// An explicitly chosen auth mode without its credentials would quietly
+	// turn auth off
+	if c.Stage != "dev" && src.isSet("AUTH_MODE") && !c.AuthEnabled {
+		add("AUTH_MODE", "%s has no credentials configured, which would disable auth", c.AuthMode)
+	}
+	return errs
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validOrigin reports whether origin is a scheme and host, optionally with a
+// port and a "*." wildcard subdomain, and nothing else
+func validOrigin(origin string) bool {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
@@ -0,0 +1,109 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// Prefix is the S3 prefix under which suppression state is stored
+const Prefix = "notifications/dedup/"
+
+// Store persists suppression state so it survives Lambda cold starts
+type Store interface {
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
+
+// Fingerprint identifies "the same failure" for notification purposes:
+// project, env, method and the URL host and path (query string ignored).
+func Fingerprint(project, env, method, rawURL string) string {
+	hostPath := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		hostPath = strings.ToLower(u.Host) + u.Path
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{project, env, strings.ToUpper(method), hostPath}, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// state is the persisted suppression window for a fingerprint
+type state struct {
+	WindowStart time.Time `json:"windowStart"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Suppressed  int       `json:"suppressed"`
+}
+
+// Decision is the outcome of checking a fingerprint against its window
+type Decision struct {
+	// Notify is true when a notification should be sent for this occurrence
+	Notify bool
+	// Suppressed is the number of occurrences swallowed by the previous window,
+	// reported on the notification that closes it
+	Suppressed int
+	// Since is when the previous window started
+	Since time.Time
+}
+
+// Deduper throttles notifications to one per fingerprint per window
+type Deduper struct {
+	store  Store
+	window time.Duration
+}
+
+// New creates a deduper backed by store
+func New(store Store, window time.Duration) *Deduper {
+	return &Deduper{store: store, window: window}
+}
+
+// Check records an occurrence of fingerprint at now and decides whether to notify.
+// The first occurrence in a window notifies; later ones are counted and suppressed.
+// The first occurrence after the window closes notifies with the suppressed count.
+// Storage errors fail open so failures are never silently dropped.
+func (d *Deduper) Check(ctx context.Context, fingerprint string, now time.Time) Decision {
+	key := Prefix + fingerprint + ".json"
+
+	var st state
+	exists, err := d.store.ObjectExists(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("fingerprint", fingerprint).Msg("dedup state lookup failed")
+		return Decision{Notify: true}
+	}
+	if exists {
+		b, err := d.store.GetObjectBytes(ctx, key)
+		if err == nil {
+			err = json.Unmarshal(b, &st)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("fingerprint", fingerprint).Msg("dedup state unreadable")
+			st = state{}
+		}
+	}
+
+	var decision Decision
+	if !st.WindowStart.IsZero() && now.Sub(st.WindowStart) < d.window {
+		st.Suppressed++
+		decision = Decision{Notify: false, Suppressed: st.Suppressed, Since: st.WindowStart}
+	} else {
+		decision = Decision{Notify: true, Suppressed: st.Suppressed, Since: st.WindowStart}
+		st = state{WindowStart: now}
+	}
+	st.LastSeen = now
+
+	b, err := json.Marshal(st)
+	if err == nil {
+		err = d.store.PutObjectBytes(ctx, key, "application/json", b)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("fingerprint", fingerprint).Msg("dedup state write failed")
+	}
+
+	return decision
+}
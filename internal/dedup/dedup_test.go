@@ -0,0 +1,53 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("myapp", "prod", "POST", "https://api.example.com/v1/orders?id=1")
+
+	if got := Fingerprint("myapp", "prod", "post", "https://API.example.com/v1/orders?id=2"); got != base {
+		t.Error("query string, method case and host case should not change the fingerprint")
+	}
+	if got := Fingerprint("myapp", "prod", "POST", "https://api.example.com/v1/users"); got == base {
+		t.Error("different path should change the fingerprint")
+	}
+	if got := Fingerprint("myapp", "staging", "POST", "https://api.example.com/v1/orders"); got == base {
+		t.Error("different env should change the fingerprint")
+	}
+}
+
+func TestDeduper_Check(t *testing.T) {
+	ctx := context.Background()
+	d := New(testsupport.NewStore(), 15*time.Minute)
+	start := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	if dec := d.Check(ctx, "fp", start); !dec.Notify || dec.Suppressed != 0 {
+		t.Fatalf("first occurrence = %+v, want notify with no suppressed", dec)
+	}
+
+	for i := 1; i <= 3; i++ {
+		dec := d.Check(ctx, "fp", start.Add(time.Duration(i)*time.Minute))
+		if dec.Notify {
+			t.Fatalf("occurrence %d within window should be suppressed", i+1)
+		}
+	}
+
+	if dec := d.Check(ctx, "other", start.Add(time.Minute)); !dec.Notify {
+		t.Error("a different fingerprint should notify")
+	}
+
+	dec := d.Check(ctx, "fp", start.Add(20*time.Minute))
+	if !dec.Notify || dec.Suppressed != 3 || !dec.Since.Equal(start) {
+		t.Errorf("occurrence after window = %+v, want notify with 3 suppressed since %v", dec, start)
+	}
+
+	if dec := d.Check(ctx, "fp", start.Add(21*time.Minute)); dec.Notify {
+		t.Error("new window should suppress again")
+	}
+}
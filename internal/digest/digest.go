@@ -0,0 +1,275 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/links"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/scan"
+)
+
+// Prefix is the S3 prefix under which digest manifest entries are stored
+const Prefix = "digests/"
+
+const (
+	topURLLimit = 10
+	recentLimit = 20
+)
+
+// Store is the subset of S3 operations the digest needs
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+	PresignGet(ctx context.Context, key string) (string, error)
+}
+
+// Entry records a single completed failure for later inclusion in a digest
+type Entry struct {
+	FailureID   string    `json:"failureId"`
+	Project     string    `json:"project"`
+	Env         string    `json:"env"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	AppVersion  string    `json:"appVersion"`
+	Platform    string    `json:"platform"`
+	EnvelopeKey string    `json:"envelopeKey"`
+	CompletedAt time.Time `json:"completedAt"`
+	// ContentMismatches counts artifacts whose content contradicts their declared type
+	ContentMismatches int `json:"contentMismatches,omitempty"`
+	// ScanKeys are the objects whose malware scan had not cleared when the
+	// failure completed; the envelope is only linked once they are cleared
+	ScanKeys []string `json:"scanKeys,omitempty"`
+
+	// EnvelopeURL is filled in when building a summary; it is not persisted
+	EnvelopeURL string `json:"-"`
+}
+
+// Key returns the manifest key for the entry
+// Format: digests/{project}/YYYY/MM/DD/{failureId}.json
+func (e Entry) Key() string {
+	return path.Join(dayPrefix(e.Project, e.CompletedAt), e.FailureID+".json")
+}
+
+func dayPrefix(project string, t time.Time) string {
+	return Prefix + project + "/" + t.UTC().Format("2006/01/02") + "/"
+}
+
+// Record writes a manifest entry for a completed failure
+func Record(ctx context.Context, store Store, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return store.PutObjectBytes(keys.WithScope(ctx, e.Project, e.Env), e.Key(), "application/json", b)
+}
+
+// Projects lists the projects that have recorded entries
+func Projects(ctx context.Context, store Store) ([]string, error) {
+	prefixes, err := store.ListPrefixes(ctx, Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		projects = append(projects, strings.TrimSuffix(strings.TrimPrefix(p, Prefix), "/"))
+	}
+	return projects, nil
+}
+
+// Collect loads the entries for project completed within [from, to)
+func Collect(ctx context.Context, store Store, project string, from, to time.Time) ([]Entry, error) {
+	var entries []Entry
+
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		keys, err := store.ListKeys(ctx, dayPrefix(project, day))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			b, err := store.GetObjectBytes(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", key, err)
+			}
+
+			var e Entry
+			if err := json.Unmarshal(b, &e); err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("skipping unreadable digest entry")
+				continue
+			}
+			if e.CompletedAt.Before(from) || !e.CompletedAt.Before(to) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// URLCount is the number of failures for a single endpoint
+type URLCount struct {
+	Method string
+	URL    string
+	Count  int
+}
+
+// Summary aggregates a project's failures over a digest period
+type Summary struct {
+	Project string
+	From    time.Time
+	To      time.Time
+	Total   int
+	ByEnv   map[string]int
+	TopURLs []URLCount
+	Recent  []Entry
+	// Flagged are the failures with content mismatches, most recent first
+	Flagged []Entry
+}
+
+// Summarize aggregates entries into a digest summary
+func Summarize(project string, entries []Entry, from, to time.Time) Summary {
+	s := Summary{
+		Project: project,
+		From:    from,
+		To:      to,
+		Total:   len(entries),
+		ByEnv:   make(map[string]int),
+	}
+
+	counts := make(map[string]*URLCount)
+	for _, e := range entries {
+		s.ByEnv[e.Env]++
+
+		k := e.Method + " " + e.URL
+		if c, ok := counts[k]; ok {
+			c.Count++
+		} else {
+			counts[k] = &URLCount{Method: e.Method, URL: e.URL, Count: 1}
+		}
+	}
+
+	for _, c := range counts {
+		s.TopURLs = append(s.TopURLs, *c)
+	}
+	sort.Slice(s.TopURLs, func(i, j int) bool {
+		if s.TopURLs[i].Count != s.TopURLs[j].Count {
+			return s.TopURLs[i].Count > s.TopURLs[j].Count
+		}
+		return s.TopURLs[i].Method+s.TopURLs[i].URL < s.TopURLs[j].Method+s.TopURLs[j].URL
+	})
+	if len(s.TopURLs) > topURLLimit {
+		s.TopURLs = s.TopURLs[:topURLLimit]
+	}
+
+	s.Recent = append([]Entry(nil), entries...)
+	sort.Slice(s.Recent, func(i, j int) bool {
+		return s.Recent[i].CompletedAt.After(s.Recent[j].CompletedAt)
+	})
+	for _, e := range s.Recent {
+		if e.ContentMismatches > 0 {
+			s.Flagged = append(s.Flagged, e)
+		}
+	}
+	if len(s.Recent) > recentLimit {
+		s.Recent = s.Recent[:recentLimit]
+	}
+	if len(s.Flagged) > recentLimit {
+		s.Flagged = s.Flagged[:recentLimit]
+	}
+
+	return s
+}
+
+// Notifier delivers a digest summary
+type Notifier interface {
+	SendDigest(ctx context.Context, s Summary) error
+}
+
+// Period returns the lookback window for a named digest period
+func Period(name string) (time.Duration, error) {
+	switch name {
+	case "daily", "":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unknown digest period %q", name)
+	}
+}
+
+// Run sends one digest per project covering [to-period, to). Projects with no
+// failures in the window are skipped. When signer is set, envelopes are linked
+// through signed short links that presign at click time instead of expiring URLs.
+func Run(ctx context.Context, store Store, notifier Notifier, period time.Duration, to time.Time, signer *links.Signer) error {
+	from := to.Add(-period)
+
+	projects, err := Projects(ctx, store)
+	if err != nil {
+		return fmt.Errorf("list projects: %w", err)
+	}
+
+	var failed int
+	for _, project := range projects {
+		entries, err := Collect(ctx, store, project, from, to)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("project", project).Msg("failed to collect digest entries")
+			failed++
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		s := Summarize(project, entries, from, to)
+		for i := range s.Recent {
+			if s.Recent[i].EnvelopeKey == "" || withheld(ctx, store, s.Recent[i]) {
+				continue
+			}
+			if signer != nil {
+				s.Recent[i].EnvelopeURL = signer.URL(s.Recent[i].FailureID, "envelope.json")
+				continue
+			}
+			if url, err := store.PresignGet(ctx, s.Recent[i].EnvelopeKey); err == nil {
+				s.Recent[i].EnvelopeURL = url
+			}
+		}
+
+		if err := notifier.SendDigest(ctx, s); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("project", project).Msg("failed to send digest")
+			failed++
+			continue
+		}
+
+		logging.FromContext(ctx).Info().Str("project", project).Int("failures", s.Total).Msg("digest sent")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d project digests failed", failed, len(projects))
+	}
+	return nil
+}
+
+// withheld reports whether the malware scan still withholds e's downloads.
+// Records that cannot be read withhold them too.
+func withheld(ctx context.Context, store Store, e Entry) bool {
+	if len(e.ScanKeys) == 0 {
+		return false
+	}
+	recs, err := scan.Load(ctx, store, e.FailureID)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", e.FailureID).Msg("failed to read scan records")
+		return true
+	}
+	return recs.Status(e.ScanKeys) != ""
+}
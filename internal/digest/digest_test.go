@@ -0,0 +1,113 @@
+package digest_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/digest"
+	"github.com/yourorg/failure-uploader/internal/links"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+type recordingNotifier struct {
+	sent []digest.Summary
+}
+
+func (n *recordingNotifier) SendDigest(_ context.Context, s digest.Summary) error {
+	n.sent = append(n.sent, s)
+	return nil
+}
+
+func TestEntry_Key(t *testing.T) {
+	e := digest.Entry{Project: "myapp", FailureID: "abc-123", CompletedAt: time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)}
+	want := "digests/myapp/2024/03/15/abc-123.json"
+	if got := e.Key(); got != want {
+		t.Errorf("Key() = %q, want %q", got, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	from := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	entries := []digest.Entry{
+		{FailureID: "1", Env: "prod", Method: "POST", URL: "https://a/x", CompletedAt: from.Add(1 * time.Hour)},
+		{FailureID: "2", Env: "prod", Method: "POST", URL: "https://a/x", CompletedAt: from.Add(3 * time.Hour)},
+		{FailureID: "3", Env: "staging", Method: "GET", URL: "https://a/y", CompletedAt: from.Add(2 * time.Hour), ContentMismatches: 1},
+	}
+
+	s := digest.Summarize("myapp", entries, from, from.Add(24*time.Hour))
+
+	if s.Total != 3 {
+		t.Errorf("Total = %d, want 3", s.Total)
+	}
+	if s.ByEnv["prod"] != 2 || s.ByEnv["staging"] != 1 {
+		t.Errorf("ByEnv = %v", s.ByEnv)
+	}
+	if len(s.TopURLs) != 2 || s.TopURLs[0].URL != "https://a/x" || s.TopURLs[0].Count != 2 {
+		t.Errorf("TopURLs = %+v", s.TopURLs)
+	}
+	if s.Recent[0].FailureID != "2" {
+		t.Errorf("Recent[0] = %q, want most recent failure 2", s.Recent[0].FailureID)
+	}
+	if len(s.Flagged) != 1 || s.Flagged[0].FailureID != "3" {
+		t.Errorf("Flagged = %+v, want failure 3", s.Flagged)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	to := time.Date(2024, 3, 16, 6, 0, 0, 0, time.UTC)
+
+	records := []digest.Entry{
+		{FailureID: "in-1", Project: "myapp", Env: "prod", EnvelopeKey: "failures/e1", CompletedAt: to.Add(-2 * time.Hour)},
+		{FailureID: "in-2", Project: "myapp", Env: "prod", CompletedAt: to.Add(-20 * time.Hour)},
+		{FailureID: "old", Project: "myapp", Env: "prod", CompletedAt: to.Add(-30 * time.Hour)},
+		{FailureID: "stale", Project: "quiet", Env: "prod", CompletedAt: to.Add(-48 * time.Hour)},
+	}
+	for _, e := range records {
+		if err := digest.Record(ctx, store, e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	n := &recordingNotifier{}
+	if err := digest.Run(ctx, store, n, 24*time.Hour, to, nil); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(n.sent) != 1 {
+		t.Fatalf("sent %d digests, want 1 (projects without failures are skipped)", len(n.sent))
+	}
+	s := n.sent[0]
+	if s.Project != "myapp" || s.Total != 2 {
+		t.Errorf("digest = %s with %d failures, want myapp with 2", s.Project, s.Total)
+	}
+	if s.Recent[0].EnvelopeURL != "https://storage.test/failures/e1" {
+		t.Errorf("EnvelopeURL = %q", s.Recent[0].EnvelopeURL)
+	}
+}
+
+func TestRun_ShortLinks(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	to := time.Date(2024, 3, 16, 6, 0, 0, 0, time.UTC)
+
+	digest.Record(ctx, store, digest.Entry{FailureID: "in-1", Project: "myapp", Env: "prod", EnvelopeKey: "failures/e1", CompletedAt: to.Add(-time.Hour)})
+
+	signer, _ := links.NewSigner("https://api.example.com", "0123456789abcdef", time.Hour)
+	n := &recordingNotifier{}
+	if err := digest.Run(ctx, store, n, 24*time.Hour, to, signer); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := n.sent[0].Recent[0].EnvelopeURL
+	if !strings.HasPrefix(got, "https://api.example.com/r/in-1/envelope.json?") {
+		t.Fatalf("EnvelopeURL = %q, want short link", got)
+	}
+	link, _ := url.Parse(got)
+	if err := signer.VerifyURL("in-1", "envelope.json", link.Query()); err != nil {
+		t.Errorf("EnvelopeURL signature: %v", err)
+	}
+}
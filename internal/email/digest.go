@@ -0,0 +1,112 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/digest"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// SendDigest sends a summary email covering all failures for a project in a digest period
+func (s *Sender) SendDigest(ctx context.Context, sum digest.Summary) error {
+	period := fmt.Sprintf("%s – %s", sum.From.UTC().Format("2006-01-02 15:04"), sum.To.UTC().Format("2006-01-02 15:04 MST"))
+	subject := fmt.Sprintf("[%s] Failure digest: %d failed requests", sum.Project, sum.Total)
+
+	envs := make([]string, 0, len(sum.ByEnv))
+	for env := range sum.ByEnv {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	var text, htm strings.Builder
+
+	fmt.Fprintf(&text, "Failure digest for %s\nPeriod: %s\nTotal failures: %d\n\nBy environment:\n", sum.Project, period, sum.Total)
+	for _, env := range envs {
+		fmt.Fprintf(&text, "- %s: %d\n", env, sum.ByEnv[env])
+	}
+	text.WriteString("\nTop failing URLs:\n")
+	for _, u := range sum.TopURLs {
+		fmt.Fprintf(&text, "- %dx %s %s\n", u.Count, u.Method, u.URL)
+	}
+	if len(sum.Flagged) > 0 {
+		text.WriteString("\nContent mismatches (artifacts that do not match their declared type):\n")
+		for _, e := range sum.Flagged {
+			fmt.Fprintf(&text, "- %s [%s] %s: %d artifact(s)\n", e.CompletedAt.UTC().Format("2006-01-02 15:04"), e.Env, e.FailureID, e.ContentMismatches)
+		}
+	}
+	text.WriteString("\nRecent failures:\n")
+	for _, e := range sum.Recent {
+		fmt.Fprintf(&text, "- %s [%s] %s %s %s\n", e.CompletedAt.UTC().Format("2006-01-02 15:04"), e.Env, e.Method, e.URL, e.EnvelopeURL)
+	}
+	fmt.Fprintf(&text, "\n---\nThis is an automated digest from failure-uploader %s.\n", buildinfo.Get())
+
+	htm.WriteString(`<!DOCTYPE html>
+<html>
+<head><style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; }
+.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+.header { background: #f44336; color: white; padding: 20px; border-radius: 8px 8px 0 0; }
+.content { background: #f9f9f9; padding: 20px; border-radius: 0 0 8px 8px; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 4px 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+.count { font-weight: bold; text-align: right; white-space: nowrap; }
+.footer { margin-top: 20px; font-size: 12px; color: #999; }
+</style></head>
+<body>
+<div class="container">
+<div class="header">
+`)
+	fmt.Fprintf(&htm, "<h2 style=\"margin:0;\">Failure Digest: %s</h2>\n<p style=\"margin:5px 0 0 0;\">%s &middot; %d failures</p>\n</div>\n<div class=\"content\">\n",
+		html.EscapeString(sum.Project), html.EscapeString(period), sum.Total)
+
+	htm.WriteString("<h3>By Environment</h3>\n<table>\n")
+	for _, env := range envs {
+		fmt.Fprintf(&htm, "<tr><td>%s</td><td class=\"count\">%d</td></tr>\n", html.EscapeString(env), sum.ByEnv[env])
+	}
+	htm.WriteString("</table>\n<h3>Top Failing URLs</h3>\n<table>\n")
+	for _, u := range sum.TopURLs {
+		fmt.Fprintf(&htm, "<tr><td>%s %s</td><td class=\"count\">%d</td></tr>\n", html.EscapeString(u.Method), html.EscapeString(u.URL), u.Count)
+	}
+	if len(sum.Flagged) > 0 {
+		htm.WriteString("</table>\n<h3>Content Mismatches</h3>\n<table>\n")
+		for _, e := range sum.Flagged {
+			fmt.Fprintf(&htm, "<tr><td>%s</td><td>%s</td><td>%s</td><td class=\"count\">%d</td></tr>\n",
+				e.CompletedAt.UTC().Format("01-02 15:04"), html.EscapeString(e.Env), html.EscapeString(e.FailureID), e.ContentMismatches)
+		}
+	}
+	htm.WriteString("</table>\n<h3>Recent Failures</h3>\n<table>\n")
+	for _, e := range sum.Recent {
+		link := html.EscapeString(e.FailureID)
+		if e.EnvelopeURL != "" {
+			link = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(e.EnvelopeURL), link)
+		}
+		fmt.Fprintf(&htm, "<tr><td>%s</td><td>%s</td><td>%s %s</td><td>%s</td></tr>\n",
+			e.CompletedAt.UTC().Format("01-02 15:04"), html.EscapeString(e.Env), html.EscapeString(e.Method), html.EscapeString(e.URL), link)
+	}
+	htm.WriteString(`</table>
+</div>
+`)
+	fmt.Fprintf(&htm, "<div class=\"footer\">This is an automated digest from failure-uploader %s.</div>\n", html.EscapeString(buildinfo.Get().String()))
+	htm.WriteString(`</div>
+</body>
+</html>`)
+
+	tags := map[string]string{"type": "digest", "project": sum.Project}
+	sent, err := s.send(ctx, "digest", s.to, subject, text.String(), htm.String(), tags)
+	if err != nil {
+		metrics.EmailFailures.Inc("digest")
+		logging.FromContext(ctx).Error().Err(err).Str("project", sum.Project).Msg("failed to send digest email")
+		return err
+	}
+
+	if sent {
+		logging.FromContext(ctx).Info().Str("project", sum.Project).Int("failures", sum.Total).Str("to", s.to).Msg("digest email sent")
+	}
+	return nil
+}
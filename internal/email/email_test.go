@@ -0,0 +1,433 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+var testMessage = Message{
+	From:    "noreply@example.com",
+	To:      "owner@example.com",
+	Subject: "[myapp/prod] Failed Request Captured: f1",
+	Text:    "A failed network request has been captured.\n",
+	HTML:    `<p class="x">A failed network request has been captured.</p>`,
+	Tags:    map[string]string{"failureId": "f1"},
+}
+
+// fakeTransport records sent messages
+type fakeTransport struct {
+	sent []Message
+}
+
+func (f *fakeTransport) Send(_ context.Context, m Message) error {
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func TestSender_SendFailureNotification(t *testing.T) {
+	ft := &fakeTransport{}
+	s := &Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}
+
+	err := s.SendFailureNotification(context.Background(), FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", Critical: true})
+	if err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	if len(ft.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(ft.sent))
+	}
+	m := ft.sent[0]
+	if m.From != "noreply@example.com" || m.To != "owner@example.com" || !strings.HasPrefix(m.Subject, "[CRITICAL] [myapp/prod]") {
+		t.Errorf("message = %+v", m)
+	}
+	if !strings.Contains(m.Text, "f1") || !strings.Contains(m.HTML, "f1") {
+		t.Error("message body does not mention the failure")
+	}
+	if m.Tags["failureId"] != "f1" || m.Tags["project"] != "myapp" || m.Tags["env"] != "prod" {
+		t.Errorf("Tags = %v", m.Tags)
+	}
+}
+
+func TestSender_WithholdsLinksDuringScan(t *testing.T) {
+	ft := &fakeTransport{}
+	s := &Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}
+
+	err := s.SendFailureNotification(context.Background(), FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", ScanStatus: "quarantined"})
+	if err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	m := ft.sent[0]
+	if !strings.Contains(m.Text, "quarantined an attachment") || !strings.Contains(m.HTML, "quarantined an attachment") {
+		t.Errorf("message does not explain the withheld download:\n%s", m.Text)
+	}
+	if strings.Contains(m.HTML, "Download Envelope") {
+		t.Error("HTML links the envelope of a quarantined failure")
+	}
+}
+
+func TestSender_IncludesThumbnail(t *testing.T) {
+	ft := &fakeTransport{}
+	s := &Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}
+
+	url := "https://failures.example.com/r/f1/thumbs/screenshot.png.png"
+	err := s.SendFailureNotification(context.Background(), FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", ThumbnailURL: url})
+	if err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	m := ft.sent[0]
+	if !strings.Contains(m.Text, url) || !strings.Contains(m.HTML, `<img src="`+url+`"`) {
+		t.Errorf("message does not show the thumbnail:\n%s", m.HTML)
+	}
+}
+
+func TestSender_SubjectIncludesOutcome(t *testing.T) {
+	ft := &fakeTransport{}
+	s := &Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}
+
+	notif := FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", StatusCode: 503, DurationMs: 1200,
+		ErrorMessage: "upstream\nunavailable " + strings.Repeat("x", 100)}
+	if err := s.SendFailureNotification(context.Background(), notif); err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	m := ft.sent[0]
+	if !strings.HasPrefix(m.Subject, "[myapp/prod] Failed Request Captured: f1 (HTTP 503: upstream unavailable x") || !strings.HasSuffix(m.Subject, "...)") {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if !strings.Contains(m.Text, "- Status: 503") || !strings.Contains(m.Text, "- Duration: 1200 ms") || !strings.Contains(m.HTML, "1200 ms") {
+		t.Errorf("body does not describe the response:\n%s", m.Text)
+	}
+}
+
+func TestFailureNotification_Outcome(t *testing.T) {
+	for _, tt := range []struct {
+		notif FailureNotification
+		want  string
+	}{
+		{FailureNotification{}, ""},
+		{FailureNotification{StatusCode: 500}, "HTTP 500"},
+		{FailureNotification{ErrorClass: "timeout"}, "timeout"},
+		{FailureNotification{StatusCode: 502, ErrorClass: "server", ErrorMessage: "Bad Gateway"}, "HTTP 502: Bad Gateway"},
+	} {
+		if got := tt.notif.Outcome(); got != tt.want {
+			t.Errorf("Outcome(%+v) = %q, want %q", tt.notif, got, tt.want)
+		}
+	}
+}
+
+// suppressed is a Suppressions listing fixed addresses
+type suppressed map[string]bool
+
+func (s suppressed) Suppressed(_ context.Context, address string) (bool, error) {
+	return s[address], nil
+}
+
+func TestSender_SkipsSuppressedRecipient(t *testing.T) {
+	ft := &fakeTransport{}
+	s := (&Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}).
+		WithSuppressions(suppressed{"owner@example.com": true})
+
+	if err := s.SendFailureNotification(context.Background(), FailureNotification{FailureID: "f1"}); err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	if len(ft.sent) != 0 {
+		t.Errorf("sent %d messages to a suppressed recipient", len(ft.sent))
+	}
+
+	s.WithSuppressions(suppressed{})
+	if err := s.SendFailureNotification(context.Background(), FailureNotification{FailureID: "f1"}); err != nil || len(ft.sent) != 1 {
+		t.Errorf("unsuppressed send: err = %v, sent = %d", err, len(ft.sent))
+	}
+}
+
+func TestSender_RoutedRecipients(t *testing.T) {
+	ft := &fakeTransport{}
+	s := (&Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}).
+		WithSuppressions(suppressed{"gone@example.com": true})
+
+	notif := FailureNotification{FailureID: "f1", To: []string{"a@example.com", "gone@example.com", "b@example.com"}}
+	if err := s.SendFailureNotification(context.Background(), notif); err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	if len(ft.sent) != 2 || ft.sent[0].To != "a@example.com" || ft.sent[1].To != "b@example.com" {
+		t.Errorf("sent = %+v, want a@ and b@ only", ft.sent)
+	}
+}
+
+func TestMessage_MIME(t *testing.T) {
+	m := testMessage
+	m.Subject = "Ünicode\r\nBcc: someone@example.com"
+	raw, err := m.mime(time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("mime() error = %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("subject injected a header")
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != m.Subject {
+		t.Errorf("Subject = %q, want %q", subject, m.Subject)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		b, _ := io.ReadAll(p)
+		parts = append(parts, strings.ReplaceAll(string(b), "\r\n", "\n"))
+	}
+	if len(parts) != 2 || parts[0] != m.Text || parts[1] != m.HTML {
+		t.Errorf("parts = %q", parts)
+	}
+}
+
+func TestSMTPTransport_Send(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		var cmds []string
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmds = append(cmds, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case line == "DATA":
+				reply("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+				}
+				reply("250 queued")
+			case line == "QUIT":
+				reply("221 bye")
+				got <- cmds
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	tr := newSMTP(ln.Addr().String(), "", "")
+	if err := tr.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	cmds := <-got
+	joined := strings.Join(cmds, "\n")
+	if !strings.Contains(joined, "MAIL FROM:<noreply@example.com>") || !strings.Contains(joined, "RCPT TO:<owner@example.com>") {
+		t.Errorf("commands = %q", cmds)
+	}
+}
+
+func TestSendGridTransport_Send(t *testing.T) {
+	var body sendGridRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	tr := newSendGrid("sg-key")
+	tr.url = srv.URL
+	if err := tr.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if auth != "Bearer sg-key" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if body.From.Email != testMessage.From || body.Personalizations[0].To[0].Email != testMessage.To || len(body.Content) != 2 {
+		t.Errorf("body = %+v", body)
+	}
+	if body.Personalizations[0].CustomArgs["failureId"] != "f1" {
+		t.Errorf("body = %+v", body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	tr.url = failing.URL
+	if err := tr.Send(context.Background(), testMessage); err == nil {
+		t.Error("Send() error = nil for a 401 response")
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	ctx := context.Background()
+	for _, opts := range []Options{
+		{Provider: ProviderSMTP},
+		{Provider: ProviderSendGrid},
+		{Provider: "pigeon"},
+	} {
+		if _, err := NewTransport(ctx, opts); err == nil {
+			t.Errorf("NewTransport(%+v) error = nil", opts)
+		}
+	}
+	if tr, err := NewTransport(ctx, Options{Provider: ProviderSMTP, SMTPAddr: "localhost:25"}); err != nil || tr == nil {
+		t.Errorf("NewTransport(smtp) = %v, %v", tr, err)
+	}
+}
+
+func TestRenderFailure_Golden(t *testing.T) {
+	defer func(v, c, b string) {
+		buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = v, c, b
+	}(buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime)
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "v1.4.0", "3f2a9c1d0b7e44aa", "2024-03-15T10:30:00Z"
+
+	got, err := (*Templates)(nil).renderFailure(sampleData.FailureNotification)
+	if err != nil {
+		t.Fatalf("renderFailure() error = %v", err)
+	}
+
+	golden := filepath.Join("testdata", "failure.golden.html")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("rendered HTML differs from %s; run go test -update to accept\n%s", golden, got)
+	}
+}
+
+func TestRenderFailure_Escapes(t *testing.T) {
+	got, err := (*Templates)(nil).renderFailure(FailureNotification{
+		URL:               `https://api.example.com/?q=<script>alert(1)</script>`,
+		ContentMismatches: []string{`<img src=x onerror=alert(1)>`},
+	})
+	if err != nil {
+		t.Fatalf("renderFailure() error = %v", err)
+	}
+	if strings.Contains(got, "<script>") || strings.Contains(got, "<img") {
+		t.Errorf("rendered HTML contains unescaped input:\n%s", got)
+	}
+}
+
+// templateStore is an in-memory TemplateStore
+type templateStore map[string]string
+
+func (s templateStore) ListKeys(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for k := range s {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (s templateStore) GetObjectBytes(_ context.Context, key string) ([]byte, error) {
+	v, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", key)
+	}
+	return []byte(v), nil
+}
+
+func TestLoadTemplates(t *testing.T) {
+	ctx := context.Background()
+	tpl, err := LoadTemplates(ctx, templateStore{
+		"templates/myapp.html":       `<p>{{.Project}}/{{.Env}} {{.FailureID}}</p>`,
+		"templates/README.md":        `not a template`,
+		"templates/archive/old.html": `{{.Missing}}`,
+		"templates/otherapp.htm.bak": `{{`,
+		"elsewhere/ignoredapp.html":  `{{`,
+	})
+	if err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+	if tpl.Projects() != 1 {
+		t.Errorf("Projects() = %d, want 1", tpl.Projects())
+	}
+
+	got, err := tpl.renderFailure(FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod"})
+	if err != nil || got != "<p>myapp/prod f1</p>" {
+		t.Errorf("renderFailure(myapp) = %q, %v", got, err)
+	}
+	if got, _ := tpl.renderFailure(FailureNotification{FailureID: "f1", Project: "other"}); !strings.Contains(got, "Failed Request Captured") {
+		t.Errorf("renderFailure(other) did not use the default template:\n%s", got)
+	}
+
+	for name, src := range map[string]string{
+		"syntax":        `<p>{{.Project</p>`,
+		"unknown field": `<p>{{.Nope}}</p>`,
+	} {
+		if _, err := LoadTemplates(ctx, templateStore{"templates/myapp.html": src}); err == nil {
+			t.Errorf("%s: LoadTemplates() error = nil", name)
+		}
+	}
+}
+
+func TestSender_UsesProjectTemplate(t *testing.T) {
+	tpl, err := LoadTemplates(context.Background(), templateStore{"templates/myapp.html": `<b>{{.FailureID}}</b>`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &fakeTransport{}
+	s := (&Sender{transport: ft, from: "noreply@example.com", to: "owner@example.com"}).WithTemplates(tpl)
+
+	if err := s.SendFailureNotification(context.Background(), FailureNotification{FailureID: "f1", Project: "myapp"}); err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	if len(ft.sent) != 1 || ft.sent[0].HTML != "<b>f1</b>" {
+		t.Errorf("sent = %+v", ft.sent)
+	}
+}
@@ -0,0 +1,70 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/archive"
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// SendExpiryNotice emails a project the list of failures that are about to be deleted
+func (s *Sender) SendExpiryNotice(ctx context.Context, n archive.Notice) error {
+	expires := n.ExpiresOn.UTC().Format("2006-01-02")
+	subject := fmt.Sprintf("[%s] %d captured failures expire on %s", n.Project, len(n.Failures), expires)
+
+	var text, htm strings.Builder
+
+	fmt.Fprintf(&text, "The following failures for %s will be deleted on %s and become unreachable.\n", n.Project, expires)
+	text.WriteString("Restore or download anything you still need before then.\n\n")
+	for _, f := range n.Failures {
+		fmt.Fprintf(&text, "- %s [%s] %s\n", f.FailureID, f.Env, f.Prefix)
+	}
+	fmt.Fprintf(&text, "\n---\nThis is an automated notification from failure-uploader %s.\n", buildinfo.Get())
+
+	htm.WriteString(`<!DOCTYPE html>
+<html>
+<head><style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; }
+.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+.header { background: #ff9800; color: white; padding: 20px; border-radius: 8px 8px 0 0; }
+.content { background: #f9f9f9; padding: 20px; border-radius: 0 0 8px 8px; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 4px 8px; border-bottom: 1px solid #eee; vertical-align: top; font-size: 13px; }
+.footer { margin-top: 20px; font-size: 12px; color: #999; }
+</style></head>
+<body>
+<div class="container">
+<div class="header">
+`)
+	fmt.Fprintf(&htm, "<h2 style=\"margin:0;\">Failures Expiring: %s</h2>\n<p style=\"margin:5px 0 0 0;\">%d failures will be deleted on %s</p>\n</div>\n<div class=\"content\">\n<table>\n",
+		html.EscapeString(n.Project), len(n.Failures), expires)
+	for _, f := range n.Failures {
+		fmt.Fprintf(&htm, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(f.FailureID), html.EscapeString(f.Env), html.EscapeString(f.Prefix))
+	}
+	htm.WriteString(`</table>
+</div>
+`)
+	fmt.Fprintf(&htm, "<div class=\"footer\">This is an automated notification from failure-uploader %s.</div>\n", html.EscapeString(buildinfo.Get().String()))
+	htm.WriteString(`</div>
+</body>
+</html>`)
+
+	tags := map[string]string{"type": "expiry", "project": n.Project}
+	sent, err := s.send(ctx, "expiry", s.to, subject, text.String(), htm.String(), tags)
+	if err != nil {
+		metrics.EmailFailures.Inc("expiry")
+		logging.FromContext(ctx).Error().Err(err).Str("project", n.Project).Msg("failed to send expiry notice")
+		return err
+	}
+
+	if sent {
+		logging.FromContext(ctx).Info().Str("project", n.Project).Int("failures", len(n.Failures)).Str("to", s.to).Msg("expiry notice sent")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/quota"
+)
+
+// SendQuotaAlert emails that a project has used most of a daily quota
+func (s *Sender) SendQuotaAlert(ctx context.Context, a quota.Alert) error {
+	day := a.Day.UTC().Format("2006-01-02")
+	subject := fmt.Sprintf("[%s] %d%% of the daily failure quota used", a.Project, a.Percent)
+
+	var rows [][2]string
+	if a.Limit.Failures > 0 {
+		rows = append(rows, [2]string{"Failures", fmt.Sprintf("%d of %d", a.Used.Failures, a.Limit.Failures)})
+	}
+	if a.Limit.Bytes > 0 {
+		rows = append(rows, [2]string{"Upload bytes", fmt.Sprintf("%d of %d", a.Used.Bytes, a.Limit.Bytes)})
+	}
+
+	var text, htm strings.Builder
+
+	fmt.Fprintf(&text, "%s has used %d%% of its daily quota for %s (UTC).\n", a.Project, a.Percent, day)
+	text.WriteString("Once it is exhausted, upload tickets are rejected with 429 quota_exceeded until midnight UTC.\n\n")
+	for _, r := range rows {
+		fmt.Fprintf(&text, "%s: %s\n", r[0], r[1])
+	}
+	fmt.Fprintf(&text, "\n---\nThis is an automated notification from failure-uploader %s.\n", buildinfo.Get())
+
+	htm.WriteString(`<!DOCTYPE html>
+<html>
+<head><style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; }
+.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+.header { background: #ff9800; color: white; padding: 20px; border-radius: 8px 8px 0 0; }
+.content { background: #f9f9f9; padding: 20px; border-radius: 0 0 8px 8px; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 4px 8px; border-bottom: 1px solid #eee; vertical-align: top; font-size: 13px; }
+.footer { margin-top: 20px; font-size: 12px; color: #999; }
+</style></head>
+<body>
+<div class="container">
+<div class="header">
+`)
+	fmt.Fprintf(&htm, "<h2 style=\"margin:0;\">Quota Warning: %s</h2>\n<p style=\"margin:5px 0 0 0;\">%d%% of the daily quota for %s (UTC) used</p>\n</div>\n<div class=\"content\">\n",
+		html.EscapeString(a.Project), a.Percent, day)
+	htm.WriteString("<p>Once it is exhausted, upload tickets are rejected until midnight UTC.</p>\n<table>\n")
+	for _, r := range rows {
+		fmt.Fprintf(&htm, "<tr><td>%s</td><td>%s</td></tr>\n", r[0], r[1])
+	}
+	htm.WriteString(`</table>
+</div>
+`)
+	fmt.Fprintf(&htm, "<div class=\"footer\">This is an automated notification from failure-uploader %s.</div>\n", html.EscapeString(buildinfo.Get().String()))
+	htm.WriteString(`</div>
+</body>
+</html>`)
+
+	tags := map[string]string{"type": "quota", "project": a.Project}
+	sent, err := s.send(ctx, "quota", s.to, subject, text.String(), htm.String(), tags)
+	if err != nil {
+		metrics.EmailFailures.Inc("quota")
+		logging.FromContext(ctx).Error().Err(err).Str("project", a.Project).Msg("failed to send quota alert")
+		return err
+	}
+
+	if sent {
+		logging.FromContext(ctx).Info().Str("project", a.Project).Int("percent", a.Percent).Str("to", s.to).Msg("quota alert sent")
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// Notifier sends failure notifications; *Sender and routing.Dispatcher implement it
+type Notifier interface {
+	SendFailureNotification(ctx context.Context, notif FailureNotification) error
+}
+
+// Suppressions reports recipients that must not be emailed, e.g. after a hard bounce
+type Suppressions interface {
+	Suppressed(ctx context.Context, address string) (bool, error)
+}
+
+// Sender renders notification emails and delivers them through a Transport
+type Sender struct {
+	transport    Transport
+	from         string
+	to           string
+	suppressions Suppressions
+	templates    *Templates
+}
+
+// NewSender creates an email sender using the provider selected in opts
+func NewSender(ctx context.Context, opts Options) (*Sender, error) {
+	t, err := NewTransport(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sender{
+		transport: t,
+		from:      opts.From,
+		to:        opts.To,
+	}, nil
+}
+
+// WithSuppressions skips sending to recipients on the suppression list
+func (s *Sender) WithSuppressions(sup Suppressions) *Sender {
+	s.suppressions = sup
+	return s
+}
+
+// WithTemplates renders failure emails with per-project template overrides
+func (s *Sender) WithTemplates(t *Templates) *Sender {
+	s.templates = t
+	return s
+}
+
+// checker is implemented by transports that can verify they are able to send
+type checker interface {
+	Check(ctx context.Context, from string) error
+}
+
+// Check verifies the transport can deliver from the configured sender, for
+// readiness probes. Transports without a cheap check always pass.
+func (s *Sender) Check(ctx context.Context) error {
+	if c, ok := s.transport.(checker); ok {
+		return c.Check(ctx, s.from)
+	}
+	return nil
+}
+
+// FailureNotification contains data for the failure notification email
+type FailureNotification struct {
+	FailureID   string
+	Project     string
+	Env         string
+	Method      string
+	URL         string
+	AppVersion  string
+	Platform    string
+	EnvelopeURL string
+	// Critical marks failures sent on the priority lane
+	Critical bool
+	// Severity is the client-declared info, warning, error or critical (optional)
+	Severity string
+	// Tags and Description are the client's triage labels and the user's
+	// report (optional)
+	Tags        map[string]string
+	Description string
+	// TraceID, SpanID and RequestID correlate the failure with APM traces and
+	// server logs (optional)
+	TraceID   string
+	SpanID    string
+	RequestID string
+	// Tenant selects the tenant's notification routes; empty for none
+	Tenant string
+
+	// StatusCode, DurationMs, ErrorClass and ErrorMessage describe how the
+	// request failed; StatusCode is 0 when no response was received
+	StatusCode   int
+	DurationMs   int64
+	ErrorClass   string
+	ErrorMessage string
+
+	// To overrides the configured recipient, e.g. with a project's routed addresses
+	To []string
+
+	// Curl is a command reproducing the request, with sensitive values redacted (optional)
+	Curl string
+
+	// AckURL is a signed link that acknowledges the failure when opened (optional)
+	AckURL string
+	// ContentMismatches describes artifacts whose bytes contradict their declared type
+	ContentMismatches []string
+	// ScanStatus is "pending" or "quarantined" while the malware scan withholds
+	// the failure's attachments; EnvelopeURL is empty then
+	ScanStatus string
+	// ThumbnailURL previews the failure's first image attachment, typically the
+	// screenshot; it does not resolve until the thumbnail worker has stored it
+	ThumbnailURL string
+
+	// GroupID is the failure's group (fingerprint) and Occurrences its count
+	// including this failure; both are empty when grouping failed
+	GroupID     string
+	Occurrences int
+
+	// Suppressed is how many identical failures were throttled since SuppressedSince
+	Suppressed      int
+	SuppressedSince time.Time
+}
+
+// ScanNotice explains why download links are withheld, or is empty when they
+// are not
+func (n FailureNotification) ScanNotice() string {
+	switch n.ScanStatus {
+	case "":
+		return ""
+	case "quarantined":
+		return "Withheld: the malware scan quarantined an attachment. An admin must release it before it can be downloaded."
+	default:
+		return "Withheld until the malware scan clears the attachments."
+	}
+}
+
+// maxSubjectOutcome bounds the failure outcome appended to email subjects
+const maxSubjectOutcome = 80
+
+// Outcome summarizes why the request failed, e.g. "HTTP 503: Service Unavailable"
+// or "timeout". It is empty when the client reported neither.
+func (n FailureNotification) Outcome() string {
+	var parts []string
+	if n.StatusCode > 0 {
+		parts = append(parts, fmt.Sprintf("HTTP %d", n.StatusCode))
+	}
+	if n.ErrorMessage != "" {
+		parts = append(parts, n.ErrorMessage)
+	} else if n.ErrorClass != "" {
+		parts = append(parts, n.ErrorClass)
+	}
+	return strings.Join(parts, ": ")
+}
+
+// TagList returns the tags as sorted key=value pairs
+func (n FailureNotification) TagList() []string {
+	list := make([]string, 0, len(n.Tags))
+	for k, v := range n.Tags {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// SendFailureNotification sends an email notification about a completed failure upload
+func (s *Sender) SendFailureNotification(ctx context.Context, notif FailureNotification) error {
+	subject := fmt.Sprintf("[%s/%s] Failed Request Captured: %s", notif.Project, notif.Env, notif.FailureID)
+	if outcome := strings.Join(strings.Fields(notif.Outcome()), " "); outcome != "" {
+		if r := []rune(outcome); len(r) > maxSubjectOutcome {
+			outcome = string(r[:maxSubjectOutcome-3]) + "..."
+		}
+		subject += " (" + outcome + ")"
+	}
+	if notif.Critical {
+		subject = "[CRITICAL] " + subject
+	}
+
+	failure := ""
+	if notif.TraceID != "" {
+		failure += fmt.Sprintf("- Trace ID: %s\n", notif.TraceID)
+	}
+	if notif.SpanID != "" {
+		failure += fmt.Sprintf("- Span ID: %s\n", notif.SpanID)
+	}
+	if notif.RequestID != "" {
+		failure += fmt.Sprintf("- Request ID: %s\n", notif.RequestID)
+	}
+	if notif.StatusCode > 0 {
+		failure += fmt.Sprintf("- Status: %d\n", notif.StatusCode)
+	}
+	if notif.DurationMs > 0 {
+		failure += fmt.Sprintf("- Duration: %d ms\n", notif.DurationMs)
+	}
+	if notif.ErrorClass != "" {
+		failure += fmt.Sprintf("- Error class: %s\n", notif.ErrorClass)
+	}
+	if notif.ErrorMessage != "" {
+		failure += fmt.Sprintf("- Error: %s\n", notif.ErrorMessage)
+	}
+
+	triage := ""
+	if notif.Severity != "" {
+		triage += fmt.Sprintf("Severity: %s\n", notif.Severity)
+	}
+	if len(notif.Tags) > 0 {
+		triage += fmt.Sprintf("Tags: %s\n", strings.Join(notif.TagList(), ", "))
+	}
+	if notif.Description != "" {
+		triage += "\nDescription:\n" + notif.Description + "\n"
+	}
+
+	repeats := ""
+	if notif.Suppressed > 0 {
+		repeats = fmt.Sprintf("\nThis failure also occurred %d more time(s) since %s (notifications suppressed).\n",
+			notif.Suppressed, notif.SuppressedSince.UTC().Format(time.RFC3339))
+	}
+
+	reproduce := ""
+	if notif.Curl != "" {
+		reproduce = "\nReproduce:\n" + notif.Curl + "\n"
+	}
+
+	ack := ""
+	if notif.AckURL != "" {
+		ack = "\nAcknowledge:\n" + notif.AckURL + "\n"
+	}
+
+	mismatches := ""
+	if len(notif.ContentMismatches) > 0 {
+		mismatches = "\nWARNING: artifact content does not match its declared type:\n- " + strings.Join(notif.ContentMismatches, "\n- ") + "\n"
+	}
+
+	thumbnail := ""
+	if notif.ThumbnailURL != "" {
+		thumbnail = "\nScreenshot thumbnail:\n" + notif.ThumbnailURL + "\n"
+	}
+
+	download := notif.EnvelopeURL
+	if notice := notif.ScanNotice(); notice != "" {
+		download = notice
+	}
+
+	body := fmt.Sprintf(`A failed network request has been captured and uploaded.
+
+Failure ID: %s
+Project: %s
+Environment: %s
+%s%s%s
+Request Details:
+- Method: %s
+- URL: %s
+%s
+Client:
+- App Version: %s
+- Platform: %s
+
+Download envelope:
+%s
+%s%s%s
+---
+This is an automated notification from failure-uploader %s.
+`,
+		notif.FailureID,
+		notif.Project,
+		notif.Env,
+		triage,
+		repeats,
+		mismatches,
+		notif.Method,
+		notif.URL,
+		failure,
+		notif.AppVersion,
+		notif.Platform,
+		download,
+		thumbnail,
+		reproduce,
+		ack,
+		buildinfo.Get(),
+	)
+
+	htmlBody, err := s.templates.renderFailure(notif)
+	if err != nil {
+		metrics.EmailFailures.Inc("failure")
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", notif.FailureID).Msg("failed to render email notification")
+		return err
+	}
+
+	recipients := notif.To
+	if len(recipients) == 0 {
+		recipients = []string{s.to}
+	}
+
+	tags := map[string]string{"type": "failure", "project": notif.Project, "env": notif.Env, "failureId": notif.FailureID}
+	var errs []error
+	for _, to := range recipients {
+		sent, err := s.send(ctx, "failure", to, subject, body, htmlBody, tags)
+		if err != nil {
+			metrics.EmailFailures.Inc("failure")
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", notif.FailureID).Str("to", to).Msg("failed to send email notification")
+			errs = append(errs, err)
+			continue
+		}
+		if sent {
+			logging.FromContext(ctx).Info().Str("failureId", notif.FailureID).Str("to", to).Msg("email notification sent")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send delivers a multipart text/HTML email to one recipient. It reports
+// false without an error when the recipient is suppressed; a failed
+// suppression lookup does not stop the email.
+func (s *Sender) send(ctx context.Context, kind, to, subject, textBody, htmlBody string, tags map[string]string) (bool, error) {
+	if s.suppressions != nil {
+		suppressed, err := s.suppressions.Suppressed(ctx, to)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Msg("failed to check email suppression list")
+		} else if suppressed {
+			metrics.EmailsSuppressed.Inc(kind)
+			logging.FromContext(ctx).Warn().Str("to", to).Str("kind", kind).Msg("recipient suppressed after bounce or complaint - email not sent")
+			return false, nil
+		}
+	}
+
+	err := s.transport.Send(ctx, Message{
+		From:    s.from,
+		To:      to,
+		Subject: subject,
+		Text:    textBody,
+		HTML:    htmlBody,
+		Tags:    tags,
+	})
+	return err == nil, err
+}
@@ -0,0 +1,81 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sendGridURL is the SendGrid v3 mail send endpoint
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// sendGridTransport delivers email through the SendGrid HTTP API
+type sendGridTransport struct {
+	apiKey string
+	url    string
+	client *http.Client
+}
+
+func newSendGrid(apiKey string) *sendGridTransport {
+	return &sendGridTransport{apiKey: apiKey, url: sendGridURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+	// CustomArgs are echoed in SendGrid event webhooks, like SES message tags
+	CustomArgs map[string]string `json:"custom_args,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sendGridRequest is the body of a mail send call
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+// Send posts m to the SendGrid mail send API
+func (t *sendGridTransport) Send(ctx context.Context, m Message) error {
+	b, err := json.Marshal(sendGridRequest{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: m.To}}, CustomArgs: m.Tags}},
+		From:             sendGridAddress{Email: m.From},
+		Subject:          m.Subject,
+		Content: []sendGridContent{
+			{Type: "text/plain", Value: m.Text},
+			{Type: "text/html", Value: m.HTML},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sendgrid returned %s", resp.Status)
+	}
+	return nil
+}
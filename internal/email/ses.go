@@ -2,159 +2,131 @@ package email
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ses"
-	"github.com/aws/aws-sdk-go-v2/service/ses/types"
-	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/yourorg/failure-uploader/internal/awscall"
+	"github.com/yourorg/failure-uploader/internal/requestid"
 )
 
-// Sender handles email sending via SES
-type Sender struct {
-	client *ses.Client
-	from   string
-	to     string
+// sesTagUnsafe matches characters SES does not allow in message tag names and values
+var sesTagUnsafe = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+
+// sesTransport delivers email via the Amazon SES v2 API
+type sesTransport struct {
+	client           *sesv2.Client
+	configurationSet string
 }
 
-// NewSender creates a new SES email sender
-func NewSender(ctx context.Context, region, from, to string) (*Sender, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+func newSES(ctx context.Context, region, configurationSet string, policy awscall.Policy) (*sesTransport, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, append([]func(*config.LoadOptions) error{
+		config.WithRegion(region),
+		config.WithAPIOptions([]func(*middleware.Stack) error{requestid.APIOption}),
+	}, policy.LoadOptions()...)...)
 	if err != nil {
 		return nil, err
 	}
-
-	client := ses.NewFromConfig(cfg)
-
-	return &Sender{
-		client: client,
-		from:   from,
-		to:     to,
-	}, nil
+	return &sesTransport{client: sesv2.NewFromConfig(cfg), configurationSet: configurationSet}, nil
 }
 
-// FailureNotification contains data for the failure notification email
-type FailureNotification struct {
-	FailureID   string
-	Project     string
-	Env         string
-	Method      string
-	URL         string
-	AppVersion  string
-	Platform    string
-	EnvelopeURL string
-}
-
-// SendFailureNotification sends an email notification about a completed failure upload
-func (s *Sender) SendFailureNotification(ctx context.Context, notif FailureNotification) error {
-	subject := fmt.Sprintf("[%s/%s] Failed Request Captured: %s", notif.Project, notif.Env, notif.FailureID)
-
-	body := fmt.Sprintf(`A failed network request has been captured and uploaded.
-
-Failure ID: %s
-Project: %s
-Environment: %s
-
-Request Details:
-- Method: %s
-- URL: %s
-
-Client:
-- App Version: %s
-- Platform: %s
-
-Download envelope:
-%s
-
----
-This is an automated notification from failure-uploader.
-`,
-		notif.FailureID,
-		notif.Project,
-		notif.Env,
-		notif.Method,
-		notif.URL,
-		notif.AppVersion,
-		notif.Platform,
-		notif.EnvelopeURL,
-	)
-
-	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
-<html>
-<head><style>
-body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; }
-.container { max-width: 600px; margin: 0 auto; padding: 20px; }
-.header { background: #f44336; color: white; padding: 20px; border-radius: 8px 8px 0 0; }
-.content { background: #f9f9f9; padding: 20px; border-radius: 0 0 8px 8px; }
-.field { margin-bottom: 10px; }
-.label { font-weight: bold; color: #666; }
-.value { color: #333; }
-.button { display: inline-block; background: #2196F3; color: white; padding: 12px 24px; text-decoration: none; border-radius: 4px; margin-top: 15px; }
-.footer { margin-top: 20px; font-size: 12px; color: #999; }
-</style></head>
-<body>
-<div class="container">
-<div class="header">
-<h2 style="margin:0;">Failed Request Captured</h2>
-<p style="margin:5px 0 0 0;">%s / %s</p>
-</div>
-<div class="content">
-<div class="field"><span class="label">Failure ID:</span> <span class="value">%s</span></div>
-<div class="field"><span class="label">Project:</span> <span class="value">%s</span></div>
-<div class="field"><span class="label">Environment:</span> <span class="value">%s</span></div>
-<h3>Request Details</h3>
-<div class="field"><span class="label">Method:</span> <span class="value">%s</span></div>
-<div class="field"><span class="label">URL:</span> <span class="value">%s</span></div>
-<h3>Client</h3>
-<div class="field"><span class="label">App Version:</span> <span class="value">%s</span></div>
-<div class="field"><span class="label">Platform:</span> <span class="value">%s</span></div>
-<a href="%s" class="button">Download Envelope</a>
-</div>
-<div class="footer">This is an automated notification from failure-uploader.</div>
-</div>
-</body>
-</html>`,
-		notif.Project, notif.Env,
-		notif.FailureID,
-		notif.Project,
-		notif.Env,
-		notif.Method,
-		notif.URL,
-		notif.AppVersion,
-		notif.Platform,
-		notif.EnvelopeURL,
-	)
-
-	input := &ses.SendEmailInput{
-		Source: aws.String(s.from),
+// Send delivers m with SES SendEmail, tagged so bounce and complaint events
+// can be traced back to the failure and to the request that sent it
+func (t *sesTransport) Send(ctx context.Context, m Message) error {
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(m.From),
 		Destination: &types.Destination{
-			ToAddresses: []string{s.to},
+			ToAddresses: []string{m.To},
 		},
-		Message: &types.Message{
-			Subject: &types.Content{
-				Data:    aws.String(subject),
-				Charset: aws.String("UTF-8"),
-			},
-			Body: &types.Body{
-				Text: &types.Content{
-					Data:    aws.String(body),
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{
+					Data:    aws.String(m.Subject),
 					Charset: aws.String("UTF-8"),
 				},
-				Html: &types.Content{
-					Data:    aws.String(htmlBody),
-					Charset: aws.String("UTF-8"),
+				Body: &types.Body{
+					Text: &types.Content{
+						Data:    aws.String(m.Text),
+						Charset: aws.String("UTF-8"),
+					},
+					Html: &types.Content{
+						Data:    aws.String(m.HTML),
+						Charset: aws.String("UTF-8"),
+					},
 				},
 			},
 		},
+		EmailTags: sesTags(m.Tags),
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		input.EmailTags = append(input.EmailTags, sesTags(map[string]string{"request_id": id})...)
+	}
+	if t.configurationSet != "" {
+		input.ConfigurationSetName = aws.String(t.configurationSet)
 	}
 
-	_, err := s.client.SendEmail(ctx, input)
+	_, err := t.client.SendEmail(ctx, input)
+	return err
+}
+
+// Check verifies that the account may send, has quota left for the last 24
+// hours, and that from (or its domain) is a verified identity
+func (t *sesTransport) Check(ctx context.Context, from string) error {
+	account, err := t.client.GetAccount(ctx, &sesv2.GetAccountInput{})
 	if err != nil {
-		logging.Error().Err(err).Str("failureId", notif.FailureID).Msg("failed to send email notification")
-		return err
+		return fmt.Errorf("get account: %w", err)
+	}
+	if !account.SendingEnabled {
+		return errors.New("sending is disabled for the account")
+	}
+	if q := account.SendQuota; q != nil && q.Max24HourSend > 0 && q.SentLast24Hours >= q.Max24HourSend {
+		return fmt.Errorf("daily sending quota of %.0f exhausted", q.Max24HourSend)
 	}
 
-	logging.Info().Str("failureId", notif.FailureID).Str("to", s.to).Msg("email notification sent")
-	return nil
+	addr := from
+	if a, err := mail.ParseAddress(from); err == nil {
+		addr = a.Address
+	}
+	identities := []string{addr}
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		identities = append(identities, addr[i+1:])
+	}
+	for _, identity := range identities {
+		out, err := t.client.GetEmailIdentity(ctx, &sesv2.GetEmailIdentityInput{EmailIdentity: aws.String(identity)})
+		var nf *types.NotFoundException
+		if errors.As(err, &nf) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("get identity %s: %w", identity, err)
+		}
+		if !out.VerifiedForSendingStatus {
+			return fmt.Errorf("identity %s is not verified for sending", identity)
+		}
+		return nil
+	}
+	return fmt.Errorf("no SES identity for %s", addr)
+}
+
+// sesTags converts tags to SES message tags, replacing disallowed characters
+// and dropping empty values
+func sesTags(tags map[string]string) []types.MessageTag {
+	var out []types.MessageTag
+	for name, value := range tags {
+		if value == "" {
+			continue
+		}
+		out = append(out, types.MessageTag{
+			Name:  aws.String(sesTagUnsafe.ReplaceAllString(name, "_")),
+			Value: aws.String(sesTagUnsafe.ReplaceAllString(value, "_")),
+		})
+	}
+	return out
 }
@@ -0,0 +1,155 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// TemplatePrefix is where per-project templates live in the config bucket.
+// Format: templates/{project}.html
+const TemplatePrefix = "templates/"
+
+//go:embed templates/failure.html
+var defaultFailureHTML string
+
+// defaultFailureTemplate renders failure emails for projects without their own template
+var defaultFailureTemplate = template.Must(ParseTemplate("failure", defaultFailureHTML))
+
+// TemplateData is passed to failure email templates. Templates may use every
+// FailureNotification field and method, e.g. {{.FailureID}}, {{.Outcome}} or
+// {{range .ContentMismatches}}.
+type TemplateData struct {
+	FailureNotification
+	// SuppressedSinceText is SuppressedSince in RFC 3339, set when Suppressed > 0
+	SuppressedSinceText string
+	// Build identifies the service build that sent the email, for the footer
+	Build string
+}
+
+func newTemplateData(notif FailureNotification) TemplateData {
+	d := TemplateData{FailureNotification: notif, Build: buildinfo.Get().String()}
+	if notif.Suppressed > 0 {
+		d.SuppressedSinceText = notif.SuppressedSince.UTC().Format(time.RFC3339)
+	}
+	return d
+}
+
+// sampleData exercises every optional section of a template during validation
+var sampleData = newTemplateData(FailureNotification{
+	FailureID:         "00000000-0000-0000-0000-000000000000",
+	Project:           "myapp",
+	Env:               "prod",
+	Method:            "POST",
+	URL:               "https://api.example.com/v1/orders",
+	AppVersion:        "1.2.3",
+	Platform:          "ios",
+	EnvelopeURL:       "https://example.com/envelope.json",
+	Critical:          true,
+	Severity:          "critical",
+	Tags:              map[string]string{"team": "payments", "flow": "checkout"},
+	Description:       "Checkout spun forever after tapping Pay.",
+	TraceID:           "4bf92f3577b34da6a3ce929d0e0e4736",
+	SpanID:            "00f067aa0ba902b7",
+	RequestID:         "req-7f3a9c",
+	StatusCode:        503,
+	DurationMs:        1200,
+	ErrorClass:        "server_error",
+	ErrorMessage:      "Service Unavailable",
+	Curl:              "curl -X POST 'https://api.example.com/v1/orders' \\\n  -H 'Authorization: [REDACTED]'",
+	AckURL:            "https://api.example.com/ack/00000000-0000-0000-0000-000000000000?expires=1710500400&sig=0f3c",
+	ContentMismatches: []string{"files/log.txt declared text/plain, detected application/zip"},
+	ThumbnailURL:      "https://example.com/thumbs/screenshot.png.png",
+	Suppressed:        3,
+	SuppressedSince:   time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC),
+})
+
+// ParseTemplate parses an HTML failure email template and validates it by
+// rendering sample data, so unknown fields fail at startup rather than on send
+func ParseTemplate(name, src string) (*template.Template, error) {
+	t, err := template.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse email template %s: %w", name, err)
+	}
+	if err := t.Execute(&bytes.Buffer{}, sampleData); err != nil {
+		return nil, fmt.Errorf("validate email template %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// TemplateStore is the subset of S3 operations needed to load templates
+type TemplateStore interface {
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+}
+
+// Templates holds per-project overrides of the failure email HTML
+type Templates struct {
+	byProject map[string]*template.Template
+}
+
+// LoadTemplates reads and validates every templates/{project}.html in store.
+// Any invalid template is an error so a broken override is caught at startup.
+func LoadTemplates(ctx context.Context, store TemplateStore) (*Templates, error) {
+	keys, err := store.ListKeys(ctx, TemplatePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list email templates: %w", err)
+	}
+
+	t := &Templates{byProject: make(map[string]*template.Template)}
+	for _, key := range keys {
+		name := path.Base(key)
+		if path.Dir(key)+"/" != TemplatePrefix || !strings.HasSuffix(name, ".html") {
+			continue
+		}
+		b, err := store.GetObjectBytes(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("read email template %s: %w", key, err)
+		}
+		tmpl, err := ParseTemplate(key, string(b))
+		if err != nil {
+			return nil, err
+		}
+		t.byProject[strings.TrimSuffix(name, ".html")] = tmpl
+	}
+	return t, nil
+}
+
+// Projects returns the number of projects with their own template
+func (t *Templates) Projects() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.byProject)
+}
+
+// renderFailure renders the failure email HTML with the project's template.
+// The default template is used for other projects and when the override fails.
+func (t *Templates) renderFailure(notif FailureNotification) (string, error) {
+	data := newTemplateData(notif)
+
+	var buf bytes.Buffer
+	if t != nil {
+		if tmpl, ok := t.byProject[notif.Project]; ok {
+			err := tmpl.Execute(&buf, data)
+			if err == nil {
+				return buf.String(), nil
+			}
+			logging.Warn().Err(err).Str("project", notif.Project).Msg("failed to render project email template - using default")
+			buf.Reset()
+		}
+	}
+
+	if err := defaultFailureTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render email template: %w", err)
+	}
+	return buf.String(), nil
+}
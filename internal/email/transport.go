@@ -0,0 +1,74 @@
+package email
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yourorg/failure-uploader/internal/awscall"
+)
+
+// Provider names accepted in Options.Provider
+const (
+	ProviderSES      = "ses"
+	ProviderSMTP     = "smtp"
+	ProviderSendGrid = "sendgrid"
+)
+
+// Message is a rendered email with text and HTML alternatives
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Tags label the message for delivery events, e.g. project and failureId
+	Tags map[string]string
+}
+
+// Transport delivers rendered emails through a provider
+type Transport interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Options selects and configures the email provider
+type Options struct {
+	// Provider is ses, smtp or sendgrid; empty means ses
+	Provider string
+	From     string
+	To       string
+
+	// Region is the SES region
+	Region string
+	// ConfigurationSet is the SES configuration set whose event destinations
+	// publish bounces and complaints
+	ConfigurationSet string
+	// Policy bounds SES calls with a timeout, retries and a circuit breaker
+	Policy awscall.Policy
+
+	// SMTPAddr is the host:port of an SMTP server; STARTTLS is used when offered
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+
+	SendGridAPIKey string
+}
+
+// NewTransport creates the transport for opts.Provider
+func NewTransport(ctx context.Context, opts Options) (Transport, error) {
+	switch opts.Provider {
+	case "", ProviderSES:
+		return newSES(ctx, opts.Region, opts.ConfigurationSet, opts.Policy)
+	case ProviderSMTP:
+		if opts.SMTPAddr == "" {
+			return nil, fmt.Errorf("email provider smtp requires an SMTP address")
+		}
+		return newSMTP(opts.SMTPAddr, opts.SMTPUsername, opts.SMTPPassword), nil
+	case ProviderSendGrid:
+		if opts.SendGridAPIKey == "" {
+			return nil, fmt.Errorf("email provider sendgrid requires an API key")
+		}
+		return newSendGrid(opts.SendGridAPIKey), nil
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", opts.Provider)
+	}
+}
@@ -0,0 +1,93 @@
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// ErrUnsupportedVersion is returned in strict mode for envelopes of a schema
+// version newer than the service knows
+var ErrUnsupportedVersion = errors.New("unsupported envelope schema version")
+
+// upgrades[v] rewrites a version v envelope, decoded as a JSON object, into
+// version v+1. Every version below SchemaVersion needs one, so envelopes
+// written by older SDKs are read as the current version.
+var upgrades = map[int]func(doc map[string]json.RawMessage, prefix string) error{
+	0: upgradeUnversioned,
+}
+
+// upgradeUnversioned upgrades the envelopes SDKs wrote before schemaVersion
+// existed. Their fields match version 1, but s3Prefix and createdAt were never
+// required, so the prefix is filled in from the envelope's location.
+func upgradeUnversioned(doc map[string]json.RawMessage, prefix string) error {
+	var s3Prefix string
+	if raw, ok := doc["s3Prefix"]; ok {
+		if err := json.Unmarshal(raw, &s3Prefix); err != nil {
+			return fmt.Errorf("s3Prefix: %w", err)
+		}
+	}
+	if s3Prefix == "" && prefix != "" {
+		doc["s3Prefix"], _ = json.Marshal(prefix)
+	}
+	return nil
+}
+
+// Version returns the schema version of the envelope in b: 0 for envelopes
+// written before versioning
+func Version(b []byte) (int, error) {
+	var probe struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return 0, err
+	}
+	if probe.SchemaVersion < 0 {
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, probe.SchemaVersion)
+	}
+	return probe.SchemaVersion, nil
+}
+
+// Decode parses the envelope stored under prefix, upgrading older schema
+// versions to SchemaVersion. Newer versions are rejected with
+// ErrUnsupportedVersion when strict is set; otherwise the fields the service
+// knows are read and the rest ignored, keeping the newer version number.
+func Decode(b []byte, prefix string, strict bool) (*models.Envelope, error) {
+	version, err := Version(b)
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion && strict {
+		return nil, fmt.Errorf("%w: %d (newest supported is %d)", ErrUnsupportedVersion, version, SchemaVersion)
+	}
+
+	if version < SchemaVersion {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		for v := version; v < SchemaVersion; v++ {
+			if err := upgrades[v](doc, prefix); err != nil {
+				return nil, fmt.Errorf("upgrade envelope from version %d: %w", v, err)
+			}
+		}
+		doc["schemaVersion"], _ = json.Marshal(SchemaVersion)
+		if b, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var env models.Envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// Supported reports whether clients may send requests of schema version v: 0
+// (unversioned) through SchemaVersion, or any version unless strict is set
+func Supported(v int, strict bool) bool {
+	return v >= 0 && (v <= SchemaVersion || !strict)
+}
@@ -0,0 +1,89 @@
+package envelope
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpgradesCoverEveryVersion(t *testing.T) {
+	for v := 0; v < SchemaVersion; v++ {
+		if upgrades[v] == nil {
+			t.Errorf("no upgrade from version %d", v)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	const prefix = "failures/myapp/prod/2024/03/15/abc-123/"
+	tests := []struct {
+		name       string
+		body       string
+		strict     bool
+		wantPrefix string
+		wantVer    int
+		wantErr    error
+	}{
+		{
+			name:       "unversioned",
+			body:       `{"failureId":"abc-123","request":{"method":"POST","url":"https://api.example.com"}}`,
+			wantPrefix: prefix,
+			wantVer:    SchemaVersion,
+		},
+		{
+			name:       "unversioned keeps its prefix",
+			body:       `{"s3Prefix":"failures/other/","request":{"method":"POST"}}`,
+			wantPrefix: "failures/other/",
+			wantVer:    SchemaVersion,
+		},
+		{
+			name:       "current",
+			body:       `{"schemaVersion":1,"s3Prefix":"failures/x/"}`,
+			wantPrefix: "failures/x/",
+			wantVer:    SchemaVersion,
+		},
+		{
+			name:       "newer read leniently",
+			body:       `{"schemaVersion":99,"s3Prefix":"failures/x/","futureField":true}`,
+			wantPrefix: "failures/x/",
+			wantVer:    99,
+		},
+		{name: "newer in strict mode", body: `{"schemaVersion":99}`, strict: true, wantErr: ErrUnsupportedVersion},
+		{name: "negative", body: `{"schemaVersion":-1}`, wantErr: ErrUnsupportedVersion},
+		{name: "not json", body: `nope`, wantErr: errors.New("any")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := Decode([]byte(tt.body), prefix, tt.strict)
+			if tt.wantErr != nil {
+				if err == nil || (errors.Is(tt.wantErr, ErrUnsupportedVersion) && !errors.Is(err, ErrUnsupportedVersion)) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if env.S3Prefix != tt.wantPrefix || env.SchemaVersion != tt.wantVer {
+				t.Errorf("Decode() = prefix %q, version %d; want %q, %d", env.S3Prefix, env.SchemaVersion, tt.wantPrefix, tt.wantVer)
+			}
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for _, tt := range []struct {
+		v      int
+		strict bool
+		want   bool
+	}{
+		{0, true, true},
+		{SchemaVersion, true, true},
+		{SchemaVersion + 1, true, false},
+		{SchemaVersion + 1, false, true},
+		{-1, false, false},
+	} {
+		if got := Supported(tt.v, tt.strict); got != tt.want {
+			t.Errorf("Supported(%d, %v) = %v, want %v", tt.v, tt.strict, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package envelope
+
+import (
+	"errors"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+// SchemaVersion is the version of the envelopes the service generates. Bump it
+// when a field is removed or changes meaning; new optional fields keep it.
+const SchemaVersion = 1
+
+// Name is the object name of the envelope under a failure's prefix
+const Name = "envelope.json"
+
+// ErrNoMetadata is returned for tickets issued before they recorded request metadata
+var ErrNoMetadata = errors.New("ticket has no request metadata")
+
+// Generate builds the canonical envelope of a completed upload from its ticket
+// and the completion payload. The completion's response, when set, replaces the
+// one sent with the ticket.
+func Generate(rec *tickets.Record, req *models.UploadCompleteRequest) (*models.Envelope, error) {
+	if rec.Request == nil {
+		return nil, ErrNoMetadata
+	}
+
+	env := &models.Envelope{
+		SchemaVersion: SchemaVersion,
+		FailureID:     rec.FailureID,
+		Project:       rec.Project,
+		Env:           rec.Env,
+		Request:       *rec.Request,
+		Response:      rec.Response,
+		CreatedAt:     rec.IssuedAt,
+		S3Prefix:      rec.S3Prefix,
+		Severity:      rec.Severity,
+		Tags:          rec.Tags,
+		Description:   rec.Description,
+		Encryption:    req.Encryption,
+	}
+	if rec.Client != nil {
+		env.Client = *rec.Client
+	}
+	env.Client.UserID = rec.UserHash
+	if req.Response != nil {
+		env.Response = req.Response
+	}
+	return env, nil
+}
+
+// Key returns the envelope key under prefix
+func Key(prefix string) string {
+	return prefix + Name
+}
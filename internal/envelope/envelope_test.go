@@ -0,0 +1,51 @@
+package envelope
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+func TestGenerate(t *testing.T) {
+	issued := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	rec := &tickets.Record{
+		FailureID: "abc-123",
+		Project:   "myapp",
+		Env:       "prod",
+		S3Prefix:  "failures/myapp/prod/2024/03/15/abc-123/",
+		IssuedAt:  issued,
+		UserHash:  "sha256:abcd",
+		Request:   &models.RequestInfo{Method: "POST", URL: "https://api.example.com/v1/orders", BodyBytes: 42},
+		Client:    &models.ClientInfo{AppVersion: "1.2.3", Platform: "ios"},
+		Response:  &models.ResponseInfo{StatusCode: 500},
+		Severity:  "critical",
+	}
+	enc := &models.Encryption{Algorithm: "AES-256-GCM", KeyID: "k1", IV: "AAAAAAAAAAA="}
+
+	env, err := Generate(rec, &models.UploadCompleteRequest{Encryption: enc})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if env.SchemaVersion != SchemaVersion || env.FailureID != "abc-123" || env.S3Prefix != rec.S3Prefix || !env.CreatedAt.Equal(issued) {
+		t.Errorf("Generate() = %+v", env)
+	}
+	if env.Request.URL != rec.Request.URL || env.Client.Platform != "ios" || env.Client.UserID != "sha256:abcd" {
+		t.Errorf("request/client = %+v / %+v", env.Request, env.Client)
+	}
+	if env.Response.StatusCode != 500 || env.Encryption != enc || env.Severity != "critical" {
+		t.Errorf("response/encryption = %+v / %+v", env.Response, env.Encryption)
+	}
+
+	// The completion's response wins over the ticket's
+	env, _ = Generate(rec, &models.UploadCompleteRequest{Response: &models.ResponseInfo{StatusCode: 504, DurationMs: 30000}})
+	if env.Response.StatusCode != 504 {
+		t.Errorf("response = %+v, want the completion's", env.Response)
+	}
+
+	if _, err := Generate(&tickets.Record{FailureID: "old"}, &models.UploadCompleteRequest{}); !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("Generate() without metadata error = %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package erasure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/ack"
+	"github.com/yourorg/failure-uploader/internal/digest"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/links"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/scan"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+// AuditPrefix is the S3 prefix under which erasure audit records are stored
+const AuditPrefix = "audit/erasures/"
+
+// Store is the subset of S3 operations erasure needs
+type Store interface {
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	ObjectSizes(ctx context.Context, keys []string) (map[string]int64, error)
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	DeleteObjects(ctx context.Context, keys []string) error
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+}
+
+// Request identifies the failure to erase and who asked for it
+type Request struct {
+	FailureID string
+	Project   string
+	Env       string
+	Prefix    string
+	Principal string
+	// UserHash is the failure's hashed user ID; when empty it is read from the envelope
+	UserHash string
+}
+
+// Record is the audit record of an erasure. It names the failure but holds
+// none of its content.
+type Record struct {
+	FailureID string    `json:"failureId"`
+	Project   string    `json:"project"`
+	Env       string    `json:"env"`
+	Prefix    string    `json:"prefix"`
+	DeletedBy string    `json:"deletedBy"`
+	DeletedAt time.Time `json:"deletedAt"`
+	UserHash  string    `json:"userHash,omitempty"`
+	// Objects is the number of captured objects deleted
+	Objects int `json:"objects"`
+	// Bytes is the size of the deleted objects, 0 when it could not be read
+	Bytes int64 `json:"bytes"`
+	// Records lists the index records deleted along with the failure
+	Records []string `json:"records"`
+}
+
+// AuditKey returns the audit record key
+// Format: audit/erasures/{failureId}.json
+func AuditKey(failureID string) string {
+	return AuditPrefix + failureID + ".json"
+}
+
+// Erase deletes every object under the failure's prefix, their quarantined
+// copies, and its ticket, link, acknowledgment, digest and scan records, then
+// writes an audit record. Erasing
+// a failure that has nothing left returns a record with no deletions and
+// writes no audit.
+func Erase(ctx context.Context, store Store, req Request, now time.Time) (*Record, error) {
+	loc, ok := keys.Parse(req.Prefix + "envelope.json")
+	if !ok || loc.Prefix != req.Prefix || loc.FailureID != req.FailureID {
+		return nil, fmt.Errorf("refusing to erase prefix %q", req.Prefix)
+	}
+
+	objKeys, err := store.ListKeys(ctx, req.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", req.Prefix, err)
+	}
+	quarantined, err := store.ListKeys(ctx, scan.QuarantinePrefix+req.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list quarantined %s: %w", req.Prefix, err)
+	}
+	objKeys = append(objKeys, quarantined...)
+
+	if req.UserHash == "" {
+		req.UserHash = envelopeUserHash(ctx, store, req.Prefix)
+	}
+
+	var records []string
+	for _, key := range indexKeys(req, loc.Date) {
+		exists, err := store.ObjectExists(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", key, err)
+		}
+		if exists {
+			records = append(records, key)
+		}
+	}
+	scanRecords, err := store.ListKeys(ctx, scan.RecordPrefix(req.FailureID))
+	if err != nil {
+		return nil, fmt.Errorf("list scan records: %w", err)
+	}
+	records = append(records, scanRecords...)
+
+	rec := &Record{
+		FailureID: req.FailureID,
+		Project:   req.Project,
+		Env:       req.Env,
+		Prefix:    req.Prefix,
+		DeletedBy: req.Principal,
+		DeletedAt: now.UTC(),
+		UserHash:  req.UserHash,
+		Objects:   len(objKeys),
+		Records:   records,
+	}
+	if len(objKeys) == 0 && len(records) == 0 {
+		return rec, nil
+	}
+	// The size only feeds storage accounting, so the erasure goes ahead without it
+	if sizes, err := store.ObjectSizes(ctx, objKeys); err == nil {
+		for _, n := range sizes {
+			rec.Bytes += n
+		}
+	} else {
+		logging.FromContext(ctx).Warn().Err(err).Str("prefix", req.Prefix).Msg("failed to read sizes of erased objects")
+	}
+
+	if err := store.DeleteObjects(ctx, append(append([]string{}, objKeys...), records...)); err != nil {
+		return nil, fmt.Errorf("delete %s: %w", req.Prefix, err)
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.PutObjectBytes(ctx, AuditKey(req.FailureID), "application/json", b); err != nil {
+		return rec, fmt.Errorf("write audit record: %w", err)
+	}
+	return rec, nil
+}
+
+// indexKeys returns the records that may reference the failure. Digest entries
+// are keyed by completion day, which is the capture day or the one after.
+func indexKeys(req Request, day time.Time) []string {
+	entry := digest.Entry{FailureID: req.FailureID, Project: req.Project, CompletedAt: day}
+	next := entry
+	next.CompletedAt = day.AddDate(0, 0, 1)
+	keys := []string{
+		tickets.Key(req.FailureID),
+		links.Key(req.FailureID),
+		ack.Key(req.FailureID),
+		entry.Key(),
+		next.Key(),
+	}
+	if req.UserHash != "" {
+		keys = append(keys, tickets.UserKey(req.UserHash, req.FailureID))
+	}
+	return keys
+}
+
+// envelopeUserHash returns the hashed user ID stored in the failure's envelope,
+// or "" when there is none or the envelope cannot be read
+func envelopeUserHash(ctx context.Context, store Store, prefix string) string {
+	b, err := store.GetObjectBytes(ctx, prefix+"envelope.json")
+	if err != nil {
+		return ""
+	}
+	var env models.Envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return ""
+	}
+	return env.Client.UserID
+}
+
+// UserRecord is the audit record of erasing every failure of a user
+type UserRecord struct {
+	UserHash  string    `json:"userHash"`
+	DeletedBy string    `json:"deletedBy"`
+	DeletedAt time.Time `json:"deletedAt"`
+	// Failures lists the erased failure IDs, each with its own audit record
+	Failures []string `json:"failures"`
+	// Skipped lists failures in projects the principal may not access
+	Skipped []string `json:"skipped,omitempty"`
+	Objects int      `json:"objects"`
+	// Erased holds the record of each erased failure, audited on its own
+	Erased []Record `json:"-"`
+}
+
+// UserAuditKey returns the audit record key of a user erasure
+// Format: audit/erasures/users/{hex hash}/{RFC3339 time}.json
+func UserAuditKey(userHash string, t time.Time) string {
+	return AuditPrefix + tickets.UserPrefix(userHash) + t.UTC().Format(time.RFC3339) + ".json"
+}
+
+// EraseUser erases every failure indexed for userHash whose project and prefix
+// allowed reports true for, and writes a UserRecord audit even when none were found
+func EraseUser(ctx context.Context, store Store, userHash, principal string, allowed func(project, prefix string) bool, now time.Time) (*UserRecord, error) {
+	indexed, err := tickets.UserFailures(ctx, store, userHash)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &UserRecord{UserHash: userHash, DeletedBy: principal, DeletedAt: now.UTC(), Failures: []string{}}
+	for _, t := range indexed {
+		if !allowed(t.Project, t.S3Prefix) {
+			rec.Skipped = append(rec.Skipped, t.FailureID)
+			continue
+		}
+		erased, err := Erase(ctx, store, Request{
+			FailureID: t.FailureID,
+			Project:   t.Project,
+			Env:       t.Env,
+			Prefix:    t.S3Prefix,
+			Principal: principal,
+			UserHash:  userHash,
+		}, now)
+		if err != nil {
+			return nil, fmt.Errorf("erase %s: %w", t.FailureID, err)
+		}
+		rec.Failures = append(rec.Failures, t.FailureID)
+		rec.Objects += erased.Objects
+		rec.Erased = append(rec.Erased, *erased)
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.PutObjectBytes(ctx, UserAuditKey(userHash, now), "application/json", b); err != nil {
+		return rec, fmt.Errorf("write audit record: %w", err)
+	}
+	return rec, nil
+}
@@ -0,0 +1,149 @@
+package erasure
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+func TestErase(t *testing.T) {
+	ctx := context.Background()
+	prefix := "failures/myapp/prod/2024/03/15/f1/"
+	store := testsupport.NewStore()
+	store.Touch(
+		prefix+"envelope.json",
+		prefix+"files/a.png",
+		"quarantine/"+prefix+"files/b.zip",
+		"scans/f1/files/b.zip.json",
+		"failures/myapp/prod/2024/03/15/f2/envelope.json",
+		"tickets/f1.json",
+		"links/f1.json",
+		"digests/myapp/2024/03/16/f1.json",
+	)
+	now := time.Date(2024, 3, 20, 9, 0, 0, 0, time.UTC)
+	req := Request{FailureID: "f1", Project: "myapp", Env: "prod", Prefix: prefix, Principal: "key:dpo"}
+
+	rec, err := Erase(ctx, store, req, now)
+	if err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if rec.Objects != 3 || rec.Bytes != 3 || len(rec.Records) != 4 {
+		t.Errorf("record = %+v, want 3 objects of 3 bytes and 4 records", rec)
+	}
+
+	for _, k := range store.Keys("") {
+		if strings.Contains(k, "f1") && k != AuditKey("f1") {
+			t.Errorf("%s not deleted", k)
+		}
+	}
+	if _, ok := store.Object("failures/myapp/prod/2024/03/15/f2/envelope.json"); !ok {
+		t.Error("other failure deleted")
+	}
+
+	var audit Record
+	obj, _ := store.Object(AuditKey("f1"))
+	if err := json.Unmarshal(obj.Data, &audit); err != nil {
+		t.Fatalf("audit record: %v", err)
+	}
+	if audit.DeletedBy != "key:dpo" || !audit.DeletedAt.Equal(now) || audit.Objects != 3 {
+		t.Errorf("audit = %+v", audit)
+	}
+
+	// Erasing again finds nothing and keeps the original audit record
+	again, err := Erase(ctx, store, req, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("second Erase() error = %v", err)
+	}
+	if again.Objects != 0 || len(again.Records) != 0 {
+		t.Errorf("second erase = %+v, want nothing deleted", again)
+	}
+	obj, _ = store.Object(AuditKey("f1"))
+	if err := json.Unmarshal(obj.Data, &audit); err != nil || !audit.DeletedAt.Equal(now) {
+		t.Errorf("audit record overwritten: %+v, %v", audit, err)
+	}
+}
+
+func TestErase_RefusesForeignPrefix(t *testing.T) {
+	store := testsupport.NewStore()
+	store.Touch("failures/myapp/prod/2024/03/15/f1/envelope.json")
+
+	for _, prefix := range []string{"", "failures/", "failures/myapp/prod/", "failures/myapp/prod/2024/03/15/f2/"} {
+		req := Request{FailureID: "f1", Project: "myapp", Env: "prod", Prefix: prefix}
+		if _, err := Erase(context.Background(), store, req, time.Now()); err == nil {
+			t.Errorf("Erase() with prefix %q error = nil", prefix)
+		}
+	}
+	if len(store.Keys("")) != 1 {
+		t.Error("objects deleted for a refused prefix")
+	}
+}
+
+func TestErase_RemovesUserIndexFromEnvelope(t *testing.T) {
+	ctx := context.Background()
+	prefix := "failures/myapp/prod/2024/03/15/f1/"
+	hash := tickets.HashUserID("", "user-42")
+	store := testsupport.NewStore()
+	store.Touch(tickets.UserKey(hash, "f1"))
+	store.Put(prefix+"envelope.json", "application/json", []byte(`{"failureId":"f1","client":{"userId":"`+hash+`"}}`))
+
+	rec, err := Erase(ctx, store, Request{FailureID: "f1", Project: "myapp", Env: "prod", Prefix: prefix}, time.Now())
+	if err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if rec.UserHash != hash {
+		t.Errorf("UserHash = %q, want %q", rec.UserHash, hash)
+	}
+	if _, ok := store.Object(tickets.UserKey(hash, "f1")); ok {
+		t.Error("user index entry not deleted")
+	}
+}
+
+func TestEraseUser(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	hash := tickets.HashUserID("secret", "user-42")
+	now := time.Date(2024, 3, 20, 9, 0, 0, 0, time.UTC)
+
+	for _, tk := range []tickets.Record{
+		{FailureID: "f1", Project: "myapp", Env: "prod", S3Prefix: "failures/myapp/prod/2024/03/15/f1/", UserHash: hash},
+		{FailureID: "f2", Project: "other", Env: "prod", S3Prefix: "failures/v2/other/prod/dt=2024-03-16/f2/", UserHash: hash},
+		{FailureID: "f3", Project: "secret", Env: "prod", S3Prefix: "failures/secret/prod/2024/03/16/f3/", UserHash: hash},
+	} {
+		if err := tickets.IndexUser(ctx, store, tk); err != nil {
+			t.Fatalf("IndexUser() error = %v", err)
+		}
+		store.Touch(tk.S3Prefix + "request.raw")
+	}
+	store.Touch("failures/myapp/prod/2024/03/15/someone-else/request.raw")
+
+	allowed := func(project, _ string) bool { return project != "secret" }
+	rec, err := EraseUser(ctx, store, hash, "key:dpo", allowed, now)
+	if err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+	if len(rec.Failures) != 2 || len(rec.Skipped) != 1 || rec.Skipped[0] != "f3" || rec.Objects != 2 {
+		t.Errorf("record = %+v", rec)
+	}
+
+	for _, k := range []string{"failures/myapp/prod/2024/03/15/f1/request.raw", "failures/v2/other/prod/dt=2024-03-16/f2/request.raw", tickets.UserKey(hash, "f1")} {
+		if _, ok := store.Object(k); ok {
+			t.Errorf("%s not deleted", k)
+		}
+	}
+	for _, k := range []string{"failures/secret/prod/2024/03/16/f3/request.raw", "failures/myapp/prod/2024/03/15/someone-else/request.raw"} {
+		if _, ok := store.Object(k); !ok {
+			t.Errorf("%s deleted", k)
+		}
+	}
+	if _, ok := store.Object(UserAuditKey(hash, now)); !ok {
+		t.Error("user audit record not written")
+	}
+	if strings.Contains(UserAuditKey(hash, now), "user-42") {
+		t.Error("audit key contains the raw user ID")
+	}
+}
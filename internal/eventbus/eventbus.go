@@ -0,0 +1,194 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/retention"
+)
+
+// Detail types of failure lifecycle events
+const (
+	TypeTicketCreated = "failure.ticket.created"
+	TypeCompleted     = "failure.completed"
+	TypePurged        = "failure.purged"
+)
+
+// SchemaVersion is the version field of every event detail. Fields are only
+// added within a version.
+const SchemaVersion = 1
+
+// maxBatch is the most entries PutEvents accepts per call
+const maxBatch = 10
+
+// Reasons a failure was purged
+const (
+	ReasonRetention   = "retention"
+	ReasonDeleted     = "deleted"
+	ReasonUserErasure = "user_erasure"
+)
+
+// Event is the detail of a lifecycle event
+type Event interface {
+	DetailType() string
+}
+
+// TicketCreated is published when an upload ticket is issued
+type TicketCreated struct {
+	Version   int       `json:"version"`
+	FailureID string    `json:"failureId"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Project   string    `json:"project"`
+	Env       string    `json:"env"`
+	Priority  string    `json:"priority,omitempty"`
+	S3Prefix  string    `json:"s3Prefix"`
+	Files     int       `json:"files"`
+	Principal string    `json:"principal,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DetailType implements Event
+func (TicketCreated) DetailType() string { return TypeTicketCreated }
+
+// Completed is published when upload-complete accepted a failure
+type Completed struct {
+	Version     int    `json:"version"`
+	FailureID   string `json:"failureId"`
+	Tenant      string `json:"tenant,omitempty"`
+	Project     string `json:"project"`
+	Env         string `json:"env"`
+	Critical    bool   `json:"critical"`
+	Method      string `json:"method,omitempty"`
+	URL         string `json:"url,omitempty"`
+	AppVersion  string `json:"appVersion,omitempty"`
+	Platform    string `json:"platform,omitempty"`
+	EnvelopeKey string `json:"envelopeKey,omitempty"`
+	// StatusCode is 0 when the client received no response
+	StatusCode  int       `json:"statusCode,omitempty"`
+	ErrorClass  string    `json:"errorClass,omitempty"`
+	Encrypted   bool      `json:"encrypted"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// DetailType implements Event
+func (Completed) DetailType() string { return TypeCompleted }
+
+// Purged is published when a failure's objects were deleted, or tagged for
+// deletion by a retention rule
+type Purged struct {
+	Version   int    `json:"version"`
+	FailureID string `json:"failureId"`
+	Tenant    string `json:"tenant,omitempty"`
+	Project   string `json:"project,omitempty"`
+	Env       string `json:"env,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	// Reason is retention, deleted or user_erasure
+	Reason string `json:"reason"`
+	// Action is delete or tag
+	Action    string    `json:"action"`
+	Objects   int       `json:"objects"`
+	Principal string    `json:"principal,omitempty"`
+	PurgedAt  time.Time `json:"purgedAt"`
+}
+
+// DetailType implements Event
+func (Purged) DetailType() string { return TypePurged }
+
+// API is the subset of the EventBridge client used by the bus
+type API interface {
+	PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// Bus publishes lifecycle events to an EventBridge bus. A nil *Bus publishes
+// nothing, so publishing can stay unconditional when events are disabled.
+type Bus struct {
+	client API
+	name   string
+	source string
+}
+
+// New creates a bus publishing to the bus named name with source
+func New(client API, name, source string) *Bus {
+	return &Bus{client: client, name: name, source: source}
+}
+
+// NewClient creates an EventBridge client for region
+func NewClient(ctx context.Context, region string) (*eventbridge.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return eventbridge.NewFromConfig(cfg), nil
+}
+
+// Publish puts events on the bus in batches. It fails when any event was not
+// accepted.
+func (b *Bus) Publish(ctx context.Context, events ...Event) error {
+	if b == nil || len(events) == 0 {
+		return nil
+	}
+
+	entries := make([]types.PutEventsRequestEntry, 0, len(events))
+	for _, ev := range events {
+		detail, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("encode %s event: %w", ev.DetailType(), err)
+		}
+		entries = append(entries, types.PutEventsRequestEntry{
+			EventBusName: aws.String(b.name),
+			Source:       aws.String(b.source),
+			DetailType:   aws.String(ev.DetailType()),
+			Detail:       aws.String(string(detail)),
+		})
+	}
+
+	var errs []error
+	for start := 0; start < len(entries); start += maxBatch {
+		batch := entries[start:min(start+maxBatch, len(entries))]
+		out, err := b.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: batch})
+		if err != nil {
+			return fmt.Errorf("put events: %w", err)
+		}
+		for _, res := range out.Entries {
+			if res.ErrorCode != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", aws.ToString(res.ErrorCode), aws.ToString(res.ErrorMessage)))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d events rejected: %w", len(errs), len(entries), errors.Join(errs...))
+	}
+	return nil
+}
+
+// RetentionPurges returns a Purged event for each failure purged by a retention run
+func RetentionPurges(audit *retention.Audit) []Event {
+	if audit == nil {
+		return nil
+	}
+	events := make([]Event, 0, len(audit.Entries))
+	for _, e := range audit.Entries {
+		loc, _ := keys.Parse(e.Prefix)
+		events = append(events, Purged{
+			Version:   SchemaVersion,
+			FailureID: e.FailureID,
+			Tenant:    loc.Tenant,
+			Project:   e.Project,
+			Env:       e.Env,
+			Prefix:    e.Prefix,
+			Reason:    ReasonRetention,
+			Action:    string(e.Action),
+			Objects:   e.Objects,
+			PurgedAt:  audit.FinishedAt,
+		})
+	}
+	return events
+}
@@ -0,0 +1,109 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/yourorg/failure-uploader/internal/retention"
+)
+
+type fakeEventBridge struct {
+	calls  [][]types.PutEventsRequestEntry
+	reject string
+}
+
+func (f *fakeEventBridge) PutEvents(_ context.Context, in *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.calls = append(f.calls, in.Entries)
+	out := &eventbridge.PutEventsOutput{}
+	for _, e := range in.Entries {
+		res := types.PutEventsResultEntry{EventId: aws.String("id")}
+		if f.reject != "" && strings.Contains(aws.ToString(e.Detail), f.reject) {
+			res = types.PutEventsResultEntry{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("try again")}
+			out.FailedEntryCount++
+		}
+		out.Entries = append(out.Entries, res)
+	}
+	return out, nil
+}
+
+func TestPublish(t *testing.T) {
+	client := &fakeEventBridge{}
+	bus := New(client, "failures", "failure-uploader")
+	ev := Completed{Version: SchemaVersion, FailureID: "f-1", Project: "myapp", Env: "prod", StatusCode: 503, CompletedAt: time.Now()}
+	if err := bus.Publish(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 1 || len(client.calls[0]) != 1 {
+		t.Fatalf("calls = %+v", client.calls)
+	}
+	entry := client.calls[0][0]
+	if aws.ToString(entry.EventBusName) != "failures" || aws.ToString(entry.Source) != "failure-uploader" || aws.ToString(entry.DetailType) != TypeCompleted {
+		t.Errorf("entry = %+v", entry)
+	}
+	var detail map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.ToString(entry.Detail)), &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail["failureId"] != "f-1" || detail["version"] != float64(1) || detail["statusCode"] != float64(503) {
+		t.Errorf("detail = %v", detail)
+	}
+}
+
+func TestPublish_Batches(t *testing.T) {
+	client := &fakeEventBridge{}
+	bus := New(client, "failures", "failure-uploader")
+	events := make([]Event, 25)
+	for i := range events {
+		events[i] = TicketCreated{Version: SchemaVersion, FailureID: "f"}
+	}
+	if err := bus.Publish(context.Background(), events...); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 3 || len(client.calls[2]) != 5 {
+		t.Errorf("got %d calls, want batches of 10, 10 and 5", len(client.calls))
+	}
+}
+
+func TestPublish_Rejected(t *testing.T) {
+	client := &fakeEventBridge{reject: "bad"}
+	bus := New(client, "failures", "failure-uploader")
+	err := bus.Publish(context.Background(), Purged{FailureID: "ok"}, Purged{FailureID: "bad"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("Publish() error = %v, want 1 of 2 rejected", err)
+	}
+}
+
+func TestPublish_NilBus(t *testing.T) {
+	var bus *Bus
+	if err := bus.Publish(context.Background(), Purged{FailureID: "f"}); err != nil {
+		t.Errorf("nil bus Publish() = %v", err)
+	}
+}
+
+func TestRetentionPurges(t *testing.T) {
+	finished := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	audit := &retention.Audit{FinishedAt: finished, Entries: []retention.Entry{
+		{Project: "myapp", Env: "prod", FailureID: "f-1", Prefix: "failures/myapp/prod/2024/01/01/f-1/", Objects: 4, Action: retention.ActionTag},
+		{Project: "myapp", Env: "prod", FailureID: "f-2", Prefix: "failures/tenant=acme/myapp/prod/dt=2024-01-01/f-2/", Objects: 2, Action: retention.ActionDelete},
+	}}
+	events := RetentionPurges(audit)
+	if len(events) != 2 {
+		t.Fatalf("got %d events", len(events))
+	}
+	p := events[0].(Purged)
+	if p.Reason != ReasonRetention || p.Action != "tag" || p.Objects != 4 || !p.PurgedAt.Equal(finished) || p.Tenant != "" {
+		t.Errorf("event = %+v", p)
+	}
+	if p := events[1].(Purged); p.Tenant != "acme" {
+		t.Errorf("tenant = %q, want the tenant of the purged prefix", p.Tenant)
+	}
+	if RetentionPurges(nil) != nil {
+		t.Error("RetentionPurges(nil) returned events")
+	}
+}
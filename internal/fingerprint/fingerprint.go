@@ -0,0 +1,63 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment     = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	tokenSegment   = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+	hasDigit       = regexp.MustCompile(`\d`)
+)
+
+// Input is the set of attributes that identify a class of failure
+type Input struct {
+	Method     string
+	URL        string
+	Status     int
+	ErrorClass string
+}
+
+// NormalizePath reduces a URL to its path with variable segments (IDs, UUIDs,
+// hashes, tokens) replaced by placeholders, so /users/42 and /users/43 group together.
+func NormalizePath(rawURL string) string {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		p = u.Path
+	}
+
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+		case numericSegment.MatchString(seg):
+			segments[i] = "{id}"
+		case uuidSegment.MatchString(seg):
+			segments[i] = "{uuid}"
+		case hexSegment.MatchString(seg):
+			segments[i] = "{hash}"
+		case tokenSegment.MatchString(seg) && hasDigit.MatchString(seg):
+			segments[i] = "{token}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Compute returns the stable group ID for a failure
+func Compute(in Input) string {
+	parts := []string{
+		strings.ToUpper(in.Method),
+		NormalizePath(in.URL),
+		strconv.Itoa(in.Status),
+		strings.ToLower(strings.TrimSpace(in.ErrorClass)),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,52 @@
+package fingerprint
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://api.example.com/v1/users/42", want: "/v1/users/{id}"},
+		{url: "https://api.example.com/v1/users/42/orders/7?x=1", want: "/v1/users/{id}/orders/{id}"},
+		{url: "https://api.example.com/v1/items/550e8400-e29b-41d4-a716-446655440000", want: "/v1/items/{uuid}"},
+		{url: "https://api.example.com/blobs/0123456789abcdef0123", want: "/blobs/{hash}"},
+		{url: "https://api.example.com/share/aB3dE5fG7hJ9kL1mN3pQ5r", want: "/share/{token}"},
+		{url: "https://api.example.com/v1/profile/", want: "/v1/profile"},
+		{url: "https://api.example.com", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := NormalizePath(tt.url); got != tt.want {
+				t.Errorf("NormalizePath(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	base := Compute(Input{Method: "GET", URL: "https://a.example.com/users/1", Status: 500, ErrorClass: "Timeout"})
+
+	same := []Input{
+		{Method: "get", URL: "https://a.example.com/users/2", Status: 500, ErrorClass: "timeout"},
+		{Method: "GET", URL: "https://b.example.com/users/3?q=1", Status: 500, ErrorClass: " Timeout "},
+	}
+	for _, in := range same {
+		if got := Compute(in); got != base {
+			t.Errorf("Compute(%+v) = %s, want same group %s", in, got, base)
+		}
+	}
+
+	different := []Input{
+		{Method: "POST", URL: "https://a.example.com/users/1", Status: 500, ErrorClass: "Timeout"},
+		{Method: "GET", URL: "https://a.example.com/orders/1", Status: 500, ErrorClass: "Timeout"},
+		{Method: "GET", URL: "https://a.example.com/users/1", Status: 503, ErrorClass: "Timeout"},
+		{Method: "GET", URL: "https://a.example.com/users/1", Status: 500, ErrorClass: "ConnectionReset"},
+	}
+	for _, in := range different {
+		if got := Compute(in); got == base {
+			t.Errorf("Compute(%+v) should differ from base group", in)
+		}
+	}
+}
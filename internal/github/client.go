@@ -0,0 +1,269 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAPIURL is the GitHub REST API of github.com
+const DefaultAPIURL = "https://api.github.com"
+
+// ErrRateLimited is returned without calling GitHub while the rate limit of
+// the last response is exhausted
+var ErrRateLimited = errors.New("github rate limit exhausted")
+
+// errNotFound is returned for 404 and 410 responses
+var errNotFound = errors.New("github resource not found")
+
+// TokenSource returns the token requests are authenticated with
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a personal access token
+type StaticToken string
+
+// Token implements TokenSource
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Client calls the GitHub REST API. It remembers when the rate limit is
+// exhausted and fails fast until it resets, instead of spending requests on
+// certain rejections.
+type Client struct {
+	baseURL string
+	tokens  TokenSource
+	http    *http.Client
+	now     func() time.Time
+
+	mu           sync.Mutex
+	limitedUntil time.Time
+}
+
+// NewClient creates a client for the API at baseURL (DefaultAPIURL when empty)
+func NewClient(baseURL string, tokens TokenSource) *Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		tokens:  tokens,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+	}
+}
+
+// do sends a JSON request and decodes a JSON response into out (when non-nil)
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	c.mu.Lock()
+	until := c.limitedUntil
+	c.mu.Unlock()
+	if c.now().Before(until) {
+		return fmt.Errorf("%w until %s", ErrRateLimited, until.UTC().Format(time.RFC3339))
+	}
+
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("github token: %w", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	limited := c.observeRateLimit(resp)
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errNotFound
+	case limited && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests):
+		return fmt.Errorf("%w: github returned %s", ErrRateLimited, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("github returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// observeRateLimit records when requests may resume after resp, reporting
+// whether the client is now rate limited. Secondary limits send Retry-After;
+// primary limits report no remaining requests and a reset time.
+func (c *Client) observeRateLimit(resp *http.Response) bool {
+	var until time.Time
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			until = c.now().Add(time.Duration(secs) * time.Second)
+		}
+	} else if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			until = time.Unix(reset, 0)
+		}
+	}
+	if until.IsZero() {
+		return false
+	}
+	c.mu.Lock()
+	c.limitedUntil = until
+	c.mu.Unlock()
+	return true
+}
+
+// AppToken authenticates as a GitHub App installation, exchanging a JWT
+// signed with the app's private key for installation tokens, which are cached
+// until shortly before they expire
+type AppToken struct {
+	baseURL        string
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+	http           *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewAppToken creates a token source for an app installation. privateKeyPEM
+// is the app's PKCS#1 or PKCS#8 RSA private key.
+func NewAppToken(baseURL, appID, installationID, privateKeyPEM string) (*AppToken, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("github app private key is not PEM")
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = k
+	} else if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("github app private key is not RSA")
+		}
+		key = rk
+	} else {
+		return nil, fmt.Errorf("parse github app private key: %w", err)
+	}
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return &AppToken{
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		http:           &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Token implements TokenSource
+func (a *AppToken) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expires.Add(-5*time.Minute)) {
+		return a.token, nil
+	}
+
+	jwt, err := a.appJWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/app/installations/"+a.installationID+"/access_tokens", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("installation token request returned %s", resp.Status)
+	}
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	a.token, a.expires = out.Token, out.ExpiresAt
+	return a.token, nil
+}
+
+// appJWT returns the RS256 JWT identifying the app, backdated for clock drift
+func (a *AppToken) appJWT(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// NewTokenSource picks the app installation when appID is set and the
+// personal access token otherwise. It returns nil when neither is configured.
+func NewTokenSource(baseURL, token, appID, installationID, privateKeyPEM string) (TokenSource, error) {
+	switch {
+	case appID != "":
+		if installationID == "" || privateKeyPEM == "" {
+			return nil, errors.New("github app requires an installation ID and a private key")
+		}
+		return NewAppToken(baseURL, appID, installationID, privateKeyPEM)
+	case token != "":
+		return StaticToken(token), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,217 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+// fakeGitHub serves the issue endpoints, numbering issues from 1
+type fakeGitHub struct {
+	mu       sync.Mutex
+	issues   map[int]string
+	comments map[int][]string
+	gone     map[int]bool
+	auth     []string
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{issues: make(map[int]string), comments: make(map[int][]string), gone: make(map[int]bool)}
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	var in map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&in)
+
+	const prefix = "/repos/myorg/myapp/issues"
+	switch {
+	case r.URL.Path == prefix:
+		n := len(f.issues) + 1
+		f.issues[n] = in["title"]
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"number": n, "html_url": "https://github.com/myorg/myapp/issues/" + strconv.Itoa(n)})
+	case strings.HasPrefix(r.URL.Path, prefix+"/") && strings.HasSuffix(r.URL.Path, "/comments"):
+		n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix+"/"), "/comments"))
+		if _, ok := f.issues[n]; !ok || f.gone[n] {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		f.comments[n] = append(f.comments[n], in["body"])
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testNotification(occurrences int) email.FailureNotification {
+	return email.FailureNotification{
+		FailureID:   "f-" + strconv.Itoa(occurrences),
+		Project:     "myapp",
+		Env:         "prod",
+		Method:      "post",
+		URL:         "https://api.example.com/v1/orders/12345",
+		StatusCode:  503,
+		EnvelopeURL: "https://bucket.s3.amazonaws.com/envelope.json?X-Amz-Signature=abc",
+		GroupID:     "g1",
+		Occurrences: occurrences,
+	}
+}
+
+func TestReport_Threads(t *testing.T) {
+	gh := newFakeGitHub()
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+	store := testsupport.NewStore()
+	issues := NewIssues(NewClient(srv.URL, StaticToken("pat")), store)
+	ctx := context.Background()
+
+	for n := 1; n <= 3; n++ {
+		if err := issues.Report(ctx, "myorg/myapp", testNotification(n)); err != nil {
+			t.Fatalf("Report(%d) = %v", n, err)
+		}
+	}
+	if len(gh.issues) != 1 {
+		t.Fatalf("opened %d issues, want 1", len(gh.issues))
+	}
+	if got := gh.issues[1]; got != "[myapp/prod] POST /v1/orders/{id} HTTP 503" {
+		t.Errorf("title = %q", got)
+	}
+	if len(gh.comments[1]) != 2 || !strings.Contains(gh.comments[1][1], "3 occurrence(s)") || !strings.Contains(gh.comments[1][1], "X-Amz-Signature") {
+		t.Errorf("comments = %q", gh.comments[1])
+	}
+	if gh.auth[0] != "Bearer pat" {
+		t.Errorf("Authorization = %q", gh.auth[0])
+	}
+
+	var thread Thread
+	obj, _ := store.Object(Key("myorg/myapp", "", "myapp", "prod", "g1"))
+	if err := json.Unmarshal(obj.Data, &thread); err != nil {
+		t.Fatal(err)
+	}
+	if thread.Issue != 1 || thread.Occurrences != 3 || thread.CommentedAt == nil {
+		t.Errorf("thread = %+v", thread)
+	}
+
+	// A deleted issue is replaced
+	gh.gone[1] = true
+	if err := issues.Report(ctx, "myorg/myapp", testNotification(4)); err != nil {
+		t.Fatal(err)
+	}
+	if len(gh.issues) != 2 {
+		t.Errorf("opened %d issues after the first was deleted, want 2", len(gh.issues))
+	}
+}
+
+func TestReport_Ungrouped(t *testing.T) {
+	gh := newFakeGitHub()
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+	store := testsupport.NewStore()
+	issues := NewIssues(NewClient(srv.URL, StaticToken("pat")), store)
+
+	notif := testNotification(0)
+	notif.GroupID = ""
+	for i := 0; i < 2; i++ {
+		if err := issues.Report(context.Background(), "myorg/myapp", notif); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(gh.issues) != 2 || len(store.Keys("")) != 0 {
+		t.Errorf("issues = %d, threads = %d; want 2 issues and no threads", len(gh.issues), len(store.Keys("")))
+	}
+}
+
+func TestClient_RateLimited(t *testing.T) {
+	calls := 0
+	reset := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, StaticToken("pat"))
+
+	for i := 0; i < 2; i++ {
+		if err := c.do(context.Background(), "POST", "/repos/myorg/myapp/issues", map[string]string{}, nil); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("do() = %v, want ErrRateLimited", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("GitHub called %d times, want 1 before the limit resets", calls)
+	}
+
+	c.now = func() time.Time { return time.Unix(reset+1, 0) }
+	_ = c.do(context.Background(), "GET", "/", nil, nil)
+	if calls != 2 {
+		t.Errorf("GitHub called %d times, want a call after the reset", calls)
+	}
+}
+
+func TestAppToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	exchanges := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app/installations/42/access_tokens" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ey") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		exchanges++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"token": "ghs_installation", "expires_at": time.Now().Add(time.Hour)})
+	}))
+	defer srv.Close()
+
+	tokens, err := NewTokenSource(srv.URL, "", "7", "42", pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		token, err := tokens.Token(context.Background())
+		if err != nil || token != "ghs_installation" {
+			t.Fatalf("Token() = %q, %v", token, err)
+		}
+	}
+	if exchanges != 1 {
+		t.Errorf("exchanged %d times, want the token cached", exchanges)
+	}
+
+	if _, err := NewTokenSource(srv.URL, "", "7", "", pemKey); err == nil {
+		t.Error("app without an installation ID should fail")
+	}
+	if ts, err := NewTokenSource(srv.URL, "", "", "", ""); ts != nil || err != nil {
+		t.Errorf("unconfigured token source = %v, %v", ts, err)
+	}
+}
+
+func TestValidRepo(t *testing.T) {
+	for repo, want := range map[string]bool{"myorg/myapp": true, "myorg": false, "/myapp": false, "a/b/c": false, "my org/app": false} {
+		if got := ValidRepo(repo); got != want {
+			t.Errorf("ValidRepo(%q) = %v, want %v", repo, got, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/fingerprint"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// Prefix is the S3 prefix under which issue threads are stored
+const Prefix = "notifications/github/"
+
+// Store is the subset of S3 operations used for issue threads
+type Store interface {
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
+
+// Thread links a failure group to the issue opened for it in a repository
+type Thread struct {
+	Repo        string     `json:"repo"`
+	Issue       int        `json:"issue"`
+	URL         string     `json:"url"`
+	GroupID     string     `json:"groupId"`
+	OpenedAt    time.Time  `json:"openedAt"`
+	CommentedAt *time.Time `json:"commentedAt,omitempty"`
+	// Occurrences is the group's count at the last comment
+	Occurrences int `json:"occurrences"`
+}
+
+// Key returns the thread key of a group in repo
+// Format: notifications/github/{owner}/{repo}/{project}/{env}/{groupId}.json
+// Format with a tenant: notifications/github/{owner}/{repo}/tenant={tenant}/{project}/{env}/{groupId}.json
+func Key(repo, tenant, project, env, groupID string) string {
+	key := Prefix + repo + "/"
+	if tenant != "" {
+		key += "tenant=" + tenant + "/"
+	}
+	return fmt.Sprintf("%s%s/%s/%s.json", key, project, env, groupID)
+}
+
+// ValidRepo reports whether repo is of the form owner/name
+func ValidRepo(repo string) bool {
+	owner, name, ok := strings.Cut(repo, "/")
+	return ok && owner != "" && name != "" && !strings.ContainsAny(name, "/ ") && !strings.Contains(owner, " ")
+}
+
+// Issues opens one issue per failure group and comments on it when the group
+// recurs, so a repository collects a single thread per distinct failure
+// instead of an issue per occurrence.
+type Issues struct {
+	client *Client
+	store  Store
+	now    func() time.Time
+}
+
+// NewIssues creates an issue reporter recording threads in store
+func NewIssues(client *Client, store Store) *Issues {
+	return &Issues{client: client, store: store, now: time.Now}
+}
+
+type issue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// Report opens an issue for notif's group in repo, or comments on the group's
+// issue if one was opened before. An issue that was deleted or transferred is
+// replaced by a new one. Failures without a group always open a new issue.
+// Concurrent first occurrences of a group may each open an issue.
+func (i *Issues) Report(ctx context.Context, repo string, notif email.FailureNotification) error {
+	if notif.GroupID == "" {
+		_, err := i.open(ctx, repo, notif)
+		return err
+	}
+
+	key := Key(repo, notif.Tenant, notif.Project, notif.Env, notif.GroupID)
+	thread, err := i.load(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if thread != nil {
+		err = i.client.do(ctx, "POST", issuePath(repo, thread.Issue)+"/comments",
+			map[string]string{"body": commentBody(notif)}, nil)
+		if err == nil {
+			now := i.now().UTC()
+			thread.CommentedAt = &now
+			thread.Occurrences = notif.Occurrences
+			return i.save(ctx, key, thread)
+		}
+		if !errors.Is(err, errNotFound) {
+			return fmt.Errorf("comment on %s#%d: %w", repo, thread.Issue, err)
+		}
+		logging.FromContext(ctx).Warn().Str("repo", repo).Int("issue", thread.Issue).Str("groupId", notif.GroupID).Msg("github issue is gone - opening a new one")
+	}
+
+	iss, err := i.open(ctx, repo, notif)
+	if err != nil {
+		return err
+	}
+	return i.save(ctx, key, &Thread{
+		Repo:        repo,
+		Issue:       iss.Number,
+		URL:         iss.HTMLURL,
+		GroupID:     notif.GroupID,
+		OpenedAt:    i.now().UTC(),
+		Occurrences: notif.Occurrences,
+	})
+}
+
+// open creates an issue for notif in repo
+func (i *Issues) open(ctx context.Context, repo string, notif email.FailureNotification) (*issue, error) {
+	var iss issue
+	in := map[string]string{"title": Title(notif), "body": issueBody(notif)}
+	if err := i.client.do(ctx, "POST", repoPath(repo)+"/issues", in, &iss); err != nil {
+		return nil, fmt.Errorf("open issue in %s: %w", repo, err)
+	}
+	return &iss, nil
+}
+
+func (i *Issues) load(ctx context.Context, key string) (*Thread, error) {
+	exists, err := i.store.ObjectExists(ctx, key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	b, err := i.store.GetObjectBytes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var t Thread
+	if err := json.Unmarshal(b, &t); err != nil || t.Issue == 0 {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("ignoring unreadable github thread")
+		return nil, nil
+	}
+	return &t, nil
+}
+
+func (i *Issues) save(ctx context.Context, key string, t *Thread) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := i.store.PutObjectBytes(ctx, key, "application/json", b); err != nil {
+		return fmt.Errorf("record github thread: %w", err)
+	}
+	return nil
+}
+
+// Title names the failure group rather than the occurrence, e.g.
+// "[myapp/prod] POST /v1/orders/{id} HTTP 503"
+func Title(notif email.FailureNotification) string {
+	title := fmt.Sprintf("[%s/%s] %s %s", notif.Project, notif.Env, strings.ToUpper(notif.Method), fingerprint.NormalizePath(notif.URL))
+	switch {
+	case notif.StatusCode > 0:
+		title += fmt.Sprintf(" HTTP %d", notif.StatusCode)
+	case notif.ErrorClass != "":
+		title += " " + notif.ErrorClass
+	}
+	return title
+}
+
+// issueBody describes the first occurrence of a failure group
+func issueBody(notif email.FailureNotification) string {
+	var b strings.Builder
+	b.WriteString("A failed request was captured.\n\n")
+	writeOccurrence(&b, notif)
+	if notif.GroupID != "" {
+		fmt.Fprintf(&b, "\nFurther occurrences of group `%s` are added as comments.\n", notif.GroupID)
+	}
+	return b.String()
+}
+
+// commentBody describes a repeat occurrence, with fresh download links
+func commentBody(notif email.FailureNotification) string {
+	var b strings.Builder
+	if notif.Occurrences > 0 {
+		fmt.Fprintf(&b, "Seen again: %d occurrence(s) so far.\n\n", notif.Occurrences)
+	} else {
+		b.WriteString("Seen again.\n\n")
+	}
+	writeOccurrence(&b, notif)
+	return b.String()
+}
+
+func writeOccurrence(b *strings.Builder, notif email.FailureNotification) {
+	fmt.Fprintf(b, "- Failure: `%s`\n", notif.FailureID)
+	fmt.Fprintf(b, "- Request: `%s %s`\n", notif.Method, notif.URL)
+	if outcome := notif.Outcome(); outcome != "" {
+		fmt.Fprintf(b, "- Outcome: %s\n", outcome)
+	}
+	if notif.AppVersion != "" || notif.Platform != "" {
+		fmt.Fprintf(b, "- App: %s (%s)\n", notif.AppVersion, notif.Platform)
+	}
+	if notif.Critical {
+		b.WriteString("- Priority: critical\n")
+	}
+	if notif.EnvelopeURL != "" {
+		fmt.Fprintf(b, "- Envelope: [download](%s) (link expires)\n", notif.EnvelopeURL)
+	}
+	if notif.Curl != "" {
+		fmt.Fprintf(b, "\n```sh\n%s\n```\n", notif.Curl)
+	}
+}
+
+func repoPath(repo string) string {
+	owner, name, _ := strings.Cut(repo, "/")
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+}
+
+func issuePath(repo string, number int) string {
+	return fmt.Sprintf("%s/issues/%d", repoPath(repo), number)
+}
@@ -0,0 +1,132 @@
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/fingerprint"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Prefix is the S3 prefix under which group records are stored
+const Prefix = "groups/"
+
+// Store is the subset of S3 operations used for group records
+type Store interface {
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Key returns the record key for a group
+// Format: groups/{project}/{env}/{groupId}.json
+// Format with a tenant: groups/tenant={tenant}/{project}/{env}/{groupId}.json
+func Key(tenant, project, env, groupID string) string {
+	return fmt.Sprintf("%s%s/%s.json", projectPrefix(tenant, project), env, groupID)
+}
+
+// projectPrefix returns the prefix of a project's group records
+func projectPrefix(tenant, project string) string {
+	if tenant != "" {
+		return Prefix + "tenant=" + tenant + "/" + project + "/"
+	}
+	return Prefix + project + "/"
+}
+
+// Record adds one occurrence of env's failure to its group and returns the updated group.
+// Concurrent occurrences of the same group may race; counts are best-effort.
+func Record(ctx context.Context, store Store, env *models.Envelope, at time.Time) (*models.Group, error) {
+	in := fingerprint.Input{Method: env.Request.Method, URL: env.Request.URL}
+	if env.Response != nil {
+		in.Status = env.Response.StatusCode
+		in.ErrorClass = env.Response.ErrorClass
+	}
+	id := fingerprint.Compute(in)
+	key := Key(env.Tenant, env.Project, env.Env, id)
+	// Groups are kept in the bucket of their failures
+	ctx = keys.WithScope(ctx, env.Project, env.Env)
+
+	g := &models.Group{
+		ID:         id,
+		Tenant:     env.Tenant,
+		Project:    env.Project,
+		Env:        env.Env,
+		Method:     strings.ToUpper(in.Method),
+		Path:       fingerprint.NormalizePath(in.URL),
+		StatusCode: in.Status,
+		ErrorClass: in.ErrorClass,
+		FirstSeen:  at,
+	}
+
+	exists, err := store.ObjectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		b, err := store.GetObjectBytes(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, g); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("resetting unreadable group record")
+			g.Count = 0
+			g.FirstSeen = at
+		}
+	}
+
+	g.Count++
+	g.LastSeen = at
+	g.LastFailureID = env.FailureID
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.PutObjectBytes(ctx, key, "application/json", b); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// List returns a project's groups within tenant, optionally filtered to env,
+// most frequent first
+func List(ctx context.Context, store Store, tenant, project, env string) ([]models.Group, error) {
+	prefix := projectPrefix(tenant, project)
+	if env != "" {
+		prefix += env + "/"
+	}
+
+	keys, err := store.ListKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]models.Group, 0, len(keys))
+	for _, key := range keys {
+		b, err := store.GetObjectBytes(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", key, err)
+		}
+		var g models.Group
+		if err := json.Unmarshal(b, &g); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("skipping unreadable group record")
+			continue
+		}
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].LastSeen.After(groups[j].LastSeen)
+	})
+	return groups, nil
+}
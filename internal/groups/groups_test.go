@@ -0,0 +1,85 @@
+package groups
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func envelope(id, url string, status int) *models.Envelope {
+	return &models.Envelope{
+		FailureID: id,
+		Project:   "myapp",
+		Env:       "prod",
+		Request:   models.RequestInfo{Method: "GET", URL: url},
+		Response:  &models.ResponseInfo{StatusCode: status},
+	}
+}
+
+func TestRecordAndList(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	t0 := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	first, err := Record(ctx, store, envelope("f1", "https://a/users/1", 500), t0)
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	second, err := Record(ctx, store, envelope("f2", "https://a/users/2", 500), t0.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if _, err := Record(ctx, store, envelope("f3", "https://a/orders", 404), t0.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if first.ID != second.ID {
+		t.Fatalf("same endpoint produced groups %s and %s", first.ID, second.ID)
+	}
+	if second.Count != 2 || !second.FirstSeen.Equal(t0) || second.LastFailureID != "f2" {
+		t.Errorf("group after second occurrence = %+v", second)
+	}
+	if second.Path != "/users/{id}" {
+		t.Errorf("Path = %q, want /users/{id}", second.Path)
+	}
+
+	list, err := List(ctx, store, "", "myapp", "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 || list[0].ID != first.ID || list[0].Count != 2 {
+		t.Errorf("List() = %+v, want most frequent group first", list)
+	}
+
+	if list, _ := List(ctx, store, "", "myapp", "staging"); len(list) != 0 {
+		t.Errorf("List() for other env returned %d groups", len(list))
+	}
+}
+
+func TestRecordAndList_Tenant(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	t0 := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	env := envelope("f1", "https://a/users/1", 500)
+	env.Tenant = "acme"
+	g, err := Record(ctx, store, env, t0)
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if _, ok := store.Object("groups/tenant=acme/myapp/prod/" + g.ID + ".json"); !ok || g.Tenant != "acme" {
+		t.Errorf("Record() = %+v, stored %v", g, store.Keys(""))
+	}
+
+	if list, _ := List(ctx, store, "acme", "myapp", ""); len(list) != 1 {
+		t.Errorf("List() for tenant returned %d groups, want 1", len(list))
+	}
+	for _, tenant := range []string{"", "globex"} {
+		if list, _ := List(ctx, store, tenant, "myapp", ""); len(list) != 0 {
+			t.Errorf("List() for tenant %q returned another tenant's groups", tenant)
+		}
+	}
+}
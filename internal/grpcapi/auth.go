@@ -0,0 +1,198 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"runtime/debug"
+	"strings"
+
+	pb "github.com/yourorg/failure-uploader/api/proto/failureuploader/v1"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/audit"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys of the credentials, the lowercase forms of the REST headers
+const (
+	APIKeyMetadata        = "x-api-key"
+	AuthorizationMetadata = "authorization"
+)
+
+// methodScopes is the scope each method requires, as on the matching REST route
+var methodScopes = map[string]apikeys.Scope{
+	pb.FailureUploaderService_CreateUploadTicket_FullMethodName: apikeys.ScopeTicketCreate,
+	pb.FailureUploaderService_CompleteUpload_FullMethodName:     apikeys.ScopeTicketCreate,
+	pb.FailureUploaderService_GetFailure_FullMethodName:         apikeys.ScopeFailureRead,
+}
+
+// Authenticator authenticates gRPC calls with the credentials of the REST
+// API. Signed requests and API Gateway authorizer claims only exist over
+// HTTP, so AUTH_MODE=hmac and AUTH_MODE=authorizer reject every call.
+type Authenticator struct {
+	mode        string
+	auth        middleware.Authenticators
+	enabled     bool
+	multiTenant bool
+	audit       *audit.Recorder
+}
+
+// NewAuthenticator creates an authenticator for mode. When enabled is false
+// calls are not authenticated, as with AUTH_ENABLED off over HTTP.
+func NewAuthenticator(mode string, auth middleware.Authenticators, enabled, multiTenant bool) *Authenticator {
+	return &Authenticator{mode: mode, auth: auth, enabled: enabled, multiTenant: multiTenant}
+}
+
+// WithAudit records rejected calls with rec
+func (a *Authenticator) WithAudit(rec *audit.Recorder) *Authenticator {
+	a.audit = rec
+	return a
+}
+
+// Supported reports whether calls can authenticate in the authenticator's mode
+func (a *Authenticator) Supported() bool {
+	return !a.enabled || (a.mode != middleware.AuthModeSignature && a.mode != middleware.AuthModeAuthorizer)
+}
+
+// Unary authenticates a call, checks the method's scope and the principal's
+// tenant, and passes the principal to the handler in its context. Health
+// checks need no credentials.
+func (a *Authenticator) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !a.enabled || strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
+
+	p, problem := a.authenticate(ctx)
+	if problem != nil {
+		logging.FromContext(ctx).Warn().
+			Str("method", info.FullMethod).
+			Str("mode", a.mode).
+			Str("reason", problem.Title).
+			Msg("unauthenticated gRPC call")
+		a.recordDenied(ctx, info.FullMethod, nil, problem)
+		return nil, statusError(problem)
+	}
+
+	if scope, ok := methodScopes[info.FullMethod]; ok && !p.HasScope(scope) {
+		logging.FromContext(ctx).Warn().
+			Str("method", info.FullMethod).
+			Str("principal", p.Identity()).
+			Str("scope", string(scope)).
+			Msg("principal missing scope")
+		problem := apierror.Forbidden("Not authorized for this operation")
+		a.recordDenied(ctx, info.FullMethod, p, problem)
+		return nil, statusError(problem)
+	}
+
+	if a.multiTenant && !validation.ValidTenant(p.TenantID()) {
+		logging.FromContext(ctx).Warn().
+			Str("method", info.FullMethod).
+			Str("principal", p.Identity()).
+			Str("tenant", p.TenantID()).
+			Msg("principal has no valid tenant")
+		problem := apierror.Forbidden("Credentials are not assigned to a tenant")
+		a.recordDenied(ctx, info.FullMethod, p, problem)
+		return nil, statusError(problem)
+	}
+
+	return handler(middleware.WithPrincipal(ctx, p), req)
+}
+
+// recordDenied records a rejected call; p is nil when authentication failed
+func (a *Authenticator) recordDenied(ctx context.Context, method string, p middleware.Principal, problem *apierror.Problem) {
+	ev := audit.Event{
+		Action:  audit.ActionAuthDenied,
+		Outcome: audit.OutcomeDenied,
+		Method:  "gRPC",
+		Path:    method,
+		Status:  problem.Status,
+		Details: map[string]string{"reason": problem.Title},
+	}
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		ev.SourceIP = pr.Addr.String()
+		if host, _, err := net.SplitHostPort(ev.SourceIP); err == nil {
+			ev.SourceIP = host
+		}
+	}
+	if p != nil {
+		ev.Principal, ev.Tenant = p.Identity(), p.TenantID()
+	}
+	a.audit.Record(ctx, ev)
+}
+
+// authenticate verifies the call's credentials for the configured mode. In
+// AuthModeAny a bearer token is used when present and the API key otherwise.
+func (a *Authenticator) authenticate(ctx context.Context) (middleware.Principal, *apierror.Problem) {
+	switch a.mode {
+	case middleware.AuthModeSignature, middleware.AuthModeAuthorizer:
+		return nil, apierror.Unauthorized("Auth mode is not supported over gRPC")
+	case middleware.AuthModeJWT:
+		return a.bearer(ctx)
+	case middleware.AuthModeAny:
+		if a.auth.Verifier != nil && bearerToken(ctx) != "" {
+			return a.bearer(ctx)
+		}
+		return a.apiKey(ctx)
+	default:
+		return a.apiKey(ctx)
+	}
+}
+
+func (a *Authenticator) apiKey(ctx context.Context) (middleware.Principal, *apierror.Problem) {
+	provided := firstMetadata(ctx, APIKeyMetadata)
+	if provided == "" {
+		return nil, apierror.Unauthorized("Missing API key")
+	}
+	key, ok := a.auth.Registry.Lookup(provided)
+	if !ok {
+		return nil, apierror.Unauthorized("Invalid API key")
+	}
+	return key, nil
+}
+
+func (a *Authenticator) bearer(ctx context.Context) (middleware.Principal, *apierror.Problem) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, apierror.Unauthorized("Missing bearer token")
+	}
+	if a.auth.Verifier == nil {
+		return nil, apierror.Unauthorized("Invalid bearer token")
+	}
+	claims, err := a.auth.Verifier.Verify(ctx, token)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Msg("invalid bearer token")
+		return nil, apierror.Unauthorized("Invalid bearer token")
+	}
+	return claims, nil
+}
+
+func bearerToken(ctx context.Context) string {
+	h := firstMetadata(ctx, AuthorizationMetadata)
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// recoverer turns a panicking handler into an Internal error, like chi's
+// Recoverer does for HTTP
+func recoverer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.FromContext(ctx).Error().
+				Str("method", info.FullMethod).
+				Interface("panic", r).
+				Bytes("stack", debug.Stack()).
+				Msg("panic in gRPC handler")
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
@@ -0,0 +1,176 @@
+package grpcapi
+
+import (
+	pb "github.com/yourorg/failure-uploader/api/proto/failureuploader/v1"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Conversions between the protobuf messages and the JSON models. Nil messages
+// convert to zero values, as omitted JSON objects decode.
+
+func ticketRequest(m *pb.CreateUploadTicketRequest) *models.UploadTicketRequest {
+	return &models.UploadTicketRequest{
+		Project:  m.GetProject(),
+		Env:      m.GetEnv(),
+		Request:  requestInfo(m.GetRequest()),
+		Client:   clientInfo(m.GetClient()),
+		Response: responseInfo(m.GetResponse()),
+		Priority: m.GetPriority(),
+	}
+}
+
+func completeRequest(m *pb.CompleteUploadRequest) *models.UploadCompleteRequest {
+	return &models.UploadCompleteRequest{
+		FailureID:        m.GetFailureId(),
+		Project:          m.GetProject(),
+		Env:              m.GetEnv(),
+		UploadedKeys:     m.GetUploadedKeys(),
+		SHA256:           m.GetSha256(),
+		ServerChecksums:  m.GetServerChecksums(),
+		Priority:         m.GetPriority(),
+		Encryption:       encryption(m.GetEncryption()),
+		GenerateEnvelope: m.GetGenerateEnvelope(),
+		Response:         responseInfo(m.GetResponse()),
+	}
+}
+
+func requestInfo(m *pb.RequestInfo) models.RequestInfo {
+	info := models.RequestInfo{
+		Method:      m.GetMethod(),
+		URL:         m.GetUrl(),
+		ContentType: m.GetContentType(),
+		BodyBytes:   m.GetBodyBytes(),
+		SHA256:      m.GetSha256(),
+	}
+	for _, f := range m.GetFiles() {
+		info.Files = append(info.Files, models.FileInfo{
+			Name:        f.GetName(),
+			Filename:    f.GetFilename(),
+			ContentType: f.GetContentType(),
+			Bytes:       f.GetBytes(),
+			SHA256:      f.GetSha256(),
+		})
+	}
+	return info
+}
+
+func clientInfo(m *pb.ClientInfo) models.ClientInfo {
+	return models.ClientInfo{
+		AppVersion: m.GetAppVersion(),
+		Platform:   m.GetPlatform(),
+		UserID:     m.GetUserId(),
+	}
+}
+
+func responseInfo(m *pb.ResponseInfo) *models.ResponseInfo {
+	if m == nil {
+		return nil
+	}
+	return &models.ResponseInfo{
+		StatusCode:   int(m.GetStatusCode()),
+		ErrorClass:   m.GetErrorClass(),
+		DurationMs:   m.GetDurationMs(),
+		ErrorMessage: m.GetErrorMessage(),
+	}
+}
+
+func encryption(m *pb.Encryption) *models.Encryption {
+	if m == nil {
+		return nil
+	}
+	return &models.Encryption{Algorithm: m.GetAlgorithm(), KeyID: m.GetKeyId(), IV: m.GetIv()}
+}
+
+func ticketResponse(r *models.UploadTicketResponse) *pb.CreateUploadTicketResponse {
+	uploads := &pb.UploadURLs{
+		Envelope:       presignedUpload(r.Uploads.Envelope),
+		RequestRaw:     presignedUpload(r.Uploads.RequestRaw),
+		RequestHeaders: presignedUpload(r.Uploads.RequestHeaders),
+		ResponseRaw:    presignedUpload(r.Uploads.ResponseRaw),
+		Checksums:      presignedUpload(r.Uploads.Checksums),
+	}
+	for _, f := range r.Uploads.Files {
+		uploads.Files = append(uploads.Files, presignedUpload(f))
+	}
+	return &pb.CreateUploadTicketResponse{
+		FailureId:        r.FailureID,
+		S3Prefix:         r.S3Prefix,
+		Uploads:          uploads,
+		ExpiresInSeconds: int32(r.ExpiresInSeconds),
+	}
+}
+
+func presignedUpload(u models.PresignedUpload) *pb.PresignedUpload {
+	return &pb.PresignedUpload{Key: u.Key, PutUrl: u.PutURL, Headers: u.Headers}
+}
+
+func envelopeMessage(e *models.Envelope) *pb.Envelope {
+	m := &pb.Envelope{
+		SchemaVersion: int32(e.SchemaVersion),
+		FailureId:     e.FailureID,
+		Tenant:        e.Tenant,
+		Project:       e.Project,
+		Env:           e.Env,
+		Request:       requestInfoMessage(e.Request),
+		Response:      responseInfoMessage(e.Response),
+		Client: &pb.ClientInfo{
+			AppVersion: e.Client.AppVersion,
+			Platform:   e.Client.Platform,
+			UserId:     e.Client.UserID,
+		},
+		S3Prefix:   e.S3Prefix,
+		GroupId:    e.GroupID,
+		Encryption: encryptionMessage(e.Encryption),
+	}
+	if !e.CreatedAt.IsZero() {
+		m.CreatedAt = timestamppb.New(e.CreatedAt)
+	}
+	for _, c := range e.ContentMismatches {
+		m.ContentMismatches = append(m.ContentMismatches, &pb.ContentMismatch{
+			Artifact: c.Artifact,
+			Declared: c.Declared,
+			Detected: c.Detected,
+		})
+	}
+	return m
+}
+
+func requestInfoMessage(r models.RequestInfo) *pb.RequestInfo {
+	m := &pb.RequestInfo{
+		Method:      r.Method,
+		Url:         r.URL,
+		ContentType: r.ContentType,
+		BodyBytes:   r.BodyBytes,
+		Sha256:      r.SHA256,
+	}
+	for _, f := range r.Files {
+		m.Files = append(m.Files, &pb.FileInfo{
+			Name:        f.Name,
+			Filename:    f.Filename,
+			ContentType: f.ContentType,
+			Bytes:       f.Bytes,
+			Sha256:      f.SHA256,
+		})
+	}
+	return m
+}
+
+func responseInfoMessage(r *models.ResponseInfo) *pb.ResponseInfo {
+	if r == nil {
+		return nil
+	}
+	return &pb.ResponseInfo{
+		StatusCode:   int32(r.StatusCode),
+		ErrorClass:   r.ErrorClass,
+		DurationMs:   r.DurationMs,
+		ErrorMessage: r.ErrorMessage,
+	}
+}
+
+func encryptionMessage(e *models.Encryption) *pb.Encryption {
+	if e == nil {
+		return nil
+	}
+	return &pb.Encryption{Algorithm: e.Algorithm, KeyId: e.KeyID, Iv: e.IV}
+}
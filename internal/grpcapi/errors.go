@@ -0,0 +1,72 @@
+package grpcapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain qualifies the problem codes sent as ErrorInfo reasons
+const errorDomain = "failure-uploader"
+
+// statusCodes maps the HTTP status of a problem to the closest gRPC code
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusInternalServerError:   codes.Internal,
+	http.StatusBadGateway:            codes.Unavailable,
+}
+
+// statusError converts p to a gRPC status. The problem code is sent as the
+// ErrorInfo reason, failed fields as BadRequest violations and the retry delay
+// as RetryInfo, so clients can act on them as REST clients do.
+func statusError(p *apierror.Problem) error {
+	code, ok := statusCodes[p.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+	// Conflicts that resolve on retry, like a completion in progress, are aborts
+	if code == codes.FailedPrecondition && p.Retryable {
+		code = codes.Aborted
+	}
+
+	msg := p.Title
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	st := status.New(code, msg)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: string(p.Code), Domain: errorDomain}}
+	if len(p.Errors) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, e := range p.Errors {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       e.Field,
+				Description: e.Message,
+			})
+		}
+		details = append(details, br)
+	}
+	if p.RetryAfterSeconds > 0 {
+		details = append(details, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(time.Duration(p.RetryAfterSeconds) * time.Second),
+		})
+	}
+
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
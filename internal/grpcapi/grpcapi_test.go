@@ -0,0 +1,201 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	pb "github.com/yourorg/failure-uploader/api/proto/failureuploader/v1"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeService records the calls it gets and answers with canned responses
+type fakeService struct {
+	ticketReq      *models.UploadTicketRequest
+	idempotencyKey string
+	principal      string
+}
+
+func (f *fakeService) CreateTicket(ctx context.Context, req *models.UploadTicketRequest) (*models.UploadTicketResponse, *apierror.Problem) {
+	f.ticketReq = req
+	f.principal = middleware.PrincipalID(ctx)
+	return &models.UploadTicketResponse{
+		FailureID: "f-1",
+		S3Prefix:  "failures/myapp/prod/2024/01/02/f-1/",
+		Uploads: models.UploadURLs{
+			Envelope: models.PresignedUpload{Key: "k", PutURL: "https://s3/k", Headers: map[string]string{"x-amz-sdk": "1"}},
+			Files:    []models.PresignedUpload{{Key: "f"}},
+		},
+		ExpiresInSeconds: 900,
+	}, nil
+}
+
+func (f *fakeService) CompleteUpload(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string) (*models.UploadCompleteResponse, bool, *apierror.Problem) {
+	f.idempotencyKey = idempotencyKey
+	return &models.UploadCompleteResponse{Status: "ok"}, true, nil
+}
+
+func (f *fakeService) ReadFailure(ctx context.Context, failureID, project, env, prefix string) (*models.FailureResponse, *apierror.Problem) {
+	return nil, apierror.NotFound("Unknown failure")
+}
+
+// dial serves svc over an in-memory connection with an API key registry
+func dial(t *testing.T, svc Service) *grpc.ClientConn {
+	t.Helper()
+
+	registry, err := apikeys.ParseJSON([]byte(`[
+		{"id":"ios","key":"ios-secret","projects":["myapp"],"scopes":["ticket:create"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAuthenticator(middleware.AuthModeAPIKey, middleware.Authenticators{Registry: registry}, true, false)
+	s, _ := New(svc, auth)
+
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), APIKeyMetadata, key)
+}
+
+func TestCreateUploadTicket(t *testing.T) {
+	svc := &fakeService{}
+	client := pb.NewFailureUploaderServiceClient(dial(t, svc))
+
+	resp, err := client.CreateUploadTicket(withKey("ios-secret"), &pb.CreateUploadTicketRequest{
+		Project: "myapp",
+		Env:     "prod",
+		Request: &pb.RequestInfo{Method: "POST", Url: "https://api.example.com/x", BodyBytes: 12},
+	})
+	if err != nil {
+		t.Fatalf("CreateUploadTicket error = %v", err)
+	}
+
+	if svc.principal != "ios" {
+		t.Errorf("principal = %q, want ios", svc.principal)
+	}
+	if r := svc.ticketReq; r.Project != "myapp" || r.Request.Method != "POST" || r.Request.BodyBytes != 12 || r.Response != nil {
+		t.Errorf("service request = %+v", r)
+	}
+	if resp.FailureId != "f-1" || resp.ExpiresInSeconds != 900 || resp.Uploads.Envelope.PutUrl != "https://s3/k" ||
+		resp.Uploads.Envelope.Headers["x-amz-sdk"] != "1" || len(resp.Uploads.Files) != 1 {
+		t.Errorf("response = %v", resp)
+	}
+}
+
+func TestCompleteUpload_IdempotencyKey(t *testing.T) {
+	svc := &fakeService{}
+	client := pb.NewFailureUploaderServiceClient(dial(t, svc))
+
+	ctx := metadata.AppendToOutgoingContext(withKey("ios-secret"), IdempotencyKeyMetadata, "retry-1")
+	resp, err := client.CompleteUpload(ctx, &pb.CompleteUploadRequest{FailureId: "f-1"})
+	if err != nil {
+		t.Fatalf("CompleteUpload error = %v", err)
+	}
+	if svc.idempotencyKey != "retry-1" || !resp.IdempotentReplayed || resp.Status != "ok" {
+		t.Errorf("key = %q, response = %v", svc.idempotencyKey, resp)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	client := pb.NewFailureUploaderServiceClient(dial(t, &fakeService{}))
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		call func(ctx context.Context) error
+		want codes.Code
+	}{
+		{"missing key", context.Background(), func(ctx context.Context) error {
+			_, err := client.CreateUploadTicket(ctx, &pb.CreateUploadTicketRequest{})
+			return err
+		}, codes.Unauthenticated},
+		{"invalid key", withKey("nope"), func(ctx context.Context) error {
+			_, err := client.CreateUploadTicket(ctx, &pb.CreateUploadTicketRequest{})
+			return err
+		}, codes.Unauthenticated},
+		{"missing scope", withKey("ios-secret"), func(ctx context.Context) error {
+			_, err := client.GetFailure(ctx, &pb.GetFailureRequest{})
+			return err
+		}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call(tt.ctx)); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealth_NoCredentials(t *testing.T) {
+	conn := dial(t, &fakeService{})
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: pb.FailureUploaderService_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatalf("Check error = %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", resp.Status)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	p := apierror.Validation([]apierror.FieldError{{Field: "project", Message: "is required"}})
+	st := status.Convert(statusError(p))
+	if st.Code() != codes.InvalidArgument || st.Message() != "Validation failed" {
+		t.Fatalf("status = %v %q", st.Code(), st.Message())
+	}
+
+	var info *errdetails.ErrorInfo
+	var bad *errdetails.BadRequest
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			info = d
+		case *errdetails.BadRequest:
+			bad = d
+		}
+	}
+	if info == nil || info.Reason != string(apierror.CodeValidation) {
+		t.Errorf("ErrorInfo = %v", info)
+	}
+	if bad == nil || len(bad.FieldViolations) != 1 || bad.FieldViolations[0].Field != "project" {
+		t.Errorf("BadRequest = %v", bad)
+	}
+
+	inProgress := apierror.New(http.StatusConflict, apierror.CodeCompletionInProgress, "in progress").WithRetry(time.Second)
+	if got := status.Code(statusError(inProgress)); got != codes.Aborted {
+		t.Errorf("retryable conflict code = %v, want Aborted", got)
+	}
+	if got := status.Code(statusError(apierror.Dependency(apierror.CodeReadFailed, "x"))); got != codes.Unavailable {
+		t.Errorf("dependency code = %v, want Unavailable", got)
+	}
+}
@@ -0,0 +1,92 @@
+package grpcapi
+
+import (
+	"context"
+
+	pb "github.com/yourorg/failure-uploader/api/proto/failureuploader/v1"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// IdempotencyKeyMetadata carries the idempotency key of CompleteUpload, like
+// the Idempotency-Key header of the REST API
+const IdempotencyKeyMetadata = "idempotency-key"
+
+// Service is the transport-agnostic API the gRPC server exposes; the HTTP
+// handlers are built on the same methods
+type Service interface {
+	CreateTicket(ctx context.Context, req *models.UploadTicketRequest) (*models.UploadTicketResponse, *apierror.Problem)
+	CompleteUpload(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string) (*models.UploadCompleteResponse, bool, *apierror.Problem)
+	ReadFailure(ctx context.Context, failureID, project, env, prefix string) (*models.FailureResponse, *apierror.Problem)
+}
+
+// Server implements the FailureUploaderService on top of a Service
+type Server struct {
+	pb.UnimplementedFailureUploaderServiceServer
+	svc Service
+}
+
+// NewServer creates a gRPC server for svc
+func NewServer(svc Service) *Server {
+	return &Server{svc: svc}
+}
+
+// New creates a grpc.Server serving svc and the standard health service,
+// authenticating calls with auth
+func New(svc Service, auth *Authenticator) (*grpc.Server, *health.Server) {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(recoverer, auth.Unary))
+	pb.RegisterFailureUploaderServiceServer(s, NewServer(svc))
+
+	hs := health.NewServer()
+	hs.SetServingStatus(pb.FailureUploaderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	return s, hs
+}
+
+// CreateUploadTicket issues presigned upload URLs for a new failure
+func (s *Server) CreateUploadTicket(ctx context.Context, req *pb.CreateUploadTicketRequest) (*pb.CreateUploadTicketResponse, error) {
+	resp, p := s.svc.CreateTicket(ctx, ticketRequest(req))
+	if p != nil {
+		return nil, statusError(p)
+	}
+	return ticketResponse(resp), nil
+}
+
+// CompleteUpload verifies a failure's uploads and notifies about it
+func (s *Server) CompleteUpload(ctx context.Context, req *pb.CompleteUploadRequest) (*pb.CompleteUploadResponse, error) {
+	resp, replayed, p := s.svc.CompleteUpload(ctx, completeRequest(req), firstMetadata(ctx, IdempotencyKeyMetadata))
+	if p != nil {
+		return nil, statusError(p)
+	}
+	return &pb.CompleteUploadResponse{
+		Status:             resp.Status,
+		Checksums:          resp.Checksums,
+		Encryption:         encryptionMessage(resp.Encryption),
+		IdempotentReplayed: replayed,
+	}, nil
+}
+
+// GetFailure returns a failure's envelope and a curl command reproducing it
+func (s *Server) GetFailure(ctx context.Context, req *pb.GetFailureRequest) (*pb.GetFailureResponse, error) {
+	resp, p := s.svc.ReadFailure(ctx, req.GetFailureId(), req.GetProject(), req.GetEnv(), req.GetPrefix())
+	if p != nil {
+		return nil, statusError(p)
+	}
+	return &pb.GetFailureResponse{
+		Envelope: envelopeMessage(&resp.Envelope),
+		Curl:     resp.Curl,
+	}, nil
+}
+
+// firstMetadata returns the first value of the incoming metadata key
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/archive"
+	"github.com/yourorg/failure-uploader/internal/audit"
+	"github.com/yourorg/failure-uploader/internal/eventbus"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/retention"
+	"github.com/yourorg/failure-uploader/internal/routing"
+	"github.com/yourorg/failure-uploader/internal/storage"
+	"github.com/yourorg/failure-uploader/internal/validation"
+)
+
+// AdminListProjects handles GET /admin/projects, listing the projects with stored failures
+func (h *Handler) AdminListProjects(w http.ResponseWriter, r *http.Request) {
+	pairs, err := archive.ProjectEnvs(r.Context(), h.presigner)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Msg("failed to list projects")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeListFailed, "Failed to list projects"))
+		return
+	}
+
+	envs := make(map[[2]string][]string)
+	for _, pair := range pairs {
+		p := [2]string{pair.Tenant, pair.Project}
+		envs[p] = append(envs[p], pair.Env)
+	}
+	resp := models.AdminProjectsResponse{Projects: make([]models.AdminProject, 0, len(envs))}
+	for p, e := range envs {
+		sort.Strings(e)
+		resp.Projects = append(resp.Projects, models.AdminProject{Tenant: p[0], Project: p[1], Envs: e})
+	}
+	sort.Slice(resp.Projects, func(i, j int) bool {
+		a, b := resp.Projects[i], resp.Projects[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Project < b.Project
+	})
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminGetProject handles GET /admin/projects/{project}?env=...&tenant=...,
+// returning the configuration in effect for the project's uploads
+func (h *Handler) AdminGetProject(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	env := r.URL.Query().Get("env")
+	tenant, ok := h.tenantQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if errs := validation.ValidateProjectEnv(project, env); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	limits := h.limits(project)
+	resp := models.ProjectConfigResponse{
+		Tenant:             tenant,
+		Project:            project,
+		Env:                env,
+		Limits:             models.ProjectLimits(limits),
+		RequiresEncryption: h.cfg.RequiresEncryption(project),
+	}
+	if h.retention != nil {
+		rule := h.retention.For(project, env)
+		resp.RetentionDays, resp.RetentionAction = rule.Days, string(rule.Action)
+	}
+	if h.routes != nil {
+		route, found, err := h.routes.Resolve(r.Context(), tenant, project, env)
+		if err != nil {
+			logging.FromContext(r.Context()).Error().Err(err).Str("project", project).Msg("failed to resolve notification route")
+			apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read notification route"))
+			return
+		}
+		if found {
+			nr := models.NotificationRoute(route)
+			resp.NotificationRoute = &nr
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminPurgeProject handles POST /admin/projects/{project}/purge, applying the
+// project's retention policy now instead of at the next lifecycle run
+func (h *Handler) AdminPurgeProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := chi.URLParam(r, "project")
+
+	if errs := validation.ValidateProjectEnv(project, ""); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+	if h.retention == nil {
+		apierror.Write(w, r, apierror.NotFound("Retention policies are not configured"))
+		return
+	}
+
+	run, err := retention.PurgeProject(ctx, h.presigner, h.retention, project, time.Now())
+	if run == nil {
+		logging.FromContext(ctx).Error().Err(err).Str("project", project).Msg("failed to purge project")
+		recordAudit(r, audit.ActionProjectPurge, audit.OutcomeFailure, project, nil)
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeDeleteFailed, "Failed to purge project"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("project", project).Msg("project purge incomplete")
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("project", project).
+		Int("purged", len(run.Entries)).
+		Int("failed", len(run.Errors)).
+		Msg("project purge triggered")
+
+	outcome := audit.OutcomeSuccess
+	if err != nil {
+		outcome = audit.OutcomeFailure
+	}
+	recordAudit(r, audit.ActionProjectPurge, outcome, project, map[string]string{
+		"purged": strconv.Itoa(len(run.Entries)),
+		"failed": strconv.Itoa(len(run.Errors)),
+	})
+
+	h.publish(ctx, eventbus.RetentionPurges(run)...)
+	for p, bytes := range run.BytesByProject() {
+		h.storage.Release(ctx, p, bytes)
+	}
+
+	h.writeJSON(w, http.StatusOK, models.PurgeResponse{
+		Project:    project,
+		Purged:     len(run.Entries),
+		Failed:     len(run.Errors),
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Audit:      retention.AuditKey(run.StartedAt),
+	})
+}
+
+// AdminProjectStorage handles GET /admin/projects/{project}/storage, returning
+// the bytes the project stores against its storage budget
+func (h *Handler) AdminProjectStorage(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if errs := validation.ValidateProjectEnv(project, ""); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+	if h.storage == nil {
+		apierror.Write(w, r, apierror.NotFound("Storage tracking is not configured"))
+		return
+	}
+
+	stored, err := h.storage.Stored(r.Context(), project)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("project", project).Msg("failed to read stored bytes")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read storage usage"))
+		return
+	}
+
+	limit := h.limits(project).StorageBudgetBytes
+	h.writeJSON(w, http.StatusOK, models.StorageUsageResponse{
+		Project:     project,
+		StoredBytes: stored,
+		BudgetBytes: limit,
+		ExemptBytes: h.cfg.StorageBudgetExemptBytes,
+		Exceeded:    limit > 0 && stored >= limit,
+	})
+}
+
+// AdminListKeys handles GET /admin/keys, listing configured and managed API keys
+func (h *Handler) AdminListKeys(w http.ResponseWriter, r *http.Request) {
+	managed, err := apikeys.LoadManaged(r.Context(), h.presigner)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Msg("failed to list api keys")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeListFailed, "Failed to list API keys"))
+		return
+	}
+
+	now := time.Now()
+	resp := models.APIKeysResponse{Keys: []models.APIKeyInfo{}}
+	for _, k := range h.apiKeys.Configured() {
+		resp.Keys = append(resp.Keys, models.APIKeyInfo{ID: k.ID, Projects: k.Projects, Scopes: scopeNames(k.Scopes), Tenant: k.Tenant})
+	}
+	for i := range managed {
+		if !h.apiKeys.IsConfigured(managed[i].ID) {
+			resp.Keys = append(resp.Keys, managedKeyInfo(&managed[i], now))
+		}
+	}
+	sort.Slice(resp.Keys, func(i, j int) bool { return resp.Keys[i].ID < resp.Keys[j].ID })
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminCreateKey handles POST /admin/keys. The secret is generated here and
+// returned once; only its hash is stored.
+func (h *Handler) AdminCreateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.CreateAPIKeyRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+	if errs := validation.ValidateCreateAPIKeyRequest(&req); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	exists := h.apiKeys.IsConfigured(req.ID)
+	if !exists {
+		var err error
+		if exists, err = h.presigner.ObjectExists(ctx, apikeys.ManagedKey(req.ID)); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("keyId", req.ID).Msg("failed to check api key")
+			apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to check API key"))
+			return
+		}
+	}
+	if exists {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeKeyExists, "API key already exists").
+			WithDetail("key %q already exists; revoke it first", req.ID))
+		return
+	}
+
+	secret, err := apikeys.GenerateSecret()
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to generate api key")
+		apierror.Write(w, r, apierror.Internal(apierror.CodeUpdateFailed, "Failed to generate API key"))
+		return
+	}
+	now := time.Now().UTC()
+	m := apikeys.Managed{
+		ID:        req.ID,
+		Secrets:   []apikeys.Secret{{Hash: apikeys.HashSecret(secret), CreatedAt: now}},
+		Projects:  req.Projects,
+		Scopes:    make([]apikeys.Scope, 0, len(req.Scopes)),
+		Tenant:    req.Tenant,
+		CreatedAt: now,
+		CreatedBy: middleware.PrincipalID(ctx),
+	}
+	for _, s := range req.Scopes {
+		m.Scopes = append(m.Scopes, apikeys.Scope(s))
+	}
+	if err := apikeys.SaveManaged(ctx, h.presigner, m); err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("keyId", req.ID).Msg("failed to store api key")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeUpdateFailed, "Failed to store API key"))
+		return
+	}
+	h.syncAPIKeys(r)
+
+	logging.FromContext(ctx).Info().
+		Str("keyId", m.ID).
+		Strs("projects", m.Projects).
+		Strs("scopes", req.Scopes).
+		Str("tenant", m.Tenant).
+		Msg("api key created")
+	recordAudit(r, audit.ActionKeyCreate, audit.OutcomeSuccess, m.ID, map[string]string{
+		"projects": strings.Join(m.Projects, ","),
+		"scopes":   strings.Join(req.Scopes, ","),
+		"tenant":   m.Tenant,
+	})
+
+	h.writeJSON(w, http.StatusCreated, models.CreateAPIKeyResponse{APIKeyInfo: managedKeyInfo(&m, now), Key: secret})
+}
+
+// AdminRotateKey handles POST /admin/keys/{id}/rotate. The current secrets keep
+// working for the requested overlap so clients can switch without downtime.
+func (h *Handler) AdminRotateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.RotateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if p := h.decodeJSON(r, &req); p != nil {
+			apierror.Write(w, r, p)
+			return
+		}
+	}
+	if errs := validation.ValidateRotateAPIKeyRequest(&req); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+	overlap := apikeys.DefaultOverlap
+	if req.OverlapSeconds != nil {
+		overlap = time.Duration(*req.OverlapSeconds) * time.Second
+	}
+
+	m, ok := h.loadManagedKey(w, r)
+	if !ok {
+		return
+	}
+	secret, err := apikeys.GenerateSecret()
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to generate api key")
+		apierror.Write(w, r, apierror.Internal(apierror.CodeUpdateFailed, "Failed to generate API key"))
+		return
+	}
+	now := time.Now().UTC()
+	m.Rotate(apikeys.HashSecret(secret), overlap, now)
+	if !h.saveManagedKey(w, r, m) {
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("keyId", m.ID).
+		Dur("overlap", overlap).
+		Msg("api key rotated")
+	recordAudit(r, audit.ActionKeyRotate, audit.OutcomeSuccess, m.ID, map[string]string{"overlap": overlap.String()})
+
+	h.writeJSON(w, http.StatusOK, models.CreateAPIKeyResponse{APIKeyInfo: managedKeyInfo(m, now), Key: secret})
+}
+
+// AdminDisableKey handles POST /admin/keys/{id}/disable
+func (h *Handler) AdminDisableKey(w http.ResponseWriter, r *http.Request) {
+	h.setKeyDisabled(w, r, true)
+}
+
+// AdminEnableKey handles POST /admin/keys/{id}/enable
+func (h *Handler) AdminEnableKey(w http.ResponseWriter, r *http.Request) {
+	h.setKeyDisabled(w, r, false)
+}
+
+// setKeyDisabled disables or re-enables a managed key, keeping its secrets
+func (h *Handler) setKeyDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	m, ok := h.loadManagedKey(w, r)
+	if !ok {
+		return
+	}
+	m.Disabled = disabled
+	if !h.saveManagedKey(w, r, m) {
+		return
+	}
+
+	logging.FromContext(r.Context()).Info().
+		Str("keyId", m.ID).
+		Bool("disabled", disabled).
+		Msg("api key updated")
+	action := audit.ActionKeyEnable
+	if disabled {
+		action = audit.ActionKeyDisable
+	}
+	recordAudit(r, action, audit.OutcomeSuccess, m.ID, nil)
+
+	h.writeJSON(w, http.StatusOK, managedKeyInfo(m, time.Now()))
+}
+
+// AdminRevokeKey handles DELETE /admin/keys/{id}. Keys set by API_KEYS cannot be revoked here.
+func (h *Handler) AdminRevokeKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyID := chi.URLParam(r, "id")
+
+	if _, ok := h.loadManagedKey(w, r); !ok {
+		return
+	}
+	if err := apikeys.DeleteManaged(ctx, h.presigner, keyID); err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("keyId", keyID).Msg("failed to revoke api key")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeDeleteFailed, "Failed to revoke API key"))
+		return
+	}
+	h.syncAPIKeys(r)
+
+	logging.FromContext(ctx).Info().
+		Str("keyId", keyID).
+		Msg("api key revoked")
+	recordAudit(r, audit.ActionKeyRevoke, audit.OutcomeSuccess, keyID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminListRoutes handles GET /admin/routes
+func (h *Handler) AdminListRoutes(w http.ResponseWriter, r *http.Request) {
+	resp := models.RoutesResponse{Routes: make(map[string]models.NotificationRoute)}
+	if h.routes != nil {
+		routes, err := h.routes.Routes(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error().Err(err).Msg("failed to list notification routes")
+			apierror.Write(w, r, apierror.Dependency(apierror.CodeListFailed, "Failed to list notification routes"))
+			return
+		}
+		for name, route := range routes {
+			resp.Routes[name] = models.NotificationRoute(route)
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminPutRoute handles PUT /admin/routes/{project} and /admin/routes/{project}/{env}
+func (h *Handler) AdminPutRoute(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.routeName(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.NotificationRoute
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+	route := routing.Route(req)
+	if err := route.Validate(); err != nil {
+		h.writeValidationErrors(w, r, []validation.ValidationError{{Field: "route", Message: err.Error()}})
+		return
+	}
+
+	var err error = routing.ErrReadOnly
+	if h.routes != nil {
+		err = h.routes.PutRoute(r.Context(), name, route)
+	}
+	if !h.writeRouteError(w, r, name, err) {
+		return
+	}
+
+	logging.FromContext(r.Context()).Info().
+		Str("route", name).
+		Msg("notification route updated")
+	recordAudit(r, audit.ActionRoutePut, audit.OutcomeSuccess, name, nil)
+
+	h.writeJSON(w, http.StatusOK, req)
+}
+
+// AdminDeleteRoute handles DELETE /admin/routes/{project} and /admin/routes/{project}/{env}
+func (h *Handler) AdminDeleteRoute(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.routeName(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := false, routing.ErrReadOnly
+	if h.routes != nil {
+		deleted, err = h.routes.DeleteRoute(r.Context(), name)
+	}
+	if !h.writeRouteError(w, r, name, err) {
+		return
+	}
+	if !deleted {
+		apierror.Write(w, r, apierror.NotFound("Notification route not found"))
+		return
+	}
+
+	logging.FromContext(r.Context()).Info().
+		Str("route", name).
+		Msg("notification route deleted")
+	recordAudit(r, audit.ActionRouteDelete, audit.OutcomeSuccess, name, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// routeName validates the route path parameters and ?tenant= query and
+// returns the route name
+func (h *Handler) routeName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	project, env := chi.URLParam(r, "project"), chi.URLParam(r, "env")
+	tenant, ok := h.tenantQuery(w, r)
+	if !ok {
+		return "", false
+	}
+	if errs := validation.ValidateProjectEnv(project, env); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return "", false
+	}
+	return routing.Name(tenant, project, env), true
+}
+
+// tenantQuery validates the optional ?tenant= query of admin requests
+func (h *Handler) tenantQuery(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant != "" && !validation.ValidTenant(tenant) {
+		h.writeValidationErrors(w, r, []validation.ValidationError{{Field: "tenant", Message: "invalid format"}})
+		return "", false
+	}
+	return tenant, true
+}
+
+// writeRouteError reports a failed route change, returning true when err is nil
+func (h *Handler) writeRouteError(w http.ResponseWriter, r *http.Request, name string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, routing.ErrReadOnly):
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeReadOnly, "Notification routes are read-only").
+			WithDetail("set NOTIFY_ROUTES_BACKEND=dynamodb to manage routes at runtime"))
+	default:
+		logging.FromContext(r.Context()).Error().Err(err).Str("route", name).Msg("failed to change notification route")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeUpdateFailed, "Failed to change notification route"))
+	}
+	return false
+}
+
+// loadManagedKey reads the managed key named by the id path parameter. Keys set
+// by API_KEYS cannot be changed at runtime and are rejected with 409.
+func (h *Handler) loadManagedKey(w http.ResponseWriter, r *http.Request) (*apikeys.Managed, bool) {
+	keyID := chi.URLParam(r, "id")
+	if h.apiKeys.IsConfigured(keyID) {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeReadOnly, "API key is configured by API_KEYS").
+			WithDetail("change key %q in API_KEYS and redeploy instead", keyID))
+		return nil, false
+	}
+
+	m, err := apikeys.LoadManagedKey(r.Context(), h.presigner, keyID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("API key not found"))
+		return nil, false
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("keyId", keyID).Msg("failed to read api key")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read API key"))
+		return nil, false
+	}
+	return m, true
+}
+
+// saveManagedKey stores m and applies it to this instance
+func (h *Handler) saveManagedKey(w http.ResponseWriter, r *http.Request, m *apikeys.Managed) bool {
+	if err := apikeys.SaveManaged(r.Context(), h.presigner, *m); err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("keyId", m.ID).Msg("failed to store api key")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeUpdateFailed, "Failed to store API key"))
+		return false
+	}
+	h.syncAPIKeys(r)
+	return true
+}
+
+// syncAPIKeys reloads managed keys so a change applies on this instance at once;
+// other instances pick it up on their next sync (best-effort)
+func (h *Handler) syncAPIKeys(r *http.Request) {
+	if h.apiKeys == nil {
+		return
+	}
+	if err := h.apiKeys.Sync(r.Context(), h.presigner); err != nil {
+		logging.FromContext(r.Context()).Warn().Err(err).Msg("failed to sync managed api keys")
+	}
+}
+
+// managedKeyInfo describes a managed key and its secrets valid at now
+func managedKeyInfo(m *apikeys.Managed, now time.Time) models.APIKeyInfo {
+	created := m.CreatedAt
+	info := models.APIKeyInfo{
+		ID:        m.ID,
+		Projects:  m.Projects,
+		Scopes:    scopeNames(m.Scopes),
+		Tenant:    m.Tenant,
+		Managed:   true,
+		CreatedAt: &created,
+		CreatedBy: m.CreatedBy,
+		Disabled:  m.Disabled,
+		RotatedAt: m.RotatedAt,
+	}
+	for _, s := range m.Active(now) {
+		info.Secrets = append(info.Secrets, models.APIKeySecret{CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt})
+	}
+	return info
+}
+
+func scopeNames(scopes []apikeys.Scope) []string {
+	names := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		names = append(names, string(s))
+	}
+	return names
+}
@@ -1,76 +1,307 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
 	"net/http"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/google/uuid"
+	"github.com/go-chi/chi/v5"
+	"github.com/yourorg/failure-uploader/api"
+	"github.com/yourorg/failure-uploader/internal/ack"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apigw"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/archive"
+	"github.com/yourorg/failure-uploader/internal/athena"
+	"github.com/yourorg/failure-uploader/internal/audit"
+	"github.com/yourorg/failure-uploader/internal/budget"
+	"github.com/yourorg/failure-uploader/internal/buildinfo"
+	"github.com/yourorg/failure-uploader/internal/canary"
 	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/dedup"
 	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/envelope"
+	"github.com/yourorg/failure-uploader/internal/erasure"
+	"github.com/yourorg/failure-uploader/internal/eventbus"
+	"github.com/yourorg/failure-uploader/internal/groups"
+	"github.com/yourorg/failure-uploader/internal/har"
+	"github.com/yourorg/failure-uploader/internal/headers"
+	"github.com/yourorg/failure-uploader/internal/health"
 	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/links"
 	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/middleware"
 	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/profiles"
+	"github.com/yourorg/failure-uploader/internal/quota"
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/reload"
+	"github.com/yourorg/failure-uploader/internal/replay"
+	"github.com/yourorg/failure-uploader/internal/repro"
+	"github.com/yourorg/failure-uploader/internal/retention"
+	"github.com/yourorg/failure-uploader/internal/routing"
 	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/scan"
+	"github.com/yourorg/failure-uploader/internal/sentry"
+	"github.com/yourorg/failure-uploader/internal/sesevents"
+	"github.com/yourorg/failure-uploader/internal/sniff"
+	"github.com/yourorg/failure-uploader/internal/stats"
+	"github.com/yourorg/failure-uploader/internal/storage"
+	"github.com/yourorg/failure-uploader/internal/thumbs"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+	"github.com/yourorg/failure-uploader/internal/usage"
 	"github.com/yourorg/failure-uploader/internal/validation"
+	"github.com/yourorg/failure-uploader/internal/verify"
+)
+
+// proxyUploadTimeout bounds how long a proxied artifact upload may stream
+const proxyUploadTimeout = 10 * time.Minute
+
+// proxyDownloadTimeout bounds how long a proxied artifact download may stream
+const proxyDownloadTimeout = 10 * time.Minute
+
+// Idempotency headers of upload-complete. Without a key, the failure ID is the key.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
 )
 
 // Handler contains dependencies for HTTP handlers
 type Handler struct {
 	cfg       *config.Config
-	presigner *s3client.Presigner
-	emailer   *email.Sender
+	presigner Store
+	emailer   email.Notifier
+	canary    *canary.Selector
+	dedup     *dedup.Deduper
+	redactor  *redact.Redactor
+	headers   *headers.Policies
+	profiles  *profiles.Profiles
+	usage     usage.Store
+	quotas    *quota.Enforcer
+	storage   *budget.Tracker
+	sesEvents *sesevents.Verifier
+	replayer  *replay.Replayer
+	apiKeys   *apikeys.Registry
+	routes    routing.Editor
+	retention *retention.Policies
+	events    *eventbus.Bus
+	sentry    *sentry.Client
+	catalog   *athena.Catalog
+	health    *health.Checker
+	snapshots *reload.Store
+	verifier  verify.Strategy
+	pending   *verify.Publisher
+	thumbs    *thumbs.Publisher
+	links     *links.Signer
 }
 
 // NewHandler creates a new handler with dependencies
-func NewHandler(cfg *config.Config, presigner *s3client.Presigner, emailer *email.Sender) *Handler {
+func NewHandler(cfg *config.Config, presigner Store, emailer email.Notifier) *Handler {
 	return &Handler{
 		cfg:       cfg,
 		presigner: presigner,
 		emailer:   emailer,
+		redactor:  redact.Default(),
+		verifier:  verify.Once{},
+	}
+}
+
+// WithRedactor replaces the default redaction rules applied to stored metadata
+func (h *Handler) WithRedactor(r *redact.Redactor) *Handler {
+	h.redactor = r
+	return h
+}
+
+// WithHeaderPolicies sets the per-project rules for which captured headers are stored
+func (h *Handler) WithHeaderPolicies(p *headers.Policies) *Handler {
+	h.headers = p
+	return h
+}
+
+// WithProfiles sets the per-project upload limits and validation rules
+func (h *Handler) WithProfiles(p *profiles.Profiles) *Handler {
+	h.profiles = p
+	return h
+}
+
+// WithUsage enables per-key usage queries backed by store
+func (h *Handler) WithUsage(store usage.Store) *Handler {
+	h.usage = store
+	return h
+}
+
+// WithQuotas charges upload tickets against the projects' daily quotas
+func (h *Handler) WithQuotas(e *quota.Enforcer) *Handler {
+	h.quotas = e
+	return h
+}
+
+// WithStorageBudget tracks the bytes projects store and refuses large uploads
+// of projects over their storage budget
+func (h *Handler) WithStorageBudget(t *budget.Tracker) *Handler {
+	h.storage = t
+	return h
+}
+
+// WithCanary routes the selected projects through experimental code paths
+func (h *Handler) WithCanary(s *canary.Selector) *Handler {
+	h.canary = s
+	return h
+}
+
+// WithSESEvents accepts SES bounce and complaint events whose SNS signature v verifies
+func (h *Handler) WithSESEvents(v *sesevents.Verifier) *Handler {
+	h.sesEvents = v
+	return h
+}
+
+// WithReplayer enables replays to the replayer's allowed hosts; without one
+// only dry runs succeed
+func (h *Handler) WithReplayer(rp *replay.Replayer) *Handler {
+	h.replayer = rp
+	return h
+}
+
+// WithAPIKeys lets the admin API manage keys in registry
+func (h *Handler) WithAPIKeys(registry *apikeys.Registry) *Handler {
+	h.apiKeys = registry
+	return h
+}
+
+// WithRoutes lets the admin API show and change notification routes
+func (h *Handler) WithRoutes(routes routing.Editor) *Handler {
+	h.routes = routes
+	return h
+}
+
+// WithRetention enables on-demand purges with policies
+func (h *Handler) WithRetention(policies *retention.Policies) *Handler {
+	h.retention = policies
+	return h
+}
+
+// WithDedup throttles repeated identical failure notifications
+func (h *Handler) WithDedup(d *dedup.Deduper) *Handler {
+	h.dedup = d
+	return h
+}
+
+// WithEvents publishes failure lifecycle events to bus
+func (h *Handler) WithEvents(bus *eventbus.Bus) *Handler {
+	h.events = bus
+	return h
+}
+
+// WithSentry forwards completed failures to Sentry
+func (h *Handler) WithSentry(c *sentry.Client) *Handler {
+	h.sentry = c
+	return h
+}
+
+// WithCatalog registers the metadata index's partitions in the Glue Data Catalog
+func (h *Handler) WithCatalog(c *athena.Catalog) *Handler {
+	h.catalog = c
+	return h
+}
+
+// WithHealth sets the dependency checks run by the readiness endpoint
+func (h *Handler) WithHealth(c *health.Checker) *Handler {
+	h.health = c
+	return h
+}
+
+// WithReload takes the upload limits and project profiles from the current
+// snapshot of store instead of the startup configuration
+func (h *Handler) WithReload(store *reload.Store) *Handler {
+	h.snapshots = store
+	return h
+}
+
+// WithVerification checks the uploads of a completion with s, e.g. retrying
+// keys that are not visible yet
+func (h *Handler) WithVerification(s verify.Strategy) *Handler {
+	h.verifier = s
+	return h
+}
+
+// WithPendingVerification accepts upload completions as pending and queues
+// them to p, to be verified and processed by ProcessVerification
+func (h *Handler) WithPendingVerification(p *verify.Publisher) *Handler {
+	h.pending = p
+	return h
+}
+
+// WithThumbnails queues the image attachments of completed failures to p for
+// thumbnails, and links them in listings and notifications
+func (h *Handler) WithThumbnails(p *thumbs.Publisher) *Handler {
+	h.thumbs = p
+	return h
+}
+
+// WithLinks links notifications to artifacts and acknowledgments through
+// links signed by s, served by RedirectArtifact and AckLink
+func (h *Handler) WithLinks(s *links.Signer) *Handler {
+	h.links = s
+	return h
+}
+
+// limitsConfig returns the configuration and project profiles that upload
+// limits are computed from, both from the same snapshot
+func (h *Handler) limitsConfig() (*config.Config, *profiles.Profiles) {
+	if snap := h.snapshots.Current(); snap != nil {
+		return snap.Config, snap.Profiles
 	}
+	return h.cfg, h.profiles
+}
+
+// limits returns the effective upload limits of project
+func (h *Handler) limits(project string) profiles.Profile {
+	cfg, profs := h.limitsConfig()
+	return validation.Limits(cfg, profs, project)
 }
 
 // UploadTicket handles POST /v1/upload-ticket
 func (h *Handler) UploadTicket(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
 	var req models.UploadTicketRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse request body", err.Error())
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
 		return
 	}
 
-	// Validate request
-	if errs := validation.ValidateUploadTicketRequest(&req, h.cfg); len(errs) > 0 {
-		h.writeValidationErrors(w, errs)
+	resp, p := h.CreateTicket(r.Context(), &req)
+	if p != nil {
+		apierror.Write(w, r, p)
 		return
 	}
 
-	// Generate failure ID and build keys
-	failureID := uuid.New().String()
-	keyBuilder := keys.NewBuilder(req.Project, req.Env, failureID)
-
-	logging.Info().
-		Str("failureId", failureID).
-		Str("project", req.Project).
-		Str("env", req.Env).
-		Msg("creating upload ticket")
+	h.writeJSON(w, http.StatusOK, resp)
+}
 
-	// Generate presigned URLs
-	uploads, err := h.generatePresignedURLs(ctx, keyBuilder, &req)
-	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "presign_failed", "Failed to generate presigned URLs", "")
+// RetryUploadPresign handles POST /v1/upload-ticket/{failureId}/presign
+func (h *Handler) RetryUploadPresign(w http.ResponseWriter, r *http.Request) {
+	var req models.PresignRetryRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
 		return
 	}
 
-	resp := models.UploadTicketResponse{
-		FailureID:        failureID,
-		S3Prefix:         keyBuilder.Prefix(),
-		Uploads:          *uploads,
-		ExpiresInSeconds: int(h.cfg.PresignTTL.Seconds()),
+	resp, p := h.RetryPresign(r.Context(), chi.URLParam(r, "failureId"), &req)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
 	}
 
 	h.writeJSON(w, http.StatusOK, resp)
@@ -78,188 +309,2053 @@ func (h *Handler) UploadTicket(w http.ResponseWriter, r *http.Request) {
 
 // UploadComplete handles POST /v1/upload-complete
 func (h *Handler) UploadComplete(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
 	var req models.UploadCompleteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "invalid_json", "Failed to parse request body", err.Error())
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	resp, replayed, p := h.CompleteUpload(r.Context(), &req, r.Header.Get(IdempotencyKeyHeader))
+	if p != nil {
+		apierror.Write(w, r, p)
 		return
 	}
 
+	if replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	status := http.StatusOK
+	if resp.Status == models.CompletionPending {
+		status = http.StatusAccepted
+	}
+	h.writeJSON(w, status, resp)
+}
+
+// UploadArtifact handles PUT /v1/failures/{failureId}/artifacts/{name}, streaming the
+// body to S3 for clients that cannot reach presigned URLs directly
+func (h *Handler) UploadArtifact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+	name := chi.URLParam(r, "*")
+	q := r.URL.Query()
+	project, env, prefix := q.Get("project"), q.Get("env"), q.Get("prefix")
+
 	// Validate request
-	if errs := validation.ValidateUploadCompleteRequest(&req); len(errs) > 0 {
-		h.writeValidationErrors(w, errs)
+	if errs := validation.ValidateArtifactUpload(project, env, prefix, failureID, name); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
 		return
 	}
 
-	logging.Info().
-		Str("failureId", req.FailureID).
-		Str("project", req.Project).
-		Str("env", req.Env).
-		Int("uploadedKeys", len(req.UploadedKeys)).
-		Msg("processing upload complete")
+	if !h.authorizeProject(w, r, project) || !h.authorizeTenant(w, r, prefix) {
+		return
+	}
 
-	// Verify all uploaded keys exist in S3
-	missing, err := h.presigner.VerifyObjectsExist(ctx, req.UploadedKeys)
+	// Only the uploads of an open ticket may be written, so completed failures
+	// cannot be overwritten past redaction and the checks of upload-complete
+	key := path.Join(prefix, name)
+	rec, err := tickets.Get(ctx, h.presigner, failureID)
+	if errors.Is(err, tickets.ErrNotFound) || (err == nil && (rec.Project != project || rec.Env != env || rec.S3Prefix != prefix)) {
+		apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeNoTicket, "No upload ticket tracked for this failure"))
+		return
+	}
 	if err != nil {
-		logging.Error().Err(err).Msg("failed to verify objects")
-		h.writeError(w, http.StatusInternalServerError, "verification_failed", "Failed to verify uploaded objects", "")
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to read upload ticket")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read upload ticket"))
+		return
+	}
+	if rec.State != tickets.StateIssued {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeAlreadyCompleted, "Upload ticket is no longer open").
+			WithDetail("the ticket is %s", rec.State))
+		return
+	}
+	// checksums.json is issued with every ticket but not expected
+	if name != "checksums.json" && !slices.Contains(rec.Expected, key) {
+		apierror.Write(w, r, apierror.NotFound("Artifact is not an upload of this ticket"))
 		return
 	}
 
-	if len(missing) > 0 {
-		logging.Warn().
-			Str("failureId", req.FailureID).
-			Strs("missing", missing).
-			Msg("missing objects in S3")
-		h.writeError(w, http.StatusBadRequest, "missing_objects", "Some objects were not found in S3", "")
+	// Uploads are capped at the size their ticket declared, or their limit
+	var declared models.RequestInfo
+	if rec.Request != nil {
+		declared = *rec.Request
+	}
+	limit := validation.AllowedSize(name, &declared, rec.Artifacts, h.limits(project), h.cfg.UploadSizeTolerancePercent)
+	if r.ContentLength > limit {
+		apierror.Write(w, r, apierror.TooLarge("Artifact exceeds maximum allowed size", limit))
 		return
 	}
 
-	// Locate envelope key from uploadedKeys (don't try to re-compute date-based prefixes).
-	envelopeKey := ""
-	for _, k := range req.UploadedKeys {
-		if strings.HasSuffix(k, "/envelope.json") || k == "envelope.json" {
-			envelopeKey = k
-			break
-		}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
 	}
 
-	// Generate presigned GET URL for envelope (best-effort)
-	envelopeURL := ""
-	if envelopeKey != "" {
-		envelopeURL, err = h.presigner.PresignGet(ctx, envelopeKey)
-		if err != nil {
-			logging.Error().Err(err).Msg("failed to generate envelope URL")
-			envelopeURL = ""
+	// Large bodies outlive the server's default read timeout
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(proxyUploadTimeout)
+	if err := rc.SetReadDeadline(deadline); err == nil {
+		_ = rc.SetWriteDeadline(deadline)
+	}
+
+	body := &countingReader{r: http.MaxBytesReader(w, r.Body, limit)}
+	if err := h.presigner.Upload(ctx, key, contentType, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Write(w, r, apierror.TooLarge("Artifact exceeds maximum allowed size", limit))
+			return
 		}
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Str("key", key).Msg("failed to upload artifact")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeUploadFailed, "Failed to store artifact"))
+		return
 	}
 
-	// Read envelope.json from S3 (best-effort) to enrich email content.
-	var envObj models.Envelope
-	if envelopeKey != "" {
-		b, err := h.presigner.GetObjectBytes(ctx, envelopeKey)
-		if err != nil {
-			logging.Warn().Err(err).Str("key", envelopeKey).Msg("failed to read envelope from S3")
-		} else if err := json.Unmarshal(b, &envObj); err != nil {
-			logging.Warn().Err(err).Str("key", envelopeKey).Msg("failed to parse envelope.json")
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Str("key", key).
+		Int64("bytes", body.n).
+		Msg("artifact uploaded")
+
+	h.writeJSON(w, http.StatusOK, models.ArtifactUploadResponse{Key: key, Bytes: body.n})
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// DownloadArtifact handles GET /v1/failures/{failureId}/artifacts/{name}?project=...&env=...&prefix=...,
+// streaming the artifact from S3 for clients that cannot reach presigned URLs.
+// Range headers are passed through, so interrupted downloads can resume.
+func (h *Handler) DownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "*")
+	if !validation.ValidArtifactName(name) {
+		apierror.Write(w, r, apierror.NotFound("Unknown artifact"))
+		return
+	}
+	envObj, prefix, ok := h.loadFailure(w, r)
+	if !ok {
+		return
+	}
+
+	key := path.Join(prefix, name)
+	scans, p := h.scanRecords(ctx, envObj.FailureID)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+	if scans != nil {
+		if p := scanProblem(scanStatusOf(scans, key)); p != nil {
+			apierror.Write(w, r, p)
+			return
 		}
 	}
 
-	// Send email notification
-	if h.emailer != nil {
-		notif := email.FailureNotification{
-			FailureID:   req.FailureID,
-			Project:     req.Project,
-			Env:         req.Env,
-			Method:      envObj.Request.Method,
-			URL:         envObj.Request.URL,
-			AppVersion:  envObj.Client.AppVersion,
-			Platform:    envObj.Client.Platform,
-			EnvelopeURL: envelopeURL,
+	obj, err := h.presigner.OpenObject(ctx, key, r.Header.Get("Range"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		apierror.Write(w, r, apierror.NotFound("Unknown artifact"))
+		return
+	case errors.Is(err, storage.ErrInvalidRange):
+		if sizes, err := h.presigner.ObjectSizes(ctx, []string{key}); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", sizes[key]))
 		}
+		apierror.Write(w, r, apierror.New(http.StatusRequestedRangeNotSatisfiable, apierror.CodeInvalidRange, "Requested range not satisfiable"))
+		return
+	case err != nil:
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", envObj.FailureID).Str("key", key).Msg("failed to open artifact")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read artifact"))
+		return
+	}
+	defer obj.Body.Close()
 
-		if err := h.emailer.SendFailureNotification(ctx, notif); err != nil {
-			logging.Error().Err(err).Msg("failed to send email notification")
-			// Don't fail the request if email fails
+	// Buffered Lambda responses cannot carry large artifacts; send the client to S3
+	if limit := apigw.ResponseLimit(ctx); limit > 0 && obj.ContentLength > limit {
+		url, err := h.presigner.PresignGet(ctx, key)
+		if err != nil {
+			apierror.Write(w, r, apierror.Dependency(apierror.CodePresignFailed, "Failed to generate download URL"))
+			return
 		}
+		logging.FromContext(ctx).Info().
+			Str("failureId", envObj.FailureID).
+			Str("key", key).
+			Int64("bytes", obj.ContentLength).
+			Msg("artifact download redirected")
+		setEncryptionHeaders(w, envObj.Encryption)
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, url, http.StatusFound)
+		return
 	}
 
-	logging.Info().
-		Str("failureId", req.FailureID).
-		Msg("upload complete processed successfully")
+	header := w.Header()
+	header.Set("Content-Type", artifactContentType(envObj, name, obj.ContentType))
+	header.Set("Content-Length", strconv.FormatInt(obj.ContentLength, 10))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Cache-Control", "private, no-store")
+	if obj.ETag != "" {
+		header.Set("ETag", obj.ETag)
+	}
+	if !obj.LastModified.IsZero() {
+		header.Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+	setEncryptionHeaders(w, envObj.Encryption)
+	status := http.StatusOK
+	if obj.ContentRange != "" {
+		header.Set("Content-Range", obj.ContentRange)
+		status = http.StatusPartialContent
+	}
+
+	// Large artifacts outlive the server's default write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(proxyDownloadTimeout))
+
+	w.WriteHeader(status)
+	n, err := io.Copy(w, obj.Body)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", envObj.FailureID).Str("key", key).Int64("bytes", n).Msg("artifact download interrupted")
+		return
+	}
 
-	h.writeJSON(w, http.StatusOK, models.UploadCompleteResponse{Status: "ok"})
+	logging.FromContext(ctx).Info().
+		Str("failureId", envObj.FailureID).
+		Str("key", key).
+		Str("range", obj.ContentRange).
+		Int64("bytes", n).
+		Msg("artifact downloaded")
 }
 
-// HealthCheck handles GET /health
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	h.writeJSON(w, http.StatusOK, map[string]string{
-		"status": "healthy",
-		"time":   time.Now().UTC().Format(time.RFC3339),
-	})
+// setEncryptionHeaders tells the caller how to decrypt artifacts of a failure
+// encrypted client-side with enc, which are served as stored
+func setEncryptionHeaders(w http.ResponseWriter, enc *models.Encryption) {
+	if enc == nil {
+		return
+	}
+	w.Header().Set(links.HeaderAlgorithm, enc.Algorithm)
+	w.Header().Set(links.HeaderKeyID, enc.KeyID)
+	w.Header().Set(links.HeaderIV, enc.IV)
+}
+
+// artifactContentType returns the content type to serve artifact name of
+// envObj with: the type the envelope declares, else the one stored with the
+// object, else the one of its extension. Encrypted artifacts are opaque.
+func artifactContentType(envObj *models.Envelope, name, stored string) string {
+	if envObj.Encryption != nil {
+		return "application/octet-stream"
+	}
+	if t := declaredTypes(envObj)[name]; t != "" {
+		return t
+	}
+	// S3 reports objects stored without a type as binary/octet-stream
+	if stored != "" && stored != "binary/octet-stream" {
+		return stored
+	}
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
 }
 
-func (h *Handler) generatePresignedURLs(ctx context.Context, kb *keys.Builder, req *models.UploadTicketRequest) (*models.UploadURLs, error) {
-	uploads := &models.UploadURLs{}
+// RestoreFailure handles POST /v1/failures/{failureId}/restore
+func (h *Handler) RestoreFailure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
 
-	// Envelope
-	url, err := h.presigner.PresignPut(ctx, kb.Envelope(), "application/json")
-	if err != nil {
-		return nil, err
+	var req models.RestoreRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
 	}
-	uploads.Envelope = models.PresignedUpload{Key: kb.Envelope(), PutURL: url}
 
-	// Request raw
-	contentType := req.Request.ContentType
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	// Validate request
+	if errs := validation.ValidateRestoreRequest(&req, failureID); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
 	}
-	url, err = h.presigner.PresignPut(ctx, kb.RequestRaw(), contentType)
+
+	if !h.authorizeProject(w, r, req.Project) || !h.authorizeTenant(w, r, req.S3Prefix) {
+		return
+	}
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
+
+	restored, err := archive.Restore(ctx, h.presigner, req.S3Prefix, int32(h.cfg.RestoreDays))
 	if err != nil {
-		return nil, err
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to restore failure")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeRestoreFailed, "Failed to restore archived objects"))
+		return
+	}
+
+	if restored == 0 {
+		apierror.Write(w, r, apierror.NotFound("No objects found for this failure"))
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Int("objects", restored).
+		Msg("restore requested")
+
+	h.writeJSON(w, http.StatusAccepted, models.RestoreResponse{
+		Status:  "restoring",
+		Objects: restored,
+		Days:    h.cfg.RestoreDays,
+	})
+}
+
+// ReleaseFailure handles POST /v1/failures/{failureId}/release, clearing the
+// artifacts the malware scan withholds: quarantined ones are moved back and
+// ones the scanner could not scan become downloadable
+func (h *Handler) ReleaseFailure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+
+	var req models.ReleaseRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	if errs := validation.ValidateReleaseRequest(&req, failureID); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !h.authorizeProject(w, r, req.Project) || !h.authorizeTenant(w, r, req.S3Prefix) {
+		return
 	}
-	uploads.RequestRaw = models.PresignedUpload{Key: kb.RequestRaw(), PutURL: url}
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
 
-	// Request headers
-	url, err = h.presigner.PresignPut(ctx, kb.RequestHeaders(), "application/json")
+	principal := middleware.PrincipalID(ctx)
+	now := time.Now().UTC()
+	released, err := scan.Release(ctx, h.presigner, failureID, req.S3Prefix, principal, now)
 	if err != nil {
-		return nil, err
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to release failure")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeUpdateFailed, "Failed to release withheld artifacts"))
+		return
+	}
+
+	if len(released) == 0 {
+		apierror.Write(w, r, apierror.NotFound("No withheld artifacts for this failure"))
+		return
+	}
+
+	resp := models.ReleaseResponse{Status: "released", ReleasedBy: principal, ReleasedAt: now}
+	for _, rec := range released {
+		resp.Artifacts = append(resp.Artifacts, strings.TrimPrefix(rec.Key, req.S3Prefix))
+	}
+
+	logging.FromContext(ctx).Warn().
+		Str("failureId", failureID).
+		Strs("artifacts", resp.Artifacts).
+		Msg("withheld artifacts released")
+	recordAudit(r, audit.ActionFailureRelease, audit.OutcomeSuccess, failureID, map[string]string{
+		"project":   req.Project,
+		"env":       req.Env,
+		"prefix":    req.S3Prefix,
+		"artifacts": strings.Join(resp.Artifacts, ","),
+	})
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// GetFailure handles GET /v1/failures/{failureId}?project=...&env=...&prefix=...,
+// returning the stored envelope and a curl command reproducing the request
+func (h *Handler) GetFailure(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	resp, p := h.ReadFailure(r.Context(), chi.URLParam(r, "failureId"), q.Get("project"), q.Get("env"), q.Get("prefix"))
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
 	}
-	uploads.RequestHeaders = models.PresignedUpload{Key: kb.RequestHeaders(), PutURL: url}
 
-	// Response raw
-	url, err = h.presigner.PresignPut(ctx, kb.ResponseRaw(), "application/octet-stream")
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// ListFailures handles GET /v1/failures?project=...&env=...&days=...&limit=...&severity=...&tag=...,
+// listing the most recent failures of a project and env, optionally only
+// those of a severity or carrying tags
+func (h *Handler) ListFailures(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	errs := validation.ValidateListFailures(q.Get("project"), q.Get("env"), q.Get("days"), q.Get("limit"))
+	filter, ferrs := validation.ParseFailureFilter(q.Get("severity"), q["tag"])
+	if errs = append(errs, ferrs...); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+	days, err := strconv.Atoi(q.Get("days"))
 	if err != nil {
-		return nil, err
+		days = validation.DefaultListDays
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = validation.DefaultListLimit
+	}
+
+	resp, p := h.ListRecentFailures(r.Context(), q.Get("project"), q.Get("env"), days, limit, filter)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
 	}
-	uploads.ResponseRaw = models.PresignedUpload{Key: kb.ResponseRaw(), PutURL: url}
 
-	// Checksums
-	url, err = h.presigner.PresignPut(ctx, kb.Checksums(), "application/json")
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// GetDownloads handles GET /v1/failures/{failureId}/downloads?project=...&env=...&prefix=...,
+// returning a presigned download URL for each stored artifact the malware scan
+// does not withhold
+func (h *Handler) GetDownloads(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	envObj, prefix, ok := h.loadFailure(w, r)
+	if !ok {
+		return
+	}
+
+	objects, err := h.presigner.ListKeys(ctx, prefix)
 	if err != nil {
-		return nil, err
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", envObj.FailureID).Msg("failed to list failure artifacts")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeListFailed, "Failed to list failure artifacts"))
+		return
+	}
+	scans, p := h.scanRecords(ctx, envObj.FailureID)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+	// Quarantined artifacts are listed without a link, sized by their copies
+	var quarantined []*scan.Record
+	for _, rec := range scans.Quarantined() {
+		if strings.HasPrefix(rec.Key, prefix) {
+			quarantined = append(quarantined, rec)
+		}
+	}
+	sizeKeys := append([]string{}, objects...)
+	for _, rec := range quarantined {
+		sizeKeys = append(sizeKeys, rec.QuarantineKey)
+	}
+	sizes, err := h.presigner.ObjectSizes(ctx, sizeKeys)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", envObj.FailureID).Msg("failed to read failure artifact sizes")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read failure artifacts"))
+		return
 	}
-	uploads.Checksums = models.PresignedUpload{Key: kb.Checksums(), PutURL: url}
 
-	// Files
-	for _, file := range req.Request.Files {
-		ct := file.ContentType
-		if ct == "" {
-			ct = "application/octet-stream"
+	resp := models.DownloadsResponse{
+		Artifacts:        make([]models.ArtifactDownload, 0, len(objects)+len(quarantined)),
+		ExpiresInSeconds: int(h.cfg.PresignTTL.Seconds()),
+		Encryption:       envObj.Encryption,
+	}
+	for _, k := range objects {
+		artifact := models.ArtifactDownload{
+			Name:  strings.TrimPrefix(k, prefix),
+			Bytes: sizes[k],
 		}
-		url, err = h.presigner.PresignPut(ctx, kb.File(file.Filename), ct)
-		if err != nil {
-			return nil, err
+		if scans != nil {
+			artifact.ScanStatus = scanStatusOf(scans, k)
+		}
+		if artifact.ScanStatus == "" {
+			url, err := h.presigner.PresignGet(ctx, k)
+			if err != nil {
+				apierror.Write(w, r, apierror.Dependency(apierror.CodePresignFailed, "Failed to generate download URL"))
+				return
+			}
+			artifact.URL = url
 		}
-		uploads.Files = append(uploads.Files, models.PresignedUpload{
-			Key:    kb.File(file.Filename),
-			PutURL: url,
+		resp.Artifacts = append(resp.Artifacts, artifact)
+	}
+	for _, rec := range quarantined {
+		resp.Artifacts = append(resp.Artifacts, models.ArtifactDownload{
+			Name:       strings.TrimPrefix(rec.Key, prefix),
+			Bytes:      sizes[rec.QuarantineKey],
+			ScanStatus: scan.StatusQuarantined,
 		})
 	}
 
-	return uploads, nil
+	logging.FromContext(ctx).Info().
+		Str("failureId", envObj.FailureID).
+		Int("artifacts", len(resp.Artifacts)).
+		Msg("failure download links generated")
+
+	h.writeJSON(w, http.StatusOK, resp)
 }
 
-func (h *Handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+// GetFailureHAR handles GET /v1/failures/{failureId}/har?project=...&env=...&prefix=...,
+// returning the failure as a HAR document for browser dev tools and proxies
+func (h *Handler) GetFailureHAR(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	envObj, prefix, ok := h.loadFailure(w, r)
+	if !ok {
+		return
+	}
+	if envObj.Encryption != nil {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeEncrypted, "Failure artifacts are encrypted client-side"))
+		return
+	}
+
+	doc, err := har.Assemble(ctx, h.presigner, envObj, prefix, h.redactor)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", envObj.FailureID).Msg("failed to assemble HAR")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read failure"))
+		return
+	}
+	b, err := doc.Marshal()
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", envObj.FailureID).Msg("failed to encode HAR")
+		apierror.Write(w, r, apierror.Internal(apierror.CodeReadFailed, "Failed to encode HAR"))
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", envObj.FailureID).
+		Msg("failure exported as HAR")
+
+	w.Header().Set("Content-Type", har.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.har"`, envObj.FailureID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
 }
 
-func (h *Handler) writeError(w http.ResponseWriter, status int, code, message, details string) {
-	resp := models.ErrorResponse{
-		Error:   message,
-		Code:    code,
-		Details: details,
+// loadFailure reads the envelope of the failure the request looks up. On
+// failure it writes the error response and returns false.
+func (h *Handler) loadFailure(w http.ResponseWriter, r *http.Request) (*models.Envelope, string, bool) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	envObj, p := h.lookupFailure(r.Context(), chi.URLParam(r, "failureId"), q.Get("project"), q.Get("env"), prefix)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return nil, "", false
 	}
-	h.writeJSON(w, status, resp)
+	return envObj, prefix, true
+}
+
+// ReplayFailure handles POST /v1/failures/{failureId}/replay, re-sending the
+// captured request to its original or an overridden host
+func (h *Handler) ReplayFailure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+
+	var req models.ReplayRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	if errs := validation.ValidateReplayRequest(&req, failureID); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !h.authorizeProject(w, r, req.Project) || !h.authorizeTenant(w, r, req.S3Prefix) {
+		return
+	}
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
+
+	envObj, p := h.readEnvelope(ctx, failureID, req.S3Prefix)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+	if envObj.Encryption != nil {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeEncrypted, "Failure artifacts are encrypted client-side"))
+		return
+	}
+
+	planned, err := replay.Prepare(h.capturedRequest(ctx, envObj, req.S3Prefix, -1), replay.Options{
+		BaseURL: req.BaseURL,
+		Headers: req.Headers,
+	})
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(apierror.CodeReplayFailed, "Captured request cannot be replayed").WithDetail("%v", err))
+		return
+	}
+
+	resp := models.ReplayResponse{
+		DryRun: req.DryRun,
+		Request: models.ReplayedRequest{
+			Method:    planned.Method,
+			URL:       h.redactor.URL(planned.URL),
+			Headers:   h.redactor.Headers(planned.Headers),
+			BodyBytes: len(planned.Body),
+		},
+	}
+	if req.DryRun {
+		metrics.Replays.Inc(req.Project, "dry_run")
+		h.writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	res, err := h.replayer.Send(ctx, planned)
+	if errors.Is(err, replay.ErrHostNotAllowed) {
+		apierror.Write(w, r, apierror.Forbidden("Replay target host is not allowed").WithDetail("Add the host to REPLAY_ALLOWED_HOSTS or use dryRun"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(apierror.CodeReplayFailed, "Captured request cannot be replayed").WithDetail("%v", err))
+		return
+	}
+
+	resp.Response = h.replayResult(envObj, res)
+	outcome := "failed"
+	switch {
+	case res.Err != nil && res.StatusCode == 0:
+		outcome = "error"
+	case resp.Response.Resolved:
+		outcome = "resolved"
+	}
+	metrics.Replays.Inc(req.Project, outcome)
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Str("url", resp.Request.URL).
+		Int("statusCode", res.StatusCode).
+		Str("outcome", outcome).
+		Msg("failure replayed")
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// replayResult summarizes a replay's response, redacting it like captured metadata
+func (h *Handler) replayResult(envObj *models.Envelope, res *replay.Result) *models.ReplayResult {
+	out := &models.ReplayResult{
+		StatusCode: res.StatusCode,
+		DurationMs: res.Duration.Milliseconds(),
+		BodyBytes:  len(res.Body),
+		Truncated:  res.Truncated,
+		Resolved:   res.Err == nil && res.StatusCode > 0 && res.StatusCode < 400,
+	}
+	if res.Err != nil {
+		out.Error = res.Err.Error()
+	}
+	if res.Headers != nil {
+		out.Headers = h.redactor.Headers(res.Headers)
+	}
+	if envObj.Response != nil {
+		out.OriginalStatusCode = envObj.Response.StatusCode
+	}
+	// Binary bodies are only counted
+	switch {
+	case !utf8.Valid(res.Body):
+	case json.Valid(res.Body):
+		if redacted, err := h.redactor.JSON(res.Body); err == nil {
+			out.Body = string(redacted)
+		}
+	default:
+		out.Body = h.redactor.String(string(res.Body))
+	}
+	return out
+}
+
+// DeleteFailure handles DELETE /v1/failures/{failureId}, erasing every object of
+// the failure and its index records, e.g. for a GDPR erasure request
+func (h *Handler) DeleteFailure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+	q := r.URL.Query()
+	project, env, prefix := q.Get("project"), q.Get("env"), q.Get("prefix")
+
+	if errs := validation.ValidateDeleteFailure(project, env, prefix, failureID); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !h.authorizeProject(w, r, project) || !h.authorizeTenant(w, r, prefix) {
+		return
+	}
+
+	principal := middleware.PrincipalID(ctx)
+	rec, err := erasure.Erase(ctx, h.presigner, erasure.Request{
+		FailureID: failureID,
+		Project:   project,
+		Env:       env,
+		Prefix:    prefix,
+		Principal: principal,
+	}, time.Now())
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to delete failure")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeDeleteFailed, "Failed to delete failure"))
+		return
+	}
+
+	if rec.Objects == 0 && len(rec.Records) == 0 {
+		apierror.Write(w, r, apierror.NotFound("No objects found for this failure"))
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Int("objects", rec.Objects).
+		Int("records", len(rec.Records)).
+		Msg("failure deleted")
+	recordAudit(r, audit.ActionFailureDelete, audit.OutcomeSuccess, failureID, map[string]string{
+		"project": project,
+		"env":     env,
+		"prefix":  prefix,
+		"objects": strconv.Itoa(rec.Objects),
+	})
+
+	loc, _ := keys.Parse(prefix)
+	h.publish(ctx, eventbus.Purged{
+		Version:   eventbus.SchemaVersion,
+		FailureID: failureID,
+		Tenant:    loc.Tenant,
+		Project:   project,
+		Env:       env,
+		Prefix:    prefix,
+		Reason:    eventbus.ReasonDeleted,
+		Action:    string(retention.ActionDelete),
+		Objects:   rec.Objects,
+		Principal: principal,
+		PurgedAt:  rec.DeletedAt,
+	})
+	h.storage.Release(ctx, project, rec.Bytes)
+
+	h.writeJSON(w, http.StatusOK, models.DeleteFailureResponse{
+		Status:    "deleted",
+		Objects:   rec.Objects,
+		Records:   len(rec.Records),
+		DeletedAt: rec.DeletedAt,
+	})
+}
+
+// EraseUser handles POST /v1/admin/erasure, deleting every failure indexed for a
+// user in the projects the caller may access
+func (h *Handler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.UserErasureRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	if errs := validation.ValidateUserErasureRequest(&req); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	allowed := func(string, string) bool { return true }
+	if p := middleware.PrincipalFromContext(ctx); p != nil {
+		tenant := h.tenant(ctx)
+		allowed = func(project, prefix string) bool {
+			return p.AllowsProject(project) && (!h.cfg.MultiTenant || validation.TenantOwns(tenant, prefix))
+		}
+	}
+
+	principal := middleware.PrincipalID(ctx)
+	userHash := tickets.HashUserID(h.cfg.UserIDHashKey, req.UserID)
+	rec, err := erasure.EraseUser(ctx, h.presigner, userHash, principal, allowed, time.Now())
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("userHash", userHash).Msg("failed to erase user")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeDeleteFailed, "Failed to erase user"))
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("userHash", userHash).
+		Int("failures", len(rec.Failures)).
+		Int("skipped", len(rec.Skipped)).
+		Int("objects", rec.Objects).
+		Msg("user erased")
+	recordAudit(r, audit.ActionUserErase, audit.OutcomeSuccess, userHash, map[string]string{
+		"failures": strconv.Itoa(len(rec.Failures)),
+		"objects":  strconv.Itoa(rec.Objects),
+	})
+
+	events := make([]eventbus.Event, 0, len(rec.Erased))
+	for _, e := range rec.Erased {
+		loc, _ := keys.Parse(e.Prefix)
+		events = append(events, eventbus.Purged{
+			Version:   eventbus.SchemaVersion,
+			FailureID: e.FailureID,
+			Tenant:    loc.Tenant,
+			Project:   e.Project,
+			Env:       e.Env,
+			Prefix:    e.Prefix,
+			Reason:    eventbus.ReasonUserErasure,
+			Action:    string(retention.ActionDelete),
+			Objects:   e.Objects,
+			Principal: principal,
+			PurgedAt:  e.DeletedAt,
+		})
+		h.storage.Release(ctx, e.Project, e.Bytes)
+	}
+	h.publish(ctx, events...)
+
+	h.writeJSON(w, http.StatusOK, models.UserErasureResponse{
+		Status:    "deleted",
+		Failures:  rec.Failures,
+		Skipped:   rec.Skipped,
+		Objects:   rec.Objects,
+		DeletedAt: rec.DeletedAt,
+	})
+}
+
+// maxSNSMessageBytes bounds an SNS delivery; SNS messages are at most 256 KiB
+const maxSNSMessageBytes = 320 << 10
+
+// SESEvents handles POST /v1/ses-events, the SNS subscription delivering SES
+// bounce and complaint events. Requests carry no API key; they are
+// authenticated by their SNS signature and must come from the configured topic.
+func (h *Handler) SESEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var msg sesevents.Message
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSNSMessageBytes)).Decode(&msg); err != nil {
+		apierror.Write(w, r, apierror.InvalidJSON(err))
+		return
+	}
+
+	if h.sesEvents == nil || msg.TopicArn != h.cfg.SESEventsTopicARN {
+		logging.FromContext(ctx).Warn().Str("topic", msg.TopicArn).Msg("SNS message from unexpected topic")
+		apierror.Write(w, r, apierror.Forbidden("Unexpected topic"))
+		return
+	}
+	if err := h.sesEvents.Verify(ctx, &msg); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("topic", msg.TopicArn).Msg("rejected SNS message")
+		apierror.Write(w, r, apierror.Forbidden("Invalid SNS signature"))
+		return
+	}
+
+	switch msg.Type {
+	case sesevents.TypeSubscriptionConfirmation:
+		if err := h.sesEvents.Confirm(ctx, &msg); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("topic", msg.TopicArn).Msg("failed to confirm SNS subscription")
+			apierror.Write(w, r, apierror.Dependency(apierror.CodeEventFailed, "Failed to confirm subscription"))
+			return
+		}
+		logging.FromContext(ctx).Info().Str("topic", msg.TopicArn).Msg("SES events subscription confirmed")
+
+	case sesevents.TypeNotification:
+		ev, err := sesevents.ParseEvent(msg.Message)
+		if err != nil {
+			apierror.Write(w, r, apierror.InvalidJSON(err))
+			return
+		}
+		metrics.SESEvents.Inc(ev.Type())
+
+		records, err := sesevents.Apply(ctx, h.presigner, ev, time.Now())
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("messageId", ev.Mail.MessageID).Msg("failed to record SES event")
+			apierror.Write(w, r, apierror.Dependency(apierror.CodeEventFailed, "Failed to record event"))
+			return
+		}
+		for _, rec := range records {
+			logging.FromContext(ctx).Warn().
+				Str("type", rec.LastType).
+				Str("subType", rec.LastSubType).
+				Str("failureId", rec.LastFailureID).
+				Bool("suppressed", rec.Suppressed).
+				Msg("email recipient bounced or complained")
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AckFailure handles POST /v1/failures/{failureId}/ack
+func (h *Handler) AckFailure(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+
+	var req models.AckRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	if errs := validation.ValidateAckRequest(&req); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !h.authorizeProject(w, r, req.Project) {
+		return
+	}
+	ctx = logging.With(ctx, "project", req.Project)
+
+	// Records of other projects or tenants are reported as missing
+	rec, err := ack.Get(ctx, h.presigner, failureID)
+	if err == nil && (rec.Project != req.Project || !h.ownsTenant(ctx, rec.EnvelopeKey)) {
+		err = ack.ErrNotFound
+	}
+	if err == nil {
+		rec, err = ack.Acknowledge(ctx, h.presigner, failureID, middleware.PrincipalID(ctx), time.Now().UTC())
+	}
+	h.writeAck(ctx, w, r, failureID, rec, err)
+}
+
+// AckLink handles GET /ack/{failureId}?expires=...&sig=..., the one-click
+// acknowledgment link of notifications. Mail scanners and link previewers
+// fetch every link of an email, so it only answers with a page whose button
+// submits the acknowledgment to ConfirmAck. The signature authorizes the
+// request, so it needs no API credentials.
+func (h *Handler) AckLink(w http.ResponseWriter, r *http.Request) {
+	failureID := chi.URLParam(r, "failureId")
+	if !h.verifyAckLink(w, r, failureID) {
+		return
+	}
+
+	// The form posts back to the link itself, signature included, which must
+	// not leak to other sites through the Referer header
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	if err := ackPage.Execute(w, failureID); err != nil {
+		logging.FromContext(r.Context()).Warn().Err(err).Str("failureId", failureID).Msg("failed to write acknowledgment page")
+	}
+}
+
+// ackPage confirms the acknowledgment of a failure before it is recorded
+var ackPage = template.Must(template.New("ack").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Acknowledge failure</title></head>
+<body>
+<p>Acknowledge failure <code>{{.}}</code>? Escalation stops once it is acknowledged.</p>
+<form method="post"><button type="submit">Acknowledge</button></form>
+</body>
+</html>
+`))
+
+// ConfirmAck handles POST /ack/{failureId}?expires=...&sig=..., submitted from
+// the page of AckLink, and records the acknowledgment. Like the link, it is
+// authorized by the signature.
+func (h *Handler) ConfirmAck(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+	if !h.verifyAckLink(w, r, failureID) {
+		return
+	}
+
+	rec, err := ack.Acknowledge(ctx, h.presigner, failureID, ackedByLink, time.Now().UTC())
+	h.writeAck(ctx, w, r, failureID, rec, err)
+}
+
+// verifyAckLink checks the signature of an acknowledgment link of failureID,
+// writing the problem when it does not hold
+func (h *Handler) verifyAckLink(w http.ResponseWriter, r *http.Request, failureID string) bool {
+	if h.links == nil {
+		apierror.Write(w, r, apierror.NotFound("Unknown failure"))
+		return false
+	}
+	if err := h.links.VerifyAck(failureID, r.URL.Query()); err != nil {
+		apierror.Write(w, r, linkProblem(r.Context(), failureID, err))
+		return false
+	}
+	return true
+}
+
+// ackedByLink records acknowledgments made through a signed link, whose
+// follower is not known
+const ackedByLink = "link"
+
+// writeAck writes the outcome of acknowledging failureID
+func (h *Handler) writeAck(ctx context.Context, w http.ResponseWriter, r *http.Request, failureID string, rec *ack.Record, err error) {
+	if errors.Is(err, ack.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("No notification found for this failure"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to acknowledge failure")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeAckFailed, "Failed to record acknowledgment"))
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Str("ackedBy", rec.AckedBy).
+		Msg("failure acknowledged")
+
+	h.writeJSON(w, http.StatusOK, models.AckResponse{
+		FailureID: rec.FailureID,
+		AckedBy:   rec.AckedBy,
+		AckedAt:   *rec.AckedAt,
+	})
+}
+
+// RedirectArtifact handles GET /r/{failureId}/{artifact}?expires=...&sig=...,
+// redirecting to a presigned URL generated at click time. The signature
+// authorizes the request, so it needs no API credentials.
+func (h *Handler) RedirectArtifact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	failureID := chi.URLParam(r, "failureId")
+	artifact := chi.URLParam(r, "*")
+
+	if failureID == "" || !validation.ValidArtifactName(artifact) {
+		apierror.Write(w, r, apierror.NotFound("Unknown artifact"))
+		return
+	}
+	if h.links == nil {
+		apierror.Write(w, r, apierror.NotFound("Unknown artifact"))
+		return
+	}
+	if err := h.links.VerifyURL(failureID, artifact, r.URL.Query()); err != nil {
+		apierror.Write(w, r, linkProblem(ctx, failureID, err))
+		return
+	}
+
+	target, err := links.Resolve(ctx, h.presigner, failureID)
+	if errors.Is(err, links.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Unknown failure"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to resolve link")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeLinkFailed, "Failed to resolve link"))
+		return
+	}
+
+	key := target.ObjectKey(artifact)
+	scans, p := h.scanRecords(ctx, failureID)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+	if scans != nil {
+		if p := scanProblem(scanStatusOf(scans, key)); p != nil {
+			apierror.Write(w, r, p)
+			return
+		}
+	}
+
+	url, err := h.presigner.PresignGet(ctx, key)
+	if err != nil {
+		apierror.Write(w, r, apierror.Dependency(apierror.CodePresignFailed, "Failed to generate download URL"))
+		return
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Str("artifact", artifact).
+		Msg("artifact link followed")
+
+	setEncryptionHeaders(w, target.Encryption)
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// linkProblem reports a notification link to failureID whose signature is
+// missing, invalid or expired
+func linkProblem(ctx context.Context, failureID string, err error) *apierror.Problem {
+	logging.FromContext(ctx).Warn().Err(err).Str("failureId", failureID).Msg("rejected notification link")
+	if errors.Is(err, links.ErrExpired) {
+		return apierror.Forbidden("Link has expired")
+	}
+	return apierror.Forbidden("Invalid link signature")
+}
+
+// KeyUsage handles GET /v1/admin/keys/{id}/usage?from=...&to=..., also served under /admin
+func (h *Handler) KeyUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyID := chi.URLParam(r, "id")
+	q := r.URL.Query()
+	now := time.Now().UTC()
+
+	if errs := validation.ValidateUsageQuery(keyID, q.Get("from"), q.Get("to"), now, usage.Retention); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+	if h.usage == nil {
+		apierror.Write(w, r, apierror.NotFound("Usage analytics are not enabled"))
+		return
+	}
+
+	from, to := validation.UsageWindow(q.Get("from"), q.Get("to"), now)
+	buckets, err := h.usage.Hourly(ctx, keyID, from, to)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("keyId", keyID).Msg("failed to read key usage")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeUsageFailed, "Failed to read key usage"))
+		return
+	}
+
+	total := usage.Total(buckets)
+	resp := models.KeyUsageResponse{
+		KeyID:     keyID,
+		From:      from,
+		To:        to,
+		Totals:    models.UsageCounts(total),
+		ErrorRate: total.ErrorRate(),
+		Hourly:    make([]models.UsageHour, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		resp.Hourly = append(resp.Hourly, models.UsageHour{Hour: b.Hour, UsageCounts: models.UsageCounts(b.Counts)})
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// ListGroups handles GET /v1/groups?project=...&env=...&limit=...
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.URL.Query().Get("project")
+	env := r.URL.Query().Get("env")
+
+	if errs := validation.ValidateGroupsQuery(project, env); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !h.authorizeProject(w, r, project) {
+		return
+	}
+
+	list, err := groups.List(ctx, h.presigner, h.tenant(ctx), project, env)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to list groups")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeListFailed, "Failed to list failure groups"))
+		return
+	}
+
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+
+	h.writeJSON(w, http.StatusOK, models.GroupsResponse{Groups: list})
+}
+
+// GetStats handles GET /v1/stats: failure counts per day, project and env,
+// platform and URL over a window of days. Without a project it covers every
+// project the caller may read.
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	project := q.Get("project")
+
+	if errs := validation.ValidateStatsQuery(project, q.Get("env"), q.Get("from"), q.Get("to"), q.Get("top"), time.Now()); len(errs) > 0 {
+		h.writeValidationErrors(w, r, errs)
+		return
+	}
+	if project != "" && !h.authorizeProject(w, r, project) {
+		return
+	}
+
+	from, to := validation.StatsWindow(q.Get("from"), q.Get("to"), time.Now())
+	top, err := strconv.Atoi(q.Get("top"))
+	if err != nil {
+		top = 10
+	}
+	allowed := func(string) bool { return true }
+	if p := middleware.PrincipalFromContext(ctx); p != nil {
+		allowed = p.AllowsProject
+	}
+
+	resp, err := stats.Aggregate(ctx, h.presigner, stats.Query{
+		Tenant:  h.tenant(ctx),
+		Project: project,
+		Env:     q.Get("env"),
+		From:    from,
+		To:      to,
+		Top:     top,
+	}, allowed)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to aggregate stats")
+		apierror.Write(w, r, apierror.Dependency(apierror.CodeReadFailed, "Failed to read failure statistics"))
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// recordStats counts the completed failure in the daily statistics (best-effort)
+func (h *Handler) recordStats(ctx context.Context, envObj *models.Envelope) {
+	if err := stats.Record(ctx, h.presigner, envObj, time.Now().UTC()); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", envObj.FailureID).Msg("failed to record failure stats")
+	}
+}
+
+// HealthCheck handles GET /health and GET /health/live. It only reports that
+// the process serves requests; dependencies are checked by Readiness.
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, map[string]string{
+		"status": "healthy",
+		"time":   time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// Version handles GET /version, reporting which build is serving the request
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, http.StatusOK, buildinfo.Get())
+}
+
+// Readiness handles GET /health/ready, checking S3 and optionally SES. It
+// answers 503 when a critical dependency fails, so load balancers stop
+// routing to the instance.
+func (h *Handler) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Run(r.Context())
+	for name, res := range report.Checks {
+		if res.Err != nil {
+			logging.FromContext(r.Context()).Warn().
+				Err(res.Err).
+				Str("dependency", name).
+				Bool("critical", res.Critical).
+				Int64("latencyMs", res.LatencyMs).
+				Msg("readiness check failed")
+		}
+	}
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, status, report)
+}
+
+// OpenAPISpec handles GET /openapi.json, serving the API specification
+func (h *Handler) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	b, err := api.JSON()
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Msg("failed to encode openapi spec")
+		apierror.Write(w, r, apierror.Internal(apierror.CodeReadFailed, "Failed to encode API specification"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// authorizeProject rejects the request if the authenticated principal may not act on project
+func (h *Handler) authorizeProject(w http.ResponseWriter, r *http.Request, project string) bool {
+	if p := h.checkProject(r.Context(), project); p != nil {
+		apierror.Write(w, r, p)
+		return false
+	}
+	return true
+}
+
+// checkProject returns a problem if the principal in ctx may not act on project
+func (h *Handler) checkProject(ctx context.Context, project string) *apierror.Problem {
+	p := middleware.PrincipalFromContext(ctx)
+	if p == nil || p.AllowsProject(project) {
+		return nil
+	}
+
+	logging.FromContext(logging.With(ctx, "project", project)).Warn().
+		Msg("principal not authorized for project")
+	return apierror.Forbidden("Not authorized for this project")
+}
+
+// criticalAllowed reports whether the caller in ctx may mark failures
+// critical: principals granted apikeys.ScopeCritical, or anyone without auth
+func criticalAllowed(ctx context.Context) bool {
+	p := middleware.PrincipalFromContext(ctx)
+	return p == nil || p.HasScope(apikeys.ScopeCritical)
+}
+
+// tenant returns the tenant the caller's failures are stored under: the
+// principal's when multi-tenancy is on, otherwise none
+func (h *Handler) tenant(ctx context.Context) string {
+	if !h.cfg.MultiTenant {
+		return ""
+	}
+	return middleware.PrincipalTenant(ctx)
+}
+
+// ownsTenant reports whether the principal in ctx may access the failure
+// stored under prefix. Without multi-tenancy or auth every prefix is allowed.
+func (h *Handler) ownsTenant(ctx context.Context, prefix string) bool {
+	if !h.cfg.MultiTenant || middleware.PrincipalFromContext(ctx) == nil {
+		return true
+	}
+	return validation.TenantOwns(h.tenant(ctx), prefix)
+}
+
+// authorizeTenant rejects the request if any of prefixes is stored under another tenant
+func (h *Handler) authorizeTenant(w http.ResponseWriter, r *http.Request, prefixes ...string) bool {
+	if p := h.checkTenant(r.Context(), prefixes...); p != nil {
+		apierror.Write(w, r, p)
+		return false
+	}
+	return true
+}
+
+// checkTenant returns a problem if any of prefixes is stored under a tenant
+// other than the caller's
+func (h *Handler) checkTenant(ctx context.Context, prefixes ...string) *apierror.Problem {
+	for _, prefix := range prefixes {
+		if h.ownsTenant(ctx, prefix) {
+			continue
+		}
+
+		logging.FromContext(ctx).Warn().
+			Str("prefix", prefix).
+			Msg("principal not authorized for tenant")
+		return apierror.Forbidden("Not authorized for this tenant")
+	}
+	return nil
+}
+
+// tenantProject qualifies project with tenant, so tenants' projects of the
+// same name never share notification state
+func tenantProject(tenant, project string) string {
+	if tenant == "" {
+		return project
+	}
+	return tenant + ":" + project
+}
+
+// recordLinkTarget stores where the failure's artifacts live so short links resolve (best-effort)
+func (h *Handler) recordLinkTarget(ctx context.Context, req *models.UploadCompleteRequest, envelopeKey string) {
+	t := links.Target{
+		FailureID:  req.FailureID,
+		Project:    req.Project,
+		Env:        req.Env,
+		S3Prefix:   path.Dir(envelopeKey) + "/",
+		Encryption: req.Encryption,
+	}
+	if err := links.Record(ctx, h.presigner, t); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", req.FailureID).Msg("failed to record link target")
+	}
+}
+
+// trackTicket records an issued ticket so the reaper can clean up its uploads
+// if it is never completed, and the auto-completion worker knows which uploads
+// to wait for (best-effort)
+func (h *Handler) trackTicket(ctx context.Context, req *models.UploadTicketRequest, failureID string, plan *ticketPlan) {
+	rec := h.ticketRecord(ctx, req, failureID, plan.prefix, plan.expectedKeys())
+	if err := tickets.Issue(ctx, h.presigner, rec); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", failureID).Msg("failed to track upload ticket")
+	}
+	h.indexUser(ctx, rec)
+}
+
+// ticketRecord returns the redacted ticket of req, whose uploads under prefix
+// are expected
+func (h *Handler) ticketRecord(ctx context.Context, req *models.UploadTicketRequest, failureID, prefix string, expected []string) tickets.Record {
+	request := req.Request
+	request.URL = h.redactor.URL(request.URL)
+	rec := tickets.Record{
+		FailureID: failureID,
+		Project:   req.Project,
+		Env:       req.Env,
+		S3Prefix:  prefix,
+		IssuedAt:  time.Now().UTC(),
+		UserHash:  tickets.HashUserID(h.cfg.UserIDHashKey, req.Client.UserID),
+		Request:   &request,
+		Client:    &models.ClientInfo{AppVersion: req.Client.AppVersion, Platform: req.Client.Platform},
+		Severity:  req.Severity,
+		Tags:      h.redactTags(req.Tags),
+		Artifacts: req.Artifacts,
+		Expected:  expected,
+
+		CriticalAllowed: criticalAllowed(ctx),
+	}
+	rec.Description = h.redactor.String(req.Description)
+	if req.Response != nil {
+		response := *req.Response
+		response.ErrorMessage = h.redactor.String(response.ErrorMessage)
+		rec.Response = &response
+	}
+	return rec
+}
+
+// redactTags returns tags with their values redacted, e.g. an email address
+// used as a label
+func (h *Handler) redactTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	redacted := make(map[string]string, len(tags))
+	for k, v := range tags {
+		redacted[k] = h.redactor.String(v)
+	}
+	return redacted
+}
+
+// indexUser records the failure under its user so it can be found for erasure
+// (best-effort). Failures without a user ID are not indexed.
+func (h *Handler) indexUser(ctx context.Context, rec tickets.Record) {
+	if rec.UserHash == "" {
+		return
+	}
+	if err := tickets.IndexUser(ctx, h.presigner, rec); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", rec.FailureID).Msg("failed to index failure by user")
+	}
+}
+
+// completeTicket marks the failure's ticket completed (best-effort). Tickets
+// issued before tracking was enabled are not found and ignored.
+func (h *Handler) completeTicket(ctx context.Context, failureID string) {
+	err := tickets.Complete(ctx, h.presigner, failureID, time.Now().UTC())
+	if err != nil && !errors.Is(err, tickets.ErrNotFound) {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", failureID).Msg("failed to mark upload ticket completed")
+	}
+}
+
+// describeResponse copies how the request failed into notif. Responses the
+// client wrote to envelope.json outside the ticket limits are left out.
+func (h *Handler) describeResponse(ctx context.Context, notif *email.FailureNotification, resp *models.ResponseInfo) {
+	if resp == nil {
+		return
+	}
+	if errs := validation.ValidateResponseInfo(resp); len(errs) > 0 {
+		logging.FromContext(ctx).Warn().Str("failureId", notif.FailureID).Str("error", errs[0].Error()).Msg("envelope response omitted from notification")
+		return
+	}
+	notif.StatusCode = resp.StatusCode
+	notif.DurationMs = resp.DurationMs
+	notif.ErrorClass = resp.ErrorClass
+	notif.ErrorMessage = resp.ErrorMessage
+}
+
+// reproCommand builds a curl command from the failure's stored headers and body
+// under prefix (best-effort). Missing artifacts are left out of the command.
+func (h *Handler) reproCommand(ctx context.Context, envObj *models.Envelope, prefix string) string {
+	// Bodies over the inline limit are only referenced, so never read more than that
+	return repro.Curl(h.capturedRequest(ctx, envObj, prefix, repro.MaxInlineBody+1), h.redactor)
+}
+
+// notificationCommand builds the curl command of notifications from the
+// failure's stored headers under prefix, which completion filtered and
+// redacted, without the body or credentials (best-effort)
+func (h *Handler) notificationCommand(ctx context.Context, envObj *models.Envelope, prefix string) string {
+	// Only whether a body was captured matters, so read a single byte of it
+	return repro.NotificationCurl(h.capturedRequest(ctx, envObj, prefix, 1), h.redactor)
+}
+
+// capturedRequest rebuilds the failure's request from its stored headers and up
+// to bodyLimit bytes of its body (all of it when negative). Missing or
+// unreadable artifacts are left out.
+func (h *Handler) capturedRequest(ctx context.Context, envObj *models.Envelope, prefix string, bodyLimit int64) repro.Request {
+	req := repro.Request{Method: envObj.Request.Method, URL: envObj.Request.URL}
+
+	if b := h.readArtifact(ctx, prefix+"request.headers.json", -1); b != nil {
+		hdrs, err := repro.ParseHeaders(b)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("failureId", envObj.FailureID).Msg("failed to parse headers artifact")
+		}
+		req.Headers = hdrs
+	}
+	req.Body = h.readArtifact(ctx, prefix+repro.BodyFile, bodyLimit)
+	return req
+}
+
+// readArtifact returns up to n bytes of an optional artifact (all of it when n
+// is negative), or nil when it is missing or unreadable
+func (h *Handler) readArtifact(ctx context.Context, key string, n int64) []byte {
+	var b []byte
+	var err error
+	if n < 0 {
+		b, err = h.presigner.GetObjectBytes(ctx, key)
+	} else {
+		b, err = h.presigner.GetObjectHead(ctx, key, n)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to read artifact")
+		return nil
+	}
+	return b
+}
+
+// recordAudit records an action taken by the request's principal on target
+func recordAudit(r *http.Request, action audit.Action, outcome audit.Outcome, target string, details map[string]string) {
+	audit.Record(r.Context(), audit.Event{
+		Action:   action,
+		Outcome:  outcome,
+		SourceIP: middleware.ClientIP(r),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Target:   target,
+		Details:  details,
+	})
+}
+
+// publish puts lifecycle events on the event bus (best-effort)
+func (h *Handler) publish(ctx context.Context, events ...eventbus.Event) {
+	if err := h.events.Publish(ctx, events...); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Int("events", len(events)).Msg("failed to publish lifecycle events")
+	}
+}
+
+// forwardSentry sends the completed failure to Sentry (best-effort)
+func (h *Handler) forwardSentry(ctx context.Context, envObj *models.Envelope, prefix, envelopeURL string, group *models.Group, critical bool) {
+	if h.sentry == nil {
+		return
+	}
+	f := sentry.Failure{
+		Envelope:    envObj,
+		S3URI:       "s3://" + h.presigner.BucketFor(prefix) + "/" + prefix,
+		EnvelopeURL: envelopeURL,
+		Critical:    critical,
+	}
+	if group != nil {
+		f.Occurrences = group.Count
+	}
+	if err := h.sentry.Forward(ctx, f); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", envObj.FailureID).Msg("failed to forward failure to sentry")
+	}
+}
+
+// writeIndex adds the completed failure to the Athena metadata index and
+// registers its partition in the catalog, if any (best-effort)
+func (h *Handler) writeIndex(ctx context.Context, entry athena.Entry) {
+	key, err := athena.Write(ctx, h.presigner, entry)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", entry.Envelope.FailureID).Msg("failed to write metadata index row")
+		return
+	}
+	if err := h.catalog.Register(ctx, entry.Envelope.Tenant, entry.Envelope.Project, entry.CompletedAt); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to register index partition")
+	}
+}
+
+// trackAck records a sent notification so it can be acknowledged or escalated (best-effort)
+func (h *Handler) trackAck(ctx context.Context, notif email.FailureNotification, envelopeKey string) {
+	rec := ack.Record{
+		FailureID:   notif.FailureID,
+		Project:     notif.Project,
+		Env:         notif.Env,
+		Method:      notif.Method,
+		URL:         notif.URL,
+		EnvelopeKey: envelopeKey,
+		NotifiedAt:  time.Now().UTC(),
+	}
+	if err := ack.Track(ctx, h.presigner, rec); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", notif.FailureID).Msg("failed to track notification acknowledgment")
+	}
+}
+
+// assignGroup records the failure's group and sets its group ID on the
+// envelope, returning the group or nil when it could not be recorded
+func (h *Handler) assignGroup(ctx context.Context, envObj *models.Envelope) *models.Group {
+	g, err := groups.Record(ctx, h.presigner, envObj, time.Now().UTC())
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", envObj.FailureID).Msg("failed to record failure group")
+		return nil
+	}
+	envObj.GroupID = g.ID
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", envObj.FailureID).
+		Str("groupId", g.ID).
+		Int("occurrences", g.Count).
+		Msg("failure grouped")
+	return g
+}
+
+// writeEnvelope replaces the stored envelope with the server-side version
+func (h *Handler) writeEnvelope(ctx context.Context, key string, envObj *models.Envelope) {
+	b, err := json.Marshal(envObj)
+	if err != nil {
+		return
+	}
+	if err := h.presigner.PutObjectBytes(ctx, key, "application/json", b); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to rewrite envelope")
+	}
+}
+
+// writeServerChecksums hashes every uploaded object under the failure's prefix,
+// writes the failure's checksums.json and verifies it was stored. Client-supplied
+// digests are checked against the computed ones and the keys that differ are
+// returned.
+func (h *Handler) writeServerChecksums(ctx context.Context, req *models.UploadCompleteRequest, kb *keys.Builder) (map[string]string, []string, error) {
+	checksumsKey := kb.Checksums()
+
+	sums := make(map[string]string, len(req.UploadedKeys))
+	var mismatched []string
+	for _, k := range req.UploadedKeys {
+		if k == checksumsKey || !strings.HasPrefix(k, kb.Prefix()) {
+			continue
+		}
+		sum, err := h.presigner.ObjectSHA256(ctx, k)
+		if err != nil {
+			return nil, nil, err
+		}
+		sums[k] = sum
+		if want, ok := req.SHA256[k]; ok && !strings.EqualFold(want, sum) {
+			mismatched = append(mismatched, k)
+		}
+	}
+	if len(mismatched) > 0 {
+		return nil, mismatched, nil
+	}
+
+	b, err := json.Marshal(sums)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := h.presigner.PutObjectBytes(ctx, checksumsKey, "application/json", b); err != nil {
+		return nil, nil, err
+	}
+
+	missing, err := h.presigner.VerifyObjectsExist(ctx, []string{checksumsKey})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("checksums.json not found after write: %s", checksumsKey)
+	}
+
+	return sums, nil, nil
+}
+
+// uploadedArtifacts reports which artifact slots under prefix are among the
+// uploaded keys
+func uploadedArtifacts(prefix string, uploadedKeys []string) *models.ArtifactPresence {
+	var p models.ArtifactPresence
+	for _, k := range uploadedKeys {
+		switch strings.TrimPrefix(k, prefix) {
+		case keys.LogsName:
+			p.Logs = true
+		case keys.ScreenshotName:
+			p.Screenshot = true
+		case keys.ConsoleName:
+			p.Console = true
+		}
+	}
+	return &p
+}
+
+// scanRecords loads the malware scan records of failureID; they are nil when
+// scanning is off
+func (h *Handler) scanRecords(ctx context.Context, failureID string) (scan.Records, *apierror.Problem) {
+	if !h.cfg.MalwareScan {
+		return nil, nil
+	}
+	recs, err := scan.Load(ctx, h.presigner, failureID)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to read scan records")
+		return nil, apierror.Dependency(apierror.CodeReadFailed, "Failed to read malware scan results")
+	}
+	return recs, nil
+}
+
+// scanStatus returns whether the malware scan withholds the failure's objects
+// at objKeys: "" when scanning is off or they are cleared. Records that
+// cannot be read withhold them.
+func (h *Handler) scanStatus(ctx context.Context, failureID string, objKeys []string) string {
+	if !h.cfg.MalwareScan {
+		return ""
+	}
+	recs, p := h.scanRecords(ctx, failureID)
+	if p != nil {
+		return scan.StatusPending
+	}
+	return recs.Status(objKeys)
+}
+
+// scanProblem returns the problem of downloading an object with a scan status
+func scanProblem(status string) *apierror.Problem {
+	switch status {
+	case scan.StatusQuarantined:
+		return apierror.Quarantined()
+	case scan.StatusPending:
+		return apierror.ScanPending()
+	}
+	return nil
+}
+
+// scanStatusOf returns the scan status of the object at key. Thumbnails are
+// withheld as long as the image they were made from.
+func scanStatusOf(scans scan.Records, key string) string {
+	if src, ok := thumbs.SourceKey(key); ok {
+		key = src
+	}
+	return scans.StatusOf(key)
+}
+
+// queueThumbnails queues the image artifacts of the failure stored under
+// prefix for thumbnails (best-effort)
+func (h *Handler) queueThumbnails(ctx context.Context, req *models.UploadCompleteRequest, prefix string, artifacts []string) {
+	imageKeys := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		imageKeys = append(imageKeys, prefix+a)
+	}
+	if err := h.thumbs.Enqueue(ctx, req.Project, req.FailureID, imageKeys); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", req.FailureID).Msg("failed to queue thumbnails")
+	}
+}
+
+// thumbnailURL links the thumbnail of artifact through a signed short link
+// when links are configured, otherwise through a presigned GET URL; it is empty
+// when presigning fails
+func (h *Handler) thumbnailURL(ctx context.Context, failureID, prefix, artifact string) string {
+	if h.links != nil {
+		return h.links.URL(failureID, thumbs.Name(artifact))
+	}
+	url, err := h.presigner.PresignGet(ctx, prefix+thumbs.Name(artifact))
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", failureID).Msg("failed to generate thumbnail URL")
+		return ""
+	}
+	return url
+}
+
+// listThumbnails links the thumbnails of the failure at loc, leaving out
+// images the malware scan withholds. Thumbnails still being generated are
+// linked too; their links fail until they are stored.
+func (h *Handler) listThumbnails(ctx context.Context, envObj *models.Envelope, loc keys.Location) []models.Thumbnail {
+	artifacts := thumbs.Sources(envObj)
+	if len(artifacts) == 0 {
+		return nil
+	}
+	scans, p := h.scanRecords(ctx, loc.FailureID)
+	if p != nil {
+		return nil
+	}
+	var out []models.Thumbnail
+	for _, a := range artifacts {
+		if scans != nil && scans.StatusOf(loc.Prefix+a) != "" {
+			continue
+		}
+		if url := h.thumbnailURL(ctx, loc.FailureID, loc.Prefix, a); url != "" {
+			out = append(out, models.Thumbnail{Artifact: a, URL: url})
+		}
+	}
+	return out
+}
+
+// sniffArtifacts compares the leading bytes of the request body, attached files
+// and artifact slots with their declared content types, and checks that JSON
+// parses as far as it was read. It returns the mismatches (best-effort).
+func (h *Handler) sniffArtifacts(ctx context.Context, envObj *models.Envelope, uploadedKeys []string) []models.ContentMismatch {
+	declared := declaredTypes(envObj)
+	var mismatches []models.ContentMismatch
+	for _, k := range uploadedKeys {
+		artifact := ""
+		for name := range declared {
+			if strings.HasSuffix(k, "/"+name) {
+				artifact = name
+				break
+			}
+		}
+		if artifact == "" {
+			continue
+		}
+
+		head, err := h.presigner.GetObjectHead(ctx, k, sniff.Len)
+		if err != nil || len(head) == 0 {
+			continue
+		}
+		detected := sniff.Detect(head)
+		switch {
+		case sniff.Mismatch(declared[artifact], detected):
+		case sniff.IsJSON(declared[artifact]) && !sniff.ValidJSON(head, len(head) < sniff.Len):
+			detected = sniff.InvalidJSON
+		default:
+			continue
+		}
+
+		mismatches = append(mismatches, models.ContentMismatch{Artifact: artifact, Declared: declared[artifact], Detected: detected})
+		metrics.ContentMismatches.Inc(envObj.Project)
+		logging.FromContext(ctx).Warn().
+			Str("failureId", envObj.FailureID).
+			Str("artifact", artifact).
+			Str("declared", declared[artifact]).
+			Str("detected", detected).
+			Msg("artifact content does not match declared type")
+	}
+	return mismatches
+}
+
+// declaredTypes returns the content types envObj declares for its artifacts
+// by name relative to the failure's prefix
+func declaredTypes(envObj *models.Envelope) map[string]string {
+	declared := map[string]string{
+		"request.raw":       envObj.Request.ContentType,
+		keys.LogsName:       "text/plain",
+		keys.ScreenshotName: "image/png",
+		keys.ConsoleName:    "application/json",
+	}
+	for _, f := range envObj.Request.Files {
+		declared[path.Join("files", f.Filename)] = f.ContentType
+	}
+	return declared
+}
+
+// rejectMismatches returns the problem of completing a failure with mismatches
+// under CONTENT_MISMATCH_ACTION, or nil when the completion goes ahead
+func (h *Handler) rejectMismatches(ctx context.Context, req *models.UploadCompleteRequest, mismatches []models.ContentMismatch) *apierror.Problem {
+	var rejected []string
+	for _, m := range mismatches {
+		if h.cfg.ContentMismatchAction == "reject" ||
+			(h.cfg.ContentMismatchAction == "reject_executables" && sniff.IsExecutable(m.Detected)) {
+			rejected = append(rejected, fmt.Sprintf("%s declared %s, detected %s", m.Artifact, m.Declared, m.Detected))
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	logging.FromContext(ctx).Warn().
+		Str("failureId", req.FailureID).
+		Strs("mismatches", rejected).
+		Msg("completion rejected for content mismatches")
+	metrics.VerificationFailures.Inc(req.Project, "content_mismatch")
+	return apierror.BadRequest(apierror.CodeContentMismatch, "Some artifacts do not match their declared content type").WithDetail("%s", strings.Join(rejected, "; "))
+}
+
+// redactHeadersArtifact rewrites a stored headers document, dropping headers the
+// project's policy does not allow and removing sensitive values from the rest
+func (h *Handler) redactHeadersArtifact(ctx context.Context, project, key string) {
+	b, err := h.presigner.GetObjectBytes(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to read headers artifact")
+		return
+	}
+	filtered, dropped, err := h.headers.For(project).FilterJSON(b)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to parse headers artifact")
+		return
+	}
+	if len(dropped) > 0 {
+		logging.FromContext(ctx).Debug().Str("key", key).Strs("dropped", dropped).Msg("dropped headers from artifact")
+	}
+	redacted, err := h.redactor.HeadersJSON(filtered)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to parse headers artifact")
+		return
+	}
+	if err := h.presigner.PutObjectBytes(ctx, key, "application/json", redacted); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to write redacted headers artifact")
+	}
+}
+
+// ticketPlan is the prefix and presigned uploads handed to the client for a
+// ticket, and the uploads of a partial ticket that could not be presigned
+type ticketPlan struct {
+	prefix  string
+	uploads *models.UploadURLs
+	failed  []models.FailedUpload
+}
+
+func (h *Handler) planTicket(ctx context.Context, kb *keys.Builder, req *models.UploadTicketRequest) (*ticketPlan, error) {
+	uploads, failed, err := h.generatePresignedURLs(ctx, kb, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ticketPlan{prefix: kb.Prefix(), uploads: uploads, failed: failed}, nil
+}
+
+// sameLayout reports whether two plans lay out the same artifacts relative to their prefixes
+func sameLayout(a, b *ticketPlan) bool {
+	ra, rb := a.relativeKeys(), b.relativeKeys()
+	if len(ra) != len(rb) {
+		return false
+	}
+	for i := range ra {
+		if ra[i] != rb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// expectedKeys returns the keys a client uploads for the plan; checksums.json
+// is optional
+func (p *ticketPlan) expectedKeys() []string {
+	u := p.uploads
+	expected := []string{u.Envelope.Key, u.RequestRaw.Key, u.RequestHeaders.Key, u.ResponseRaw.Key}
+	for _, slot := range presignedSlots(u) {
+		expected = append(expected, slot.Key)
+	}
+	for _, f := range u.Files {
+		expected = append(expected, f.Key)
+	}
+	return expected
+}
+
+func (p *ticketPlan) relativeKeys() []string {
+	u := p.uploads
+	all := []models.PresignedUpload{u.Envelope, u.RequestRaw, u.RequestHeaders, u.ResponseRaw, u.Checksums}
+	all = append(all, presignedSlots(u)...)
+	all = append(all, u.Files...)
+
+	rel := make([]string, 0, len(all))
+	for _, up := range all {
+		rel = append(rel, strings.TrimPrefix(up.Key, p.prefix))
+	}
+	return rel
+}
+
+// presignedSlots returns the uploads of the artifact slots the ticket declared
+func presignedSlots(u *models.UploadURLs) []models.PresignedUpload {
+	var slots []models.PresignedUpload
+	for _, up := range []*models.PresignedUpload{u.Logs, u.Screenshot, u.Console} {
+		if up != nil {
+			slots = append(slots, *up)
+		}
+	}
+	return slots
+}
+
+func (h *Handler) generatePresignedURLs(ctx context.Context, kb *keys.Builder, req *models.UploadTicketRequest) (*models.UploadURLs, []models.FailedUpload, error) {
+	opts := uploadOptions(req)
+	var (
+		failed    []models.FailedUpload
+		presigned int
+		lastErr   error
+	)
+	// A failed upload keeps its key, so a partial ticket can list it
+	presign := func(name string) models.PresignedUpload {
+		key := path.Join(kb.Prefix(), name)
+		up, err := h.presignUpload(ctx, key, opts[name])
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to presign upload")
+			lastErr = err
+			failed = append(failed, models.FailedUpload{Artifact: name, Key: key, Error: "Failed to generate presigned URL"})
+			return models.PresignedUpload{Key: key}
+		}
+		presigned++
+		return up
+	}
+	slot := func(name string, declared *models.ArtifactInfo) *models.PresignedUpload {
+		if declared == nil {
+			return nil
+		}
+		up := presign(name)
+		return &up
+	}
+
+	uploads := &models.UploadURLs{
+		Envelope:       presign("envelope.json"),
+		RequestRaw:     presign("request.raw"),
+		RequestHeaders: presign("request.headers.json"),
+		ResponseRaw:    presign("response.raw"),
+		Checksums:      presign("checksums.json"),
+	}
+	if a := req.Artifacts; a != nil {
+		uploads.Logs = slot(keys.LogsName, a.Logs)
+		uploads.Screenshot = slot(keys.ScreenshotName, a.Screenshot)
+		uploads.Console = slot(keys.ConsoleName, a.Console)
+	}
+	for _, file := range req.Request.Files {
+		uploads.Files = append(uploads.Files, presign(path.Join("files", file.Filename)))
+	}
+
+	// Partial tickets need at least one upload to show for them
+	if lastErr != nil && (!req.AllowPartial || presigned == 0) {
+		return nil, nil, lastErr
+	}
+	return uploads, failed, nil
+}
+
+// uploadOptions returns the presigning options of the uploads of a ticket for
+// req, by name relative to the failure's prefix
+func uploadOptions(req *models.UploadTicketRequest) map[string]s3client.PutOptions {
+	raw := s3client.PutOptions{ContentType: req.Request.ContentType, Size: req.Request.BodyBytes, SHA256: req.Request.SHA256}
+	if raw.ContentType == "" {
+		raw.ContentType = "application/octet-stream"
+	}
+	opts := map[string]s3client.PutOptions{
+		"envelope.json":        {ContentType: "application/json"},
+		"request.raw":          raw,
+		"request.headers.json": {ContentType: "application/json"},
+		"response.raw":         {ContentType: "application/octet-stream"},
+		"checksums.json":       {ContentType: "application/json"},
+	}
+
+	// Artifact slots, when declared
+	slot := func(name, contentType string, declared *models.ArtifactInfo) {
+		if declared != nil {
+			opts[name] = s3client.PutOptions{ContentType: contentType, Size: declared.Bytes, SHA256: declared.SHA256}
+		}
+	}
+	if a := req.Artifacts; a != nil {
+		slot(keys.LogsName, "text/plain", a.Logs)
+		slot(keys.ScreenshotName, "image/png", a.Screenshot)
+		slot(keys.ConsoleName, "application/json", a.Console)
+	}
+
+	// Files
+	for _, file := range req.Request.Files {
+		ct := file.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		opts[path.Join("files", file.Filename)] = s3client.PutOptions{ContentType: ct, Size: file.Bytes, SHA256: file.SHA256}
+	}
+	return opts
+}
+
+// presignUpload presigns a PUT of key along with the headers the client must send
+func (h *Handler) presignUpload(ctx context.Context, key string, opts s3client.PutOptions) (models.PresignedUpload, error) {
+	url, signed, err := h.presigner.PresignPut(ctx, key, opts)
+	if err != nil {
+		return models.PresignedUpload{}, err
+	}
+	return models.PresignedUpload{Key: key, PutURL: url, Headers: signed}, nil
+}
+
+// decodeJSON decodes the JSON body of r into v, rejecting fields v does not
+// have. Requests of a schema version newer than the service's may carry such
+// fields, so they are ignored for those unless STRICT_SCHEMA_VERSION is set.
+func (h *Handler) decodeJSON(r *http.Request, v interface{}) *apierror.Problem {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return apierror.TooLarge("Request body too large", tooLarge.Limit)
+		}
+		if errors.Is(err, middleware.ErrInvalidEncoding) {
+			return apierror.InvalidEncoding(err)
+		}
+		return apierror.InvalidJSON(err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after the JSON value")
+	}
+	if err == nil {
+		return nil
+	}
+
+	field, ok := unknownField(err)
+	if !ok {
+		return apierror.InvalidJSON(err)
+	}
+	if version, verr := envelope.Version(body); verr == nil && version > envelope.SchemaVersion && !h.cfg.StrictSchema {
+		if err := json.Unmarshal(body, v); err != nil {
+			return apierror.InvalidJSON(err)
+		}
+		return nil
+	}
+	p := apierror.InvalidJSON(err).WithDetail("unknown field %q", field)
+	p.Errors = []apierror.FieldError{{Field: field, Message: "unknown field", Code: "unknown_field"}}
+	return p
+}
+
+// unknownField returns the field named by a DisallowUnknownFields error
+func unknownField(err error) (string, bool) {
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return "", false
+	}
+	field, err := strconv.Unquote(quoted)
+	return field, err == nil
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeValidationErrors reports every failed field to the client
+func (h *Handler) writeValidationErrors(w http.ResponseWriter, r *http.Request, errs []validation.ValidationError) {
+	apierror.Write(w, r, validationProblem(errs))
 }
 
-func (h *Handler) writeValidationErrors(w http.ResponseWriter, errs []validation.ValidationError) {
-	var messages []string
+// validationProblem reports every failed field
+func validationProblem(errs []validation.ValidationError) *apierror.Problem {
+	fields := make([]apierror.FieldError, 0, len(errs))
 	for _, e := range errs {
-		messages = append(messages, e.Error())
+		fields = append(fields, apierror.FieldError{Field: e.Field, Message: e.Message, Code: e.Code})
 	}
-	h.writeError(w, http.StatusBadRequest, "validation_error", "Validation failed", "")
+	return apierror.Validation(fields)
 }
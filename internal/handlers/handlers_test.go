@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/go-chi/chi/v5"
+	"github.com/yourorg/failure-uploader/internal/ack"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apigw"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/links"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+func testHandler() *Handler {
+	return NewHandler(&config.Config{
+		MaxBodyBytes:  1024,
+		MaxFileBytes:  1024,
+		MaxTotalBytes: 2048,
+	}, nil, nil)
+}
+
+// serve runs fn against a JSON body and decodes the problem response
+func serve(t *testing.T, fn http.HandlerFunc, target, body string) (*httptest.ResponseRecorder, apierror.Problem) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	fn(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+
+	var p apierror.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return rec, p
+}
+
+func TestUploadTicket_ValidationErrors(t *testing.T) {
+	h := testHandler()
+	body := `{"project":"bad project!","env":"prod","request":{"method":"FETCH","url":"ftp://x"}}`
+
+	rec, p := serve(t, h.UploadTicket, "/v1/upload-ticket", body)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != apierror.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, apierror.ContentType)
+	}
+	if p.Code != apierror.CodeValidation || p.Title != "Validation failed" {
+		t.Errorf("problem = %+v", p)
+	}
+
+	want := map[string]bool{"project": true, "request.method": true, "request.url": true}
+	if len(p.Errors) != len(want) {
+		t.Fatalf("errors = %+v, want fields %v", p.Errors, want)
+	}
+	for _, e := range p.Errors {
+		if !want[e.Field] || e.Message == "" {
+			t.Errorf("unexpected error %+v", e)
+		}
+	}
+}
+
+func TestUploadComplete_ValidationErrors(t *testing.T) {
+	h := testHandler()
+
+	rec, p := serve(t, h.UploadComplete, "/v1/upload-complete", `{"project":"myapp","priority":"urgent"}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+
+	got := make(map[string]string)
+	for _, e := range p.Errors {
+		got[e.Field] = e.Message
+	}
+	for _, field := range []string{"failureId", "env", "uploadedKeys", "priority"} {
+		if got[field] == "" {
+			t.Errorf("missing error for %s in %+v", field, p.Errors)
+		}
+	}
+	if _, ok := got["project"]; ok {
+		t.Errorf("valid project reported as invalid: %+v", p.Errors)
+	}
+}
+
+func TestUploadComplete_InvalidJSON(t *testing.T) {
+	h := testHandler()
+
+	for _, body := range []string{`{"project":`, `{"project":"myapp"} {"env":"prod"}`} {
+		rec, p := serve(t, h.UploadComplete, "/v1/upload-complete", body)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", body, rec.Code)
+		}
+		if p.Code != apierror.CodeInvalidJSON || p.Detail == "" {
+			t.Errorf("%s: problem = %+v", body, p)
+		}
+		if len(p.Errors) != 0 {
+			t.Errorf("%s: errors = %+v, want none for invalid JSON", body, p.Errors)
+		}
+	}
+}
+
+func TestUploadComplete_InvalidEncoding(t *testing.T) {
+	h := testHandler()
+	// A valid gzip header followed by a corrupt deflate stream
+	body := "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xff\xff\xff\xff"
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Content-Encoding", "gzip")
+		middleware.Decompress(1024)(http.HandlerFunc(h.UploadComplete)).ServeHTTP(w, r)
+	}
+
+	rec, p := serve(t, fn, "/v1/upload-complete", body)
+	if rec.Code != http.StatusBadRequest || p.Code != apierror.CodeInvalidEncoding {
+		t.Errorf("status = %d, problem = %+v; want 400 invalid_encoding", rec.Code, p)
+	}
+}
+
+func TestReadFailure_ChecksProjectBeforeReading(t *testing.T) {
+	h := testHandler()
+	key := &apikeys.Key{ID: "web", Projects: []string{"other"}, Scopes: []apikeys.Scope{apikeys.ScopeFailureRead}}
+	ctx := middleware.WithPrincipal(context.Background(), key)
+
+	// The presigner is nil, so reaching storage would panic
+	_, p := h.ReadFailure(ctx, "11111111-1111-1111-1111-111111111111", "myapp", "prod",
+		"failures/myapp/prod/2024/01/02/11111111-1111-1111-1111-111111111111/")
+
+	if p == nil || p.Status != http.StatusForbidden {
+		t.Fatalf("problem = %+v, want 403", p)
+	}
+}
+
+func TestListRecentFailures_ChecksProjectBeforeListing(t *testing.T) {
+	h := testHandler()
+	key := &apikeys.Key{ID: "web", Projects: []string{"other"}, Scopes: []apikeys.Scope{apikeys.ScopeFailureRead}}
+	ctx := middleware.WithPrincipal(context.Background(), key)
+
+	// The presigner is nil, so reaching storage would panic
+	_, p := h.ListRecentFailures(ctx, "myapp", "prod", 7, 50, models.FailureFilter{})
+
+	if p == nil || p.Status != http.StatusForbidden {
+		t.Fatalf("problem = %+v, want 403", p)
+	}
+}
+
+func TestListFailures_RequiresEnv(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testHandler().ListFailures(rec, httptest.NewRequest(http.MethodGet, "/v1/failures?project=myapp&limit=500", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	var p apierror.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(p.Errors) != 2 {
+		t.Errorf("errors = %+v, want env and limit", p.Errors)
+	}
+}
+
+func TestDeleteFailure_RejectsForeignPrefix(t *testing.T) {
+	h := testHandler()
+	r := chi.NewRouter()
+	r.Delete("/v1/failures/{failureId}", h.DeleteFailure)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete,
+		"/v1/failures/abc-123?project=myapp&env=prod&prefix=failures/myapp/prod/", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	var p apierror.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "prefix" {
+		t.Errorf("errors = %+v, want prefix", p.Errors)
+	}
+}
+
+func TestDeleteFailure_RejectsOtherTenant(t *testing.T) {
+	h := testHandler()
+	h.cfg.MultiTenant = true
+	r := chi.NewRouter()
+	r.Delete("/v1/failures/{failureId}", h.DeleteFailure)
+
+	req := httptest.NewRequest(http.MethodDelete,
+		"/v1/failures/abc-123?project=myapp&env=prod&prefix=failures/tenant=globex/myapp/prod/dt=2024-03-15/abc-123/", nil)
+	key := &apikeys.Key{ID: "acme-ops", Projects: []string{"*"}, Scopes: []apikeys.Scope{apikeys.ScopeAdmin}, Tenant: "acme"}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req.WithContext(middleware.WithPrincipal(req.Context(), key)))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestEraseUser_RequiresUserID(t *testing.T) {
+	rec, p := serve(t, testHandler().EraseUser, "/v1/admin/erasure", `{"userId":"  "}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "userId" {
+		t.Errorf("errors = %+v, want userId", p.Errors)
+	}
+}
+
+func TestAdminCreateKey_ValidationErrors(t *testing.T) {
+	rec, p := serve(t, testHandler().AdminCreateKey, "/admin/keys", `{"id":"a b","scopes":["root"]}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if len(p.Errors) != 3 {
+		t.Errorf("errors = %+v, want id, projects and scopes[0]", p.Errors)
+	}
+}
+
+func TestAdminRotateKey_InvalidOverlap(t *testing.T) {
+	rec, p := serve(t, testHandler().AdminRotateKey, "/admin/keys/web-app/rotate", `{"overlapSeconds":-1}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "overlapSeconds" {
+		t.Errorf("errors = %+v, want overlapSeconds", p.Errors)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testHandler().OpenAPISpec(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var doc struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.OpenAPI == "" || doc.Paths["/v1/upload-ticket"] == nil || doc.Paths["/openapi.json"] == nil {
+		t.Errorf("spec = %.200s", rec.Body.String())
+	}
+}
+
+func TestAdminPutRoute_ReadOnlyWithoutEditableRoutes(t *testing.T) {
+	h := testHandler()
+	r := chi.NewRouter()
+	r.Put("/admin/routes/{project}/{env}", h.AdminPutRoute)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/routes/myapp/prod",
+		strings.NewReader(`{"emails":["oncall@example.com"]}`)))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+	var p apierror.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Code != apierror.CodeReadOnly {
+		t.Errorf("code = %q, want %q", p.Code, apierror.CodeReadOnly)
+	}
+}
+
+func TestUploadArtifact(t *testing.T) {
+	h, store, _ := fakeHandler()
+	h.cfg.MaxBodyBytes = 1 << 20
+	ctx := context.Background()
+	ticket, p := h.CreateTicket(ctx, ticketRequest())
+	if p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+
+	r := chi.NewRouter()
+	r.Put("/v1/failures/{failureId}/artifacts/*", h.UploadArtifact)
+	upload := func(name string, size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/v1/failures/"+ticket.FailureID+"/artifacts/"+name+
+			"?project=myapp&env=prod&prefix="+ticket.S3Prefix, strings.NewReader(strings.Repeat("x", size)))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name, artifact string
+		size           int
+		wantStatus     int
+	}{
+		{name: "issued upload", artifact: "request.raw", size: 12, wantStatus: http.StatusOK},
+		{name: "checksums", artifact: "checksums.json", size: 2, wantStatus: http.StatusOK},
+		{name: "not issued", artifact: "files/a.bin", size: 12, wantStatus: http.StatusNotFound},
+		// request.raw was declared as 12 bytes; the body limit alone would allow this
+		{name: "over declared size", artifact: "request.raw", size: 8192, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := upload(tt.artifact, tt.size); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	// Completed failures cannot be overwritten
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploadAll(store, ticket)), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if rec := upload("envelope.json", 2); rec.Code != http.StatusConflict {
+		t.Errorf("overwrite after completion: status = %d, want 409: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploadAll(store, ticket)), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	store.Put(ticket.S3Prefix+keys.LogsName, "", []byte("0123456789"))
+
+	r := chi.NewRouter()
+	r.Get("/v1/failures/{failureId}/artifacts/*", h.DownloadArtifact)
+	download := func(name, byteRange string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/failures/"+ticket.FailureID+"/artifacts/"+name+
+			"?project=myapp&env=prod&prefix="+ticket.S3Prefix, nil)
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name, artifact, byteRange string
+		wantStatus                int
+		wantBody, wantRange       string
+	}{
+		{name: "whole", artifact: keys.LogsName, wantStatus: http.StatusOK, wantBody: "0123456789"},
+		{name: "range", artifact: keys.LogsName, byteRange: "bytes=2-4", wantStatus: http.StatusPartialContent, wantBody: "234", wantRange: "bytes 2-4/10"},
+		{name: "suffix range", artifact: keys.LogsName, byteRange: "bytes=-3", wantStatus: http.StatusPartialContent, wantBody: "789", wantRange: "bytes 7-9/10"},
+		{name: "unsatisfiable", artifact: keys.LogsName, byteRange: "bytes=20-", wantStatus: http.StatusRequestedRangeNotSatisfiable, wantRange: "bytes */10"},
+		{name: "missing", artifact: "files/a.bin", wantStatus: http.StatusNotFound},
+		{name: "unknown name", artifact: "../secrets", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := download(tt.artifact, tt.byteRange)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if rec.Code >= 300 {
+				return
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+				t.Errorf("Content-Type = %q, want the declared text/plain", ct)
+			}
+			if cl := rec.Header().Get("Content-Length"); cl != strconv.Itoa(len(tt.wantBody)) {
+				t.Errorf("Content-Length = %q", cl)
+			}
+		})
+	}
+}
+
+func TestDownloadArtifact_RedirectsPastLambdaLimit(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploadAll(store, ticket)), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	store.Put(ticket.S3Prefix+keys.ScreenshotName, "image/png", make([]byte, apigw.MaxResponseBytes))
+
+	r := chi.NewRouter()
+	r.Get("/v1/failures/{failureId}/artifacts/*", h.DownloadArtifact)
+	ev := events.APIGatewayV2HTTPRequest{
+		Version:        "2.0",
+		RawPath:        "/v1/failures/" + ticket.FailureID + "/artifacts/" + keys.ScreenshotName,
+		RawQueryString: "project=myapp&env=prod&prefix=" + ticket.S3Prefix,
+	}
+	ev.RequestContext.HTTP.Method = http.MethodGet
+	payload, _ := json.Marshal(ev)
+
+	resp, err := apigw.Serve(ctx, r, payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resp.(events.APIGatewayV2HTTPResponse)
+	if got.StatusCode != http.StatusFound || !strings.HasSuffix(got.Headers["Location"], keys.ScreenshotName) {
+		t.Errorf("response = %d %v, want a redirect to the presigned artifact", got.StatusCode, got.Headers)
+	}
+}
+
+func TestNotificationLinks(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	signer, err := links.NewSigner("https://api.example.com", "0123456789abcdef", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.WithLinks(signer)
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploadAll(store, ticket)), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	sent := notifier.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d notifications, want 1", len(sent))
+	}
+
+	// Links are followed without credentials
+	r := chi.NewRouter()
+	r.Get("/r/{failureId}/*", h.RedirectArtifact)
+	r.Get("/ack/{failureId}", h.AckLink)
+	r.Post("/ack/{failureId}", h.ConfirmAck)
+	send := func(method, link string) *httptest.ResponseRecorder {
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, u.RequestURI(), nil))
+		return rec
+	}
+	follow := func(link string) *httptest.ResponseRecorder {
+		return send(http.MethodGet, link)
+	}
+
+	if rec := follow(sent[0].EnvelopeURL); rec.Code != http.StatusFound || !strings.HasSuffix(rec.Header().Get("Location"), "/envelope.json") {
+		t.Errorf("envelope link: status = %d, Location = %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	tampered := strings.Replace(sent[0].EnvelopeURL, "/envelope.json", "/request.raw", 1)
+	if rec := follow(tampered); rec.Code != http.StatusForbidden {
+		t.Errorf("link to another artifact: status = %d, want 403", rec.Code)
+	}
+	if rec := follow("https://api.example.com/r/" + ticket.FailureID + "/envelope.json"); rec.Code != http.StatusForbidden {
+		t.Errorf("unsigned link: status = %d, want 403", rec.Code)
+	}
+
+	// Following the link, as mail scanners do, only shows the confirmation
+	rec := follow(sent[0].AckURL)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), `<form method="post">`) {
+		t.Fatalf("ack link: status = %d, Content-Type = %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if a, err := ack.Get(ctx, store, ticket.FailureID); err != nil || a.Acked() {
+		t.Fatalf("ack record after GET = %+v, %v, want it unacknowledged", a, err)
+	}
+
+	rec = send(http.MethodPost, sent[0].AckURL)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ack confirmation: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var ackResp models.AckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &ackResp); err != nil || ackResp.FailureID != ticket.FailureID || ackResp.AckedBy != ackedByLink {
+		t.Errorf("ack response = %+v, %v", ackResp, err)
+	}
+	if rec := follow(strings.Replace(sent[0].AckURL, ticket.FailureID, "other", 1)); rec.Code != http.StatusForbidden {
+		t.Errorf("ack link of another failure: status = %d, want 403", rec.Code)
+	}
+	if rec := send(http.MethodPost, strings.Replace(sent[0].AckURL, ticket.FailureID, "other", 1)); rec.Code != http.StatusForbidden {
+		t.Errorf("ack confirmation of another failure: status = %d, want 403", rec.Code)
+	}
+}
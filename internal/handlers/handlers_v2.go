@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// CreateTicketV2 handles POST /v2/tickets
+func (h *Handler) CreateTicketV2(w http.ResponseWriter, r *http.Request) {
+	var req models.UploadTicketRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	resp, p := h.CreatePostTicket(r.Context(), &req)
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, resp)
+}
+
+// CompleteTicketV2 handles POST /v2/tickets/{failureId}/complete
+func (h *Handler) CompleteTicketV2(w http.ResponseWriter, r *http.Request) {
+	var req models.CompleteTicketRequest
+	if p := h.decodeJSON(r, &req); p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	resp, replayed, p := h.CompleteTicket(r.Context(), chi.URLParam(r, "failureId"), &req, r.Header.Get(IdempotencyKeyHeader))
+	if p != nil {
+		apierror.Write(w, r, p)
+		return
+	}
+
+	if replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	status := http.StatusOK
+	if resp.Status == models.CompletionPending {
+		status = http.StatusAccepted
+	}
+	h.writeJSON(w, status, resp)
+}
+
+// NotFoundV2 answers unknown v2 routes with a problem rather than plain text
+func (h *Handler) NotFoundV2(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, apierror.NotFound("No such API route"))
+}
+
+// MethodNotAllowedV2 answers v2 routes called with the wrong method
+func (h *Handler) MethodNotAllowedV2(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, apierror.New(http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "Method not allowed for this route"))
+}
@@ -0,0 +1,988 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apigw"
+	"github.com/yourorg/failure-uploader/internal/athena"
+	"github.com/yourorg/failure-uploader/internal/budget"
+	"github.com/yourorg/failure-uploader/internal/canary"
+	"github.com/yourorg/failure-uploader/internal/dedup"
+	"github.com/yourorg/failure-uploader/internal/digest"
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/envelope"
+	"github.com/yourorg/failure-uploader/internal/eventbus"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/priority"
+	"github.com/yourorg/failure-uploader/internal/quota"
+	"github.com/yourorg/failure-uploader/internal/storage"
+	"github.com/yourorg/failure-uploader/internal/thumbs"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+	"github.com/yourorg/failure-uploader/internal/validation"
+	"github.com/yourorg/failure-uploader/internal/verify"
+)
+
+// The methods in this file are the transport-agnostic core of the ticket,
+// complete and read APIs. The caller is the principal in ctx; failures are
+// returned as problems for the transport to encode, never written.
+
+// CreateTicket validates req and issues presigned upload URLs for a new failure
+func (h *Handler) CreateTicket(ctx context.Context, req *models.UploadTicketRequest) (*models.UploadTicketResponse, *apierror.Problem) {
+	cfg, profs := h.limitsConfig()
+	if errs := validation.ValidateUploadTicketRequest(req, cfg, profs); len(errs) > 0 {
+		return nil, validationProblem(errs)
+	}
+
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
+	if p := h.checkProject(ctx, req.Project); p != nil {
+		return nil, p
+	}
+	if p := h.checkSchemaVersion(ctx, req.SchemaVersion); p != nil {
+		return nil, p
+	}
+	if p := h.checkBudget(ctx, req); p != nil {
+		return nil, p
+	}
+	if p := h.checkQuota(ctx, req); p != nil {
+		return nil, p
+	}
+
+	// Generate failure ID
+	failureID := uuid.New().String()
+	tenant := h.tenant(ctx)
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Str("priority", req.Priority).
+		Msg("creating upload ticket")
+
+	// Build keys and presigned URLs; canary projects use the v2 key scheme
+	plan, err := canary.Run(ctx, h.canary, "key-scheme-v2", req.Project, failureID,
+		func(ctx context.Context) (*ticketPlan, error) {
+			return h.planTicket(ctx, keys.NewBuilder(req.Project, req.Env, failureID).WithTenant(tenant), req)
+		},
+		func(ctx context.Context) (*ticketPlan, error) {
+			return h.planTicket(ctx, keys.NewBuilderV2(req.Project, req.Env, failureID).WithTenant(tenant), req)
+		},
+		sameLayout,
+	)
+	if err != nil {
+		return nil, apierror.Dependency(apierror.CodePresignFailed, "Failed to generate presigned URLs")
+	}
+
+	if len(plan.failed) > 0 {
+		logging.FromContext(ctx).Warn().
+			Str("failureId", failureID).
+			Int("failed", len(plan.failed)).
+			Msg("issuing partial upload ticket")
+	}
+
+	metrics.TicketsIssued.Inc(req.Project)
+	h.trackTicket(ctx, req, failureID, plan)
+	h.publishTicket(ctx, req, failureID, tenant, plan.prefix)
+
+	return &models.UploadTicketResponse{
+		SchemaVersion:    envelope.SchemaVersion,
+		FailureID:        failureID,
+		S3Prefix:         plan.prefix,
+		Uploads:          *plan.uploads,
+		ExpiresInSeconds: int(h.cfg.PresignTTL.Seconds()),
+		Failed:           plan.failed,
+	}, nil
+}
+
+// RetryPresign presigns again the uploads of the ticket of failureID named in
+// req, typically those a partial ticket listed as failed. Uploads that fail
+// again are listed in the response's Failed.
+func (h *Handler) RetryPresign(ctx context.Context, failureID string, req *models.PresignRetryRequest) (*models.PresignRetryResponse, *apierror.Problem) {
+	if errs := validation.ValidatePresignRetryRequest(req, failureID); len(errs) > 0 {
+		return nil, validationProblem(errs)
+	}
+
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
+	if p := h.checkProject(ctx, req.Project); p != nil {
+		return nil, p
+	}
+	rec, err := tickets.Get(ctx, h.presigner, failureID)
+	if errors.Is(err, tickets.ErrNotFound) || (err == nil && (rec.Project != req.Project || rec.Env != req.Env)) {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNoTicket, "No upload ticket tracked for this failure")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to read upload ticket")
+		return nil, apierror.Dependency(apierror.CodeReadFailed, "Failed to read upload ticket")
+	}
+	if p := h.checkTenant(ctx, rec.S3Prefix); p != nil {
+		return nil, p
+	}
+	if rec.State != tickets.StateIssued {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeAlreadyCompleted, "Upload ticket is no longer open").
+			WithDetail("the ticket is %s", rec.State)
+	}
+
+	// Only the ticket's own uploads may be presigned, with its declared sizes
+	ticket := &models.UploadTicketRequest{Artifacts: rec.Artifacts}
+	if rec.Request != nil {
+		ticket.Request = *rec.Request
+	}
+	opts := uploadOptions(ticket)
+	resp := &models.PresignRetryResponse{
+		FailureID:        failureID,
+		S3Prefix:         rec.S3Prefix,
+		Uploads:          make([]models.PresignedUpload, 0, len(req.Artifacts)),
+		ExpiresInSeconds: int(h.cfg.PresignTTL.Seconds()),
+	}
+	var errs []validation.ValidationError
+	for i, name := range req.Artifacts {
+		_, ok := opts[name]
+		if !ok || (name != "checksums.json" && !slices.Contains(rec.Expected, path.Join(rec.S3Prefix, name))) {
+			errs = append(errs, validation.ValidationError{Field: fmt.Sprintf("artifacts[%d]", i), Message: "not an upload of this ticket"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, validationProblem(errs)
+	}
+
+	for _, name := range req.Artifacts {
+		key := path.Join(rec.S3Prefix, name)
+		up, err := h.presignUpload(ctx, key, opts[name])
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("failureId", failureID).Str("key", key).Msg("failed to presign upload")
+			resp.Failed = append(resp.Failed, models.FailedUpload{Artifact: name, Key: key, Error: "Failed to generate presigned URL"})
+			continue
+		}
+		resp.Uploads = append(resp.Uploads, up)
+	}
+	if len(resp.Uploads) == 0 {
+		return nil, apierror.Dependency(apierror.CodePresignFailed, "Failed to generate presigned URLs")
+	}
+	return resp, nil
+}
+
+// checkQuota charges the ticket of req against its project's daily quota.
+// Failures to count are logged and the ticket allowed, since losing failure
+// reports costs more than going over a quota.
+func (h *Handler) checkQuota(ctx context.Context, req *models.UploadTicketRequest) *apierror.Problem {
+	limits := h.limits(req.Project)
+	limit := quota.Usage{Failures: limits.DailyFailures, Bytes: limits.DailyBytes}
+	charge := h.quotas.Charge
+	if isCritical(criticalAllowed(ctx), req.Priority, req.Severity) {
+		// Critical failures count towards the quota but are never refused
+		charge = h.quotas.ChargeExempt
+	}
+	resets, err := charge(ctx, req.Project, declaredBytes(req), limit)
+	if errors.Is(err, quota.ErrExceeded) {
+		return apierror.QuotaExceeded(time.Until(resets)).
+			WithDetail("the daily quota of %s resets at %s", req.Project, resets.Format(time.RFC3339))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Msg("failed to charge daily quota - allowing ticket")
+	}
+	return nil
+}
+
+// isCritical reports whether a failure of prio and severity is handled as
+// critical, which callers not allowed to mark failures critical never get
+func isCritical(allowed bool, prio, severity string) bool {
+	return allowed && (priority.IsCritical(prio) || severity == priority.SeverityCritical)
+}
+
+// checkBudget refuses tickets for large uploads once their project stores its
+// storage budget. Like quotas, it fails open when usage cannot be read.
+func (h *Handler) checkBudget(ctx context.Context, req *models.UploadTicketRequest) *apierror.Problem {
+	limit := h.limits(req.Project).StorageBudgetBytes
+	stored, err := h.storage.Check(ctx, req.Project, declaredBytes(req), limit, h.cfg.StorageBudgetExemptBytes)
+	if errors.Is(err, budget.ErrExceeded) {
+		return apierror.BudgetExceeded().
+			WithDetail("%s stores %d of its %d byte budget; uploads over %d bytes are refused until failures are purged or the budget is raised",
+				req.Project, stored, limit, h.cfg.StorageBudgetExemptBytes)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Msg("failed to check storage budget - allowing ticket")
+	}
+	return nil
+}
+
+// recordStored counts the uploaded objects of a completed failure towards its
+// project's stored bytes
+func (h *Handler) recordStored(ctx context.Context, req *models.UploadCompleteRequest) {
+	if h.storage == nil {
+		return
+	}
+	sizes, err := h.presigner.ObjectSizes(ctx, req.UploadedKeys)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", req.FailureID).Msg("failed to read sizes of stored objects")
+		return
+	}
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	h.storage.Record(ctx, req.Project, total)
+}
+
+// declaredBytes sums the sizes of every upload a ticket declares
+func declaredBytes(req *models.UploadTicketRequest) int64 {
+	total := req.Request.BodyBytes
+	for _, f := range req.Request.Files {
+		total += f.Bytes
+	}
+	if a := req.Artifacts; a != nil {
+		for _, slot := range []*models.ArtifactInfo{a.Logs, a.Screenshot, a.Console} {
+			if slot != nil {
+				total += slot.Bytes
+			}
+		}
+	}
+	return total
+}
+
+// publishTicket publishes the TicketCreated event of an issued ticket
+func (h *Handler) publishTicket(ctx context.Context, req *models.UploadTicketRequest, failureID, tenant, prefix string) {
+	h.publish(ctx, eventbus.TicketCreated{
+		Version:   eventbus.SchemaVersion,
+		FailureID: failureID,
+		Tenant:    tenant,
+		Project:   req.Project,
+		Env:       req.Env,
+		Priority:  req.Priority,
+		S3Prefix:  prefix,
+		Files:     len(req.Request.Files),
+		Principal: middleware.PrincipalID(ctx),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// CompleteUpload verifies the uploads of req, finalizes the failure's envelope
+// and notifies about it. idempotencyKey defaults to the failure ID; a retry
+// under the same key returns the stored response with replayed set.
+//
+// With pending verification configured, the completion is checked and
+// queued instead, and the response's status is pending. Critical completions
+// are never queued behind bulk ones.
+func (h *Handler) CompleteUpload(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string) (*models.UploadCompleteResponse, bool, *apierror.Problem) {
+	return h.completeUpload(ctx, req, idempotencyKey, criticalAllowed(ctx), h.pending != nil)
+}
+
+// ProcessVerification verifies and processes a completion queued by
+// CompleteUpload. It runs without a principal, since the request's project
+// and tenant were authorized before it was queued, and whether it may be
+// critical was decided then too. Problems a retry may
+// resolve, such as objects not visible yet, are returned so the message is
+// redelivered; others drop the completion.
+func (h *Handler) ProcessVerification(ctx context.Context, m verify.Message) error {
+	_, _, p := h.completeUpload(ctx, &m.Request, m.IdempotencyKey, m.CriticalAllowed, false)
+	if p == nil {
+		return nil
+	}
+	if p.Retryable || p.Status >= http.StatusInternalServerError {
+		return fmt.Errorf("%s: %s", p.Code, p.Title)
+	}
+	logging.FromContext(ctx).Error().
+		Str("failureId", m.Request.FailureID).
+		Str("code", string(p.Code)).
+		Str("detail", p.Detail).
+		Msg("dropping queued completion that cannot succeed")
+	return nil
+}
+
+// completeUpload implements CompleteUpload; with pending set, non-critical
+// completions are queued after the checks that need the caller's principal.
+// allowCritical is whether the caller may mark the failure critical.
+func (h *Handler) completeUpload(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string, allowCritical, pending bool) (resp *models.UploadCompleteResponse, replayed bool, problem *apierror.Problem) {
+	errs := validation.ValidateUploadCompleteRequest(req, h.cfg)
+	errs = append(errs, validation.ValidateIdempotencyKey(idempotencyKey)...)
+	if len(errs) > 0 {
+		return nil, false, validationProblem(errs)
+	}
+
+	// Objects the service writes are derived from the failure's location, which
+	// validation checked every uploaded key against, never from the client's list
+	loc, _ := keys.Parse(req.UploadedKeys[0])
+	kb := loc.Builder()
+
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
+	if p := h.checkProject(ctx, req.Project); p != nil {
+		return nil, false, p
+	}
+	if p := h.checkTenant(ctx, req.UploadedKeys...); p != nil {
+		return nil, false, p
+	}
+	if p := h.checkSchemaVersion(ctx, req.SchemaVersion); p != nil {
+		return nil, false, p
+	}
+
+	// Retries of a finished completion get its response without being verified
+	// or notified again
+	claim, stored, p := h.claimCompletion(ctx, req, idempotencyKey)
+	if p != nil {
+		return nil, false, p
+	}
+	if stored != nil {
+		return stored, true, nil
+	}
+	if claim != nil {
+		// Error responses release the claim, so the client can retry at once
+		defer func() {
+			if claim.Completion.Response == nil {
+				h.releaseCompletion(ctx, claim)
+			}
+		}()
+	}
+
+	// Verify out-of-band; the claim is released, so the consumer can take it
+	if pending && !isCritical(allowCritical, req.Priority, "") {
+		if err := h.pending.Enqueue(ctx, req, idempotencyKey, allowCritical); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", req.FailureID).Msg("failed to queue verification")
+			return nil, false, apierror.Dependency(apierror.CodeVerificationFailed, "Failed to queue verification")
+		}
+		logging.FromContext(ctx).Info().Str("failureId", req.FailureID).Msg("upload complete queued for verification")
+		return &models.UploadCompleteResponse{SchemaVersion: envelope.SchemaVersion, Status: models.CompletionPending}, false, nil
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", req.FailureID).
+		Str("priority", req.Priority).
+		Bool("encrypted", req.Encryption != nil).
+		Int("uploadedKeys", len(req.UploadedKeys)).
+		Msg("processing upload complete")
+
+	// Verify all uploaded keys exist in S3, re-checking missing ones per the
+	// verification strategy
+	verified, err := h.verifier.Verify(ctx, h.presigner, req.UploadedKeys)
+	if verified.Attempts > 1 {
+		outcome := "recovered"
+		if len(verified.Missing) > 0 {
+			outcome = "missing"
+		}
+		metrics.VerificationRetries.Inc(req.Project, outcome)
+	}
+	missing := verified.Missing
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to verify objects")
+		metrics.VerificationFailures.Inc(req.Project, "error")
+		return nil, false, apierror.Dependency(apierror.CodeVerificationFailed, "Failed to verify uploaded objects")
+	}
+
+	if len(missing) > 0 {
+		logging.FromContext(ctx).Warn().
+			Str("failureId", req.FailureID).
+			Strs("missing", missing).
+			Msg("missing objects in S3")
+		metrics.VerificationFailures.Inc(req.Project, "missing_objects")
+		// Uploads may still be in flight, so the client may retry
+		return nil, false, apierror.BadRequest(apierror.CodeMissingObjects, "Some objects were not found in S3").WithDetail("missing: %s", strings.Join(missing, ", ")).WithRetry(time.Second)
+	}
+
+	// Enforce the sizes the ticket declared; tickets predating request metadata are not checked
+	if claim != nil && claim.Request != nil {
+		if p := h.checkUploadSizes(ctx, req, claim); p != nil {
+			return nil, false, p
+		}
+	}
+
+	// Hash the uploaded objects on behalf of clients that cannot (before any rewrites below)
+	var checksums map[string]string
+	if req.ServerChecksums {
+		var mismatched []string
+		checksums, mismatched, err = h.writeServerChecksums(ctx, req, kb)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", req.FailureID).Msg("failed to compute checksums")
+			metrics.VerificationFailures.Inc(req.Project, "error")
+			return nil, false, apierror.Dependency(apierror.CodeChecksumFailed, "Failed to compute checksums")
+		}
+		if len(mismatched) > 0 {
+			logging.FromContext(ctx).Warn().
+				Str("failureId", req.FailureID).
+				Strs("mismatched", mismatched).
+				Msg("checksum mismatch")
+			metrics.VerificationFailures.Inc(req.Project, "checksum_mismatch")
+			return nil, false, apierror.BadRequest(apierror.CodeChecksumMismatch, "Some objects do not match the provided sha256").WithDetail("mismatched: %s", strings.Join(mismatched, ", "))
+		}
+	}
+
+	// Generate the canonical envelope from the ticket when asked, instead of
+	// trusting the client's
+	var generated *models.Envelope
+	if req.GenerateEnvelope {
+		if generated, problem = h.generateEnvelope(ctx, req, kb.Prefix()); problem != nil {
+			return nil, false, problem
+		}
+	}
+
+	// The envelope is the failure's, when it was uploaded or generated
+	envelopeKey := ""
+	if generated != nil || slices.Contains(req.UploadedKeys, kb.Envelope()) {
+		envelopeKey = kb.Envelope()
+	}
+
+	// Link the envelope through a signed short link when links are configured, so
+	// the link outlives presigned URLs; otherwise fall back to a presigned GET URL (best-effort)
+	envelopeURL := ""
+	if envelopeKey != "" && h.links != nil {
+		h.recordLinkTarget(ctx, req, envelopeKey)
+		envelopeURL = h.links.URL(req.FailureID, "envelope.json")
+	} else if envelopeKey != "" {
+		envelopeURL, err = h.presigner.PresignGet(ctx, envelopeKey)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("failed to generate envelope URL")
+			envelopeURL = ""
+		}
+	}
+
+	// Withhold download links until the malware scan clears the uploads
+	scanStatus := h.scanStatus(ctx, req.FailureID, req.UploadedKeys)
+	if scanStatus != "" {
+		envelopeURL = ""
+	}
+
+	// Read envelope.json from S3 (best-effort) to enrich email content,
+	// upgrading envelopes of older SDKs to the current schema version
+	var envObj models.Envelope
+	envelopeOK := false
+	var group *models.Group
+	if generated != nil {
+		envObj, envelopeOK = *generated, true
+	} else if envelopeKey != "" {
+		b, err := h.presigner.GetObjectBytes(ctx, envelopeKey)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", envelopeKey).Msg("failed to read envelope from S3")
+		} else if decoded, err := envelope.Decode(b, kb.Prefix(), h.cfg.StrictSchema); errors.Is(err, envelope.ErrUnsupportedVersion) {
+			return nil, false, apierror.BadRequest(apierror.CodeUnsupportedSchema, "Unsupported envelope schema version").WithDetail("%s", err)
+		} else if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", envelopeKey).Msg("failed to parse envelope.json")
+		} else {
+			envObj, envelopeOK = *decoded, true
+		}
+	}
+
+	// Redact the envelope, assign the failure to its group and write it back (best-effort)
+	if envelopeOK {
+		if envObj.SchemaVersion > envelope.SchemaVersion {
+			logging.FromContext(ctx).Warn().Int("schemaVersion", envObj.SchemaVersion).Str("failureId", req.FailureID).Msg("rewriting envelope of a newer schema version without its unknown fields")
+		}
+		envObj.SchemaVersion = envelope.SchemaVersion
+		envObj.Project, envObj.Env, envObj.FailureID = req.Project, req.Env, req.FailureID
+		// Verify artifact content before anything is written, so a rejected
+		// completion leaves the failure to the reaper; encrypted artifacts are
+		// opaque to the service and are never sniffed
+		if req.Encryption == nil {
+			envObj.ContentMismatches = h.sniffArtifacts(ctx, &envObj, req.UploadedKeys)
+			if p := h.rejectMismatches(ctx, req, envObj.ContentMismatches); p != nil {
+				return nil, false, p
+			}
+		}
+		envObj.Tenant = loc.Tenant
+		envObj.Request.URL = h.redactor.URL(envObj.Request.URL)
+		if envObj.Response != nil {
+			envObj.Response.ErrorMessage = h.redactor.String(envObj.Response.ErrorMessage)
+		}
+		envObj.Encryption = req.Encryption
+		envObj.Artifacts = uploadedArtifacts(kb.Prefix(), req.UploadedKeys)
+		if !priority.ValidSeverity(envObj.Severity) {
+			envObj.Severity = ""
+		}
+		if errs := validation.ValidateTriage(envObj.Tags, envObj.Description); len(errs) > 0 {
+			logging.FromContext(ctx).Warn().Str("failureId", req.FailureID).Str("field", errs[0].Field).Msg("dropping invalid tags and description from envelope")
+			envObj.Tags, envObj.Description = nil, ""
+		}
+		if errs := validation.ValidateTrace(envObj.Request); len(errs) > 0 {
+			logging.FromContext(ctx).Warn().Str("failureId", req.FailureID).Str("field", errs[0].Field).Msg("dropping invalid trace IDs from envelope")
+			envObj.Request.TraceID, envObj.Request.SpanID, envObj.Request.RequestID = "", "", ""
+		}
+		envObj.Tags = h.redactTags(envObj.Tags)
+		envObj.Description = h.redactor.String(envObj.Description)
+		envObj.Client.UserID = tickets.HashUserID(h.cfg.UserIDHashKey, envObj.Client.UserID)
+		h.indexUser(ctx, tickets.Record{
+			FailureID: req.FailureID,
+			Project:   req.Project,
+			Env:       req.Env,
+			S3Prefix:  kb.Prefix(),
+			IssuedAt:  envObj.CreatedAt,
+			UserHash:  envObj.Client.UserID,
+		})
+		group = h.assignGroup(ctx, &envObj)
+		h.recordStats(ctx, &envObj)
+		h.writeEnvelope(ctx, envelopeKey, &envObj)
+	}
+
+	// Filter and redact the stored headers artifact (best-effort); encrypted
+	// artifacts are opaque to the service and are never parsed
+	if slices.Contains(req.UploadedKeys, kb.RequestHeaders()) && req.Encryption == nil {
+		h.redactHeadersArtifact(ctx, req.Project, kb.RequestHeaders())
+	}
+
+	// Queue image attachments for thumbnails (best-effort)
+	var thumbnails []string
+	if envelopeOK && h.thumbs != nil {
+		if thumbnails = thumbs.Sources(&envObj); len(thumbnails) > 0 {
+			h.queueThumbnails(ctx, req, kb.Prefix(), thumbnails)
+		}
+	}
+
+	// Retag the failure's objects, including those rewritten above, so lifecycle
+	// rules can tell them from abandoned uploads (best-effort)
+	if err := h.presigner.MarkComplete(ctx, req.UploadedKeys[0]); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", req.FailureID).Msg("failed to tag completed failure")
+	}
+
+	// Critical failures are emailed straight away even in digest mode and skip the dedup window
+	critical := isCritical(allowCritical, req.Priority, envObj.Severity)
+
+	// In digest mode, record the failure for the scheduled summary instead of emailing now
+	if h.cfg.NotifyMode == "digest" {
+		entry := digest.Entry{
+			FailureID:   req.FailureID,
+			Project:     req.Project,
+			Env:         req.Env,
+			Method:      envObj.Request.Method,
+			URL:         envObj.Request.URL,
+			AppVersion:  envObj.Client.AppVersion,
+			Platform:    envObj.Client.Platform,
+			EnvelopeKey: envelopeKey,
+			CompletedAt: time.Now().UTC(),
+
+			ContentMismatches: len(envObj.ContentMismatches),
+		}
+		if scanStatus != "" {
+			entry.ScanKeys = req.UploadedKeys
+		}
+		if err := digest.Record(ctx, h.presigner, entry); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", req.FailureID).Msg("failed to record digest entry")
+		}
+	}
+	if (h.cfg.NotifyMode != "digest" || critical) && h.emailer != nil {
+		// Send email notification
+		notif := email.FailureNotification{
+			FailureID:   req.FailureID,
+			Project:     req.Project,
+			Env:         req.Env,
+			Method:      envObj.Request.Method,
+			URL:         envObj.Request.URL,
+			AppVersion:  envObj.Client.AppVersion,
+			Platform:    envObj.Client.Platform,
+			EnvelopeURL: envelopeURL,
+			Critical:    critical,
+			Severity:    envObj.Severity,
+			Tags:        envObj.Tags,
+			Description: envObj.Description,
+			TraceID:     envObj.Request.TraceID,
+			SpanID:      envObj.Request.SpanID,
+			RequestID:   envObj.Request.RequestID,
+			Tenant:      envObj.Tenant,
+			GroupID:     envObj.GroupID,
+			ScanStatus:  scanStatus,
+		}
+		if group != nil {
+			notif.Occurrences = group.Count
+		}
+		h.describeResponse(ctx, &notif, envObj.Response)
+		if envelopeOK && req.Encryption == nil {
+			notif.Curl = h.notificationCommand(ctx, &envObj, kb.Prefix())
+		}
+		for _, m := range envObj.ContentMismatches {
+			notif.ContentMismatches = append(notif.ContentMismatches,
+				fmt.Sprintf("%s declared %s, detected %s", m.Artifact, m.Declared, m.Detected))
+		}
+		if len(thumbnails) > 0 && scanStatus == "" {
+			notif.ThumbnailURL = h.thumbnailURL(ctx, req.FailureID, kb.Prefix(), thumbnails[0])
+		}
+		if h.links != nil {
+			notif.AckURL = h.links.AckURL(req.FailureID)
+		}
+
+		send := true
+		if h.dedup != nil && !critical {
+			fp := dedup.Fingerprint(tenantProject(envObj.Tenant, req.Project), req.Env, envObj.Request.Method, envObj.Request.URL)
+			decision := h.dedup.Check(ctx, fp, time.Now().UTC())
+			send = decision.Notify
+			notif.Suppressed = decision.Suppressed
+			notif.SuppressedSince = decision.Since
+			if !send {
+				logging.FromContext(ctx).Info().
+					Str("failureId", req.FailureID).
+					Str("fingerprint", fp).
+					Int("suppressed", decision.Suppressed).
+					Msg("notification suppressed by dedup window")
+			}
+		}
+
+		if send {
+			// Fans out to the project's routed destinations when routing is configured
+			if err := h.emailer.SendFailureNotification(ctx, notif); err != nil {
+				logging.FromContext(ctx).Error().Err(err).Msg("failed to send failure notification")
+				// Don't fail the request if notification fails
+			} else {
+				h.trackAck(ctx, notif, envelopeKey)
+			}
+		}
+	}
+
+	resp = &models.UploadCompleteResponse{SchemaVersion: envelope.SchemaVersion, Status: models.CompletionOK, Checksums: checksums, Encryption: req.Encryption}
+	metrics.UploadsCompleted.Inc(req.Project)
+	h.recordStored(ctx, req)
+	completed := eventbus.Completed{
+		Version:     eventbus.SchemaVersion,
+		FailureID:   req.FailureID,
+		Tenant:      envObj.Tenant,
+		Project:     req.Project,
+		Env:         req.Env,
+		Critical:    critical,
+		Method:      envObj.Request.Method,
+		URL:         envObj.Request.URL,
+		AppVersion:  envObj.Client.AppVersion,
+		Platform:    envObj.Client.Platform,
+		EnvelopeKey: envelopeKey,
+		Encrypted:   req.Encryption != nil,
+		CompletedAt: time.Now().UTC(),
+	}
+	if envObj.Response != nil {
+		completed.StatusCode = envObj.Response.StatusCode
+		completed.ErrorClass = envObj.Response.ErrorClass
+	}
+	h.publish(ctx, completed)
+	if envelopeOK {
+		h.forwardSentry(ctx, &envObj, kb.Prefix(), envelopeURL, group, critical)
+	}
+	if envelopeOK && h.cfg.MetadataIndex {
+		entry := athena.Entry{
+			Envelope:    &envObj,
+			EnvelopeKey: envelopeKey,
+			Critical:    critical,
+			Encrypted:   req.Encryption != nil,
+			CompletedAt: completed.CompletedAt,
+		}
+		if group != nil {
+			entry.Occurrences = group.Count
+		}
+		h.writeIndex(ctx, entry)
+	}
+	if claim != nil {
+		h.finishCompletion(ctx, claim, *resp)
+	} else {
+		h.completeTicket(ctx, req.FailureID)
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", req.FailureID).
+		Msg("upload complete processed successfully")
+
+	return resp, false, nil
+}
+
+// claimCompletion claims the completion of req on its ticket under
+// idempotencyKey. A retried call gets the stored response instead of a claim.
+// Keys the ticket did not expect are refused. Failures without a readable
+// ticket of their project are processed without idempotency, so all are nil.
+func (h *Handler) claimCompletion(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string) (*tickets.Record, *models.UploadCompleteResponse, *apierror.Problem) {
+	rec, err := tickets.Get(ctx, h.presigner, req.FailureID)
+	if err != nil {
+		if !errors.Is(err, tickets.ErrNotFound) {
+			logging.FromContext(ctx).Warn().Err(err).Str("failureId", req.FailureID).Msg("failed to read upload ticket")
+		}
+		return nil, nil, nil
+	}
+	// A tracked ticket fixes the failure's uploads, so keys it did not hand
+	// out, such as another failure's, are refused; checksums.json is issued
+	// with every ticket but not expected
+	if len(rec.Expected) > 0 {
+		var errs []validation.ValidationError
+		for i, k := range req.UploadedKeys {
+			if k != path.Join(rec.S3Prefix, "checksums.json") && !slices.Contains(rec.Expected, k) {
+				errs = append(errs, validation.ValidationError{Field: fmt.Sprintf("uploadedKeys[%d]", i), Message: "not an upload of this ticket"})
+			}
+		}
+		if len(errs) > 0 {
+			return nil, nil, validationProblem(errs)
+		}
+	}
+	if rec.Project != req.Project || rec.Env != req.Env {
+		return nil, nil, nil
+	}
+
+	key := idempotencyKey
+	if key == "" {
+		key = req.FailureID
+	}
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+
+	stored, err := tickets.Claim(ctx, h.presigner, rec, key, hex.EncodeToString(sum[:]), time.Now().UTC())
+	switch {
+	case stored != nil:
+		var resp models.UploadCompleteResponse
+		if err := json.Unmarshal(stored, &resp); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", req.FailureID).Msg("failed to parse stored upload completion")
+			return nil, nil, apierror.Internal(apierror.CodeReadFailed, "Stored completion is not valid JSON")
+		}
+		logging.FromContext(ctx).Info().Str("failureId", req.FailureID).Msg("upload complete retried, returning stored response")
+		metrics.CompletionReplays.Inc(req.Project)
+		return nil, &resp, nil
+	case errors.Is(err, tickets.ErrAlreadyCompleted):
+		return nil, nil, apierror.New(http.StatusConflict, apierror.CodeAlreadyCompleted, "Failure was already completed with another idempotency key")
+	case errors.Is(err, tickets.ErrKeyReused):
+		return nil, nil, apierror.New(http.StatusUnprocessableEntity, apierror.CodeIdempotencyKeyReused, "Idempotency key was already used with a different request")
+	case errors.Is(err, tickets.ErrInProgress):
+		return nil, nil, apierror.New(http.StatusConflict, apierror.CodeCompletionInProgress, "A completion of this failure is in progress").WithRetry(time.Second)
+	case err != nil:
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", req.FailureID).Msg("failed to claim upload completion")
+		return nil, nil, nil
+	}
+	return rec, nil, nil
+}
+
+// finishCompletion stores resp on the claimed ticket for retries and marks it
+// completed (best-effort)
+func (h *Handler) finishCompletion(ctx context.Context, claim *tickets.Record, resp models.UploadCompleteResponse) {
+	b, err := json.Marshal(resp)
+	if err == nil {
+		err = tickets.Finish(ctx, h.presigner, claim, b, time.Now().UTC())
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", claim.FailureID).Msg("failed to store upload completion")
+	}
+}
+
+// releaseCompletion drops an unfinished claim (best-effort); otherwise retries
+// wait for the lease to run out
+func (h *Handler) releaseCompletion(ctx context.Context, claim *tickets.Record) {
+	if err := tickets.Release(context.WithoutCancel(ctx), h.presigner, claim); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("failureId", claim.FailureID).Msg("failed to release upload completion")
+	}
+}
+
+// checkUploadSizes rejects uploads larger than their ticket declared
+func (h *Handler) checkUploadSizes(ctx context.Context, req *models.UploadCompleteRequest, rec *tickets.Record) *apierror.Problem {
+	sizes, err := h.presigner.ObjectSizes(ctx, req.UploadedKeys)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to read object sizes")
+		metrics.VerificationFailures.Inc(req.Project, "error")
+		return apierror.Dependency(apierror.CodeVerificationFailed, "Failed to verify uploaded objects")
+	}
+
+	limits := h.limits(req.Project)
+	mismatches := validation.CheckUploadSizes(rec.Request, rec.Artifacts, rec.S3Prefix, sizes, limits, h.cfg.UploadSizeTolerancePercent)
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	oversized := make([]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		oversized = append(oversized, m.String())
+	}
+	logging.FromContext(ctx).Warn().
+		Str("failureId", req.FailureID).
+		Strs("oversized", oversized).
+		Msg("uploads exceed declared sizes")
+	metrics.VerificationFailures.Inc(req.Project, "size_mismatch")
+	return apierror.BadRequest(apierror.CodeSizeMismatch, "Some objects are larger than declared").WithDetail("oversized: %s", strings.Join(oversized, ", "))
+}
+
+// generateEnvelope builds the envelope of req, stored under prefix, from its ticket
+func (h *Handler) generateEnvelope(ctx context.Context, req *models.UploadCompleteRequest, prefix string) (*models.Envelope, *apierror.Problem) {
+	rec, err := tickets.Get(ctx, h.presigner, req.FailureID)
+	if err != nil && !errors.Is(err, tickets.ErrNotFound) {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", req.FailureID).Msg("failed to read upload ticket")
+		return nil, apierror.Dependency(apierror.CodeReadFailed, "Failed to read upload ticket")
+	}
+	// A ticket of another project, env or prefix is reported like a missing one
+	if err != nil || rec.Project != req.Project || rec.Env != req.Env || rec.S3Prefix != prefix {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeNoTicket, "No upload ticket tracked for this failure").
+			WithDetail("upload envelope.json and omit generateEnvelope")
+	}
+
+	env, err := envelope.Generate(rec, req)
+	if err != nil {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeNoTicket, "Upload ticket predates envelope generation").
+			WithDetail("upload envelope.json and omit generateEnvelope")
+	}
+	return env, nil
+}
+
+// ReadFailure returns the stored envelope of a failure and a curl command
+// reproducing its request
+func (h *Handler) ReadFailure(ctx context.Context, failureID, project, env, prefix string) (*models.FailureResponse, *apierror.Problem) {
+	envObj, p := h.lookupFailure(ctx, failureID, project, env, prefix)
+	if p != nil {
+		return nil, p
+	}
+	ctx = logging.With(ctx, "project", envObj.Project, "env", envObj.Env)
+
+	resp := &models.FailureResponse{Envelope: *envObj}
+	if envObj.Encryption == nil {
+		resp.Curl = h.reproCommand(ctx, envObj, prefix)
+	}
+	if h.cfg.MalwareScan {
+		objKeys, err := h.presigner.ListKeys(ctx, prefix)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to list failure artifacts")
+			return nil, apierror.Dependency(apierror.CodeListFailed, "Failed to list failure artifacts")
+		}
+		resp.ScanStatus = h.scanStatus(ctx, failureID, objKeys)
+	}
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", envObj.FailureID).
+		Msg("failure read")
+
+	return resp, nil
+}
+
+// ListRecentFailures lists up to limit failures of project and env stored in
+// the last days UTC days that pass filter, newest day first. Failures are read
+// from their envelopes, so unreadable ones are skipped.
+func (h *Handler) ListRecentFailures(ctx context.Context, project, env string, days, limit int, filter models.FailureFilter) (*models.FailuresResponse, *apierror.Problem) {
+	if p := h.checkProject(ctx, project); p != nil {
+		return nil, p
+	}
+
+	tenant := h.tenant(ctx)
+	today := time.Now().UTC()
+	resp := &models.FailuresResponse{SchemaVersion: envelope.SchemaVersion, Failures: []models.FailureSummary{}}
+	for i := 0; i < days && len(resp.Failures) < limit; i++ {
+		var day []models.FailureSummary
+		for _, dayPrefix := range keys.DayPrefixes(tenant, project, env, today.AddDate(0, 0, -i)) {
+			list, err := h.presigner.ListKeys(ctx, dayPrefix)
+			if err != nil {
+				logging.FromContext(ctx).Error().Err(err).Str("prefix", dayPrefix).Msg("failed to list failures")
+				return nil, apierror.Dependency(apierror.CodeListFailed, "Failed to list failures")
+			}
+			for _, k := range list {
+				if len(resp.Failures)+len(day) >= limit {
+					break
+				}
+				loc, ok := keys.Parse(k)
+				if !ok || k != loc.Prefix+"envelope.json" {
+					continue
+				}
+				envObj, p := h.readEnvelope(ctx, loc.FailureID, loc.Prefix)
+				if p != nil || !matchesFilter(envObj, filter) {
+					continue
+				}
+				summary := summarizeFailure(envObj, loc)
+				if h.thumbs != nil {
+					summary.Thumbnails = h.listThumbnails(ctx, envObj, loc)
+				}
+				day = append(day, summary)
+			}
+		}
+		sort.Slice(day, func(a, b int) bool { return day[a].CreatedAt.After(day[b].CreatedAt) })
+		resp.Failures = append(resp.Failures, day...)
+	}
+
+	return resp, nil
+}
+
+// matchesFilter reports whether envObj passes f
+func matchesFilter(envObj *models.Envelope, f models.FailureFilter) bool {
+	if f.Severity != "" && envObj.Severity != f.Severity {
+		return false
+	}
+	for k, v := range f.Tags {
+		got, ok := envObj.Tags[k]
+		if !ok || (v != "" && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// summarizeFailure condenses the envelope of the failure at loc for listings
+func summarizeFailure(envObj *models.Envelope, loc keys.Location) models.FailureSummary {
+	s := models.FailureSummary{
+		SchemaVersion: envObj.SchemaVersion,
+		FailureID:     loc.FailureID,
+		Project:       loc.Project,
+		Env:           loc.Env,
+		S3Prefix:      loc.Prefix,
+		CreatedAt:     envObj.CreatedAt,
+		Method:        envObj.Request.Method,
+		URL:           envObj.Request.URL,
+		Severity:      envObj.Severity,
+		GroupID:       envObj.GroupID,
+		AppVersion:    envObj.Client.AppVersion,
+		Platform:      envObj.Client.Platform,
+		Encrypted:     envObj.Encryption != nil,
+		Tags:          envObj.Tags,
+		Artifacts:     envObj.Artifacts,
+		TraceID:       envObj.Request.TraceID,
+		SpanID:        envObj.Request.SpanID,
+		RequestID:     envObj.Request.RequestID,
+	}
+	if envObj.Response != nil {
+		s.StatusCode = envObj.Response.StatusCode
+		s.ErrorClass = envObj.Response.ErrorClass
+	}
+	return s
+}
+
+// lookupFailure validates a failure lookup, authorizes its project and tenant
+// and reads its envelope
+func (h *Handler) lookupFailure(ctx context.Context, failureID, project, env, prefix string) (*models.Envelope, *apierror.Problem) {
+	if errs := validation.ValidateGetFailure(project, env, prefix, failureID); len(errs) > 0 {
+		return nil, validationProblem(errs)
+	}
+
+	if p := h.checkProject(ctx, project); p != nil {
+		return nil, p
+	}
+	if p := h.checkTenant(ctx, prefix); p != nil {
+		return nil, p
+	}
+	// Responses carry the failure's data, so they are spilled to its bucket
+	apigw.SetSpillScope(ctx, project, env)
+
+	return h.readEnvelope(ctx, failureID, prefix)
+}
+
+// readEnvelope reads the envelope under a validated prefix
+func (h *Handler) readEnvelope(ctx context.Context, failureID, prefix string) (*models.Envelope, *apierror.Problem) {
+	b, err := h.presigner.GetObjectBytes(ctx, prefix+"envelope.json")
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, apierror.NotFound("Unknown failure")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to read envelope")
+		return nil, apierror.Dependency(apierror.CodeReadFailed, "Failed to read failure")
+	}
+	envObj, err := envelope.Decode(b, prefix, h.cfg.StrictSchema)
+	if errors.Is(err, envelope.ErrUnsupportedVersion) {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("stored envelope has an unsupported schema version")
+		return nil, apierror.Internal(apierror.CodeUnsupportedSchema, "Stored envelope has an unsupported schema version")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to parse envelope")
+		return nil, apierror.Internal(apierror.CodeReadFailed, "Stored envelope is not valid JSON")
+	}
+	return envObj, nil
+}
+
+// checkSchemaVersion rejects requests of a schema version newer than the
+// service's in strict mode; otherwise they are served like the current version
+func (h *Handler) checkSchemaVersion(ctx context.Context, v int) *apierror.Problem {
+	if v <= envelope.SchemaVersion {
+		return nil
+	}
+	if !envelope.Supported(v, h.cfg.StrictSchema) {
+		return apierror.BadRequest(apierror.CodeUnsupportedSchema, "Unsupported schema version").
+			WithDetail("schemaVersion %d is newer than %d", v, envelope.SchemaVersion)
+	}
+	logging.FromContext(ctx).Warn().Int("schemaVersion", v).Msg("request schema version is newer than the service's")
+	return nil
+}
@@ -0,0 +1,960 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/budget"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/envelope"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/placement"
+	"github.com/yourorg/failure-uploader/internal/quota"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/scan"
+	"github.com/yourorg/failure-uploader/internal/sniff"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+	"github.com/yourorg/failure-uploader/internal/thumbs"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+	"github.com/yourorg/failure-uploader/internal/verify"
+)
+
+// fakeHandler creates a handler backed by in-memory storage and notifications
+func fakeHandler() (*Handler, *testsupport.Store, *testsupport.Notifier) {
+	store := testsupport.NewStore()
+	notifier := &testsupport.Notifier{}
+	h := NewHandler(&config.Config{
+		MaxBodyBytes:  1024,
+		MaxFileBytes:  1024,
+		MaxTotalBytes: 2048,
+
+		MaxLogsBytes:       1024,
+		MaxScreenshotBytes: 1024,
+		MaxConsoleBytes:    1024,
+
+		PresignTTL: 15 * time.Minute,
+		NotifyMode: "immediate",
+	}, store, notifier)
+	return h, store, notifier
+}
+
+func ticketRequest() *models.UploadTicketRequest {
+	return &models.UploadTicketRequest{
+		Project: "myapp",
+		Env:     "prod",
+		Request: models.RequestInfo{Method: "POST", URL: "https://api.example.com/orders", BodyBytes: 12},
+	}
+}
+
+// uploadAll stores an object for every presigned upload of resp, with a
+// valid envelope
+func uploadAll(store *testsupport.Store, resp *models.UploadTicketResponse) []string {
+	u := resp.Uploads
+	store.Put(u.Envelope.Key, "application/json", []byte(`{"request":{"method":"POST","url":"https://api.example.com/orders"}}`))
+	var uploaded []string
+	for _, up := range []models.PresignedUpload{u.Envelope, u.RequestRaw, u.RequestHeaders, u.ResponseRaw} {
+		if up.Key != u.Envelope.Key {
+			store.Put(up.Key, "application/octet-stream", []byte("data"))
+		}
+		uploaded = append(uploaded, up.Key)
+	}
+	return uploaded
+}
+
+func completeRequest(resp *models.UploadTicketResponse, uploaded []string) *models.UploadCompleteRequest {
+	return &models.UploadCompleteRequest{FailureID: resp.FailureID, Project: "myapp", Env: "prod", UploadedKeys: uploaded}
+}
+
+func TestCreateTicket(t *testing.T) {
+	h, store, _ := fakeHandler()
+
+	resp, p := h.CreateTicket(context.Background(), ticketRequest())
+	if p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+	if !strings.HasPrefix(resp.Uploads.Envelope.PutURL, store.BaseURL+"/"+resp.S3Prefix) {
+		t.Errorf("envelope URL = %q, want one under %s", resp.Uploads.Envelope.PutURL, resp.S3Prefix)
+	}
+	rec, err := tickets.Get(context.Background(), store, resp.FailureID)
+	if err != nil {
+		t.Fatalf("ticket not stored: %v", err)
+	}
+	// The auto-completion worker waits for every upload but checksums.json
+	if len(rec.Expected) != 4 || rec.Expected[0] != resp.Uploads.Envelope.Key || slices.Contains(rec.Expected, resp.Uploads.Checksums.Key) {
+		t.Errorf("expected keys = %v", rec.Expected)
+	}
+}
+
+func TestCreateTicket_PresignFailure(t *testing.T) {
+	h, store, _ := fakeHandler()
+	store.Fail("PresignPut", errors.New("throttled"))
+
+	_, p := h.CreateTicket(context.Background(), ticketRequest())
+
+	if p == nil || p.Status != http.StatusBadGateway || p.Code != apierror.CodePresignFailed || !p.Retryable {
+		t.Fatalf("problem = %+v, want a retryable 502 presign_failed", p)
+	}
+	if keys := store.Keys(tickets.Prefix); len(keys) != 0 {
+		t.Errorf("tickets = %v, want none for a failed ticket", keys)
+	}
+}
+
+// flakyPresigner fails presigning the uploads ending in one of failing
+type flakyPresigner struct {
+	*testsupport.Store
+	failing []string
+}
+
+func (f *flakyPresigner) PresignPut(ctx context.Context, key string, opts s3client.PutOptions) (string, map[string]string, error) {
+	for _, name := range f.failing {
+		if strings.HasSuffix(key, "/"+name) {
+			return "", nil, errors.New("throttled")
+		}
+	}
+	return f.Store.PresignPut(ctx, key, opts)
+}
+
+func TestCreateTicket_Partial(t *testing.T) {
+	h, store, _ := fakeHandler()
+	h.presigner = &flakyPresigner{Store: store, failing: []string{"request.raw"}}
+
+	// Without allowPartial the ticket fails as a whole
+	if _, p := h.CreateTicket(context.Background(), ticketRequest()); p == nil || p.Code != apierror.CodePresignFailed {
+		t.Fatalf("problem = %+v, want presign_failed", p)
+	}
+
+	req := ticketRequest()
+	req.AllowPartial = true
+	resp, p := h.CreateTicket(context.Background(), req)
+	if p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+	if len(resp.Failed) != 1 || resp.Failed[0].Artifact != "request.raw" || resp.Failed[0].Key != resp.Uploads.RequestRaw.Key {
+		t.Fatalf("failed = %+v, want request.raw", resp.Failed)
+	}
+	if resp.Uploads.RequestRaw.PutURL != "" || resp.Uploads.Envelope.PutURL == "" {
+		t.Errorf("uploads = %+v, want only request.raw without a URL", resp.Uploads)
+	}
+	// The failed upload is still expected, so the ticket can be completed once it is retried
+	rec, err := tickets.Get(context.Background(), store, resp.FailureID)
+	if err != nil || !slices.Contains(rec.Expected, resp.Uploads.RequestRaw.Key) {
+		t.Errorf("ticket = %+v, %v; want request.raw expected", rec, err)
+	}
+}
+
+func TestCreateTicket_PartialAllFailed(t *testing.T) {
+	h, store, _ := fakeHandler()
+	store.Fail("PresignPut", errors.New("throttled"))
+
+	req := ticketRequest()
+	req.AllowPartial = true
+	if _, p := h.CreateTicket(context.Background(), req); p == nil || p.Code != apierror.CodePresignFailed {
+		t.Fatalf("problem = %+v, want presign_failed when nothing was presigned", p)
+	}
+}
+
+func TestRetryPresign(t *testing.T) {
+	h, store, _ := fakeHandler()
+	flaky := &flakyPresigner{Store: store, failing: []string{"request.raw", "logs.txt"}}
+	h.presigner = flaky
+	req := ticketRequest()
+	req.AllowPartial = true
+	req.Artifacts = &models.ArtifactsInfo{Logs: &models.ArtifactInfo{Bytes: 10}}
+	ticket, p := h.CreateTicket(context.Background(), req)
+	if p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+
+	// logs.txt fails again and is reported; request.raw succeeds
+	flaky.failing = []string{"logs.txt"}
+	resp, p := h.RetryPresign(context.Background(), ticket.FailureID, &models.PresignRetryRequest{
+		Project: "myapp", Env: "prod", Artifacts: []string{"request.raw", keys.LogsName},
+	})
+	if p != nil {
+		t.Fatalf("RetryPresign() problem = %+v", p)
+	}
+	if len(resp.Uploads) != 1 || resp.Uploads[0].Key != ticket.Uploads.RequestRaw.Key || resp.Uploads[0].PutURL == "" {
+		t.Errorf("uploads = %+v, want request.raw", resp.Uploads)
+	}
+	if len(resp.Failed) != 1 || resp.Failed[0].Artifact != keys.LogsName {
+		t.Errorf("failed = %+v, want %s", resp.Failed, keys.LogsName)
+	}
+
+	tests := []struct {
+		name      string
+		failureID string
+		req       models.PresignRetryRequest
+		status    int
+		code      apierror.Code
+	}{
+		{"undeclared artifact", ticket.FailureID, models.PresignRetryRequest{Project: "myapp", Env: "prod", Artifacts: []string{keys.ScreenshotName}}, http.StatusBadRequest, apierror.CodeValidation},
+		{"no artifacts", ticket.FailureID, models.PresignRetryRequest{Project: "myapp", Env: "prod"}, http.StatusBadRequest, apierror.CodeValidation},
+		{"other env", ticket.FailureID, models.PresignRetryRequest{Project: "myapp", Env: "staging", Artifacts: []string{"request.raw"}}, http.StatusNotFound, apierror.CodeNoTicket},
+		{"unknown failure", "00000000-0000-0000-0000-000000000000", models.PresignRetryRequest{Project: "myapp", Env: "prod", Artifacts: []string{"request.raw"}}, http.StatusNotFound, apierror.CodeNoTicket},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, p := h.RetryPresign(context.Background(), tt.failureID, &tt.req)
+			if p == nil || p.Status != tt.status || p.Code != tt.code {
+				t.Errorf("problem = %+v, want %d %s", p, tt.status, tt.code)
+			}
+		})
+	}
+
+	// Completed tickets cannot be presigned again
+	uploaded := uploadAll(store, ticket)
+	if _, _, p := h.CompleteUpload(context.Background(), completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	_, p = h.RetryPresign(context.Background(), ticket.FailureID, &models.PresignRetryRequest{Project: "myapp", Env: "prod", Artifacts: []string{"request.raw"}})
+	if p == nil || p.Status != http.StatusConflict {
+		t.Errorf("problem = %+v, want 409 for a completed ticket", p)
+	}
+}
+
+func TestCreateTicket_Quota(t *testing.T) {
+	h, store, _ := fakeHandler()
+	h.cfg.QuotaDailyFailures = 5
+	h.cfg.QuotaDailyBytes = 30
+	h.WithQuotas(quota.NewEnforcer(quota.NewMemoryStore(), nil, 0))
+
+	// Each ticket declares 12 bytes, so the third exceeds the byte quota
+	for i := 0; i < 2; i++ {
+		if _, p := h.CreateTicket(context.Background(), ticketRequest()); p != nil {
+			t.Fatalf("CreateTicket() #%d problem = %+v", i+1, p)
+		}
+	}
+	before := len(store.Keys(tickets.Prefix))
+	_, p := h.CreateTicket(context.Background(), ticketRequest())
+	if p == nil || p.Status != http.StatusTooManyRequests || p.Code != apierror.CodeQuotaExceeded || p.RetryAfterSeconds <= 0 {
+		t.Fatalf("problem = %+v, want 429 quota_exceeded with a retry hint", p)
+	}
+	if after := len(store.Keys(tickets.Prefix)); after != before {
+		t.Errorf("tickets = %d, want no ticket stored once over quota", after)
+	}
+}
+
+func TestCreateTicket_QuotaAllowsCritical(t *testing.T) {
+	h, _, _ := fakeHandler()
+	h.cfg.QuotaDailyFailures = 1
+	h.WithQuotas(quota.NewEnforcer(quota.NewMemoryStore(), nil, 0))
+	if _, p := h.CreateTicket(context.Background(), ticketRequest()); p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+
+	byPriority, bySeverity := ticketRequest(), ticketRequest()
+	byPriority.Priority = "critical"
+	bySeverity.Severity = "critical"
+	for _, req := range []*models.UploadTicketRequest{byPriority, bySeverity} {
+		if _, p := h.CreateTicket(context.Background(), req); p != nil {
+			t.Errorf("CreateTicket(priority %q, severity %q) problem = %+v, want critical tickets never refused", req.Priority, req.Severity, p)
+		}
+	}
+	if _, p := h.CreateTicket(context.Background(), ticketRequest()); p == nil || p.Code != apierror.CodeQuotaExceeded {
+		t.Errorf("problem = %+v, want normal tickets still refused", p)
+	}
+}
+
+func TestCreateTicket_QuotaCriticalNeedsScope(t *testing.T) {
+	h, _, _ := fakeHandler()
+	h.cfg.QuotaDailyFailures = 1
+	h.WithQuotas(quota.NewEnforcer(quota.NewMemoryStore(), nil, 0))
+	key := &apikeys.Key{ID: "ci", Projects: []string{"myapp"}, Scopes: []apikeys.Scope{apikeys.ScopeTicketCreate}}
+	ctx := middleware.WithPrincipal(context.Background(), key)
+	if _, p := h.CreateTicket(ctx, ticketRequest()); p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+
+	req := ticketRequest()
+	req.Priority = "critical"
+	_, p := h.CreateTicket(ctx, req)
+	if p == nil || p.Status != http.StatusTooManyRequests || p.Code != apierror.CodeQuotaExceeded {
+		t.Fatalf("problem = %+v, want 429 quota_exceeded for keys without %s", p, apikeys.ScopeCritical)
+	}
+
+	key.Scopes = append(key.Scopes, apikeys.ScopeCritical)
+	if _, p := h.CreateTicket(ctx, req); p != nil {
+		t.Errorf("CreateTicket() problem = %+v, want critical tickets allowed with %s", p, apikeys.ScopeCritical)
+	}
+}
+
+func TestCreateTicket_StorageBudget(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	tracker := budget.NewTracker(budget.NewMemoryStore())
+	h.WithStorageBudget(tracker)
+
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploadAll(store, ticket)), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	stored, _ := tracker.Stored(ctx, "myapp")
+	if stored == 0 {
+		t.Fatal("completed uploads were not counted")
+	}
+
+	// At the budget, tickets declaring more than the exempt size are refused
+	h.cfg.StorageBudgetBytes = stored
+	_, p := h.CreateTicket(ctx, ticketRequest())
+	if p == nil || p.Status != http.StatusInsufficientStorage || p.Code != apierror.CodeBudgetExceeded || p.Retryable {
+		t.Fatalf("problem = %+v, want 507 budget_exceeded", p)
+	}
+	h.cfg.StorageBudgetExemptBytes = 12
+	if _, p := h.CreateTicket(ctx, ticketRequest()); p != nil {
+		t.Errorf("CreateTicket(small) problem = %+v, want small uploads accepted", p)
+	}
+}
+
+func TestCompleteUpload(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+
+	resp, replayed, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "")
+	if p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if resp.Status != "ok" || replayed {
+		t.Errorf("response = %+v, replayed = %v", resp, replayed)
+	}
+
+	sent := notifier.Sent()
+	if len(sent) != 1 || sent[0].FailureID != ticket.FailureID || sent[0].URL != "https://api.example.com/orders" {
+		t.Fatalf("notifications = %+v, want one for the failure", sent)
+	}
+	if obj, _ := store.Object(ticket.Uploads.RequestRaw.Key); obj.Tags[placement.TagStage] != placement.StageComplete {
+		t.Errorf("tags = %v, want the failure marked complete", obj.Tags)
+	}
+
+	// A retry gets the stored response without another notification
+	if _, replayed, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil || !replayed {
+		t.Errorf("retry: replayed = %v, problem = %+v", replayed, p)
+	}
+	if notifier.Calls() != 1 {
+		t.Errorf("notified %d times, want once", notifier.Calls())
+	}
+}
+
+func TestCompleteUpload_MalwareScan(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	h.cfg.MalwareScan = true
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	sent := notifier.Sent()
+	if len(sent) != 1 || sent[0].ScanStatus != scan.StatusPending || sent[0].EnvelopeURL != "" {
+		t.Fatalf("notifications = %+v, want the envelope link withheld until scanned", sent)
+	}
+
+	now := time.Now()
+	for _, k := range uploaded {
+		verdict := scan.VerdictClean
+		if k == ticket.Uploads.RequestRaw.Key {
+			verdict = scan.VerdictInfected
+		}
+		if _, err := scan.Apply(ctx, store, scan.Result{Key: k, Verdict: verdict}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, p := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix)
+	if p != nil || resp.ScanStatus != scan.StatusQuarantined {
+		t.Fatalf("ReadFailure() = %+v, %+v; want the failure marked quarantined", resp, p)
+	}
+
+	if _, err := scan.Release(ctx, store, ticket.FailureID, ticket.S3Prefix, "key:ops", now); err != nil {
+		t.Fatal(err)
+	}
+	if resp, p := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix); p != nil || resp.ScanStatus != "" {
+		t.Errorf("ReadFailure() = %+v, %+v; want the failure cleared after release", resp, p)
+	}
+}
+
+func TestCompleteUpload_ContentMismatch(t *testing.T) {
+	h, store, _ := fakeHandler()
+	h.cfg.ContentMismatchAction = "reject_executables"
+	ctx := context.Background()
+	req := ticketRequest()
+
+	// Mismatches that are not executables are only recorded
+	ticket, _ := h.CreateTicket(ctx, req)
+	uploaded := uploadAll(store, ticket)
+	store.Put(ticket.Uploads.Envelope.Key, "application/json", []byte(`{"request":{"method":"POST","url":"https://api.example.com/orders","contentType":"application/json"}}`))
+	store.Put(ticket.Uploads.RequestRaw.Key, "application/json", []byte("<p>hi</p>"))
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	resp, _ := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix)
+	if m := resp.Envelope.ContentMismatches; len(m) != 1 || m[0].Artifact != "request.raw" || m[0].Detected != sniff.InvalidJSON {
+		t.Errorf("contentMismatches = %+v, want request.raw flagged as invalid JSON", m)
+	}
+
+	ticket, _ = h.CreateTicket(ctx, req)
+	uploaded = uploadAll(store, ticket)
+	store.Put(ticket.Uploads.RequestRaw.Key, "application/json", []byte("MZ\x90\x00"))
+	_, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "")
+	if p == nil || p.Status != http.StatusBadRequest || p.Code != apierror.CodeContentMismatch {
+		t.Fatalf("problem = %+v, want 400 content_mismatch for an executable", p)
+	}
+	if rec, _ := tickets.Get(ctx, store, ticket.FailureID); rec == nil || rec.State == tickets.StateCompleted {
+		t.Errorf("ticket = %+v, want it left for the reaper", rec)
+	}
+}
+
+func TestCompleteUpload_Triage(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	req := ticketRequest()
+	req.Severity = "error"
+	req.Tags = map[string]string{"team": "payments", "flow": "checkout"}
+	req.Description = "Pay button did nothing"
+	ticket, p := h.CreateTicket(ctx, req)
+	if p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+	uploaded := uploadAll(store, ticket)[1:]
+	complete := completeRequest(ticket, uploaded)
+	complete.GenerateEnvelope = true
+	if _, _, p := h.CompleteUpload(ctx, complete, ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+
+	sent := notifier.Sent()
+	if len(sent) != 1 || sent[0].Tags["team"] != "payments" || sent[0].Description != req.Description {
+		t.Fatalf("notifications = %+v, want the tags and description", sent)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.FailureFilter
+		want   int
+	}{
+		{"none", models.FailureFilter{}, 1},
+		{"severity", models.FailureFilter{Severity: "error"}, 1},
+		{"other severity", models.FailureFilter{Severity: "critical"}, 0},
+		{"tag", models.FailureFilter{Tags: map[string]string{"team": "payments", "flow": ""}}, 1},
+		{"other tag value", models.FailureFilter{Tags: map[string]string{"team": "search"}}, 0},
+		{"missing tag", models.FailureFilter{Tags: map[string]string{"release": ""}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, p := h.ListRecentFailures(ctx, "myapp", "prod", 1, 50, tt.filter)
+			if p != nil {
+				t.Fatalf("ListRecentFailures() problem = %+v", p)
+			}
+			if len(resp.Failures) != tt.want {
+				t.Fatalf("listed %d failures, want %d", len(resp.Failures), tt.want)
+			}
+			if tt.want > 0 && resp.Failures[0].Tags["flow"] != "checkout" {
+				t.Errorf("summary tags = %v", resp.Failures[0].Tags)
+			}
+		})
+	}
+}
+
+func TestCompleteUpload_ArtifactSlots(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	req := ticketRequest()
+	req.Artifacts = &models.ArtifactsInfo{Logs: &models.ArtifactInfo{Bytes: 100}, Screenshot: &models.ArtifactInfo{Bytes: 100}}
+	ticket, p := h.CreateTicket(ctx, req)
+	if p != nil {
+		t.Fatalf("CreateTicket() problem = %+v", p)
+	}
+	u := ticket.Uploads
+	if u.Logs == nil || u.Screenshot == nil || u.Console != nil {
+		t.Fatalf("uploads = %+v, want only the declared slots", u)
+	}
+	if u.Screenshot.Key != ticket.S3Prefix+"screenshot.png" {
+		t.Errorf("screenshot key = %q", u.Screenshot.Key)
+	}
+	if rec, _ := tickets.Get(ctx, store, ticket.FailureID); rec == nil || !slices.Contains(rec.Expected, u.Logs.Key) {
+		t.Errorf("ticket = %+v, want the slots expected", rec)
+	}
+
+	uploaded := append(uploadAll(store, ticket), u.Logs.Key, u.Screenshot.Key)
+	store.Put(u.Logs.Key, "text/plain", []byte("12:00:01 checkout started"))
+	store.Put(u.Screenshot.Key, "image/png", make([]byte, 5000))
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p == nil || p.Code != apierror.CodeSizeMismatch {
+		t.Fatalf("problem = %+v, want the oversized screenshot rejected", p)
+	}
+
+	store.Put(u.Screenshot.Key, "image/png", make([]byte, 100))
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	resp, p := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix)
+	if p != nil {
+		t.Fatalf("ReadFailure() problem = %+v", p)
+	}
+	if a := resp.Envelope.Artifacts; a == nil || !a.Logs || !a.Screenshot || a.Console {
+		t.Errorf("artifacts = %+v, want logs and screenshot present", a)
+	}
+}
+
+func TestSchemaVersions(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	ticket, p := h.CreateTicket(ctx, ticketRequest())
+	if p != nil || ticket.SchemaVersion != envelope.SchemaVersion {
+		t.Fatalf("CreateTicket() = %+v, %+v; want the current schema version", ticket, p)
+	}
+
+	// Envelopes of SDKs predating versioning are upgraded
+	uploaded := uploadAll(store, ticket)
+	if resp, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil || resp.SchemaVersion != envelope.SchemaVersion {
+		t.Fatalf("CompleteUpload() = %+v, %+v", resp, p)
+	}
+	resp, p := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix)
+	if p != nil || resp.Envelope.SchemaVersion != envelope.SchemaVersion || resp.Envelope.S3Prefix != ticket.S3Prefix {
+		t.Fatalf("ReadFailure() = %+v, %+v; want the upgraded envelope", resp, p)
+	}
+
+	// Newer versions are served unless strict
+	req := ticketRequest()
+	req.SchemaVersion = envelope.SchemaVersion + 1
+	if _, p := h.CreateTicket(ctx, req); p != nil {
+		t.Fatalf("CreateTicket(newer) problem = %+v", p)
+	}
+	h.cfg.StrictSchema = true
+	if _, p := h.CreateTicket(ctx, req); p == nil || p.Code != apierror.CodeUnsupportedSchema {
+		t.Fatalf("problem = %+v, want unsupported_schema_version in strict mode", p)
+	}
+
+	store.Put(ticket.Uploads.Envelope.Key, "application/json", []byte(`{"schemaVersion":99}`))
+	if _, p := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix); p == nil || p.Code != apierror.CodeUnsupportedSchema {
+		t.Errorf("ReadFailure() problem = %+v, want the newer envelope rejected", p)
+	}
+}
+
+func TestPostTicket(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	ticket, p := h.CreatePostTicket(ctx, ticketRequest())
+	if p != nil {
+		t.Fatalf("CreatePostTicket() problem = %+v", p)
+	}
+	u := ticket.Uploads
+	if u.RequestRaw.MaxBytes != 12+4096 || u.RequestRaw.Fields["key"] != u.RequestRaw.Key {
+		t.Errorf("request.raw upload = %+v, want the declared size with slack", u.RequestRaw)
+	}
+	if _, err := tickets.Get(ctx, store, ticket.FailureID); err != nil {
+		t.Fatalf("ticket not stored: %v", err)
+	}
+
+	if _, _, p := h.CompleteTicket(ctx, ticket.FailureID, &models.CompleteTicketRequest{}, ""); p == nil || p.Code != apierror.CodeMissingObjects {
+		t.Fatalf("problem = %+v, want missing_objects before any upload", p)
+	}
+
+	// The uploads come from the ticket and the envelope is generated
+	store.Put(u.RequestRaw.Key, "application/json", []byte(`{"item":"x"}`))
+	store.Put(u.ResponseRaw.Key, "application/octet-stream", []byte(`{"error":"boom"}`))
+	resp, replayed, p := h.CompleteTicket(ctx, ticket.FailureID, &models.CompleteTicketRequest{}, "key-1")
+	if p != nil || replayed || resp.Status != "ok" {
+		t.Fatalf("CompleteTicket() = %+v, %v, %+v", resp, replayed, p)
+	}
+	failure, p := h.ReadFailure(ctx, ticket.FailureID, "myapp", "prod", ticket.S3Prefix)
+	if p != nil || failure.Envelope.Request.URL != "https://api.example.com/orders" {
+		t.Fatalf("ReadFailure() = %+v, %+v; want the generated envelope", failure, p)
+	}
+
+	if _, replayed, p := h.CompleteTicket(ctx, ticket.FailureID, &models.CompleteTicketRequest{}, "key-1"); p != nil || !replayed {
+		t.Errorf("retry = %v, %+v; want a replay", replayed, p)
+	}
+	if notifier.Calls() != 1 {
+		t.Errorf("notified %d times, want once", notifier.Calls())
+	}
+
+	if _, _, p := h.CompleteTicket(ctx, "00000000-0000-4000-8000-000000000000", &models.CompleteTicketRequest{}, ""); p == nil || p.Code != apierror.CodeNoTicket {
+		t.Errorf("problem = %+v, want no_ticket for an unknown failure", p)
+	}
+}
+
+func TestCompleteUpload_MissingObjects(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+	store.DeleteObjects(ctx, []string{ticket.Uploads.ResponseRaw.Key})
+
+	_, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "")
+
+	if p == nil || p.Code != apierror.CodeMissingObjects || !strings.Contains(p.Detail, ticket.Uploads.ResponseRaw.Key) {
+		t.Fatalf("problem = %+v, want missing_objects naming response.raw", p)
+	}
+	if !p.Retryable {
+		t.Error("missing objects should be retryable while uploads are in flight")
+	}
+	if notifier.Calls() != 0 {
+		t.Errorf("notified %d times, want none", notifier.Calls())
+	}
+
+	// The claim is released, so the completed retry goes through
+	store.Put(ticket.Uploads.ResponseRaw.Key, "application/octet-stream", []byte("data"))
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Errorf("retry problem = %+v", p)
+	}
+}
+
+func TestCompleteUpload_VerificationError(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+	store.Fail("VerifyObjectsExist", errors.New("access denied"))
+
+	_, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "")
+
+	if p == nil || p.Status != http.StatusBadGateway || p.Code != apierror.CodeVerificationFailed {
+		t.Fatalf("problem = %+v, want 502 verification_failed", p)
+	}
+}
+
+func TestCompleteUpload_CrossProjectKeys(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	victimReq := ticketRequest()
+	victimReq.Project = "victim"
+	victim, _ := h.CreateTicket(ctx, victimReq)
+	victimKeys := uploadAll(store, victim)
+	before, _ := store.GetObjectBytes(ctx, victim.Uploads.Envelope.Key)
+
+	attackerReq := ticketRequest()
+	attackerReq.Project = "attacker"
+	attacker, _ := h.CreateTicket(ctx, attackerReq)
+	attackerKeys := uploadAll(store, attacker)
+	key := &apikeys.Key{ID: "attacker", Projects: []string{"attacker"}, Scopes: []apikeys.Scope{apikeys.ScopeTicketCreate}}
+	ctx = middleware.WithPrincipal(ctx, key)
+
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"victim keys", victimKeys},
+		{"victim keys among own", append(slices.Clone(attackerKeys), victim.Uploads.Envelope.Key)},
+		{"own key not on the ticket", append(slices.Clone(attackerKeys), attacker.S3Prefix+"files/extra.bin")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := completeRequest(attacker, tt.keys)
+			req.Project = "attacker"
+
+			_, _, p := h.CompleteUpload(ctx, req, "")
+
+			if p == nil || p.Status != http.StatusBadRequest || p.Code != apierror.CodeValidation {
+				t.Fatalf("problem = %+v, want a 400 validation problem", p)
+			}
+		})
+	}
+
+	if after, _ := store.GetObjectBytes(ctx, victim.Uploads.Envelope.Key); string(after) != string(before) {
+		t.Errorf("victim envelope = %s, want it untouched", after)
+	}
+	if keys := store.Keys(victim.S3Prefix + "checksums.json"); len(keys) != 0 {
+		t.Errorf("checksums written into the victim's prefix: %v", keys)
+	}
+	if notifier.Calls() != 0 {
+		t.Errorf("notified %d times, want none", notifier.Calls())
+	}
+}
+
+func TestCompleteUpload_WritesOnlyTheFailureEnvelope(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	req := ticketRequest()
+	req.Request.Files = []models.FileInfo{{Name: "attachment", Filename: "envelope.json", ContentType: "application/json", Bytes: 9}}
+	ticket, _ := h.CreateTicket(ctx, req)
+	file := ticket.Uploads.Files[0].Key
+	store.Put(file, "application/json", []byte(`{"a":"b"}`))
+	uploaded := append([]string{file}, uploadAll(store, ticket)...)
+
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if b, _ := store.GetObjectBytes(ctx, file); string(b) != `{"a":"b"}` {
+		t.Errorf("file named envelope.json = %s, want it untouched", b)
+	}
+	if b, _ := store.GetObjectBytes(ctx, ticket.Uploads.Envelope.Key); !strings.Contains(string(b), `"project":"myapp"`) {
+		t.Errorf("envelope = %s, want it written back", b)
+	}
+}
+
+func TestCompleteUpload_RedactsOnlyTheFailureHeaders(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	req := ticketRequest()
+	req.Request.Files = []models.FileInfo{{Name: "attachment", Filename: "saved.headers.json", ContentType: "application/json", Bytes: 40}}
+	ticket, _ := h.CreateTicket(ctx, req)
+	uploaded := append(uploadAll(store, ticket), ticket.Uploads.Files[0].Key)
+	headersDoc := []byte(`{"Authorization":"Bearer s3cr3t-token"}`)
+	store.Put(ticket.Uploads.RequestHeaders.Key, "application/json", headersDoc)
+	store.Put(ticket.Uploads.Files[0].Key, "application/json", headersDoc)
+
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if b, _ := store.GetObjectBytes(ctx, ticket.Uploads.RequestHeaders.Key); strings.Contains(string(b), "s3cr3t-token") {
+		t.Errorf("request headers = %s, want them redacted", b)
+	}
+	if b, _ := store.GetObjectBytes(ctx, ticket.Uploads.Files[0].Key); string(b) != string(headersDoc) {
+		t.Errorf("attached file = %s, want it untouched", b)
+	}
+}
+
+func TestCompleteUpload_ServerChecksums(t *testing.T) {
+	h, store, _ := fakeHandler()
+	ctx := context.Background()
+	req := ticketRequest()
+	req.Request.Files = []models.FileInfo{{Name: "attachment", Filename: "a.txt", ContentType: "text/plain", Bytes: 4}}
+	ticket, _ := h.CreateTicket(ctx, req)
+	uploadAll(store, ticket)
+	file := ticket.Uploads.Files[0].Key
+	store.Put(file, "text/plain", []byte("data"))
+
+	// Listing only files still writes the failure's checksums.json
+	complete := completeRequest(ticket, []string{file})
+	complete.ServerChecksums = true
+	resp, _, p := h.CompleteUpload(ctx, complete, "")
+	if p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if len(resp.Checksums) != 1 || resp.Checksums[file] == "" {
+		t.Errorf("checksums = %v, want the file's", resp.Checksums)
+	}
+	if keys := store.Keys(ticket.S3Prefix + "files/checksums.json"); len(keys) != 0 {
+		t.Errorf("checksums written under files/: %v", keys)
+	}
+	if _, err := store.GetObjectBytes(ctx, ticket.Uploads.Checksums.Key); err != nil {
+		t.Errorf("failure checksums.json not written: %v", err)
+	}
+}
+
+func TestCompleteUpload_NotificationCurl(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+	store.Put(ticket.Uploads.RequestHeaders.Key, "application/json", []byte(`{"Content-Type":"application/json","X-Secret":"s3cr3t-value"}`))
+	store.Put(ticket.Uploads.RequestRaw.Key, "application/json", []byte(`{"note":"raw-body-value"}`))
+
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	sent := notifier.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d notifications, want 1", len(sent))
+	}
+	curl := sent[0].Curl
+	if !strings.Contains(curl, "Content-Type: application/json") || !strings.Contains(curl, "--data-binary @request.raw") {
+		t.Errorf("curl = %s, want the describing headers and a body reference", curl)
+	}
+	if strings.Contains(curl, "s3cr3t-value") || strings.Contains(curl, "raw-body-value") {
+		t.Errorf("curl = %s, want no header values or body", curl)
+	}
+}
+
+func TestCompleteUpload_NotificationFailure(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+	notifier.Fail(errors.New("ses unavailable"))
+
+	resp, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "")
+
+	if p != nil || resp.Status != "ok" {
+		t.Fatalf("CompleteUpload() = %+v, %+v; a failed notification must not fail the upload", resp, p)
+	}
+	if notifier.Calls() != 1 || len(notifier.Sent()) != 0 {
+		t.Errorf("calls = %d, sent = %d", notifier.Calls(), len(notifier.Sent()))
+	}
+}
+
+func TestCompleteUpload_RetriesMissingObjects(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	h.WithVerification(verify.Retry{Attempts: 3, Window: 300 * time.Millisecond})
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+	store.DeleteObjects(ctx, []string{ticket.Uploads.ResponseRaw.Key})
+
+	// The last PUT becomes visible while upload-complete is verifying
+	time.AfterFunc(20*time.Millisecond, func() {
+		store.Put(ticket.Uploads.ResponseRaw.Key, "application/octet-stream", []byte("data"))
+	})
+	resp, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "")
+
+	if p != nil || resp.Status != models.CompletionOK {
+		t.Fatalf("CompleteUpload() = %+v, %+v; want the late object found on a retry", resp, p)
+	}
+	if notifier.Calls() != 1 {
+		t.Errorf("notified %d times, want once", notifier.Calls())
+	}
+}
+
+// fakeSQS records the messages sent to a queue
+type fakeSQS struct {
+	sent []string
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, aws.ToString(in.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestCompleteUpload_Thumbnails(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	h.cfg.MalwareScan = true
+	queue := &fakeSQS{}
+	h.WithThumbnails(thumbs.NewPublisher(queue, "https://sqs.us-east-1.amazonaws.com/123/thumbs"))
+	ctx := context.Background()
+	req := ticketRequest()
+	req.Artifacts = &models.ArtifactsInfo{Screenshot: &models.ArtifactInfo{Bytes: 8}}
+	ticket, _ := h.CreateTicket(ctx, req)
+	uploaded := uploadAll(store, ticket)
+	screenshot := ticket.S3Prefix + keys.ScreenshotName
+	store.Put(screenshot, "image/png", []byte("\x89PNG\r\n\x1a\n"))
+	uploaded = append(uploaded, screenshot)
+
+	if _, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if len(queue.sent) != 1 {
+		t.Fatalf("queued %d messages, want the screenshot queued", len(queue.sent))
+	}
+	if m, err := thumbs.Decode(queue.sent[0]); err != nil || !reflect.DeepEqual(m.Keys, []string{screenshot}) {
+		t.Errorf("Decode() = %+v, %v", m, err)
+	}
+	// Withheld while the malware scan is pending, in notifications and listings
+	if sent := notifier.Sent(); len(sent) != 1 || sent[0].ThumbnailURL != "" {
+		t.Errorf("notifications = %+v, want no thumbnail before the scan", sent)
+	}
+	list, _ := h.ListRecentFailures(ctx, "myapp", "prod", 1, 10, models.FailureFilter{})
+	if len(list.Failures) != 1 || len(list.Failures[0].Thumbnails) != 0 {
+		t.Fatalf("failures = %+v, want the thumbnail withheld", list.Failures)
+	}
+
+	if _, err := scan.Apply(ctx, store, scan.Result{Key: screenshot, Verdict: scan.VerdictClean}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = h.ListRecentFailures(ctx, "myapp", "prod", 1, 10, models.FailureFilter{})
+	if th := list.Failures[0].Thumbnails; len(th) != 1 || th[0].Artifact != keys.ScreenshotName || !strings.Contains(th[0].URL, "thumbs/screenshot.png.png") {
+		t.Errorf("thumbnails = %+v, want the screenshot's", th)
+	}
+}
+
+func TestCompleteUpload_PendingVerification(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	queue := &fakeSQS{}
+	h.WithPendingVerification(verify.NewPublisher(queue, "https://sqs.us-east-1.amazonaws.com/123/verify"))
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	uploaded := uploadAll(store, ticket)
+	store.DeleteObjects(ctx, []string{ticket.Uploads.ResponseRaw.Key})
+
+	resp, _, p := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "complete-1")
+	if p != nil || resp.Status != models.CompletionPending {
+		t.Fatalf("CompleteUpload() = %+v, %+v; want it accepted as pending", resp, p)
+	}
+	if len(queue.sent) != 1 || notifier.Calls() != 0 {
+		t.Fatalf("queued %d, notified %d; want the completion queued, not processed", len(queue.sent), notifier.Calls())
+	}
+	m, err := verify.Decode(queue.sent[0])
+	if err != nil || m.IdempotencyKey != "complete-1" {
+		t.Fatalf("Decode() = %+v, %v", m, err)
+	}
+
+	// Delivered before the last upload is visible, the message is retried
+	if err := h.ProcessVerification(ctx, m); err == nil {
+		t.Fatal("ProcessVerification() succeeded with an object missing")
+	}
+	store.Put(ticket.Uploads.ResponseRaw.Key, "application/octet-stream", []byte("data"))
+	if err := h.ProcessVerification(ctx, m); err != nil {
+		t.Fatalf("ProcessVerification() error = %v", err)
+	}
+	// A redelivered message is answered from the stored completion
+	if err := h.ProcessVerification(ctx, m); err != nil {
+		t.Fatalf("redelivered ProcessVerification() error = %v", err)
+	}
+	if len(notifier.Sent()) != 1 || notifier.Calls() != 1 {
+		t.Errorf("notified %d times, want once", notifier.Calls())
+	}
+	if resp, replayed, _ := h.CompleteUpload(ctx, completeRequest(ticket, uploaded), "complete-1"); !replayed || resp.Status != models.CompletionOK {
+		t.Errorf("client retry = %+v, replayed = %v; want the processed completion", resp, replayed)
+	}
+}
+
+func TestCompleteUpload_CriticalSkipsPendingVerification(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	queue := &fakeSQS{}
+	h.WithPendingVerification(verify.NewPublisher(queue, "https://sqs.us-east-1.amazonaws.com/123/verify"))
+	ctx := context.Background()
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	req := completeRequest(ticket, uploadAll(store, ticket))
+	req.Priority = "critical"
+
+	resp, _, p := h.CompleteUpload(ctx, req, "")
+	if p != nil || resp.Status != models.CompletionOK {
+		t.Fatalf("CompleteUpload() = %+v, %+v; want it processed inline", resp, p)
+	}
+	if len(queue.sent) != 0 || notifier.Calls() != 1 {
+		t.Errorf("queued %d, notified %d; want the critical completion processed, not queued", len(queue.sent), notifier.Calls())
+	}
+}
+
+func TestCompleteUpload_CriticalNeedsScope(t *testing.T) {
+	h, store, notifier := fakeHandler()
+	key := &apikeys.Key{ID: "ci", Projects: []string{"myapp"}, Scopes: []apikeys.Scope{apikeys.ScopeTicketCreate}}
+	ctx := middleware.WithPrincipal(context.Background(), key)
+	ticket, _ := h.CreateTicket(ctx, ticketRequest())
+	req := completeRequest(ticket, uploadAll(store, ticket))
+	req.Priority = "critical"
+
+	if _, _, p := h.CompleteUpload(ctx, req, ""); p != nil {
+		t.Fatalf("CompleteUpload() problem = %+v", p)
+	}
+	if sent := notifier.Sent(); len(sent) != 1 || sent[0].Critical {
+		t.Errorf("sent = %+v, want one notification not marked critical", sent)
+	}
+
+	// Without the scope, critical completions are queued like any other and
+	// stay non-critical when processed
+	queue := &fakeSQS{}
+	h.WithPendingVerification(verify.NewPublisher(queue, "https://sqs.us-east-1.amazonaws.com/123/verify"))
+	ticket, _ = h.CreateTicket(ctx, ticketRequest())
+	req = completeRequest(ticket, uploadAll(store, ticket))
+	req.Priority = "critical"
+	if resp, _, p := h.CompleteUpload(ctx, req, ""); p != nil || resp.Status != models.CompletionPending {
+		t.Fatalf("CompleteUpload() = %+v, %+v; want it queued", resp, p)
+	}
+	if len(queue.sent) != 1 {
+		t.Fatalf("queued %d messages, want 1", len(queue.sent))
+	}
+	if m, err := verify.Decode(queue.sent[0]); err != nil || m.CriticalAllowed {
+		t.Errorf("queued = %+v, %v; want a message not allowed to be critical", m, err)
+	}
+}
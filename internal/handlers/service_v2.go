@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/envelope"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+	"github.com/yourorg/failure-uploader/internal/validation"
+)
+
+// The methods in this file are the core of the v2 upload API. Unlike v1,
+// uploads are presigned POSTs whose sizes S3 enforces, the ticket must be
+// stored, and completion reads the uploads from it and always generates the
+// envelope.
+
+// CreatePostTicket validates req and issues presigned POST uploads for a new
+// failure, each capped at the size the ticket declared
+func (h *Handler) CreatePostTicket(ctx context.Context, req *models.UploadTicketRequest) (*models.TicketResponse, *apierror.Problem) {
+	cfg, profs := h.limitsConfig()
+	if errs := validation.ValidateUploadTicketRequest(req, cfg, profs); len(errs) > 0 {
+		return nil, validationProblem(errs)
+	}
+
+	ctx = logging.With(ctx, "project", req.Project, "env", req.Env)
+	if p := h.checkProject(ctx, req.Project); p != nil {
+		return nil, p
+	}
+	if p := h.checkSchemaVersion(ctx, req.SchemaVersion); p != nil {
+		return nil, p
+	}
+	if p := h.checkBudget(ctx, req); p != nil {
+		return nil, p
+	}
+	if p := h.checkQuota(ctx, req); p != nil {
+		return nil, p
+	}
+
+	failureID := uuid.New().String()
+	tenant := h.tenant(ctx)
+	kb := keys.NewBuilder(req.Project, req.Env, failureID).WithTenant(tenant)
+
+	logging.FromContext(ctx).Info().
+		Str("failureId", failureID).
+		Str("priority", req.Priority).
+		Msg("creating upload ticket")
+
+	uploads, err := h.presignPosts(ctx, kb, req)
+	if err != nil {
+		return nil, apierror.Dependency(apierror.CodePresignFailed, "Failed to generate presigned uploads")
+	}
+
+	// Completion reads the uploads from the ticket, so it must be stored
+	rec := h.ticketRecord(ctx, req, failureID, kb.Prefix(), postKeys(uploads))
+	if err := tickets.Issue(ctx, h.presigner, rec); err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to store upload ticket")
+		return nil, apierror.Dependency(apierror.CodeTicketFailed, "Failed to store upload ticket")
+	}
+	h.indexUser(ctx, rec)
+
+	metrics.TicketsIssued.Inc(req.Project)
+	h.publishTicket(ctx, req, failureID, tenant, kb.Prefix())
+
+	return &models.TicketResponse{
+		SchemaVersion:    envelope.SchemaVersion,
+		FailureID:        failureID,
+		S3Prefix:         kb.Prefix(),
+		Uploads:          *uploads,
+		ExpiresInSeconds: int(h.cfg.PresignTTL.Seconds()),
+	}, nil
+}
+
+// CompleteTicket verifies and processes the uploads of the ticket of
+// failureID like CompleteUpload. The project, env and uploaded keys are read
+// from the ticket, and the envelope is generated from it.
+func (h *Handler) CompleteTicket(ctx context.Context, failureID string, req *models.CompleteTicketRequest, idempotencyKey string) (*models.UploadCompleteResponse, bool, *apierror.Problem) {
+	if errs := validation.ValidateFailureID(failureID); len(errs) > 0 {
+		return nil, false, validationProblem(errs)
+	}
+
+	rec, err := tickets.Get(ctx, h.presigner, failureID)
+	if errors.Is(err, tickets.ErrNotFound) {
+		return nil, false, apierror.New(http.StatusNotFound, apierror.CodeNoTicket, "No upload ticket tracked for this failure")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to read upload ticket")
+		return nil, false, apierror.Dependency(apierror.CodeReadFailed, "Failed to read upload ticket")
+	}
+	if p := h.checkProject(ctx, rec.Project); p != nil {
+		return nil, false, p
+	}
+
+	// Only the expected uploads count, so retries list the same keys even
+	// after the envelope and checksums were written
+	missing, err := h.presigner.VerifyObjectsExist(ctx, rec.Expected)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("failureId", failureID).Msg("failed to list uploads")
+		return nil, false, apierror.Dependency(apierror.CodeVerificationFailed, "Failed to verify uploaded objects")
+	}
+	var uploaded []string
+	for _, k := range rec.Expected {
+		if !slices.Contains(missing, k) {
+			uploaded = append(uploaded, k)
+		}
+	}
+	if len(uploaded) == 0 {
+		return nil, false, apierror.BadRequest(apierror.CodeMissingObjects, "Nothing was uploaded for this ticket").
+			WithDetail("expected: %s", strings.Join(rec.Expected, ", "))
+	}
+
+	return h.CompleteUpload(ctx, &models.UploadCompleteRequest{
+		SchemaVersion:    req.SchemaVersion,
+		FailureID:        rec.FailureID,
+		Project:          rec.Project,
+		Env:              rec.Env,
+		UploadedKeys:     uploaded,
+		ServerChecksums:  req.ServerChecksums,
+		Priority:         req.Priority,
+		Encryption:       req.Encryption,
+		GenerateEnvelope: true,
+		Response:         req.Response,
+	}, idempotencyKey)
+}
+
+// postKeys returns the keys of every upload of a v2 ticket
+func postKeys(u *models.TicketUploads) []string {
+	all := []string{u.RequestRaw.Key, u.RequestHeaders.Key, u.ResponseRaw.Key}
+	for _, slot := range []*models.PresignedPost{u.Logs, u.Screenshot, u.Console} {
+		if slot != nil {
+			all = append(all, slot.Key)
+		}
+	}
+	for _, f := range u.Files {
+		all = append(all, f.Key)
+	}
+	return all
+}
+
+// presignPosts presigns the POST uploads of req, each limited to the size
+// upload-complete would accept
+func (h *Handler) presignPosts(ctx context.Context, kb *keys.Builder, req *models.UploadTicketRequest) (*models.TicketUploads, error) {
+	limits := h.limits(req.Project)
+	post := func(key, contentType string, size int64) (models.PresignedPost, error) {
+		maxBytes := validation.AllowedSize(strings.TrimPrefix(key, kb.Prefix()), &req.Request, req.Artifacts, limits, h.cfg.UploadSizeTolerancePercent)
+		url, fields, err := h.presigner.PresignPost(ctx, key, s3client.PostOptions{ContentType: contentType, Size: size, MaxBytes: maxBytes})
+		if err != nil {
+			return models.PresignedPost{}, err
+		}
+		return models.PresignedPost{Key: key, URL: url, Fields: fields, MaxBytes: maxBytes}, nil
+	}
+	slot := func(key, contentType string, declared *models.ArtifactInfo) (*models.PresignedPost, error) {
+		if declared == nil {
+			return nil, nil
+		}
+		up, err := post(key, contentType, declared.Bytes)
+		return &up, err
+	}
+
+	uploads := &models.TicketUploads{}
+	var err error
+	rawType := req.Request.ContentType
+	if rawType == "" {
+		rawType = "application/octet-stream"
+	}
+	if uploads.RequestRaw, err = post(kb.RequestRaw(), rawType, req.Request.BodyBytes); err != nil {
+		return nil, err
+	}
+	if uploads.RequestHeaders, err = post(kb.RequestHeaders(), "application/json", 0); err != nil {
+		return nil, err
+	}
+	if uploads.ResponseRaw, err = post(kb.ResponseRaw(), "application/octet-stream", 0); err != nil {
+		return nil, err
+	}
+
+	if a := req.Artifacts; a != nil {
+		if uploads.Logs, err = slot(kb.Logs(), "text/plain", a.Logs); err != nil {
+			return nil, err
+		}
+		if uploads.Screenshot, err = slot(kb.Screenshot(), "image/png", a.Screenshot); err != nil {
+			return nil, err
+		}
+		if uploads.Console, err = slot(kb.Console(), "application/json", a.Console); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range req.Request.Files {
+		ct := file.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		up, err := post(kb.File(file.Filename), ct, file.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		uploads.Files = append(uploads.Files, up)
+	}
+	return uploads, nil
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+)
+
+// Store is the object storage behind the handlers: *s3client.Presigner in
+// production, testsupport.Store in tests. Besides the methods the handlers
+// call, it covers the Store interfaces of the packages they pass it to.
+type Store interface {
+	PresignPut(ctx context.Context, key string, opts s3client.PutOptions) (string, map[string]string, error)
+	PresignGet(ctx context.Context, key string) (string, error)
+	PresignPost(ctx context.Context, key string, opts s3client.PostOptions) (string, map[string]string, error)
+
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	VerifyObjectsExist(ctx context.Context, keys []string) ([]string, error)
+	ObjectSizes(ctx context.Context, keys []string) (map[string]int64, error)
+	ObjectSHA256(ctx context.Context, key string) (string, error)
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	GetObjectHead(ctx context.Context, key string, n int64) ([]byte, error)
+	OpenObject(ctx context.Context, key, byteRange string) (*s3client.Object, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	Upload(ctx context.Context, key, contentType string, body io.Reader) error
+	CopyObject(ctx context.Context, src, dst string) error
+	DeleteObjects(ctx context.Context, keys []string) error
+
+	TagObjects(ctx context.Context, keys []string, tags map[string]string) error
+	ObjectTags(ctx context.Context, key string) (map[string]string, error)
+	MarkComplete(ctx context.Context, key string) error
+	SetStorageClass(ctx context.Context, key string, storageClass types.StorageClass) error
+	RestoreObject(ctx context.Context, key string, days int32) error
+
+	// BucketFor returns the bucket holding key, for links to the console
+	BucketFor(key string) string
+}
@@ -0,0 +1,324 @@
+package har
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/repro"
+	"github.com/yourorg/failure-uploader/internal/sniff"
+)
+
+// Version is the HAR spec version written to documents
+const Version = "1.2"
+
+// ContentType is the media type HAR documents are served with
+const ContentType = "application/json"
+
+// creator names the service in documents; its version is the API version
+var creator = Creator{Name: "failure-uploader", Version: "v1"}
+
+// MaxBody is the largest body included in a document; larger bodies are
+// left out with a comment pointing at the artifact
+const MaxBody = 1 << 20
+
+// Store is the subset of S3 operations assembly needs
+type Store interface {
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	GetObjectHead(ctx context.Context, key string, n int64) ([]byte, error)
+}
+
+// HAR is the root of a HAR document
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	Comment         string   `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	Comment     string      `json:"comment,omitempty"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	Comment     string      `json:"comment,omitempty"`
+}
+
+// NameValue is a header, cookie or query parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Params   []NameValue `json:"params"`
+	Text     string      `json:"text"`
+	Comment  string      `json:"comment,omitempty"`
+}
+
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	// Encoding is "base64" for binary bodies
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Timings only records the wait; the client measures the request as a whole
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// body is an artifact read for a document
+type body struct {
+	text     string
+	encoding string
+	mimeType string
+	size     int64
+	comment  string
+}
+
+// Assemble builds a single-entry HAR document from the failure's envelope and
+// the artifacts under prefix. Sensitive headers and body fields are redacted
+// with r; missing artifacts are left out.
+func Assemble(ctx context.Context, store Store, env *models.Envelope, prefix string, r *redact.Redactor) (*HAR, error) {
+	req := Request{
+		Method:      strings.ToUpper(env.Request.Method),
+		URL:         env.Request.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []NameValue{},
+		Headers:     []NameValue{},
+		QueryString: queryString(env.Request.URL),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+
+	hb, err := readOptional(ctx, store, prefix+"request.headers.json", -1)
+	if err != nil {
+		return nil, err
+	}
+	if hb != nil {
+		hdrs, err := repro.ParseHeaders(hb)
+		if err != nil {
+			return nil, err
+		}
+		req.Headers = nameValues(r.Headers(hdrs))
+	}
+
+	reqBody, err := readBody(ctx, store, prefix+repro.BodyFile, r)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody != nil {
+		req.BodySize = reqBody.size
+		req.PostData = &PostData{
+			MimeType: env.Request.ContentType,
+			Params:   []NameValue{},
+			Text:     reqBody.text,
+			Comment:  reqBody.comment,
+		}
+		// postData has no encoding field, so binary bodies are only referenced
+		if reqBody.encoding != "" {
+			req.PostData.Text = ""
+			req.PostData.Comment = "binary body; see " + repro.BodyFile
+		}
+	}
+
+	resp := Response{
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []NameValue{},
+		Headers:     []NameValue{},
+		Content:     Content{MimeType: "application/octet-stream"},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	var durationMs float64
+	if info := env.Response; info != nil {
+		resp.Status = info.StatusCode
+		resp.StatusText = http.StatusText(info.StatusCode)
+		if info.ErrorMessage != "" {
+			resp.StatusText = info.ErrorMessage
+		}
+		if info.ErrorClass != "" {
+			resp.Comment = info.ErrorClass
+		}
+		durationMs = float64(info.DurationMs)
+	}
+
+	respBody, err := readBody(ctx, store, prefix+"response.raw", r)
+	if err != nil {
+		return nil, err
+	}
+	if respBody != nil {
+		resp.BodySize = respBody.size
+		resp.Content = Content{
+			Size:     respBody.size,
+			MimeType: respBody.mimeType,
+			Text:     respBody.text,
+			Encoding: respBody.encoding,
+			Comment:  respBody.comment,
+		}
+	}
+
+	return &HAR{Log: Log{
+		Version: Version,
+		Creator: creator,
+		Entries: []Entry{{
+			StartedDateTime: env.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+			Time:            durationMs,
+			Request:         req,
+			Response:        resp,
+			Timings:         Timings{Wait: durationMs},
+			Comment:         env.FailureID,
+		}},
+		Comment: fmt.Sprintf("%s/%s failure %s", env.Project, env.Env, env.FailureID),
+	}}, nil
+}
+
+// Marshal renders h as indented JSON
+func (h *HAR) Marshal() ([]byte, error) {
+	return json.MarshalIndent(h, "", "  ")
+}
+
+// readBody reads a body artifact, redacting text and base64-encoding binary
+// content. It returns nil when the artifact is missing.
+func readBody(ctx context.Context, store Store, key string, r *redact.Redactor) (*body, error) {
+	b, err := readOptional(ctx, store, key, MaxBody+1)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	if len(b) > MaxBody {
+		name := key[strings.LastIndex(key, "/")+1:]
+		return &body{size: -1, mimeType: sniff.Detect(b), comment: fmt.Sprintf("body exceeds %d bytes; see %s", MaxBody, name)}, nil
+	}
+
+	// Response headers are not captured, so the media type is sniffed
+	out := &body{size: int64(len(b)), mimeType: sniff.Detect(b)}
+	switch {
+	case !utf8.Valid(b):
+		out.text = base64.StdEncoding.EncodeToString(b)
+		out.encoding = "base64"
+	case json.Valid(b):
+		out.mimeType = "application/json"
+		if redacted, err := r.JSON(b); err == nil {
+			out.text = string(redacted)
+		} else {
+			out.text = r.String(string(b))
+		}
+	default:
+		out.text = r.String(string(b))
+	}
+	return out, nil
+}
+
+// readOptional reads up to n bytes of key (all of it when n is negative), or
+// returns nil when the object does not exist
+func readOptional(ctx context.Context, store Store, key string, n int64) ([]byte, error) {
+	exists, err := store.ObjectExists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("check %s: %w", key, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	var b []byte
+	if n < 0 {
+		b, err = store.GetObjectBytes(ctx, key)
+	} else {
+		b, err = store.GetObjectHead(ctx, key, n)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// nameValues flattens headers into sorted HAR name/value pairs
+func nameValues(h map[string][]string) []NameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []NameValue{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			out = append(out, NameValue{Name: name, Value: v})
+		}
+	}
+	return out
+}
+
+// queryString returns the query parameters of raw in order of appearance
+func queryString(raw string) []NameValue {
+	out := []NameValue{}
+	u, err := url.Parse(raw)
+	if err != nil || u.RawQuery == "" {
+		return out
+	}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		out = append(out, NameValue{Name: name, Value: value})
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package har
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func testEnvelope() *models.Envelope {
+	return &models.Envelope{
+		FailureID: "abc-123",
+		Project:   "myapp",
+		Env:       "prod",
+		Request:   models.RequestInfo{Method: "post", URL: "https://api.example.com/v1/orders?id=7&q=a%20b", ContentType: "application/json"},
+		Response:  &models.ResponseInfo{StatusCode: 503, DurationMs: 1200},
+		CreatedAt: time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	prefix := "failures/myapp/prod/2024/03/15/abc-123/"
+	store := testsupport.NewStore()
+	store.Put(prefix+"request.headers.json", "application/json", []byte(`{"Authorization":"Bearer secret","Accept":["application/json"]}`))
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte(`{"card":"4111","password":"hunter2"}`))
+	store.Put(prefix+"response.raw", "application/octet-stream", []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0xff})
+
+	doc, err := Assemble(context.Background(), store, testEnvelope(), prefix, redact.Default())
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+	if doc.Log.Version != "1.2" || len(doc.Log.Entries) != 1 {
+		t.Fatalf("log = %+v", doc.Log)
+	}
+	e := doc.Log.Entries[0]
+
+	if e.StartedDateTime != "2024-03-15T10:30:00.000Z" || e.Time != 1200 || e.Timings.Wait != 1200 {
+		t.Errorf("timing = %s, %v, %+v", e.StartedDateTime, e.Time, e.Timings)
+	}
+	if e.Request.Method != "POST" || len(e.Request.QueryString) != 2 || e.Request.QueryString[1] != (NameValue{"q", "a b"}) {
+		t.Errorf("request = %+v", e.Request)
+	}
+	if len(e.Request.Headers) != 2 || e.Request.Headers[1] != (NameValue{"Authorization", redact.Placeholder}) {
+		t.Errorf("headers = %+v", e.Request.Headers)
+	}
+	if e.Request.PostData == nil || strings.Contains(e.Request.PostData.Text, "hunter2") || e.Request.BodySize != 36 {
+		t.Errorf("postData = %+v, bodySize = %d", e.Request.PostData, e.Request.BodySize)
+	}
+	if e.Response.Status != 503 || e.Response.StatusText != "Service Unavailable" {
+		t.Errorf("status = %d %q", e.Response.Status, e.Response.StatusText)
+	}
+	if c := e.Response.Content; c.Encoding != "base64" || c.MimeType != "image/png" || c.Size != 9 {
+		t.Errorf("content = %+v", c)
+	}
+
+	b, err := doc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		t.Errorf("Marshal() produced invalid JSON: %v", err)
+	}
+}
+
+func TestAssemble_MissingAndLarge(t *testing.T) {
+	prefix := "p/"
+	env := testEnvelope()
+	env.Response = &models.ResponseInfo{ErrorMessage: "The request timed out."}
+	store := testsupport.NewStore()
+	store.Put(prefix+"response.raw", "application/octet-stream", []byte(strings.Repeat("a", MaxBody+10)))
+
+	doc, err := Assemble(context.Background(), store, env, prefix, redact.Default())
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+	e := doc.Log.Entries[0]
+	if e.Request.PostData != nil || len(e.Request.Headers) != 0 || e.Request.BodySize != -1 {
+		t.Errorf("request without artifacts = %+v", e.Request)
+	}
+	if e.Response.Status != 0 || e.Response.StatusText != "The request timed out." {
+		t.Errorf("status = %d %q", e.Response.Status, e.Response.StatusText)
+	}
+	if c := e.Response.Content; c.Text != "" || !strings.Contains(c.Comment, "response.raw") {
+		t.Errorf("large content = %+v", c)
+	}
+}
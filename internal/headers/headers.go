@@ -0,0 +1,140 @@
+package headers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultDeny lists headers dropped for every project unless explicitly allowed
+var DefaultDeny = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+const (
+	defaultMaxHeaders    = 100
+	defaultMaxValueBytes = 4096
+	truncatedSuffix      = "...[truncated]"
+)
+
+// Policy controls which headers are kept in stored header artifacts.
+// When Allow is non-empty only listed headers are kept; Deny always wins.
+type Policy struct {
+	Allow         []string `json:"allow,omitempty"`
+	Deny          []string `json:"deny,omitempty"`
+	MaxHeaders    int      `json:"maxHeaders,omitempty"`
+	MaxValueBytes int      `json:"maxValueBytes,omitempty"`
+}
+
+// Policies maps projects to header policies, with "default" used for unlisted projects
+type Policies struct {
+	byProject map[string]Policy
+}
+
+// ParsePolicies parses a JSON object of project -> policy. An empty string
+// yields the default policy for every project.
+func ParsePolicies(s string) (*Policies, error) {
+	p := &Policies{byProject: make(map[string]Policy)}
+	if s == "" {
+		return p, nil
+	}
+	if err := json.Unmarshal([]byte(s), &p.byProject); err != nil {
+		return nil, fmt.Errorf("parse header policies: %w", err)
+	}
+	return p, nil
+}
+
+// For returns the effective policy for project
+func (p *Policies) For(project string) Policy {
+	var pol Policy
+	if p != nil {
+		var ok bool
+		if pol, ok = p.byProject[project]; !ok {
+			pol = p.byProject["default"]
+		}
+	}
+	if pol.MaxHeaders <= 0 {
+		pol.MaxHeaders = defaultMaxHeaders
+	}
+	if pol.MaxValueBytes <= 0 {
+		pol.MaxValueBytes = defaultMaxValueBytes
+	}
+	return pol
+}
+
+func toSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[strings.ToLower(strings.TrimSpace(n))] = true
+	}
+	return set
+}
+
+// Keep reports whether the policy allows storing header name
+func (pol Policy) Keep(name string) bool {
+	n := strings.ToLower(name)
+	allow := toSet(pol.Allow)
+	if toSet(pol.Deny)[n] {
+		return false
+	}
+	if len(allow) > 0 {
+		return allow[n]
+	}
+	return !toSet(DefaultDeny)[n]
+}
+
+// Filter applies the policy to a headers document whose values are a string or
+// a list of strings, returning the names of dropped headers.
+func (pol Policy) Filter(doc map[string]interface{}) []string {
+	var dropped []string
+
+	names := make([]string, 0, len(doc))
+	for k := range doc {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	kept := 0
+	for _, name := range names {
+		if !pol.Keep(name) || kept >= pol.MaxHeaders {
+			delete(doc, name)
+			dropped = append(dropped, name)
+			continue
+		}
+		kept++
+		doc[name] = pol.truncate(doc[name])
+	}
+	return dropped
+}
+
+func (pol Policy) truncate(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if len(t) > pol.MaxValueBytes {
+			return t[:pol.MaxValueBytes] + truncatedSuffix
+		}
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = pol.truncate(t[i])
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// FilterJSON applies the policy to a serialized headers document
+func (pol Policy) FilterJSON(b []byte) ([]byte, []string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, nil, err
+	}
+	dropped := pol.Filter(doc)
+	out, err := json.Marshal(doc)
+	return out, dropped, err
+}
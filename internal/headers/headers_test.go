@@ -0,0 +1,70 @@
+package headers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Keep(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		header string
+		want   bool
+	}{
+		{name: "default keeps ordinary header", header: "Accept", want: true},
+		{name: "default drops authorization", header: "authorization", want: false},
+		{name: "default drops cookie", header: "Cookie", want: false},
+		{name: "deny list", policy: Policy{Deny: []string{"X-Device-Id"}}, header: "x-device-id", want: false},
+		{name: "allow list keeps listed", policy: Policy{Allow: []string{"Accept"}}, header: "accept", want: true},
+		{name: "allow list drops unlisted", policy: Policy{Allow: []string{"Accept"}}, header: "User-Agent", want: false},
+		{name: "allow overrides default deny", policy: Policy{Allow: []string{"Cookie"}}, header: "Cookie", want: true},
+		{name: "deny beats allow", policy: Policy{Allow: []string{"Cookie"}, Deny: []string{"Cookie"}}, header: "Cookie", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Keep(tt.header); got != tt.want {
+				t.Errorf("Keep(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicies_For(t *testing.T) {
+	p, err := ParsePolicies(`{"default":{"deny":["X-A"]},"myapp":{"allow":["Accept"],"maxHeaders":5}}`)
+	if err != nil {
+		t.Fatalf("ParsePolicies() error = %v", err)
+	}
+
+	if pol := p.For("myapp"); pol.MaxHeaders != 5 || len(pol.Allow) != 1 {
+		t.Errorf("For(myapp) = %+v", pol)
+	}
+	if pol := p.For("other"); len(pol.Deny) != 1 || pol.MaxHeaders != defaultMaxHeaders {
+		t.Errorf("For(other) = %+v, want default policy", pol)
+	}
+
+	if _, err := ParsePolicies("{"); err == nil {
+		t.Error("ParsePolicies() expected error")
+	}
+}
+
+func TestPolicy_FilterJSON(t *testing.T) {
+	pol := Policy{MaxHeaders: 2, MaxValueBytes: 4}
+
+	out, dropped, err := pol.FilterJSON([]byte(`{"Authorization":"Bearer x","Accept":"application/json","B":["12345678"],"C":"c"}`))
+	if err != nil {
+		t.Fatalf("FilterJSON() error = %v", err)
+	}
+
+	s := string(out)
+	if strings.Contains(s, "Authorization") || strings.Contains(s, `"C"`) {
+		t.Errorf("FilterJSON() = %s, want Authorization dropped and count limited", s)
+	}
+	if !strings.Contains(s, `"appl`+truncatedSuffix+`"`) || !strings.Contains(s, `"1234`+truncatedSuffix+`"`) {
+		t.Errorf("FilterJSON() = %s, want values truncated", s)
+	}
+	if len(dropped) != 2 {
+		t.Errorf("dropped = %v, want 2 headers", dropped)
+	}
+}
@@ -0,0 +1,142 @@
+// Package health probes the service's dependencies for the readiness endpoint
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Statuses of a report
+const (
+	StatusReady       = "ready"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// Statuses of a single check
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+)
+
+// CacheTTL is how long a report is reused. Readiness is unauthenticated and
+// probed every few seconds by each load balancer node, so probes must not
+// turn into an AWS call each.
+const CacheTTL = 5 * time.Second
+
+// Check is a dependency probed for readiness
+type Check struct {
+	Name string
+	// Critical checks make the service unavailable when they fail; others
+	// only degrade it
+	Critical bool
+	Run      func(ctx context.Context) error
+	// Breaker, when set, reports the state of the dependency's circuit
+	// breaker. While it is open, Run fails fast.
+	Breaker func() string
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latencyMs"`
+	// Breaker is the state of the dependency's circuit breaker, if it has one
+	Breaker string `json:"breaker,omitempty"`
+	// Err is logged, never returned to the unauthenticated caller, since AWS
+	// errors name buckets, roles and accounts
+	Err error `json:"-"`
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Status string            `json:"status"`
+	Time   time.Time         `json:"time"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every critical check passed
+func (r Report) Ready() bool {
+	return r.Status != StatusUnavailable
+}
+
+// Checker runs the checks, each bounded by a timeout, and caches the report
+// for CacheTTL
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	last   Report
+	cached bool
+}
+
+// New creates a checker running checks with the given per-check timeout
+func New(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout, now: time.Now}
+}
+
+// Run returns the current report, probing the dependencies unless a report
+// younger than CacheTTL exists. A nil Checker is always ready.
+func (c *Checker) Run(ctx context.Context) Report {
+	if c == nil {
+		return Report{Status: StatusReady, Time: time.Now().UTC(), Checks: map[string]Result{}}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.cached && now.Sub(c.last.Time) < CacheTTL {
+		return c.last
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Time: now.UTC(), Checks: make(map[string]Result, len(results))}
+	for i, res := range results {
+		report.Checks[c.checks[i].Name] = res
+		if res.Status == CheckOK {
+			continue
+		}
+		if res.Critical {
+			report.Status = StatusUnavailable
+		} else if report.Status == StatusReady {
+			report.Status = StatusDegraded
+		}
+	}
+	c.last, c.cached = report, true
+	return report
+}
+
+// run executes check under the timeout
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	res := Result{
+		Status:    CheckOK,
+		Critical:  check.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Err:       err,
+	}
+	if err != nil {
+		res.Status = CheckFail
+	}
+	if check.Breaker != nil {
+		res.Breaker = check.Breaker()
+	}
+	return res
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func pass(context.Context) error { return nil }
+
+func fail(context.Context) error { return errors.New("access denied") }
+
+func TestChecker_Run(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   string
+	}{
+		{"all pass", []Check{{Name: "s3", Critical: true, Run: pass}, {Name: "ses", Run: pass}}, StatusReady},
+		{"optional fails", []Check{{Name: "s3", Critical: true, Run: pass}, {Name: "ses", Run: fail}}, StatusDegraded},
+		{"critical fails", []Check{{Name: "s3", Critical: true, Run: fail}, {Name: "ses", Run: fail}}, StatusUnavailable},
+		{"no checks", nil, StatusReady},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := New(time.Second, tt.checks...).Run(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("Status = %q, want %q", report.Status, tt.want)
+			}
+			if report.Ready() != (tt.want != StatusUnavailable) {
+				t.Errorf("Ready() = %v", report.Ready())
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("Checks = %+v", report.Checks)
+			}
+			for _, c := range tt.checks {
+				res := report.Checks[c.Name]
+				if (res.Status == CheckFail) != (res.Err != nil) || res.Critical != c.Critical {
+					t.Errorf("Checks[%s] = %+v", c.Name, res)
+				}
+			}
+		})
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	report := New(10*time.Millisecond, Check{Name: "s3", Critical: true, Run: slow}).Run(context.Background())
+	if res := report.Checks["s3"]; res.Status != CheckFail || !errors.Is(res.Err, context.DeadlineExceeded) {
+		t.Errorf("Checks[s3] = %+v, want a timeout", res)
+	}
+}
+
+func TestChecker_Cache(t *testing.T) {
+	calls := 0
+	count := func(context.Context) error {
+		calls++
+		return nil
+	}
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	c := New(time.Second, Check{Name: "s3", Critical: true, Run: count})
+	c.now = func() time.Time { return now }
+
+	c.Run(context.Background())
+	now = now.Add(CacheTTL - time.Millisecond)
+	c.Run(context.Background())
+	if calls != 1 {
+		t.Errorf("checks ran %d times within CacheTTL, want 1", calls)
+	}
+
+	now = now.Add(time.Millisecond)
+	c.Run(context.Background())
+	if calls != 2 {
+		t.Errorf("checks ran %d times after CacheTTL, want 2", calls)
+	}
+}
+
+func TestChecker_Nil(t *testing.T) {
+	var c *Checker
+	if report := c.Run(context.Background()); report.Status != StatusReady {
+		t.Errorf("Status = %q, want ready", report.Status)
+	}
+}
+
+func TestChecker_Breaker(t *testing.T) {
+	open := func() string { return "open" }
+	report := New(time.Second, Check{Name: "s3", Critical: true, Run: fail, Breaker: open}, Check{Name: "ses", Run: pass}).Run(context.Background())
+	if got := report.Checks["s3"].Breaker; got != "open" {
+		t.Errorf("Checks[s3].Breaker = %q, want open", got)
+	}
+	if got := report.Checks["ses"].Breaker; got != "" {
+		t.Errorf("Checks[ses].Breaker = %q, want none", got)
+	}
+}
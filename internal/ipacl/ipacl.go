@@ -0,0 +1,154 @@
+package ipacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Route groups an ACL can apply to
+const (
+	// GroupAPI is the versioned API under /v1 and /v2 and the short links
+	GroupAPI = "api"
+	// GroupAdmin is the admin API under /admin
+	GroupAdmin = "admin"
+	// GroupDashboard is the web dashboard under /ui
+	GroupDashboard = "dashboard"
+)
+
+var groups = map[string]bool{GroupAPI: true, GroupAdmin: true, GroupDashboard: true}
+
+// ACL admits or rejects source addresses. Deny entries win; when there are
+// allow entries, addresses must also match one of them.
+type ACL struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// Allows reports whether addr, an IP address, may call the group. A nil ACL
+// allows everything; addresses that do not parse are only allowed by ACLs
+// without allow entries.
+func (a *ACL) Allows(addr string) bool {
+	if a == nil {
+		return true
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return len(a.allow) == 0
+	}
+	ip = ip.Unmap()
+	for _, p := range a.deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, p := range a.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules maps route groups to their ACLs
+type Rules map[string]*ACL
+
+// For returns the ACL of group, nil when it is unrestricted
+func (r Rules) For(group string) *ACL {
+	return r[group]
+}
+
+// Parse parses a JSON object of route groups to allow and deny lists of CIDRs
+// or single addresses, e.g. {"admin":{"allow":["10.0.0.0/8"]}}
+func Parse(s string) (Rules, error) {
+	rules := Rules{}
+	if s == "" {
+		return rules, nil
+	}
+
+	var raw map[string]struct {
+		Allow []string `json:"allow"`
+		Deny  []string `json:"deny"`
+	}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("parse IP ACLs: %w", err)
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !groups[name] {
+			return nil, fmt.Errorf("parse IP ACLs: unknown route group %q (want api, admin or dashboard)", name)
+		}
+		acl := &ACL{}
+		var err error
+		if acl.allow, err = parsePrefixes(raw[name].Allow); err != nil {
+			return nil, fmt.Errorf("parse IP ACLs: %s.allow: %w", name, err)
+		}
+		if acl.deny, err = parsePrefixes(raw[name].Deny); err != nil {
+			return nil, fmt.Errorf("parse IP ACLs: %s.deny: %w", name, err)
+		}
+		rules[name] = acl
+	}
+	return rules, nil
+}
+
+// parsePrefixes parses CIDRs, taking single addresses as /32 or /128
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			ip, err := netip.ParseAddr(e)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR", e)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", e)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// ClientIP returns the address of the client of a request from peer, the
+// address that connected to the service, and the X-Forwarded-For values.
+// Each of the depth proxies in front of the service appends the address it
+// received the request from, so the client is depth entries from the end;
+// anything before that was sent by the client and cannot be trusted. Shorter
+// chains yield their first entry, and depth 0 the peer.
+func ClientIP(peer string, forwardedFor []string, depth int) string {
+	if depth <= 0 {
+		return peer
+	}
+	var chain []string
+	for _, v := range forwardedFor {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				chain = append(chain, e)
+			}
+		}
+	}
+	chain = append(chain, peer)
+
+	i := len(chain) - 1 - depth
+	if i < 0 {
+		i = 0
+	}
+	if _, err := netip.ParseAddr(chain[i]); err != nil {
+		return peer
+	}
+	return chain[i]
+}
@@ -0,0 +1,72 @@
+package ipacl
+
+import "testing"
+
+func TestACL_Allows(t *testing.T) {
+	rules, err := Parse(`{
+		"admin": {"allow": ["10.0.0.0/8", "2001:db8::/32", "203.0.113.7"], "deny": ["10.9.0.0/16"]},
+		"api": {"deny": ["198.51.100.0/24"]}
+	}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		group string
+		addr  string
+		want  bool
+	}{
+		{GroupAdmin, "10.1.2.3", true},
+		{GroupAdmin, "::ffff:10.1.2.3", true},
+		{GroupAdmin, "2001:db8::1", true},
+		{GroupAdmin, "203.0.113.7", true},
+		{GroupAdmin, "203.0.113.8", false},
+		{GroupAdmin, "10.9.0.1", false},
+		{GroupAdmin, "not-an-ip", false},
+		{GroupAPI, "198.51.100.20", false},
+		{GroupAPI, "203.0.113.8", true},
+		{GroupAPI, "not-an-ip", true},
+		{GroupDashboard, "198.51.100.20", true},
+	}
+	for _, tt := range tests {
+		if got := rules.For(tt.group).Allows(tt.addr); got != tt.want {
+			t.Errorf("%s.Allows(%s) = %v, want %v", tt.group, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, spec := range []string{
+		`{"metrics":{"allow":["10.0.0.0/8"]}}`,
+		`{"admin":{"allow":["10.0.0.0/33"]}}`,
+		`{"admin":{"deny":["example.com"]}}`,
+		`not json`,
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%s) error = nil", spec)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name  string
+		xff   []string
+		depth int
+		want  string
+	}{
+		{"no proxies trusted", []string{"1.1.1.1"}, 0, "10.0.0.2"},
+		{"one proxy", []string{"6.6.6.6, 1.1.1.1"}, 1, "1.1.1.1"},
+		{"two proxies", []string{"6.6.6.6, 1.1.1.1", "192.0.2.1"}, 2, "1.1.1.1"},
+		{"chain shorter than depth", []string{"1.1.1.1"}, 3, "1.1.1.1"},
+		{"no header", nil, 1, "10.0.0.2"},
+		{"garbage entry", []string{"bogus"}, 1, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClientIP("10.0.0.2", tt.xff, tt.depth); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval bounds how often an unknown kid may force a JWKS refetch
+const minRefreshInterval = time.Minute
+
+// KeySet fetches and caches RSA public keys from a JWKS endpoint
+type KeySet struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewKeySet creates a JWKS-backed key set. Keys are refetched after ttl.
+func NewKeySet(url string, ttl time.Duration) *KeySet {
+	return &KeySet{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the public key for kid, refreshing the set when it is stale
+// or the kid is unknown.
+func (ks *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	fresh := time.Since(ks.fetchedAt) < ks.ttl
+	recent := time.Since(ks.fetchedAt) < minRefreshInterval
+	ks.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !ok && recent {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if err := ks.refresh(ctx); err != nil {
+		// Serve a stale key rather than failing closed on a transient fetch error
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (ks *KeySet) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := parseRSAKey(k.N, k.E)
+		if err != nil {
+			return fmt.Errorf("parse jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = pub
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
@@ -0,0 +1,273 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+)
+
+// leeway tolerates clock skew between the issuer and this service
+const leeway = time.Minute
+
+var (
+	ErrMalformed   = errors.New("malformed token")
+	ErrSignature   = errors.New("invalid token signature")
+	ErrExpired     = errors.New("token expired")
+	ErrNotYetValid = errors.New("token not yet valid")
+	ErrIssuer      = errors.New("invalid token issuer")
+	ErrAudience    = errors.New("invalid token audience")
+)
+
+// Options configures token verification
+type Options struct {
+	Issuer        string
+	Audience      string
+	ProjectClaim  string
+	TenantClaim   string
+	DefaultScopes []apikeys.Scope
+}
+
+// KeyProvider resolves the public key used to sign a token
+type KeyProvider interface {
+	Key(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// Verifier validates RS256/RS384/RS512 bearer tokens
+type Verifier struct {
+	keys KeyProvider
+	opts Options
+	now  func() time.Time
+}
+
+// NewVerifier creates a verifier backed by the given key provider
+func NewVerifier(keys KeyProvider, opts Options) *Verifier {
+	if opts.ProjectClaim == "" {
+		opts.ProjectClaim = "project"
+	}
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = "tenant"
+	}
+	return &Verifier{keys: keys, opts: opts, now: time.Now}
+}
+
+// Claims are the identity attributes extracted from a verified token
+type Claims struct {
+	Subject  string
+	Issuer   string
+	Projects []string
+	Tenant   string
+	Scopes   []apikeys.Scope
+	Raw      map[string]interface{}
+}
+
+// Identity returns the token subject
+func (c *Claims) Identity() string {
+	return c.Subject
+}
+
+// TenantID returns the token's tenant claim, or an empty string
+func (c *Claims) TenantID() string {
+	return c.Tenant
+}
+
+// AllowsProject reports whether the token grants access to project
+func (c *Claims) AllowsProject(project string) bool {
+	for _, p := range c.Projects {
+		if p == apikeys.Wildcard || p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token carries scope. The admin scope implies every other scope.
+func (c *Claims) HasScope(scope apikeys.Scope) bool {
+	for _, s := range c.Scopes {
+		if s == scope || s == apikeys.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes splits a comma- or space-separated scope list
+func ParseScopes(s string) []apikeys.Scope {
+	var scopes []apikeys.Scope
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		scopes = append(scopes, apikeys.Scope(f))
+	}
+	return scopes
+}
+
+var hashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// Verify checks the token signature and standard claims and returns its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+
+	hash, ok := hashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrMalformed, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), sig); err != nil {
+		return nil, ErrSignature
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, ErrMalformed
+	}
+
+	// Tokens without an expiry would be valid forever
+	now := v.now()
+	exp, ok := numericClaim(raw, "exp")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrMalformed)
+	}
+	if now.After(exp.Add(leeway)) {
+		return nil, ErrExpired
+	}
+	if nbf, ok := numericClaim(raw, "nbf"); ok && now.Add(leeway).Before(nbf) {
+		return nil, ErrNotYetValid
+	}
+
+	return newClaims(raw, v.opts)
+}
+
+// Authorizer maps claims already validated upstream, by an API Gateway JWT or
+// Lambda authorizer, the same way Verifier maps token claims
+type Authorizer struct {
+	opts Options
+}
+
+// NewAuthorizer creates an authorizer claim mapper
+func NewAuthorizer(opts Options) *Authorizer {
+	if opts.ProjectClaim == "" {
+		opts.ProjectClaim = "project"
+	}
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = "tenant"
+	}
+	return &Authorizer{opts: opts}
+}
+
+// Claims returns the claims of raw. Signatures and expiry were checked by the
+// authorizer; the issuer and audience are checked again when configured.
+func (a *Authorizer) Claims(raw map[string]interface{}) (*Claims, error) {
+	return newClaims(raw, a.opts)
+}
+
+// newClaims checks the issuer and audience of raw and maps it to Claims
+func newClaims(raw map[string]interface{}, opts Options) (*Claims, error) {
+	claims := &Claims{
+		Subject:  stringClaim(raw, "sub"),
+		Issuer:   stringClaim(raw, "iss"),
+		Projects: listClaim(raw, opts.ProjectClaim),
+		Tenant:   stringClaim(raw, opts.TenantClaim),
+		Raw:      raw,
+	}
+
+	// A configured issuer is required: tokens without an iss claim fail too
+	if opts.Issuer != "" && claims.Issuer != opts.Issuer {
+		return nil, ErrIssuer
+	}
+	if opts.Audience != "" && !containsString(listClaim(raw, "aud"), opts.Audience) {
+		return nil, ErrAudience
+	}
+
+	scopes := listClaim(raw, "scope")
+	if len(scopes) == 0 {
+		scopes = listClaim(raw, "scp")
+	}
+	for _, s := range scopes {
+		claims.Scopes = append(claims.Scopes, apikeys.Scope(s))
+	}
+	if len(claims.Scopes) == 0 {
+		claims.Scopes = opts.DefaultScopes
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func stringClaim(raw map[string]interface{}, name string) string {
+	s, _ := raw[name].(string)
+	return s
+}
+
+// listClaim reads a claim that may be a JSON array or a space-separated string
+func listClaim(raw map[string]interface{}, name string) []string {
+	switch v := raw[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func numericClaim(raw map[string]interface{}, name string) (time.Time, bool) {
+	f, ok := raw[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func jwksServer(t *testing.T, kid string, pub *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+
+	doc := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	srv := jwksServer(t, "k1", &key.PublicKey)
+	v := NewVerifier(NewKeySet(srv.URL, time.Hour), Options{
+		Issuer:        "https://issuer.example.com",
+		Audience:      "failure-uploader",
+		DefaultScopes: []apikeys.Scope{apikeys.ScopeTicketCreate},
+	})
+
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":     "user-1",
+			"iss":     "https://issuer.example.com",
+			"aud":     []string{"failure-uploader"},
+			"exp":     now.Add(time.Hour).Unix(),
+			"project": "myapp",
+			"tenant":  "acme",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name:  "valid token",
+			token: func() string { return signToken(t, key, "k1", valid()) },
+		},
+		{
+			name: "expired",
+			token: func() string {
+				c := valid()
+				c["exp"] = now.Add(-time.Hour).Unix()
+				return signToken(t, key, "k1", c)
+			},
+			wantErr: ErrExpired,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				c := valid()
+				c["iss"] = "https://evil.example.com"
+				return signToken(t, key, "k1", c)
+			},
+			wantErr: ErrIssuer,
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				c := valid()
+				delete(c, "exp")
+				return signToken(t, key, "k1", c)
+			},
+			wantErr: ErrMalformed,
+		},
+		{
+			name: "no issuer",
+			token: func() string {
+				c := valid()
+				delete(c, "iss")
+				return signToken(t, key, "k1", c)
+			},
+			wantErr: ErrIssuer,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				c := valid()
+				c["aud"] = "someone-else"
+				return signToken(t, key, "k1", c)
+			},
+			wantErr: ErrAudience,
+		},
+		{
+			name:    "bad signature",
+			token:   func() string { return signToken(t, other, "k1", valid()) },
+			wantErr: ErrSignature,
+		},
+		{
+			name:    "malformed",
+			token:   func() string { return "not.a-token" },
+			wantErr: ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "user-1" || claims.Tenant != "acme" {
+				t.Errorf("claims = %+v", claims)
+			}
+			if !claims.AllowsProject("myapp") || claims.AllowsProject("other") {
+				t.Errorf("project claim not enforced: %v", claims.Projects)
+			}
+			if !claims.HasScope(apikeys.ScopeTicketCreate) {
+				t.Error("default scopes not applied")
+			}
+		})
+	}
+}
+
+func TestVerifier_UnknownKid(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	srv := jwksServer(t, "k1", &key.PublicKey)
+	v := NewVerifier(NewKeySet(srv.URL, time.Hour), Options{})
+
+	token := signToken(t, key, "k2", map[string]interface{}{"sub": "user-1"})
+	if _, err := v.Verify(context.Background(), token); err == nil {
+		t.Error("Verify() expected error for unknown kid")
+	}
+}
+
+func TestAuthorizer_Claims(t *testing.T) {
+	a := NewAuthorizer(Options{
+		Issuer:        "https://cognito-idp.example.com/pool",
+		ProjectClaim:  "cognito:groups",
+		DefaultScopes: []apikeys.Scope{apikeys.ScopeTicketCreate},
+	})
+
+	claims, err := a.Claims(map[string]interface{}{
+		"sub":            "user-1",
+		"iss":            "https://cognito-idp.example.com/pool",
+		"cognito:groups": []interface{}{"myapp"},
+		"tenant":         "acme",
+	})
+	if err != nil {
+		t.Fatalf("Claims() error = %v", err)
+	}
+	if claims.Identity() != "user-1" || claims.Tenant != "acme" || !claims.AllowsProject("myapp") || claims.AllowsProject("other") {
+		t.Errorf("Claims() = %+v", claims)
+	}
+	if !claims.HasScope(apikeys.ScopeTicketCreate) || claims.HasScope(apikeys.ScopeFailureRead) {
+		t.Errorf("scopes = %v, want the defaults", claims.Scopes)
+	}
+
+	if _, err := a.Claims(map[string]interface{}{"sub": "user-1", "iss": "https://evil.example.com"}); !errors.Is(err, ErrIssuer) {
+		t.Errorf("Claims() with another issuer error = %v", err)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	got := ParseScopes("ticket:create, failure:read admin")
+	if len(got) != 3 || got[2] != apikeys.ScopeAdmin {
+		t.Errorf("ParseScopes() = %v", got)
+	}
+}
@@ -3,36 +3,105 @@ package keys
 import (
 	"fmt"
 	"path"
+	"strings"
 	"time"
 )
 
+// Key scheme versions
+const (
+	SchemeV1 = 1
+	SchemeV2 = 2
+)
+
+// TenantsPrefix is the root under which tenants' failures are stored, one
+// "failures/tenant={tenant}/" prefix per tenant
+const TenantsPrefix = "failures/tenant="
+
+// ReservedProject is the project name taken by the v2 scheme's root,
+// "failures/v2/", within the v1 layout "failures/{project}/". No project may
+// use it, or its v1 keys would be read as another project's v2 keys.
+const ReservedProject = "v2"
+
+// QuarantinePrefix is prepended to the key of an infected failure object
+// moved into quarantine. Quarantined objects stay in their failure's bucket.
+const QuarantinePrefix = "quarantine/"
+
+// Names of the dedicated artifact slots under a failure's prefix
+const (
+	LogsName       = "logs.txt"
+	ScreenshotName = "screenshot.png"
+	ConsoleName    = "console.json"
+)
+
 // Builder constructs S3 keys for failure uploads
 type Builder struct {
+	tenant    string
 	project   string
 	env       string
 	failureID string
 	date      time.Time
+	scheme    int
 }
 
-// NewBuilder creates a new key builder
+// NewBuilder creates a new key builder using the v1 key scheme
 func NewBuilder(project, env, failureID string) *Builder {
 	return &Builder{
 		project:   project,
 		env:       env,
 		failureID: failureID,
 		date:      time.Now().UTC(),
+		scheme:    SchemeV1,
 	}
 }
 
+// NewBuilderV2 creates a key builder using the experimental v2 key scheme
+func NewBuilderV2(project, env, failureID string) *Builder {
+	b := NewBuilder(project, env, failureID)
+	b.scheme = SchemeV2
+	return b
+}
+
+// Scheme returns the key scheme version
+func (b *Builder) Scheme() int {
+	return b.scheme
+}
+
 // WithDate sets a custom date (useful for testing)
 func (b *Builder) WithDate(t time.Time) *Builder {
 	b.date = t
 	return b
 }
 
+// WithTenant stores the failure under tenant's prefix. Tenant prefixes always
+// use the v2 date layout; an empty tenant keeps the scheme's layout.
+func (b *Builder) WithTenant(tenant string) *Builder {
+	b.tenant = tenant
+	return b
+}
+
 // Prefix returns the S3 prefix for this failure
-// Format: failures/{project}/{env}/YYYY/MM/DD/{failureId}/
+// Format v1: failures/{project}/{env}/YYYY/MM/DD/{failureId}/
+// Format v2: failures/v2/{project}/{env}/dt=YYYY-MM-DD/{failureId}/
+// Format with a tenant: failures/tenant={tenant}/{project}/{env}/dt=YYYY-MM-DD/{failureId}/
 func (b *Builder) Prefix() string {
+	if b.tenant != "" {
+		return fmt.Sprintf("%s%s/%s/%s/dt=%s/%s/",
+			TenantsPrefix,
+			b.tenant,
+			b.project,
+			b.env,
+			b.date.Format("2006-01-02"),
+			b.failureID,
+		)
+	}
+	if b.scheme == SchemeV2 {
+		return fmt.Sprintf("failures/v2/%s/%s/dt=%s/%s/",
+			b.project,
+			b.env,
+			b.date.Format("2006-01-02"),
+			b.failureID,
+		)
+	}
 	return fmt.Sprintf("failures/%s/%s/%s/%s/",
 		b.project,
 		b.env,
@@ -66,6 +135,21 @@ func (b *Builder) Checksums() string {
 	return path.Join(b.Prefix(), "checksums.json")
 }
 
+// Logs returns the key for logs.txt, the tail of the client's log
+func (b *Builder) Logs() string {
+	return path.Join(b.Prefix(), LogsName)
+}
+
+// Screenshot returns the key for screenshot.png
+func (b *Builder) Screenshot() string {
+	return path.Join(b.Prefix(), ScreenshotName)
+}
+
+// Console returns the key for console.json, the client's console output
+func (b *Builder) Console() string {
+	return path.Join(b.Prefix(), ConsoleName)
+}
+
 // File returns the key for a file upload
 func (b *Builder) File(filename string) string {
 	return path.Join(b.Prefix(), "files", filename)
@@ -81,12 +165,142 @@ func (b *Builder) RequiredKeys() []string {
 	}
 }
 
-// AllKeys returns all keys including files
+// AllKeys returns all keys including the artifact slots and files
 func (b *Builder) AllKeys(filenames []string) []string {
 	keys := b.RequiredKeys()
-	keys = append(keys, b.ResponseRaw())
+	keys = append(keys, b.ResponseRaw(), b.Logs(), b.Screenshot(), b.Console())
 	for _, f := range filenames {
 		keys = append(keys, b.File(f))
 	}
 	return keys
 }
+
+// DayPrefixes returns the prefixes holding all failures for project/env on day,
+// one per key scheme, or the tenant's prefix when tenant is set
+func DayPrefixes(tenant, project, env string, day time.Time) []string {
+	if tenant != "" {
+		return []string{fmt.Sprintf("%s%s/%s/%s/dt=%s/", TenantsPrefix, tenant, project, env, day.Format("2006-01-02"))}
+	}
+	return []string{
+		fmt.Sprintf("failures/%s/%s/%s/", project, env, day.Format("2006/01/02")),
+		fmt.Sprintf("failures/v2/%s/%s/dt=%s/", project, env, day.Format("2006-01-02")),
+	}
+}
+
+// EnvPrefixes returns the prefixes holding all failures for project/env, one
+// per key scheme, or the tenant's prefix when tenant is set
+func EnvPrefixes(tenant, project, env string) []string {
+	if tenant != "" {
+		return []string{fmt.Sprintf("%s%s/%s/%s/", TenantsPrefix, tenant, project, env)}
+	}
+	return []string{
+		fmt.Sprintf("failures/%s/%s/", project, env),
+		fmt.Sprintf("failures/v2/%s/%s/", project, env),
+	}
+}
+
+// Location identifies the failure an object key belongs to
+type Location struct {
+	// Tenant is empty for failures stored outside a tenant prefix
+	Tenant    string
+	Project   string
+	Env       string
+	Date      time.Time
+	FailureID string
+	// Prefix is the failure's prefix, as returned by Builder.Prefix
+	Prefix string
+}
+
+// Builder returns a key builder for the failure at l, in the key scheme and
+// tenant it is stored under
+func (l Location) Builder() *Builder {
+	b := NewBuilder(l.Project, l.Env, l.FailureID).WithDate(l.Date).WithTenant(l.Tenant)
+	if l.Tenant == "" && strings.HasPrefix(l.Prefix, "failures/v2/") {
+		b.scheme = SchemeV2
+	}
+	return b
+}
+
+// ParseEnv returns the project and env of a key or prefix within a single
+// project/env, e.g. one returned by EnvPrefixes or DayPrefixes. It reports
+// false for anything shorter, such as the prefix of a whole project.
+func ParseEnv(prefix string) (project, env string, ok bool) {
+	var parts []string
+	switch {
+	case strings.HasPrefix(prefix, TenantsPrefix):
+		parts = strings.SplitN(strings.TrimPrefix(prefix, TenantsPrefix), "/", 4)
+		if len(parts) < 4 || parts[0] == "" {
+			return "", "", false
+		}
+		parts = parts[1:]
+	case strings.HasPrefix(prefix, "failures/v2/"):
+		parts = strings.SplitN(strings.TrimPrefix(prefix, "failures/v2/"), "/", 3)
+	case strings.HasPrefix(prefix, "failures/"):
+		parts = strings.SplitN(strings.TrimPrefix(prefix, "failures/"), "/", 3)
+	}
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Parse locates the failure of an object key in either key scheme. It reports
+// false for keys outside a failure prefix.
+func Parse(key string) (Location, bool) {
+	if rest, ok := strings.CutPrefix(key, TenantsPrefix); ok {
+		parts := strings.SplitN(rest, "/", 6)
+		if len(parts) < 6 || parts[0] == "" || !strings.HasPrefix(parts[3], "dt=") {
+			return Location{}, false
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimPrefix(parts[3], "dt="))
+		if err != nil || parts[4] == "" {
+			return Location{}, false
+		}
+		return Location{
+			Tenant:    parts[0],
+			Project:   parts[1],
+			Env:       parts[2],
+			Date:      date,
+			FailureID: parts[4],
+			Prefix:    TenantsPrefix + strings.Join(parts[:5], "/") + "/",
+		}, true
+	}
+
+	if rest, ok := strings.CutPrefix(key, "failures/v2/"); ok {
+		parts := strings.SplitN(rest, "/", 5)
+		if len(parts) < 5 || !strings.HasPrefix(parts[2], "dt=") {
+			return Location{}, false
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimPrefix(parts[2], "dt="))
+		if err != nil || parts[3] == "" {
+			return Location{}, false
+		}
+		return Location{
+			Project:   parts[0],
+			Env:       parts[1],
+			Date:      date,
+			FailureID: parts[3],
+			Prefix:    "failures/v2/" + strings.Join(parts[:4], "/") + "/",
+		}, true
+	}
+
+	rest, ok := strings.CutPrefix(key, "failures/")
+	if !ok {
+		return Location{}, false
+	}
+	parts := strings.SplitN(rest, "/", 7)
+	if len(parts) < 7 || parts[5] == "" {
+		return Location{}, false
+	}
+	date, err := time.Parse("2006/01/02", strings.Join(parts[2:5], "/"))
+	if err != nil {
+		return Location{}, false
+	}
+	return Location{
+		Project:   parts[0],
+		Env:       parts[1],
+		Date:      date,
+		FailureID: parts[5],
+		Prefix:    "failures/" + strings.Join(parts[:6], "/") + "/",
+	}, true
+}
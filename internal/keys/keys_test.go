@@ -1,6 +1,7 @@
 package keys
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -77,6 +78,21 @@ func TestBuilder_Keys(t *testing.T) {
 			fn:   b.Checksums,
 			want: "failures/myapp/prod/2024/03/15/abc-123/checksums.json",
 		},
+		{
+			name: "logs",
+			fn:   b.Logs,
+			want: "failures/myapp/prod/2024/03/15/abc-123/logs.txt",
+		},
+		{
+			name: "screenshot",
+			fn:   b.Screenshot,
+			want: "failures/myapp/prod/2024/03/15/abc-123/screenshot.png",
+		},
+		{
+			name: "console",
+			fn:   b.Console,
+			want: "failures/myapp/prod/2024/03/15/abc-123/console.json",
+		},
 	}
 
 	for _, tt := range tests {
@@ -148,8 +164,133 @@ func TestBuilder_AllKeys(t *testing.T) {
 	filenames := []string{"a.jpg", "b.png"}
 	keys := b.AllKeys(filenames)
 
-	// 4 required + 1 response.raw + 2 files = 7
-	if len(keys) != 7 {
-		t.Errorf("AllKeys() returned %d keys, want 7", len(keys))
+	// 4 required + 1 response.raw + 3 artifact slots + 2 files = 10
+	if len(keys) != 10 {
+		t.Errorf("AllKeys() returned %d keys, want 10", len(keys))
+	}
+}
+
+func TestBuilderV2_Prefix(t *testing.T) {
+	date := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	b := NewBuilderV2("myapp", "prod", "abc-123").WithDate(date)
+
+	if b.Scheme() != SchemeV2 {
+		t.Errorf("Scheme() = %d, want %d", b.Scheme(), SchemeV2)
+	}
+
+	want := "failures/v2/myapp/prod/dt=2024-03-15/abc-123/"
+	if got := b.Prefix(); got != want {
+		t.Errorf("Prefix() = %q, want %q", got, want)
+	}
+
+	want = "failures/v2/myapp/prod/dt=2024-03-15/abc-123/envelope.json"
+	if got := b.Envelope(); got != want {
+		t.Errorf("Envelope() = %q, want %q", got, want)
+	}
+}
+
+func TestDayPrefixes(t *testing.T) {
+	date := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	got := DayPrefixes("", "myapp", "prod", date)
+
+	want := []string{
+		"failures/myapp/prod/2024/03/15/",
+		"failures/v2/myapp/prod/dt=2024-03-15/",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("DayPrefixes() returned %d prefixes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("DayPrefixes()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	// Every key built for that day must fall under one of the prefixes
+	for _, b := range []*Builder{NewBuilder("myapp", "prod", "abc").WithDate(date), NewBuilderV2("myapp", "prod", "abc").WithDate(date)} {
+		if !strings.HasPrefix(b.Prefix(), got[0]) && !strings.HasPrefix(b.Prefix(), got[1]) {
+			t.Errorf("prefix %q not covered by DayPrefixes", b.Prefix())
+		}
+	}
+}
+
+func TestBuilder_Tenant(t *testing.T) {
+	date := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	want := "failures/tenant=acme/myapp/prod/dt=2024-03-15/abc-123/"
+
+	for _, b := range []*Builder{NewBuilder("myapp", "prod", "abc-123"), NewBuilderV2("myapp", "prod", "abc-123")} {
+		if got := b.WithDate(date).WithTenant("acme").Prefix(); got != want {
+			t.Errorf("Prefix() = %q, want %q", got, want)
+		}
+	}
+	if got := DayPrefixes("acme", "myapp", "prod", date); len(got) != 1 || !strings.HasPrefix(want, got[0]) {
+		t.Errorf("DayPrefixes() = %v, want a prefix of %q", got, want)
+	}
+	if got := EnvPrefixes("acme", "myapp", "prod"); len(got) != 1 || !strings.HasPrefix(want, got[0]) {
+		t.Errorf("EnvPrefixes() = %v, want a prefix of %q", got, want)
+	}
+
+	loc, ok := Parse(want + "files/a.png")
+	if !ok || loc.Tenant != "acme" || loc.Project != "myapp" || loc.Env != "prod" || loc.FailureID != "abc-123" || loc.Prefix != want || !loc.Date.Equal(date.Truncate(24*time.Hour)) {
+		t.Errorf("Parse() = %+v, %v", loc, ok)
+	}
+	if loc, ok := Parse("failures/tenant=acme/myapp/prod/2024/03/15/abc/envelope.json"); ok {
+		t.Errorf("Parse() of a dated tenant key = %+v, want not ok", loc)
+	}
+}
+
+func TestParse(t *testing.T) {
+	date := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, b := range []*Builder{NewBuilder("myapp", "prod", "abc").WithDate(date), NewBuilderV2("myapp", "prod", "abc").WithDate(date)} {
+		for _, key := range []string{b.Envelope(), b.File("a.png")} {
+			loc, ok := Parse(key)
+			if !ok {
+				t.Fatalf("Parse(%q) not ok", key)
+			}
+			if loc.Tenant != "" || loc.Project != "myapp" || loc.Env != "prod" || loc.FailureID != "abc" || !loc.Date.Equal(date) || loc.Prefix != b.Prefix() {
+				t.Errorf("Parse(%q) = %+v", key, loc)
+			}
+		}
+	}
+
+	// Builders of parsed locations rebuild the failure's keys in its scheme and tenant
+	for _, b := range []*Builder{NewBuilder("myapp", "prod", "abc").WithDate(date), NewBuilderV2("myapp", "prod", "abc").WithDate(date), NewBuilder("myapp", "prod", "abc").WithDate(date).WithTenant("acme")} {
+		loc, _ := Parse(b.File("a.png"))
+		if got := loc.Builder(); got.Prefix() != b.Prefix() || got.Envelope() != b.Envelope() {
+			t.Errorf("Builder() of %+v has prefix %q, want %q", loc, got.Prefix(), b.Prefix())
+		}
+	}
+
+	for _, key := range []string{
+		"links/abc.json",
+		"failures/myapp/prod/2024/03/15/",
+		"failures/myapp/prod/2024/13/15/abc/envelope.json",
+		"failures/v2/myapp/prod/2024-03-15/abc/envelope.json",
+	} {
+		if loc, ok := Parse(key); ok {
+			t.Errorf("Parse(%q) = %+v, want not ok", key, loc)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	var prefixes []string
+	for _, tenant := range []string{"", "acme"} {
+		prefixes = append(prefixes, EnvPrefixes(tenant, "myapp", "prod")...)
+		prefixes = append(prefixes, DayPrefixes(tenant, "myapp", "prod", day)...)
+	}
+	prefixes = append(prefixes, NewBuilder("myapp", "prod", "abc").Envelope())
+	for _, prefix := range prefixes {
+		if project, env, ok := ParseEnv(prefix); !ok || project != "myapp" || env != "prod" {
+			t.Errorf("ParseEnv(%q) = %q, %q, %v", prefix, project, env, ok)
+		}
+	}
+
+	for _, prefix := range []string{"", "failures/", "failures/myapp/", "failures/v2/myapp/", TenantsPrefix, TenantsPrefix + "acme/myapp/", "links/abc.json"} {
+		if project, env, ok := ParseEnv(prefix); ok {
+			t.Errorf("ParseEnv(%q) = %q, %q, want not ok", prefix, project, env)
+		}
 	}
 }
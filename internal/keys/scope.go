@@ -0,0 +1,24 @@
+package keys
+
+import "context"
+
+// scope is the project and env of the failure a context works on
+type scope struct {
+	project string
+	env     string
+}
+
+type scopeKey struct{}
+
+// WithScope returns ctx working on a failure of project and env. Records of
+// the failure kept outside failures/, such as its ticket or index row, are
+// stored in that failure's bucket when written with it.
+func WithScope(ctx context.Context, project, env string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{project: project, env: env})
+}
+
+// ScopeFrom returns the project and env set by WithScope
+func ScopeFrom(ctx context.Context) (project, env string, ok bool) {
+	s, ok := ctx.Value(scopeKey{}).(scope)
+	return s.project, s.env, ok
+}
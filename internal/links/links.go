@@ -0,0 +1,90 @@
+package links
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Prefix is the S3 prefix under which failure link targets are stored
+const Prefix = "links/"
+
+// Response headers describing the client-side encryption of a linked artifact
+const (
+	HeaderAlgorithm = "X-Encryption-Algorithm"
+	HeaderKeyID     = "X-Encryption-Key-Id"
+	HeaderIV        = "X-Encryption-Iv"
+)
+
+// ErrNotFound is returned when no target was recorded for a failure
+var ErrNotFound = errors.New("no link target for failure")
+
+// Store is the subset of S3 operations short links need
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
+
+// Target is where a failure's artifacts live
+type Target struct {
+	FailureID string `json:"failureId"`
+	Project   string `json:"project"`
+	Env       string `json:"env"`
+	S3Prefix  string `json:"s3Prefix"`
+
+	Encryption *models.Encryption `json:"encryption,omitempty"`
+}
+
+// Key returns the target key
+// Format: links/{failureId}.json
+func Key(failureID string) string {
+	return Prefix + failureID + ".json"
+}
+
+// Record stores the target so links for its failure can be resolved later
+func Record(ctx context.Context, store Store, t Target) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return store.PutObjectBytes(keys.WithScope(ctx, t.Project, t.Env), Key(t.FailureID), "application/json", b)
+}
+
+// Resolve loads the target for failureID, returning ErrNotFound if none was recorded
+func Resolve(ctx context.Context, store Store, failureID string) (*Target, error) {
+	key := Key(failureID)
+	exists, err := store.ObjectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	b, err := store.GetObjectBytes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var t Target
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ObjectKey returns the S3 key of artifact within the target
+func (t *Target) ObjectKey(artifact string) string {
+	return strings.TrimSuffix(t.S3Prefix, "/") + "/" + artifact
+}
+
+// URL builds the short link for artifact of failureID under the public base URL
+// Format: {base}/r/{failureId}/{artifact}
+func URL(base, failureID, artifact string) string {
+	return strings.TrimSuffix(base, "/") + "/r/" + url.PathEscape(failureID) + "/" + artifact
+}
@@ -0,0 +1,117 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// memStore is an in-memory Store for tests
+type memStore struct {
+	objects map[string][]byte
+}
+
+func (m *memStore) PutObjectBytes(_ context.Context, key, _ string, data []byte) error {
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memStore) GetObjectBytes(_ context.Context, key string) ([]byte, error) {
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", key)
+	}
+	return b, nil
+}
+
+func (m *memStore) ObjectExists(_ context.Context, key string) (bool, error) {
+	_, ok := m.objects[key]
+	return ok, nil
+}
+
+func TestRecordResolve(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{objects: make(map[string][]byte)}
+
+	if _, err := Resolve(ctx, store, "abc-123"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Resolve() error = %v, want ErrNotFound", err)
+	}
+
+	want := Target{FailureID: "abc-123", Project: "myapp", Env: "prod", S3Prefix: "failures/myapp/prod/2024/03/15/abc-123/"}
+	if err := Record(ctx, store, want); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	got, err := Resolve(ctx, store, "abc-123")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if *got != want {
+		t.Errorf("Resolve() = %+v, want %+v", got, want)
+	}
+	if k := got.ObjectKey("files/a.jpg"); k != "failures/myapp/prod/2024/03/15/abc-123/files/a.jpg" {
+		t.Errorf("ObjectKey() = %q", k)
+	}
+}
+
+func TestURL(t *testing.T) {
+	if got := URL("https://api.example.com/", "abc-123", "envelope.json"); got != "https://api.example.com/r/abc-123/envelope.json" {
+		t.Errorf("URL() = %q", got)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	s, err := NewSigner("https://api.example.com/", "0123456789abcdef", time.Hour)
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	link, err := url.Parse(s.URL("abc-123", "files/a.jpg"))
+	if err != nil || link.Path != "/r/abc-123/files/a.jpg" {
+		t.Fatalf("URL() = %v, %v", link, err)
+	}
+	q := link.Query()
+	if err := s.VerifyURL("abc-123", "files/a.jpg", q); err != nil {
+		t.Errorf("VerifyURL() error = %v", err)
+	}
+	if err := s.VerifyURL("abc-123", "envelope.json", q); !errors.Is(err, ErrSignature) {
+		t.Errorf("VerifyURL(other artifact) error = %v, want ErrSignature", err)
+	}
+	if err := s.VerifyAck("abc-123", q); !errors.Is(err, ErrSignature) {
+		t.Errorf("VerifyAck(artifact link) error = %v, want ErrSignature", err)
+	}
+
+	ack, _ := url.Parse(s.AckURL("abc-123"))
+	if ack.Path != "/ack/abc-123" {
+		t.Errorf("AckURL() path = %q", ack.Path)
+	}
+	if err := s.VerifyAck("abc-123", ack.Query()); err != nil {
+		t.Errorf("VerifyAck() error = %v", err)
+	}
+	if err := s.VerifyAck("other", ack.Query()); !errors.Is(err, ErrSignature) {
+		t.Errorf("VerifyAck(other failure) error = %v, want ErrSignature", err)
+	}
+
+	extended := ack.Query()
+	extended.Set(ParamExpires, "9999999999")
+	if err := s.VerifyAck("abc-123", extended); !errors.Is(err, ErrSignature) {
+		t.Errorf("VerifyAck(extended expiry) error = %v, want ErrSignature", err)
+	}
+	if err := s.VerifyAck("abc-123", url.Values{}); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("VerifyAck(unsigned) error = %v, want ErrUnsigned", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := s.VerifyAck("abc-123", ack.Query()); !errors.Is(err, ErrExpired) {
+		t.Errorf("VerifyAck(expired) error = %v, want ErrExpired", err)
+	}
+
+	if _, err := NewSigner("https://api.example.com", "short", time.Hour); err == nil {
+		t.Error("NewSigner() with a short secret error = nil")
+	}
+}
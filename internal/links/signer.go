@@ -0,0 +1,121 @@
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters carrying the signature of a link
+const (
+	ParamExpires   = "expires"
+	ParamSignature = "sig"
+)
+
+var (
+	ErrUnsigned  = errors.New("link is not signed")
+	ErrSignature = errors.New("invalid link signature")
+	ErrExpired   = errors.New("link has expired")
+)
+
+// Signer builds the links of notifications under the public base URL. Each
+// link carries an expiry and an HMAC-SHA256 signature of what it points at,
+// so it is followed without API credentials but cannot be reused for another
+// failure, artifact or action, nor after it expires.
+type Signer struct {
+	base   string
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewSigner creates a signer of links under base that are valid for ttl
+func NewSigner(base, secret string, ttl time.Duration) (*Signer, error) {
+	if base == "" {
+		return nil, errors.New("link base URL is required")
+	}
+	if len(secret) < 16 {
+		return nil, errors.New("link secret must be at least 16 characters")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("link TTL must be positive, got %s", ttl)
+	}
+	return &Signer{base: base, secret: []byte(secret), ttl: ttl, now: time.Now}, nil
+}
+
+// Load creates a signer of links under base, returning nil when base is empty
+func Load(base, secret string, ttl time.Duration) (*Signer, error) {
+	if base == "" {
+		return nil, nil
+	}
+	return NewSigner(base, secret, ttl)
+}
+
+// URL returns the signed short link of artifact of failureID
+// Format: {base}/r/{failureId}/{artifact}?expires=...&sig=...
+func (s *Signer) URL(failureID, artifact string) string {
+	return URL(s.base, failureID, artifact) + "?" + s.token(artifactPath(failureID, artifact))
+}
+
+// AckURL returns the signed one-click acknowledgment link of failureID
+// Format: {base}/ack/{failureId}?expires=...&sig=...
+func (s *Signer) AckURL(failureID string) string {
+	return strings.TrimSuffix(s.base, "/") + "/ack/" + url.PathEscape(failureID) + "?" + s.token(ackPath(failureID))
+}
+
+// VerifyURL checks the signature query of a short link to artifact of failureID
+func (s *Signer) VerifyURL(failureID, artifact string, query url.Values) error {
+	return s.verify(artifactPath(failureID, artifact), query)
+}
+
+// VerifyAck checks the signature query of an acknowledgment link of failureID
+func (s *Signer) VerifyAck(failureID string, query url.Values) error {
+	return s.verify(ackPath(failureID), query)
+}
+
+// artifactPath and ackPath identify what a link points at. They are signed
+// unescaped, so the signature does not depend on how the path was encoded.
+func artifactPath(failureID, artifact string) string {
+	return "r\n" + failureID + "\n" + artifact
+}
+
+func ackPath(failureID string) string {
+	return "ack\n" + failureID
+}
+
+// token returns the signature query of a link to target expiring after ttl
+func (s *Signer) token(target string) string {
+	expires := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)
+	return url.Values{ParamExpires: {expires}, ParamSignature: {s.sign(target, expires)}}.Encode()
+}
+
+// sign returns the hex HMAC-SHA256 of expires + "\n" + target
+func (s *Signer) sign(target, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(expires + "\n" + target))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Signer) verify(target string, query url.Values) error {
+	expires, sig := query.Get(ParamExpires), query.Get(ParamSignature)
+	if expires == "" || sig == "" {
+		return ErrUnsigned
+	}
+	if !hmac.Equal([]byte(s.sign(target, expires)), []byte(strings.ToLower(sig))) {
+		return ErrSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrSignature
+	}
+	if s.now().After(time.Unix(unix, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
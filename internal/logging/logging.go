@@ -1,48 +1,174 @@
 package logging
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
-var Logger zerolog.Logger
+// base is the process logger. Code serving a request logs through
+// FromContext, so that its lines carry the request's correlation fields;
+// the package-level Info, Error, Warn and Debug are for everything else.
+var base zerolog.Logger
 
-func Init(stage string) {
+// Options configures the process logger
+type Options struct {
+	Stage string
+	// Level is the minimum level logged: trace, debug, info, warn or error.
+	// Empty means debug in dev and info elsewhere.
+	Level string
+	// Format is "json" or "pretty"; empty means pretty in dev and JSON elsewhere
+	Format string
+	// InfoSampleN keeps one in N info lines; 0 or 1 keeps them all. Warnings
+	// and errors are never sampled.
+	InfoSampleN int
+	// DebugProjects are logged at debug level and unsampled once a request
+	// names them, to diagnose one client without raising the level for all
+	DebugProjects []string
+}
+
+// debugProjects holds Options.DebugProjects
+var debugProjects map[string]bool
+
+// Init configures the process logger. Invalid options are reported after
+// falling back to their defaults, so the logger is always usable.
+func Init(opts Options) error {
 	zerolog.TimeFieldFormat = time.RFC3339
 
-	if stage == "dev" {
-		Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+	var errs []error
+	level := zerolog.InfoLevel
+	if opts.Stage == "dev" {
+		level = zerolog.DebugLevel
+	}
+	if opts.Level != "" {
+		l, err := zerolog.ParseLevel(strings.ToLower(opts.Level))
+		if err != nil || l == zerolog.NoLevel {
+			errs = append(errs, fmt.Errorf("invalid log level %q", opts.Level))
+		} else {
+			level = l
+		}
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = "json"
+		if opts.Stage == "dev" {
+			format = "pretty"
+		}
+	}
+	switch format {
+	case "pretty":
+		base = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
 			With().
 			Timestamp().
 			Caller().
 			Logger()
-	} else {
-		Logger = zerolog.New(os.Stderr).
+	default:
+		if format != "json" {
+			errs = append(errs, fmt.Errorf("invalid log format %q", opts.Format))
+		}
+		base = zerolog.New(os.Stderr).
 			With().
 			Timestamp().
-			Str("stage", stage).
+			Str("stage", opts.Stage).
 			Logger()
 	}
+	base = base.Level(level)
+	if opts.InfoSampleN > 1 {
+		base = base.Sample(&zerolog.LevelSampler{InfoSampler: &zerolog.BasicSampler{N: uint32(opts.InfoSampleN)}})
+	}
+
+	debugProjects = make(map[string]bool, len(opts.DebugProjects))
+	for _, p := range opts.DebugProjects {
+		debugProjects[p] = true
+	}
+	return errors.Join(errs...)
 }
 
 func Info() *zerolog.Event {
-	return Logger.Info()
+	return base.Info()
 }
 
 func Error() *zerolog.Event {
-	return Logger.Error()
+	return base.Error()
 }
 
 func Warn() *zerolog.Event {
-	return Logger.Warn()
+	return base.Warn()
 }
 
 func Debug() *zerolog.Event {
-	return Logger.Debug()
+	return base.Debug()
+}
+
+// Log returns an event without a level, which level and sampling settings never drop
+func Log() *zerolog.Event {
+	return base.Log()
+}
+
+// ctxKey carries a scoped logger in a context
+type ctxKey struct{}
+
+// scoped is a logger together with the names of the fields added through With
+type scoped struct {
+	logger zerolog.Logger
+	fields map[string]bool
+}
+
+// WithContext returns a copy of ctx carrying l. Tests use it to capture or
+// silence the logs of the code under test.
+func WithContext(ctx context.Context, l zerolog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &scoped{logger: l})
+}
+
+// FromContext returns the logger carried by ctx, or the process logger
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if s, ok := ctx.Value(ctxKey{}).(*scoped); ok {
+		return &s.logger
+	}
+	return &base
 }
 
-func WithField(key string, value interface{}) zerolog.Logger {
-	return Logger.With().Interface(key, value).Logger()
+// With returns a copy of ctx whose logger adds the given key/value pairs to
+// every line. Empty values are skipped, and so are keys an outer With already
+// set: the first value seeded for a request wins, so entry points and the
+// packages they call can both seed the same fields without repeating them.
+// Seeding a project listed in Options.DebugProjects enables debug logging.
+func With(ctx context.Context, kv ...string) context.Context {
+	parent, ok := ctx.Value(ctxKey{}).(*scoped)
+	if !ok {
+		parent = &scoped{logger: base}
+	}
+
+	child := &scoped{fields: make(map[string]bool, len(parent.fields)+len(kv)/2)}
+	for k := range parent.fields {
+		child.fields[k] = true
+	}
+	c := parent.logger.With()
+	added, debug := false, false
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" || child.fields[kv[i]] {
+			continue
+		}
+		c = c.Str(kv[i], kv[i+1])
+		child.fields[kv[i]] = true
+		added = true
+		debug = debug || (kv[i] == "project" && debugProjects[kv[i+1]])
+	}
+	if !added {
+		return ctx
+	}
+	child.logger = c.Logger()
+	if debug {
+		child.logger = child.logger.Sample(nil)
+		if child.logger.GetLevel() > zerolog.DebugLevel {
+			child.logger = child.logger.Level(zerolog.DebugLevel)
+		}
+	}
+	return context.WithValue(ctx, ctxKey{}, child)
 }
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != &base {
+		t.Error("FromContext without a logger should return the process logger")
+	}
+
+	var buf bytes.Buffer
+	ctx := WithContext(context.Background(), zerolog.New(&buf))
+	FromContext(ctx).Info().Msg("captured")
+	if !strings.Contains(buf.String(), "captured") {
+		t.Errorf("log = %q, want the line written to the context's logger", buf.String())
+	}
+}
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithContext(context.Background(), zerolog.New(&buf))
+
+	ctx = With(ctx, "requestId", "req-1", "project", "")
+	ctx = With(ctx, "project", "myapp", "requestId", "other")
+	ctx = With(ctx, "project", "second")
+	FromContext(ctx).Info().Msg("done")
+
+	// Repeated keys would appear twice in the raw line
+	if n := strings.Count(buf.String(), `"project"`); n != 1 {
+		t.Fatalf("log = %q, want project once", buf.String())
+	}
+	var line map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["requestId"] != "req-1" || line["project"] != "myapp" {
+		t.Errorf("fields = %v, want the first non-empty values", line)
+	}
+
+	if got := With(ctx, "project", "myapp"); got != ctx {
+		t.Error("With adding nothing should return ctx unchanged")
+	}
+}
+
+func TestInit_InvalidOptions(t *testing.T) {
+	if err := Init(Options{Stage: "prod", Level: "warn", Format: "json"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if base.GetLevel() != zerolog.WarnLevel {
+		t.Errorf("level = %v, want warn", base.GetLevel())
+	}
+
+	err := Init(Options{Stage: "prod", Level: "loud", Format: "xml"})
+	if err == nil || !strings.Contains(err.Error(), "loud") || !strings.Contains(err.Error(), "xml") {
+		t.Errorf("Init() error = %v, want both options reported", err)
+	}
+	if base.GetLevel() != zerolog.InfoLevel {
+		t.Errorf("level = %v, want the info default", base.GetLevel())
+	}
+	base = zerolog.Logger{}
+}
+
+func TestWith_DebugProjects(t *testing.T) {
+	debugProjects = map[string]bool{"noisy": true}
+	defer func() { debugProjects = nil }()
+
+	var buf bytes.Buffer
+	ctx := WithContext(context.Background(), zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	FromContext(With(ctx, "project", "quiet")).Debug().Msg("quiet debug")
+	FromContext(With(ctx, "project", "noisy")).Debug().Msg("noisy debug")
+
+	if strings.Contains(buf.String(), "quiet debug") {
+		t.Error("debug line of an unlisted project was logged")
+	}
+	if !strings.Contains(buf.String(), "noisy debug") {
+		t.Error("debug line of a listed project was dropped")
+	}
+}
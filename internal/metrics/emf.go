@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// emfMetric names a metric inside an EMF document
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit,omitempty"`
+}
+
+// emfDirective tells CloudWatch which fields of the document are metrics
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// WriteEMF writes one CloudWatch Embedded Metric Format document per series that
+// changed since the last call and resets those changes. Lambda ships stdout to
+// CloudWatch Logs, which extracts the metrics without any API calls.
+func (r *Registry) WriteEMF(w io.Writer, namespace string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	emit := func(name, unit string, labels, values []string, value interface{}) error {
+		doc := map[string]interface{}{
+			"_aws": emfMetadata{
+				Timestamp: now.UnixMilli(),
+				CloudWatchMetrics: []emfDirective{{
+					Namespace:  namespace,
+					Dimensions: [][]string{append([]string{}, labels...)},
+					Metrics:    []emfMetric{{Name: name, Unit: unit}},
+				}},
+			},
+			name: value,
+		}
+		for i, l := range labels {
+			doc[l] = values[i]
+		}
+		return enc.Encode(doc)
+	}
+
+	for _, c := range r.counters {
+		for _, s := range sortedSeries(c.series) {
+			if s.delta == 0 {
+				continue
+			}
+			if err := emit(c.name, "Count", c.labels, s.labels, s.delta); err != nil {
+				return err
+			}
+			s.delta = 0
+		}
+	}
+	for _, g := range r.gauges {
+		for _, s := range sortedSeries(g.series) {
+			if !s.changed {
+				continue
+			}
+			if err := emit(g.name, "None", g.labels, s.labels, s.value); err != nil {
+				return err
+			}
+			s.changed = false
+		}
+	}
+	for _, h := range r.histograms {
+		for _, s := range sortedSeries(h.series) {
+			if len(s.pending) == 0 {
+				continue
+			}
+			if err := emit(h.name, h.emfUnit, h.labels, s.labels, s.pending); err != nil {
+				return err
+			}
+			s.pending = nil
+		}
+	}
+	return nil
+}
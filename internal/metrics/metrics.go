@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// Namespace is the CloudWatch namespace used for EMF output
+const Namespace = "FailureUploader"
+
+// Default is the registry the service records its metrics in
+var Default = NewRegistry()
+
+// Upload funnel metrics
+var (
+	TicketsIssued = Default.NewCounter("failure_uploader_tickets_issued_total",
+		"Upload tickets issued.", "project")
+	UploadsCompleted = Default.NewCounter("failure_uploader_uploads_completed_total",
+		"Uploads completed successfully.", "project")
+	VerificationFailures = Default.NewCounter("failure_uploader_verification_failures_total",
+		"Upload completions rejected during verification.", "project", "reason")
+	CompletionReplays = Default.NewCounter("failure_uploader_completion_replays_total",
+		"Upload-complete retries answered with the stored response.", "project")
+	VerificationRetries = Default.NewCounter("failure_uploader_verification_retries_total",
+		"Verifications that re-checked missing objects, by whether they turned up.", "project", "outcome")
+	VerificationsQueued = Default.NewCounter("failure_uploader_verifications_queued_total",
+		"Upload completions accepted as pending and queued for verification.", "project")
+	AutoCompletions = Default.NewCounter("failure_uploader_auto_completions_total",
+		"Completions queued by the auto-completion worker, by whether all uploads arrived or the ticket timed out.", "project", "trigger")
+	PresignDuration = Default.NewHistogram("failure_uploader_presign_duration_seconds",
+		"Time to presign an S3 URL.", "Seconds",
+		[]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}, "operation")
+	EmailFailures = Default.NewCounter("failure_uploader_email_failures_total",
+		"Emails that could not be sent.", "kind")
+	ContentMismatches = Default.NewCounter("failure_uploader_content_mismatches_total",
+		"Artifacts whose content does not match the declared type.", "project")
+)
+
+// Routed notification metrics, by channel (email, slack, webhook, teams, sns, github, pagerduty)
+var (
+	NotificationsSent = Default.NewCounter("failure_uploader_notifications_sent_total",
+		"Failure notifications delivered to a routed destination.", "channel")
+	NotificationFailures = Default.NewCounter("failure_uploader_notification_failures_total",
+		"Failure notifications that could not be delivered to a routed destination.", "channel")
+)
+
+// Notification queue metrics, by project
+var (
+	NotificationsQueued = Default.NewCounter("failure_uploader_notifications_queued_total",
+		"Failure notifications enqueued for asynchronous delivery.", "project")
+	QueuedDeliveryFailures = Default.NewCounter("failure_uploader_queued_delivery_failures_total",
+		"Queued failure notifications whose delivery failed and will be retried.", "project")
+)
+
+// Email feedback metrics from SES bounce and complaint events
+var (
+	SESEvents = Default.NewCounter("failure_uploader_ses_events_total",
+		"SES delivery events received.", "type")
+	EmailsSuppressed = Default.NewCounter("failure_uploader_emails_suppressed_total",
+		"Emails not sent because the recipient hard-bounced or complained.", "kind")
+)
+
+// Ticket reaper metrics; the abandonment rate is expired / all reaped tickets
+var (
+	TicketsReaped = Default.NewCounter("failure_uploader_tickets_reaped_total",
+		"Tickets settled by the reaper, by final state.", "project", "state")
+	ReapedObjects = Default.NewCounter("failure_uploader_reaped_objects_total",
+		"Partial uploads deleted from abandoned tickets.", "project")
+)
+
+// Daily quota metrics
+var (
+	QuotaRejections = Default.NewCounter("failure_uploader_quota_rejections_total",
+		"Upload tickets rejected by a daily quota.", "project")
+	QuotaAlerts = Default.NewCounter("failure_uploader_quota_alerts_total",
+		"Projects that reached the alert threshold of a daily quota.", "project")
+)
+
+// Malware scan metrics
+var (
+	ScanVerdicts = Default.NewCounter("failure_uploader_scan_verdicts_total",
+		"Malware scan verdicts applied to uploaded objects, by verdict.", "project", "verdict")
+	ObjectsQuarantined = Default.NewCounter("failure_uploader_objects_quarantined_total",
+		"Infected objects moved to quarantine.", "project")
+)
+
+// Thumbnail metrics, by outcome (generated, failed)
+var (
+	Thumbnails = Default.NewCounter("failure_uploader_thumbnails_total",
+		"Thumbnails generated for image attachments, by outcome.", "project", "outcome")
+)
+
+// Storage budget metrics
+var (
+	BudgetRejections = Default.NewCounter("failure_uploader_budget_rejections_total",
+		"Upload tickets refused because the project reached its storage budget.", "project")
+)
+
+// Replay metrics, by outcome (resolved, failed, error, dry_run)
+var (
+	Replays = Default.NewCounter("failure_uploader_replays_total",
+		"Captured requests replayed against a target.", "project", "outcome")
+)
+
+// AWS call policy metrics, by dependency (s3, ses). The breaker state is 0
+// when closed, 1 when half-open and 2 when open.
+var (
+	BreakerState = Default.NewGauge("failure_uploader_breaker_state",
+		"Circuit breaker state: 0 closed, 1 half-open, 2 open.", "dependency")
+	BreakerRejections = Default.NewCounter("failure_uploader_breaker_rejections_total",
+		"AWS calls failed fast because the circuit breaker was open.", "dependency")
+	AWSCallTimeouts = Default.NewCounter("failure_uploader_aws_call_timeouts_total",
+		"AWS calls that exceeded their timeout.", "dependency")
+)
+
+// Since returns the seconds elapsed since start, for histogram observations
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler serves the default registry in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WritePrometheus(w)
+	})
+}
+
+// FlushEMF writes the default registry's changes since the last flush to stdout
+// in CloudWatch Embedded Metric Format
+func FlushEMF() error {
+	return Default.WriteEMF(os.Stdout, Namespace, time.Now())
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("tickets_total", "Tickets.", "project")
+	h := r.NewHistogram("latency_seconds", "Latency.", "Seconds", []float64{0.5, 0.1})
+	g := r.NewGauge("breaker_state", "Breaker state.", "dependency")
+
+	g.Set(2, "s3")
+	g.Set(1, "s3")
+	c.Inc("myapp")
+	c.Inc("myapp")
+	c.Add(3, "checkout")
+	h.Observe(0.05)
+	h.Observe(0.3)
+	h.Observe(2)
+
+	var b bytes.Buffer
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE tickets_total counter\n",
+		`tickets_total{project="checkout"} 3` + "\n",
+		`tickets_total{project="myapp"} 2` + "\n",
+		"# TYPE breaker_state gauge\n",
+		`breaker_state{dependency="s3"} 1` + "\n",
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{le="0.5"} 2` + "\n",
+		`latency_seconds_bucket{le="+Inf"} 3` + "\n",
+		"latency_seconds_sum 2.35\n",
+		"latency_seconds_count 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteEMF(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("failures_total", "Failures.", "project", "reason")
+	h := r.NewHistogram("latency_seconds", "Latency.", "Seconds", []float64{1})
+	r.NewCounter("unused_total", "Never incremented.")
+
+	c.Inc("myapp", "missing_objects")
+	c.Inc("myapp", "missing_objects")
+	h.Observe(0.2)
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	if err := r.WriteEMF(&b, "Test", now); err != nil {
+		t.Fatalf("WriteEMF() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d documents, want 2:\n%s", len(lines), b.String())
+	}
+
+	var doc struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		Failures float64 `json:"failures_total"`
+		Project  string  `json:"project"`
+		Reason   string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &doc); err != nil {
+		t.Fatalf("invalid EMF document: %v", err)
+	}
+	cw := doc.AWS.CloudWatchMetrics[0]
+	if doc.AWS.Timestamp != now.UnixMilli() || cw.Namespace != "Test" || cw.Metrics[0].Unit != "Count" {
+		t.Errorf("metadata = %+v", doc.AWS)
+	}
+	if len(cw.Dimensions[0]) != 2 || doc.Failures != 2 || doc.Project != "myapp" || doc.Reason != "missing_objects" {
+		t.Errorf("document = %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"latency_seconds":[0.2]`) {
+		t.Errorf("histogram document = %s", lines[1])
+	}
+
+	// Flushed changes are not emitted again
+	b.Reset()
+	r.WriteEMF(&b, "Test", now)
+	if b.Len() != 0 {
+		t.Errorf("second flush wrote %q, want nothing", b.String())
+	}
+}
+
+func TestWriteEMF_Gauge(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("breaker_state", "Breaker state.", "dependency")
+	g.Set(2, "s3")
+
+	var b bytes.Buffer
+	r.WriteEMF(&b, "Test", time.Now())
+	if !strings.Contains(b.String(), `"breaker_state":2`) || !strings.Contains(b.String(), `"dependency":"s3"`) {
+		t.Errorf("gauge document = %s", b.String())
+	}
+
+	// An unchanged gauge is not emitted again
+	b.Reset()
+	r.WriteEMF(&b, "Test", time.Now())
+	if b.Len() != 0 {
+		t.Errorf("second flush wrote %q, want nothing", b.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	TicketsIssued.Inc("handler-test")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `failure_uploader_tickets_issued_total{project="handler-test"} 1`) {
+		t.Errorf("body missing ticket counter:\n%s", rec.Body.String())
+	}
+}
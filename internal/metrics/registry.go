@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxPending caps the observations kept per series between EMF flushes,
+// matching the 100 values CloudWatch accepts per metric in one document
+const maxPending = 100
+
+// Registry holds a set of metrics and renders them for Prometheus or CloudWatch
+type Registry struct {
+	mu         sync.Mutex
+	counters   []*Counter
+	gauges     []*Gauge
+	histograms []*Histogram
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// series is the state of one label combination of a metric
+type series struct {
+	labels []string
+
+	// Counter value, or histogram count and sum
+	value float64
+	sum   float64
+	// Cumulative counts per histogram bucket
+	buckets []uint64
+
+	// Counter increase and histogram values since the last EMF flush
+	delta   float64
+	pending []float64
+	// Gauge set since the last EMF flush
+	changed bool
+}
+
+// Counter is a monotonically increasing value per label combination
+type Counter struct {
+	reg    *Registry
+	name   string
+	help   string
+	labels []string
+	series map[string]*series
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{reg: r, name: name, help: help, labels: labels, series: make(map[string]*series)}
+	r.mu.Lock()
+	r.counters = append(r.counters, c)
+	r.mu.Unlock()
+	return c
+}
+
+// Inc adds one to the series for labelValues
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the series for labelValues
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.reg.mu.Lock()
+	defer c.reg.mu.Unlock()
+	s := lookup(c.series, c.labels, labelValues, 0)
+	s.value += v
+	s.delta += v
+}
+
+// Gauge is a value that can go up and down per label combination
+type Gauge struct {
+	reg    *Registry
+	name   string
+	help   string
+	labels []string
+	series map[string]*series
+}
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{reg: r, name: name, help: help, labels: labels, series: make(map[string]*series)}
+	r.mu.Lock()
+	r.gauges = append(r.gauges, g)
+	r.mu.Unlock()
+	return g
+}
+
+// Set sets the series for labelValues to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.reg.mu.Lock()
+	defer g.reg.mu.Unlock()
+	s := lookup(g.series, g.labels, labelValues, 0)
+	s.value = v
+	s.changed = true
+}
+
+// Histogram counts observations into cumulative buckets per label combination
+type Histogram struct {
+	reg     *Registry
+	name    string
+	help    string
+	labels  []string
+	bounds  []float64
+	series  map[string]*series
+	emfUnit string
+}
+
+// NewHistogram registers a histogram with upper bucket bounds and label names.
+// unit is the CloudWatch unit used for EMF output, e.g. "Seconds".
+func (r *Registry) NewHistogram(name, help, unit string, bounds []float64, labels ...string) *Histogram {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	h := &Histogram{reg: r, name: name, help: help, labels: labels, bounds: sorted, series: make(map[string]*series), emfUnit: unit}
+	r.mu.Lock()
+	r.histograms = append(r.histograms, h)
+	r.mu.Unlock()
+	return h
+}
+
+// Observe records v in the series for labelValues
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.reg.mu.Lock()
+	defer h.reg.mu.Unlock()
+	s := lookup(h.series, h.labels, labelValues, len(h.bounds))
+	s.value++
+	s.sum += v
+	for i, b := range h.bounds {
+		if v <= b {
+			s.buckets[i]++
+		}
+	}
+	s.pending = appendPending(s.pending, v)
+}
+
+// lookup returns the series for labelValues, creating it if needed. Missing
+// values are treated as empty and extra values are ignored.
+func lookup(m map[string]*series, names, values []string, buckets int) *series {
+	vals := make([]string, len(names))
+	copy(vals, values)
+	key := strings.Join(vals, "\xff")
+	s, ok := m[key]
+	if !ok {
+		s = &series{labels: vals, buckets: make([]uint64, buckets)}
+		m[key] = s
+	}
+	return s
+}
+
+func appendPending(p []float64, v float64) []float64 {
+	if len(p) >= maxPending {
+		return p
+	}
+	return append(p, v)
+}
+
+// sortedSeries returns the series of m ordered by label values
+func sortedSeries(m map[string]*series) []*series {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, m[k])
+	}
+	return out
+}
+
+// WritePrometheus renders all metrics in the Prometheus text exposition format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for _, c := range r.counters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, s := range sortedSeries(c.series) {
+			fmt.Fprintf(&b, "%s%s %s\n", c.name, labelString(c.labels, s.labels, "", ""), formatFloat(s.value))
+		}
+	}
+	for _, g := range r.gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, s := range sortedSeries(g.series) {
+			fmt.Fprintf(&b, "%s%s %s\n", g.name, labelString(g.labels, s.labels, "", ""), formatFloat(s.value))
+		}
+	}
+	for _, h := range r.histograms {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		for _, s := range sortedSeries(h.series) {
+			for i, bound := range h.bounds {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labels, "le", formatFloat(bound)), s.buckets[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %s\n", h.name, labelString(h.labels, s.labels, "le", "+Inf"), formatFloat(s.value))
+			fmt.Fprintf(&b, "%s_sum%s %s\n", h.name, labelString(h.labels, s.labels, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %s\n", h.name, labelString(h.labels, s.labels, "", ""), formatFloat(s.value))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelString renders {name="value",...}, optionally with an extra label
+func labelString(names, values []string, extraName, extraValue string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, n+"="+strconv.Quote(values[i]))
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+"="+strconv.Quote(extraValue))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/yourorg/failure-uploader/internal/audit"
+	"github.com/yourorg/failure-uploader/internal/signing"
+	"github.com/yourorg/failure-uploader/internal/usage"
+)
+
+// Audit creates middleware that carries rec through the request for handlers
+// to record their actions, records responses rejected with 401 or 403, and
+// adds the request to its principal's usage. It must run before
+// authentication so that rejected requests are seen.
+func Audit(rec *audit.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rec == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := audit.WithRecorder(r.Context(), rec)
+			body := &countingBody{ReadCloser: r.Body}
+			r.Body = body
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status == http.StatusUnauthorized || status == http.StatusForbidden {
+				rec.Record(ctx, audit.Event{
+					Action:   audit.ActionAuthDenied,
+					Outcome:  audit.OutcomeDenied,
+					SourceIP: ClientIP(r),
+					Method:   r.Method,
+					Path:     r.URL.Path,
+					Status:   status,
+					Details:  map[string]string{"credential": credentialKind(r)},
+				})
+			}
+			principal, tenant := audit.Principal(ctx)
+			rec.AddUsage(principal, tenant, usage.Request(status, body.n, int64(ww.BytesWritten())))
+		})
+	}
+}
+
+// credentialKind names the credential a request presented, never its value
+func credentialKind(r *http.Request) string {
+	switch {
+	case r.Header.Get(AdminKeyHeader) != "":
+		return "admin-key"
+	case signing.Signed(r):
+		return "signature"
+	case bearerToken(r) != "":
+		return "bearer"
+	case r.Header.Get(APIKeyHeader) != "":
+		return "api-key"
+	default:
+		return "none"
+	}
+}
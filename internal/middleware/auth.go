@@ -1,15 +1,37 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/audit"
 	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/validation"
 )
 
 const APIKeyHeader = "X-Api-Key"
 
-// APIKeyAuth creates middleware that validates API key from header
-func APIKeyAuth(apiKey string, enabled bool) func(http.Handler) http.Handler {
+// AdminKeyHeader carries the credential of the admin API
+const AdminKeyHeader = "X-Admin-Key"
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// Principal is an authenticated caller, either an API key or verified token claims
+type Principal interface {
+	Identity() string
+	AllowsProject(project string) bool
+	HasScope(scope apikeys.Scope) bool
+	// TenantID is the org the caller belongs to, empty when it has none
+	TenantID() string
+}
+
+// APIKeyAuth creates middleware that validates API key from header against the
+// registry. Keys are compared by hash in constant time (see Registry.Lookup).
+func APIKeyAuth(registry *apikeys.Registry, enabled bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip auth if disabled
@@ -18,66 +40,155 @@ func APIKeyAuth(apiKey string, enabled bool) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Get API key from header
-			providedKey := r.Header.Get(APIKeyHeader)
-			if providedKey == "" {
-				logging.Warn().
+			key, ok := authenticateAPIKey(w, r, registry)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), key)))
+		})
+	}
+}
+
+// authenticateAPIKey validates the X-Api-Key header, writing a 401 on failure
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, registry *apikeys.Registry) (*apikeys.Key, bool) {
+	// Get API key from header
+	providedKey := r.Header.Get(APIKeyHeader)
+	if providedKey == "" {
+		logging.FromContext(r.Context()).Warn().
+			Str("path", r.URL.Path).
+			Str("method", r.Method).
+			Msg("missing API key")
+		apierror.Write(w, r, apierror.Unauthorized("Missing API key"))
+		return nil, false
+	}
+
+	// Validate API key
+	key, ok := registry.Lookup(providedKey)
+	if !ok {
+		logging.FromContext(r.Context()).Warn().
+			Str("path", r.URL.Path).
+			Str("method", r.Method).
+			Msg("invalid API key")
+		apierror.Write(w, r, apierror.Unauthorized("Invalid API key"))
+		return nil, false
+	}
+
+	return key, true
+}
+
+// AdminAuth creates middleware that validates the X-Admin-Key header against
+// the admin registry. Client API keys and bearer tokens are never accepted,
+// and unlike APIKeyAuth it cannot be disabled.
+func AdminAuth(registry *apikeys.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.Header.Get(AdminKeyHeader)
+			key, ok := registry.Lookup(provided)
+			if provided == "" || !ok {
+				logging.FromContext(r.Context()).Warn().
 					Str("path", r.URL.Path).
 					Str("method", r.Method).
-					Msg("missing API key")
-				http.Error(w, `{"error":"Missing API key","code":"unauthorized"}`, http.StatusUnauthorized)
+					Bool("present", provided != "").
+					Msg("invalid admin key")
+				apierror.Write(w, r, apierror.Unauthorized("Missing or invalid admin key"))
 				return
 			}
 
-			// Validate API key
-			if providedKey != apiKey {
-				logging.Warn().
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), key)))
+		})
+	}
+}
+
+// RequireScope rejects requests whose principal lacks the given scope.
+// Requests without a principal in context (auth disabled) are allowed through,
+// except to admin routes, which always need a credential with the admin scope.
+func RequireScope(scope apikeys.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := PrincipalFromContext(r.Context())
+			if p == nil && scope == apikeys.ScopeAdmin {
+				logging.FromContext(r.Context()).Warn().
 					Str("path", r.URL.Path).
 					Str("method", r.Method).
-					Msg("invalid API key")
-				http.Error(w, `{"error":"Invalid API key","code":"unauthorized"}`, http.StatusUnauthorized)
+					Msg("admin route without credentials")
+				apierror.Write(w, r, apierror.Unauthorized("Admin scope requires an authenticated API key"))
+				return
+			}
+			if p != nil && !p.HasScope(scope) {
+				logging.FromContext(r.Context()).Warn().
+					Str("path", r.URL.Path).
+					Str("method", r.Method).
+					Str("scope", string(scope)).
+					Msg("principal missing scope")
+				apierror.Write(w, r, apierror.Forbidden("Not authorized for this operation"))
 				return
 			}
-
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// RequestLogger logs incoming requests
-func RequestLogger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logging.Info().
-			Str("method", r.Method).
-			Str("path", r.URL.Path).
-			Str("remote", r.RemoteAddr).
-			Str("userAgent", r.UserAgent()).
-			Msg("incoming request")
+// WithPrincipal returns a copy of ctx carrying the authenticated principal,
+// whose identity and tenant are added to the request's logger and audit records
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	audit.SetPrincipal(ctx, p.Identity(), p.TenantID())
+	ctx = logging.With(ctx, "principal", p.Identity(), "tenant", p.TenantID())
+	return context.WithValue(ctx, principalContextKey, p)
+}
 
-		next.ServeHTTP(w, r)
-	})
+// PrincipalFromContext returns the authenticated principal, or nil when auth is disabled
+func PrincipalFromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalContextKey).(Principal)
+	return p
 }
 
-// JSONContentType sets JSON content type for responses
-func JSONContentType(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
-	})
+// APIKeyFromContext returns the authenticated API key, or nil if the caller did not use one
+func APIKeyFromContext(ctx context.Context) *apikeys.Key {
+	key, _ := PrincipalFromContext(ctx).(*apikeys.Key)
+	return key
 }
 
-// CORS adds CORS headers for development
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Api-Key")
+// PrincipalID returns the identity of the authenticated principal, or an empty string
+func PrincipalID(ctx context.Context) string {
+	if p := PrincipalFromContext(ctx); p != nil {
+		return p.Identity()
+	}
+	return ""
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// PrincipalTenant returns the tenant of the authenticated principal, or an empty string
+func PrincipalTenant(ctx context.Context) string {
+	if p := PrincipalFromContext(ctx); p != nil {
+		return p.TenantID()
+	}
+	return ""
+}
+
+// RequireTenant rejects principals without a valid tenant, so that with
+// multi-tenancy on, every upload and read is scoped to one. Requests without
+// a principal (auth disabled) are allowed through.
+func RequireTenant(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := PrincipalFromContext(r.Context())
+			if enabled && p != nil && !validation.ValidTenant(p.TenantID()) {
+				logging.FromContext(r.Context()).Warn().
+					Str("path", r.URL.Path).
+					Str("method", r.Method).
+					Msg("principal has no valid tenant")
+				apierror.Write(w, r, apierror.Forbidden("Credentials are not assigned to a tenant"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
+// JSONContentType sets JSON content type for responses
+func JSONContentType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+)
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     apikeys.Scope
+		principal Principal
+		want      int
+	}{
+		{"granted", apikeys.ScopeFailureRead, &apikeys.Key{ID: "ops", Scopes: []apikeys.Scope{apikeys.ScopeFailureRead}}, http.StatusNoContent},
+		{"admin implies all", apikeys.ScopeFailureRead, &apikeys.Key{ID: "ops", Scopes: []apikeys.Scope{apikeys.ScopeAdmin}}, http.StatusNoContent},
+		{"missing scope", apikeys.ScopeAdmin, &apikeys.Key{ID: "ios", Scopes: []apikeys.Scope{apikeys.ScopeTicketCreate}}, http.StatusForbidden},
+		{"auth disabled", apikeys.ScopeFailureRead, nil, http.StatusNoContent},
+		// Admin routes fail closed when auth is disabled
+		{"auth disabled on an admin route", apikeys.ScopeAdmin, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/v1/failures/abc", nil)
+			if tt.principal != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			RequireScope(tt.scope)(okHandler).ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+)
+
+// BodyLimit caps request bodies at limit bytes. Requests declaring a larger
+// Content-Length are rejected with 413 before their body is read; bodies sent
+// without one fail with http.MaxBytesError once they exceed the limit.
+func BodyLimit(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				apierror.Write(w, r, apierror.TooLarge("Request body too large", limit))
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
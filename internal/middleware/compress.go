@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+)
+
+// compressibleTypes are the response content types worth compressing. They
+// include text artifacts streamed through the API; ranged requests of those are
+// never compressed, see Compress.
+var compressibleTypes = []string{
+	"application/json",
+	apierror.ContentType,
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// Compress gzips responses of clients that send Accept-Encoding: gzip at the
+// given level, 1 to 9; level 0 disables compression. Requests with a Range
+// header are served uncompressed, since byte ranges refer to the stored
+// representation.
+func Compress(level int) func(http.Handler) http.Handler {
+	if level <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	compress := chimiddleware.Compress(level, compressibleTypes...)
+	return func(next http.Handler) http.Handler {
+		compressed := compress(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ErrInvalidEncoding marks errors reading a request body whose compression
+// is corrupt, as opposed to the JSON within
+var ErrInvalidEncoding = errors.New("invalid content encoding")
+
+// inflater wraps the errors of a decompressing reader in ErrInvalidEncoding
+type inflater struct {
+	r io.Reader
+}
+
+func (i inflater) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", ErrInvalidEncoding, err)
+	}
+	return n, err
+}
+
+// Decompress transparently inflates request bodies sent with Content-Encoding:
+// gzip, capping them at limit bytes once decompressed so a small compressed
+// body cannot expand without bound. Other encodings are rejected with 415,
+// and bodies that are not valid gzip with 400 invalid_encoding; corruption
+// found while the handler reads the body fails its reads with
+// ErrInvalidEncoding.
+func Decompress(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+			default:
+				apierror.Write(w, r, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedEncoding, "Unsupported Content-Encoding").
+					WithDetail("request bodies may only be gzip compressed, got %q", enc))
+				return
+			}
+
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				apierror.Write(w, r, apierror.InvalidEncoding(err))
+				return
+			}
+			var body io.Reader = inflater{gz}
+			if limit > 0 {
+				body = http.MaxBytesReader(w, io.NopCloser(body), limit)
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{body, r.Body}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(w, r)
+		})
+	}
+}
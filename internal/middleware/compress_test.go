@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	var body []byte
+	var readErr error
+	handler := Decompress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, readErr = io.ReadAll(r.Body)
+	}))
+	serve := func(encoding string, b []byte) *httptest.ResponseRecorder {
+		body, readErr = nil, nil
+		req := httptest.NewRequest(http.MethodPost, "/v1/upload-ticket", bytes.NewReader(b))
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	problem := func(rec *httptest.ResponseRecorder) apierror.Problem {
+		var p apierror.Problem
+		_ = json.Unmarshal(rec.Body.Bytes(), &p)
+		return p
+	}
+
+	if rec := serve("gzip", gzipped(t, `{"ok":true}`)); rec.Code != http.StatusOK || string(body) != `{"ok":true}` || readErr != nil {
+		t.Errorf("gzip body = %q, %v (status %d), want it inflated", body, readErr, rec.Code)
+	}
+
+	rec := serve("gzip", []byte(`{"ok":true}`))
+	if p := problem(rec); rec.Code != http.StatusBadRequest || p.Code != apierror.CodeInvalidEncoding {
+		t.Errorf("plain body sent as gzip = %d %+v, want 400 invalid_encoding", rec.Code, p)
+	}
+
+	// Corruption past the header surfaces while the handler reads the body
+	corrupt := gzipped(t, `{"ok":true}`)
+	corrupt[len(corrupt)-5] ^= 0xff
+	serve("gzip", corrupt)
+	if !errors.Is(readErr, ErrInvalidEncoding) {
+		t.Errorf("read error = %v, want ErrInvalidEncoding", readErr)
+	}
+
+	rec = serve("br", []byte("x"))
+	if p := problem(rec); rec.Code != http.StatusUnsupportedMediaType || p.Code != apierror.CodeUnsupportedEncoding {
+		t.Errorf("brotli body = %d %+v, want 415 unsupported_encoding", rec.Code, p)
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy configures which browser origins may call the API
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins ("https://app.example.com"), wildcard
+	// subdomains ("https://*.example.com") or "*" for any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+	// AllowCredentials lets browsers send cookies and HTTP auth; it is never
+	// combined with "*"
+	AllowCredentials bool
+}
+
+// allows reports whether origin matches one of the allowed origins, and
+// whether it matched "*"
+func (p CORSPolicy) allows(origin string) (ok, wildcard bool) {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true, true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return true, false
+		}
+		// https://*.example.com matches https://app.example.com but not
+		// https://example.com
+		scheme, suffix, found := strings.Cut(allowed, "://*.")
+		if found && len(origin) > len(scheme)+3+len(suffix)+1 &&
+			strings.EqualFold(origin[:len(scheme)+3], scheme+"://") &&
+			strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(suffix)) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// CORS answers preflight requests and adds CORS headers for the origins p
+// allows, echoing the matching origin so credentialed requests work. Other
+// origins get no CORS headers, so browsers block them, and their preflights
+// 403; requests without an Origin header are not affected.
+func CORS(p CORSPolicy) func(http.Handler) http.Handler {
+	methods := strings.Join(p.AllowedMethods, ", ")
+	headers := strings.Join(p.AllowedHeaders, ", ")
+	exposed := strings.Join(p.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(p.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			w.Header().Add("Vary", "Origin")
+
+			ok, wildcard := p.allows(origin)
+			if origin == "" || !ok {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			if wildcard {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				if p.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if p.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/ipacl"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// TrustedProxies replaces the remote address of requests with the client
+// address the depth proxies in front of the service recorded in
+// X-Forwarded-For, so rate limits, audit records and IP filters see the
+// client rather than the load balancer. Depth 0 trusts no proxy.
+func TrustedProxies(depth int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if depth <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, port, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				peer, port = r.RemoteAddr, "0"
+			}
+			if ip := ipacl.ClientIP(peer, r.Header.Values("X-Forwarded-For"), depth); ip != peer {
+				r.RemoteAddr = net.JoinHostPort(ip, port)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPFilter rejects requests whose source address acl does not allow with
+// 403. A nil acl allows every request.
+func IPFilter(acl *ipacl.ACL) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if acl == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			if !acl.Allows(ip) {
+				logging.FromContext(r.Context()).Warn().
+					Str("sourceIp", ip).
+					Str("path", r.URL.Path).
+					Msg("source address not allowed")
+				apierror.Write(w, r, apierror.Forbidden("Source address not allowed"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
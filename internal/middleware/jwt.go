@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apigw"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/jwtauth"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/signing"
+)
+
+// Auth modes selectable via config
+const (
+	AuthModeAPIKey = "apikey"
+	AuthModeJWT    = "jwt"
+	AuthModeAny    = "any"
+	// AuthModeSignature accepts only HMAC-signed requests
+	AuthModeSignature = "hmac"
+	// AuthModeAuthorizer trusts claims validated by an API Gateway authorizer
+	AuthModeAuthorizer = "authorizer"
+)
+
+// Authenticators are the credential checks Authenticate chooses from; any may
+// be nil when its credential is not configured
+type Authenticators struct {
+	Registry   *apikeys.Registry
+	Verifier   *jwtauth.Verifier
+	Signatures *signing.Verifier
+	Authorizer *jwtauth.Authorizer
+}
+
+// BearerAuth creates middleware that validates Authorization: Bearer tokens
+func BearerAuth(verifier *jwtauth.Verifier, enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, ok := authenticateBearer(w, r, verifier)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), claims)))
+		})
+	}
+}
+
+// Authenticate selects the auth middleware for mode. In AuthModeAny a bearer
+// token is used when present and the API key header otherwise. When signing
+// keys are configured, requests carrying X-Signature are verified as signed
+// requests in every mode.
+func Authenticate(mode string, auth Authenticators, enabled bool) func(http.Handler) http.Handler {
+	if mode == AuthModeSignature {
+		return SignatureAuth(auth.Signatures, enabled)
+	}
+	unsigned := authenticateMode(mode, auth, enabled)
+	if auth.Signatures.Len() == 0 {
+		return unsigned
+	}
+	return func(next http.Handler) http.Handler {
+		signed := SignatureAuth(auth.Signatures, enabled)(next)
+		other := unsigned(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if signing.Signed(r) {
+				signed.ServeHTTP(w, r)
+				return
+			}
+			other.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticateMode returns the middleware for mode, ignoring signed requests
+func authenticateMode(mode string, auth Authenticators, enabled bool) func(http.Handler) http.Handler {
+	switch mode {
+	case AuthModeJWT:
+		return BearerAuth(auth.Verifier, enabled)
+	case AuthModeAuthorizer:
+		return AuthorizerAuth(auth.Authorizer, enabled)
+	case AuthModeAny:
+		return func(next http.Handler) http.Handler {
+			bearer := BearerAuth(auth.Verifier, enabled)(next)
+			apiKey := APIKeyAuth(auth.Registry, enabled)(next)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if auth.Verifier != nil && bearerToken(r) != "" {
+					bearer.ServeHTTP(w, r)
+					return
+				}
+				apiKey.ServeHTTP(w, r)
+			})
+		}
+	default:
+		return APIKeyAuth(auth.Registry, enabled)
+	}
+}
+
+// AuthorizerAuth creates middleware that trusts the claims an API Gateway JWT
+// or Lambda authorizer attached to the event. Requests that did not pass
+// through an authorizer (including every request outside Lambda) are rejected.
+func AuthorizerAuth(authorizer *jwtauth.Authorizer, enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			raw, ok := apigw.AuthorizerClaims(r.Context())
+			if !ok || authorizer == nil {
+				logging.FromContext(r.Context()).Warn().
+					Str("path", r.URL.Path).
+					Str("method", r.Method).
+					Msg("missing authorizer claims")
+				apierror.Write(w, r, apierror.Unauthorized("Missing authorizer claims"))
+				return
+			}
+			claims, err := authorizer.Claims(raw)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn().
+					Err(err).
+					Str("path", r.URL.Path).
+					Str("method", r.Method).
+					Msg("rejected authorizer claims")
+				apierror.Write(w, r, apierror.Unauthorized("Invalid authorizer claims"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), claims)))
+		})
+	}
+}
+
+// ClaimsFromContext returns verified token claims, or nil if the caller did not use a token
+func ClaimsFromContext(ctx context.Context) *jwtauth.Claims {
+	claims, _ := PrincipalFromContext(ctx).(*jwtauth.Claims)
+	return claims
+}
+
+func authenticateBearer(w http.ResponseWriter, r *http.Request, verifier *jwtauth.Verifier) (*jwtauth.Claims, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		logging.FromContext(r.Context()).Warn().
+			Str("path", r.URL.Path).
+			Str("method", r.Method).
+			Msg("missing bearer token")
+		apierror.Write(w, r, apierror.Unauthorized("Missing bearer token"))
+		return nil, false
+	}
+
+	claims, err := verifier.Verify(r.Context(), token)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn().
+			Err(err).
+			Str("path", r.URL.Path).
+			Str("method", r.Method).
+			Msg("invalid bearer token")
+		apierror.Write(w, r, apierror.Unauthorized("Invalid bearer token"))
+		return nil, false
+	}
+
+	return claims, true
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// RequestLogger logs each request as it arrives and again when it completes,
+// with the response status, duration, size and the matched route. Both lines
+// use the request's logger, so RequestID must run before it to tag them with
+// the request ID. 5xx responses are logged as errors and 4xx as warnings.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		log := logging.FromContext(r.Context())
+
+		log.Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("remote", r.RemoteAddr).
+			Str("userAgent", r.UserAgent()).
+			Msg("incoming request")
+
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// A panic is answered with a 500 by Recoverer further out
+			rec := recover()
+			if rec != nil {
+				status = http.StatusInternalServerError
+			}
+
+			var ev *zerolog.Event
+			switch {
+			case status >= 500:
+				ev = log.Error()
+			case status >= 400:
+				ev = log.Warn()
+			default:
+				ev = log.Info()
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				ev = ev.Str("route", rctx.RoutePattern())
+			}
+			if rec != nil {
+				ev = ev.Bool("panic", true)
+			}
+			ev.Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Int("status", status).
+				Int64("durationMs", time.Since(start).Milliseconds()).
+				Int("bytes", ww.BytesWritten()).
+				Msg("request completed")
+
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// completed serves a request through h wrapped in RequestLogger, logging into
+// a buffer, and returns the fields of its "request completed" line
+func completed(t *testing.T, h http.Handler) map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	r := httptest.NewRequest(http.MethodPost, "/v1/upload-ticket", nil)
+	r = r.WithContext(logging.WithContext(r.Context(), zerolog.New(&buf)))
+	RequestLogger(h).ServeHTTP(httptest.NewRecorder(), r)
+
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q: %v", scanner.Text(), err)
+		}
+		if line["message"] == "request completed" {
+			return line
+		}
+	}
+	t.Fatalf("no request completed line in:\n%s", buf.String())
+	return nil
+}
+
+func TestRequestLogger(t *testing.T) {
+	line := completed(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+
+	if line["status"] != float64(http.StatusCreated) || line["bytes"] != float64(len(`{"ok":true}`)) {
+		t.Errorf("status = %v, bytes = %v", line["status"], line["bytes"])
+	}
+	if d, _ := line["durationMs"].(float64); d < 10 {
+		t.Errorf("durationMs = %v, want at least 10", line["durationMs"])
+	}
+	if line["level"] != "info" || line["method"] != http.MethodPost || line["path"] != "/v1/upload-ticket" {
+		t.Errorf("line = %v", line)
+	}
+}
+
+func TestRequestLogger_UnwrittenResponse(t *testing.T) {
+	line := completed(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	if line["status"] != float64(http.StatusOK) || line["bytes"] != float64(0) {
+		t.Errorf("status = %v, bytes = %v, want an implicit 200", line["status"], line["bytes"])
+	}
+}
+
+func TestRequestLogger_Levels(t *testing.T) {
+	for status, level := range map[int]string{http.StatusNotFound: "warn", http.StatusBadGateway: "error"} {
+		line := completed(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		if line["level"] != level {
+			t.Errorf("%d logged at %v, want %s", status, line["level"], level)
+		}
+	}
+}
+
+func TestRequestLogger_Route(t *testing.T) {
+	var buf bytes.Buffer
+	router := chi.NewRouter()
+	router.Use(RequestLogger)
+	router.Post("/v1/{action}", func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest(http.MethodPost, "/v1/upload-ticket", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r.WithContext(logging.WithContext(r.Context(), zerolog.New(&buf))))
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"route":"/v1/{action}"`)) {
+		t.Errorf("log = %s, want the matched route", buf.String())
+	}
+}
+
+func TestRequestLogger_Panic(t *testing.T) {
+	var buf bytes.Buffer
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(logging.WithContext(r.Context(), zerolog.New(&buf)))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was not re-raised for Recoverer")
+			}
+		}()
+		RequestLogger(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})).ServeHTTP(httptest.NewRecorder(), r)
+	}()
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"panic":true`)) || !bytes.Contains(buf.Bytes(), []byte(`"status":500`)) {
+		t.Errorf("log = %s, want a 500 marked as a panic", buf.String())
+	}
+}
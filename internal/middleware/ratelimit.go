@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/priority"
+	"github.com/yourorg/failure-uploader/internal/ratelimit"
+)
+
+// RateLimit creates middleware that rejects requests with 429 once the bucket
+// selected by keyFunc is exhausted. Requests with an empty key are not limited.
+// Requests marked critical by principals granted apikeys.ScopeCritical draw
+// from a separate bucket so bulk captures cannot starve them; the header alone
+// grants no extra capacity. Limiter errors fail open so a backend outage does
+// not take the API down.
+func RateLimit(limiter ratelimit.Limiter, keyFunc func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if criticalLane(r) {
+				key += "#critical"
+			}
+
+			ok, retryAfter, err := limiter.Allow(r.Context(), key)
+			if err != nil {
+				logging.FromContext(r.Context()).Error().Err(err).Str("key", key).Msg("rate limiter unavailable")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !ok {
+				problem := apierror.RateLimited(retryAfter)
+				logging.FromContext(r.Context()).Warn().
+					Str("path", r.URL.Path).
+					Str("method", r.Method).
+					Str("key", key).
+					Int("retryAfter", problem.RetryAfterSeconds).
+					Msg("rate limit exceeded")
+				apierror.Write(w, r, problem)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// criticalLane reports whether r is marked critical by a principal allowed to
+// use the critical lane. Requests limited before authentication never are.
+func criticalLane(r *http.Request) bool {
+	if !priority.IsCritical(priority.FromRequest(r)) {
+		return false
+	}
+	p := PrincipalFromContext(r.Context())
+	return p != nil && p.HasScope(apikeys.ScopeCritical)
+}
+
+// ClientIPKey keys rate limits by the source IP of the request
+func ClientIPKey(r *http.Request) string {
+	host := ClientIP(r)
+	if host == "" {
+		return ""
+	}
+	return "ip:" + host
+}
+
+// ClientIP returns the source IP of the request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// PrincipalKey keys rate limits by the authenticated API key or token subject
+func PrincipalKey(r *http.Request) string {
+	if id := PrincipalID(r.Context()); id != "" {
+		return "principal:" + id
+	}
+	return ""
+}
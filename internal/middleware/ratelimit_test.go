@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/priority"
+)
+
+// fakeLimiter allows keys until they are listed in denied, recording each key
+type fakeLimiter struct {
+	denied     map[string]bool
+	retryAfter time.Duration
+	err        error
+	keys       []string
+}
+
+func (l *fakeLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	l.keys = append(l.keys, key)
+	if l.err != nil {
+		return false, 0, l.err
+	}
+	if l.denied[key] {
+		return false, l.retryAfter, nil
+	}
+	return true, 0, nil
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+// serve runs r through RateLimit keyed by principal, as an authenticated
+// principal when p is set
+func serve(limiter *fakeLimiter, p Principal, r *http.Request) *httptest.ResponseRecorder {
+	if p != nil {
+		r = r.WithContext(WithPrincipal(r.Context(), p))
+	}
+	rec := httptest.NewRecorder()
+	RateLimit(limiter, PrincipalKey)(okHandler).ServeHTTP(rec, r)
+	return rec
+}
+
+func TestRateLimit_Rejects(t *testing.T) {
+	limiter := &fakeLimiter{denied: map[string]bool{"principal:ios": true}, retryAfter: 1500 * time.Millisecond}
+	rec := serve(limiter, &apikeys.Key{ID: "ios"}, httptest.NewRequest(http.MethodPost, "/v1/upload-ticket", nil))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	// Retry-After rounds the limiter's wait up to whole seconds
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+}
+
+func TestRateLimit_KeysByPrincipal(t *testing.T) {
+	limiter := &fakeLimiter{denied: map[string]bool{"principal:ios": true}}
+	if rec := serve(limiter, &apikeys.Key{ID: "android"}, httptest.NewRequest(http.MethodPost, "/", nil)); rec.Code != http.StatusNoContent {
+		t.Errorf("other principal status = %d, want 204", rec.Code)
+	}
+
+	// Unauthenticated requests have no principal key and are not limited
+	if rec := serve(limiter, nil, httptest.NewRequest(http.MethodPost, "/", nil)); rec.Code != http.StatusNoContent {
+		t.Errorf("anonymous status = %d, want 204", rec.Code)
+	}
+	if want := []string{"principal:android"}; !reflect.DeepEqual(limiter.keys, want) {
+		t.Errorf("limited keys = %v, want %v", limiter.keys, want)
+	}
+}
+
+func TestRateLimit_CriticalLane(t *testing.T) {
+	limiter := &fakeLimiter{denied: map[string]bool{"principal:ios": true, "principal:android": true}}
+	critical := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(priority.Header, "critical")
+		return r
+	}
+
+	if rec := serve(limiter, &apikeys.Key{ID: "ios", Scopes: []apikeys.Scope{apikeys.ScopeCritical}}, critical()); rec.Code != http.StatusNoContent {
+		t.Errorf("critical status = %d, want 204 from the critical bucket", rec.Code)
+	}
+	// The header alone does not move a request to the critical bucket
+	if rec := serve(limiter, &apikeys.Key{ID: "android"}, critical()); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("unscoped critical status = %d, want 429", rec.Code)
+	}
+	if want := []string{"principal:ios#critical", "principal:android"}; !reflect.DeepEqual(limiter.keys, want) {
+		t.Errorf("limited keys = %v, want %v", limiter.keys, want)
+	}
+}
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	limiter := &fakeLimiter{err: errors.New("dynamodb unavailable")}
+	if rec := serve(limiter, &apikeys.Key{ID: "ios"}, httptest.NewRequest(http.MethodPost, "/", nil)); rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204 while the limiter is down", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/requestid"
+	"github.com/yourorg/failure-uploader/internal/validation"
+)
+
+// RequestID assigns each request an ID, reusing a well-formed X-Request-Id from
+// the caller or API Gateway and generating one otherwise. The ID is echoed in
+// the X-Request-Id response header and AWS clients built with
+// requestid.APIOption pass it on to S3 and SES. It also seeds the request's
+// logger with the ID and with the project and env query parameters when they
+// are valid; authentication adds the principal.
+func RequestID(next http.Handler) http.Handler {
+	tag := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chimiddleware.GetReqID(r.Context())
+		w.Header().Set(requestid.Header, id)
+		ctx := logging.With(r.Context(), "requestId", id)
+		if project, env := r.URL.Query().Get("project"), r.URL.Query().Get("env"); len(validation.ValidateProjectEnv(project, env)) == 0 {
+			ctx = logging.With(ctx, "project", project, "env", env)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+	assign := chimiddleware.RequestID(tag)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Malformed IDs would be echoed into headers and logs; replace them
+		if id := r.Header.Get(requestid.Header); id != "" && !requestid.Valid(id) {
+			r.Header.Del(requestid.Header)
+		}
+		assign.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/signing"
+)
+
+// SignatureAuth creates middleware that verifies HMAC-signed requests
+// (X-Key-Id, X-Timestamp, X-Signature) against the signing keys
+func SignatureAuth(verifier *signing.Verifier, enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, ok := authenticateSignature(w, r, verifier)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), key)))
+		})
+	}
+}
+
+// authenticateSignature verifies the request signature, writing a 401 (or 413
+// for bodies too large to verify) on failure
+func authenticateSignature(w http.ResponseWriter, r *http.Request, verifier *signing.Verifier) (*apikeys.Key, bool) {
+	if verifier.Len() == 0 {
+		apierror.Write(w, r, apierror.Unauthorized("Signed requests are not configured"))
+		return nil, false
+	}
+
+	key, err := verifier.Verify(r)
+	if err == nil {
+		return key, true
+	}
+
+	logging.FromContext(r.Context()).Warn().
+		Err(err).
+		Str("path", r.URL.Path).
+		Str("method", r.Method).
+		Str("keyId", r.Header.Get(signing.HeaderKeyID)).
+		Msg("invalid request signature")
+
+	switch {
+	case errors.Is(err, signing.ErrBodyTooLarge):
+		apierror.Write(w, r, apierror.TooLarge("Request body too large to verify", verifier.MaxBodyBytes()))
+	case errors.Is(err, signing.ErrStale), errors.Is(err, signing.ErrTimestamp):
+		apierror.Write(w, r, apierror.Unauthorized("Stale request timestamp").
+			WithDetail("X-Timestamp must be Unix seconds within %s of the server clock", verifier.MaxSkew()))
+	case errors.Is(err, signing.ErrMissing):
+		apierror.Write(w, r, apierror.Unauthorized("Missing request signature"))
+	default:
+		apierror.Write(w, r, apierror.Unauthorized("Invalid request signature"))
+	}
+	return nil, false
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/usage"
+)
+
+// Usage records request counts, error responses and byte volumes per
+// authenticated principal. It must run after authentication; anonymous
+// requests are not recorded. Store errors are logged and never fail the request.
+func Usage(store usage.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := PrincipalID(r.Context())
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := &countingBody{ReadCloser: r.Body}
+			r.Body = body
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			c := usage.Request(status, body.n, int64(ww.BytesWritten()))
+			if err := store.Record(r.Context(), id, time.Now(), c); err != nil {
+				logging.FromContext(r.Context()).Warn().Err(err).Msg("failed to record usage")
+			}
+		})
+	}
+}
+
+// countingBody counts the request body bytes read by the handler
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
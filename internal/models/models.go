@@ -4,10 +4,57 @@ import "time"
 
 // UploadTicketRequest is the input for POST /v1/upload-ticket
 type UploadTicketRequest struct {
+	// SchemaVersion is the envelope schema version the client writes; 0 for
+	// clients predating versioning
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
 	Project string      `json:"project"`
 	Env     string      `json:"env"`
 	Request RequestInfo `json:"request"`
 	Client  ClientInfo  `json:"client"`
+	// Response describes how the request failed; clients should repeat it in envelope.json
+	Response *ResponseInfo `json:"response,omitempty"`
+	// Priority is "normal" (default) or "critical"
+	Priority string `json:"priority,omitempty"`
+	// Severity is info, warning, error or critical; clients should repeat it
+	// in envelope.json. Critical failures are treated like critical priority.
+	Severity string `json:"severity,omitempty"`
+	// Tags are free-form key/value labels for triage, e.g. {"team": "payments"};
+	// clients should repeat them in envelope.json
+	Tags map[string]string `json:"tags,omitempty"`
+	// Description is what the user reported, e.g. from a "report a problem" form
+	Description string `json:"description,omitempty"`
+	// Artifacts declares the dedicated artifact slots the client will upload
+	Artifacts *ArtifactsInfo `json:"artifacts,omitempty"`
+	// AllowPartial accepts a ticket whose uploads could only partly be
+	// presigned; the others are listed in the response's Failed and can be
+	// presigned again with POST /v1/upload-ticket/{failureId}/presign
+	AllowPartial bool `json:"allowPartial,omitempty"`
+}
+
+// ArtifactsInfo declares the diagnostic artifacts captured alongside the
+// request; each slot has its own key and size limit
+type ArtifactsInfo struct {
+	// Logs is the tail of the client's log, uploaded as logs.txt
+	Logs *ArtifactInfo `json:"logs,omitempty"`
+	// Screenshot is a PNG of the screen when the request failed, uploaded as screenshot.png
+	Screenshot *ArtifactInfo `json:"screenshot,omitempty"`
+	// Console is the captured console output, uploaded as console.json
+	Console *ArtifactInfo `json:"console,omitempty"`
+}
+
+// ArtifactInfo declares the size of an artifact slot upload
+type ArtifactInfo struct {
+	Bytes int64 `json:"bytes"`
+	// SHA256 is the hex digest of the artifact; S3 rejects an upload that differs
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ArtifactPresence reports which artifact slots of a failure were uploaded
+type ArtifactPresence struct {
+	Logs       bool `json:"logs"`
+	Screenshot bool `json:"screenshot"`
+	Console    bool `json:"console"`
 }
 
 type RequestInfo struct {
@@ -16,6 +63,14 @@ type RequestInfo struct {
 	ContentType string     `json:"contentType"`
 	BodyBytes   int64      `json:"bodyBytes"`
 	Files       []FileInfo `json:"files,omitempty"`
+	// SHA256 is the hex digest of the body; S3 rejects a request.raw upload that differs
+	SHA256 string `json:"sha256,omitempty"`
+	// TraceID and SpanID link the failure to an APM trace, as hex IDs like
+	// those of a W3C traceparent header; RequestID is the server's request ID,
+	// e.g. from X-Request-Id. All are optional.
+	TraceID   string `json:"traceId,omitempty"`
+	SpanID    string `json:"spanId,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 type FileInfo struct {
@@ -23,19 +78,30 @@ type FileInfo struct {
 	Filename    string `json:"filename"`
 	ContentType string `json:"contentType"`
 	Bytes       int64  `json:"bytes"`
+	// SHA256 is the hex digest of the file; S3 rejects an upload that differs
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 type ClientInfo struct {
 	AppVersion string `json:"appVersion"`
 	Platform   string `json:"platform"`
+	// UserID identifies the app user for erasure requests. It is hashed before
+	// being stored, so clients may send it raw.
+	UserID string `json:"userId,omitempty"`
 }
 
 // UploadTicketResponse is the output for POST /v1/upload-ticket
 type UploadTicketResponse struct {
+	// SchemaVersion is the envelope schema version the service writes
+	SchemaVersion int `json:"schemaVersion"`
+
 	FailureID        string     `json:"failureId"`
 	S3Prefix         string     `json:"s3Prefix"`
 	Uploads          UploadURLs `json:"uploads"`
 	ExpiresInSeconds int        `json:"expiresInSeconds"`
+	// Failed are the uploads of a partial ticket that could not be presigned;
+	// their entries in Uploads have a key but no putUrl
+	Failed []FailedUpload `json:"failed,omitempty"`
 }
 
 type UploadURLs struct {
@@ -45,41 +111,605 @@ type UploadURLs struct {
 	ResponseRaw    PresignedUpload   `json:"responseRaw"`
 	Files          []PresignedUpload `json:"files,omitempty"`
 	Checksums      PresignedUpload   `json:"checksums"`
+	// Logs, Screenshot and Console are only presigned when the ticket declared them
+	Logs       *PresignedUpload `json:"logs,omitempty"`
+	Screenshot *PresignedUpload `json:"screenshot,omitempty"`
+	Console    *PresignedUpload `json:"console,omitempty"`
 }
 
 type PresignedUpload struct {
 	Key    string `json:"key"`
 	PutURL string `json:"putUrl"`
+	// Headers are signed into PutURL and must be sent with the PUT, e.g. SSE-KMS
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// FailedUpload is an upload that could not be presigned
+type FailedUpload struct {
+	// Artifact is the upload's path below the failure prefix, e.g. "request.raw"
+	Artifact string `json:"artifact"`
+	Key      string `json:"key"`
+	Error    string `json:"error"`
+}
+
+// PresignRetryRequest is the input for POST /v1/upload-ticket/{failureId}/presign
+type PresignRetryRequest struct {
+	Project string `json:"project"`
+	Env     string `json:"env"`
+	// Artifacts are the paths below the failure prefix to presign again, as
+	// listed in the ticket's Failed
+	Artifacts []string `json:"artifacts"`
+}
+
+// PresignRetryResponse is the output for POST /v1/upload-ticket/{failureId}/presign
+type PresignRetryResponse struct {
+	FailureID        string            `json:"failureId"`
+	S3Prefix         string            `json:"s3Prefix"`
+	Uploads          []PresignedUpload `json:"uploads"`
+	Failed           []FailedUpload    `json:"failed,omitempty"`
+	ExpiresInSeconds int               `json:"expiresInSeconds"`
 }
 
 // UploadCompleteRequest is the input for POST /v1/upload-complete
 type UploadCompleteRequest struct {
+	// SchemaVersion is the envelope schema version of the uploaded envelope.json
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
 	FailureID    string            `json:"failureId"`
 	Project      string            `json:"project"`
 	Env          string            `json:"env"`
 	UploadedKeys []string          `json:"uploadedKeys"`
 	SHA256       map[string]string `json:"sha256,omitempty"`
+	// ServerChecksums asks the service to hash the uploaded objects and write checksums.json
+	ServerChecksums bool `json:"serverChecksums,omitempty"`
+	// Priority is "normal" (default) or "critical"; critical failures bypass
+	// digest batching and notification dedup
+	Priority string `json:"priority,omitempty"`
+	// Encryption declares that the artifacts were encrypted client-side
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// GenerateEnvelope asks the service to write envelope.json from the ticket
+	// instead of reading the one the client uploaded
+	GenerateEnvelope bool `json:"generateEnvelope,omitempty"`
+	// Response describes how the request failed, overriding the ticket's when
+	// the envelope is generated
+	Response *ResponseInfo `json:"response,omitempty"`
+}
+
+// Encryption describes how a client encrypted a failure's artifacts. The key
+// itself never reaches the service.
+type Encryption struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	// IV is the base64-encoded initialization vector or nonce
+	IV string `json:"iv"`
 }
 
+// Statuses of an upload completion
+const (
+	CompletionOK = "ok"
+	// CompletionPending means the completion was accepted and its uploads are
+	// verified out-of-band
+	CompletionPending = "pending"
+)
+
 // UploadCompleteResponse is the output for POST /v1/upload-complete
 type UploadCompleteResponse struct {
+	// SchemaVersion is the envelope schema version the service stored
+	SchemaVersion int `json:"schemaVersion"`
+
+	Status     string            `json:"status"`
+	Checksums  map[string]string `json:"checksums,omitempty"`
+	Encryption *Encryption       `json:"encryption,omitempty"`
+}
+
+// TicketResponse is the output for POST /v2/tickets
+type TicketResponse struct {
+	// SchemaVersion is the envelope schema version the service writes
+	SchemaVersion int `json:"schemaVersion"`
+
+	FailureID        string        `json:"failureId"`
+	S3Prefix         string        `json:"s3Prefix"`
+	Uploads          TicketUploads `json:"uploads"`
+	ExpiresInSeconds int           `json:"expiresInSeconds"`
+}
+
+// TicketUploads are the presigned POST uploads of a v2 ticket. There is no
+// envelope upload: the service generates it from the ticket on completion.
+type TicketUploads struct {
+	RequestRaw     PresignedPost   `json:"requestRaw"`
+	RequestHeaders PresignedPost   `json:"requestHeaders"`
+	ResponseRaw    PresignedPost   `json:"responseRaw"`
+	Files          []PresignedPost `json:"files,omitempty"`
+	// Logs, Screenshot and Console are only presigned when the ticket declared them
+	Logs       *PresignedPost `json:"logs,omitempty"`
+	Screenshot *PresignedPost `json:"screenshot,omitempty"`
+	Console    *PresignedPost `json:"console,omitempty"`
+}
+
+// PresignedPost is an upload as an HTML form: POST Fields, then the file as
+// the last part, as multipart/form-data to URL. S3 rejects files larger than
+// MaxBytes.
+type PresignedPost struct {
+	Key      string            `json:"key"`
+	URL      string            `json:"url"`
+	Fields   map[string]string `json:"fields"`
+	MaxBytes int64             `json:"maxBytes"`
+}
+
+// CompleteTicketRequest is the input for POST /v2/tickets/{failureId}/complete.
+// The project, env and uploads are read from the ticket.
+type CompleteTicketRequest struct {
+	// SchemaVersion is the envelope schema version the client expects
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// ServerChecksums asks the service to hash the uploaded objects and write checksums.json
+	ServerChecksums bool `json:"serverChecksums,omitempty"`
+	// Priority is "normal" (default) or "critical"
+	Priority string `json:"priority,omitempty"`
+	// Encryption declares that the artifacts were encrypted client-side
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// Response describes how the request failed, overriding the ticket's
+	Response *ResponseInfo `json:"response,omitempty"`
+}
+
+// ArtifactUploadResponse is the output for PUT /v1/failures/{failureId}/artifacts/{name}
+type ArtifactUploadResponse struct {
+	Key   string `json:"key"`
+	Bytes int64  `json:"bytes"`
+}
+
+// RestoreRequest is the input for POST /v1/failures/{failureId}/restore
+type RestoreRequest struct {
+	Project  string `json:"project"`
+	Env      string `json:"env"`
+	S3Prefix string `json:"s3Prefix"`
+}
+
+// RestoreResponse is the output for POST /v1/failures/{failureId}/restore
+type RestoreResponse struct {
+	Status  string `json:"status"`
+	Objects int    `json:"objects"`
+	Days    int    `json:"days"`
+}
+
+// ReleaseRequest is the input for POST /v1/failures/{failureId}/release
+type ReleaseRequest struct {
+	Project  string `json:"project"`
+	Env      string `json:"env"`
+	S3Prefix string `json:"s3Prefix"`
+}
+
+// ReleaseResponse is the output for POST /v1/failures/{failureId}/release
+type ReleaseResponse struct {
+	Status string `json:"status"`
+	// Artifacts are the released artifacts' paths below the failure prefix
+	Artifacts  []string  `json:"artifacts"`
+	ReleasedBy string    `json:"releasedBy"`
+	ReleasedAt time.Time `json:"releasedAt"`
+}
+
+// ReplayRequest is the input for POST /v1/failures/{failureId}/replay
+type ReplayRequest struct {
+	Project  string `json:"project"`
+	Env      string `json:"env"`
+	S3Prefix string `json:"s3Prefix"`
+	// BaseURL replaces the scheme and host of the captured URL, e.g. a staging server
+	BaseURL string `json:"baseUrl,omitempty"`
+	// Headers override captured headers; an empty value removes the header
+	Headers map[string]string `json:"headers,omitempty"`
+	// DryRun returns the request that would be sent without sending it
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// ReplayResponse is the output for POST /v1/failures/{failureId}/replay
+type ReplayResponse struct {
+	DryRun  bool            `json:"dryRun"`
+	Request ReplayedRequest `json:"request"`
+	// Response is omitted for dry runs
+	Response *ReplayResult `json:"response,omitempty"`
+}
+
+// ReplayedRequest is the request a replay sends, with sensitive headers redacted
+type ReplayedRequest struct {
+	Method    string              `json:"method"`
+	URL       string              `json:"url"`
+	Headers   map[string][]string `json:"headers"`
+	BodyBytes int                 `json:"bodyBytes"`
+}
+
+// ReplayResult summarizes the response to a replay
+type ReplayResult struct {
+	// StatusCode is 0 when no response was received; Error then says why
+	StatusCode int                 `json:"statusCode"`
+	Error      string              `json:"error,omitempty"`
+	DurationMs int64               `json:"durationMs"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	// Body is the redacted start of a text response body
+	Body      string `json:"body,omitempty"`
+	BodyBytes int    `json:"bodyBytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+	// OriginalStatusCode is the status the captured request failed with
+	OriginalStatusCode int `json:"originalStatusCode,omitempty"`
+	// Resolved reports whether the replay got a non-error (below 400) response
+	Resolved bool `json:"resolved"`
+}
+
+// FailureResponse is the output for GET /v1/failures/{failureId}
+type FailureResponse struct {
+	Envelope Envelope `json:"envelope"`
+	// Curl reproduces the request with sensitive headers redacted; empty for
+	// client-side encrypted failures
+	Curl string `json:"curl,omitempty"`
+	// ScanStatus is "pending" or "quarantined" while the malware scan
+	// withholds the failure's artifacts
+	ScanStatus string `json:"scanStatus,omitempty"`
+}
+
+// DeleteFailureResponse is the output for DELETE /v1/failures/{failureId}
+type DeleteFailureResponse struct {
+	Status    string    `json:"status"`
+	Objects   int       `json:"objects"`
+	Records   int       `json:"records"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// UserErasureRequest is the input for POST /v1/admin/erasure
+type UserErasureRequest struct {
+	UserID string `json:"userId"`
+}
+
+// UserErasureResponse is the output for POST /v1/admin/erasure
+type UserErasureResponse struct {
 	Status string `json:"status"`
+	// Failures lists the erased failure IDs
+	Failures []string `json:"failures"`
+	// Skipped lists failures in projects the caller may not access
+	Skipped   []string  `json:"skipped,omitempty"`
+	Objects   int       `json:"objects"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// AckRequest is the input for POST /v1/failures/{failureId}/ack
+type AckRequest struct {
+	Project string `json:"project"`
+}
+
+// AckResponse is the output for POST /v1/failures/{failureId}/ack
+type AckResponse struct {
+	FailureID string    `json:"failureId"`
+	AckedBy   string    `json:"ackedBy"`
+	AckedAt   time.Time `json:"ackedAt"`
+}
+
+// UsageCounts is an API key's traffic over a period
+type UsageCounts struct {
+	Requests     int64 `json:"requests"`
+	ClientErrors int64 `json:"clientErrors"`
+	ServerErrors int64 `json:"serverErrors"`
+	BytesIn      int64 `json:"bytesIn"`
+	BytesOut     int64 `json:"bytesOut"`
+}
+
+// UsageHour is an API key's traffic in one hour
+type UsageHour struct {
+	Hour time.Time `json:"hour"`
+	UsageCounts
+}
+
+// KeyUsageResponse is the output for GET /v1/admin/keys/{id}/usage
+type KeyUsageResponse struct {
+	KeyID     string      `json:"keyId"`
+	From      time.Time   `json:"from"`
+	To        time.Time   `json:"to"`
+	Totals    UsageCounts `json:"totals"`
+	ErrorRate float64     `json:"errorRate"`
+	Hourly    []UsageHour `json:"hourly"`
+}
+
+// AdminProject is a project with stored failures and the envs they were uploaded to
+type AdminProject struct {
+	Tenant  string   `json:"tenant,omitempty"`
+	Project string   `json:"project"`
+	Envs    []string `json:"envs"`
+}
+
+// AdminProjectsResponse is the output for GET /admin/projects
+type AdminProjectsResponse struct {
+	Projects []AdminProject `json:"projects"`
+}
+
+// ProjectLimits are a project's effective upload limits and validation rules
+type ProjectLimits struct {
+	MaxBodyBytes       int64    `json:"maxBodyBytes"`
+	MaxFileBytes       int64    `json:"maxFileBytes"`
+	MaxTotalBytes      int64    `json:"maxTotalBytes"`
+	MaxFiles           int      `json:"maxFiles"`
+	MaxLogsBytes       int64    `json:"maxLogsBytes"`
+	MaxScreenshotBytes int64    `json:"maxScreenshotBytes"`
+	MaxConsoleBytes    int64    `json:"maxConsoleBytes"`
+	DailyFailures      int64    `json:"dailyFailures"`
+	DailyBytes         int64    `json:"dailyBytes"`
+	StorageBudgetBytes int64    `json:"storageBudgetBytes"`
+	Platforms          []string `json:"platforms,omitempty"`
+	ContentTypes       []string `json:"contentTypes,omitempty"`
+	DeniedContentTypes []string `json:"deniedContentTypes,omitempty"`
+}
+
+// NotificationRoute lists the destinations notified about a project's failures
+type NotificationRoute struct {
+	Emails        []string `json:"emails,omitempty"`
+	SlackChannels []string `json:"slackChannels,omitempty"`
+	Webhooks      []string `json:"webhooks,omitempty"`
+	TeamsWebhooks []string `json:"teamsWebhooks,omitempty"`
+	SNSTopics     []string `json:"snsTopics,omitempty"`
+	GitHubRepos   []string `json:"githubRepos,omitempty"`
+	PagerDutyKeys []string `json:"pagerDutyKeys,omitempty"`
+}
+
+// ProjectConfigResponse is the output for GET /admin/projects/{project}
+type ProjectConfigResponse struct {
+	Tenant             string        `json:"tenant,omitempty"`
+	Project            string        `json:"project"`
+	Env                string        `json:"env,omitempty"`
+	Limits             ProjectLimits `json:"limits"`
+	RequiresEncryption bool          `json:"requiresEncryption"`
+	RetentionDays      int           `json:"retentionDays"`
+	RetentionAction    string        `json:"retentionAction"`
+	// NotificationRoute is unset when failures are emailed to SES_TO
+	NotificationRoute *NotificationRoute `json:"notificationRoute,omitempty"`
+}
+
+// PurgeResponse is the output for POST /admin/projects/{project}/purge
+type PurgeResponse struct {
+	Project    string    `json:"project"`
+	Purged     int       `json:"purged"`
+	Failed     int       `json:"failed"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Audit is the key of the run's audit record
+	Audit string `json:"audit"`
+}
+
+// StorageUsageResponse is the output for GET /admin/projects/{project}/storage
+type StorageUsageResponse struct {
+	Project     string `json:"project"`
+	StoredBytes int64  `json:"storedBytes"`
+	// BudgetBytes is the project's storage budget, 0 when unlimited
+	BudgetBytes int64 `json:"budgetBytes"`
+	// ExemptBytes is the largest upload still accepted over budget
+	ExemptBytes int64 `json:"exemptBytes"`
+	// Exceeded is set while larger uploads are refused
+	Exceeded bool `json:"exceeded"`
+}
+
+// APIKeyInfo describes an API key without its secret
+type APIKeyInfo struct {
+	ID       string   `json:"id"`
+	Projects []string `json:"projects"`
+	Scopes   []string `json:"scopes"`
+	Tenant   string   `json:"tenant,omitempty"`
+	// Managed keys were created through the admin API; others are set by API_KEYS
+	Managed   bool       `json:"managed"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	Disabled  bool       `json:"disabled,omitempty"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	// Secrets lists the validity of a managed key's current secrets
+	Secrets []APIKeySecret `json:"secrets,omitempty"`
+}
+
+// APIKeySecret is the validity window of one secret of a managed key
+type APIKeySecret struct {
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// APIKeysResponse is the output for GET /admin/keys
+type APIKeysResponse struct {
+	Keys []APIKeyInfo `json:"keys"`
+}
+
+// CreateAPIKeyRequest is the input for POST /admin/keys
+type CreateAPIKeyRequest struct {
+	ID       string   `json:"id"`
+	Projects []string `json:"projects"`
+	Scopes   []string `json:"scopes"`
+	Tenant   string   `json:"tenant,omitempty"`
+}
+
+// CreateAPIKeyResponse is the output for POST /admin/keys and
+// POST /admin/keys/{id}/rotate. Key is the new secret and is never returned again.
+type CreateAPIKeyResponse struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// RotateAPIKeyRequest is the input for POST /admin/keys/{id}/rotate
+type RotateAPIKeyRequest struct {
+	// OverlapSeconds is how long the current secrets keep working; 24 hours when unset
+	OverlapSeconds *int `json:"overlapSeconds,omitempty"`
+}
+
+// RoutesResponse is the output for GET /admin/routes
+type RoutesResponse struct {
+	Routes map[string]NotificationRoute `json:"routes"`
+}
+
+// ResponseInfo describes how the failed request ended
+type ResponseInfo struct {
+	// StatusCode is 0 when no response was received, e.g. on a timeout
+	StatusCode int    `json:"statusCode,omitempty"`
+	ErrorClass string `json:"errorClass,omitempty"`
+	// DurationMs is the time from sending the request until it failed
+	DurationMs int64 `json:"durationMs,omitempty"`
+	// ErrorMessage is the client-side error, e.g. "The request timed out."
+	ErrorMessage string `json:"errorMessage,omitempty"`
 }
 
 // Envelope is the metadata stored in envelope.json
 type Envelope struct {
-	FailureID string      `json:"failureId"`
-	Project   string      `json:"project"`
-	Env       string      `json:"env"`
-	Request   RequestInfo `json:"request"`
-	Client    ClientInfo  `json:"client"`
-	CreatedAt time.Time   `json:"createdAt"`
-	S3Prefix  string      `json:"s3Prefix"`
-}
-
-// ErrorResponse for API errors
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    string `json:"code,omitempty"`
-	Details string `json:"details,omitempty"`
+	// SchemaVersion is the version of the envelope's format. Envelopes written
+	// by clients predating versioning have none and are upgraded when read.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
+	FailureID string        `json:"failureId"`
+	Tenant    string        `json:"tenant,omitempty"`
+	Project   string        `json:"project"`
+	Env       string        `json:"env"`
+	Request   RequestInfo   `json:"request"`
+	Response  *ResponseInfo `json:"response,omitempty"`
+	Client    ClientInfo    `json:"client"`
+	CreatedAt time.Time     `json:"createdAt"`
+	S3Prefix  string        `json:"s3Prefix"`
+	GroupID   string        `json:"groupId,omitempty"`
+	// Severity is info, warning, error or critical, when the client declared one
+	Severity string `json:"severity,omitempty"`
+	// Tags and Description are the client's triage labels and the user's
+	// report, both optional
+	Tags        map[string]string `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
+	// Artifacts reports which artifact slots were uploaded; the service sets it
+	// on completion
+	Artifacts *ArtifactPresence `json:"artifacts,omitempty"`
+	// Encryption is set when the artifacts are only readable with the client's key
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// ContentMismatches lists artifacts whose bytes contradict their declared type
+	ContentMismatches []ContentMismatch `json:"contentMismatches,omitempty"`
+}
+
+// ContentMismatch flags an artifact whose magic bytes do not match its declared content type
+type ContentMismatch struct {
+	Artifact string `json:"artifact"`
+	Declared string `json:"declared"`
+	Detected string `json:"detected"`
+}
+
+// Group aggregates failures that share a fingerprint
+type Group struct {
+	ID            string    `json:"groupId"`
+	Tenant        string    `json:"tenant,omitempty"`
+	Project       string    `json:"project"`
+	Env           string    `json:"env"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	StatusCode    int       `json:"statusCode,omitempty"`
+	ErrorClass    string    `json:"errorClass,omitempty"`
+	Count         int       `json:"count"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+	LastFailureID string    `json:"lastFailureId"`
+}
+
+// FailureSummary is a failure as listed by GET /v1/failures
+type FailureSummary struct {
+	// SchemaVersion is the version of the stored envelope once upgraded
+	SchemaVersion int `json:"schemaVersion"`
+
+	FailureID  string    `json:"failureId"`
+	Project    string    `json:"project"`
+	Env        string    `json:"env"`
+	S3Prefix   string    `json:"s3Prefix"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	ErrorClass string    `json:"errorClass,omitempty"`
+	Severity   string    `json:"severity,omitempty"`
+	GroupID    string    `json:"groupId,omitempty"`
+	AppVersion string    `json:"appVersion,omitempty"`
+	Platform   string    `json:"platform,omitempty"`
+	Encrypted  bool      `json:"encrypted"`
+
+	Tags      map[string]string `json:"tags,omitempty"`
+	Artifacts *ArtifactPresence `json:"artifacts,omitempty"`
+	// Thumbnails preview the failure's image attachments when thumbnails are enabled
+	Thumbnails []Thumbnail `json:"thumbnails,omitempty"`
+
+	TraceID   string `json:"traceId,omitempty"`
+	SpanID    string `json:"spanId,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Thumbnail links a small PNG preview of an image attachment
+type Thumbnail struct {
+	// Artifact is the image's path below the failure prefix, e.g. screenshot.png
+	Artifact string `json:"artifact"`
+	URL      string `json:"url"`
+}
+
+// FailureFilter narrows the failures listed by GET /v1/failures; the zero
+// value matches every failure
+type FailureFilter struct {
+	// Severity matches failures declared with exactly this severity
+	Severity string
+	// Tags match failures carrying every tag; an empty value matches any value
+	Tags map[string]string
+}
+
+// FailuresResponse is the output for GET /v1/failures
+type FailuresResponse struct {
+	// SchemaVersion is the envelope schema version the service writes
+	SchemaVersion int `json:"schemaVersion"`
+
+	Failures []FailureSummary `json:"failures"`
+}
+
+// ArtifactDownload is a presigned download URL of one stored artifact
+type ArtifactDownload struct {
+	// Name is the artifact's path below the failure prefix, e.g. files/photo.jpg
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	// URL is empty while the malware scan withholds the artifact
+	URL string `json:"url,omitempty"`
+	// ScanStatus is "pending" or "quarantined" for withheld artifacts
+	ScanStatus string `json:"scanStatus,omitempty"`
+}
+
+// DownloadsResponse is the output for GET /v1/failures/{failureId}/downloads
+type DownloadsResponse struct {
+	Artifacts        []ArtifactDownload `json:"artifacts"`
+	ExpiresInSeconds int                `json:"expiresInSeconds"`
+	// Encryption is set when the artifacts must be decrypted with the client's key
+	Encryption *Encryption `json:"encryption,omitempty"`
+}
+
+// GroupsResponse is the output for GET /v1/groups
+type GroupsResponse struct {
+	Groups []Group `json:"groups"`
+}
+
+// StatsResponse is the output for GET /v1/stats
+type StatsResponse struct {
+	// From and To are the inclusive UTC days counted
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Total     int             `json:"total"`
+	Days      []DayCount      `json:"days"`
+	Projects  []ProjectCount  `json:"projects"`
+	Platforms []PlatformCount `json:"platforms"`
+	TopURLs   []URLCount      `json:"topUrls"`
+}
+
+// DayCount is the number of failures completed on a UTC day
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// ProjectCount is the number of failures of a project and env
+type ProjectCount struct {
+	Project string `json:"project"`
+	Env     string `json:"env"`
+	Count   int    `json:"count"`
+}
+
+// PlatformCount is the number of failures reported from a client platform
+type PlatformCount struct {
+	Platform string `json:"platform"`
+	Count    int    `json:"count"`
+}
+
+// URLCount is the number of failures of a method and normalized URL path
+type URLCount struct {
+	URL   string `json:"url"`
+	Count int    `json:"count"`
 }
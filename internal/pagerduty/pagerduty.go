@@ -0,0 +1,246 @@
+package pagerduty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/priority"
+)
+
+// DefaultEventsURL is the PagerDuty Events API v2 endpoint
+const DefaultEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Prefix is the S3 prefix under which occurrence windows are stored
+const Prefix = "notifications/pagerduty/"
+
+// maxSummary is the longest summary PagerDuty accepts
+const maxSummary = 1024
+
+// Store persists occurrence windows so they survive Lambda cold starts
+type Store interface {
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
+
+// Options configures when failures page
+type Options struct {
+	// EventsURL defaults to DefaultEventsURL
+	EventsURL string
+	// Threshold pages non-critical failures once their group occurred this
+	// many times within Window; 0 pages only critical failures
+	Threshold int
+	Window    time.Duration
+}
+
+// Pager triggers PagerDuty incidents for critical failures and for failure
+// groups that recur too often. Triggers of one group share a dedup key, so
+// PagerDuty adds repeats to the open incident instead of opening new ones.
+type Pager struct {
+	opts  Options
+	store Store
+	http  *http.Client
+}
+
+// New creates a pager recording occurrence windows in store
+func New(store Store, opts Options) *Pager {
+	if opts.EventsURL == "" {
+		opts.EventsURL = DefaultEventsURL
+	}
+	return &Pager{opts: opts, store: store, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// window counts a group's occurrences since Start
+type window struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// WindowKey returns the occurrence window key of a group
+// Format: notifications/pagerduty/{project}/{env}/{groupId}.json
+// Format with a tenant: notifications/pagerduty/tenant={tenant}/{project}/{env}/{groupId}.json
+func WindowKey(tenant, project, env, groupID string) string {
+	key := Prefix
+	if tenant != "" {
+		key += "tenant=" + tenant + "/"
+	}
+	return fmt.Sprintf("%s%s/%s/%s.json", key, project, env, groupID)
+}
+
+// DedupKey identifies notif's incident: its failure group, or the failure
+// itself when it was not grouped
+func DedupKey(notif email.FailureNotification) string {
+	id := notif.GroupID
+	if id == "" {
+		id = notif.FailureID
+	}
+	key := "failure-uploader/"
+	if notif.Tenant != "" {
+		key += notif.Tenant + "/"
+	}
+	return key + notif.Project + "/" + notif.Env + "/" + id
+}
+
+// ShouldPage reports whether notif warrants a page: it is critical, or its
+// group reached the occurrence threshold within the window. Occurrences
+// suppressed by the notification dedup window are counted too. Call it once
+// per notification, as it records the occurrence. Storage errors are logged
+// and do not page.
+func (p *Pager) ShouldPage(ctx context.Context, notif email.FailureNotification, now time.Time) bool {
+	if notif.Critical || notif.Severity == priority.SeverityCritical {
+		return true
+	}
+	if p.opts.Threshold <= 0 || notif.GroupID == "" {
+		return false
+	}
+
+	key := WindowKey(notif.Tenant, notif.Project, notif.Env, notif.GroupID)
+	var w window
+	exists, err := p.store.ObjectExists(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("pagerduty window lookup failed")
+		return false
+	}
+	if exists {
+		b, err := p.store.GetObjectBytes(ctx, key)
+		if err == nil {
+			err = json.Unmarshal(b, &w)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("resetting unreadable pagerduty window")
+			w = window{}
+		}
+	}
+	if w.Start.IsZero() || now.Sub(w.Start) >= p.opts.Window {
+		w = window{Start: now}
+	}
+	w.Count += 1 + notif.Suppressed
+
+	if b, err := json.Marshal(w); err == nil {
+		if err := p.store.PutObjectBytes(ctx, key, "application/json", b); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("failed to record pagerduty window")
+		}
+	}
+	return w.Count >= p.opts.Threshold
+}
+
+type link struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type eventPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+type event struct {
+	RoutingKey  string       `json:"routing_key"`
+	EventAction string       `json:"event_action"`
+	DedupKey    string       `json:"dedup_key"`
+	Client      string       `json:"client"`
+	Payload     eventPayload `json:"payload"`
+	Links       []link       `json:"links,omitempty"`
+}
+
+// Trigger sends a trigger event for notif to the service with routingKey
+func (p *Pager) Trigger(ctx context.Context, routingKey string, notif email.FailureNotification) error {
+	body, err := json.Marshal(newEvent(routingKey, notif))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.opts.EventsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pagerduty returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func newEvent(routingKey string, notif email.FailureNotification) event {
+	summary := fmt.Sprintf("[%s/%s] %s %s", notif.Project, notif.Env, notif.Method, notif.URL)
+	if outcome := notif.Outcome(); outcome != "" {
+		summary += " - " + outcome
+	}
+	if len(summary) > maxSummary {
+		summary = summary[:maxSummary]
+	}
+
+	details := map[string]interface{}{
+		"failureId": notif.FailureID,
+		"method":    notif.Method,
+		"url":       notif.URL,
+	}
+	for k, v := range map[string]string{"groupId": notif.GroupID, "tenant": notif.Tenant, "appVersion": notif.AppVersion, "platform": notif.Platform} {
+		if v != "" {
+			details[k] = v
+		}
+	}
+	if notif.Occurrences > 0 {
+		details["occurrences"] = notif.Occurrences
+	}
+	if notif.Suppressed > 0 {
+		details["suppressed"] = notif.Suppressed
+	}
+
+	ev := event{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    DedupKey(notif),
+		Client:      "failure-uploader",
+		Payload: eventPayload{
+			Summary:       summary,
+			Source:        notif.Project + "/" + notif.Env,
+			Severity:      severity(notif),
+			Timestamp:     time.Now().UTC().Format(time.RFC3339),
+			Component:     notif.Project,
+			Group:         notif.Env,
+			Class:         notif.Outcome(),
+			CustomDetails: details,
+		},
+	}
+	if notif.EnvelopeURL != "" {
+		ev.Links = append(ev.Links, link{Href: notif.EnvelopeURL, Text: "Envelope"})
+	}
+	if notif.AckURL != "" {
+		ev.Links = append(ev.Links, link{Href: notif.AckURL, Text: "Acknowledge"})
+	}
+	return ev
+}
+
+// severity maps notif to a PagerDuty severity: the declared one, else
+// critical for critical priority and error otherwise
+func severity(notif email.FailureNotification) string {
+	switch {
+	case notif.Severity != "" && priority.ValidSeverity(notif.Severity):
+		return notif.Severity
+	case notif.Critical:
+		return priority.SeverityCritical
+	default:
+		return priority.SeverityError
+	}
+}
@@ -0,0 +1,107 @@
+package pagerduty
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func testNotification() email.FailureNotification {
+	return email.FailureNotification{
+		FailureID:   "f-1",
+		Project:     "payments",
+		Env:         "prod",
+		Method:      "POST",
+		URL:         "https://api.example.com/v1/charges",
+		StatusCode:  502,
+		GroupID:     "g1",
+		EnvelopeURL: "https://bucket.s3.amazonaws.com/envelope.json",
+	}
+}
+
+func TestShouldPage(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	off := New(testsupport.NewStore(), Options{})
+	notif := testNotification()
+	if off.ShouldPage(ctx, notif, now) {
+		t.Error("non-critical failure paged without a threshold")
+	}
+	notif.Severity = "critical"
+	if !off.ShouldPage(ctx, notif, now) {
+		t.Error("critical severity did not page")
+	}
+
+	p := New(testsupport.NewStore(), Options{Threshold: 3, Window: time.Hour})
+	notif = testNotification()
+	if p.ShouldPage(ctx, notif, now) || p.ShouldPage(ctx, notif, now.Add(time.Minute)) {
+		t.Fatal("paged below the threshold")
+	}
+	if !p.ShouldPage(ctx, notif, now.Add(2*time.Minute)) {
+		t.Error("third occurrence within the window did not page")
+	}
+	// The window restarts after it elapses
+	if p.ShouldPage(ctx, notif, now.Add(2*time.Hour)) {
+		t.Error("paged on the first occurrence of a new window")
+	}
+	// Occurrences suppressed by notification dedup count towards the threshold
+	notif.Suppressed = 5
+	if !p.ShouldPage(ctx, notif, now.Add(2*time.Hour+time.Minute)) {
+		t.Error("suppressed occurrences were not counted")
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	var got event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	p := New(testsupport.NewStore(), Options{EventsURL: srv.URL})
+	notif := testNotification()
+	notif.Critical = true
+	if err := p.Trigger(context.Background(), "routing-key", notif); err != nil {
+		t.Fatal(err)
+	}
+	if got.RoutingKey != "routing-key" || got.EventAction != "trigger" || got.DedupKey != "failure-uploader/payments/prod/g1" {
+		t.Errorf("event = %+v", got)
+	}
+	if got.Payload.Severity != "critical" || got.Payload.Source != "payments/prod" || len(got.Links) != 1 {
+		t.Errorf("payload = %+v, links = %+v", got.Payload, got.Links)
+	}
+}
+
+func TestTrigger_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":"invalid event"}`))
+	}))
+	defer srv.Close()
+
+	if err := New(testsupport.NewStore(), Options{EventsURL: srv.URL}).Trigger(context.Background(), "k", testNotification()); err == nil {
+		t.Error("Trigger() succeeded on a 400")
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	notif := testNotification()
+	notif.Tenant = "acme"
+	if got := DedupKey(notif); got != "failure-uploader/acme/payments/prod/g1" {
+		t.Errorf("DedupKey() = %q", got)
+	}
+	notif.GroupID = ""
+	if got := DedupKey(notif); got != "failure-uploader/acme/payments/prod/f-1" {
+		t.Errorf("ungrouped DedupKey() = %q", got)
+	}
+}
@@ -0,0 +1,94 @@
+package placement
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+)
+
+// Headers clients must send with a PUT presigned with tags or a storage class
+const (
+	HeaderTagging      = "x-amz-tagging"
+	HeaderStorageClass = "x-amz-storage-class"
+)
+
+// Tag keys set on failure objects
+const (
+	TagProject   = "project"
+	TagEnv       = "env"
+	TagFailureID = "failureId"
+	TagStage     = "stage"
+)
+
+// Upload stages recorded in TagStage
+const (
+	// StagePending objects were presigned but their failure is not completed yet
+	StagePending = "pending"
+	// StageComplete objects belong to a completed failure
+	StageComplete = "complete"
+)
+
+// storageClasses are the classes large artifacts may be uploaded to. Archive
+// classes are left to cmd/lifecycle, since their objects cannot be read directly.
+var storageClasses = map[string]bool{
+	"STANDARD_IA":         true,
+	"ONEZONE_IA":          true,
+	"INTELLIGENT_TIERING": true,
+	"GLACIER_IR":          true,
+}
+
+// Policy decides the tags and storage class of uploaded failure objects. A nil
+// policy tags nothing and keeps every object in STANDARD.
+type Policy struct {
+	tags          bool
+	largeClass    string
+	largeMinBytes int64
+}
+
+// New creates a policy. Artifacts declared at least largeMinBytes long are
+// uploaded to largeClass; an empty class keeps them in STANDARD.
+func New(tags bool, largeClass string, largeMinBytes int64) (*Policy, error) {
+	largeClass = strings.ToUpper(strings.TrimSpace(largeClass))
+	if largeClass != "" && !storageClasses[largeClass] {
+		return nil, fmt.Errorf("unsupported upload storage class %q", largeClass)
+	}
+	if largeClass != "" && largeMinBytes <= 0 {
+		return nil, fmt.Errorf("large object threshold must be positive, got %d", largeMinBytes)
+	}
+	return &Policy{tags: tags, largeClass: largeClass, largeMinBytes: largeMinBytes}, nil
+}
+
+// Tags returns the tags of the failure's objects at stage, or nil when
+// tagging is disabled
+func (p *Policy) Tags(loc keys.Location, stage string) map[string]string {
+	if p == nil || !p.tags {
+		return nil
+	}
+	return map[string]string{
+		TagProject:   loc.Project,
+		TagEnv:       loc.Env,
+		TagFailureID: loc.FailureID,
+		TagStage:     stage,
+	}
+}
+
+// StorageClass returns the storage class of an artifact of size bytes, or ""
+// for STANDARD. Artifacts of unknown size (0) stay in STANDARD.
+func (p *Policy) StorageClass(size int64) string {
+	if p == nil || p.largeClass == "" || size < p.largeMinBytes {
+		return ""
+	}
+	return p.largeClass
+}
+
+// Encode formats tags as an x-amz-tagging header value. Keys are sorted, so
+// the value signed into a URL is the one returned to the client.
+func Encode(tags map[string]string) string {
+	v := make(url.Values, len(tags))
+	for k, t := range tags {
+		v.Set(k, t)
+	}
+	return v.Encode()
+}
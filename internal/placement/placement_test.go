@@ -0,0 +1,49 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+)
+
+func TestPolicy_Tags(t *testing.T) {
+	loc, ok := keys.Parse("failures/v2/myapp/prod/dt=2024-03-15/abc-123/request.raw")
+	if !ok {
+		t.Fatal("Parse() failed")
+	}
+
+	p, _ := New(true, "", 0)
+	tags := p.Tags(loc, StagePending)
+	if got := Encode(tags); got != "env=prod&failureId=abc-123&project=myapp&stage=pending" {
+		t.Errorf("Encode(Tags()) = %q", got)
+	}
+
+	off, _ := New(false, "", 0)
+	var none *Policy
+	if off.Tags(loc, StagePending) != nil || none.Tags(loc, StagePending) != nil {
+		t.Error("disabled policy returned tags")
+	}
+}
+
+func TestPolicy_StorageClass(t *testing.T) {
+	p, err := New(false, "standard_ia", 128<<10)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for size, want := range map[int64]string{0: "", 1024: "", 128 << 10: "STANDARD_IA", 10 << 20: "STANDARD_IA"} {
+		if got := p.StorageClass(size); got != want {
+			t.Errorf("StorageClass(%d) = %q, want %q", size, got, want)
+		}
+	}
+
+	var none *Policy
+	if none.StorageClass(10<<20) != "" {
+		t.Error("nil policy chose a storage class")
+	}
+	if _, err := New(false, "GLACIER", 1); err == nil {
+		t.Error("New() accepted an archive storage class")
+	}
+	if _, err := New(false, "STANDARD_IA", 0); err == nil {
+		t.Error("New() accepted a zero threshold")
+	}
+}
@@ -0,0 +1,53 @@
+package priority
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Header lets clients mark a request as critical before its body is read,
+// so middleware such as rate limiting can route it to the critical lane
+const Header = "X-Failure-Priority"
+
+const (
+	Normal   = "normal"
+	Critical = "critical"
+)
+
+// Valid reports whether p is an accepted priority; empty means normal
+func Valid(p string) bool {
+	switch strings.ToLower(p) {
+	case "", Normal, Critical:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsCritical reports whether p marks a critical failure
+func IsCritical(p string) bool {
+	return strings.EqualFold(p, Critical)
+}
+
+// Severities a client can declare for a failure, matching PagerDuty's
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+// ValidSeverity reports whether s is an accepted severity; empty means undeclared
+func ValidSeverity(s string) bool {
+	switch s {
+	case "", SeverityInfo, SeverityWarning, SeverityError, SeverityCritical:
+		return true
+	default:
+		return false
+	}
+}
+
+// FromRequest returns the priority declared in the request header
+func FromRequest(r *http.Request) string {
+	return r.Header.Get(Header)
+}
@@ -0,0 +1,34 @@
+package priority
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	for _, p := range []string{"", "normal", "critical", "CRITICAL"} {
+		if !Valid(p) {
+			t.Errorf("Valid(%q) = false, want true", p)
+		}
+	}
+	for _, p := range []string{"high", "urgent", "0"} {
+		if Valid(p) {
+			t.Errorf("Valid(%q) = true, want false", p)
+		}
+	}
+}
+
+func TestIsCritical(t *testing.T) {
+	if !IsCritical("critical") || !IsCritical("Critical") {
+		t.Error("critical should be critical regardless of case")
+	}
+	if IsCritical("") || IsCritical("normal") {
+		t.Error("empty and normal should not be critical")
+	}
+
+	r := httptest.NewRequest("POST", "/v1/upload-ticket", nil)
+	r.Header.Set(Header, "critical")
+	if !IsCritical(FromRequest(r)) {
+		t.Error("header priority not read")
+	}
+}
@@ -0,0 +1,169 @@
+package profiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Profile holds the upload limits and validation rules for a project. Zero
+// values fall back to the "default" profile and then to the global limits.
+type Profile struct {
+	MaxBodyBytes  int64 `json:"maxBodyBytes,omitempty"`
+	MaxFileBytes  int64 `json:"maxFileBytes,omitempty"`
+	MaxTotalBytes int64 `json:"maxTotalBytes,omitempty"`
+	// MaxFiles caps the attached files per ticket; 0 means unlimited
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// MaxLogsBytes, MaxScreenshotBytes and MaxConsoleBytes cap the dedicated
+	// artifact slots
+	MaxLogsBytes       int64 `json:"maxLogsBytes,omitempty"`
+	MaxScreenshotBytes int64 `json:"maxScreenshotBytes,omitempty"`
+	MaxConsoleBytes    int64 `json:"maxConsoleBytes,omitempty"`
+	// DailyFailures and DailyBytes cap the tickets and declared upload bytes
+	// per UTC day; 0 means unlimited
+	DailyFailures int64 `json:"dailyFailures,omitempty"`
+	DailyBytes    int64 `json:"dailyBytes,omitempty"`
+	// StorageBudgetBytes caps the bytes the project keeps stored; once reached,
+	// large uploads are refused. 0 means unlimited.
+	StorageBudgetBytes int64 `json:"storageBudgetBytes,omitempty"`
+	// Platforms restricts client.platform; empty allows every supported platform
+	Platforms []string `json:"platforms,omitempty"`
+	// ContentTypes allows request and file content types, e.g. "image/*"; empty allows any
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// DeniedContentTypes rejects content types even when ContentTypes allows them
+	DeniedContentTypes []string `json:"deniedContentTypes,omitempty"`
+}
+
+// Profiles maps projects to profiles, with "default" used for unlisted projects
+type Profiles struct {
+	byProject map[string]Profile
+}
+
+// Parse parses a JSON object of project -> profile. An empty string yields the
+// global limits for every project.
+func Parse(s string) (*Profiles, error) {
+	p := &Profiles{byProject: make(map[string]Profile)}
+	if s == "" {
+		return p, nil
+	}
+	if err := json.Unmarshal([]byte(s), &p.byProject); err != nil {
+		return nil, fmt.Errorf("parse project profiles: %w", err)
+	}
+	for project, prof := range p.byProject {
+		if prof.MaxBodyBytes < 0 || prof.MaxFileBytes < 0 || prof.MaxTotalBytes < 0 || prof.MaxFiles < 0 ||
+			prof.MaxLogsBytes < 0 || prof.MaxScreenshotBytes < 0 || prof.MaxConsoleBytes < 0 ||
+			prof.DailyFailures < 0 || prof.DailyBytes < 0 || prof.StorageBudgetBytes < 0 {
+			return nil, fmt.Errorf("parse project profiles: %s: limits cannot be negative", project)
+		}
+	}
+	return p, nil
+}
+
+// For returns the effective profile for project, filling unset fields from
+// the "default" profile and then from base
+func (p *Profiles) For(project string, base Profile) Profile {
+	prof := base
+	if p != nil {
+		prof = merge(merge(base, p.byProject["default"]), p.byProject[project])
+	}
+	return prof
+}
+
+// merge overlays the set fields of over onto prof
+func merge(prof, over Profile) Profile {
+	if over.MaxBodyBytes > 0 {
+		prof.MaxBodyBytes = over.MaxBodyBytes
+	}
+	if over.MaxFileBytes > 0 {
+		prof.MaxFileBytes = over.MaxFileBytes
+	}
+	if over.MaxTotalBytes > 0 {
+		prof.MaxTotalBytes = over.MaxTotalBytes
+	}
+	if over.MaxFiles > 0 {
+		prof.MaxFiles = over.MaxFiles
+	}
+	if over.MaxLogsBytes > 0 {
+		prof.MaxLogsBytes = over.MaxLogsBytes
+	}
+	if over.MaxScreenshotBytes > 0 {
+		prof.MaxScreenshotBytes = over.MaxScreenshotBytes
+	}
+	if over.MaxConsoleBytes > 0 {
+		prof.MaxConsoleBytes = over.MaxConsoleBytes
+	}
+	if over.DailyFailures > 0 {
+		prof.DailyFailures = over.DailyFailures
+	}
+	if over.DailyBytes > 0 {
+		prof.DailyBytes = over.DailyBytes
+	}
+	if over.StorageBudgetBytes > 0 {
+		prof.StorageBudgetBytes = over.StorageBudgetBytes
+	}
+	if len(over.Platforms) > 0 {
+		prof.Platforms = over.Platforms
+	}
+	if len(over.ContentTypes) > 0 {
+		prof.ContentTypes = over.ContentTypes
+	}
+	if len(over.DeniedContentTypes) > 0 {
+		prof.DeniedContentTypes = over.DeniedContentTypes
+	}
+	return prof
+}
+
+// AllowsPlatform reports whether the profile accepts platform
+func (prof Profile) AllowsPlatform(platform string) bool {
+	if len(prof.Platforms) == 0 {
+		return true
+	}
+	for _, p := range prof.Platforms {
+		if strings.EqualFold(p, platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsContentType reports whether contentType is on the profile's allowlist.
+// Parameters are ignored and patterns may end in "/*" to match a whole type.
+func (prof Profile) AllowsContentType(contentType string) bool {
+	if len(prof.ContentTypes) == 0 {
+		return true
+	}
+	return matchContentType(prof.ContentTypes, contentType)
+}
+
+// DeniesContentType reports whether contentType is on the profile's denylist
+func (prof Profile) DeniesContentType(contentType string) bool {
+	return matchContentType(prof.DeniedContentTypes, contentType)
+}
+
+// matchContentType reports whether contentType matches any of patterns.
+// Unparseable content types match nothing.
+func matchContentType(patterns []string, contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mt || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitList parses a comma-separated list of content types, dropping empty entries
+func SplitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
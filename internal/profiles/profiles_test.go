@@ -0,0 +1,88 @@
+package profiles
+
+import "testing"
+
+var base = Profile{MaxBodyBytes: 10, MaxFileBytes: 50, MaxTotalBytes: 100, MaxScreenshotBytes: 20}
+
+func TestFor(t *testing.T) {
+	p, err := Parse(`{
+		"default": {"maxFiles": 5},
+		"tools": {"maxFileBytes": 500, "maxTotalBytes": 1000, "maxScreenshotBytes": 200, "platforms": ["desktop"]}
+	}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tools := p.For("tools", base)
+	if tools.MaxBodyBytes != 10 || tools.MaxFileBytes != 500 || tools.MaxTotalBytes != 1000 || tools.MaxFiles != 5 || tools.MaxScreenshotBytes != 200 {
+		t.Errorf("tools = %+v", tools)
+	}
+
+	other := p.For("public", base)
+	if other.MaxFileBytes != 50 || other.MaxFiles != 5 || other.MaxScreenshotBytes != 20 || len(other.Platforms) != 0 {
+		t.Errorf("public = %+v", other)
+	}
+
+	var none *Profiles
+	if got := none.For("any", base); got.MaxTotalBytes != 100 {
+		t.Errorf("nil profiles = %+v, want base", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, s := range []string{`not json`, `{"app": {"maxFiles": -1}}`, `{"app": {"maxLogsBytes": -1}}`} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) error = nil", s)
+		}
+	}
+}
+
+func TestAllowsPlatform(t *testing.T) {
+	prof := Profile{Platforms: []string{"ios", "android"}}
+	if !prof.AllowsPlatform("iOS") || prof.AllowsPlatform("web") {
+		t.Error("platform allowlist not applied")
+	}
+	if !(Profile{}).AllowsPlatform("web") {
+		t.Error("empty allowlist should allow every platform")
+	}
+}
+
+func TestAllowsContentType(t *testing.T) {
+	prof := Profile{ContentTypes: []string{"image/*", "application/json"}}
+
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"image/png", true},
+		{"application/json; charset=utf-8", true},
+		{"video/mp4", false},
+		{"imagex/png", false},
+		{"not a type", false},
+	}
+	for _, tt := range tests {
+		if got := prof.AllowsContentType(tt.contentType); got != tt.want {
+			t.Errorf("AllowsContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestDeniesContentType(t *testing.T) {
+	prof := Profile{DeniedContentTypes: SplitList("application/x-msdownload, application/x-sh,, video/*")}
+
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/x-msdownload", true},
+		{"application/x-sh; charset=utf-8", true},
+		{"video/mp4", true},
+		{"image/png", false},
+		{"not a type", false},
+	}
+	for _, tt := range tests {
+		if got := prof.DeniesContentType(tt.contentType); got != tt.want {
+			t.Errorf("DeniesContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package consumer processes the messages of an SQS queue, either as the SQS
+// events of a Lambda invocation or by long polling. It is shared by every
+// queue the service consumes and imports none of their packages, so any of
+// them can use it.
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// pollWait is how long a receive waits for messages (SQS long polling maximum)
+const pollWait = 20
+
+// receiveBackoff is how long polling pauses after a failed receive
+const receiveBackoff = 5 * time.Second
+
+// ErrMalformed marks messages that can never be processed
+var ErrMalformed = errors.New("malformed message")
+
+// Malformed marks err as the reason a message can never be processed, so it
+// is dropped instead of retried
+func Malformed(err error) error {
+	return fmt.Errorf("%w: %w", ErrMalformed, err)
+}
+
+// Receiver is the subset of SQS operations polling needs
+type Receiver interface {
+	ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// Func processes the body of message id. An error leaves the message on the
+// queue to be retried, unless it is Malformed.
+type Func func(ctx context.Context, id, body string) error
+
+// Consumer processes the messages of one queue
+type Consumer struct {
+	// Name labels the queue in logs, e.g. "notifications"
+	Name    string
+	Process Func
+}
+
+// New creates a consumer of the queue name processing messages with process
+func New(name string, process Func) Consumer {
+	return Consumer{Name: name, Process: process}
+}
+
+// Decode parses the JSON body of a queued message into m, which must carry
+// a top-level "version" equal to version
+func Decode(body string, version int, m any) error {
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(body), &probe); err != nil {
+		return err
+	}
+	if probe.Version != version {
+		return fmt.Errorf("unsupported version %d", probe.Version)
+	}
+	return json.Unmarshal([]byte(body), m)
+}
+
+// SQSEvent returns payload as an SQS event, reporting false for any other
+// Lambda event, so a Lambda can consume a queue besides its other triggers
+func SQSEvent(payload []byte) (events.SQSEvent, bool) {
+	var event events.SQSEvent
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) == 0 || event.Records[0].EventSource != "aws:sqs" {
+		return events.SQSEvent{}, false
+	}
+	return event, true
+}
+
+// process runs one message, reporting whether it is done with: processed or
+// dropped as malformed
+func (c Consumer) process(ctx context.Context, id, body string) bool {
+	err := c.Process(ctx, id, body)
+	if errors.Is(err, ErrMalformed) {
+		logging.FromContext(ctx).Error().Err(err).Str("queue", c.Name).Str("messageId", id).Msg("dropping malformed message")
+		return true
+	}
+	return err == nil
+}
+
+// Handle processes the messages of an SQS Lambda event. Failed ones are
+// reported as batch item failures, so SQS retries only those after the
+// visibility timeout and moves them to the dead-letter queue once the
+// redrive policy's receive count is exhausted. Malformed messages are
+// dropped.
+func (c Consumer) Handle(ctx context.Context, event events.SQSEvent) events.SQSEventResponse {
+	var resp events.SQSEventResponse
+	for _, rec := range event.Records {
+		if !c.process(ctx, rec.MessageId, rec.Body) {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: rec.MessageId})
+		}
+	}
+	return resp
+}
+
+// Poll receives messages from the queue at queueURL and processes them until
+// ctx is done. Processed and malformed messages are deleted; failed ones
+// become visible again after the queue's visibility timeout.
+func (c Consumer) Poll(ctx context.Context, client Receiver, queueURL string) {
+	for ctx.Err() == nil {
+		out, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     pollWait,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logging.FromContext(ctx).Error().Err(err).Str("queue", c.Name).Msg("failed to receive messages")
+			select {
+			case <-ctx.Done():
+			case <-time.After(receiveBackoff):
+			}
+			continue
+		}
+
+		for _, msg := range out.Messages {
+			id := aws.ToString(msg.MessageId)
+			if !c.process(ctx, id, aws.ToString(msg.Body)) {
+				continue
+			}
+			if _, err := client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(queueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			}); err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Str("queue", c.Name).Str("messageId", id).Msg("failed to delete message")
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// process fails "retry" and drops "garbage" as malformed
+func process(_ context.Context, _, body string) error {
+	switch body {
+	case "retry":
+		return errors.New("unavailable")
+	case "garbage":
+		return Malformed(errors.New("not json"))
+	}
+	return nil
+}
+
+func TestHandle(t *testing.T) {
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "m1", Body: "ok"},
+		{MessageId: "m2", Body: "retry"},
+		{MessageId: "m3", Body: "garbage"},
+	}}
+	resp := New("test", process).Handle(context.Background(), event)
+
+	// Malformed messages are dropped rather than retried
+	want := []events.SQSBatchItemFailure{{ItemIdentifier: "m2"}}
+	if !reflect.DeepEqual(resp.BatchItemFailures, want) {
+		t.Errorf("BatchItemFailures = %+v, want only m2", resp.BatchItemFailures)
+	}
+}
+
+// fakeReceiver returns its messages once, then stops polling
+type fakeReceiver struct {
+	messages []types.Message
+	cancel   context.CancelFunc
+	deleted  []string
+}
+
+func (f *fakeReceiver) ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{Messages: f.messages}
+	f.messages = nil
+	if out.Messages == nil {
+		f.cancel()
+	}
+	return out, nil
+}
+
+func (f *fakeReceiver) DeleteMessage(_ context.Context, in *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(in.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &fakeReceiver{cancel: cancel}
+	for _, body := range []string{"ok", "retry", "garbage"} {
+		client.messages = append(client.messages, types.Message{
+			MessageId:     aws.String("id-" + body),
+			ReceiptHandle: aws.String(body),
+			Body:          aws.String(body),
+		})
+	}
+	New("test", process).Poll(ctx, client, "q")
+
+	// Failed messages stay on the queue to become visible again
+	if want := []string{"ok", "garbage"}; !reflect.DeepEqual(client.deleted, want) {
+		t.Errorf("deleted %v, want %v", client.deleted, want)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var m struct {
+		Version int    `json:"version"`
+		Name    string `json:"name"`
+	}
+	if err := Decode(`{"version":1,"name":"a"}`, 1, &m); err != nil || m.Name != "a" {
+		t.Errorf("Decode() = %+v, %v", m, err)
+	}
+	for _, body := range []string{"not json", `{"version":2,"name":"a"}`, `{"name":"a"}`} {
+		if err := Decode(body, 1, &m); err == nil {
+			t.Errorf("Decode(%q) succeeded", body)
+		}
+	}
+}
+
+func TestSQSEvent(t *testing.T) {
+	if _, ok := SQSEvent([]byte(`{"Records":[{"messageId":"m1","eventSource":"aws:sqs","body":"{}"}]}`)); !ok {
+		t.Error("SQSEvent() did not detect an SQS event")
+	}
+	for _, payload := range []string{`{"version":"2.0","rawPath":"/health"}`, `{"Records":[{"eventSource":"aws:s3"}]}`, `[]`} {
+		if _, ok := SQSEvent([]byte(payload)); ok {
+			t.Errorf("SQSEvent(%s) = true", payload)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/queue/consumer"
+)
+
+// Version is the schema version of queued messages
+const Version = 1
+
+// Message is the body of a queued failure notification
+type Message struct {
+	Version      int                       `json:"version"`
+	EnqueuedAt   time.Time                 `json:"enqueuedAt"`
+	Notification email.FailureNotification `json:"notification"`
+}
+
+// API is the subset of the SQS client used by the queue
+type API interface {
+	SendMessage(ctx context.Context, in *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// NewClient creates an SQS client for region
+func NewClient(ctx context.Context, region string) (*sqs.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return sqs.NewFromConfig(cfg), nil
+}
+
+// Publisher enqueues failure notifications instead of delivering them, so
+// email, Slack and webhook latency stays out of upload-complete. A consumer
+// delivers them with Handle or Poll.
+type Publisher struct {
+	client   API
+	queueURL string
+	// inline delivers critical notifications, which must not wait behind the queue
+	inline email.Notifier
+}
+
+// NewPublisher creates a publisher sending to the queue at queueURL
+func NewPublisher(client API, queueURL string) *Publisher {
+	return &Publisher{client: client, queueURL: queueURL}
+}
+
+// WithInline delivers critical notifications through n in the request
+// instead of queueing them behind bulk ones
+func (p *Publisher) WithInline(n email.Notifier) *Publisher {
+	p.inline = n
+	return p
+}
+
+// SendFailureNotification enqueues notif, or delivers it inline when it is
+// critical and an inline notifier is set
+func (p *Publisher) SendFailureNotification(ctx context.Context, notif email.FailureNotification) error {
+	if notif.Critical && p.inline != nil {
+		return p.inline.SendFailureNotification(ctx, notif)
+	}
+	b, err := json.Marshal(Message{Version: Version, EnqueuedAt: time.Now().UTC(), Notification: notif})
+	if err != nil {
+		return err
+	}
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(b)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"project": {DataType: aws.String("String"), StringValue: aws.String(notif.Project)},
+			"env":     {DataType: aws.String("String"), StringValue: aws.String(notif.Env)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("enqueue notification: %w", err)
+	}
+	metrics.NotificationsQueued.Inc(notif.Project)
+	return nil
+}
+
+// Decode parses a queued message body
+func Decode(body string) (Message, error) {
+	var m Message
+	if err := consumer.Decode(body, Version, &m); err != nil {
+		return Message{}, fmt.Errorf("parse queued notification: %w", err)
+	}
+	return m, nil
+}
+
+// deliver sends the notification in body through n
+func deliver(ctx context.Context, n email.Notifier, id, body string) error {
+	m, err := Decode(body)
+	if err != nil {
+		return consumer.Malformed(err)
+	}
+	if err := n.SendFailureNotification(ctx, m.Notification); err != nil {
+		metrics.QueuedDeliveryFailures.Inc(m.Notification.Project)
+		logging.FromContext(ctx).Error().Err(err).Str("messageId", id).Str("failureId", m.Notification.FailureID).Msg("failed to deliver queued notification")
+		return err
+	}
+	logging.FromContext(ctx).Info().
+		Str("messageId", id).
+		Str("failureId", m.Notification.FailureID).
+		Dur("queued", time.Since(m.EnqueuedAt)).
+		Msg("queued notification delivered")
+	return nil
+}
+
+// consumerOf returns the consumer delivering queued notifications through n
+func consumerOf(n email.Notifier) consumer.Consumer {
+	return consumer.New("notifications", func(ctx context.Context, id, body string) error {
+		return deliver(ctx, n, id, body)
+	})
+}
+
+// Handle delivers the notifications of an SQS Lambda event through n. Failed
+// deliveries are reported as batch item failures, so SQS retries only those
+// and moves them to the dead-letter queue once the redrive policy's receive
+// count is exhausted. Malformed messages are dropped.
+func Handle(ctx context.Context, n email.Notifier, event events.SQSEvent) events.SQSEventResponse {
+	return consumerOf(n).Handle(ctx, event)
+}
+
+// Poll delivers notifications from the queue at queueURL through n; see consumer.Consumer.Poll
+func Poll(ctx context.Context, client consumer.Receiver, queueURL string, n email.Notifier) {
+	consumerOf(n).Poll(ctx, client, queueURL)
+}
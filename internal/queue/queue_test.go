@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yourorg/failure-uploader/internal/email"
+)
+
+type fakeSQS struct {
+	sent []string
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, aws.ToString(in.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+type recordingNotifier struct {
+	got  []email.FailureNotification
+	fail map[string]bool
+}
+
+func (r *recordingNotifier) SendFailureNotification(_ context.Context, notif email.FailureNotification) error {
+	if r.fail[notif.FailureID] {
+		return errors.New("smtp down")
+	}
+	r.got = append(r.got, notif)
+	return nil
+}
+
+func TestPublisherRoundTrip(t *testing.T) {
+	client := &fakeSQS{}
+	pub := NewPublisher(client, "https://sqs.us-east-1.amazonaws.com/123/notify")
+	notif := email.FailureNotification{FailureID: "f-1", Project: "myapp", Env: "prod", StatusCode: 503, To: []string{"a@example.com"}}
+	if err := pub.SendFailureNotification(context.Background(), notif); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(client.sent))
+	}
+
+	m, err := Decode(client.sent[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Notification.FailureID != "f-1" || m.Notification.StatusCode != 503 || len(m.Notification.To) != 1 || m.EnqueuedAt.IsZero() {
+		t.Errorf("Decode() = %+v", m)
+	}
+}
+
+func TestPublisher_DeliversCriticalInline(t *testing.T) {
+	client := &fakeSQS{}
+	inline := &recordingNotifier{}
+	pub := NewPublisher(client, "https://sqs.us-east-1.amazonaws.com/123/notify").WithInline(inline)
+
+	for _, notif := range []email.FailureNotification{
+		{FailureID: "bulk", Project: "myapp"},
+		{FailureID: "payment", Project: "myapp", Critical: true},
+	} {
+		if err := pub.SendFailureNotification(context.Background(), notif); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(inline.got) != 1 || inline.got[0].FailureID != "payment" {
+		t.Errorf("delivered inline = %+v, want only the critical notification", inline.got)
+	}
+	if len(client.sent) != 1 {
+		t.Fatalf("queued %d messages, want 1", len(client.sent))
+	}
+	if m, _ := Decode(client.sent[0]); m.Notification.FailureID != "bulk" {
+		t.Errorf("queued %+v, want the bulk notification", m.Notification)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, body := range []string{"not json", `{"version":2,"notification":{}}`} {
+		if _, err := Decode(body); err == nil {
+			t.Errorf("Decode(%q) succeeded", body)
+		}
+	}
+}
+
+func TestHandle_ReportsFailedDeliveries(t *testing.T) {
+	client := &fakeSQS{}
+	pub := NewPublisher(client, "q")
+	ctx := context.Background()
+	for _, id := range []string{"ok", "fails"} {
+		if err := pub.SendFailureNotification(ctx, email.FailureNotification{FailureID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "m1", Body: client.sent[0]},
+		{MessageId: "m2", Body: client.sent[1]},
+		{MessageId: "m3", Body: "garbage"},
+	}}
+	n := &recordingNotifier{fail: map[string]bool{"fails": true}}
+	resp := Handle(ctx, n, event)
+
+	if len(n.got) != 1 || n.got[0].FailureID != "ok" {
+		t.Errorf("delivered %+v, want only ok", n.got)
+	}
+	// Malformed messages are dropped rather than retried
+	if len(resp.BatchItemFailures) != 1 || resp.BatchItemFailures[0].ItemIdentifier != "m2" {
+		t.Errorf("BatchItemFailures = %+v, want m2", resp.BatchItemFailures)
+	}
+}
@@ -0,0 +1,104 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// retention is how long daily counters are kept after their day
+const retention = 7 * 24 * time.Hour
+
+// DynamoStore keeps usage in DynamoDB with one atomic counter item per project
+// and day, so quotas are shared across Lambda instances. The table needs a
+// string partition key "pk"; enable TTL on the "expiresAt" attribute to drop
+// old days.
+type DynamoStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoStore creates a DynamoDB-backed quota store
+func NewDynamoStore(ctx context.Context, region, table string) (*DynamoStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return &DynamoStore{client: dynamodb.NewFromConfig(cfg), table: table}, nil
+}
+
+func number(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+// Add atomically adds add to project's item for day, conditioned on the
+// counters leaving room for it
+func (s *DynamoStore) Add(ctx context.Context, project string, day time.Time, add, limit Usage) (Usage, error) {
+	day = Day(day)
+	if !fits(Usage{}, add, limit) {
+		return Usage{}, ErrExceeded
+	}
+
+	values := map[string]types.AttributeValue{
+		":f":   number(add.Failures),
+		":b":   number(add.Bytes),
+		":exp": number(day.Add(retention).Unix()),
+	}
+	condition := ""
+	and := func(clause string) {
+		if condition != "" {
+			condition += " AND "
+		}
+		condition += clause
+	}
+	if limit.Failures > 0 {
+		and("(attribute_not_exists(failures) OR failures <= :maxf)")
+		values[":maxf"] = number(limit.Failures - add.Failures)
+	}
+	if limit.Bytes > 0 {
+		and("(attribute_not_exists(bytes) OR bytes <= :maxb)")
+		values[":maxb"] = number(limit.Bytes - add.Bytes)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "quota#" + project + "#" + day.Format("2006-01-02")},
+		},
+		UpdateExpression:                    aws.String("ADD failures :f, bytes :b SET expiresAt = :exp"),
+		ExpressionAttributeValues:           values,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+
+	out, err := s.client.UpdateItem(ctx, input)
+	var exceeded *types.ConditionalCheckFailedException
+	if errors.As(err, &exceeded) {
+		return usageOf(exceeded.Item), ErrExceeded
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+	return usageOf(out.Attributes), nil
+}
+
+func usageOf(item map[string]types.AttributeValue) Usage {
+	return Usage{Failures: intAttr(item, "failures"), Bytes: intAttr(item, "bytes")}
+}
+
+func intAttr(item map[string]types.AttributeValue, name string) int64 {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+)
+
+// ErrExceeded is returned when a failure would take a project over a daily quota
+var ErrExceeded = errors.New("daily quota exceeded")
+
+// Usage is a project's failures and declared upload bytes in one UTC day. As
+// a limit, zero fields are unlimited.
+type Usage struct {
+	Failures int64 `json:"failures"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Unlimited reports whether u, as a limit, caps nothing
+func (u Usage) Unlimited() bool {
+	return u.Failures <= 0 && u.Bytes <= 0
+}
+
+// fits reports whether used plus add stays within limit
+func fits(used, add, limit Usage) bool {
+	return (limit.Failures <= 0 || used.Failures+add.Failures <= limit.Failures) &&
+		(limit.Bytes <= 0 || used.Bytes+add.Bytes <= limit.Bytes)
+}
+
+// Store keeps daily usage counters per project
+type Store interface {
+	// Add adds add to project's usage for day unless that would exceed limit,
+	// returning the usage after the addition. When it would, the usage is left
+	// unchanged and returned with ErrExceeded.
+	Add(ctx context.Context, project string, day time.Time, add, limit Usage) (Usage, error)
+}
+
+// Day truncates t to the start of its UTC day
+func Day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// Alert tells a project it has used Percent of a daily quota
+type Alert struct {
+	Project string
+	Day     time.Time
+	Used    Usage
+	Limit   Usage
+	Percent int
+}
+
+// Notifier delivers quota alerts
+type Notifier interface {
+	SendQuotaAlert(ctx context.Context, a Alert) error
+}
+
+// Enforcer charges failures against daily quotas and alerts projects once per
+// day when their usage crosses the alert threshold
+type Enforcer struct {
+	store        Store
+	notifier     Notifier
+	alertPercent int
+	now          func() time.Time
+}
+
+// NewEnforcer creates an enforcer counting usage in store. notifier may be
+// nil, and alertPercent 0 disables alerts.
+func NewEnforcer(store Store, notifier Notifier, alertPercent int) *Enforcer {
+	return &Enforcer{store: store, notifier: notifier, alertPercent: alertPercent, now: time.Now}
+}
+
+// Charge counts one failure of bytes against project's quota for the current
+// UTC day and returns the time the quota resets. It returns ErrExceeded,
+// leaving the usage unchanged, when the failure would exceed limit. A nil
+// enforcer charges nothing.
+func (e *Enforcer) Charge(ctx context.Context, project string, bytes int64, limit Usage) (time.Time, error) {
+	return e.charge(ctx, project, bytes, limit, true)
+}
+
+// ChargeExempt counts one failure of bytes like Charge, but never refuses
+// it, even once the project is over limit. It is meant for failures that
+// must not be dropped, such as critical ones; they still count towards the
+// quota and its alerts.
+func (e *Enforcer) ChargeExempt(ctx context.Context, project string, bytes int64, limit Usage) (time.Time, error) {
+	return e.charge(ctx, project, bytes, limit, false)
+}
+
+func (e *Enforcer) charge(ctx context.Context, project string, bytes int64, limit Usage, enforce bool) (time.Time, error) {
+	if e == nil || limit.Unlimited() {
+		return time.Time{}, nil
+	}
+	day := Day(e.now())
+	resets := day.Add(24 * time.Hour)
+
+	add := Usage{Failures: 1, Bytes: bytes}
+	ceiling := limit
+	if !enforce {
+		ceiling = Usage{}
+	}
+	used, err := e.store.Add(ctx, project, day, add, ceiling)
+	if errors.Is(err, ErrExceeded) {
+		metrics.QuotaRejections.Inc(project)
+		logging.FromContext(ctx).Warn().
+			Int64("failures", used.Failures).
+			Int64("bytes", used.Bytes).
+			Int64("maxFailures", limit.Failures).
+			Int64("maxBytes", limit.Bytes).
+			Msg("daily quota exceeded")
+		return resets, err
+	}
+	if err != nil {
+		return resets, fmt.Errorf("charge quota: %w", err)
+	}
+
+	// Additions are atomic, so exactly one failure crosses the threshold
+	before := Usage{Failures: used.Failures - add.Failures, Bytes: used.Bytes - add.Bytes}
+	if e.alertPercent > 0 && e.notifier != nil && crossed(before, used, limit, e.alertPercent) {
+		metrics.QuotaAlerts.Inc(project)
+		alert := Alert{Project: project, Day: day, Used: used, Limit: limit, Percent: e.alertPercent}
+		if err := e.notifier.SendQuotaAlert(ctx, alert); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("failed to send quota alert")
+		}
+	}
+	return resets, nil
+}
+
+// crossed reports whether going from before to after reached percent of
+// either limit
+func crossed(before, after, limit Usage, percent int) bool {
+	reached := func(used, max int64) bool {
+		return max > 0 && used*100 >= max*int64(percent)
+	}
+	return (!reached(before.Failures, limit.Failures) && reached(after.Failures, limit.Failures)) ||
+		(!reached(before.Bytes, limit.Bytes) && reached(after.Bytes, limit.Bytes))
+}
+
+// MemoryStore keeps usage in process, suitable for a single server
+type MemoryStore struct {
+	mu   sync.Mutex
+	days map[time.Time]map[string]Usage
+}
+
+// NewMemoryStore creates an empty in-process quota store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{days: make(map[time.Time]map[string]Usage)}
+}
+
+// Add adds add to project's usage for day unless that would exceed limit
+func (s *MemoryStore) Add(_ context.Context, project string, day time.Time, add, limit Usage) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day = Day(day)
+	// Only today's counters are ever charged again
+	for d := range s.days {
+		if d.Before(day) {
+			delete(s.days, d)
+		}
+	}
+	projects, ok := s.days[day]
+	if !ok {
+		projects = make(map[string]Usage)
+		s.days[day] = projects
+	}
+
+	used := projects[project]
+	if !fits(used, add, limit) {
+		return used, ErrExceeded
+	}
+	used.Failures += add.Failures
+	used.Bytes += add.Bytes
+	projects[project] = used
+	return used, nil
+}
+
+// New builds a store for the configured backend ("memory" or "dynamodb")
+func New(ctx context.Context, backend, region, table string) (Store, error) {
+	switch backend {
+	case "dynamodb":
+		if table == "" {
+			return nil, fmt.Errorf("quota backend dynamodb requires a table name")
+		}
+		return NewDynamoStore(ctx, region, table)
+	case "memory", "":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown quota backend %q", backend)
+	}
+}
@@ -0,0 +1,120 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// alerts records quota alerts
+type alerts []Alert
+
+func (a *alerts) SendQuotaAlert(_ context.Context, alert Alert) error {
+	*a = append(*a, alert)
+	return nil
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	limit := Usage{Failures: 2, Bytes: 100}
+
+	if used, err := s.Add(ctx, "myapp", day.Add(time.Hour), Usage{1, 60}, limit); err != nil || used != (Usage{1, 60}) {
+		t.Fatalf("Add() = %+v, %v", used, err)
+	}
+	// Over the byte limit: nothing is counted
+	if used, err := s.Add(ctx, "myapp", day, Usage{1, 50}, limit); !errors.Is(err, ErrExceeded) || used != (Usage{1, 60}) {
+		t.Fatalf("Add() = %+v, %v; want ErrExceeded with usage unchanged", used, err)
+	}
+	if _, err := s.Add(ctx, "myapp", day, Usage{1, 40}, limit); err != nil {
+		t.Fatalf("Add() error = %v, want the last failure to fit", err)
+	}
+	if _, err := s.Add(ctx, "myapp", day, Usage{1, 0}, limit); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Add() error = %v, want the failure limit enforced", err)
+	}
+
+	// Other projects and days are counted separately
+	if _, err := s.Add(ctx, "billing", day, Usage{1, 0}, limit); err != nil {
+		t.Errorf("Add(billing) error = %v", err)
+	}
+	if used, err := s.Add(ctx, "myapp", day.Add(24*time.Hour), Usage{1, 0}, limit); err != nil || used.Failures != 1 {
+		t.Errorf("Add(next day) = %+v, %v; want a fresh count", used, err)
+	}
+	if _, ok := s.days[day]; ok {
+		t.Error("previous day's counters were not dropped")
+	}
+}
+
+func TestEnforcer_Charge(t *testing.T) {
+	ctx := context.Background()
+	var sent alerts
+	e := NewEnforcer(NewMemoryStore(), &sent, 80)
+	now := time.Date(2026, 10, 16, 15, 30, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	limit := Usage{Failures: 10}
+
+	for i := 0; i < 10; i++ {
+		if _, err := e.Charge(ctx, "myapp", 5, limit); err != nil {
+			t.Fatalf("Charge() #%d error = %v", i+1, err)
+		}
+	}
+	if len(sent) != 1 || sent[0].Used.Failures != 8 || sent[0].Percent != 80 {
+		t.Fatalf("alerts = %+v, want one at the 8th failure", sent)
+	}
+
+	resets, err := e.Charge(ctx, "myapp", 5, limit)
+	if !errors.Is(err, ErrExceeded) {
+		t.Fatalf("Charge() error = %v, want ErrExceeded", err)
+	}
+	if want := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC); !resets.Equal(want) {
+		t.Errorf("resets = %v, want %v", resets, want)
+	}
+	if len(sent) != 1 {
+		t.Errorf("sent %d alerts, want no more once exceeded", len(sent))
+	}
+}
+
+func TestEnforcer_ChargeExempt(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	e := NewEnforcer(store, nil, 0)
+	limit := Usage{Failures: 1}
+
+	if _, err := e.Charge(ctx, "myapp", 0, limit); err != nil {
+		t.Fatal(err)
+	}
+	// Exempt failures are counted past the limit, and still hold back others
+	if _, err := e.ChargeExempt(ctx, "myapp", 0, limit); err != nil {
+		t.Fatalf("ChargeExempt() error = %v, want it never refused", err)
+	}
+	if used, _ := store.Add(ctx, "myapp", e.now(), Usage{}, Usage{}); used.Failures != 2 {
+		t.Errorf("failures = %d, want the exempt failure counted", used.Failures)
+	}
+	if _, err := e.Charge(ctx, "myapp", 0, limit); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Charge() error = %v, want ErrExceeded", err)
+	}
+}
+
+func TestEnforcer_Unlimited(t *testing.T) {
+	var e *Enforcer
+	if _, err := e.Charge(context.Background(), "myapp", 1<<40, Usage{Failures: 1}); err != nil {
+		t.Errorf("nil enforcer Charge() error = %v", err)
+	}
+	e = NewEnforcer(NewMemoryStore(), nil, 80)
+	for i := 0; i < 3; i++ {
+		if _, err := e.Charge(context.Background(), "myapp", 1<<40, Usage{}); err != nil {
+			t.Fatalf("Charge() without limits error = %v", err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(context.Background(), "dynamodb", "us-east-1", ""); err == nil {
+		t.Error("dynamodb without table should fail")
+	}
+	if _, err := New(context.Background(), "redis", "us-east-1", ""); err == nil {
+		t.Error("unknown backend should fail")
+	}
+}
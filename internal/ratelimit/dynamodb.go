@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxConflictRetries bounds optimistic-lock retries under contention
+const maxConflictRetries = 3
+
+// DynamoLimiter is a token bucket limiter whose state lives in DynamoDB, so it
+// is shared across Lambda instances. The table needs a string partition key
+// "pk"; enable TTL on the "expiresAt" attribute to clean up idle buckets.
+type DynamoLimiter struct {
+	client *dynamodb.Client
+	table  string
+	prefix string
+	rate   float64
+	burst  int
+	now    func() time.Time
+}
+
+// NewDynamoLimiter creates a DynamoDB-backed limiter. prefix namespaces keys so
+// several limiters can share one table.
+func NewDynamoLimiter(ctx context.Context, region, table, prefix string, rate float64, burst int) (*DynamoLimiter, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DynamoLimiter{
+		client: dynamodb.NewFromConfig(cfg),
+		table:  table,
+		prefix: prefix,
+		rate:   rate,
+		burst:  burst,
+		now:    time.Now,
+	}, nil
+}
+
+// Allow consumes a token for key using a conditional write on the bucket's last update time
+func (l *DynamoLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	pk := l.prefix + key
+
+	for attempt := 0; attempt < maxConflictRetries; attempt++ {
+		out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(l.table),
+			Key:            map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: pk}},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return false, 0, err
+		}
+
+		var prev bucket
+		var prevUpdated string
+		if out.Item != nil {
+			prev.tokens = numberAttr(out.Item, "tokens")
+			prevUpdated = stringNumberAttr(out.Item, "updatedAt")
+			if ms, err := strconv.ParseInt(prevUpdated, 10, 64); err == nil {
+				prev.updated = time.UnixMilli(ms)
+			}
+		}
+
+		now := l.now()
+		next, ok, wait := take(prev, now, l.rate, l.burst)
+		if !ok {
+			return false, wait, nil
+		}
+
+		full := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+		input := &dynamodb.PutItemInput{
+			TableName: aws.String(l.table),
+			Item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: pk},
+				"tokens":    &types.AttributeValueMemberN{Value: strconv.FormatFloat(next.tokens, 'f', -1, 64)},
+				"updatedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+				"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(full+time.Hour).Unix(), 10)},
+			},
+		}
+		if prevUpdated == "" {
+			input.ConditionExpression = aws.String("attribute_not_exists(pk)")
+		} else {
+			input.ConditionExpression = aws.String("updatedAt = :prev")
+			input.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":prev": &types.AttributeValueMemberN{Value: prevUpdated},
+			}
+		}
+
+		_, err = l.client.PutItem(ctx, input)
+		if err == nil {
+			return true, 0, nil
+		}
+
+		var conflict *types.ConditionalCheckFailedException
+		if !errors.As(err, &conflict) {
+			return false, 0, err
+		}
+	}
+
+	// Heavy contention on a single key: treat as limited rather than failing open
+	return false, time.Second, nil
+}
+
+func numberAttr(item map[string]types.AttributeValue, name string) float64 {
+	f, _ := strconv.ParseFloat(stringNumberAttr(item, name), 64)
+	return f
+}
+
+func stringNumberAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter decides whether a request identified by key may proceed.
+// When it may not, retryAfter is how long until a token is available.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration, err error)
+}
+
+// bucket is the token bucket state for a single key
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b at rate tokens/sec up to burst and consumes one token if available
+func take(b bucket, now time.Time, rate float64, burst int) (bucket, bool, time.Duration) {
+	if b.updated.IsZero() {
+		b.tokens = float64(burst)
+	} else if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return b, true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return b, false, wait
+}
+
+// MemoryLimiter is an in-process token bucket limiter suitable for a single server
+type MemoryLimiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter creates a limiter refilling rate tokens/sec with capacity burst
+func NewMemoryLimiter(rate float64, burst int) *MemoryLimiter {
+	return &MemoryLimiter{
+		rate:    rate,
+		burst:   burst,
+		now:     time.Now,
+		buckets: make(map[string]bucket),
+	}
+}
+
+// Allow consumes a token for key
+func (l *MemoryLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok, wait := take(l.buckets[key], now, l.rate, l.burst)
+	l.buckets[key] = b
+	return ok, wait, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.updated) > full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// New builds a limiter for the configured backend ("memory" or "dynamodb").
+// It returns a nil Limiter when rate is not positive, disabling the limit.
+func New(ctx context.Context, backend, region, table, prefix string, rate float64, burst int) (Limiter, error) {
+	if rate <= 0 {
+		return nil, nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	switch backend {
+	case "dynamodb":
+		if table == "" {
+			return nil, fmt.Errorf("rate limit backend dynamodb requires a table name")
+		}
+		return NewDynamoLimiter(ctx, region, table, prefix, rate, burst)
+	case "memory", "":
+		return NewMemoryLimiter(rate, burst), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
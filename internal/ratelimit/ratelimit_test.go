@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	l := NewMemoryLimiter(1, 2)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := l.Allow(ctx, "a"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+
+	ok, retryAfter, _ := l.Allow(ctx, "a")
+	if ok {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("retryAfter = %v, want 1s", retryAfter)
+	}
+
+	// Other keys have their own bucket
+	if ok, _, _ := l.Allow(ctx, "b"); !ok {
+		t.Error("independent key was limited")
+	}
+
+	// Refill after one second
+	now = now.Add(time.Second)
+	if ok, _, _ := l.Allow(ctx, "a"); !ok {
+		t.Error("request after refill was limited")
+	}
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := New(ctx, "memory", "", "", "", 0, 10)
+	if err != nil || l != nil {
+		t.Errorf("New() with zero rate = %v, %v; want nil, nil", l, err)
+	}
+
+	if _, err := New(ctx, "dynamodb", "us-east-1", "", "", 1, 10); err == nil {
+		t.Error("New() dynamodb without table should fail")
+	}
+
+	if _, err := New(ctx, "redis", "", "", "", 1, 10); err == nil {
+		t.Error("New() with unknown backend should fail")
+	}
+}
@@ -0,0 +1,228 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// DefaultHeaders are always redacted
+var DefaultHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Csrf-Token",
+}
+
+// DefaultJSONFields are redacted wherever they appear in a JSON document
+var DefaultJSONFields = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"api_key",
+	"apiKey",
+	"client_secret",
+}
+
+// DefaultPatterns match secrets embedded in free text
+var DefaultPatterns = []string{
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,    // email addresses
+	`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`,                  // bearer credentials
+	`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`, // JWTs
+	`\b(?:\d[ -]?){13,16}\b`,                            // card numbers
+}
+
+// Rules configure a Redactor. They extend, never replace, the defaults.
+type Rules struct {
+	// Headers are header names to redact (case-insensitive)
+	Headers []string
+	// JSONFields are JSON keys ("password") or dotted paths ("user.ssn") to redact
+	JSONFields []string
+	// Patterns are regular expressions whose matches are redacted in string values
+	Patterns []string
+}
+
+// Redactor strips sensitive data from URLs, headers and JSON bodies
+type Redactor struct {
+	headers  map[string]bool
+	fields   map[string]bool
+	paths    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// New builds a redactor from the defaults plus rules
+func New(rules Rules) (*Redactor, error) {
+	r := &Redactor{
+		headers: make(map[string]bool),
+		fields:  make(map[string]bool),
+		paths:   make(map[string]bool),
+	}
+
+	for _, h := range append(append([]string{}, DefaultHeaders...), rules.Headers...) {
+		r.headers[strings.ToLower(strings.TrimSpace(h))] = true
+	}
+	for _, f := range append(append([]string{}, DefaultJSONFields...), rules.JSONFields...) {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if strings.Contains(f, ".") {
+			r.paths[f] = true
+		} else if f != "" {
+			r.fields[f] = true
+		}
+	}
+	for _, p := range append(append([]string{}, DefaultPatterns...), rules.Patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// Default returns a redactor using only the built-in rules
+func Default() *Redactor {
+	r, err := New(Rules{})
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// String redacts pattern matches in s
+func (r *Redactor) String(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Placeholder)
+	}
+	return s
+}
+
+// URL removes userinfo and replaces every query parameter value
+func (r *Redactor) URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return r.String(raw)
+	}
+
+	u.User = nil
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{Placeholder}
+		}
+		u.RawQuery = q.Encode()
+	}
+	u.Fragment = ""
+	return r.String(u.String())
+}
+
+// IsSensitiveHeader reports whether a header's value must be redacted
+func (r *Redactor) IsSensitiveHeader(name string) bool {
+	return r.headers[strings.ToLower(name)]
+}
+
+// Headers returns a copy of h with sensitive values replaced
+func (r *Redactor) Headers(h map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, vals := range h {
+		if r.IsSensitiveHeader(k) {
+			out[k] = []string{Placeholder}
+			continue
+		}
+		cp := make([]string, len(vals))
+		for i, v := range vals {
+			cp[i] = r.String(v)
+		}
+		out[k] = cp
+	}
+	return out
+}
+
+// HeadersJSON redacts a headers document, which may map names to a string or a list of strings
+func (r *Redactor) HeadersJSON(b []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	for k, v := range doc {
+		if r.IsSensitiveHeader(k) {
+			doc[k] = Placeholder
+			continue
+		}
+		doc[k] = r.walk(v, "")
+	}
+	return json.Marshal(doc)
+}
+
+// JSON redacts sensitive fields and pattern matches throughout a JSON document
+func (r *Redactor) JSON(b []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.walk(doc, ""))
+}
+
+func (r *Redactor) walk(v interface{}, path string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			p := strings.ToLower(k)
+			if path != "" {
+				p = path + "." + p
+			}
+			if r.fields[strings.ToLower(k)] || r.paths[p] {
+				t[k] = Placeholder
+				continue
+			}
+			t[k] = r.walk(child, p)
+		}
+		return t
+	case []interface{}:
+		for i, child := range t {
+			t[i] = r.walk(child, path)
+		}
+		return t
+	case string:
+		return r.String(t)
+	default:
+		return v
+	}
+}
+
+// ParseRules builds rules from comma-separated header and field lists and a
+// JSON array of regular expressions
+func ParseRules(headers, fields, patternsJSON string) (Rules, error) {
+	rules := Rules{
+		Headers:    splitList(headers),
+		JSONFields: splitList(fields),
+	}
+	if patternsJSON != "" {
+		if err := json.Unmarshal([]byte(patternsJSON), &rules.Patterns); err != nil {
+			return Rules{}, fmt.Errorf("parse redact patterns: %w", err)
+		}
+	}
+	return rules, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+// Package reload applies changes to per-project limits, notification routes
+// and API keys without a restart
+package reload
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/profiles"
+	"github.com/yourorg/failure-uploader/internal/routing"
+)
+
+// Snapshot is an immutable view of the reloadable settings. A request reads
+// one snapshot throughout, so it never sees half of a reload.
+type Snapshot struct {
+	// Config supplies the global upload limits and content types; its other
+	// settings only take effect on restart
+	Config   *config.Config
+	Profiles *profiles.Profiles
+	// Routes is nil unless routes are read from NOTIFY_ROUTES
+	Routes   *routing.Table
+	LoadedAt time.Time
+}
+
+// Build parses the reloadable settings of cfg
+func Build(cfg *config.Config) (*Snapshot, error) {
+	profs, err := profiles.Parse(cfg.ProjectProfiles)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{Config: cfg, Profiles: profs, LoadedAt: time.Now().UTC()}
+	if cfg.NotifyRoutesBackend == "config" || cfg.NotifyRoutesBackend == "" {
+		if snap.Routes, err = routing.ParseTable(cfg.NotifyRoutes); err != nil {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// Store holds the current snapshot and replaces it on Reload. API keys are
+// applied to the registries in place, each swapping its whole key set.
+type Store struct {
+	current   atomic.Pointer[Snapshot]
+	load      func() (*config.Config, error)
+	apiKeys   *apikeys.Registry
+	adminKeys *apikeys.Registry
+
+	// mu serializes reloads
+	mu sync.Mutex
+}
+
+// New creates a store whose first snapshot is built from cfg. Reload re-reads
+// the configuration with config.Load and applies keys to apiKeys and
+// adminKeys.
+func New(cfg *config.Config, apiKeys, adminKeys *apikeys.Registry) (*Store, error) {
+	snap, err := Build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{load: config.Load, apiKeys: apiKeys, adminKeys: adminKeys}
+	s.current.Store(snap)
+	return s, nil
+}
+
+// Current returns the current snapshot, nil for a nil Store
+func (s *Store) Current() *Snapshot {
+	if s == nil {
+		return nil
+	}
+	return s.current.Load()
+}
+
+// Reload re-reads the configuration, including the config file and secret
+// references, and applies it. Nothing is applied when any reloadable setting
+// is invalid.
+func (s *Store) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := s.load()
+	if err != nil {
+		return err
+	}
+	snap, err := Build(cfg)
+	if err != nil {
+		return err
+	}
+	keys, err := apikeys.Load(cfg.APIKeysJSON, cfg.APIKey)
+	if err != nil {
+		return err
+	}
+	adminKeys, err := apikeys.LoadAdmin(cfg.AdminAPIKeys)
+	if err != nil {
+		return err
+	}
+
+	s.current.Store(snap)
+	if s.apiKeys != nil {
+		s.apiKeys.SetConfigured(keys)
+	}
+	if s.adminKeys != nil {
+		s.adminKeys.SetConfigured(adminKeys)
+	}
+	logging.FromContext(ctx).Info().
+		Int("apiKeys", keys.Len()).
+		Int("adminKeys", adminKeys.Len()).
+		Msg("configuration reloaded")
+	return nil
+}
+
+// reload runs Reload, logging failures
+func (s *Store) reload(ctx context.Context) {
+	if err := s.Reload(ctx); err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("failed to reload configuration - keeping the previous one")
+	}
+}
+
+// Notify reloads whenever the process receives one of sigs, until ctx is done
+func (s *Store) Notify(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			s.reload(ctx)
+		}
+	}
+}
+
+// Watch reloads every interval until ctx is done
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.reload(ctx)
+		}
+	}
+}
+
+// Routes returns a read-only routing.Editor backed by the current
+// snapshot's routes
+func (s *Store) Routes() routing.Editor {
+	return routes{s}
+}
+
+// routes resolves through the current snapshot
+type routes struct {
+	s *Store
+}
+
+func (r routes) table() *routing.Table {
+	if snap := r.s.Current(); snap != nil {
+		return snap.Routes
+	}
+	return nil
+}
+
+func (r routes) Resolve(ctx context.Context, tenant, project, env string) (routing.Route, bool, error) {
+	return r.table().Resolve(ctx, tenant, project, env)
+}
+
+func (r routes) Routes(ctx context.Context) (map[string]routing.Route, error) {
+	return r.table().Routes(ctx)
+}
+
+func (r routes) PutRoute(ctx context.Context, name string, route routing.Route) error {
+	return r.table().PutRoute(ctx, name, route)
+}
+
+func (r routes) DeleteRoute(ctx context.Context, name string) (bool, error) {
+	return r.table().DeleteRoute(ctx, name)
+}
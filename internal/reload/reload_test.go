@@ -0,0 +1,102 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/profiles"
+)
+
+func testConfig(profs, routes, keys string) *config.Config {
+	return &config.Config{
+		NotifyRoutesBackend: "config",
+		ProjectProfiles:     profs,
+		NotifyRoutes:        routes,
+		APIKeysJSON:         keys,
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	registry, _ := apikeys.Load(`[{"id":"ios","key":"old"}]`, "")
+	s, err := New(testConfig(`{"myapp":{"maxFiles":1}}`, `{"default":{"emails":["a@example.com"]}}`, ""), registry, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	first := s.Current()
+
+	s.load = func() (*config.Config, error) {
+		return testConfig(`{"myapp":{"maxFiles":5}}`, `{"default":{"emails":["b@example.com"]}}`, `[{"id":"ios","key":"new"}]`), nil
+	}
+	if err := s.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if got := s.Current().Profiles.For("myapp", profiles.Profile{}).MaxFiles; got != 5 {
+		t.Errorf("MaxFiles = %d, want the reloaded profile", got)
+	}
+	if got := first.Profiles.For("myapp", profiles.Profile{}).MaxFiles; got != 1 {
+		t.Errorf("previous snapshot changed: MaxFiles = %d", got)
+	}
+	route, _, _ := s.Routes().Resolve(context.Background(), "", "myapp", "prod")
+	if len(route.Emails) != 1 || route.Emails[0] != "b@example.com" {
+		t.Errorf("route = %+v, want the reloaded route", route)
+	}
+	if _, ok := registry.Lookup("new"); !ok {
+		t.Error("reloaded API key not applied")
+	}
+	if _, ok := registry.Lookup("old"); ok {
+		t.Error("replaced API key still accepted")
+	}
+}
+
+func TestStore_ReloadInvalid(t *testing.T) {
+	registry, _ := apikeys.Load(`[{"id":"ios","key":"old"}]`, "")
+	s, _ := New(testConfig(`{"myapp":{"maxFiles":1}}`, "", ""), registry, nil)
+	first := s.Current()
+
+	tests := []struct {
+		name string
+		load func() (*config.Config, error)
+	}{
+		{"config error", func() (*config.Config, error) { return nil, errors.New("MAX_FILES: must not be negative") }},
+		{"invalid profiles", func() (*config.Config, error) { return testConfig(`{"myapp":{"maxFiles":-1}}`, "", ""), nil }},
+		{"invalid routes", func() (*config.Config, error) { return testConfig("", `{"default":{"webhooks":["ftp://x"]}}`, ""), nil }},
+		{"invalid keys", func() (*config.Config, error) { return testConfig("", "", `[{"id":"ios"}]`), nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.load = tt.load
+			if err := s.Reload(context.Background()); err == nil {
+				t.Fatal("Reload() error = nil")
+			}
+			if s.Current() != first {
+				t.Error("snapshot replaced by an invalid configuration")
+			}
+			if _, ok := registry.Lookup("old"); !ok {
+				t.Error("API keys replaced by an invalid configuration")
+			}
+		})
+	}
+}
+
+func TestStore_DynamoRoutes(t *testing.T) {
+	cfg := testConfig("", "", "")
+	cfg.NotifyRoutesBackend = "dynamodb"
+	s, err := New(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if s.Current().Routes != nil {
+		t.Error("routes of the dynamodb backend should not be in the snapshot")
+	}
+}
+
+func TestStore_Nil(t *testing.T) {
+	var s *Store
+	if s.Current() != nil {
+		t.Error("Current() of a nil Store should be nil")
+	}
+}
@@ -0,0 +1,205 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/repro"
+)
+
+// MaxResponseBody is the most of a replayed response body that is read back
+const MaxResponseBody = 64 << 10
+
+// ErrHostNotAllowed is returned when a replay targets a host outside the allowlist
+var ErrHostNotAllowed = errors.New("replay target host is not allowed")
+
+// Options adjust a captured request before it is replayed
+type Options struct {
+	// BaseURL replaces the scheme and host of the captured URL; its path, if
+	// any, is prepended to the captured path
+	BaseURL string
+	// Headers override captured headers by name; an empty value removes the header
+	Headers map[string]string
+}
+
+// Result is the outcome of a replay. Err is set when no response was received.
+type Result struct {
+	StatusCode int
+	Headers    map[string][]string
+	// Body holds at most MaxResponseBody bytes; Truncated reports whether there was more
+	Body      []byte
+	Truncated bool
+	Duration  time.Duration
+	Err       error
+}
+
+// Replayer re-sends captured requests, but only to allowlisted hosts
+type Replayer struct {
+	allowed []string
+	client  *http.Client
+}
+
+// New creates a replayer for allowedHosts, a comma-separated list of host
+// names where "*.example.com" matches any subdomain. An empty list allows no
+// host, so only dry runs are possible.
+func New(allowedHosts string, timeout time.Duration) *Replayer {
+	r := &Replayer{
+		client: &http.Client{
+			Timeout: timeout,
+			// A redirect could leave the allowlist, so it is reported instead of followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	for _, h := range strings.Split(allowedHosts, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			r.allowed = append(r.allowed, h)
+		}
+	}
+	return r
+}
+
+// Allowed reports whether requests may be replayed against host; a nil
+// replayer allows none
+func (r *Replayer) Allowed(host string) bool {
+	if r == nil {
+		return false
+	}
+	host = strings.ToLower(host)
+	for _, a := range r.allowed {
+		if host == a || (strings.HasPrefix(a, "*.") && strings.HasSuffix(host, a[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prepare applies opts to the captured request. Header and query values
+// redacted when the failure was stored cannot be replayed, so they are dropped;
+// headers can be supplied again through opts.
+func Prepare(req repro.Request, opts Options) (repro.Request, error) {
+	out := repro.Request{Method: strings.ToUpper(req.Method), Body: req.Body}
+	if out.Method == "" {
+		out.Method = http.MethodGet
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return out, fmt.Errorf("parse captured url: %w", err)
+	}
+	if opts.BaseURL != "" {
+		base, err := url.Parse(opts.BaseURL)
+		if err != nil {
+			return out, fmt.Errorf("parse base url: %w", err)
+		}
+		u.Scheme, u.Host, u.User = base.Scheme, base.Host, nil
+		if p := strings.TrimSuffix(base.Path, "/"); p != "" {
+			u.Path = p + u.Path
+			u.RawPath = ""
+		}
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k, values := range q {
+			if kept := withoutPlaceholders(values); len(kept) > 0 {
+				q[k] = kept
+			} else {
+				delete(q, k)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	out.URL = u.String()
+
+	out.Headers = make(map[string][]string, len(req.Headers)+len(opts.Headers))
+	for name, values := range req.Headers {
+		if repro.IsConnectionHeader(name) || overridden(opts.Headers, name) {
+			continue
+		}
+		if kept := withoutPlaceholders(values); len(kept) > 0 {
+			out.Headers[name] = kept
+		}
+	}
+	for name, v := range opts.Headers {
+		if v != "" {
+			out.Headers[name] = []string{v}
+		}
+	}
+	return out, nil
+}
+
+// withoutPlaceholders drops the values that were redacted when the failure was stored
+func withoutPlaceholders(values []string) []string {
+	var kept []string
+	for _, v := range values {
+		if v != redact.Placeholder {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// overridden reports whether headers sets name, ignoring case
+func overridden(headers map[string]string, name string) bool {
+	for h := range headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send replays req and reads back the response. Failures to reach the target
+// are reported in Result.Err; the error is only for requests that were not sent.
+func (r *Replayer) Send(ctx context.Context, req repro.Request) (*Result, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	if !r.Allowed(u.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
+	}
+
+	var body io.Reader
+	if len(req.Body) > 0 {
+		body = bytes.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	for name, values := range req.Headers {
+		for _, v := range values {
+			httpReq.Header.Add(name, v)
+		}
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return &Result{Duration: time.Since(start), Err: err}, nil
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseBody+1))
+	res := &Result{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       b,
+		Duration:   time.Since(start),
+		Err:        err,
+	}
+	if len(b) > MaxResponseBody {
+		res.Body, res.Truncated = b[:MaxResponseBody], true
+	}
+	return res, nil
+}
@@ -0,0 +1,114 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/redact"
+	"github.com/yourorg/failure-uploader/internal/repro"
+)
+
+func TestAllowed(t *testing.T) {
+	r := New(" api.example.com, *.staging.example.com ", time.Second)
+	for host, want := range map[string]bool{
+		"api.example.com":          true,
+		"API.example.com":          true,
+		"eu.staging.example.com":   true,
+		"staging.example.com":      false,
+		"evil.com":                 false,
+		"api.example.com.evil.com": false,
+	} {
+		if got := r.Allowed(host); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if New("", time.Second).Allowed("api.example.com") {
+		t.Error("empty allowlist allowed a host")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	got, err := Prepare(repro.Request{
+		Method: "post",
+		URL:    "https://api.example.com/v1/orders?id=7&token=%5BREDACTED%5D",
+		Headers: map[string][]string{
+			"Authorization":  {redact.Placeholder},
+			"Content-Length": {"2"},
+			"Accept":         {"application/json"},
+			"x-trace":        {"old"},
+		},
+		Body: []byte("{}"),
+	}, Options{
+		BaseURL: "http://localhost:8080/api/",
+		Headers: map[string]string{"X-Trace": "new", "Accept": "", "Authorization": "Bearer test"},
+	})
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+
+	if got.Method != "POST" || got.URL != "http://localhost:8080/api/v1/orders?id=7" {
+		t.Errorf("Prepare() = %s %s", got.Method, got.URL)
+	}
+	want := map[string][]string{"X-Trace": {"new"}, "Authorization": {"Bearer test"}}
+	if !reflect.DeepEqual(got.Headers, want) {
+		t.Errorf("headers = %v, want %v", got.Headers, want)
+	}
+
+	// Redacted values are dropped when not overridden
+	got, _ = Prepare(repro.Request{URL: "https://x/", Headers: map[string][]string{"Cookie": {redact.Placeholder}}}, Options{})
+	if got.Method != http.MethodGet || len(got.Headers) != 0 {
+		t.Errorf("Prepare() = %+v", got)
+	}
+}
+
+func TestSend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPut || r.Header.Get("X-Test") != "1" || string(body) != "hello" {
+			t.Errorf("request = %s %v %q", r.Method, r.Header, body)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(strings.Repeat("a", MaxResponseBody+1)))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	r := New(u.Hostname(), 5*time.Second)
+	res, err := r.Send(context.Background(), repro.Request{
+		Method:  http.MethodPut,
+		URL:     srv.URL + "/x",
+		Headers: map[string][]string{"X-Test": {"1"}},
+		Body:    []byte("hello"),
+	})
+	if err != nil || res.Err != nil {
+		t.Fatalf("Send() error = %v, %v", err, res.Err)
+	}
+	if res.StatusCode != http.StatusAccepted || !res.Truncated || len(res.Body) != MaxResponseBody {
+		t.Errorf("Send() = %d, truncated %v, %d bytes", res.StatusCode, res.Truncated, len(res.Body))
+	}
+
+	if _, err := New("api.example.com", time.Second).Send(context.Background(), repro.Request{Method: "GET", URL: srv.URL}); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("Send() to unlisted host error = %v", err)
+	}
+}
+
+func TestSend_DoesNotFollowRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	res, err := New(u.Hostname(), 5*time.Second).Send(context.Background(), repro.Request{Method: "GET", URL: srv.URL})
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Errorf("Send() = %+v, %v; want the 302 itself", res, err)
+	}
+}
@@ -0,0 +1,165 @@
+package repro
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yourorg/failure-uploader/internal/redact"
+)
+
+// BodyFile is the artifact a curl command reads bodies from when they are not inlined
+const BodyFile = "request.raw"
+
+// MaxInlineBody is the largest text body written into the command itself
+const MaxInlineBody = 8 << 10
+
+// connectionHeaders follow from the URL and body, or describe the original
+// connection, so they are never reproduced
+var connectionHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"connection":        true,
+	"transfer-encoding": true,
+	"keep-alive":        true,
+}
+
+// Request is a captured request to reproduce
+type Request struct {
+	Method  string
+	URL     string
+	Headers map[string][]string
+	// Body is nil when request.raw was not uploaded
+	Body []byte
+}
+
+// ParseHeaders parses a request.headers.json document, which may map names to a
+// string or a list of strings
+func ParseHeaders(b []byte) (map[string][]string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parse headers: %w", err)
+	}
+	out := make(map[string][]string, len(doc))
+	for name, v := range doc {
+		switch t := v.(type) {
+		case string:
+			out[name] = []string{t}
+		case []interface{}:
+			for _, e := range t {
+				if s, ok := e.(string); ok {
+					out[name] = append(out[name], s)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// IsConnectionHeader reports whether name is set per connection rather than
+// taken from a captured request
+func IsConnectionHeader(name string) bool {
+	return connectionHeaders[strings.ToLower(name)]
+}
+
+// describingHeaders describe a request without authorizing it, so their
+// values are safe to show in notifications
+var describingHeaders = map[string]bool{
+	"accept":          true,
+	"accept-encoding": true,
+	"accept-language": true,
+	"content-type":    true,
+	"user-agent":      true,
+}
+
+// Curl renders req as a curl command. Sensitive headers are replaced with the
+// redaction placeholder and the body is redacted with r. Binary, multipart and
+// large bodies are read from BodyFile instead of being inlined.
+func Curl(req Request, r *redact.Redactor) string {
+	return render(req, r, func(b []byte, contentType string) string {
+		return body(b, contentType, r)
+	})
+}
+
+// NotificationCurl renders req like Curl for notification channels, which are
+// read outside the API's access control. Any header may carry a credential the
+// redaction rules do not know, so only describing headers keep their values,
+// and the body is always read from BodyFile.
+func NotificationCurl(req Request, r *redact.Redactor) string {
+	masked := make(map[string][]string, len(req.Headers))
+	for name, values := range req.Headers {
+		if describingHeaders[strings.ToLower(name)] {
+			masked[name] = values
+			continue
+		}
+		masked[name] = make([]string, len(values))
+		for i := range values {
+			masked[name][i] = redact.Placeholder
+		}
+	}
+	req.Headers = masked
+	return render(req, r, func([]byte, string) string {
+		return "@" + BodyFile
+	})
+}
+
+// render renders req as a curl command, with the --data-binary argument of a
+// body returned by bodyArg
+func render(req Request, r *redact.Redactor, bodyArg func(b []byte, contentType string) string) string {
+	method := strings.ToUpper(req.Method)
+	parts := []string{"curl"}
+	switch method {
+	case "", http.MethodGet:
+	case http.MethodHead:
+		parts[0] += " --head"
+	default:
+		parts[0] += " -X " + method
+	}
+	parts[0] += " " + quote(req.URL)
+
+	headers := r.Headers(req.Headers)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if !IsConnectionHeader(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	contentType := ""
+	for _, name := range names {
+		for _, v := range headers[name] {
+			parts = append(parts, "-H "+quote(name+": "+v))
+			if strings.EqualFold(name, "Content-Type") {
+				contentType = v
+			}
+		}
+	}
+
+	if len(req.Body) > 0 {
+		parts = append(parts, "--data-binary "+bodyArg(req.Body, contentType))
+	}
+	return strings.Join(parts, " \\\n  ")
+}
+
+// body returns the curl argument for b: the redacted text when it is small
+// enough to inline, otherwise a reference to BodyFile
+func body(b []byte, contentType string, r *redact.Redactor) string {
+	if len(b) > MaxInlineBody || !utf8.Valid(b) || strings.HasPrefix(strings.ToLower(contentType), "multipart/") {
+		return "@" + BodyFile
+	}
+	if json.Valid(b) {
+		if redacted, err := r.JSON(b); err == nil {
+			return quote(string(redacted))
+		}
+	}
+	return quote(r.String(string(b)))
+}
+
+// quote single-quotes s for POSIX shells
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
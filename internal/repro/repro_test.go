@@ -0,0 +1,87 @@
+package repro
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/redact"
+)
+
+func TestParseHeaders(t *testing.T) {
+	h, err := ParseHeaders([]byte(`{"Accept":"application/json","X-Tag":["a","b"],"X-Bad":1}`))
+	if err != nil {
+		t.Fatalf("ParseHeaders() error = %v", err)
+	}
+	if len(h["Accept"]) != 1 || len(h["X-Tag"]) != 2 || h["X-Bad"] != nil {
+		t.Errorf("ParseHeaders() = %v", h)
+	}
+	if _, err := ParseHeaders([]byte(`[]`)); err == nil {
+		t.Error("ParseHeaders() accepted a non-object")
+	}
+}
+
+func TestCurl(t *testing.T) {
+	got := Curl(Request{
+		Method: "post",
+		URL:    "https://api.example.com/v1/submit?q=it's",
+		Headers: map[string][]string{
+			"Content-Type":   {"application/json"},
+			"Authorization":  {"Bearer secret-token"},
+			"Content-Length": {"27"},
+			"Accept":         {"application/json"},
+		},
+		Body: []byte(`{"name":"x","password":"hunter2"}`),
+	}, redact.Default())
+
+	want := `curl -X POST 'https://api.example.com/v1/submit?q=it'\''s' \
+  -H 'Accept: application/json' \
+  -H 'Authorization: [REDACTED]' \
+  -H 'Content-Type: application/json' \
+  --data-binary '{"name":"x","password":"[REDACTED]"}'`
+	if got != want {
+		t.Errorf("Curl() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNotificationCurl(t *testing.T) {
+	got := NotificationCurl(Request{
+		Method: "POST",
+		URL:    "https://api.example.com/v1/submit",
+		Headers: map[string][]string{
+			"Content-Type":  {"application/json"},
+			"Authorization": {"Bearer secret-token"},
+			"X-Secret":      {"s3cr3t", "other"},
+		},
+		Body: []byte(`{"card":"4111"}`),
+	}, redact.Default())
+
+	want := `curl -X POST 'https://api.example.com/v1/submit' \
+  -H 'Authorization: [REDACTED]' \
+  -H 'Content-Type: application/json' \
+  -H 'X-Secret: [REDACTED]' \
+  -H 'X-Secret: [REDACTED]' \
+  --data-binary @request.raw`
+	if got != want {
+		t.Errorf("NotificationCurl() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCurl_BodyFromFile(t *testing.T) {
+	r := redact.Default()
+	for name, req := range map[string]Request{
+		"binary":    {Method: "PUT", URL: "https://x", Body: []byte{0xff, 0xfe, 0x00}},
+		"large":     {Method: "POST", URL: "https://x", Body: []byte(strings.Repeat("a", MaxInlineBody+1))},
+		"multipart": {Method: "POST", URL: "https://x", Headers: map[string][]string{"Content-Type": {"multipart/form-data; boundary=b"}}, Body: []byte("--b--")},
+	} {
+		if got := Curl(req, r); !strings.HasSuffix(got, "--data-binary @"+BodyFile) {
+			t.Errorf("%s: Curl() = %s", name, got)
+		}
+	}
+
+	if got := Curl(Request{Method: "GET", URL: "https://x"}, r); got != "curl 'https://x'" {
+		t.Errorf("Curl(GET) = %s", got)
+	}
+	if got := Curl(Request{Method: "HEAD", URL: "https://x"}, r); got != "curl --head 'https://x'" {
+		t.Errorf("Curl(HEAD) = %s", got)
+	}
+}
@@ -0,0 +1,49 @@
+// Package requestid carries a request's ID from the HTTP layer to the AWS calls
+// made on its behalf, so a single client complaint can be traced through the
+// service logs, S3 server access logs, CloudTrail and SES events.
+package requestid
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// Header carries the request ID on requests and responses
+const Header = "X-Request-Id"
+
+// MaxLength is the longest caller-supplied request ID that is accepted
+const MaxLength = 128
+
+// validID matches request IDs that are safe to echo in headers, logs and
+// User-Agent strings: API Gateway IDs, UUIDs and chi's host/prefix-counter IDs
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:/=+-]+$`)
+
+// Valid reports whether a caller-supplied request ID can be reused
+func Valid(id string) bool {
+	return id != "" && len(id) <= MaxLength && validID.MatchString(id)
+}
+
+// FromContext returns the request ID assigned by the HTTP middleware, or ""
+func FromContext(ctx context.Context) string {
+	return chimiddleware.GetReqID(ctx)
+}
+
+// APIOption appends the request ID found in an operation's context to the
+// User-Agent of the AWS call, where S3 server access logs and CloudTrail record
+// it. Add it to a client with config.WithAPIOptions.
+func APIOption(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("RequestIDUserAgent", func(
+		ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+	) (middleware.BuildOutput, middleware.Metadata, error) {
+		if id := FromContext(ctx); id != "" {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				req.Header.Set("User-Agent", req.Header.Get("User-Agent")+" request-id/"+id)
+			}
+		}
+		return next.HandleBuild(ctx, in)
+	}), middleware.After)
+}
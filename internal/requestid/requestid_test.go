@@ -0,0 +1,65 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"c0ffee12-3456-7890-abcd-ef0123456789", true},
+		{"Jd5xbgGjoAMEJ8w=", true},
+		{"host/AbCdEfGhIj-000042", true},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("a", MaxLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+// captureClient records the User-Agent of the first request and fails it
+type captureClient struct {
+	userAgent string
+}
+
+func (c *captureClient) Do(r *http.Request) (*http.Response, error) {
+	c.userAgent = r.Header.Get("User-Agent")
+	return nil, context.Canceled
+}
+
+func TestAPIOption(t *testing.T) {
+	capture := &captureClient{}
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		Credentials:      aws.AnonymousCredentials{},
+		HTTPClient:       capture,
+		APIOptions:       []func(*middleware.Stack) error{APIOption},
+		RetryMaxAttempts: 1,
+	})
+
+	ctx := context.WithValue(context.Background(), chimiddleware.RequestIDKey, "req-123")
+	client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String("bucket")})
+	if !strings.HasSuffix(capture.userAgent, " request-id/req-123") {
+		t.Errorf("User-Agent = %q, want request-id/req-123 suffix", capture.userAgent)
+	}
+
+	client.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String("bucket")})
+	if strings.Contains(capture.userAgent, "request-id/") {
+		t.Errorf("User-Agent without request ID = %q", capture.userAgent)
+	}
+}
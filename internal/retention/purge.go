@@ -0,0 +1,228 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/archive"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// AuditPrefix is the S3 prefix under which purge audit records are stored
+const AuditPrefix = "audit/retention/"
+
+// Store is the subset of S3 operations the purge needs
+type Store interface {
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+	DeleteObjects(ctx context.Context, keys []string) error
+	TagObjects(ctx context.Context, keys []string, tags map[string]string) error
+	ObjectTags(ctx context.Context, key string) (map[string]string, error)
+	ObjectSizes(ctx context.Context, keys []string) (map[string]int64, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+}
+
+// Entry records one purged failure
+type Entry struct {
+	Project   string `json:"project"`
+	Env       string `json:"env"`
+	FailureID string `json:"failureId"`
+	Prefix    string `json:"prefix"`
+	Date      string `json:"date"`
+	Objects   int    `json:"objects"`
+	// Bytes is the size of the purged objects, 0 when it could not be read
+	Bytes  int64  `json:"bytes"`
+	Action Action `json:"action"`
+	Days   int    `json:"retentionDays"`
+}
+
+// Audit is the record of a purge run stored under AuditPrefix
+type Audit struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Entries    []Entry   `json:"entries"`
+	Errors     []string  `json:"errors,omitempty"`
+	// Project is set for runs limited to one project
+	Project string `json:"project,omitempty"`
+}
+
+// AuditKey returns the audit record key for a run started at t
+// Format: audit/retention/YYYY-MM-DD/{RFC3339 time}.json
+func AuditKey(t time.Time) string {
+	t = t.UTC()
+	return AuditPrefix + t.Format("2006-01-02") + "/" + t.Format(time.RFC3339) + ".json"
+}
+
+// Purge applies policies at now: every failure dated at least its retention
+// days before today is deleted or tagged. The run is recorded under AuditPrefix
+// even when nothing was purged; the audit is returned for logging.
+func Purge(ctx context.Context, store Store, policies *Policies, now time.Time) (*Audit, error) {
+	return run(ctx, store, policies, "", now)
+}
+
+// PurgeProject applies policies at now to project's failures only, for runs
+// triggered on demand
+func PurgeProject(ctx context.Context, store Store, policies *Policies, project string, now time.Time) (*Audit, error) {
+	return run(ctx, store, policies, project, now)
+}
+
+// run purges every project, or only project when it is set
+func run(ctx context.Context, store Store, policies *Policies, project string, now time.Time) (*Audit, error) {
+	now = now.UTC()
+	today := now.Truncate(24 * time.Hour)
+	audit := &Audit{StartedAt: now, Entries: []Entry{}, Project: project}
+
+	pairs, err := archive.ProjectEnvs(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+
+	for _, pair := range pairs {
+		if project != "" && pair.Project != project {
+			continue
+		}
+		rule := policies.For(pair.Project, pair.Env)
+		if rule.Days <= 0 {
+			continue
+		}
+		cutoff := today.AddDate(0, 0, -rule.Days)
+
+		for _, envPrefix := range pair.Prefixes() {
+			objKeys, err := store.ListKeys(ctx, envPrefix)
+			if err != nil {
+				return nil, fmt.Errorf("list %s: %w", envPrefix, err)
+			}
+
+			for _, f := range expired(objKeys, cutoff) {
+				entry, err := purge(ctx, store, f, rule)
+				if err != nil {
+					logging.FromContext(ctx).Error().Err(err).Str("prefix", f.loc.Prefix).Msg("failed to purge failure")
+					audit.Errors = append(audit.Errors, err.Error())
+					continue
+				}
+				if entry != nil {
+					audit.Entries = append(audit.Entries, *entry)
+				}
+			}
+		}
+	}
+
+	audit.FinishedAt = time.Now().UTC()
+	b, err := json.Marshal(audit)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.PutObjectBytes(ctx, AuditKey(now), "application/json", b); err != nil {
+		return audit, fmt.Errorf("write audit record: %w", err)
+	}
+
+	logging.FromContext(ctx).Info().
+		Int("purged", len(audit.Entries)).
+		Int("failed", len(audit.Errors)).
+		Str("audit", AuditKey(now)).
+		Msg("retention purge finished")
+
+	if len(audit.Errors) > 0 {
+		return audit, fmt.Errorf("%d failures could not be purged", len(audit.Errors))
+	}
+	return audit, nil
+}
+
+// BytesByProject sums the bytes of the purged failures per project. Tagged
+// failures count as purged, since the bucket's lifecycle rule expires them.
+func (a *Audit) BytesByProject() map[string]int64 {
+	bytes := make(map[string]int64)
+	if a == nil {
+		return bytes
+	}
+	for _, e := range a.Entries {
+		bytes[e.Project] += e.Bytes
+	}
+	return bytes
+}
+
+// failureKeys is a failure and its object keys
+type failureKeys struct {
+	loc  keys.Location
+	keys []string
+}
+
+// expired groups objKeys by failure, keeping failures dated on or before cutoff
+func expired(objKeys []string, cutoff time.Time) []failureKeys {
+	var failures []failureKeys
+	index := make(map[string]int)
+	for _, k := range objKeys {
+		loc, ok := keys.Parse(k)
+		if !ok || loc.Date.After(cutoff) {
+			continue
+		}
+		i, seen := index[loc.Prefix]
+		if !seen {
+			i = len(failures)
+			index[loc.Prefix] = i
+			failures = append(failures, failureKeys{loc: loc})
+		}
+		failures[i].keys = append(failures[i].keys, k)
+	}
+	return failures
+}
+
+// purge applies rule to one failure. Failures already tagged by an earlier run
+// return a nil entry so they are audited once.
+func purge(ctx context.Context, store Store, f failureKeys, rule Rule) (*Entry, error) {
+	var size int64
+	switch rule.Action {
+	case ActionTag:
+		tags, err := store.ObjectTags(ctx, f.keys[0])
+		if err != nil {
+			return nil, fmt.Errorf("read tags of %s: %w", f.keys[0], err)
+		}
+		if tags[TagKey] == TagValue {
+			return nil, nil
+		}
+		// Keep the upload tags, which are the same on every object of a failure
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[TagKey] = TagValue
+		size = totalSize(ctx, store, f)
+		if err := store.TagObjects(ctx, f.keys, tags); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", f.loc.Prefix, err)
+		}
+	default:
+		size = totalSize(ctx, store, f)
+		if err := store.DeleteObjects(ctx, f.keys); err != nil {
+			return nil, fmt.Errorf("delete %s: %w", f.loc.Prefix, err)
+		}
+	}
+
+	return &Entry{
+		Project:   f.loc.Project,
+		Env:       f.loc.Env,
+		FailureID: f.loc.FailureID,
+		Prefix:    f.loc.Prefix,
+		Date:      f.loc.Date.Format("2006-01-02"),
+		Objects:   len(f.keys),
+		Bytes:     size,
+		Action:    rule.Action,
+		Days:      rule.Days,
+	}, nil
+}
+
+// totalSize returns the bytes stored by a failure, or 0 when they cannot be
+// read: the sizes only feed storage accounting, so the purge goes ahead
+func totalSize(ctx context.Context, store Store, f failureKeys) int64 {
+	sizes, err := store.ObjectSizes(ctx, f.keys)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("prefix", f.loc.Prefix).Msg("failed to read sizes of purged objects")
+		return 0
+	}
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,104 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Action is what the purge does with failures past their retention
+type Action string
+
+const (
+	// ActionDelete deletes every object of the failure
+	ActionDelete Action = "delete"
+	// ActionTag tags every object with TagKey=TagValue so a bucket lifecycle
+	// rule can transition or expire them, e.g. to Glacier
+	ActionTag Action = "tag"
+)
+
+// Tag applied by ActionTag
+const (
+	TagKey   = "retention"
+	TagValue = "expired"
+)
+
+// Rule is the retention of a project or env
+type Rule struct {
+	// Days is the age at which failures are purged (0 = kept forever)
+	Days   int    `json:"days"`
+	Action Action `json:"action,omitempty"`
+}
+
+// Policies maps "project/env", "project", "*/env" and "default" to rules,
+// most specific first
+type Policies struct {
+	rules    map[string]Rule
+	fallback Rule
+}
+
+// Parse parses a JSON object of rules. defaultDays applies when no rule
+// matches, e.g. the global RETENTION_DAYS.
+func Parse(s string, defaultDays int) (*Policies, error) {
+	p := &Policies{rules: make(map[string]Rule), fallback: Rule{Days: defaultDays, Action: ActionDelete}}
+	if defaultDays < 0 {
+		return nil, fmt.Errorf("parse retention policies: default days cannot be negative")
+	}
+	if s == "" {
+		return p, nil
+	}
+	if err := json.Unmarshal([]byte(s), &p.rules); err != nil {
+		return nil, fmt.Errorf("parse retention policies: %w", err)
+	}
+	for name, r := range p.rules {
+		if r.Days < 0 {
+			return nil, fmt.Errorf("parse retention policies: %s: days cannot be negative", name)
+		}
+		switch r.Action {
+		case "":
+			r.Action = ActionDelete
+		case ActionDelete, ActionTag:
+		default:
+			return nil, fmt.Errorf("parse retention policies: %s: unknown action %q", name, r.Action)
+		}
+		p.rules[name] = r
+	}
+	return p, nil
+}
+
+// For returns the rule for project/env
+func (p *Policies) For(project, env string) Rule {
+	for _, name := range []string{project + "/" + env, project, "*/" + env, "default"} {
+		if r, ok := p.rules[name]; ok {
+			return r
+		}
+	}
+	return p.fallback
+}
+
+// DaysFor returns the retention of project/env in days (0 = kept forever)
+func (p *Policies) DaysFor(project, env string) int {
+	return p.For(project, env).Days
+}
+
+// Periods returns every distinct positive retention period, ascending
+func (p *Policies) Periods() []int {
+	seen := make(map[int]bool)
+	var periods []int
+	for _, r := range append(rulesOf(p.rules), p.fallback) {
+		if r.Days > 0 && !seen[r.Days] {
+			seen[r.Days] = true
+			periods = append(periods, r.Days)
+		}
+	}
+	sort.Ints(periods)
+	return periods
+}
+
+func rulesOf(m map[string]Rule) []Rule {
+	rules := make([]Rule, 0, len(m))
+	for _, r := range m {
+		rules = append(rules, r)
+	}
+	return rules
+}
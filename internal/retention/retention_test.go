@@ -0,0 +1,153 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func TestPolicies(t *testing.T) {
+	p, err := Parse(`{
+		"myapp/staging": {"days": 7},
+		"myapp": {"days": 90, "action": "tag"},
+		"*/prod": {"days": 30},
+		"default": {"days": 60}
+	}`, 0)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		project, env string
+		want         Rule
+	}{
+		{"myapp", "staging", Rule{Days: 7, Action: ActionDelete}},
+		{"myapp", "prod", Rule{Days: 90, Action: ActionTag}},
+		{"other", "prod", Rule{Days: 30, Action: ActionDelete}},
+		{"other", "dev", Rule{Days: 60, Action: ActionDelete}},
+	}
+	for _, tt := range tests {
+		if got := p.For(tt.project, tt.env); got != tt.want {
+			t.Errorf("For(%q, %q) = %+v, want %+v", tt.project, tt.env, got, tt.want)
+		}
+	}
+
+	if got := p.Periods(); !reflect.DeepEqual(got, []int{7, 30, 60, 90}) {
+		t.Errorf("Periods() = %v", got)
+	}
+
+	fallback, _ := Parse("", 14)
+	if got := fallback.DaysFor("any", "env"); got != 14 {
+		t.Errorf("fallback DaysFor() = %d, want 14", got)
+	}
+
+	for _, bad := range []string{`{"x": {"days": -1}}`, `{"x": {"days": 1, "action": "shred"}}`, `[`} {
+		if _, err := Parse(bad, 0); err == nil {
+			t.Errorf("Parse(%s) error = nil", bad)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	store.Touch(
+		"failures/myapp/prod/2024/02/15/old/envelope.json",
+		"failures/myapp/prod/2024/02/15/old/request.raw",
+		"failures/v2/myapp/prod/dt=2024-02-14/oldv2/envelope.json",
+		"failures/myapp/prod/2024/02/16/edge/envelope.json",
+		"failures/myapp/prod/2024/02/17/fresh/envelope.json",
+		"failures/myapp/staging/2024/01/01/kept/envelope.json",
+		"failures/archived/prod/2024/01/01/cold/envelope.json",
+	)
+	store.TagObjects(ctx, []string{"failures/archived/prod/2024/01/01/cold/envelope.json"}, map[string]string{"project": "archived"})
+	policies, err := Parse(`{"*/prod": {"days": 30}, "archived": {"days": 30, "action": "tag"}}`, 0)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	now := time.Date(2024, 3, 17, 3, 0, 0, 0, time.UTC)
+
+	audit, err := Purge(ctx, store, policies, now)
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+
+	var purged []string
+	for _, e := range audit.Entries {
+		purged = append(purged, e.FailureID+":"+string(e.Action))
+	}
+	sort.Strings(purged)
+	if want := []string{"cold:tag", "edge:delete", "old:delete", "oldv2:delete"}; !reflect.DeepEqual(purged, want) {
+		t.Errorf("purged = %v, want %v", purged, want)
+	}
+
+	for _, k := range []string{
+		"failures/myapp/prod/2024/02/15/old/request.raw",
+		"failures/v2/myapp/prod/dt=2024-02-14/oldv2/envelope.json",
+		"failures/myapp/prod/2024/02/16/edge/envelope.json",
+	} {
+		if _, ok := store.Object(k); ok {
+			t.Errorf("%s not deleted", k)
+		}
+	}
+	for _, k := range []string{
+		"failures/myapp/prod/2024/02/17/fresh/envelope.json",
+		"failures/myapp/staging/2024/01/01/kept/envelope.json",
+		"failures/archived/prod/2024/01/01/cold/envelope.json",
+	} {
+		if _, ok := store.Object(k); !ok {
+			t.Errorf("%s deleted", k)
+		}
+	}
+	if tags, _ := store.ObjectTags(ctx, "failures/archived/prod/2024/01/01/cold/envelope.json"); tags[TagKey] != TagValue || tags["project"] != "archived" {
+		t.Errorf("cold failure tags = %v, want the upload tags kept", tags)
+	}
+	if bytes := audit.BytesByProject(); bytes["myapp"] != 4 || bytes["archived"] != 1 {
+		t.Errorf("BytesByProject() = %v, want myapp 4 and archived 1", bytes)
+	}
+
+	var stored Audit
+	obj, _ := store.Object(AuditKey(now))
+	if err := json.Unmarshal(obj.Data, &stored); err != nil {
+		t.Fatalf("audit record: %v", err)
+	}
+	if len(stored.Entries) != 4 {
+		t.Errorf("audit record has %d entries, want 4", len(stored.Entries))
+	}
+
+	// Tagged failures are audited once
+	again, err := Purge(ctx, store, policies, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("second Purge() error = %v", err)
+	}
+	if len(again.Entries) != 1 || again.Entries[0].FailureID != "fresh" {
+		t.Errorf("second run entries = %+v, want only fresh", again.Entries)
+	}
+}
+
+func TestPurgeProject(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	store.Touch(
+		"failures/myapp/prod/2024/02/15/old/envelope.json",
+		"failures/other/prod/2024/02/15/theirs/envelope.json",
+	)
+	policies, _ := Parse("", 30)
+	now := time.Date(2024, 3, 17, 3, 0, 0, 0, time.UTC)
+
+	audit, err := PurgeProject(ctx, store, policies, "myapp", now)
+	if err != nil {
+		t.Fatalf("PurgeProject() error = %v", err)
+	}
+	if len(audit.Entries) != 1 || audit.Entries[0].FailureID != "old" || audit.Project != "myapp" {
+		t.Errorf("PurgeProject() = %+v, want only myapp's failure", audit)
+	}
+	if _, ok := store.Object("failures/other/prod/2024/02/15/theirs/envelope.json"); !ok {
+		t.Error("another project's failure was purged")
+	}
+}
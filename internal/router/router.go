@@ -2,35 +2,203 @@ package router
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/audit"
 	"github.com/yourorg/failure-uploader/internal/config"
 	"github.com/yourorg/failure-uploader/internal/handlers"
+	"github.com/yourorg/failure-uploader/internal/ipacl"
+	"github.com/yourorg/failure-uploader/internal/jwtauth"
 	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/ratelimit"
+	"github.com/yourorg/failure-uploader/internal/signing"
+	"github.com/yourorg/failure-uploader/internal/ui"
+	"github.com/yourorg/failure-uploader/internal/usage"
 )
 
+// Deps holds optional collaborators used by router middleware
+type Deps struct {
+	Registry   *apikeys.Registry
+	Verifier   *jwtauth.Verifier
+	IPLimiter  ratelimit.Limiter
+	KeyLimiter ratelimit.Limiter
+	Usage      usage.Store
+	// Signatures verifies HMAC-signed requests; nil disables them
+	Signatures *signing.Verifier
+	// Authorizer maps API Gateway authorizer claims for AUTH_MODE=authorizer
+	Authorizer *jwtauth.Authorizer
+	// AdminRegistry authenticates the admin API; without keys it is not mounted
+	AdminRegistry *apikeys.Registry
+	// Audit records denials, admin actions and usage; nil disables auditing
+	Audit *audit.Recorder
+	// IPACLs restricts route groups to source addresses; groups without one
+	// are open
+	IPACLs ipacl.Rules
+}
+
 // New creates a new HTTP router with all routes configured
-func New(cfg *config.Config, h *handlers.Handler) http.Handler {
+func New(cfg *config.Config, h *handlers.Handler, deps Deps) http.Handler {
 	r := chi.NewRouter()
+	auth := middleware.Authenticators{
+		Registry:   deps.Registry,
+		Verifier:   deps.Verifier,
+		Signatures: deps.Signatures,
+		Authorizer: deps.Authorizer,
+	}
 
 	// Global middleware
 	r.Use(chimiddleware.Recoverer)
-	r.Use(chimiddleware.RequestID)
+	r.Use(middleware.TrustedProxies(cfg.TrustedProxyDepth))
+	r.Use(middleware.RequestID)
 	r.Use(middleware.RequestLogger)
-	r.Use(middleware.CORS)
+	r.Use(middleware.Audit(deps.Audit))
+	r.Use(middleware.CORS(corsPolicy(cfg)))
+	r.Use(middleware.Compress(cfg.GzipLevel))
 
-	// Health check (no auth required)
+	// Health checks, build info and API specification (no auth required)
 	r.Get("/health", h.HealthCheck)
+	r.Get("/health/live", h.HealthCheck)
+	r.Get("/health/ready", h.Readiness)
+	r.Get("/version", h.Version)
+	r.Get("/openapi.json", h.OpenAPISpec)
+
+	// Web dashboard; the page is public and its API calls carry the user's credentials
+	if cfg.Dashboard {
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.IPFilter(deps.IPACLs.For(ipacl.GroupDashboard)))
+			r.Get("/ui", ui.Redirect)
+			r.Handle("/ui/*", http.StripPrefix("/ui/", ui.Handler()))
+		})
+	}
+
+	// Short and acknowledgment links used in notifications (authenticated by
+	// their signature, so they open from an email client)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.IPFilter(deps.IPACLs.For(ipacl.GroupAPI)))
+		r.Use(middleware.RateLimit(deps.IPLimiter, middleware.ClientIPKey))
+
+		r.Get("/r/{failureId}/*", h.RedirectArtifact)
+		r.Get("/ack/{failureId}", h.AckLink)
+		r.Post("/ack/{failureId}", h.ConfirmAck)
+	})
+
+	// SES bounce and complaint events from SNS (authenticated by message signature)
+	if cfg.SESEventsTopicARN != "" {
+		r.With(middleware.RateLimit(deps.IPLimiter, middleware.ClientIPKey)).Post("/v1/ses-events", h.SESEvents)
+	}
+
+	// Admin API, authenticated only by admin keys
+	if deps.AdminRegistry.Len() > 0 {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.IPFilter(deps.IPACLs.For(ipacl.GroupAdmin)))
+			r.Use(middleware.RateLimit(deps.IPLimiter, middleware.ClientIPKey))
+			r.Use(middleware.AdminAuth(deps.AdminRegistry))
+			r.Use(middleware.BodyLimit(cfg.MaxRequestBytes), middleware.Decompress(cfg.MaxRequestBytes))
+
+			r.Get("/projects", h.AdminListProjects)
+			r.Get("/projects/{project}", h.AdminGetProject)
+			r.Post("/projects/{project}/purge", h.AdminPurgeProject)
+			r.Get("/projects/{project}/storage", h.AdminProjectStorage)
+
+			r.Get("/keys", h.AdminListKeys)
+			r.Post("/keys", h.AdminCreateKey)
+			r.Delete("/keys/{id}", h.AdminRevokeKey)
+			r.Post("/keys/{id}/rotate", h.AdminRotateKey)
+			r.Post("/keys/{id}/disable", h.AdminDisableKey)
+			r.Post("/keys/{id}/enable", h.AdminEnableKey)
+			r.Get("/keys/{id}/usage", h.KeyUsage)
+
+			r.Get("/routes", h.AdminListRoutes)
+			r.Put("/routes/{project}", h.AdminPutRoute)
+			r.Put("/routes/{project}/{env}", h.AdminPutRoute)
+			r.Delete("/routes/{project}", h.AdminDeleteRoute)
+			r.Delete("/routes/{project}/{env}", h.AdminDeleteRoute)
+		})
+	}
+
+	// Apply API key or bearer token auth to the versioned API
+	api := func(r chi.Router) {
+		r.Use(middleware.IPFilter(deps.IPACLs.For(ipacl.GroupAPI)))
+		r.Use(middleware.RateLimit(deps.IPLimiter, middleware.ClientIPKey))
+		r.Use(middleware.Authenticate(cfg.AuthMode, auth, cfg.AuthEnabled))
+		r.Use(middleware.RequireTenant(cfg.MultiTenant))
+		r.Use(middleware.Usage(deps.Usage))
+		r.Use(middleware.RateLimit(deps.KeyLimiter, middleware.PrincipalKey))
+	}
 
 	// API v1 routes
 	r.Route("/v1", func(r chi.Router) {
-		// Apply API key auth to v1 routes
-		r.Use(middleware.APIKeyAuth(cfg.APIKey, cfg.AuthEnabled))
+		api(r)
 
-		r.Post("/upload-ticket", h.UploadTicket)
-		r.Post("/upload-complete", h.UploadComplete)
+		// Proxied artifacts are streamed to S3 and capped by the upload limits
+		if cfg.ProxyUploads {
+			r.With(middleware.RequireScope(apikeys.ScopeTicketCreate)).Put("/failures/{failureId}/artifacts/*", h.UploadArtifact)
+		}
+
+		// Artifacts are streamed from S3 for clients that cannot reach presigned URLs
+		r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/failures/{failureId}/artifacts/*", h.DownloadArtifact)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.BodyLimit(cfg.MaxRequestBytes), middleware.Decompress(cfg.MaxRequestBytes))
+
+			r.With(middleware.RequireScope(apikeys.ScopeTicketCreate)).Post("/upload-ticket", h.UploadTicket)
+			r.With(middleware.RequireScope(apikeys.ScopeTicketCreate)).Post("/upload-ticket/{failureId}/presign", h.RetryUploadPresign)
+			r.With(middleware.RequireScope(apikeys.ScopeTicketCreate)).Post("/upload-complete", h.UploadComplete)
+
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/groups", h.ListGroups)
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/stats", h.GetStats)
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/failures", h.ListFailures)
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/failures/{failureId}", h.GetFailure)
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/failures/{failureId}/downloads", h.GetDownloads)
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Get("/failures/{failureId}/har", h.GetFailureHAR)
+			r.With(middleware.RequireScope(apikeys.ScopeFailureRead)).Post("/failures/{failureId}/ack", h.AckFailure)
+			r.With(middleware.RequireScope(apikeys.ScopeAdmin)).Post("/failures/{failureId}/restore", h.RestoreFailure)
+			r.With(middleware.RequireScope(apikeys.ScopeAdmin)).Post("/failures/{failureId}/replay", h.ReplayFailure)
+			r.With(middleware.RequireScope(apikeys.ScopeAdmin)).Post("/failures/{failureId}/release", h.ReleaseFailure)
+			r.With(middleware.RequireScope(apikeys.ScopeAdmin)).Delete("/failures/{failureId}", h.DeleteFailure)
+			r.With(middleware.RequireScope(apikeys.ScopeAdmin)).Get("/admin/keys/{id}/usage", h.KeyUsage)
+			r.With(middleware.RequireScope(apikeys.ScopeAdmin)).Post("/admin/erasure", h.EraseUser)
+		})
+	})
+
+	// API v2 routes: presigned POST uploads and ticket-based completion. Reads
+	// are unchanged and stay on v1.
+	r.Route("/v2", func(r chi.Router) {
+		r.NotFound(h.NotFoundV2)
+		r.MethodNotAllowed(h.MethodNotAllowedV2)
+		api(r)
+		r.Use(middleware.BodyLimit(cfg.MaxRequestBytes), middleware.Decompress(cfg.MaxRequestBytes))
+
+		r.With(middleware.RequireScope(apikeys.ScopeTicketCreate)).Post("/tickets", h.CreateTicketV2)
+		r.With(middleware.RequireScope(apikeys.ScopeTicketCreate)).Post("/tickets/{failureId}/complete", h.CompleteTicketV2)
 	})
 
 	return r
 }
+
+// corsPolicy builds the CORS policy of the configured origins, methods and headers
+func corsPolicy(cfg *config.Config) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowedOrigins:   splitList(cfg.CORSAllowedOrigins),
+		AllowedMethods:   splitList(cfg.CORSAllowedMethods),
+		AllowedHeaders:   splitList(cfg.CORSAllowedHeaders),
+		ExposedHeaders:   []string{apierror.RequestIDHeader, handlers.IdempotentReplayedHeader, "Retry-After"},
+		MaxAge:           cfg.CORSMaxAge,
+		AllowCredentials: cfg.CORSAllowCredentials,
+	}
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,556 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apierror"
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/handlers"
+	"github.com/yourorg/failure-uploader/internal/ipacl"
+	"github.com/yourorg/failure-uploader/internal/middleware"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+// API keys of the harness, both limited to the myapp project
+const (
+	uploaderKey = "uploader-secret"
+	readerKey   = "reader-secret"
+)
+
+// harness serves the full router over HTTP, with storage behind presigned
+// URLs that clients upload to over HTTP too
+type harness struct {
+	t        *testing.T
+	api      *httptest.Server
+	store    handlers.Store
+	notifier *testsupport.Notifier
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	cfg := &config.Config{
+		AuthMode:      middleware.AuthModeAPIKey,
+		AuthEnabled:   true,
+		MaxBodyBytes:  1024,
+		MaxFileBytes:  1024,
+		MaxTotalBytes: 2048,
+		PresignTTL:    15 * time.Minute,
+		NotifyMode:    "immediate",
+
+		MaxRequestBytes: 4096,
+		GzipLevel:       5,
+
+		CORSAllowedOrigins: "https://*.example.com, http://localhost:3000",
+		CORSAllowedMethods: "GET, POST, OPTIONS",
+		CORSAllowedHeaders: "Content-Type, X-Api-Key",
+		CORSMaxAge:         10 * time.Minute,
+	}
+	registry, err := apikeys.NewRegistry([]apikeys.Key{
+		{ID: "uploader", Secret: uploaderKey, Projects: []string{"myapp"}, Scopes: []apikeys.Scope{apikeys.ScopeTicketCreate}},
+		{ID: "reader", Secret: readerKey, Projects: []string{"myapp"}, Scopes: []apikeys.Scope{apikeys.ScopeFailureRead}},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	hs := &harness{t: t, store: newStore(t), notifier: &testsupport.Notifier{}}
+	h := handlers.NewHandler(cfg, hs.store, hs.notifier)
+	hs.api = httptest.NewServer(New(cfg, h, Deps{Registry: registry}))
+	t.Cleanup(hs.api.Close)
+	return hs
+}
+
+// newStore returns the in-memory store served over HTTP, or a presigner for
+// the LocalStack at LOCALSTACK_ENDPOINT. The LocalStack bucket,
+// LOCALSTACK_BUCKET or failure-uploads, must exist.
+func newStore(t *testing.T) handlers.Store {
+	t.Helper()
+
+	endpoint := os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		store := testsupport.NewStore()
+		srv := httptest.NewServer(store)
+		t.Cleanup(srv.Close)
+		store.BaseURL = srv.URL
+		return store
+	}
+
+	bucket := os.Getenv("LOCALSTACK_BUCKET")
+	if bucket == "" {
+		bucket = "failure-uploads"
+	}
+	presigner, err := s3client.NewPresigner(context.Background(), bucket, "us-east-1", 15*time.Minute, s3client.Endpoint{
+		URL:             endpoint,
+		UsePathStyle:    true,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	})
+	if err != nil {
+		t.Fatalf("NewPresigner() error = %v", err)
+	}
+	return presigner
+}
+
+// cleanup deletes the objects of the failure at prefix when the test ends,
+// so runs against LocalStack leave the bucket as they found it
+func (hs *harness) cleanup(failureID, prefix string) {
+	hs.t.Cleanup(func() {
+		ctx := context.Background()
+		keys, _ := hs.store.ListKeys(ctx, prefix)
+		hs.store.DeleteObjects(ctx, append(keys, tickets.Key(failureID)))
+	})
+}
+
+// do sends a JSON request to the API with apiKey, decoding the response into out
+func (hs *harness) do(method, path, apiKey string, body, out any) *http.Response {
+	hs.t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			hs.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, hs.api.URL+path, r)
+	if err != nil {
+		hs.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://app.example.com")
+	if apiKey != "" {
+		req.Header.Set(middleware.APIKeyHeader, apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		hs.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			hs.t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// upload PUTs data to a presigned URL with its signed headers, like a client
+func (hs *harness) upload(up models.PresignedUpload, contentType string, data []byte) {
+	hs.t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, up.PutURL, bytes.NewReader(data))
+	if err != nil {
+		hs.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range up.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		hs.t.Fatalf("upload %s: %v", up.Key, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		hs.t.Fatalf("upload %s: status = %d", up.Key, resp.StatusCode)
+	}
+}
+
+// post uploads data with a presigned POST form, sending its fields before the
+// file like a browser form
+func (hs *harness) post(up models.PresignedPost, data []byte) {
+	hs.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for k, v := range up.Fields {
+		form.WriteField(k, v)
+	}
+	file, err := form.CreateFormFile("file", path.Base(up.Key))
+	if err != nil {
+		hs.t.Fatal(err)
+	}
+	file.Write(data)
+	form.Close()
+
+	resp, err := http.Post(up.URL, form.FormDataContentType(), &body)
+	if err != nil {
+		hs.t.Fatalf("post %s: %v", up.Key, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		hs.t.Fatalf("post %s: status = %d", up.Key, resp.StatusCode)
+	}
+}
+
+func ticketRequest(project string) models.UploadTicketRequest {
+	return models.UploadTicketRequest{
+		Project: project,
+		Env:     "prod",
+		Request: models.RequestInfo{Method: "POST", URL: "https://api.example.com/orders", BodyBytes: 12},
+	}
+}
+
+func TestIntegration_UploadFlow(t *testing.T) {
+	hs := newHarness(t)
+
+	var ticket models.UploadTicketResponse
+	resp := hs.do(http.MethodPost, "/v1/upload-ticket", uploaderKey, ticketRequest("myapp"), &ticket)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload-ticket status = %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		t.Error("upload-ticket response has no CORS headers")
+	}
+	hs.cleanup(ticket.FailureID, ticket.S3Prefix)
+
+	u := ticket.Uploads
+	env, _ := json.Marshal(models.Envelope{
+		FailureID: ticket.FailureID,
+		Project:   "myapp",
+		Env:       "prod",
+		Request:   models.RequestInfo{Method: "POST", URL: "https://api.example.com/orders"},
+		CreatedAt: time.Now().UTC(),
+	})
+	hs.upload(u.Envelope, "application/json", env)
+	hs.upload(u.RequestRaw, "application/octet-stream", []byte(`{"item":"x"}`))
+	hs.upload(u.RequestHeaders, "application/json", []byte(`{}`))
+	hs.upload(u.ResponseRaw, "application/octet-stream", []byte(`{"error":"boom"}`))
+	uploaded := []string{u.Envelope.Key, u.RequestRaw.Key, u.RequestHeaders.Key, u.ResponseRaw.Key}
+
+	var done models.UploadCompleteResponse
+	complete := models.UploadCompleteRequest{FailureID: ticket.FailureID, Project: "myapp", Env: "prod", UploadedKeys: uploaded}
+	if resp := hs.do(http.MethodPost, "/v1/upload-complete", uploaderKey, complete, &done); resp.StatusCode != http.StatusOK || done.Status != "ok" {
+		t.Fatalf("upload-complete status = %d, response = %+v", resp.StatusCode, done)
+	}
+
+	stored, err := hs.store.ListKeys(context.Background(), ticket.S3Prefix)
+	if err != nil {
+		t.Fatalf("ListKeys() error = %v", err)
+	}
+	have := make(map[string]bool, len(stored))
+	for _, k := range stored {
+		have[k] = true
+	}
+	for _, k := range uploaded {
+		if !have[k] {
+			t.Errorf("stored keys = %v, missing %s", stored, k)
+		}
+	}
+
+	sent := hs.notifier.Sent()
+	if len(sent) != 1 || sent[0].FailureID != ticket.FailureID || sent[0].Project != "myapp" {
+		t.Fatalf("notifications = %+v, want one for the failure", sent)
+	}
+
+	// The failure is readable with a read key, and a retried completion is
+	// not notified again
+	var failure models.FailureResponse
+	if resp := hs.do(http.MethodGet, "/v1/failures/"+ticket.FailureID+"?project=myapp&env=prod&prefix="+url.QueryEscape(ticket.S3Prefix), readerKey, nil, &failure); resp.StatusCode != http.StatusOK {
+		t.Fatalf("get failure status = %d", resp.StatusCode)
+	}
+	if failure.Envelope.FailureID != ticket.FailureID || failure.Envelope.Request.URL != "https://api.example.com/orders" {
+		t.Errorf("failure = %+v", failure.Envelope)
+	}
+	if resp := hs.do(http.MethodPost, "/v1/upload-complete", uploaderKey, complete, nil); resp.Header.Get(handlers.IdempotentReplayedHeader) != "true" {
+		t.Errorf("retried upload-complete was not replayed (status %d)", resp.StatusCode)
+	}
+	if hs.notifier.Calls() != 1 {
+		t.Errorf("notified %d times, want once", hs.notifier.Calls())
+	}
+}
+
+func TestIntegration_V2UploadFlow(t *testing.T) {
+	hs := newHarness(t)
+
+	var ticket models.TicketResponse
+	resp := hs.do(http.MethodPost, "/v2/tickets", uploaderKey, ticketRequest("myapp"), &ticket)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create ticket status = %d", resp.StatusCode)
+	}
+	hs.cleanup(ticket.FailureID, ticket.S3Prefix)
+
+	u := ticket.Uploads
+	hs.post(u.RequestRaw, []byte(`{"item":"x"}`))
+	hs.post(u.ResponseRaw, []byte(`{"error":"boom"}`))
+
+	var done models.UploadCompleteResponse
+	completePath := "/v2/tickets/" + ticket.FailureID + "/complete"
+	if resp := hs.do(http.MethodPost, completePath, uploaderKey, models.CompleteTicketRequest{}, &done); resp.StatusCode != http.StatusOK || done.Status != "ok" {
+		t.Fatalf("complete status = %d, response = %+v", resp.StatusCode, done)
+	}
+
+	var failure models.FailureResponse
+	if resp := hs.do(http.MethodGet, "/v1/failures/"+ticket.FailureID+"?project=myapp&env=prod&prefix="+url.QueryEscape(ticket.S3Prefix), readerKey, nil, &failure); resp.StatusCode != http.StatusOK {
+		t.Fatalf("get failure status = %d", resp.StatusCode)
+	}
+	if failure.Envelope.Request.URL != "https://api.example.com/orders" {
+		t.Errorf("failure = %+v, want the generated envelope", failure.Envelope)
+	}
+	if sent := hs.notifier.Sent(); len(sent) != 1 || sent[0].FailureID != ticket.FailureID {
+		t.Errorf("notifications = %+v, want one for the failure", sent)
+	}
+
+	// Unknown v2 routes and methods answer with problems
+	var p apierror.Problem
+	if resp := hs.do(http.MethodPost, "/v2/upload-ticket", uploaderKey, ticketRequest("myapp"), &p); resp.StatusCode != http.StatusNotFound || p.Code != apierror.CodeNotFound {
+		t.Errorf("unknown route = %d %q, want 404 not_found", resp.StatusCode, p.Code)
+	}
+	if resp := hs.do(http.MethodGet, "/v2/tickets", uploaderKey, nil, &p); resp.StatusCode != http.StatusMethodNotAllowed || p.Code != apierror.CodeMethodNotAllowed {
+		t.Errorf("wrong method = %d %q, want 405 method_not_allowed", resp.StatusCode, p.Code)
+	}
+}
+
+func TestIntegration_Auth(t *testing.T) {
+	hs := newHarness(t)
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		project string
+		status  int
+		code    apierror.Code
+	}{
+		{"missing key", "", "myapp", http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"unknown key", "wrong-secret", "myapp", http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"missing scope", readerKey, "myapp", http.StatusForbidden, apierror.CodeForbidden},
+		{"other project", uploaderKey, "billing", http.StatusForbidden, apierror.CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p apierror.Problem
+			resp := hs.do(http.MethodPost, "/v1/upload-ticket", tt.apiKey, ticketRequest(tt.project), &p)
+			if resp.StatusCode != tt.status || p.Code != tt.code {
+				t.Errorf("status = %d, code = %q; want %d %q", resp.StatusCode, p.Code, tt.status, tt.code)
+			}
+			// Browsers only read errors that carry CORS headers
+			if resp.Header.Get("Access-Control-Allow-Origin") == "" {
+				t.Error("error response has no CORS headers")
+			}
+		})
+	}
+	if hs.notifier.Calls() != 0 {
+		t.Errorf("notified %d times, want none", hs.notifier.Calls())
+	}
+}
+
+func TestIntegration_RequestBodies(t *testing.T) {
+	hs := newHarness(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   apierror.Code
+		field  string
+	}{
+		{
+			name:   "too large",
+			body:   `{"project":"myapp","env":"prod","request":{"method":"POST","url":"https://api.example.com/` + strings.Repeat("a", 5000) + `"}}`,
+			status: http.StatusRequestEntityTooLarge,
+			code:   apierror.CodeTooLarge,
+		},
+		{
+			name:   "unknown field",
+			body:   `{"project":"myapp","env":"prod","enviroment":"prod","request":{"method":"POST","url":"https://api.example.com/orders"}}`,
+			status: http.StatusBadRequest,
+			code:   apierror.CodeInvalidJSON,
+			field:  "enviroment",
+		},
+		{
+			// Newer clients may send fields this version does not know
+			name:   "unknown field of a newer schema",
+			body:   `{"schemaVersion":99,"project":"myapp","env":"prod","future":true,"request":{"method":"POST","url":"https://api.example.com/orders"}}`,
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p apierror.Problem
+			resp := hs.do(http.MethodPost, "/v1/upload-ticket", uploaderKey, json.RawMessage(tt.body), &p)
+			if resp.StatusCode != tt.status || p.Code != tt.code {
+				t.Fatalf("status = %d, code = %q; want %d %q", resp.StatusCode, p.Code, tt.status, tt.code)
+			}
+			if tt.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.field) {
+				t.Errorf("errors = %+v, want the unknown field %q", p.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestIntegration_Gzip(t *testing.T) {
+	hs := newHarness(t)
+
+	var body bytes.Buffer
+	send := func(encoding string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, hs.api.URL+"/v1/upload-ticket", bytes.NewReader(body.Bytes()))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", encoding)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set(middleware.APIKeyHeader, uploaderKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	compress := func(v any) {
+		body.Reset()
+		gz := gzip.NewWriter(&body)
+		json.NewEncoder(gz).Encode(v)
+		gz.Close()
+	}
+
+	compress(ticketRequest("myapp"))
+	resp := send("gzip")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status = %d, Content-Encoding = %q; want a gzipped ticket", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ticket models.UploadTicketResponse
+	if err := json.NewDecoder(zr).Decode(&ticket); err != nil || ticket.FailureID == "" {
+		t.Fatalf("ticket = %+v, %v", ticket, err)
+	}
+	hs.cleanup(ticket.FailureID, ticket.S3Prefix)
+
+	if resp := send("br"); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("brotli request status = %d, want 415", resp.StatusCode)
+	}
+
+	// The decompressed size is capped, however well the body compresses
+	req := ticketRequest("myapp")
+	req.Request.URL += "?q=" + strings.Repeat("a", 10000)
+	compress(req)
+	if body.Len() > 4096 {
+		t.Fatalf("compressed body is %d bytes, want it under the limit", body.Len())
+	}
+	if resp := send("gzip"); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized request status = %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestIntegration_CORSPreflight(t *testing.T) {
+	hs := newHarness(t)
+
+	preflight := func(origin string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodOptions, hs.api.URL+"/v1/upload-ticket", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-api-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Preflights carry no credentials, so they must pass before auth
+	resp := preflight("https://app.example.com")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("preflight status = %d, want 200", resp.StatusCode)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "POST",
+		"Access-Control-Allow-Headers": middleware.APIKeyHeader,
+		"Access-Control-Max-Age":       "600",
+		"Vary":                         "Origin",
+	} {
+		if got := resp.Header.Get(header); !strings.Contains(got, want) {
+			t.Errorf("%s = %q, want it to allow %s", header, got, want)
+		}
+	}
+
+	// Only listed origins and subdomains of wildcard entries are allowed
+	for origin, allowed := range map[string]bool{
+		"http://localhost:3000":        true,
+		"https://a.b.example.com":      true,
+		"https://example.com":          false,
+		"http://app.example.com":       false,
+		"https://app.example.com.evil": false,
+		"https://evilexample.com":      false,
+	} {
+		resp := preflight(origin)
+		got := resp.Header.Get("Access-Control-Allow-Origin")
+		if allowed && (resp.StatusCode != http.StatusOK || got != origin) {
+			t.Errorf("%s: status = %d, allowed origin = %q; want it allowed", origin, resp.StatusCode, got)
+		}
+		if !allowed && (resp.StatusCode != http.StatusForbidden || got != "") {
+			t.Errorf("%s: status = %d, allowed origin = %q; want it rejected", origin, resp.StatusCode, got)
+		}
+	}
+}
+
+func TestIntegration_IPACLs(t *testing.T) {
+	cfg := &config.Config{
+		AuthMode:          middleware.AuthModeAPIKey,
+		AuthEnabled:       true,
+		PresignTTL:        15 * time.Minute,
+		TrustedProxyDepth: 1,
+	}
+	registry, _ := apikeys.NewRegistry([]apikeys.Key{
+		{ID: "reader", Secret: readerKey, Projects: []string{"myapp"}, Scopes: []apikeys.Scope{apikeys.ScopeFailureRead}},
+	})
+	admins, _ := apikeys.NewRegistry([]apikeys.Key{{ID: "ops", Secret: "admin-secret"}})
+	rules, err := ipacl.Parse(`{"admin":{"allow":["10.0.0.0/8"]},"api":{"deny":["198.51.100.0/24"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.NewHandler(cfg, testsupport.NewStore(), &testsupport.Notifier{})
+	srv := New(cfg, h, Deps{Registry: registry, AdminRegistry: admins, IPACLs: rules})
+
+	tests := []struct {
+		name   string
+		path   string
+		xff    string
+		status int
+	}{
+		{"admin from corporate network", "/admin/keys", "10.1.2.3", http.StatusUnauthorized},
+		{"admin from elsewhere", "/admin/keys", "203.0.113.5", http.StatusForbidden},
+		{"admin with spoofed entry", "/admin/keys", "10.1.2.3, 203.0.113.5", http.StatusForbidden},
+		{"api from denied network", "/v1/groups?project=myapp", "198.51.100.7", http.StatusForbidden},
+		{"api from elsewhere", "/v1/groups?project=myapp", "203.0.113.5", http.StatusOK},
+		{"health is never filtered", "/health", "198.51.100.7", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The load balancer connects from 172.16.0.1 and appends the client
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = "172.16.0.1:41000"
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			req.Header.Set(middleware.APIKeyHeader, readerKey)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
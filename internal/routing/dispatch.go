@@ -0,0 +1,204 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+	"github.com/yourorg/failure-uploader/internal/github"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/pagerduty"
+)
+
+// Dispatcher fans failure notifications out to the destinations of the
+// project's route. Failures without a route are emailed to the sender's
+// configured recipient, as before routing existed.
+type Dispatcher struct {
+	resolver Resolver
+	emailer  email.Notifier
+	slack    *Slack
+	webhook  *Webhook
+	teams    *Teams
+	sns      *SNS
+	github   *github.Issues
+	pager    *pagerduty.Pager
+}
+
+// NewDispatcher creates a dispatcher; emailer may be nil when email is not configured
+func NewDispatcher(resolver Resolver, emailer email.Notifier) *Dispatcher {
+	return &Dispatcher{resolver: resolver, emailer: emailer, webhook: NewWebhook(), teams: NewTeams()}
+}
+
+// WithSlack enables delivery to the Slack channels of routes
+func (d *Dispatcher) WithSlack(s *Slack) *Dispatcher {
+	d.slack = s
+	return d
+}
+
+// WithSNS enables delivery to the SNS topics of routes
+func (d *Dispatcher) WithSNS(s *SNS) *Dispatcher {
+	d.sns = s
+	return d
+}
+
+// WithGitHub enables issues in the GitHub repositories of routes
+func (d *Dispatcher) WithGitHub(issues *github.Issues) *Dispatcher {
+	d.github = issues
+	return d
+}
+
+// WithPagerDuty enables paging the PagerDuty services of routes
+func (d *Dispatcher) WithPagerDuty(p *pagerduty.Pager) *Dispatcher {
+	d.pager = p
+	return d
+}
+
+// SendFailureNotification delivers notif to every destination of its route. It
+// fails only when no destination could be reached; partial failures are logged.
+func (d *Dispatcher) SendFailureNotification(ctx context.Context, notif email.FailureNotification) error {
+	ctx = logging.With(ctx, "tenant", notif.Tenant, "project", notif.Project, "env", notif.Env)
+	route, found, err := d.resolver.Resolve(ctx, notif.Tenant, notif.Project, notif.Env)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Msg("failed to resolve notification route - using default recipient")
+	}
+	if !found {
+		if d.emailer == nil {
+			return fmt.Errorf("no notification route for %s/%s and email is not configured", notif.Project, notif.Env)
+		}
+		return d.emailer.SendFailureNotification(ctx, notif)
+	}
+	if route.Empty() {
+		logging.FromContext(ctx).Info().Msg("notification route has no destinations")
+		return nil
+	}
+
+	delivered := 0
+	var errs []error
+	record := func(channel, dest string, err error) {
+		if err != nil {
+			metrics.NotificationFailures.Inc(channel)
+			logging.FromContext(ctx).Error().Err(err).Str("failureId", notif.FailureID).Str("channel", channel).Str("destination", dest).Msg("failed to deliver notification")
+			errs = append(errs, fmt.Errorf("%s %s: %w", channel, dest, err))
+			return
+		}
+		metrics.NotificationsSent.Inc(channel)
+		delivered++
+	}
+
+	if len(route.Emails) > 0 {
+		dest := strings.Join(route.Emails, ",")
+		if d.emailer == nil {
+			record("email", dest, errors.New("email is not configured"))
+		} else {
+			routed := notif
+			routed.To = route.Emails
+			record("email", dest, d.emailer.SendFailureNotification(ctx, routed))
+		}
+	}
+
+	text := Summary(notif)
+	for _, ch := range route.SlackChannels {
+		if d.slack == nil {
+			record("slack", ch, errors.New("no slack bot token configured"))
+			continue
+		}
+		record("slack", ch, d.slack.Post(ctx, ch, text))
+	}
+
+	for _, u := range route.Webhooks {
+		record("webhook", u, d.webhook.Post(ctx, u, notif))
+	}
+
+	for _, u := range route.TeamsWebhooks {
+		record("teams", u, d.teams.Post(ctx, u, notif))
+	}
+
+	for _, topic := range route.SNSTopics {
+		if d.sns == nil {
+			record("sns", topic, errors.New("sns is not configured"))
+			continue
+		}
+		record("sns", topic, d.sns.Publish(ctx, topic, notif))
+	}
+
+	for _, repo := range route.GitHubRepos {
+		if d.github == nil {
+			record("github", repo, errors.New("github is not configured"))
+			continue
+		}
+		record("github", repo, d.github.Report(ctx, repo, notif))
+	}
+
+	if len(route.PagerDutyKeys) > 0 {
+		switch {
+		case d.pager == nil:
+			record("pagerduty", strings.Join(route.PagerDutyKeys, ","), errors.New("pagerduty is not configured"))
+		case d.pager.ShouldPage(ctx, notif, time.Now().UTC()):
+			for _, key := range route.PagerDutyKeys {
+				record("pagerduty", redactKey(key), d.pager.Trigger(ctx, key, notif))
+			}
+		}
+	}
+
+	if delivered == 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// redactKey shortens a secret routing key for logs
+func redactKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
+
+// Summary renders notif as a short plain-text message for chat destinations
+func Summary(notif email.FailureNotification) string {
+	var b strings.Builder
+	if notif.Critical {
+		b.WriteString("[CRITICAL] ")
+	}
+	fmt.Fprintf(&b, "[%s/%s] Failed request captured: %s\n", notif.Project, notif.Env, notif.FailureID)
+	fmt.Fprintf(&b, "%s %s\n", notif.Method, notif.URL)
+	if outcome := notif.Outcome(); outcome != "" {
+		b.WriteString(outcome)
+		if notif.DurationMs > 0 {
+			fmt.Fprintf(&b, " after %d ms", notif.DurationMs)
+		}
+		b.WriteString("\n")
+	}
+	if notif.AppVersion != "" || notif.Platform != "" {
+		fmt.Fprintf(&b, "App %s (%s)\n", notif.AppVersion, notif.Platform)
+	}
+	if notif.TraceID != "" {
+		fmt.Fprintf(&b, "Trace %s\n", notif.TraceID)
+	}
+	if notif.RequestID != "" {
+		fmt.Fprintf(&b, "Request ID %s\n", notif.RequestID)
+	}
+	if notif.Severity != "" {
+		fmt.Fprintf(&b, "Severity %s\n", notif.Severity)
+	}
+	if len(notif.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags %s\n", strings.Join(notif.TagList(), ", "))
+	}
+	if notif.Description != "" {
+		fmt.Fprintf(&b, "%q\n", notif.Description)
+	}
+	if notif.Suppressed > 0 {
+		fmt.Fprintf(&b, "Repeated %d more time(s) since the last notification\n", notif.Suppressed)
+	}
+	if notif.EnvelopeURL != "" {
+		fmt.Fprintf(&b, "Envelope: %s\n", notif.EnvelopeURL)
+	}
+	if notif.AckURL != "" {
+		fmt.Fprintf(&b, "Acknowledge: %s\n", notif.AckURL)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,149 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoResolver reads routes from DynamoDB so they can change without a
+// redeploy. The table needs a string partition key "pk"; each route is an item
+// with pk "route#{name}" and string set or list attributes "emails",
+// "slackChannels", "webhooks", "teamsWebhooks", "snsTopics", "githubRepos" and
+// "pagerDutyKeys".
+type DynamoResolver struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoResolver creates a DynamoDB-backed resolver
+func NewDynamoResolver(ctx context.Context, region, table string) (*DynamoResolver, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return &DynamoResolver{client: dynamodb.NewFromConfig(cfg), table: table}, nil
+}
+
+// routePrefix prefixes the partition key of route items
+const routePrefix = "route#"
+
+// Resolve returns the most specific route stored for project and env
+func (d *DynamoResolver) Resolve(ctx context.Context, tenant, project, env string) (Route, bool, error) {
+	for _, name := range names(tenant, project, env) {
+		out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(d.table),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: routePrefix + name},
+			},
+		})
+		if err != nil {
+			return Route{}, false, err
+		}
+		if out.Item == nil {
+			continue
+		}
+
+		r := routeOf(out.Item)
+		if err := r.Validate(); err != nil {
+			return Route{}, false, fmt.Errorf("route %s: %w", name, err)
+		}
+		return r, true, nil
+	}
+	return Route{}, false, nil
+}
+
+// Routes scans the table for every stored route
+func (d *DynamoResolver) Routes(ctx context.Context) (map[string]Route, error) {
+	routes := make(map[string]Route)
+	p := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(d.table),
+		FilterExpression:          aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":prefix": &types.AttributeValueMemberS{Value: routePrefix}},
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			pk, ok := item["pk"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			routes[strings.TrimPrefix(pk.Value, routePrefix)] = routeOf(item)
+		}
+	}
+	return routes, nil
+}
+
+// PutRoute stores r under name, replacing any existing route
+func (d *DynamoResolver) PutRoute(ctx context.Context, name string, r Route) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	item := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: routePrefix + name},
+	}
+	// String sets cannot be empty, so unset destinations are left out
+	for attr, values := range map[string][]string{"emails": r.Emails, "slackChannels": r.SlackChannels, "webhooks": r.Webhooks, "teamsWebhooks": r.TeamsWebhooks, "snsTopics": r.SNSTopics, "githubRepos": r.GitHubRepos, "pagerDutyKeys": r.PagerDutyKeys} {
+		if len(values) > 0 {
+			item[attr] = &types.AttributeValueMemberSS{Value: values}
+		}
+	}
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      item,
+	})
+	return err
+}
+
+// DeleteRoute deletes the route stored under name
+func (d *DynamoResolver) DeleteRoute(ctx context.Context, name string) (bool, error) {
+	out, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: routePrefix + name},
+		},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(out.Attributes) > 0, nil
+}
+
+// routeOf reads the destinations of a route item
+func routeOf(item map[string]types.AttributeValue) Route {
+	return Route{
+		Emails:        stringsAttr(item, "emails"),
+		SlackChannels: stringsAttr(item, "slackChannels"),
+		Webhooks:      stringsAttr(item, "webhooks"),
+		TeamsWebhooks: stringsAttr(item, "teamsWebhooks"),
+		SNSTopics:     stringsAttr(item, "snsTopics"),
+		GitHubRepos:   stringsAttr(item, "githubRepos"),
+		PagerDutyKeys: stringsAttr(item, "pagerDutyKeys"),
+	}
+}
+
+// stringsAttr reads a string set or a list of strings
+func stringsAttr(item map[string]types.AttributeValue, name string) []string {
+	switch v := item[name].(type) {
+	case *types.AttributeValueMemberSS:
+		return v.Value
+	case *types.AttributeValueMemberL:
+		var out []string
+		for _, e := range v.Value {
+			if s, ok := e.(*types.AttributeValueMemberS); ok {
+				out = append(out, s.Value)
+			}
+		}
+		return out
+	}
+	return nil
+}
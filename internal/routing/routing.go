@@ -0,0 +1,209 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/yourorg/failure-uploader/internal/github"
+)
+
+// Default is the route name used for projects without a route of their own
+const Default = "default"
+
+// Route lists the destinations notified about a project's failures
+type Route struct {
+	Emails []string `json:"emails,omitempty"`
+	// SlackChannels are channel IDs or names posted to with the Slack bot token
+	SlackChannels []string `json:"slackChannels,omitempty"`
+	// Webhooks receive a JSON payload with a Slack-compatible "text" field
+	Webhooks []string `json:"webhooks,omitempty"`
+	// TeamsWebhooks are Teams incoming webhooks that receive an Adaptive Card
+	TeamsWebhooks []string `json:"teamsWebhooks,omitempty"`
+	// SNSTopics are topic ARNs published to, for subscriptions the team manages
+	SNSTopics []string `json:"snsTopics,omitempty"`
+	// GitHubRepos are owner/name repositories with an issue per failure group
+	GitHubRepos []string `json:"githubRepos,omitempty"`
+	// PagerDutyKeys are Events API v2 routing keys, triggered only for
+	// critical failures and groups over the occurrence threshold
+	PagerDutyKeys []string `json:"pagerDutyKeys,omitempty"`
+}
+
+// Empty reports whether the route has no destinations
+func (r Route) Empty() bool {
+	return len(r.Emails) == 0 && len(r.SlackChannels) == 0 && len(r.Webhooks) == 0 && len(r.TeamsWebhooks) == 0 && len(r.SNSTopics) == 0 &&
+		len(r.GitHubRepos) == 0 && len(r.PagerDutyKeys) == 0
+}
+
+// Validate checks every destination of the route
+func (r Route) Validate() error {
+	for _, e := range r.Emails {
+		if _, err := mail.ParseAddress(e); err != nil {
+			return fmt.Errorf("invalid email %q", e)
+		}
+	}
+	for _, c := range r.SlackChannels {
+		if strings.TrimSpace(c) == "" {
+			return fmt.Errorf("empty slack channel")
+		}
+	}
+	for _, w := range r.Webhooks {
+		if !validWebhookURL(w) {
+			return fmt.Errorf("invalid webhook URL %q", w)
+		}
+	}
+	for _, w := range r.TeamsWebhooks {
+		if !validWebhookURL(w) {
+			return fmt.Errorf("invalid Teams webhook URL %q", w)
+		}
+	}
+	for _, t := range r.SNSTopics {
+		if !validTopicARN(t) {
+			return fmt.Errorf("invalid SNS topic ARN %q", t)
+		}
+	}
+	for _, repo := range r.GitHubRepos {
+		if !github.ValidRepo(repo) {
+			return fmt.Errorf("invalid GitHub repository %q, want owner/name", repo)
+		}
+	}
+	for _, k := range r.PagerDutyKeys {
+		if k == "" || strings.ContainsAny(k, " \t\n") {
+			return fmt.Errorf("invalid PagerDuty routing key %q", k)
+		}
+	}
+	return nil
+}
+
+// validWebhookURL reports whether w is an absolute http(s) URL
+func validWebhookURL(w string) bool {
+	u, err := url.Parse(w)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// validTopicARN reports whether arn looks like arn:{partition}:sns:{region}:{account}:{topic}
+func validTopicARN(arn string) bool {
+	parts := strings.Split(arn, ":")
+	return len(parts) == 6 && parts[0] == "arn" && strings.HasPrefix(parts[1], "aws") && parts[2] == "sns" &&
+		parts[3] != "" && parts[4] != "" && parts[5] != ""
+}
+
+// Resolver finds the route for a project and environment of a tenant, empty
+// for none. found is false when neither the project nor a default route is configured.
+type Resolver interface {
+	Resolve(ctx context.Context, tenant, project, env string) (route Route, found bool, err error)
+}
+
+// ErrReadOnly is returned when changing the routes of the config backend
+var ErrReadOnly = errors.New("notification routes are read-only with the config backend")
+
+// Editor is a Resolver whose routes can be listed and changed by name
+// ("project/env", "project" or "default", prefixed with "tenant:" for a tenant's routes)
+type Editor interface {
+	Resolver
+	Routes(ctx context.Context) (map[string]Route, error)
+	PutRoute(ctx context.Context, name string, r Route) error
+	// DeleteRoute reports whether a route was deleted
+	DeleteRoute(ctx context.Context, name string) (bool, error)
+}
+
+// Name returns the route name of project/env, or of project when env is
+// empty, within tenant when it is set
+func Name(tenant, project, env string) string {
+	name := project
+	if env != "" {
+		name += "/" + env
+	}
+	if tenant != "" {
+		name = tenant + ":" + name
+	}
+	return name
+}
+
+// names returns the route names tried for project and env, most specific
+// first. A tenant's failures never fall back to another tenant's routes or to
+// untenanted project routes, only to the global default.
+func names(tenant, project, env string) []string {
+	if tenant == "" {
+		return []string{project + "/" + env, project, Default}
+	}
+	return []string{Name(tenant, project, env), Name(tenant, project, ""), Name(tenant, Default, ""), Default}
+}
+
+// Table is a static routing table keyed by route name
+type Table struct {
+	routes map[string]Route
+}
+
+// ParseTable parses a JSON object of route name -> route, e.g.
+// {"myapp/prod":{"emails":["oncall@example.com"],"slackChannels":["#myapp-alerts"]}}.
+// An empty string yields a table with no routes.
+func ParseTable(s string) (*Table, error) {
+	t := &Table{routes: make(map[string]Route)}
+	if s == "" {
+		return t, nil
+	}
+	if err := json.Unmarshal([]byte(s), &t.routes); err != nil {
+		return nil, fmt.Errorf("parse notification routes: %w", err)
+	}
+	for name, r := range t.routes {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("parse notification routes: %s: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+// Resolve returns the most specific route configured for project and env
+func (t *Table) Resolve(_ context.Context, tenant, project, env string) (Route, bool, error) {
+	if t == nil {
+		return Route{}, false, nil
+	}
+	for _, name := range names(tenant, project, env) {
+		if r, ok := t.routes[name]; ok {
+			return r, true, nil
+		}
+	}
+	return Route{}, false, nil
+}
+
+// Routes returns a copy of the table
+func (t *Table) Routes(context.Context) (map[string]Route, error) {
+	routes := make(map[string]Route)
+	if t != nil {
+		for name, r := range t.routes {
+			routes[name] = r
+		}
+	}
+	return routes, nil
+}
+
+// PutRoute fails with ErrReadOnly; the table is set by NOTIFY_ROUTES
+func (t *Table) PutRoute(context.Context, string, Route) error {
+	return ErrReadOnly
+}
+
+// DeleteRoute fails with ErrReadOnly; the table is set by NOTIFY_ROUTES
+func (t *Table) DeleteRoute(context.Context, string) (bool, error) {
+	return false, ErrReadOnly
+}
+
+// New builds a resolver for the configured backend ("config" or "dynamodb").
+// The config backend reads routes from routesJSON.
+func New(ctx context.Context, backend, region, table, routesJSON string) (Editor, error) {
+	switch backend {
+	case "dynamodb":
+		if table == "" {
+			return nil, fmt.Errorf("notification routes backend dynamodb requires a table name")
+		}
+		return NewDynamoResolver(ctx, region, table)
+	case "config", "":
+		return ParseTable(routesJSON)
+	default:
+		return nil, fmt.Errorf("unknown notification routes backend %q", backend)
+	}
+}
@@ -0,0 +1,320 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/yourorg/failure-uploader/internal/email"
+)
+
+func TestParseTable(t *testing.T) {
+	for name, tt := range map[string]struct {
+		in      string
+		wantErr bool
+	}{
+		"empty":       {in: ""},
+		"valid":       {in: `{"myapp":{"emails":["a@example.com"],"slackChannels":["#alerts"],"webhooks":["https://hooks.example.com/x"]}}`},
+		"bad json":    {in: `{"myapp":`, wantErr: true},
+		"bad email":   {in: `{"myapp":{"emails":["not-an-address"]}}`, wantErr: true},
+		"bad webhook": {in: `{"myapp":{"webhooks":["ftp://example.com"]}}`, wantErr: true},
+		"blank slack": {in: `{"myapp":{"slackChannels":[" "]}}`, wantErr: true},
+		"sns topic":   {in: `{"myapp":{"snsTopics":["arn:aws:sns:us-east-1:123456789012:failures"]}}`},
+		"bad sns":     {in: `{"myapp":{"snsTopics":["arn:aws:sqs:us-east-1:123456789012:failures"]}}`, wantErr: true},
+		"teams":       {in: `{"myapp":{"teamsWebhooks":["https://example.webhook.office.com/webhookb2/x"]}}`},
+		"bad teams":   {in: `{"myapp":{"teamsWebhooks":["not a url"]}}`, wantErr: true},
+		"github repo": {in: `{"myapp":{"githubRepos":["myorg/myapp"]}}`},
+		"bad github":  {in: `{"myapp":{"githubRepos":["myapp"]}}`, wantErr: true},
+		"pagerduty":   {in: `{"myapp/prod":{"pagerDutyKeys":["R0123456789ABCDEF0123456789ABCDE"]}}`},
+		"bad pd key":  {in: `{"myapp/prod":{"pagerDutyKeys":[""]}}`, wantErr: true},
+	} {
+		if _, err := ParseTable(tt.in); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ParseTable() error = %v, wantErr %v", name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTable_Resolve(t *testing.T) {
+	table, err := ParseTable(`{
+		"myapp/prod": {"emails": ["prod@example.com"]},
+		"myapp": {"emails": ["myapp@example.com"]},
+		"default": {"slackChannels": ["#failures"]}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		project, env string
+		want         Route
+	}{
+		{"myapp", "prod", Route{Emails: []string{"prod@example.com"}}},
+		{"myapp", "staging", Route{Emails: []string{"myapp@example.com"}}},
+		{"other", "prod", Route{SlackChannels: []string{"#failures"}}},
+	} {
+		got, found, err := table.Resolve(ctx, "", tt.project, tt.env)
+		if err != nil || !found || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%s, %s) = %+v, %v, %v; want %+v", tt.project, tt.env, got, found, err, tt.want)
+		}
+	}
+
+	empty, _ := ParseTable("")
+	if _, found, _ := empty.Resolve(ctx, "", "myapp", "prod"); found {
+		t.Error("Resolve() on an empty table found a route")
+	}
+}
+
+func TestTable_ResolveTenant(t *testing.T) {
+	table, err := ParseTable(`{
+		"myapp": {"emails": ["myapp@example.com"]},
+		"acme:myapp/prod": {"emails": ["acme-prod@example.com"]},
+		"acme:default": {"emails": ["acme@example.com"]},
+		"default": {"slackChannels": ["#failures"]}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		tenant, project, env string
+		want                 Route
+	}{
+		{"acme", "myapp", "prod", Route{Emails: []string{"acme-prod@example.com"}}},
+		{"acme", "myapp", "staging", Route{Emails: []string{"acme@example.com"}}},
+		{"globex", "myapp", "prod", Route{SlackChannels: []string{"#failures"}}},
+		{"", "myapp", "prod", Route{Emails: []string{"myapp@example.com"}}},
+	} {
+		got, found, err := table.Resolve(ctx, tt.tenant, tt.project, tt.env)
+		if err != nil || !found || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%s, %s, %s) = %+v, %v, %v; want %+v", tt.tenant, tt.project, tt.env, got, found, err, tt.want)
+		}
+	}
+
+	if got := Name("acme", "myapp", ""); got != "acme:myapp" {
+		t.Errorf("Name() = %q", got)
+	}
+}
+
+func TestTable_ReadOnly(t *testing.T) {
+	table, _ := ParseTable(`{"myapp": {"emails": ["myapp@example.com"]}}`)
+	ctx := context.Background()
+
+	routes, err := table.Routes(ctx)
+	if err != nil || len(routes) != 1 || routes["myapp"].Emails[0] != "myapp@example.com" {
+		t.Errorf("Routes() = %+v, %v", routes, err)
+	}
+	if err := table.PutRoute(ctx, "other", Route{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("PutRoute() error = %v, want ErrReadOnly", err)
+	}
+	if _, err := table.DeleteRoute(ctx, "myapp"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DeleteRoute() error = %v, want ErrReadOnly", err)
+	}
+}
+
+// recordingNotifier is an email.Notifier that records notifications
+type recordingNotifier struct {
+	sent []email.FailureNotification
+	err  error
+}
+
+func (r *recordingNotifier) SendFailureNotification(_ context.Context, notif email.FailureNotification) error {
+	r.sent = append(r.sent, notif)
+	return r.err
+}
+
+func TestDispatcher_FansOut(t *testing.T) {
+	var slackBody map[string]string
+	slackSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&slackBody)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer slackSrv.Close()
+
+	var hook webhookPayload
+	hookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&hook)
+	}))
+	defer hookSrv.Close()
+
+	table, err := ParseTable(`{"myapp":{"emails":["a@example.com","b@example.com"],"slackChannels":["C123"],"webhooks":["` + hookSrv.URL + `"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack := NewSlack("xoxb-test")
+	slack.url = slackSrv.URL
+	mailer := &recordingNotifier{}
+	d := NewDispatcher(table, mailer).WithSlack(slack)
+
+	notif := email.FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", Method: "GET", URL: "https://api.example.com/x", Critical: true,
+		StatusCode: 504, DurationMs: 30000, ErrorMessage: "Gateway Timeout"}
+	if err := d.SendFailureNotification(context.Background(), notif); err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+
+	if len(mailer.sent) != 1 || !reflect.DeepEqual(mailer.sent[0].To, []string{"a@example.com", "b@example.com"}) {
+		t.Errorf("emails = %+v", mailer.sent)
+	}
+	if slackBody["channel"] != "C123" || !strings.HasPrefix(slackBody["text"], "[CRITICAL] [myapp/prod]") {
+		t.Errorf("slack body = %v", slackBody)
+	}
+	if !strings.Contains(slackBody["text"], "HTTP 504: Gateway Timeout after 30000 ms") {
+		t.Errorf("slack text = %q", slackBody["text"])
+	}
+	if hook.FailureID != "f1" || !hook.Critical || hook.StatusCode != 504 || hook.ErrorMessage != "Gateway Timeout" || !strings.Contains(hook.Text, "GET https://api.example.com/x") {
+		t.Errorf("webhook payload = %+v", hook)
+	}
+}
+
+func TestDispatcher_Fallbacks(t *testing.T) {
+	ctx := context.Background()
+	notif := email.FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod"}
+
+	// Unrouted projects go to the sender's default recipient
+	mailer := &recordingNotifier{}
+	empty, _ := ParseTable("")
+	if err := NewDispatcher(empty, mailer).SendFailureNotification(ctx, notif); err != nil || len(mailer.sent) != 1 || mailer.sent[0].To != nil {
+		t.Errorf("unrouted: err = %v, sent = %+v", err, mailer.sent)
+	}
+
+	// A route whose only destination fails reports the error
+	slackOnly, _ := ParseTable(`{"default":{"slackChannels":["C1"]}}`)
+	if err := NewDispatcher(slackOnly, mailer).SendFailureNotification(ctx, notif); err == nil {
+		t.Error("route with no reachable destination should fail")
+	}
+
+	// Partial delivery succeeds
+	mixed, _ := ParseTable(`{"default":{"emails":["a@example.com"],"slackChannels":["C1"]}}`)
+	if err := NewDispatcher(mixed, mailer).SendFailureNotification(ctx, notif); err != nil {
+		t.Errorf("partial delivery error = %v", err)
+	}
+
+	failing := &recordingNotifier{err: errors.New("smtp down")}
+	emailOnly, _ := ParseTable(`{"default":{"emails":["a@example.com"]}}`)
+	if err := NewDispatcher(emailOnly, failing).SendFailureNotification(ctx, notif); err == nil {
+		t.Error("failed email-only route should fail")
+	}
+}
+
+type fakeSNS struct {
+	published []*sns.PublishInput
+}
+
+func (f *fakeSNS) Publish(_ context.Context, in *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.published = append(f.published, in)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestDispatcher_SNS(t *testing.T) {
+	const topic = "arn:aws:sns:us-east-1:123456789012:myapp-failures"
+	table, err := ParseTable(`{"myapp":{"snsTopics":["` + topic + `"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	notif := email.FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", Method: "GET", URL: "https://api.example.com/x", Critical: true}
+
+	if err := NewDispatcher(table, nil).SendFailureNotification(ctx, notif); err == nil {
+		t.Error("SNS route without an SNS client should fail")
+	}
+
+	client := &fakeSNS{}
+	d := NewDispatcher(table, nil).WithSNS(&SNS{client: client})
+	if err := d.SendFailureNotification(ctx, notif); err != nil {
+		t.Fatalf("SendFailureNotification() error = %v", err)
+	}
+	if len(client.published) != 1 {
+		t.Fatalf("published %d messages", len(client.published))
+	}
+	in := client.published[0]
+	if aws.ToString(in.TopicArn) != topic || aws.ToString(in.MessageStructure) != "json" || in.MessageAttributes["critical"].StringValue == nil || *in.MessageAttributes["critical"].StringValue != "true" {
+		t.Errorf("publish input = %+v", in)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal([]byte(aws.ToString(in.Message)), &msg); err != nil {
+		t.Fatal(err)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal([]byte(msg["default"]), &payload); err != nil || payload.FailureID != "f1" {
+		t.Errorf("default message = %q", msg["default"])
+	}
+	if !strings.HasPrefix(msg["sms"], "[CRITICAL] [myapp/prod]") || !strings.HasPrefix(aws.ToString(in.Subject), "[CRITICAL]") {
+		t.Errorf("sms = %q, subject = %q", msg["sms"], aws.ToString(in.Subject))
+	}
+}
+
+func TestSlack_PostError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer srv.Close()
+
+	s := NewSlack("xoxb-test")
+	s.url = srv.URL
+	if err := s.Post(context.Background(), "C404", "hi"); err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("Post() error = %v, want channel_not_found", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	if _, err := New(ctx, "dynamodb", "us-east-1", "", ""); err == nil {
+		t.Error("dynamodb without table should fail")
+	}
+	if _, err := New(ctx, "redis", "us-east-1", "", ""); err == nil {
+		t.Error("unknown backend should fail")
+	}
+	if _, err := New(ctx, "config", "us-east-1", "", `{"myapp":{"emails":["a@example.com"]}}`); err != nil {
+		t.Errorf("config backend error = %v", err)
+	}
+}
+
+func TestDispatcher_Teams(t *testing.T) {
+	var msg struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type    string `json:"type"`
+				Body    []map[string]interface{}
+				Actions []map[string]interface{}
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+	}))
+	defer srv.Close()
+
+	table, err := ParseTable(`{"myapp":{"teamsWebhooks":["` + srv.URL + `"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notif := email.FailureNotification{FailureID: "f1", Project: "myapp", Env: "prod", Method: "GET", URL: "https://api.example.com/x", Critical: true,
+		StatusCode: 503, EnvelopeURL: "https://example.com/envelope", AckURL: "https://api.example.com/v1/failures/f1/ack"}
+	if err := NewDispatcher(table, nil).SendFailureNotification(context.Background(), notif); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Type != "message" || len(msg.Attachments) != 1 || msg.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("message = %+v", msg)
+	}
+	c := msg.Attachments[0].Content
+	if c.Type != "AdaptiveCard" || len(c.Body) != 3 || c.Body[0]["color"] != "Attention" {
+		t.Errorf("card body = %+v", c.Body)
+	}
+	if len(c.Actions) != 2 || c.Actions[0]["url"] != notif.EnvelopeURL || c.Actions[1]["title"] != "Acknowledge" {
+		t.Errorf("card actions = %+v", c.Actions)
+	}
+}
@@ -0,0 +1,64 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// slackPostMessageURL is the Slack Web API method used to post to a channel
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// Slack posts messages to channels with a bot token. The bot must be a member
+// of each channel it posts to.
+type Slack struct {
+	token  string
+	url    string
+	client *http.Client
+}
+
+// NewSlack creates a Slack client authenticated with a bot token (xoxb-...)
+func NewSlack(token string) *Slack {
+	return &Slack{token: token, url: slackPostMessageURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Post sends text to channel
+func (s *Slack) Post(ctx context.Context, channel, text string) error {
+	b, err := json.Marshal(map[string]string{"channel": channel, "text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+
+	// Slack reports API errors with 200 OK and "ok": false
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("parse slack response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack error: %s", result.Error)
+	}
+	return nil
+}
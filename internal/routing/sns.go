@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/yourorg/failure-uploader/internal/email"
+)
+
+// maxSNSSubject is the longest subject SNS accepts for email subscriptions
+const maxSNSSubject = 100
+
+// snsAPI is the subset of the SNS client used to publish notifications
+type snsAPI interface {
+	Publish(ctx context.Context, in *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNS publishes failure notifications to topics, so teams can fan them out to
+// their own subscriptions. Lambda, SQS and HTTP subscribers receive the
+// webhook JSON payload; email and SMS subscribers receive the text summary.
+type SNS struct {
+	client snsAPI
+}
+
+// NewSNS creates an SNS publisher for region
+func NewSNS(ctx context.Context, region string) (*SNS, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return &SNS{client: sns.NewFromConfig(cfg)}, nil
+}
+
+// Publish sends notif to the topic with ARN topicARN. The project, env and
+// critical message attributes let subscriptions filter.
+func (s *SNS) Publish(ctx context.Context, topicARN string, notif email.FailureNotification) error {
+	payload, err := json.Marshal(newWebhookPayload(notif))
+	if err != nil {
+		return err
+	}
+	text := Summary(notif)
+	msg, err := json.Marshal(map[string]string{
+		"default": string(payload),
+		"email":   text,
+		"sms":     text,
+	})
+	if err != nil {
+		return err
+	}
+
+	subject, _, _ := strings.Cut(text, "\n")
+	if len(subject) > maxSNSSubject {
+		subject = subject[:maxSNSSubject]
+	}
+
+	_, err = s.client.Publish(ctx, &sns.PublishInput{
+		TopicArn:         aws.String(topicARN),
+		Message:          aws.String(string(msg)),
+		MessageStructure: aws.String("json"),
+		Subject:          aws.String(subject),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"project":  {DataType: aws.String("String"), StringValue: aws.String(notif.Project)},
+			"env":      {DataType: aws.String("String"), StringValue: aws.String(notif.Env)},
+			"critical": {DataType: aws.String("String"), StringValue: aws.String(strconv.FormatBool(notif.Critical))},
+		},
+	})
+	return err
+}
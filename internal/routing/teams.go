@@ -0,0 +1,145 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+)
+
+// card is an element of an Adaptive Card: a TextBlock, FactSet, action or
+// the card itself. Only the fields a failure card uses are modeled.
+type card map[string]interface{}
+
+// Teams posts failure notifications to Microsoft Teams incoming webhooks
+// (or Workflows webhooks) as Adaptive Cards
+type Teams struct {
+	client *http.Client
+}
+
+// NewTeams creates a Teams poster
+func NewTeams() *Teams {
+	return &Teams{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Post sends notif to the Teams webhook at url
+func (t *Teams) Post(ctx context.Context, url string, notif email.FailureNotification) error {
+	b, err := json.Marshal(teamsMessage(notif))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("teams webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// teamsMessage wraps the failure card in the message envelope Teams webhooks expect
+func teamsMessage(notif email.FailureNotification) card {
+	return card{
+		"type": "message",
+		"attachments": []card{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     failureCard(notif),
+		}},
+	}
+}
+
+// failureCard renders notif with its details as facts and buttons to download
+// the envelope, reproduce the request and acknowledge the failure
+func failureCard(notif email.FailureNotification) card {
+	text := fmt.Sprintf("[%s/%s] Failed request captured", notif.Project, notif.Env)
+	title := card{"type": "TextBlock", "text": text, "weight": "Bolder", "size": "Medium", "wrap": true}
+	if notif.Critical {
+		title["text"] = "[CRITICAL] " + text
+		title["color"] = "Attention"
+	}
+
+	var facts []card
+	fact := func(name, value string) {
+		if value != "" {
+			facts = append(facts, card{"title": name, "value": value})
+		}
+	}
+	fact("Failure", notif.FailureID)
+	fact("Outcome", notif.Outcome())
+	if notif.DurationMs > 0 {
+		fact("Duration", strconv.FormatInt(notif.DurationMs, 10)+" ms")
+	}
+	fact("Trace ID", notif.TraceID)
+	fact("Span ID", notif.SpanID)
+	fact("Request ID", notif.RequestID)
+	fact("Severity", notif.Severity)
+	fact("Tags", strings.Join(notif.TagList(), ", "))
+	fact("Description", notif.Description)
+	if notif.AppVersion != "" || notif.Platform != "" {
+		fact("App", fmt.Sprintf("%s (%s)", notif.AppVersion, notif.Platform))
+	}
+	if notif.Occurrences > 0 {
+		fact("Occurrences", strconv.Itoa(notif.Occurrences))
+	}
+	if notif.Suppressed > 0 {
+		fact("Repeated", fmt.Sprintf("%d more time(s) since the last notification", notif.Suppressed))
+	}
+
+	body := []card{
+		title,
+		{"type": "TextBlock", "text": notif.Method + " " + notif.URL, "fontType": "Monospace", "wrap": true},
+		{"type": "FactSet", "facts": facts},
+	}
+
+	var actions []card
+	if notif.EnvelopeURL != "" {
+		actions = append(actions, card{"type": "Action.OpenUrl", "title": "Download envelope", "url": notif.EnvelopeURL})
+	}
+	if notif.Curl != "" {
+		actions = append(actions, showCard("Reproduce", notif.Curl))
+	}
+	if notif.AckURL != "" {
+		actions = append(actions, card{"type": "Action.OpenUrl", "title": "Acknowledge", "url": notif.AckURL})
+	}
+
+	c := card{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"msteams": card{"width": "Full"},
+		"body":    body,
+	}
+	if len(actions) > 0 {
+		c["actions"] = actions
+	}
+	return c
+}
+
+// showCard is a button revealing a command, since cards posted by webhooks
+// cannot send authenticated requests themselves
+func showCard(title, command string) card {
+	return card{
+		"type":  "Action.ShowCard",
+		"title": title,
+		"card": card{
+			"type": "AdaptiveCard",
+			"body": []card{{"type": "TextBlock", "text": command, "fontType": "Monospace", "wrap": true}},
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+)
+
+// webhookPayload is the body posted to route webhooks. The "text" field lets
+// Slack and Teams incoming webhooks consume it directly.
+type webhookPayload struct {
+	Text       string `json:"text"`
+	FailureID  string `json:"failureId"`
+	Project    string `json:"project"`
+	Env        string `json:"env"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	AppVersion string `json:"appVersion,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+	Critical   bool   `json:"critical"`
+	Severity   string `json:"severity,omitempty"`
+	// Tags and Description are the client's triage labels and the user's report
+	Tags        map[string]string `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
+	// TraceID, SpanID and RequestID correlate the failure with APM traces and server logs
+	TraceID   string `json:"traceId,omitempty"`
+	SpanID    string `json:"spanId,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	// StatusCode is 0 when the client received no response
+	StatusCode   int    `json:"statusCode,omitempty"`
+	DurationMs   int64  `json:"durationMs,omitempty"`
+	ErrorClass   string `json:"errorClass,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	EnvelopeURL  string `json:"envelopeUrl,omitempty"`
+	AckURL       string `json:"ackUrl,omitempty"`
+}
+
+// newWebhookPayload describes notif for webhooks and other JSON consumers
+func newWebhookPayload(notif email.FailureNotification) webhookPayload {
+	return webhookPayload{
+		Text:       Summary(notif),
+		FailureID:  notif.FailureID,
+		Project:    notif.Project,
+		Env:        notif.Env,
+		Method:     notif.Method,
+		URL:        notif.URL,
+		AppVersion: notif.AppVersion,
+		Platform:   notif.Platform,
+		Critical:   notif.Critical,
+		Severity:   notif.Severity,
+
+		Tags:        notif.Tags,
+		Description: notif.Description,
+
+		TraceID:   notif.TraceID,
+		SpanID:    notif.SpanID,
+		RequestID: notif.RequestID,
+
+		StatusCode:   notif.StatusCode,
+		DurationMs:   notif.DurationMs,
+		ErrorClass:   notif.ErrorClass,
+		ErrorMessage: notif.ErrorMessage,
+
+		EnvelopeURL: notif.EnvelopeURL,
+		AckURL:      notif.AckURL,
+	}
+}
+
+// Webhook posts failure notifications as JSON
+type Webhook struct {
+	client *http.Client
+}
+
+// NewWebhook creates a webhook poster
+func NewWebhook() *Webhook {
+	return &Webhook{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Post sends the failure notification to url
+func (w *Webhook) Post(ctx context.Context, url string, notif email.FailureNotification) error {
+	b, err := json.Marshal(newWebhookPayload(notif))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
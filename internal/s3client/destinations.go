@@ -0,0 +1,248 @@
+package s3client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yourorg/failure-uploader/internal/awscall"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+)
+
+// Destination is a bucket that failure objects are stored in
+type Destination struct {
+	Bucket string `json:"bucket"`
+	// Region defaults to the presigner's region
+	Region string `json:"region,omitempty"`
+}
+
+// Destinations maps "project/env" and "env" to destinations, most specific
+// first. Failures matching neither go to the default bucket.
+type Destinations map[string]Destination
+
+// ParseDestinations parses a JSON object of destinations, e.g.
+// {"prod":{"bucket":"failures-prod","region":"eu-central-1"},"myapp/dev":{"bucket":"myapp-dev"}}.
+// An empty string yields no destinations.
+func ParseDestinations(s string) (Destinations, error) {
+	dests := make(Destinations)
+	if s == "" {
+		return dests, nil
+	}
+	if err := json.Unmarshal([]byte(s), &dests); err != nil {
+		return nil, fmt.Errorf("parse storage destinations: %w", err)
+	}
+	for name, d := range dests {
+		project, env, scoped := strings.Cut(name, "/")
+		if project == "" || (scoped && (env == "" || strings.Contains(env, "/"))) {
+			return nil, fmt.Errorf("parse storage destinations: %q must be an env or project/env", name)
+		}
+		if d.Bucket == "" {
+			return nil, fmt.Errorf("parse storage destinations: %s: bucket is required", name)
+		}
+	}
+	return dests, nil
+}
+
+// destination is a bucket and the clients of its region
+type destination struct {
+	bucket        string
+	region        string
+	client        *s3.Client
+	presignClient *s3.PresignClient
+	uploader      *manager.Uploader
+}
+
+// newDestination creates a destination of bucket. Only its presigned URLs
+// use the endpoint's acceleration and dual-stack options; the service's own
+// calls stay on the regional endpoint. Presigning skips the call policy.
+func newDestination(client *s3.Client, bucket, region string, endpoint Endpoint) *destination {
+	accelerate := endpoint.Accelerate && accelerationCompatible(bucket)
+	if endpoint.Accelerate && !accelerate {
+		logging.Warn().Str("bucket", bucket).Msg("bucket name does not support transfer acceleration - presigning for the regional endpoint")
+	}
+	presignClient := s3.NewPresignClient(client, func(po *s3.PresignOptions) {
+		po.ClientOptions = append(po.ClientOptions, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, awscall.Skip)
+			o.UseAccelerate = accelerate
+			if endpoint.DualStack {
+				o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+			}
+		})
+	})
+	return &destination{
+		bucket:        bucket,
+		region:        region,
+		client:        client,
+		presignClient: presignClient,
+		uploader:      manager.NewUploader(client),
+	}
+}
+
+// accelerationCompatible reports whether bucket can use Transfer
+// Acceleration, which needs a DNS-compliant name without dots
+func accelerationCompatible(bucket string) bool {
+	if len(bucket) < 3 || len(bucket) > 63 || bucket[0] == '-' || bucket[len(bucket)-1] == '-' {
+		return false
+	}
+	for _, c := range bucket {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// AddDestinations stores failures of the listed envs and projects in their
+// own buckets. Clients are created per region, with the presigner's endpoint.
+func (p *Presigner) AddDestinations(ctx context.Context, dests Destinations) error {
+	clients := map[string]*s3.Client{p.def.region: p.def.client}
+	for name, d := range dests {
+		region := d.Region
+		if region == "" {
+			region = p.def.region
+		}
+		client, ok := clients[region]
+		if !ok {
+			var err error
+			if client, err = newClient(ctx, region, p.endpoint); err != nil {
+				return fmt.Errorf("storage destination %s: %w", name, err)
+			}
+			clients[region] = client
+		}
+		p.dests[name] = newDestination(client, d.Bucket, region, p.endpoint)
+	}
+	return nil
+}
+
+// recordPrefixes are the roots of records holding a failure's data outside
+// failures/, which are stored in the failure's destination too: tickets and
+// the user index, Athena index rows, spilled API responses, groups, digest
+// entries, link targets and scan records
+var recordPrefixes = []string{"tickets/", "users/", "index/", "responses/", "groups/", "digests/", "links/", "scans/"}
+
+// isRecord reports whether key is under one of recordPrefixes
+func isRecord(key string) bool {
+	for _, prefix := range recordPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// destFor returns the destination of key: that of its project and env for
+// failure objects, quarantined or not, and for records of a failure written
+// with keys.WithScope. Records read without a scope are looked up in every
+// destination. Everything else is in the default one.
+func (p *Presigner) destFor(ctx context.Context, key string) *destination {
+	if project, env, ok := keys.ParseEnv(unquarantined(key)); ok {
+		return p.destOf(project, env)
+	}
+	if !isRecord(key) {
+		return p.def
+	}
+	if project, env, ok := keys.ScopeFrom(ctx); ok {
+		return p.destOf(project, env)
+	}
+	return p.find(ctx, key)
+}
+
+// destOf returns the destination of the failures of project and env
+func (p *Presigner) destOf(project, env string) *destination {
+	for _, name := range []string{project + "/" + env, env} {
+		if d, ok := p.dests[name]; ok {
+			return d
+		}
+	}
+	return p.def
+}
+
+// find returns the destination holding the record at key, or the default one
+// when none does or it cannot be told
+func (p *Presigner) find(ctx context.Context, key string) *destination {
+	dests := p.all()
+	if len(dests) == 1 {
+		return p.def
+	}
+	for _, d := range dests {
+		_, err := d.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(d.bucket),
+			Key:    aws.String(key),
+		})
+		if err == nil {
+			return d
+		}
+		if !isNotFound(err) {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Str("bucket", d.bucket).Msg("failed to look up record")
+			break
+		}
+	}
+	return p.def
+}
+
+// destsFor returns the destinations holding objects under prefix: one for a
+// prefix within a project/env or outside failures/ and failure records, every
+// destination for a prefix spanning several, such as "failures/", a whole
+// project or "tickets/". Prefixes under quarantine/ are held where the
+// failures they wrap are.
+func (p *Presigner) destsFor(prefix string) []*destination {
+	prefix = unquarantined(prefix)
+	if project, env, ok := keys.ParseEnv(prefix); ok {
+		return []*destination{p.destOf(project, env)}
+	}
+	if strings.HasPrefix(prefix, "failures/") || strings.HasPrefix("failures/", prefix) {
+		return p.all()
+	}
+	for _, root := range recordPrefixes {
+		if strings.HasPrefix(prefix, root) || strings.HasPrefix(root, prefix) {
+			return p.all()
+		}
+	}
+	return []*destination{p.def}
+}
+
+// unquarantined returns the failure key or prefix a quarantined one wraps
+func unquarantined(key string) string {
+	return strings.TrimPrefix(key, keys.QuarantinePrefix)
+}
+
+// all returns the default destination and every other bucket, each once
+func (p *Presigner) all() []*destination {
+	out := []*destination{p.def}
+	seen := map[string]bool{p.def.region + "/" + p.def.bucket: true}
+	names := make([]string, 0, len(p.dests))
+	for name := range p.dests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d := p.dests[name]
+		if id := d.region + "/" + d.bucket; !seen[id] {
+			seen[id] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// merge sorts and deduplicates the results of listing n destinations, which
+// S3 returns sorted within each
+func merge(items []string, n int) []string {
+	if n < 2 {
+		return items
+	}
+	sort.Strings(items)
+	out := items[:0]
+	for i, item := range items {
+		if i == 0 || item != items[i-1] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,321 @@
+package s3client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yourorg/failure-uploader/internal/apigw"
+	"github.com/yourorg/failure-uploader/internal/athena"
+	"github.com/yourorg/failure-uploader/internal/digest"
+	"github.com/yourorg/failure-uploader/internal/groups"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/links"
+	"github.com/yourorg/failure-uploader/internal/scan"
+	"github.com/yourorg/failure-uploader/internal/tickets"
+)
+
+func TestParseDestinations(t *testing.T) {
+	dests, err := ParseDestinations(`{"prod":{"bucket":"failures-eu","region":"eu-central-1"},"myapp/dev":{"bucket":"myapp-dev"}}`)
+	if err != nil {
+		t.Fatalf("ParseDestinations() error = %v", err)
+	}
+	want := Destinations{
+		"prod":      {Bucket: "failures-eu", Region: "eu-central-1"},
+		"myapp/dev": {Bucket: "myapp-dev"},
+	}
+	if !reflect.DeepEqual(dests, want) {
+		t.Errorf("ParseDestinations() = %+v", dests)
+	}
+
+	for _, s := range []string{
+		`{"prod":{"region":"eu-central-1"}}`,
+		`{"myapp/":{"bucket":"b"}}`,
+		`{"/prod":{"bucket":"b"}}`,
+		`{"a/b/c":{"bucket":"b"}}`,
+		`["prod"]`,
+	} {
+		if _, err := ParseDestinations(s); err == nil {
+			t.Errorf("ParseDestinations(%s) error = nil", s)
+		}
+	}
+}
+
+// testPresigner routes to destinations without clients
+func testPresigner() *Presigner {
+	return &Presigner{
+		def: &destination{bucket: "default", region: "us-east-1"},
+		dests: map[string]*destination{
+			"prod":       {bucket: "failures-eu", region: "eu-central-1"},
+			"myapp/prod": {bucket: "myapp-eu", region: "eu-central-1"},
+			"staging":    {bucket: "default", region: "us-east-1"},
+		},
+	}
+}
+
+func TestPresigner_DestFor(t *testing.T) {
+	p := testPresigner()
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{keys.NewBuilder("myapp", "prod", "abc").WithDate(day).Envelope(), "myapp-eu"},
+		{keys.NewBuilderV2("other", "prod", "abc").WithDate(day).Envelope(), "failures-eu"},
+		{keys.NewBuilder("other", "prod", "abc").WithTenant("acme").WithDate(day).Envelope(), "failures-eu"},
+		{keys.NewBuilder("myapp", "dev", "abc").WithDate(day).Envelope(), "default"},
+		{"apikeys/ios.json", "default"},
+	}
+	for _, tt := range tests {
+		if got := p.BucketFor(tt.key); got != tt.want {
+			t.Errorf("BucketFor(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	// Records of a failure follow it when written with its scope
+	ctx := keys.WithScope(context.Background(), "myapp", "prod")
+	for _, key := range []string{tickets.Key("abc"), athena.Key("", "myapp", day, "abc"), apigw.SpillKey(day), groups.Key("", "myapp", "prod", "g1")} {
+		if got := p.destFor(ctx, key).bucket; got != "myapp-eu" {
+			t.Errorf("destFor(%q) = %q, want the failure's bucket", key, got)
+		}
+	}
+	if got := p.destFor(ctx, "apikeys/ios.json").bucket; got != "default" {
+		t.Errorf("destFor(apikeys) = %q, want the default bucket", got)
+	}
+}
+
+func TestRecordPrefixes(t *testing.T) {
+	for _, prefix := range []string{
+		tickets.Prefix, tickets.UserIndexPrefix, athena.Prefix, apigw.SpillPrefix,
+		groups.Prefix, digest.Prefix, links.Prefix, scan.Prefix,
+	} {
+		if !isRecord(prefix + "x.json") {
+			t.Errorf("records under %q are not routed to their failure's bucket", prefix)
+		}
+	}
+}
+
+func TestPresigner_FindRecord(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/myapp-eu/"+tickets.Key("abc") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := New(context.Background(), Options{
+		Bucket:       "default",
+		Region:       "us-east-1",
+		Endpoint:     Endpoint{URL: srv.URL, UsePathStyle: true, AccessKeyID: "AKID", SecretAccessKey: "SECRET"},
+		Destinations: `{"myapp/prod":{"bucket":"myapp-eu","region":"eu-central-1"}}`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if got := p.destFor(ctx, tickets.Key("abc")).bucket; got != "myapp-eu" {
+		t.Errorf("destFor(stored ticket) = %q, want the bucket holding it", got)
+	}
+	if got := p.destFor(ctx, tickets.Key("new")).bucket; got != "default" {
+		t.Errorf("destFor(unknown ticket) = %q, want the default bucket", got)
+	}
+}
+
+func TestPresigner_DestsFor(t *testing.T) {
+	p := testPresigner()
+	buckets := func(prefix string) []string {
+		var out []string
+		for _, d := range p.destsFor(prefix) {
+			out = append(out, d.bucket)
+		}
+		return out
+	}
+
+	every := []string{"default", "myapp-eu", "failures-eu"}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"failures/myapp/prod/", []string{"myapp-eu"}},
+		{"failures/v2/other/prod/dt=2024-03-15/", []string{"failures-eu"}},
+		{"failures/", every},
+		{"failures/myapp/", every},
+		{keys.TenantsPrefix, every},
+		{"", every},
+		{"apikeys/", []string{"default"}},
+		{"tickets/", every},
+	}
+	for _, tt := range tests {
+		if got := buckets(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("destsFor(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := merge([]string{"failures/b/", "failures/a/", "failures/b/"}, 2)
+	if want := []string{"failures/a/", "failures/b/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merge() = %v, want %v", got, want)
+	}
+}
+
+func TestDestination_PresignEndpoint(t *testing.T) {
+	client := s3.New(s3.Options{
+		Region:      "eu-central-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	})
+	tests := []struct {
+		name     string
+		bucket   string
+		endpoint Endpoint
+		want     string
+	}{
+		{"regional", "failures", Endpoint{}, "failures.s3.eu-central-1.amazonaws.com"},
+		{"accelerate", "failures", Endpoint{Accelerate: true}, "failures.s3-accelerate.amazonaws.com"},
+		{"dual-stack", "failures", Endpoint{DualStack: true}, "failures.s3.dualstack.eu-central-1.amazonaws.com"},
+		{"both", "failures", Endpoint{Accelerate: true, DualStack: true}, "failures.s3-accelerate.dualstack.amazonaws.com"},
+		{"dotted bucket", "failures.example.com", Endpoint{Accelerate: true}, "s3.eu-central-1.amazonaws.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDestination(client, tt.bucket, "eu-central-1", tt.endpoint)
+			req, err := d.presignClient.PresignPutObject(context.Background(), &s3.PutObjectInput{
+				Bucket: aws.String(tt.bucket),
+				Key:    aws.String("failures/myapp/prod/envelope.json"),
+			})
+			if err != nil {
+				t.Fatalf("PresignPutObject() error = %v", err)
+			}
+			u, _ := url.Parse(req.URL)
+			if u.Host != tt.want {
+				t.Errorf("host = %q, want %q", u.Host, tt.want)
+			}
+		})
+	}
+
+	// The service's own calls keep the regional endpoint
+	if d := newDestination(client, "failures", "eu-central-1", Endpoint{Accelerate: true}); d.client.Options().UseAccelerate {
+		t.Error("client uses acceleration")
+	}
+}
+
+func TestPresigner_CustomEndpoint(t *testing.T) {
+	key := keys.NewBuilder("myapp", "prod", "abc").Envelope()
+	tests := []struct {
+		name      string
+		pathStyle bool
+		wantHost  string
+		wantPath  string
+	}{
+		{"path style", true, "localhost:9000", "/failures/" + key},
+		{"virtual hosted", false, "failures.localhost:9000", "/" + key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPresigner(context.Background(), "failures", "us-east-1", time.Minute, Endpoint{
+				URL:             "http://localhost:9000",
+				UsePathStyle:    tt.pathStyle,
+				AccessKeyID:     "minioadmin",
+				SecretAccessKey: "minioadmin",
+			})
+			if err != nil {
+				t.Fatalf("NewPresigner() error = %v", err)
+			}
+			putURL, _, err := p.PresignPut(context.Background(), key, PutOptions{ContentType: "application/json"})
+			if err != nil {
+				t.Fatalf("PresignPut() error = %v", err)
+			}
+			getURL, err := p.PresignGet(context.Background(), key)
+			if err != nil {
+				t.Fatalf("PresignGet() error = %v", err)
+			}
+			for _, raw := range []string{putURL, getURL} {
+				u, _ := url.Parse(raw)
+				if u.Scheme != "http" || u.Host != tt.wantHost || u.Path != tt.wantPath {
+					t.Errorf("presigned URL = %s, want http://%s%s", raw, tt.wantHost, tt.wantPath)
+				}
+				if !strings.Contains(u.Query().Get("X-Amz-Credential"), "minioadmin/") {
+					t.Errorf("presigned URL %s is not signed with the static credentials", raw)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	opts := Options{
+		Bucket:        "default",
+		Region:        "us-east-1",
+		TTL:           time.Minute,
+		Endpoint:      Endpoint{URL: "http://localhost:9000", AccessKeyID: "AKID", SecretAccessKey: "SECRET"},
+		Destinations:  `{"prod":{"bucket":"failures-eu","region":"eu-central-1"}}`,
+		DefaultKMSKey: "arn:aws:kms:eu-central-1:123456789012:key/prod",
+	}
+	p, err := New(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	key := keys.NewBuilder("myapp", "prod", "abc").Envelope()
+	if d := p.destFor(context.Background(), key); d.bucket != "failures-eu" || d.region != "eu-central-1" {
+		t.Errorf("destFor() = %s in %s, want failures-eu in eu-central-1", d.bucket, d.region)
+	}
+	if enc := p.encryptionFor(key); enc.KMSKeyID != opts.DefaultKMSKey {
+		t.Errorf("encryptionFor() = %+v, want the default KMS key", enc)
+	}
+
+	for name, bad := range map[string]Options{
+		"destinations": {Bucket: "default", Region: "us-east-1", Destinations: `{"prod":{}}`},
+		"kms keys":     {Bucket: "default", Region: "us-east-1", DefaultKMSKey: "not-an-arn"},
+	} {
+		if _, err := New(context.Background(), bad); err == nil {
+			t.Errorf("New() with invalid %s error = nil", name)
+		}
+	}
+}
+
+func TestPresigner_Quarantine(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+	}))
+	defer srv.Close()
+
+	kmsKey := "arn:aws:kms:eu-central-1:123456789012:key/myapp"
+	p, err := New(context.Background(), Options{
+		Bucket:       "default",
+		Region:       "us-east-1",
+		Endpoint:     Endpoint{URL: srv.URL, UsePathStyle: true, AccessKeyID: "AKID", SecretAccessKey: "SECRET"},
+		Destinations: `{"myapp/prod":{"bucket":"myapp-eu","region":"eu-central-1"}}`,
+		KMSKeys:      `{"myapp":"` + kmsKey + `"}`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	key := keys.NewBuilder("myapp", "prod", "abc").File("dump.zip")
+	if err := p.CopyObject(context.Background(), key, keys.QuarantinePrefix+key); err != nil {
+		t.Fatalf("CopyObject() error = %v", err)
+	}
+	if want := "/myapp-eu/" + keys.QuarantinePrefix + key; got.URL.Path != want {
+		t.Errorf("path = %q, want %q", got.URL.Path, want)
+	}
+	if src := got.Header.Get("X-Amz-Copy-Source"); src != "myapp-eu/"+key {
+		t.Errorf("copy source = %q, want the failure's bucket", src)
+	}
+	if got.Header.Get("X-Amz-Server-Side-Encryption") != "aws:kms" || got.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") != kmsKey {
+		t.Errorf("encryption headers = %v, want the project's KMS key", got.Header)
+	}
+	if dests := p.destsFor(keys.QuarantinePrefix + keys.EnvPrefixes("", "myapp", "prod")[0]); len(dests) != 1 || dests[0].bucket != "myapp-eu" {
+		t.Errorf("destsFor(quarantined prefix) = %v, want the failure's bucket", dests)
+	}
+}
@@ -0,0 +1,152 @@
+package s3client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/placement"
+)
+
+// PostOptions describe the object a presigned POST uploads
+type PostOptions struct {
+	ContentType string
+	// Size is the declared length of the object, 0 if unknown
+	Size int64
+	// MaxBytes is the largest body S3 accepts; bigger uploads are rejected
+	MaxBytes int64
+}
+
+// PresignPost generates a presigned POST policy for uploading key. The client
+// sends the returned fields, then the file, as multipart/form-data to the URL.
+// Unlike a presigned PUT, S3 itself rejects bodies larger than opts.MaxBytes.
+func (p *Presigner) PresignPost(ctx context.Context, key string, opts PostOptions) (string, map[string]string, error) {
+	d := p.destFor(ctx, key)
+	start := time.Now()
+	defer func() { metrics.PresignDuration.Observe(metrics.Since(start), "post") }()
+
+	// Presign a PUT to resolve the bucket URL with the destination's endpoint,
+	// acceleration and dual-stack options, then drop the key from it
+	put, err := d.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("key", key).Msg("failed to resolve POST URL")
+		return "", nil, err
+	}
+	u, err := url.Parse(put.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, key)
+	u.RawPath, u.RawQuery = "", ""
+
+	creds, err := d.client.Options().Credentials.Retrieve(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("key", key).Msg("failed to retrieve credentials for POST policy")
+		return "", nil, err
+	}
+
+	fields := map[string]string{"Content-Type": opts.ContentType}
+	for h, v := range p.encryptionFor(key).Headers() {
+		fields[h] = v
+	}
+	if loc, ok := keys.Parse(key); ok {
+		if tags := p.placement.Tags(loc, placement.StagePending); tags != nil {
+			fields["tagging"] = taggingXML(tags)
+		}
+	}
+	if sc := p.placement.StorageClass(opts.Size); sc != "" {
+		fields[placement.HeaderStorageClass] = sc
+	}
+
+	return u.String(), signPost(creds, d.region, d.bucket, key, fields, opts.MaxBytes, time.Now(), p.ttl), nil
+}
+
+// signPost returns the form fields of a SigV4 POST policy for key, valid for
+// ttl from now. Every field in fields must match exactly, and the body must be
+// at most maxBytes.
+func signPost(creds aws.Credentials, region, bucket, key string, fields map[string]string, maxBytes int64, now time.Time, ttl time.Duration) map[string]string {
+	now = now.UTC()
+	date := now.Format("20060102")
+	form := map[string]string{
+		"key":              key,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, date, region),
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		form["x-amz-security-token"] = creds.SessionToken
+	}
+	for k, v := range fields {
+		form[k] = v
+	}
+
+	names := make([]string, 0, len(form))
+	for k := range form {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+		[]interface{}{"content-length-range", 0, maxBytes},
+	}
+	for _, k := range names {
+		conditions = append(conditions, map[string]string{k: form[k]})
+	}
+	policy, _ := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(ttl).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	form["policy"] = base64.StdEncoding.EncodeToString(policy)
+
+	signingKey := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	form["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey, form["policy"]))
+	return form
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// taggingXML encodes tags as the tagging field of a POST, which takes the XML
+// of a PutObjectTagging body rather than a query string
+func taggingXML(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("<Tagging><TagSet>")
+	for _, k := range names {
+		b.WriteString("<Tag><Key>")
+		xml.EscapeText(&b, []byte(k))
+		b.WriteString("</Key><Value>")
+		xml.EscapeText(&b, []byte(tags[k]))
+		b.WriteString("</Value></Tag>")
+	}
+	b.WriteString("</TagSet></Tagging>")
+	return b.String()
+}
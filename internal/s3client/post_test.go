@@ -0,0 +1,86 @@
+package s3client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestPresignPost(t *testing.T) {
+	key := "failures/myapp/prod/2024/03/15/abc-123/request.raw"
+	for _, tt := range []struct {
+		name      string
+		pathStyle bool
+		want      string
+	}{
+		{"virtual-hosted", false, "https://failures.s3.eu-central-1.amazonaws.com/"},
+		{"path-style", true, "https://s3.eu-central-1.amazonaws.com/failures/"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := s3.New(s3.Options{
+				Region:       "eu-central-1",
+				Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", "TOKEN"),
+				UsePathStyle: tt.pathStyle,
+			})
+			p := &Presigner{def: newDestination(client, "failures", "eu-central-1", Endpoint{}), ttl: 15 * time.Minute}
+
+			u, fields, err := p.PresignPost(context.Background(), key, PostOptions{ContentType: "application/json", MaxBytes: 1024})
+			if err != nil {
+				t.Fatalf("PresignPost() error = %v", err)
+			}
+			if u != tt.want {
+				t.Errorf("URL = %q, want %q", u, tt.want)
+			}
+			if fields["key"] != key || fields["Content-Type"] != "application/json" || fields["x-amz-security-token"] != "TOKEN" {
+				t.Errorf("fields = %v", fields)
+			}
+		})
+	}
+}
+
+func TestSignPost(t *testing.T) {
+	creds := aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}
+	now := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	fields := map[string]string{"Content-Type": "image/png", "tagging": taggingXML(map[string]string{"stage": "pending", "a&b": "<c>"})}
+
+	form := signPost(creds, "eu-central-1", "failures", "k", fields, 2048, now, time.Hour)
+	if form["x-amz-credential"] != "AKID/20240315/eu-central-1/s3/aws4_request" || form["x-amz-date"] != "20240315T103000Z" {
+		t.Errorf("form = %v", form)
+	}
+	if !strings.Contains(form["tagging"], "<Key>a&amp;b</Key><Value>&lt;c&gt;</Value>") {
+		t.Errorf("tagging = %q, want escaped XML", form["tagging"])
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(form["policy"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.Expiration != "2024-03-15T11:30:00.000Z" {
+		t.Errorf("expiration = %q", policy.Expiration)
+	}
+	conditions := string(raw)
+	for _, want := range []string{`["content-length-range",0,2048]`, `{"bucket":"failures"}`, `{"key":"k"}`, `{"Content-Type":"image/png"}`} {
+		if !strings.Contains(conditions, want) {
+			t.Errorf("policy %s lacks %s", conditions, want)
+		}
+	}
+
+	// The signature covers the size limit
+	if other := signPost(creds, "eu-central-1", "failures", "k", fields, 4096, now, time.Hour); other["x-amz-signature"] == form["x-amz-signature"] {
+		t.Error("signature unchanged by the size limit")
+	}
+}
@@ -1,92 +1,322 @@
 package s3client
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/yourorg/failure-uploader/internal/awscall"
+	"github.com/yourorg/failure-uploader/internal/keys"
 	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/placement"
+	"github.com/yourorg/failure-uploader/internal/requestid"
+	"github.com/yourorg/failure-uploader/internal/sse"
+	"github.com/yourorg/failure-uploader/internal/storage"
 )
 
-// Presigner handles S3 presigned URL generation
+// Presigner handles S3 presigned URL generation and object access. Failure
+// objects are stored in the destination configured for their project and env
+// (see AddDestinations); everything else is in the default bucket.
 type Presigner struct {
-	client        *s3.Client
-	presignClient *s3.PresignClient
-	bucket        string
-	ttl           time.Duration
+	def        *destination
+	dests      map[string]*destination
+	endpoint   Endpoint
+	ttl        time.Duration
+	encryption *sse.Keys
+	placement  *placement.Policy
 }
 
-// NewPresigner creates a new S3 presigner
-func NewPresigner(ctx context.Context, bucket string, region string, ttl time.Duration) (*Presigner, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+// Endpoint points the presigner at an S3-compatible service such as MinIO or
+// LocalStack. The zero value uses AWS with the default credential chain.
+type Endpoint struct {
+	URL string
+	// UsePathStyle addresses buckets as {URL}/{bucket}/{key} instead of by subdomain
+	UsePathStyle    bool
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Accelerate presigns URLs for the bucket's Transfer Acceleration
+	// endpoint, which routes uploads through the nearest CloudFront edge.
+	// Acceleration must be enabled on the bucket. Buckets whose names are
+	// not valid hostnames, e.g. contain dots, keep the regional endpoint.
+	Accelerate bool
+	// DualStack presigns URLs for the IPv4 and IPv6 endpoint
+	DualStack bool
+
+	// Policy bounds every S3 call with a timeout, retries and a circuit
+	// breaker; presigning is not affected
+	Policy awscall.Policy
+}
+
+// NewPresigner creates a new S3 presigner. Presigned URLs use endpoint too, so
+// clients must be able to reach it.
+func NewPresigner(ctx context.Context, bucket string, region string, ttl time.Duration, endpoint Endpoint) (*Presigner, error) {
+	client, err := newClient(ctx, region, endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	client := s3.NewFromConfig(cfg)
-	presignClient := s3.NewPresignClient(client)
-
 	return &Presigner{
-		client:        client,
-		presignClient: presignClient,
-		bucket:        bucket,
-		ttl:           ttl,
+		def:      newDestination(client, bucket, region, endpoint),
+		dests:    make(map[string]*destination),
+		endpoint: endpoint,
+		ttl:      ttl,
 	}, nil
 }
 
-// PresignPut generates a presigned PUT URL for uploading
-func (p *Presigner) PresignPut(ctx context.Context, key string, contentType string) (string, error) {
+// Options configure the failure store every binary shares
+type Options struct {
+	Bucket   string
+	Region   string
+	TTL      time.Duration
+	Endpoint Endpoint
+	// Destinations is a JSON object of destinations (see ParseDestinations)
+	Destinations string
+	// KMSKeys and DefaultKMSKey select the SSE-KMS keys (see sse.ParseKeys)
+	KMSKeys       string
+	DefaultKMSKey string
+}
+
+// New creates the presigner of the failure store, storing the failures of
+// the mapped envs and projects in their own buckets and encrypting them with
+// the configured KMS keys
+func New(ctx context.Context, opts Options) (*Presigner, error) {
+	dests, err := ParseDestinations(opts.Destinations)
+	if err != nil {
+		return nil, err
+	}
+	kmsKeys, err := sse.ParseKeys(opts.KMSKeys, opts.DefaultKMSKey)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPresigner(ctx, opts.Bucket, opts.Region, opts.TTL, opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.AddDestinations(ctx, dests); err != nil {
+		return nil, err
+	}
+	return p.WithEncryption(kmsKeys), nil
+}
+
+// newClient creates an S3 client for region
+func newClient(ctx context.Context, region string, endpoint Endpoint) (*s3.Client, error) {
+	opts := append([]func(*config.LoadOptions) error{
+		config.WithRegion(region),
+		config.WithAPIOptions([]func(*middleware.Stack) error{requestid.APIOption}),
+	}, endpoint.Policy.LoadOptions()...)
+	if endpoint.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(endpoint.AccessKeyID, endpoint.SecretAccessKey, "")))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint.URL != "" {
+			o.BaseEndpoint = aws.String(endpoint.URL)
+		}
+		o.UsePathStyle = endpoint.UsePathStyle
+	}), nil
+}
+
+// WithEncryption encrypts failure objects with the KMS key configured for
+// their project and env. Other objects keep the bucket default encryption.
+func (p *Presigner) WithEncryption(k *sse.Keys) *Presigner {
+	p.encryption = k
+	return p
+}
+
+// WithPlacement tags presigned uploads and selects their storage class with policy
+func (p *Presigner) WithPlacement(policy *placement.Policy) *Presigner {
+	p.placement = policy
+	return p
+}
+
+// encryptionFor returns the server-side encryption of key, that of its failure
+// for quarantined objects
+func (p *Presigner) encryptionFor(key string) sse.Encryption {
+	loc, ok := keys.Parse(unquarantined(key))
+	if !ok {
+		return sse.Encryption{}
+	}
+	return p.encryption.For(loc.Project, loc.Env)
+}
+
+// applyEncryption sets the SSE-KMS fields of a put or copy
+func applyEncryption(enc sse.Encryption, algorithm *types.ServerSideEncryption, keyID **string) {
+	if !enc.Enabled() {
+		return
+	}
+	*algorithm = types.ServerSideEncryptionAwsKms
+	*keyID = aws.String(enc.KMSKeyID)
+}
+
+// HeaderChecksumSHA256 carries the base64 digest S3 verifies an upload against
+const HeaderChecksumSHA256 = "x-amz-checksum-sha256"
+
+// PutOptions describe the object a presigned PUT uploads
+type PutOptions struct {
+	ContentType string
+	// Size is the declared length of the object, 0 if unknown
+	Size int64
+	// SHA256 is the hex digest S3 checks the upload against; empty skips the check
+	SHA256 string
+}
+
+// PresignPut generates a presigned PUT URL for uploading. The returned headers
+// are signed into the URL and must be sent with the PUT.
+func (p *Presigner) PresignPut(ctx context.Context, key string, opts PutOptions) (string, map[string]string, error) {
+	d := p.destFor(ctx, key)
 	input := &s3.PutObjectInput{
-		Bucket:      aws.String(p.bucket),
+		Bucket:      aws.String(d.bucket),
 		Key:         aws.String(key),
-		ContentType: aws.String(contentType),
+		ContentType: aws.String(opts.ContentType),
+	}
+	signed := make(map[string]string)
+
+	if opts.SHA256 != "" {
+		sum, err := hex.DecodeString(opts.SHA256)
+		if err != nil || len(sum) != sha256.Size {
+			return "", nil, fmt.Errorf("invalid sha256 digest %q", opts.SHA256)
+		}
+		input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum))
+		signed[HeaderChecksumSHA256] = *input.ChecksumSHA256
 	}
 
-	presignedReq, err := p.presignClient.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
+	enc := p.encryptionFor(key)
+	applyEncryption(enc, &input.ServerSideEncryption, &input.SSEKMSKeyId)
+	for h, v := range enc.Headers() {
+		signed[h] = v
+	}
+	if loc, ok := keys.Parse(key); ok {
+		if tags := p.placement.Tags(loc, placement.StagePending); tags != nil {
+			input.Tagging = aws.String(placement.Encode(tags))
+			signed[placement.HeaderTagging] = *input.Tagging
+		}
+	}
+	if sc := p.placement.StorageClass(opts.Size); sc != "" {
+		input.StorageClass = types.StorageClass(sc)
+		signed[placement.HeaderStorageClass] = sc
+	}
+
+	start := time.Now()
+	presignedReq, err := d.presignClient.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
 		opts.Expires = p.ttl
 	})
+	metrics.PresignDuration.Observe(metrics.Since(start), "put")
 	if err != nil {
-		logging.Error().Err(err).Str("key", key).Msg("failed to presign PUT URL")
-		return "", err
+		logging.FromContext(ctx).Error().Err(err).Str("key", key).Msg("failed to presign PUT URL")
+		return "", nil, err
 	}
 
-	return presignedReq.URL, nil
+	return presignedReq.URL, signed, nil
 }
 
 // PresignGet generates a presigned GET URL for downloading
 func (p *Presigner) PresignGet(ctx context.Context, key string) (string, error) {
+	d := p.destFor(ctx, key)
 	input := &s3.GetObjectInput{
-		Bucket: aws.String(p.bucket),
+		Bucket: aws.String(d.bucket),
 		Key:    aws.String(key),
 	}
 
-	presignedReq, err := p.presignClient.PresignGetObject(ctx, input, func(opts *s3.PresignOptions) {
+	start := time.Now()
+	presignedReq, err := d.presignClient.PresignGetObject(ctx, input, func(opts *s3.PresignOptions) {
 		opts.Expires = p.ttl
 	})
+	metrics.PresignDuration.Observe(metrics.Since(start), "get")
 	if err != nil {
-		logging.Error().Err(err).Str("key", key).Msg("failed to presign GET URL")
+		logging.FromContext(ctx).Error().Err(err).Str("key", key).Msg("failed to presign GET URL")
 		return "", err
 	}
 
 	return presignedReq.URL, nil
 }
 
-// ObjectExists checks if an object exists in S3
+// ObjectExists checks if an object exists in S3. Only a missing key reports
+// false; other failures, such as throttling or access denied, are errors.
 func (p *Presigner) ObjectExists(ctx context.Context, key string) (bool, error) {
-	_, err := p.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(p.bucket),
+	d := p.destFor(ctx, key)
+	_, err := d.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(d.bucket),
 		Key:    aws.String(key),
 	})
-	if err != nil {
-		// Check if it's a "not found" error
+	if isNotFound(err) {
 		return false, nil
 	}
+	if err != nil {
+		return false, fmt.Errorf("head %s: %w", key, err)
+	}
 	return true, nil
 }
 
+// isNotFound reports whether err is S3's answer for a missing key. HEAD
+// requests have no body, so they report a bare NotFound code.
+func isNotFound(err error) bool {
+	var nf *types.NotFound
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nf) || errors.As(err, &nsk) {
+		return true
+	}
+	// S3-compatible services do not always map to the modeled types
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey")
+}
+
+// isInvalidRange reports whether err is S3's answer for a range outside the object
+func isInvalidRange(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange"
+}
+
+// wrapErr annotates a failed operation on key, wrapping storage.ErrNotFound
+// when the key does not exist and storage.ErrInvalidRange when a requested
+// range is outside the object
+func wrapErr(op, key string, err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("%s %s: %w", op, key, storage.ErrNotFound)
+	}
+	if isInvalidRange(err) {
+		return fmt.Errorf("%s %s: %w", op, key, storage.ErrInvalidRange)
+	}
+	return fmt.Errorf("%s %s: %w", op, key, err)
+}
+
+// ObjectSizes returns the content length of each key
+func (p *Presigner) ObjectSizes(ctx context.Context, keys []string) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		d := p.destFor(ctx, key)
+		out, err := d.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(d.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, wrapErr("head", key, err)
+		}
+		sizes[key] = aws.ToInt64(out.ContentLength)
+	}
+	return sizes, nil
+}
+
 // VerifyObjectsExist checks if all specified keys exist in S3
 func (p *Presigner) VerifyObjectsExist(ctx context.Context, keys []string) ([]string, error) {
 	var missing []string
@@ -104,12 +334,13 @@ func (p *Presigner) VerifyObjectsExist(ctx context.Context, keys []string) ([]st
 
 // GetObjectBytes fetches an object from S3 and returns its full body.
 func (p *Presigner) GetObjectBytes(ctx context.Context, key string) ([]byte, error) {
-	out, err := p.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(p.bucket),
+	d := p.destFor(ctx, key)
+	out, err := d.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return nil, err
+		return nil, wrapErr("get", key, err)
 	}
 	defer out.Body.Close()
 
@@ -121,7 +352,376 @@ func (p *Presigner) GetObjectBytes(ctx context.Context, key string) ([]byte, err
 	return b, nil
 }
 
-// Bucket returns the bucket name
+// GetObjectHead fetches at most the first n bytes of an object
+func (p *Presigner) GetObjectHead(ctx context.Context, key string, n int64) ([]byte, error) {
+	d := p.destFor(ctx, key)
+	out, err := d.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, wrapErr("get", key, err)
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(io.LimitReader(out.Body, n))
+}
+
+// Object is an open object whose body streams from S3
+type Object struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	// ContentRange is set for ranged reads, e.g. "bytes 0-99/1234"
+	ContentRange string
+	ETag         string
+	LastModified time.Time
+}
+
+// OpenObject opens the object at key for streaming. byteRange is an HTTP Range
+// header value passed to S3 as is, or "" for the whole object; unsatisfiable
+// ranges wrap storage.ErrInvalidRange. The caller must close the body.
+func (p *Presigner) OpenObject(ctx context.Context, key, byteRange string) (*Object, error) {
+	d := p.destFor(ctx, key)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+	out, err := d.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, wrapErr("get", key, err)
+	}
+	return &Object{
+		Body:          out.Body,
+		ContentType:   aws.ToString(out.ContentType),
+		ContentLength: aws.ToInt64(out.ContentLength),
+		ContentRange:  aws.ToString(out.ContentRange),
+		ETag:          aws.ToString(out.ETag),
+		LastModified:  aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// ObjectSHA256 streams the object at key and returns its hex SHA-256 digest
+func (p *Presigner) ObjectSHA256(ctx context.Context, key string) (string, error) {
+	d := p.destFor(ctx, key)
+	out, err := d.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", wrapErr("get", key, err)
+	}
+	defer out.Body.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, out.Body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Upload streams body to key using multipart uploads for large objects
+func (p *Presigner) Upload(ctx context.Context, key, contentType string, body io.Reader) error {
+	d := p.destFor(ctx, key)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(d.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		Metadata:    requestMetadata(ctx),
+	}
+	applyEncryption(p.encryptionFor(key), &input.ServerSideEncryption, &input.SSEKMSKeyId)
+	_, err := d.uploader.Upload(ctx, input)
+	return err
+}
+
+// requestMetadata records the ID of the request that wrote an object in its
+// x-amz-meta-request-id, so objects the service writes can be traced back
+func requestMetadata(ctx context.Context) map[string]string {
+	if id := requestid.FromContext(ctx); id != "" {
+		return map[string]string{"request-id": id}
+	}
+	return nil
+}
+
+// PutObjectBytes writes data to key
+func (p *Presigner) PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error {
+	d := p.destFor(ctx, key)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(d.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+		Metadata:    requestMetadata(ctx),
+	}
+	applyEncryption(p.encryptionFor(key), &input.ServerSideEncryption, &input.SSEKMSKeyId)
+	_, err := d.client.PutObject(ctx, input)
+	return err
+}
+
+// CopyObject copies src to dst within S3, keeping its content type, metadata
+// and tags. The keys may be stored in different destinations.
+func (p *Presigner) CopyObject(ctx context.Context, src, dst string) error {
+	from, to := p.destFor(ctx, src), p.destFor(ctx, dst)
+	segments := strings.Split(src, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(to.bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(from.bucket + "/" + strings.Join(segments, "/")),
+	}
+	applyEncryption(p.encryptionFor(dst), &input.ServerSideEncryption, &input.SSEKMSKeyId)
+	if _, err := to.client.CopyObject(ctx, input); err != nil {
+		return wrapErr("copy", src, err)
+	}
+	return nil
+}
+
+// ListKeys returns all object keys under prefix. A prefix spanning several
+// destinations, such as "failures/", is listed in each of them.
+func (p *Presigner) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	var all []string
+	dests := p.destsFor(prefix)
+	for _, d := range dests {
+		keys, err := d.listKeys(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, keys...)
+	}
+	return merge(all, len(dests)), nil
+}
+
+// listKeys returns all object keys under prefix in d
+func (d *destination) listKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(d.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+// DeleteObjects deletes keys in batches of up to 1000
+func (p *Presigner) DeleteObjects(ctx context.Context, keys []string) error {
+	var dests []*destination
+	byDest := make(map[*destination][]string)
+	for _, key := range keys {
+		d := p.destFor(ctx, key)
+		if _, ok := byDest[d]; !ok {
+			dests = append(dests, d)
+		}
+		byDest[d] = append(byDest[d], key)
+	}
+	for _, d := range dests {
+		if err := d.deleteObjects(ctx, byDest[d]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteObjects deletes keys in d in batches of up to 1000
+func (d *destination) deleteObjects(ctx context.Context, keys []string) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > 1000 {
+			n = 1000
+		}
+		objects := make([]types.ObjectIdentifier, 0, n)
+		for _, key := range keys[:n] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := d.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(d.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("delete %s: %s", aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// TagObjects replaces the tags of each key with tags
+func (p *Presigner) TagObjects(ctx context.Context, keys []string, tags map[string]string) error {
+	tagSet := make([]types.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	for _, key := range keys {
+		d := p.destFor(ctx, key)
+		_, err := d.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+			Bucket:  aws.String(d.bucket),
+			Key:     aws.String(key),
+			Tagging: &types.Tagging{TagSet: tagSet},
+		})
+		if err != nil {
+			return fmt.Errorf("tag %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// MarkComplete retags every object of the failure key belongs to with the
+// complete stage. It does nothing unless tagging is enabled.
+func (p *Presigner) MarkComplete(ctx context.Context, key string) error {
+	loc, ok := keys.Parse(key)
+	if !ok {
+		return fmt.Errorf("not a failure object: %s", key)
+	}
+	tags := p.placement.Tags(loc, placement.StageComplete)
+	if tags == nil {
+		return nil
+	}
+	objects, err := p.ListKeys(ctx, loc.Prefix)
+	if err != nil {
+		return err
+	}
+	return p.TagObjects(ctx, objects, tags)
+}
+
+// ObjectTags returns the tags of key
+func (p *Presigner) ObjectTags(ctx context.Context, key string) (map[string]string, error) {
+	d := p.destFor(ctx, key)
+	out, err := d.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapErr("get tags of", key, err)
+	}
+	tags := make(map[string]string, len(out.TagSet))
+	for _, t := range out.TagSet {
+		tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return tags, nil
+}
+
+// ListPrefixes returns the immediate child prefixes under prefix, split on
+// "/", across every destination the prefix spans
+func (p *Presigner) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	var all []string
+	dests := p.destsFor(prefix)
+	for _, d := range dests {
+		prefixes, err := d.listPrefixes(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, prefixes...)
+	}
+	return merge(all, len(dests)), nil
+}
+
+// listPrefixes returns the immediate child prefixes under prefix in d
+func (d *destination) listPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	var prefixes []string
+	paginator := s3.NewListObjectsV2Paginator(d.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(d.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, cp := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(cp.Prefix))
+		}
+	}
+	return prefixes, nil
+}
+
+// SetStorageClass transitions an object to storageClass by copying it onto
+// itself, keeping its KMS key so the copy is not re-encrypted with SSE-S3
+func (p *Presigner) SetStorageClass(ctx context.Context, key string, storageClass types.StorageClass) error {
+	d := p.destFor(ctx, key)
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(d.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(d.bucket + "/" + key),
+		StorageClass:      storageClass,
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+	applyEncryption(p.encryptionFor(key), &input.ServerSideEncryption, &input.SSEKMSKeyId)
+	_, err := d.client.CopyObject(ctx, input)
+	return err
+}
+
+// StorageClass returns the storage class of an object; STANDARD objects report an empty class
+func (p *Presigner) StorageClass(ctx context.Context, key string) (types.StorageClass, error) {
+	d := p.destFor(ctx, key)
+	out, err := d.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", wrapErr("head", key, err)
+	}
+	return out.StorageClass, nil
+}
+
+// RestoreObject requests a temporary restore of an archived object for days
+func (p *Presigner) RestoreObject(ctx context.Context, key string, days int32) error {
+	d := p.destFor(ctx, key)
+	_, err := d.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &types.RestoreRequest{
+			Days: aws.Int32(days),
+			GlacierJobParameters: &types.GlacierJobParameters{
+				Tier: types.TierStandard,
+			},
+		},
+	})
+	return err
+}
+
+// HeadBucket checks that every destination's bucket exists and the caller
+// may access it
+func (p *Presigner) HeadBucket(ctx context.Context) error {
+	var errs []error
+	for _, d := range p.all() {
+		_, err := d.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(d.bucket)})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("head bucket %s: %w", d.bucket, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Bucket returns the default bucket name
 func (p *Presigner) Bucket() string {
-	return p.bucket
+	return p.def.bucket
+}
+
+// BucketFor returns the bucket holding the failure object or prefix key
+func (p *Presigner) BucketFor(key string) string {
+	project, env, ok := keys.ParseEnv(unquarantined(key))
+	if !ok {
+		return p.def.bucket
+	}
+	return p.destOf(project, env).bucket
 }
@@ -0,0 +1,158 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/queue/consumer"
+)
+
+// detailGuardDuty is the EventBridge detail type of GuardDuty Malware
+// Protection for S3 scan results
+const detailGuardDuty = "GuardDuty Malware Protection Object Scan Result"
+
+// guardDutyVerdicts maps GuardDuty scan result statuses to verdicts
+var guardDutyVerdicts = map[string]Verdict{
+	"NO_THREATS_FOUND": VerdictClean,
+	"THREATS_FOUND":    VerdictInfected,
+	"UNSUPPORTED":      VerdictUnscanned,
+	"ACCESS_DENIED":    VerdictUnscanned,
+	"FAILED":           VerdictUnscanned,
+}
+
+// clamAVVerdicts maps the av-status of ClamAV Lambda results to verdicts
+var clamAVVerdicts = map[string]Verdict{
+	"CLEAN":    VerdictClean,
+	"INFECTED": VerdictInfected,
+	"SKIPPED":  VerdictUnscanned,
+}
+
+// Results returns the verdicts in a scan result message: a GuardDuty Malware
+// Protection EventBridge event, or the JSON a ClamAV Lambda publishes
+// ({"key": ..., "av-status": "CLEAN"|"INFECTED", "av-signature": ...}),
+// either bare or wrapped in an SNS notification. Other events hold none.
+func Results(payload []byte) ([]Result, error) {
+	var probe struct {
+		DetailType string          `json:"detail-type"`
+		Detail     json.RawMessage `json:"detail"`
+		Type       string          `json:"Type"`
+		Message    string          `json:"Message"`
+		Records    []struct {
+			EventSource string `json:"EventSource"`
+			SNS         struct {
+				Message string `json:"Message"`
+			} `json:"Sns"`
+		} `json:"Records"`
+		Key       string `json:"key"`
+		Status    string `json:"av-status"`
+		Signature string `json:"av-signature"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, consumer.Malformed(err)
+	}
+
+	switch {
+	case probe.DetailType == detailGuardDuty:
+		var detail struct {
+			Object struct {
+				Key string `json:"objectKey"`
+			} `json:"s3ObjectDetails"`
+			Result struct {
+				Status  string `json:"scanResultStatus"`
+				Threats []struct {
+					Name string `json:"name"`
+				} `json:"threats"`
+			} `json:"scanResultDetails"`
+		}
+		if err := json.Unmarshal(probe.Detail, &detail); err != nil || detail.Object.Key == "" {
+			return nil, consumer.Malformed(errors.New("scan result without an object key"))
+		}
+		verdict, ok := guardDutyVerdicts[detail.Result.Status]
+		if !ok {
+			return nil, consumer.Malformed(fmt.Errorf("unknown scan result status %q", detail.Result.Status))
+		}
+		res := Result{Key: detail.Object.Key, Verdict: verdict}
+		for _, t := range detail.Result.Threats {
+			res.Threats = append(res.Threats, t.Name)
+		}
+		return []Result{res}, nil
+	case probe.Type == "Notification":
+		return Results([]byte(probe.Message))
+	case len(probe.Records) > 0 && probe.Records[0].EventSource == "aws:sns":
+		var all []Result
+		for _, rec := range probe.Records {
+			res, err := Results([]byte(rec.SNS.Message))
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, res...)
+		}
+		return all, nil
+	case probe.Status != "":
+		verdict, ok := clamAVVerdicts[probe.Status]
+		if !ok || probe.Key == "" {
+			return nil, consumer.Malformed(errors.New("invalid ClamAV result"))
+		}
+		res := Result{Key: probe.Key, Verdict: verdict}
+		if verdict == VerdictInfected && probe.Signature != "" {
+			res.Threats = []string{probe.Signature}
+		}
+		return []Result{res}, nil
+	}
+	return nil, nil
+}
+
+// Worker applies the scan results it receives
+type Worker struct {
+	store Store
+}
+
+// NewWorker creates a worker recording verdicts and quarantining in store
+func NewWorker(store Store) *Worker {
+	return &Worker{store: store}
+}
+
+// process applies the scan results in body
+func (w *Worker) process(ctx context.Context, id, body string) error {
+	results, err := Results([]byte(body))
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		if _, err := Apply(ctx, w.store, res, time.Now()); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("messageId", id).Str("key", res.Key).Msg("scan result will be retried")
+			return err
+		}
+	}
+	return nil
+}
+
+// consumer returns the consumer of the scan result queue
+func (w *Worker) consumer() consumer.Consumer {
+	return consumer.New("scan results", w.process)
+}
+
+// Handle processes a Lambda invocation: the SQS events of the scan result
+// queue, or a scan result delivered directly by EventBridge or SNS. Failed SQS
+// messages are reported as batch item failures so only those are retried.
+func (w *Worker) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	if sqsEvent, ok := consumer.SQSEvent(payload); ok {
+		return w.consumer().Handle(ctx, sqsEvent), nil
+	}
+
+	err := w.process(ctx, "", string(payload))
+	if errors.Is(err, consumer.ErrMalformed) {
+		logging.FromContext(ctx).Error().Err(err).Msg("dropping scan result")
+		return nil, nil
+	}
+	return nil, err
+}
+
+// Poll consumes scan results from the queue at queueURL; see consumer.Consumer.Poll
+func (w *Worker) Poll(ctx context.Context, client consumer.Receiver, queueURL string) {
+	w.consumer().Poll(ctx, client, queueURL)
+}
@@ -0,0 +1,288 @@
+// Package scan applies the verdicts of a malware scanner, such as GuardDuty
+// Malware Protection for S3 or a ClamAV Lambda, to uploaded failure objects.
+// Every verdict is recorded per object; infected objects are moved under
+// QuarantinePrefix, where they stay until an admin releases them.
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/storage"
+)
+
+// Prefix is the S3 prefix under which scan records are stored
+const Prefix = "scans/"
+
+// QuarantinePrefix is the S3 prefix infected objects are moved under, keeping
+// their original key after it
+const QuarantinePrefix = keys.QuarantinePrefix
+
+// Verdict is the outcome of scanning one object
+type Verdict string
+
+const (
+	// VerdictClean objects had no threats
+	VerdictClean Verdict = "clean"
+	// VerdictInfected objects had threats and are quarantined
+	VerdictInfected Verdict = "infected"
+	// VerdictUnscanned objects could not be scanned, e.g. unsupported or
+	// encrypted files; they are withheld until released but not quarantined
+	VerdictUnscanned Verdict = "unscanned"
+	// VerdictReleased objects were withheld and released by an admin
+	VerdictReleased Verdict = "released"
+)
+
+// Statuses of a failure's objects, as shown to support staff
+const (
+	StatusPending     = "pending"
+	StatusQuarantined = "quarantined"
+)
+
+// Reader is the subset of S3 operations reading scan records needs
+type Reader interface {
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+}
+
+// Store is the subset of S3 operations scanning needs
+type Store interface {
+	Reader
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	CopyObject(ctx context.Context, src, dst string) error
+	DeleteObjects(ctx context.Context, keys []string) error
+}
+
+// Result is a scanner's verdict on one object
+type Result struct {
+	Key     string
+	Verdict Verdict
+	Threats []string
+}
+
+// Record is the scan record of one object. Records are kept per object rather
+// than per failure, so concurrent verdicts never overwrite each other.
+type Record struct {
+	FailureID string    `json:"failureId"`
+	Project   string    `json:"project"`
+	Env       string    `json:"env"`
+	Key       string    `json:"key"`
+	Verdict   Verdict   `json:"verdict"`
+	Threats   []string  `json:"threats,omitempty"`
+	ScannedAt time.Time `json:"scannedAt"`
+	// QuarantineKey is where an infected object was moved
+	QuarantineKey string `json:"quarantineKey,omitempty"`
+	// ReleasedBy and ReleasedAt are set once an admin released the object;
+	// Threats and QuarantineKey are kept for reference
+	ReleasedBy string     `json:"releasedBy,omitempty"`
+	ReleasedAt *time.Time `json:"releasedAt,omitempty"`
+}
+
+// Cleared reports whether the object may be downloaded
+func (r *Record) Cleared() bool {
+	return r.Verdict == VerdictClean || r.Verdict == VerdictReleased
+}
+
+// RecordPrefix returns the prefix of the scan records of failureID
+// Format: scans/{failureId}/
+func RecordPrefix(failureID string) string {
+	return Prefix + failureID + "/"
+}
+
+// RecordKey returns the key of the scan record of the object at key of failure loc
+// Format: scans/{failureId}/{artifact}.json
+func RecordKey(loc keys.Location, key string) string {
+	return RecordPrefix(loc.FailureID) + strings.TrimPrefix(key, loc.Prefix) + ".json"
+}
+
+// QuarantineKey returns where the object at key is quarantined
+func QuarantineKey(key string) string {
+	return QuarantinePrefix + key
+}
+
+// Records is the scan records of one failure by object key
+type Records map[string]*Record
+
+// Load reads the scan records of failureID; failures without any yield an
+// empty set
+func Load(ctx context.Context, store Reader, failureID string) (Records, error) {
+	recordKeys, err := store.ListKeys(ctx, RecordPrefix(failureID))
+	if err != nil {
+		return nil, fmt.Errorf("list scan records: %w", err)
+	}
+	recs := make(Records, len(recordKeys))
+	for _, k := range recordKeys {
+		b, err := store.GetObjectBytes(ctx, k)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", k, err)
+		}
+		var r Record
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", k, err)
+		}
+		recs[r.Key] = &r
+	}
+	return recs, nil
+}
+
+// Status returns StatusQuarantined when any object of the failure is
+// quarantined, StatusPending when any of objKeys has not been cleared, and ""
+// when every one may be downloaded
+func (rs Records) Status(objKeys []string) string {
+	status := ""
+	for _, r := range rs {
+		if r.Verdict == VerdictInfected {
+			return StatusQuarantined
+		}
+	}
+	for _, k := range objKeys {
+		if rs.StatusOf(k) != "" {
+			status = StatusPending
+		}
+	}
+	return status
+}
+
+// StatusOf returns the status of the object at key: StatusQuarantined,
+// StatusPending until it is cleared, or "" once it may be downloaded.
+// Envelopes are written by the service and need no verdict.
+func (rs Records) StatusOf(key string) string {
+	if strings.HasSuffix(key, "/envelope.json") {
+		return ""
+	}
+	r := rs[key]
+	switch {
+	case r == nil:
+		return StatusPending
+	case r.Verdict == VerdictInfected:
+		return StatusQuarantined
+	case !r.Cleared():
+		return StatusPending
+	}
+	return ""
+}
+
+// Quarantined returns the records of the objects still in quarantine
+func (rs Records) Quarantined() []*Record {
+	var out []*Record
+	for _, r := range rs {
+		if r.Verdict == VerdictInfected {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Apply records res and quarantines the object when it is infected. Objects
+// outside a failure prefix, such as quarantined copies being rescanned, are
+// ignored and return a nil record, as are new verdicts on released objects.
+func Apply(ctx context.Context, store Store, res Result, now time.Time) (*Record, error) {
+	loc, ok := keys.Parse(res.Key)
+	if !ok {
+		return nil, nil
+	}
+	recordKey := RecordKey(loc, res.Key)
+	if prev, err := get(ctx, store, recordKey); err != nil {
+		return nil, err
+	} else if prev != nil && prev.Verdict == VerdictReleased {
+		return nil, nil
+	}
+
+	rec := &Record{
+		FailureID: loc.FailureID,
+		Project:   loc.Project,
+		Env:       loc.Env,
+		Key:       res.Key,
+		Verdict:   res.Verdict,
+		Threats:   res.Threats,
+		ScannedAt: now.UTC(),
+	}
+	if res.Verdict == VerdictInfected {
+		rec.QuarantineKey = QuarantineKey(res.Key)
+		if err := store.CopyObject(ctx, res.Key, rec.QuarantineKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("quarantine %s: %w", res.Key, err)
+		}
+		if err := store.DeleteObjects(ctx, []string{res.Key}); err != nil {
+			return nil, fmt.Errorf("delete %s: %w", res.Key, err)
+		}
+		metrics.ObjectsQuarantined.Inc(loc.Project)
+		logging.FromContext(ctx).Warn().
+			Str("failureId", loc.FailureID).
+			Str("project", loc.Project).
+			Str("key", res.Key).
+			Strs("threats", res.Threats).
+			Msg("infected object quarantined")
+	}
+	metrics.ScanVerdicts.Inc(loc.Project, string(res.Verdict))
+
+	if err := put(ctx, store, recordKey, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Release clears the withheld objects of the failure stored under prefix:
+// quarantined objects are moved back to their keys, and objects the scanner
+// could not scan are released where they are. It returns the released records.
+func Release(ctx context.Context, store Store, failureID, prefix, principal string, now time.Time) ([]*Record, error) {
+	recs, err := Load(ctx, store, failureID)
+	if err != nil {
+		return nil, err
+	}
+	released := make([]*Record, 0)
+	for _, r := range recs {
+		if r.Cleared() || !strings.HasPrefix(r.Key, prefix) {
+			continue
+		}
+		if r.Verdict == VerdictInfected {
+			if err := store.CopyObject(ctx, r.QuarantineKey, r.Key); err != nil {
+				return nil, fmt.Errorf("restore %s: %w", r.Key, err)
+			}
+			if err := store.DeleteObjects(ctx, []string{r.QuarantineKey}); err != nil {
+				return nil, fmt.Errorf("delete %s: %w", r.QuarantineKey, err)
+			}
+		}
+		at := now.UTC()
+		r.Verdict, r.ReleasedBy, r.ReleasedAt = VerdictReleased, principal, &at
+		loc, _ := keys.Parse(r.Key)
+		if err := put(ctx, store, RecordKey(loc, r.Key), r); err != nil {
+			return nil, err
+		}
+		released = append(released, r)
+	}
+	return released, nil
+}
+
+func get(ctx context.Context, store Store, key string) (*Record, error) {
+	b, err := store.GetObjectBytes(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	var r Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", key, err)
+	}
+	return &r, nil
+}
+
+func put(ctx context.Context, store Store, key string, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// Scan records are kept in their failure's bucket
+	if err := store.PutObjectBytes(keys.WithScope(ctx, r.Project, r.Env), key, "application/json", b); err != nil {
+		return fmt.Errorf("write %s: %w", key, err)
+	}
+	return nil
+}
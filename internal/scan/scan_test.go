@@ -0,0 +1,142 @@
+package scan_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/yourorg/failure-uploader/internal/scan"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+const prefix = "failures/myapp/prod/2026/10/16/f1/"
+
+func TestResults(t *testing.T) {
+	clam, _ := json.Marshal(map[string]string{"key": prefix + "files/a.zip", "av-status": "INFECTED", "av-signature": "Eicar-Signature"})
+	sns, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": string(clam)})
+
+	tests := []struct {
+		name    string
+		payload string
+		want    []scan.Result
+		wantErr bool
+	}{
+		{
+			name:    "guardduty threats",
+			payload: `{"detail-type":"GuardDuty Malware Protection Object Scan Result","source":"aws.guardduty","detail":{"scanStatus":"COMPLETED","s3ObjectDetails":{"bucketName":"b","objectKey":"` + prefix + `files/a.zip"},"scanResultDetails":{"scanResultStatus":"THREATS_FOUND","threats":[{"name":"EICAR-Test-File"}]}}}`,
+			want:    []scan.Result{{Key: prefix + "files/a.zip", Verdict: scan.VerdictInfected, Threats: []string{"EICAR-Test-File"}}},
+		},
+		{
+			name:    "guardduty unsupported",
+			payload: `{"detail-type":"GuardDuty Malware Protection Object Scan Result","detail":{"s3ObjectDetails":{"objectKey":"k"},"scanResultDetails":{"scanResultStatus":"UNSUPPORTED"}}}`,
+			want:    []scan.Result{{Key: "k", Verdict: scan.VerdictUnscanned}},
+		},
+		{
+			name:    "clamav",
+			payload: string(clam),
+			want:    []scan.Result{{Key: prefix + "files/a.zip", Verdict: scan.VerdictInfected, Threats: []string{"Eicar-Signature"}}},
+		},
+		{
+			name:    "clamav via sns",
+			payload: string(sns),
+			want:    []scan.Result{{Key: prefix + "files/a.zip", Verdict: scan.VerdictInfected, Threats: []string{"Eicar-Signature"}}},
+		},
+		{name: "other event", payload: `{"detail-type":"Object Created","detail":{}}`},
+		{name: "unknown status", payload: `{"key":"k","av-status":"MAYBE"}`, wantErr: true},
+		{name: "not json", payload: `nope`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scan.Results([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Results() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Results() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	store.Put(prefix+"envelope.json", "application/json", []byte("{}"))
+	store.Put(prefix+"request.raw", "application/octet-stream", []byte("body"))
+	store.Put(prefix+"files/a.zip", "application/zip", []byte("X5O!P%@AP"))
+	store.Put(prefix+"files/b.7z", "application/x-7z-compressed", []byte("7z"))
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	uploaded := []string{prefix + "envelope.json", prefix + "request.raw", prefix + "files/a.zip", prefix + "files/b.7z"}
+
+	for _, res := range []scan.Result{{Key: prefix + "request.raw", Verdict: scan.VerdictClean}, {Key: prefix + "files/b.7z", Verdict: scan.VerdictUnscanned}} {
+		if _, err := scan.Apply(ctx, store, res, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, _ := scan.Load(ctx, store, "f1")
+	if got := recs.Status(uploaded); got != scan.StatusPending {
+		t.Errorf("Status() = %q, want pending until every upload is scanned", got)
+	}
+
+	rec, err := scan.Apply(ctx, store, scan.Result{Key: prefix + "files/a.zip", Verdict: scan.VerdictInfected, Threats: []string{"EICAR"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Object(prefix + "files/a.zip"); ok {
+		t.Error("infected object left in place")
+	}
+	if _, ok := store.Object(rec.QuarantineKey); !ok || rec.QuarantineKey != "quarantine/"+prefix+"files/a.zip" {
+		t.Errorf("quarantined copy missing at %q", rec.QuarantineKey)
+	}
+	recs, _ = scan.Load(ctx, store, "f1")
+	if got := recs.Status(uploaded); got != scan.StatusQuarantined || len(recs.Quarantined()) != 1 {
+		t.Errorf("Status() = %q, want quarantined", got)
+	}
+
+	// Rescans of the quarantined copy are ignored
+	if rec, err := scan.Apply(ctx, store, scan.Result{Key: rec.QuarantineKey, Verdict: scan.VerdictInfected}, now); rec != nil || err != nil {
+		t.Errorf("Apply(quarantined copy) = %+v, %v; want it ignored", rec, err)
+	}
+
+	released, err := scan.Release(ctx, store, "f1", prefix, "key:ops", now)
+	if err != nil || len(released) != 2 || released[0].ReleasedBy != "key:ops" {
+		t.Fatalf("Release() = %+v, %v", released, err)
+	}
+	if obj, ok := store.Object(prefix + "files/a.zip"); !ok || string(obj.Data) != "X5O!P%@AP" {
+		t.Error("released object not restored")
+	}
+	if k, _ := store.ListKeys(ctx, scan.QuarantinePrefix); len(k) != 0 {
+		t.Error("quarantined copy kept after release")
+	}
+
+	// The restored object is rescanned, but an admin's release stands
+	if rec, err := scan.Apply(ctx, store, scan.Result{Key: prefix + "files/a.zip", Verdict: scan.VerdictInfected}, now); rec != nil || err != nil {
+		t.Errorf("Apply(released) = %+v, %v; want the release kept", rec, err)
+	}
+	recs, _ = scan.Load(ctx, store, "f1")
+	if got := recs.Status(uploaded); got != "" {
+		t.Errorf("Status() = %q, want cleared", got)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	store := testsupport.NewStore()
+	store.Touch(prefix + "files/a.zip")
+	w := scan.NewWorker(store)
+
+	result := `{"key":"` + prefix + `files/a.zip","av-status":"INFECTED"}`
+	payload, _ := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "m1", EventSource: "aws:sqs", Body: result},
+		{MessageId: "m2", EventSource: "aws:sqs", Body: "not json"},
+	}})
+	resp, err := w.Handle(context.Background(), payload)
+	if err != nil || len(resp.(events.SQSEventResponse).BatchItemFailures) != 0 {
+		t.Fatalf("Handle() = %+v, %v", resp, err)
+	}
+	if _, ok := store.Object(scan.QuarantineKey(prefix + "files/a.zip")); !ok {
+		t.Error("infected object not quarantined")
+	}
+}
@@ -0,0 +1,252 @@
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/priority"
+)
+
+// clientName identifies the service in X-Sentry-Auth
+const clientName = "failure-uploader/1.0"
+
+// DSN is a parsed Sentry DSN, e.g. https://{publicKey}@o1.ingest.sentry.io/{projectId}
+type DSN struct {
+	raw       string
+	publicKey string
+	// envelopeURL is where events are sent
+	envelopeURL string
+}
+
+// ParseDSN parses a Sentry DSN
+func ParseDSN(raw string) (*DSN, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid sentry DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	projectID := path[i+1:]
+	if projectID == "" {
+		return nil, errors.New("invalid sentry DSN: no project ID")
+	}
+	base := u.Scheme + "://" + u.Host + "/"
+	if i > 0 {
+		base += path[:i] + "/"
+	}
+	return &DSN{
+		raw:         raw,
+		publicKey:   u.User.Username(),
+		envelopeURL: base + "api/" + projectID + "/envelope/",
+	}, nil
+}
+
+// Failure is a completed failure to forward
+type Failure struct {
+	Envelope *models.Envelope
+	// S3URI locates the failure's artifacts, s3://{bucket}/{prefix}
+	S3URI       string
+	EnvelopeURL string
+	Occurrences int
+	Critical    bool
+}
+
+// Client forwards failures to Sentry, so they land in the same triage queue
+// as crashes. A nil *Client forwards nothing.
+type Client struct {
+	dsn  *DSN
+	http *http.Client
+	now  func() time.Time
+}
+
+// New creates a client sending to dsn
+func New(dsn *DSN) *Client {
+	return &Client{dsn: dsn, http: &http.Client{Timeout: 5 * time.Second}, now: time.Now}
+}
+
+// Forward sends a condensed event describing f
+func (c *Client) Forward(ctx context.Context, f Failure) error {
+	if c == nil {
+		return nil
+	}
+	now := c.now().UTC()
+	ev := NewEvent(f, now)
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(map[string]string{"event_id": ev.EventID, "dsn": c.dsn.raw, "sent_at": now.Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	item, err := json.Marshal(map[string]interface{}{"type": "event", "length": len(payload)})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	for _, line := range [][]byte{header, item, payload} {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.dsn.envelopeURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", clientName, c.dsn.publicKey))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sentry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Event is the subset of the Sentry event payload the service sends
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     map[string]string `json:"message"`
+	Fingerprint []string          `json:"fingerprint"`
+	Tags        map[string]string `json:"tags"`
+	Request     map[string]string `json:"request,omitempty"`
+	Breadcrumbs struct {
+		Values []Breadcrumb `json:"values"`
+	} `json:"breadcrumbs"`
+	Extra map[string]interface{} `json:"extra"`
+	// Contexts holds the trace context linking the event to a Sentry trace
+	Contexts map[string]interface{} `json:"contexts,omitempty"`
+}
+
+// Breadcrumb is the failed HTTP request leading up to the event
+type Breadcrumb struct {
+	Type      string                 `json:"type"`
+	Category  string                 `json:"category"`
+	Level     string                 `json:"level"`
+	Timestamp string                 `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// NewEvent condenses f into a Sentry event. Failures of one group share a
+// fingerprint, so Sentry groups them the same way the service does.
+func NewEvent(f Failure, now time.Time) Event {
+	env := f.Envelope
+	method := strings.ToUpper(env.Request.Method)
+	message := fmt.Sprintf("%s %s failed", method, env.Request.URL)
+	status := 0
+	if env.Response != nil {
+		status = env.Response.StatusCode
+		switch {
+		case status > 0:
+			message = fmt.Sprintf("%s %s returned HTTP %d", method, env.Request.URL, status)
+		case env.Response.ErrorClass != "":
+			message = fmt.Sprintf("%s %s failed: %s", method, env.Request.URL, env.Response.ErrorClass)
+		}
+	}
+
+	fingerprint := []string{"{{ default }}"}
+	if env.GroupID != "" {
+		fingerprint = []string{env.Project, env.Env, env.GroupID}
+	}
+
+	ev := Event{
+		EventID:     strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Timestamp:   now.Format(time.RFC3339),
+		Level:       level(env.Severity, f.Critical),
+		Platform:    "other",
+		Logger:      "failure-uploader",
+		Environment: env.Env,
+		Message:     map[string]string{"formatted": message},
+		Fingerprint: fingerprint,
+		Tags:        map[string]string{"project": env.Project, "env": env.Env},
+		Request:     map[string]string{"method": method, "url": env.Request.URL},
+		Extra: map[string]interface{}{
+			"failureId": env.FailureID,
+			"s3Prefix":  env.S3Prefix,
+		},
+	}
+	if env.Client.Platform != "" {
+		ev.Tags["platform"] = env.Client.Platform
+	}
+	if env.Client.AppVersion != "" {
+		ev.Release = env.Project + "@" + env.Client.AppVersion
+	}
+	if env.Tenant != "" {
+		ev.Tags["tenant"] = env.Tenant
+	}
+	if env.Request.TraceID != "" {
+		ev.Tags["trace_id"] = env.Request.TraceID
+	}
+	if env.Request.RequestID != "" {
+		ev.Tags["request_id"] = env.Request.RequestID
+	}
+	// Sentry traces need a 128-bit trace ID and a span ID
+	if len(env.Request.TraceID) == 32 && env.Request.SpanID != "" {
+		ev.Contexts = map[string]interface{}{"trace": map[string]string{
+			"trace_id": strings.ToLower(env.Request.TraceID),
+			"span_id":  strings.ToLower(env.Request.SpanID),
+		}}
+	}
+	// Client tags never replace the ones above
+	for k, v := range env.Tags {
+		if _, ok := ev.Tags[k]; !ok {
+			ev.Tags[k] = v
+		}
+	}
+	for k, v := range map[string]string{"s3Uri": f.S3URI, "envelopeUrl": f.EnvelopeURL, "groupId": env.GroupID, "description": env.Description} {
+		if v != "" {
+			ev.Extra[k] = v
+		}
+	}
+	if f.Occurrences > 0 {
+		ev.Extra["occurrences"] = f.Occurrences
+	}
+
+	crumb := Breadcrumb{
+		Type:      "http",
+		Category:  "http",
+		Level:     "error",
+		Timestamp: env.CreatedAt.UTC().Format(time.RFC3339),
+		Data:      map[string]interface{}{"method": method, "url": env.Request.URL},
+	}
+	if status > 0 {
+		crumb.Data["status_code"] = status
+	}
+	if env.Response != nil && env.Response.DurationMs > 0 {
+		crumb.Data["duration_ms"] = env.Response.DurationMs
+	}
+	ev.Breadcrumbs.Values = []Breadcrumb{crumb}
+	return ev
+}
+
+// level maps a failure severity to a Sentry level
+func level(severity string, critical bool) string {
+	switch {
+	case severity == priority.SeverityCritical || critical:
+		return "fatal"
+	case severity == priority.SeverityWarning, severity == priority.SeverityInfo:
+		return severity
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,123 @@
+package sentry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+func TestParseDSN(t *testing.T) {
+	dsn, err := ParseDSN("https://abc123@o1.ingest.sentry.io/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn.publicKey != "abc123" || dsn.envelopeURL != "https://o1.ingest.sentry.io/api/42/envelope/" {
+		t.Errorf("dsn = %+v", dsn)
+	}
+
+	dsn, err = ParseDSN("https://abc123@sentry.example.com/sentry/7")
+	if err != nil || dsn.envelopeURL != "https://sentry.example.com/sentry/api/7/envelope/" {
+		t.Errorf("dsn with path = %+v, %v", dsn, err)
+	}
+
+	for _, bad := range []string{"", "https://o1.ingest.sentry.io/42", "https://abc@o1.ingest.sentry.io/", "ftp://abc@host/1"} {
+		if _, err := ParseDSN(bad); err == nil {
+			t.Errorf("ParseDSN(%q) succeeded", bad)
+		}
+	}
+}
+
+func testEnvelope() *models.Envelope {
+	return &models.Envelope{
+		FailureID: "f-1",
+		Project:   "myapp",
+		Env:       "prod",
+		Request:   models.RequestInfo{Method: "post", URL: "https://api.example.com/v1/orders"},
+		Response:  &models.ResponseInfo{StatusCode: 503, DurationMs: 1200},
+		Client:    models.ClientInfo{AppVersion: "1.2.3", Platform: "ios"},
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		S3Prefix:  "failures/myapp/prod/2024/05/01/f-1/",
+		GroupID:   "g1",
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	ev := NewEvent(Failure{Envelope: testEnvelope(), S3URI: "s3://bucket/failures/myapp/prod/2024/05/01/f-1/", Occurrences: 3}, time.Now())
+
+	if ev.Message["formatted"] != "POST https://api.example.com/v1/orders returned HTTP 503" || ev.Level != "error" {
+		t.Errorf("message = %q, level = %q", ev.Message["formatted"], ev.Level)
+	}
+	if strings.Join(ev.Fingerprint, ",") != "myapp,prod,g1" {
+		t.Errorf("fingerprint = %v", ev.Fingerprint)
+	}
+	if ev.Tags["project"] != "myapp" || ev.Tags["env"] != "prod" || ev.Tags["platform"] != "ios" || ev.Release != "myapp@1.2.3" {
+		t.Errorf("tags = %v, release = %q", ev.Tags, ev.Release)
+	}
+	if ev.Extra["s3Uri"] != "s3://bucket/failures/myapp/prod/2024/05/01/f-1/" || ev.Extra["occurrences"] != 3 {
+		t.Errorf("extra = %v", ev.Extra)
+	}
+	crumbs := ev.Breadcrumbs.Values
+	if len(crumbs) != 1 || crumbs[0].Data["url"] != "https://api.example.com/v1/orders" || crumbs[0].Data["status_code"] != 503 {
+		t.Errorf("breadcrumbs = %+v", crumbs)
+	}
+	if len(ev.EventID) != 32 {
+		t.Errorf("event_id = %q", ev.EventID)
+	}
+
+	env := testEnvelope()
+	env.Severity = "critical"
+	if got := NewEvent(Failure{Envelope: env}, time.Now()).Level; got != "fatal" {
+		t.Errorf("critical level = %q", got)
+	}
+
+	env = testEnvelope()
+	env.Request.TraceID, env.Request.SpanID, env.Request.RequestID = "4BF92F3577B34DA6A3CE929D0E0E4736", "00f067aa0ba902b7", "req-1"
+	ev = NewEvent(Failure{Envelope: env}, time.Now())
+	trace, _ := ev.Contexts["trace"].(map[string]string)
+	if ev.Tags["trace_id"] != env.Request.TraceID || ev.Tags["request_id"] != "req-1" || trace["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || trace["span_id"] != "00f067aa0ba902b7" {
+		t.Errorf("tags = %v, contexts = %v; want the trace linked", ev.Tags, ev.Contexts)
+	}
+}
+
+func TestForward(t *testing.T) {
+	var auth string
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("X-Sentry-Auth")
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+	}))
+	defer srv.Close()
+
+	dsn, err := ParseDSN(strings.Replace(srv.URL, "http://", "http://key1@", 1) + "/9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(dsn).Forward(context.Background(), Failure{Envelope: testEnvelope()}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(auth, "sentry_key=key1") {
+		t.Errorf("X-Sentry-Auth = %q", auth)
+	}
+	if len(lines) != 3 || !strings.Contains(lines[1], `"type":"event"`) {
+		t.Fatalf("envelope = %q", lines)
+	}
+	var ev Event
+	if err := json.Unmarshal([]byte(lines[2]), &ev); err != nil || ev.Extra["failureId"] != "f-1" {
+		t.Errorf("event = %+v, %v", ev, err)
+	}
+
+	var nilClient *Client
+	if err := nilClient.Forward(context.Background(), Failure{Envelope: testEnvelope()}); err != nil {
+		t.Errorf("nil client Forward() = %v", err)
+	}
+}
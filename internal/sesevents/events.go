@@ -0,0 +1,68 @@
+package sesevents
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SES event types handled; deliveries, opens and others are ignored
+const (
+	EventBounce    = "Bounce"
+	EventComplaint = "Complaint"
+)
+
+// BounceTypePermanent marks a hard bounce; the address will never accept mail
+const BounceTypePermanent = "Permanent"
+
+// Event is an SES bounce or complaint, as published by a configuration set
+// event destination or an identity notification topic
+type Event struct {
+	// EventType is set by configuration set event publishing
+	EventType string `json:"eventType"`
+	// NotificationType is set by identity feedback notifications
+	NotificationType string `json:"notificationType"`
+
+	Bounce *struct {
+		BounceType        string      `json:"bounceType"`
+		BounceSubType     string      `json:"bounceSubType"`
+		BouncedRecipients []recipient `json:"bouncedRecipients"`
+	} `json:"bounce,omitempty"`
+	Complaint *struct {
+		ComplaintFeedbackType string      `json:"complaintFeedbackType"`
+		ComplainedRecipients  []recipient `json:"complainedRecipients"`
+	} `json:"complaint,omitempty"`
+	Mail struct {
+		MessageID string `json:"messageId"`
+		// Tags are the message tags the email was sent with
+		Tags map[string][]string `json:"tags"`
+	} `json:"mail"`
+}
+
+type recipient struct {
+	EmailAddress string `json:"emailAddress"`
+}
+
+// ParseEvent parses the Message of an SNS notification
+func ParseEvent(s string) (*Event, error) {
+	var ev Event
+	if err := json.Unmarshal([]byte(s), &ev); err != nil {
+		return nil, fmt.Errorf("parse SES event: %w", err)
+	}
+	return &ev, nil
+}
+
+// Type returns the event type in either publishing format
+func (e *Event) Type() string {
+	if e.EventType != "" {
+		return e.EventType
+	}
+	return e.NotificationType
+}
+
+// Tag returns the first value of a message tag
+func (e *Event) Tag(name string) string {
+	if v := e.Mail.Tags[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package sesevents
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+const certURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-abc.pem"
+
+// signer returns a verifier trusting a fresh key at certURL, and a func signing messages with it
+func signer(t *testing.T) (*Verifier, func(m *Message)) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "sns.amazonaws.com"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	v := NewVerifier()
+	v.certs[certURL] = cert
+	return v, func(m *Message) {
+		m.SignatureVersion = "2"
+		m.SigningCertURL = certURL
+		sum := sha256.Sum256([]byte(m.stringToSign()))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		m.Signature = base64.StdEncoding.EncodeToString(sig)
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	ctx := context.Background()
+	v, sign := signer(t)
+
+	m := &Message{Type: TypeNotification, MessageID: "m1", TopicArn: "arn:aws:sns:us-east-1:1:ses", Message: "{}", Timestamp: "2024-03-15T10:00:00.000Z"}
+	sign(m)
+	if err := v.Verify(ctx, m); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	tampered := *m
+	tampered.Message = `{"eventType":"Bounce"}`
+	if err := v.Verify(ctx, &tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify(tampered) error = %v, want ErrInvalidSignature", err)
+	}
+
+	conf := &Message{Type: TypeSubscriptionConfirmation, MessageID: "m2", Token: "t", SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription", Timestamp: "x"}
+	sign(conf)
+	if err := v.Verify(ctx, conf); err != nil {
+		t.Errorf("Verify(confirmation) error = %v", err)
+	}
+
+	foreign := *m
+	foreign.SigningCertURL = "https://attacker.example.com/cert.pem"
+	if err := v.Verify(ctx, &foreign); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify(foreign cert) error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestCheckSNSURL(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"https://sns.eu-west-1.amazonaws.com/SimpleNotificationService-x.pem": true,
+		"https://sns.cn-north-1.amazonaws.com.cn/x.pem":                       true,
+		"http://sns.eu-west-1.amazonaws.com/x.pem":                            false,
+		"https://sns.eu-west-1.amazonaws.com.evil.com/x.pem":                  false,
+		"https://sns.eu-west-1.amazonaws.com:8443/x.pem":                      false,
+		"https://s3.amazonaws.com/x.pem":                                      false,
+	} {
+		if err := checkSNSURL(url); (err == nil) != ok {
+			t.Errorf("checkSNSURL(%q) error = %v, want ok=%v", url, err, ok)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	list := NewList(store)
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	apply := func(msg string) []Record {
+		t.Helper()
+		ev, err := ParseEvent(msg)
+		if err != nil {
+			t.Fatalf("ParseEvent() error = %v", err)
+		}
+		records, err := Apply(ctx, store, ev, now)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		return records
+	}
+
+	soft := apply(`{"eventType":"Bounce","bounce":{"bounceType":"Transient","bouncedRecipients":[{"emailAddress":"Owner@example.com"}]},"mail":{"tags":{"failureId":["f1"],"project":["myapp"]}}}`)
+	if len(soft) != 1 || soft[0].Suppressed || soft[0].LastFailureID != "f1" {
+		t.Errorf("transient bounce records = %+v", soft)
+	}
+	if ok, _ := list.Suppressed(ctx, "owner@example.com"); ok {
+		t.Error("transient bounce suppressed the address")
+	}
+
+	apply(`{"notificationType":"Bounce","bounce":{"bounceType":"Permanent","bounceSubType":"General","bouncedRecipients":[{"emailAddress":"owner@example.com"}]}}`)
+	if ok, _ := list.Suppressed(ctx, "OWNER@example.com"); !ok {
+		t.Error("hard bounce did not suppress the address")
+	}
+
+	again := apply(`{"eventType":"Bounce","bounce":{"bounceType":"Transient","bouncedRecipients":[{"emailAddress":"owner@example.com"}]}}`)
+	if len(again) != 1 || !again[0].Suppressed || again[0].Bounces != 3 {
+		t.Errorf("records after a later transient bounce = %+v", again)
+	}
+
+	apply(`{"eventType":"Complaint","complaint":{"complaintFeedbackType":"abuse","complainedRecipients":[{"emailAddress":"other@example.com"}]}}`)
+	if ok, _ := list.Suppressed(ctx, "other@example.com"); !ok {
+		t.Error("complaint did not suppress the address")
+	}
+
+	if got := apply(`{"eventType":"Delivery","mail":{}}`); got != nil {
+		t.Errorf("delivery event records = %+v", got)
+	}
+}
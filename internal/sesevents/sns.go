@@ -0,0 +1,192 @@
+package sesevents
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SNS message types
+const (
+	TypeNotification             = "Notification"
+	TypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	TypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// ErrInvalidSignature is returned for messages not signed by SNS
+var ErrInvalidSignature = errors.New("invalid SNS message signature")
+
+// snsHost matches the hosts SNS serves signing certificates and subscribe URLs from
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Message is an SNS HTTP(S) delivery
+type Message struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token,omitempty"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject,omitempty"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL,omitempty"`
+}
+
+// stringToSign builds the canonical string SNS signs for m
+func (m *Message) stringToSign() string {
+	fields := []string{"Message", m.Message, "MessageId", m.MessageID}
+	if m.Type == TypeNotification {
+		if m.Subject != "" {
+			fields = append(fields, "Subject", m.Subject)
+		}
+		fields = append(fields, "Timestamp", m.Timestamp, "TopicArn", m.TopicArn, "Type", m.Type)
+	} else {
+		fields = append(fields, "SubscribeURL", m.SubscribeURL, "Timestamp", m.Timestamp,
+			"Token", m.Token, "TopicArn", m.TopicArn, "Type", m.Type)
+	}
+	return strings.Join(fields, "\n") + "\n"
+}
+
+// Verifier checks SNS message signatures, caching signing certificates
+type Verifier struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// NewVerifier creates a verifier that fetches certificates from SNS
+func NewVerifier() *Verifier {
+	return &Verifier{
+		client: &http.Client{Timeout: 10 * time.Second},
+		certs:  make(map[string]*x509.Certificate),
+	}
+}
+
+// Verify reports ErrInvalidSignature unless m was signed by SNS
+func (v *Verifier) Verify(ctx context.Context, m *Message) error {
+	var hash crypto.Hash
+	var digest []byte
+	switch m.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(m.stringToSign()))
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(m.stringToSign()))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("%w: unsupported version %q", ErrInvalidSignature, m.SignatureVersion)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	cert, err := v.cert(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: signing certificate is not RSA", ErrInvalidSignature)
+	}
+	if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// cert returns the signing certificate at rawURL, which must be served by SNS
+func (v *Verifier) cert(ctx context.Context, rawURL string) (*x509.Certificate, error) {
+	v.mu.Lock()
+	cert, ok := v.certs[rawURL]
+	v.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	if err := checkSNSURL(rawURL); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(rawURL, ".pem") {
+		return nil, fmt.Errorf("%w: signing certificate URL %q", ErrInvalidSignature, rawURL)
+	}
+	b, err := v.get(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%w: signing certificate is not PEM", ErrInvalidSignature)
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	v.mu.Lock()
+	v.certs[rawURL] = cert
+	v.mu.Unlock()
+	return cert, nil
+}
+
+// Confirm visits the SubscribeURL of a verified subscription confirmation
+func (v *Verifier) Confirm(ctx context.Context, m *Message) error {
+	if m.Type != TypeSubscriptionConfirmation {
+		return fmt.Errorf("not a subscription confirmation: %s", m.Type)
+	}
+	if err := checkSNSURL(m.SubscribeURL); err != nil {
+		return err
+	}
+	_, err := v.get(ctx, m.SubscribeURL)
+	return err
+}
+
+func (v *Verifier) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned %s", withoutQuery(rawURL), resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
+
+// checkSNSURL rejects URLs that are not HTTPS on an SNS host, so a forged
+// message cannot make the service fetch arbitrary URLs
+func checkSNSURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || !snsHost.MatchString(parsed.Hostname()) || parsed.Port() != "" {
+		return fmt.Errorf("%w: untrusted URL %q", ErrInvalidSignature, rawURL)
+	}
+	return nil
+}
+
+// withoutQuery strips the query from a URL for error messages; subscribe URLs carry a token
+func withoutQuery(rawURL string) string {
+	s, _, _ := strings.Cut(rawURL, "?")
+	return s
+}
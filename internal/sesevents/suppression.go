@@ -0,0 +1,143 @@
+package sesevents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prefix is the S3 prefix under which recipient feedback records are stored
+const Prefix = "suppressions/"
+
+// Store is the subset of S3 operations the suppression list needs
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
+
+// Record is the bounce and complaint history of one recipient
+type Record struct {
+	Address    string    `json:"address"`
+	Bounces    int       `json:"bounces"`
+	Complaints int       `json:"complaints"`
+	FirstAt    time.Time `json:"firstAt"`
+	LastAt     time.Time `json:"lastAt"`
+	// LastType and LastSubType describe the latest event, e.g. Bounce/Permanent
+	LastType    string `json:"lastType"`
+	LastSubType string `json:"lastSubType,omitempty"`
+	// LastFailureID and LastProject come from the tags of the latest bounced email
+	LastFailureID string `json:"lastFailureId,omitempty"`
+	LastProject   string `json:"lastProject,omitempty"`
+	// Suppressed stops all further email to the address. Hard bounces and
+	// complaints set it; transient bounces never clear it.
+	Suppressed bool `json:"suppressed"`
+}
+
+// Key returns the record key of an address
+// Format: suppressions/{sha256 of the lowercased address}.json
+func Key(address string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(address))))
+	return Prefix + hex.EncodeToString(sum[:]) + ".json"
+}
+
+// Apply records ev against every recipient it names and returns the updated
+// records. Events other than bounces and complaints are ignored.
+func Apply(ctx context.Context, store Store, ev *Event, now time.Time) ([]Record, error) {
+	var addrs []string
+	var subType string
+	suppress := false
+	switch ev.Type() {
+	case EventBounce:
+		if ev.Bounce == nil {
+			return nil, nil
+		}
+		for _, r := range ev.Bounce.BouncedRecipients {
+			addrs = append(addrs, r.EmailAddress)
+		}
+		subType = ev.Bounce.BounceType
+		suppress = ev.Bounce.BounceType == BounceTypePermanent
+	case EventComplaint:
+		if ev.Complaint == nil {
+			return nil, nil
+		}
+		for _, r := range ev.Complaint.ComplainedRecipients {
+			addrs = append(addrs, r.EmailAddress)
+		}
+		subType = ev.Complaint.ComplaintFeedbackType
+		suppress = true
+	default:
+		return nil, nil
+	}
+
+	var records []Record
+	for _, addr := range addrs {
+		r, err := load(ctx, store, addr)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			r = &Record{Address: addr, FirstAt: now.UTC()}
+		}
+		if ev.Type() == EventBounce {
+			r.Bounces++
+		} else {
+			r.Complaints++
+		}
+		r.LastAt = now.UTC()
+		r.LastType = ev.Type()
+		r.LastSubType = subType
+		r.LastFailureID = ev.Tag("failureId")
+		r.LastProject = ev.Tag("project")
+		r.Suppressed = r.Suppressed || suppress
+
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.PutObjectBytes(ctx, Key(addr), "application/json", b); err != nil {
+			return nil, fmt.Errorf("write suppression record: %w", err)
+		}
+		records = append(records, *r)
+	}
+	return records, nil
+}
+
+func load(ctx context.Context, store Store, address string) (*Record, error) {
+	exists, err := store.ObjectExists(ctx, Key(address))
+	if err != nil || !exists {
+		return nil, err
+	}
+	b, err := store.GetObjectBytes(ctx, Key(address))
+	if err != nil {
+		return nil, err
+	}
+	var r Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse suppression record: %w", err)
+	}
+	return &r, nil
+}
+
+// List answers whether an address is suppressed
+type List struct {
+	store Store
+}
+
+// NewList creates a suppression list backed by store
+func NewList(store Store) *List {
+	return &List{store: store}
+}
+
+// Suppressed reports whether email to address must not be sent
+func (l *List) Suppressed(ctx context.Context, address string) (bool, error) {
+	r, err := load(ctx, l.store, address)
+	if err != nil || r == nil {
+		return false, err
+	}
+	return r.Suppressed, nil
+}
@@ -0,0 +1,182 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+)
+
+// Headers of a signed request
+const (
+	HeaderKeyID     = "X-Key-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	ErrMissing      = errors.New("missing signature headers")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrTimestamp    = errors.New("malformed timestamp")
+	ErrStale        = errors.New("timestamp outside the allowed window")
+	ErrSignature    = errors.New("invalid signature")
+	ErrBodyTooLarge = errors.New("request body too large to verify")
+)
+
+// Key is a shared signing secret and what requests signed with it may do
+type Key struct {
+	ID       string          `json:"id"`
+	Secret   string          `json:"secret"`
+	Projects []string        `json:"projects"`
+	Scopes   []apikeys.Scope `json:"scopes"`
+	Tenant   string          `json:"tenant,omitempty"`
+}
+
+// Verifier checks HMAC-SHA256 request signatures. A signature covers the
+// timestamp, method, request URI and body, so a captured request can only be
+// replayed unchanged and only while its timestamp is within maxSkew.
+type Verifier struct {
+	secrets      map[string][]byte
+	keys         map[string]*apikeys.Key
+	maxSkew      time.Duration
+	maxBodyBytes int64
+	now          func() time.Time
+}
+
+// New creates a verifier for keys. Timestamps more than maxSkew from the
+// server clock are rejected, as are bodies over maxBodyBytes.
+func New(keys []Key, maxSkew time.Duration, maxBodyBytes int64) (*Verifier, error) {
+	if maxSkew <= 0 {
+		return nil, fmt.Errorf("signature max skew must be positive, got %s", maxSkew)
+	}
+	v := &Verifier{
+		secrets:      make(map[string][]byte, len(keys)),
+		keys:         make(map[string]*apikeys.Key, len(keys)),
+		maxSkew:      maxSkew,
+		maxBodyBytes: maxBodyBytes,
+		now:          time.Now,
+	}
+	for i, k := range keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("signing key %d: id is required", i)
+		}
+		if len(k.Secret) < 16 {
+			return nil, fmt.Errorf("signing key %q: secret must be at least 16 characters", k.ID)
+		}
+		if _, dup := v.secrets[k.ID]; dup {
+			return nil, fmt.Errorf("signing key %q: duplicate id", k.ID)
+		}
+		v.secrets[k.ID] = []byte(k.Secret)
+		v.keys[k.ID] = &apikeys.Key{ID: k.ID, Projects: k.Projects, Scopes: k.Scopes, Tenant: k.Tenant}
+	}
+	return v, nil
+}
+
+// Load builds a verifier from a JSON array of keys, e.g.
+// [{"id":"ios","secret":"...","projects":["myapp"],"scopes":["ticket:create"]}].
+// It returns nil when keysJSON is empty.
+func Load(keysJSON string, maxSkew time.Duration, maxBodyBytes int64) (*Verifier, error) {
+	if keysJSON == "" {
+		return nil, nil
+	}
+	var keys []Key
+	if err := json.Unmarshal([]byte(keysJSON), &keys); err != nil {
+		return nil, fmt.Errorf("parse signing keys: %w", err)
+	}
+	return New(keys, maxSkew, maxBodyBytes)
+}
+
+// Len returns the number of signing keys
+func (v *Verifier) Len() int {
+	if v == nil {
+		return 0
+	}
+	return len(v.keys)
+}
+
+// MaxSkew returns how far a request timestamp may be from the server clock
+func (v *Verifier) MaxSkew() time.Duration {
+	return v.maxSkew
+}
+
+// MaxBodyBytes returns the largest body a signed request may have
+func (v *Verifier) MaxBodyBytes() int64 {
+	return v.maxBodyBytes
+}
+
+// Signed reports whether r carries a signature
+func Signed(r *http.Request) bool {
+	return r.Header.Get(HeaderSignature) != ""
+}
+
+// Sign returns the hex HMAC-SHA256 of a request with secret. The signed string is
+//
+//	timestamp + "\n" + METHOD + "\n" + request URI + "\n" + hex(sha256(body))
+func Sign(secret []byte, timestamp, method, uri string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + strings.ToUpper(method) + "\n" + uri + "\n" + hex.EncodeToString(sum[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks r's signature and returns the key that signed it. The body is
+// read to verify it and replaced, so handlers can still read it.
+func (v *Verifier) Verify(r *http.Request) (*apikeys.Key, error) {
+	keyID := r.Header.Get(HeaderKeyID)
+	ts := r.Header.Get(HeaderTimestamp)
+	sig := r.Header.Get(HeaderSignature)
+	if keyID == "" || ts == "" || sig == "" {
+		return nil, ErrMissing
+	}
+	secret, ok := v.secrets[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrTimestamp
+	}
+	if skew := v.now().Sub(time.Unix(unix, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return nil, ErrStale
+	}
+
+	body, err := v.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	want := Sign(secret, ts, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(want), []byte(strings.ToLower(sig))) {
+		return nil, ErrSignature
+	}
+	return v.keys[keyID], nil
+}
+
+// readBody buffers r's body, up to maxBodyBytes, and puts it back on r
+func (v *Verifier) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, v.maxBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if int64(len(body)) > v.maxBodyBytes {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,101 @@
+package signing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/apikeys"
+)
+
+const secret = "0123456789abcdef"
+
+func testVerifier(t *testing.T, now time.Time) *Verifier {
+	t.Helper()
+	v, err := Load(`[{"id":"ios","secret":"`+secret+`","projects":["myapp"],"scopes":["ticket:create"]}]`, 5*time.Minute, 64)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func signedRequest(ts time.Time, body, sig string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/upload-ticket?x=1", strings.NewReader(body))
+	stamp := strconv.FormatInt(ts.Unix(), 10)
+	if sig == "" {
+		sig = Sign([]byte(secret), stamp, r.Method, r.URL.RequestURI(), []byte(body))
+	}
+	r.Header.Set(HeaderKeyID, "ios")
+	r.Header.Set(HeaderTimestamp, stamp)
+	r.Header.Set(HeaderSignature, sig)
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	v := testVerifier(t, now)
+
+	r := signedRequest(now.Add(-time.Minute), `{"project":"myapp"}`, "")
+	key, err := v.Verify(r)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if key.ID != "ios" || !key.AllowsProject("myapp") || !key.HasScope(apikeys.ScopeTicketCreate) {
+		t.Errorf("Verify() = %+v", key)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != `{"project":"myapp"}` {
+		t.Errorf("body after Verify() = %q", body)
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want error
+	}{
+		{"stale", signedRequest(now.Add(-6*time.Minute), `{}`, ""), ErrStale},
+		{"future", signedRequest(now.Add(6*time.Minute), `{}`, ""), ErrStale},
+		{"bad signature", signedRequest(now, `{}`, strings.Repeat("0", 64)), ErrSignature},
+		{"too large", signedRequest(now, strings.Repeat("a", 65), ""), ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Verify(tt.r); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	tampered := signedRequest(now, `{"project":"myapp"}`, "")
+	tampered.Body = io.NopCloser(strings.NewReader(`{"project":"other"}`))
+	if _, err := v.Verify(tampered); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify() with tampered body error = %v", err)
+	}
+
+	unknown := signedRequest(now, `{}`, "")
+	unknown.Header.Set(HeaderKeyID, "web")
+	if _, err := v.Verify(unknown); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify() with unknown key error = %v", err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for _, keys := range []string{
+		`[{"id":"ios","secret":"short"}]`,
+		`[{"secret":"0123456789abcdef"}]`,
+		`[{"id":"a","secret":"0123456789abcdef"},{"id":"a","secret":"fedcba9876543210"}]`,
+		`{`,
+	} {
+		if _, err := Load(keys, time.Minute, 1); err == nil {
+			t.Errorf("Load(%s) succeeded", keys)
+		}
+	}
+	if v, err := Load("", time.Minute, 1); v != nil || err != nil {
+		t.Errorf("Load(\"\") = %v, %v", v, err)
+	}
+}
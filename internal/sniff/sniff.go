@@ -0,0 +1,197 @@
+package sniff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Len is the number of leading bytes needed to detect a content type
+const Len = 512
+
+// Detected types the standard library does not recognise
+const (
+	TypeWindowsExecutable = "application/vnd.microsoft.portable-executable"
+	TypeELF               = "application/x-elf"
+	TypeMachO             = "application/x-mach-binary"
+	TypeScript            = "text/x-shellscript"
+	TypeHEIC              = "image/heic"
+	TypeAVIF              = "image/avif"
+	TypeTIFF              = "image/tiff"
+)
+
+var executableTypes = map[string]bool{
+	TypeWindowsExecutable:      true,
+	TypeELF:                    true,
+	TypeMachO:                  true,
+	TypeScript:                 true,
+	"application/x-msdownload": true,
+	"application/x-executable": true,
+	"application/x-sharedlib":  true,
+	"application/x-sh":         true,
+	"application/x-dosexec":    true,
+}
+
+// InvalidJSON is reported as detected for content declared as JSON that does
+// not parse
+const InvalidJSON = "invalid JSON"
+
+// detectableImages are the image types Detect recognises; content declared as
+// one of them must be recognised as an image
+var detectableImages = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/bmp":    true,
+	"image/x-icon": true,
+	TypeHEIC:       true,
+	TypeAVIF:       true,
+	TypeTIFF:       true,
+}
+
+// ftypBrands maps the major brands of ISO base media files to image types
+var ftypBrands = map[string]string{
+	"heic": TypeHEIC, "heix": TypeHEIC, "mif1": TypeHEIC, "msf1": TypeHEIC,
+	"avif": TypeAVIF, "avis": TypeAVIF,
+}
+
+var machOMagics = [][]byte{
+	{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+// Detect returns the media type of b judged from its leading bytes, without parameters.
+// Unrecognised binary content is reported as application/octet-stream.
+func Detect(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("MZ")):
+		return TypeWindowsExecutable
+	case bytes.HasPrefix(b, []byte("\x7fELF")):
+		return TypeELF
+	case bytes.HasPrefix(b, []byte("#!")):
+		return TypeScript
+	}
+	for _, m := range machOMagics {
+		if bytes.HasPrefix(b, m) {
+			return TypeMachO
+		}
+	}
+	if bytes.HasPrefix(b, []byte("II*\x00")) || bytes.HasPrefix(b, []byte("MM\x00*")) {
+		return TypeTIFF
+	}
+	if len(b) >= 12 && string(b[4:8]) == "ftyp" {
+		if t, ok := ftypBrands[string(b[8:12])]; ok {
+			return t
+		}
+	}
+
+	t := http.DetectContentType(b)
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = t[:i]
+	}
+	return strings.TrimSpace(t)
+}
+
+// IsExecutable reports whether the media type is native code or a script
+func IsExecutable(mediaType string) bool {
+	return executableTypes[normalize(mediaType)]
+}
+
+// Mismatch reports whether content detected as detected contradicts the declared
+// media type. Executables are flagged unless declared as such, and images the
+// sniffer knows must be recognised; otherwise content the sniffer cannot
+// identify, and declarations that say nothing, never mismatch.
+func Mismatch(declared, detected string) bool {
+	declared, detected = normalize(declared), normalize(detected)
+
+	if IsExecutable(detected) {
+		return !IsExecutable(declared)
+	}
+	if detected == "application/octet-stream" && detectableImages[declared] {
+		return true
+	}
+	if declared == "" || declared == "application/octet-stream" || detected == "application/octet-stream" {
+		return false
+	}
+	if declared == detected {
+		return false
+	}
+
+	switch {
+	case detected == "text/plain":
+		// Any textual declaration is consistent with plain text
+		return !isText(declared)
+	case isText(detected):
+		return !isText(declared)
+	case detected == "application/zip":
+		return !isZipContainer(declared)
+	}
+	return true
+}
+
+// IsJSON reports whether the media type is JSON
+func IsJSON(mediaType string) bool {
+	t := normalize(mediaType)
+	return t == "application/json" || strings.HasSuffix(t, "+json")
+}
+
+// ValidJSON reports whether head, the leading bytes of a document, is valid
+// JSON. Unless complete says head is the whole document, it only has to be a
+// valid beginning, since the document may be cut anywhere.
+func ValidJSON(head []byte, complete bool) bool {
+	if complete {
+		return json.Valid(head)
+	}
+	dec := json.NewDecoder(bytes.NewReader(head))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// isText reports whether a declared type is textual
+func isText(t string) bool {
+	return strings.HasPrefix(t, "text/") ||
+		strings.HasPrefix(t, "multipart/") ||
+		strings.HasSuffix(t, "+json") || strings.HasSuffix(t, "+xml") ||
+		t == "application/json" || t == "application/xml" ||
+		t == "application/javascript" || t == "application/x-www-form-urlencoded" ||
+		t == "application/graphql" || t == "image/svg+xml"
+}
+
+// isZipContainer reports whether a declared type is stored as a zip archive
+func isZipContainer(t string) bool {
+	return t == "application/x-zip-compressed" || t == "application/java-archive" ||
+		strings.HasSuffix(t, "+zip") ||
+		strings.HasPrefix(t, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(t, "application/vnd.oasis.opendocument.")
+}
+
+// normalize lowercases a media type and strips its parameters, mapping common aliases
+func normalize(t string) string {
+	if mt, _, err := mime.ParseMediaType(t); err == nil {
+		t = mt
+	} else {
+		t = strings.ToLower(strings.TrimSpace(t))
+	}
+	switch t {
+	case "image/jpg", "image/pjpeg":
+		return "image/jpeg"
+	case "image/x-png":
+		return "image/png"
+	case "text/json":
+		return "application/json"
+	}
+	return t
+}
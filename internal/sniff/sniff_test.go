@@ -0,0 +1,91 @@
+package sniff
+
+import "testing"
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"png", pngHeader, "image/png"},
+		{"windows executable", []byte("MZ\x90\x00\x03\x00\x00\x00"), TypeWindowsExecutable},
+		{"elf", []byte("\x7fELF\x02\x01\x01"), TypeELF},
+		{"mach-o", []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07, 0x00}, TypeMachO},
+		{"script", []byte("#!/bin/sh\nrm -rf /\n"), TypeScript},
+		{"json", []byte(`{"ok":true}`), "text/plain"},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), TypeHEIC},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), TypeTIFF},
+		{"binary", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.b); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		declared string
+		detected string
+		want     bool
+	}{
+		{"image/png", "image/png", false},
+		{"image/png", TypeWindowsExecutable, true},
+		{"", TypeELF, true},
+		{"application/octet-stream", TypeMachO, true},
+		{"application/x-msdownload", TypeWindowsExecutable, false},
+		{"image/jpg", "image/jpeg", false},
+		{"image/png", "image/jpeg", true},
+		{"application/json; charset=utf-8", "text/plain", false},
+		{"multipart/form-data; boundary=x", "text/plain", false},
+		{"image/png", "text/plain", true},
+		{"application/json", "application/pdf", true},
+		{"image/png", "application/octet-stream", true},
+		{"image/x-canon-cr2", "application/octet-stream", false},
+		{"image/heic", TypeHEIC, false},
+		{"", "image/png", false},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", false},
+		{"image/png", "application/zip", true},
+		{"image/svg+xml", "text/xml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.declared+"/"+tt.detected, func(t *testing.T) {
+			if got := Mismatch(tt.declared, tt.detected); got != tt.want {
+				t.Errorf("Mismatch(%q, %q) = %v, want %v", tt.declared, tt.detected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     string
+		complete bool
+		want     bool
+	}{
+		{"object", `{"ok":true}`, true, true},
+		{"truncated object", `{"items":[{"id":1},{"na`, false, true},
+		{"truncated document", `{"items":[{"id":1},{"na`, true, false},
+		{"html", `<!DOCTYPE html><html>`, false, false},
+		{"syntax error", `{"a":1,,"b":2}`, false, false},
+		{"text", `OK`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidJSON([]byte(tt.head), tt.complete); got != tt.want {
+				t.Errorf("ValidJSON(%q, %v) = %v, want %v", tt.head, tt.complete, got, tt.want)
+			}
+		})
+	}
+}
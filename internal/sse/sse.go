@@ -0,0 +1,90 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Headers clients must send with a PUT presigned for SSE-KMS
+const (
+	HeaderAlgorithm = "x-amz-server-side-encryption"
+	HeaderKMSKeyID  = "x-amz-server-side-encryption-aws-kms-key-id"
+)
+
+// AlgorithmKMS is the server-side encryption algorithm for SSE-KMS
+const AlgorithmKMS = "aws:kms"
+
+// Encryption is the server-side encryption of an object. The zero value
+// leaves encryption to the bucket default (SSE-S3).
+type Encryption struct {
+	KMSKeyID string
+}
+
+// Enabled reports whether objects are encrypted with a KMS key
+func (e Encryption) Enabled() bool {
+	return e.KMSKeyID != ""
+}
+
+// Headers returns the request headers that select this encryption, or nil
+// when the bucket default applies
+func (e Encryption) Headers() map[string]string {
+	if !e.Enabled() {
+		return nil
+	}
+	return map[string]string{
+		HeaderAlgorithm: AlgorithmKMS,
+		HeaderKMSKeyID:  e.KMSKeyID,
+	}
+}
+
+// Keys maps "project/env", "project" and "default" to KMS key ARNs, most
+// specific first. An empty ARN opts a project out of SSE-KMS.
+type Keys struct {
+	byName   map[string]string
+	fallback string
+}
+
+// ParseKeys parses a JSON object of KMS key ARNs. defaultKey applies when no
+// entry matches, e.g. the global SSE_KMS_KEY_ARN.
+func ParseKeys(s, defaultKey string) (*Keys, error) {
+	k := &Keys{byName: make(map[string]string), fallback: defaultKey}
+	if err := checkARN("default key", defaultKey); err != nil {
+		return nil, err
+	}
+	if s == "" {
+		return k, nil
+	}
+	if err := json.Unmarshal([]byte(s), &k.byName); err != nil {
+		return nil, fmt.Errorf("parse kms keys: %w", err)
+	}
+	for name, arn := range k.byName {
+		if err := checkARN(name, arn); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func checkARN(name, arn string) error {
+	if arn == "" {
+		return nil
+	}
+	if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":kms:") {
+		return fmt.Errorf("parse kms keys: %s: %q is not a KMS key ARN", name, arn)
+	}
+	return nil
+}
+
+// For returns the encryption of objects in project/env
+func (k *Keys) For(project, env string) Encryption {
+	if k == nil {
+		return Encryption{}
+	}
+	for _, name := range []string{project + "/" + env, project, "default"} {
+		if arn, ok := k.byName[name]; ok {
+			return Encryption{KMSKeyID: arn}
+		}
+	}
+	return Encryption{KMSKeyID: k.fallback}
+}
@@ -0,0 +1,55 @@
+package sse
+
+import "testing"
+
+const (
+	defaultARN = "arn:aws:kms:us-east-1:111122223333:key/default"
+	prodARN    = "arn:aws:kms:us-east-1:111122223333:key/myapp-prod"
+	appARN     = "arn:aws:kms:us-east-1:111122223333:key/myapp"
+)
+
+func TestKeys_For(t *testing.T) {
+	k, err := ParseKeys(`{"myapp/prod": "`+prodARN+`", "myapp": "`+appARN+`", "public": ""}`, defaultARN)
+	if err != nil {
+		t.Fatalf("ParseKeys() error = %v", err)
+	}
+
+	tests := []struct {
+		project, env string
+		want         string
+	}{
+		{"myapp", "prod", prodARN},
+		{"myapp", "staging", appARN},
+		{"other", "prod", defaultARN},
+		{"public", "prod", ""},
+	}
+	for _, tt := range tests {
+		if got := k.For(tt.project, tt.env).KMSKeyID; got != tt.want {
+			t.Errorf("For(%q, %q) = %q, want %q", tt.project, tt.env, got, tt.want)
+		}
+	}
+
+	var none *Keys
+	if none.For("myapp", "prod").Enabled() {
+		t.Error("nil Keys enabled encryption")
+	}
+
+	for _, bad := range []string{`{"myapp": "alias/foo"}`, `{"myapp": "arn:aws:s3:::bucket"}`, `[`} {
+		if _, err := ParseKeys(bad, ""); err == nil {
+			t.Errorf("ParseKeys(%s) error = nil", bad)
+		}
+	}
+	if _, err := ParseKeys("", "not-an-arn"); err == nil {
+		t.Error("ParseKeys() accepted an invalid default key")
+	}
+}
+
+func TestEncryption_Headers(t *testing.T) {
+	if h := (Encryption{}).Headers(); h != nil {
+		t.Errorf("Headers() = %v, want nil", h)
+	}
+	h := Encryption{KMSKeyID: prodARN}.Headers()
+	if h[HeaderAlgorithm] != "aws:kms" || h[HeaderKMSKeyID] != prodARN {
+		t.Errorf("Headers() = %v", h)
+	}
+}
@@ -0,0 +1,214 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/fingerprint"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Prefix is the S3 prefix under which daily statistics are stored
+const Prefix = "stats/"
+
+// DateLayout is the format of days in keys and queries
+const DateLayout = "2006-01-02"
+
+// maxURLs bounds the URLs counted per day record; further URLs count as Other
+const maxURLs = 200
+
+// Other is the URL under which URLs beyond maxURLs are counted
+const Other = "(other)"
+
+// Store is the subset of S3 operations used for statistics
+type Store interface {
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Day counts the completed failures of a project and env on one UTC day
+type Day struct {
+	Date      string         `json:"date"`
+	Project   string         `json:"project"`
+	Env       string         `json:"env"`
+	Count     int            `json:"count"`
+	Platforms map[string]int `json:"platforms"`
+	// URLs counts "METHOD /normalized/path"
+	URLs map[string]int `json:"urls"`
+}
+
+// Key returns the record key of a project and env on day
+// Format: stats/{project}/{env}/{yyyy-mm-dd}.json
+// Format with a tenant: stats/tenant={tenant}/{project}/{env}/{yyyy-mm-dd}.json
+func Key(tenant, project, env string, day time.Time) string {
+	return fmt.Sprintf("%s%s/%s/%s.json", tenantPrefix(tenant), project, env, day.UTC().Format(DateLayout))
+}
+
+func tenantPrefix(tenant string) string {
+	if tenant != "" {
+		return Prefix + "tenant=" + tenant + "/"
+	}
+	return Prefix
+}
+
+// Record counts env's failure in its day record. Concurrent completions of the
+// same project and env may race; counts are best-effort.
+func Record(ctx context.Context, store Store, env *models.Envelope, at time.Time) error {
+	key := Key(env.Tenant, env.Project, env.Env, at)
+	d := &Day{Date: at.UTC().Format(DateLayout), Project: env.Project, Env: env.Env}
+
+	exists, err := store.ObjectExists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		b, err := store.GetObjectBytes(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, d); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("resetting unreadable stats record")
+			d = &Day{Date: at.UTC().Format(DateLayout), Project: env.Project, Env: env.Env}
+		}
+	}
+	if d.Platforms == nil {
+		d.Platforms = make(map[string]int)
+	}
+	if d.URLs == nil {
+		d.URLs = make(map[string]int)
+	}
+
+	d.Count++
+	platform := env.Client.Platform
+	if platform == "" {
+		platform = "unknown"
+	}
+	d.Platforms[platform]++
+	u := strings.ToUpper(env.Request.Method) + " " + fingerprint.NormalizePath(env.Request.URL)
+	if _, ok := d.URLs[u]; !ok && len(d.URLs) >= maxURLs {
+		u = Other
+	}
+	d.URLs[u]++
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return store.PutObjectBytes(ctx, key, "application/json", b)
+}
+
+// Query is a statistics request. Project may be empty for every project
+// allowed reports true for; Env may be empty for every env.
+type Query struct {
+	Tenant  string
+	Project string
+	Env     string
+	// From and To are inclusive UTC days
+	From time.Time
+	To   time.Time
+	// Top is how many URLs to return
+	Top int
+}
+
+// Aggregate sums the day records matching q
+func Aggregate(ctx context.Context, store Store, q Query, allowed func(project string) bool) (*models.StatsResponse, error) {
+	prefix := tenantPrefix(q.Tenant)
+	if q.Project != "" {
+		prefix += q.Project + "/"
+		if q.Env != "" {
+			prefix += q.Env + "/"
+		}
+	}
+	keys, err := store.ListKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := q.From.UTC().Format(DateLayout), q.To.UTC().Format(DateLayout)
+	days := make(map[string]int)
+	projects := make(map[[2]string]int)
+	platforms := make(map[string]int)
+	urls := make(map[string]int)
+	total := 0
+
+	for _, key := range keys {
+		// {project}/{env}/{date}.json below the tenant prefix; other tenants' records are skipped
+		parts := strings.Split(strings.TrimPrefix(key, tenantPrefix(q.Tenant)), "/")
+		if len(parts) != 3 || strings.HasPrefix(parts[0], "tenant=") || (q.Env != "" && parts[1] != q.Env) {
+			continue
+		}
+		date := strings.TrimSuffix(parts[2], ".json")
+		if date < from || date > to || !allowed(parts[0]) {
+			continue
+		}
+
+		b, err := store.GetObjectBytes(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", key, err)
+		}
+		var d Day
+		if err := json.Unmarshal(b, &d); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("skipping unreadable stats record")
+			continue
+		}
+
+		total += d.Count
+		days[date] += d.Count
+		projects[[2]string{parts[0], parts[1]}] += d.Count
+		for p, n := range d.Platforms {
+			platforms[p] += n
+		}
+		for u, n := range d.URLs {
+			urls[u] += n
+		}
+	}
+
+	resp := &models.StatsResponse{
+		From:      from,
+		To:        to,
+		Total:     total,
+		Days:      []models.DayCount{},
+		Projects:  []models.ProjectCount{},
+		Platforms: []models.PlatformCount{},
+		TopURLs:   []models.URLCount{},
+	}
+	// Every day of the range is listed, so quiet days read as zero
+	for d := q.From.UTC(); d.Format(DateLayout) <= to; d = d.AddDate(0, 0, 1) {
+		resp.Days = append(resp.Days, models.DayCount{Date: d.Format(DateLayout), Count: days[d.Format(DateLayout)]})
+	}
+	for pe, n := range projects {
+		resp.Projects = append(resp.Projects, models.ProjectCount{Project: pe[0], Env: pe[1], Count: n})
+	}
+	sort.Slice(resp.Projects, func(i, j int) bool {
+		a, b := resp.Projects[i], resp.Projects[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Project+"/"+a.Env < b.Project+"/"+b.Env
+	})
+	for p, n := range platforms {
+		resp.Platforms = append(resp.Platforms, models.PlatformCount{Platform: p, Count: n})
+	}
+	sort.Slice(resp.Platforms, func(i, j int) bool {
+		a, b := resp.Platforms[i], resp.Platforms[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Platform < b.Platform)
+	})
+	for u, n := range urls {
+		resp.TopURLs = append(resp.TopURLs, models.URLCount{URL: u, Count: n})
+	}
+	sort.Slice(resp.TopURLs, func(i, j int) bool {
+		a, b := resp.TopURLs[i], resp.TopURLs[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.URL < b.URL)
+	})
+	if q.Top > 0 && len(resp.TopURLs) > q.Top {
+		resp.TopURLs = resp.TopURLs[:q.Top]
+	}
+	return resp, nil
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func failure(tenant, project, env, platform, url string) *models.Envelope {
+	return &models.Envelope{
+		Tenant:  tenant,
+		Project: project,
+		Env:     env,
+		Request: models.RequestInfo{Method: "get", URL: url},
+		Client:  models.ClientInfo{Platform: platform},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	day1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	day3 := day1.AddDate(0, 0, 2)
+
+	for _, rec := range []struct {
+		env *models.Envelope
+		at  time.Time
+	}{
+		{failure("", "myapp", "prod", "ios", "https://api.example.com/v1/orders/1"), day1},
+		{failure("", "myapp", "prod", "ios", "https://api.example.com/v1/orders/2"), day1},
+		{failure("", "myapp", "staging", "android", "https://api.example.com/v1/cart"), day3},
+		{failure("", "other", "prod", "", "https://api.example.com/v1/login"), day3},
+		{failure("acme", "myapp", "prod", "web", "https://api.example.com/v1/cart"), day3},
+	} {
+		if err := Record(ctx, store, rec.env, rec.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all := func(string) bool { return true }
+	resp, err := Aggregate(ctx, store, Query{From: day1, To: day3, Top: 1}, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 4 || len(resp.Days) != 3 || resp.Days[0].Count != 2 || resp.Days[1].Count != 0 || resp.Days[2].Count != 2 {
+		t.Errorf("total = %d, days = %+v", resp.Total, resp.Days)
+	}
+	if len(resp.Projects) != 3 || resp.Projects[0] != (models.ProjectCount{Project: "myapp", Env: "prod", Count: 2}) {
+		t.Errorf("projects = %+v", resp.Projects)
+	}
+	if len(resp.TopURLs) != 1 || resp.TopURLs[0] != (models.URLCount{URL: "GET /v1/orders/{id}", Count: 2}) {
+		t.Errorf("top URLs = %+v", resp.TopURLs)
+	}
+	if resp.Platforms[0] != (models.PlatformCount{Platform: "ios", Count: 2}) || len(resp.Platforms) != 3 {
+		t.Errorf("platforms = %+v", resp.Platforms)
+	}
+
+	// Filters: a project and env, a tenant, and the caller's projects
+	resp, _ = Aggregate(ctx, store, Query{Project: "myapp", Env: "staging", From: day1, To: day3}, all)
+	if resp.Total != 1 {
+		t.Errorf("myapp/staging total = %d", resp.Total)
+	}
+	resp, _ = Aggregate(ctx, store, Query{Tenant: "acme", From: day1, To: day3}, all)
+	if resp.Total != 1 || resp.Platforms[0].Platform != "web" {
+		t.Errorf("tenant stats = %+v", resp)
+	}
+	resp, _ = Aggregate(ctx, store, Query{From: day1, To: day3}, func(p string) bool { return p == "other" })
+	if resp.Total != 1 {
+		t.Errorf("restricted total = %d", resp.Total)
+	}
+	resp, _ = Aggregate(ctx, store, Query{From: day3, To: day3}, all)
+	if resp.Total != 2 || len(resp.Days) != 1 {
+		t.Errorf("single day = %+v", resp)
+	}
+}
+
+func TestRecord_BoundsURLs(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxURLs+5; i++ {
+		name := string(rune('a'+i/26%26)) + string(rune('a'+i%26))
+		env := failure("", "myapp", "prod", "ios", "https://api.example.com/v1/"+name)
+		if err := Record(ctx, store, env, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, _ := Aggregate(ctx, store, Query{From: at, To: at, Top: maxURLs + 5}, func(string) bool { return true })
+	if len(resp.TopURLs) != maxURLs+1 || resp.TopURLs[0] != (models.URLCount{URL: Other, Count: 5}) {
+		t.Errorf("got %d URLs, first %+v", len(resp.TopURLs), resp.TopURLs[0])
+	}
+}
@@ -0,0 +1,11 @@
+package storage
+
+import "errors"
+
+// ErrNotFound is wrapped by object store errors for keys that do not exist.
+// Other errors, such as throttling or access denied, never wrap it.
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidRange is wrapped by object store errors for byte ranges that do
+// not overlap the object
+var ErrInvalidRange = errors.New("range not satisfiable")
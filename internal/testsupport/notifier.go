@@ -0,0 +1,50 @@
+package testsupport
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yourorg/failure-uploader/internal/email"
+)
+
+// Notifier records failure notifications instead of sending them. It
+// implements email.Notifier and is safe for concurrent use.
+type Notifier struct {
+	mu    sync.Mutex
+	sent  []email.FailureNotification
+	err   error
+	calls int
+}
+
+// Fail makes every later send return err; a nil err restores it
+func (n *Notifier) Fail(err error) {
+	n.mu.Lock()
+	n.err = err
+	n.mu.Unlock()
+}
+
+// SendFailureNotification records notif, or returns the injected error
+func (n *Notifier) SendFailureNotification(ctx context.Context, notif email.FailureNotification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, notif)
+	return nil
+}
+
+// Sent returns the notifications sent successfully, in order
+func (n *Notifier) Sent() []email.FailureNotification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]email.FailureNotification(nil), n.sent...)
+}
+
+// Calls returns how many sends were attempted, including failed ones
+func (n *Notifier) Calls() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls
+}
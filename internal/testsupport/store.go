@@ -0,0 +1,565 @@
+// Package testsupport provides in-memory fakes of the service's storage and
+// notifications, so handlers can be tested without AWS
+package testsupport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/placement"
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/storage"
+)
+
+// Bucket is the bucket every object of a Store is reported in
+const Bucket = "test-bucket"
+
+// Object is an object held by a Store
+type Object struct {
+	Data         []byte
+	ContentType  string
+	Tags         map[string]string
+	StorageClass types.StorageClass
+	// RestoreDays is the duration of the last restore requested, 0 if none
+	RestoreDays int32
+}
+
+// Store is an in-memory object store implementing handlers.Store. Like the
+// S3 presigner, reads of missing keys wrap storage.ErrNotFound. It is safe
+// for concurrent use.
+type Store struct {
+	// BaseURL prefixes presigned URLs, which are BaseURL/{key}
+	BaseURL string
+
+	mu      sync.Mutex
+	objects map[string]*Object
+	errs    map[string]error
+}
+
+// NewStore creates an empty store presigning URLs under https://storage.test
+func NewStore() *Store {
+	return &Store{
+		BaseURL: "https://storage.test",
+		objects: make(map[string]*Object),
+		errs:    make(map[string]error),
+	}
+}
+
+// Fail makes every call of method, e.g. "PresignPut", return err; a nil err
+// restores it
+func (s *Store) Fail(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errs, method)
+		return
+	}
+	s.errs[method] = err
+}
+
+// Put stores data at key, as a client upload would
+func (s *Store) Put(key, contentType string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = &Object{Data: append([]byte(nil), data...), ContentType: contentType}
+}
+
+// Touch stores a one-byte object at each key, for tests that only need the
+// keys to exist
+func (s *Store) Touch(keys ...string) {
+	for _, k := range keys {
+		s.Put(k, "", []byte("x"))
+	}
+}
+
+// Object returns a copy of the object at key
+func (s *Store) Object(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return Object{}, false
+	}
+	out := *obj
+	out.Data = append([]byte(nil), obj.Data...)
+	out.Tags = copyTags(obj.Tags)
+	return out, true
+}
+
+// Keys returns the keys under prefix in order
+func (s *Store) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys(prefix)
+}
+
+func (s *Store) keys(prefix string) []string {
+	var out []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// err returns the error injected for method
+func (s *Store) err(method string) error {
+	return s.errs[method]
+}
+
+// get returns the object at key or an error wrapping storage.ErrNotFound
+func (s *Store) get(op, key string) (*Object, error) {
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s %s: %w", op, key, storage.ErrNotFound)
+	}
+	return obj, nil
+}
+
+// PresignPut returns BaseURL/{key}; opts.SHA256 is signed like S3 signs it
+func (s *Store) PresignPut(ctx context.Context, key string, opts s3client.PutOptions) (string, map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("PresignPut"); err != nil {
+		return "", nil, err
+	}
+	signed := make(map[string]string)
+	if opts.SHA256 != "" {
+		sum, err := hex.DecodeString(opts.SHA256)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid sha256 digest %q", opts.SHA256)
+		}
+		signed[s3client.HeaderChecksumSHA256] = base64.StdEncoding.EncodeToString(sum)
+	}
+	return s.url(key), signed, nil
+}
+
+// PresignPost returns BaseURL/ with the key and content type as fields
+func (s *Store) PresignPost(ctx context.Context, key string, opts s3client.PostOptions) (string, map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("PresignPost"); err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/", map[string]string{"key": key, "Content-Type": opts.ContentType}, nil
+}
+
+// PresignGet returns BaseURL/{key}
+func (s *Store) PresignGet(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("PresignGet"); err != nil {
+		return "", err
+	}
+	return s.url(key), nil
+}
+
+func (s *Store) url(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// ObjectExists reports whether key is stored
+func (s *Store) ObjectExists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("ObjectExists"); err != nil {
+		return false, err
+	}
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+// VerifyObjectsExist returns the keys that are not stored
+func (s *Store) VerifyObjectsExist(ctx context.Context, keys []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("VerifyObjectsExist"); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, k := range keys {
+		if _, ok := s.objects[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	return missing, nil
+}
+
+// ObjectSizes returns the size of each key
+func (s *Store) ObjectSizes(ctx context.Context, keys []string) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("ObjectSizes"); err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(keys))
+	for _, k := range keys {
+		obj, err := s.get("head", k)
+		if err != nil {
+			return nil, err
+		}
+		sizes[k] = int64(len(obj.Data))
+	}
+	return sizes, nil
+}
+
+// ObjectSHA256 returns the hex SHA-256 digest of key
+func (s *Store) ObjectSHA256(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("ObjectSHA256"); err != nil {
+		return "", err
+	}
+	obj, err := s.get("get", key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(obj.Data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GetObjectBytes returns the data of key
+func (s *Store) GetObjectBytes(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("GetObjectBytes"); err != nil {
+		return nil, err
+	}
+	obj, err := s.get("get", key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), obj.Data...), nil
+}
+
+// GetObjectHead returns at most the first n bytes of key
+func (s *Store) GetObjectHead(ctx context.Context, key string, n int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("GetObjectHead"); err != nil {
+		return nil, err
+	}
+	obj, err := s.get("get", key)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(obj.Data)) < n {
+		n = int64(len(obj.Data))
+	}
+	return append([]byte(nil), obj.Data[:n]...), nil
+}
+
+// OpenObject opens key for streaming. Like S3 it serves a single byte range,
+// ignores malformed ones and wraps storage.ErrInvalidRange for ranges past the
+// end of the object.
+func (s *Store) OpenObject(ctx context.Context, key, byteRange string) (*s3client.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("OpenObject"); err != nil {
+		return nil, err
+	}
+	obj, err := s.get("get", key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(obj.Data)
+	out := &s3client.Object{
+		ContentType: obj.ContentType,
+		ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+	data, size := obj.Data, int64(len(obj.Data))
+	if start, end, ok := parseRange(byteRange, size); ok {
+		if start >= size {
+			return nil, fmt.Errorf("get %s: %w", key, storage.ErrInvalidRange)
+		}
+		data = data[start : end+1]
+		out.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+	}
+	out.ContentLength = int64(len(data))
+	out.Body = io.NopCloser(bytes.NewReader(append([]byte(nil), data...)))
+	return out, nil
+}
+
+// parseRange parses a single range of the form bytes=a-b, bytes=a- or
+// bytes=-n of an object of size bytes, clamping its end to the object
+func parseRange(byteRange string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(byteRange, "bytes=")
+	first, last, dash := strings.Cut(spec, "-")
+	if !found || !dash || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// ListKeys returns the keys under prefix in order
+func (s *Store) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("ListKeys"); err != nil {
+		return nil, err
+	}
+	return s.keys(prefix), nil
+}
+
+// ListPrefixes returns the immediate child prefixes under prefix, split on "/"
+func (s *Store) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("ListPrefixes"); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, k := range s.keys(prefix) {
+		i := strings.Index(k[len(prefix):], "/")
+		if i < 0 {
+			continue
+		}
+		if p := k[:len(prefix)+i+1]; !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// PutObjectBytes stores data at key
+func (s *Store) PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("PutObjectBytes"); err != nil {
+		return err
+	}
+	s.objects[key] = &Object{Data: append([]byte(nil), data...), ContentType: contentType}
+	return nil
+}
+
+// Upload stores the contents of body at key
+func (s *Store) Upload(ctx context.Context, key, contentType string, body io.Reader) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("Upload"); err != nil {
+		return err
+	}
+	s.objects[key] = &Object{Data: data, ContentType: contentType}
+	return nil
+}
+
+// CopyObject copies src, with its content type and tags, to dst
+func (s *Store) CopyObject(ctx context.Context, src, dst string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("CopyObject"); err != nil {
+		return err
+	}
+	obj, err := s.get("copy", src)
+	if err != nil {
+		return err
+	}
+	s.objects[dst] = &Object{Data: append([]byte(nil), obj.Data...), ContentType: obj.ContentType, Tags: copyTags(obj.Tags)}
+	return nil
+}
+
+// DeleteObjects deletes keys; missing keys are ignored like in S3
+func (s *Store) DeleteObjects(ctx context.Context, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("DeleteObjects"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		delete(s.objects, k)
+	}
+	return nil
+}
+
+// TagObjects replaces the tags of each key with tags
+func (s *Store) TagObjects(ctx context.Context, keys []string, tags map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("TagObjects"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		obj, err := s.get("tag", k)
+		if err != nil {
+			return err
+		}
+		obj.Tags = copyTags(tags)
+	}
+	return nil
+}
+
+// ObjectTags returns the tags of key
+func (s *Store) ObjectTags(ctx context.Context, key string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("ObjectTags"); err != nil {
+		return nil, err
+	}
+	obj, err := s.get("get tags of", key)
+	if err != nil {
+		return nil, err
+	}
+	return copyTags(obj.Tags), nil
+}
+
+// MarkComplete tags every object of the failure key belongs to with the
+// complete stage
+func (s *Store) MarkComplete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("MarkComplete"); err != nil {
+		return err
+	}
+	loc, ok := keys.Parse(key)
+	if !ok {
+		return fmt.Errorf("not a failure object: %s", key)
+	}
+	for _, k := range s.keys(loc.Prefix) {
+		obj := s.objects[k]
+		if obj.Tags == nil {
+			obj.Tags = make(map[string]string)
+		}
+		obj.Tags[placement.TagStage] = placement.StageComplete
+	}
+	return nil
+}
+
+// SetStorageClass sets the storage class of key
+func (s *Store) SetStorageClass(ctx context.Context, key string, storageClass types.StorageClass) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("SetStorageClass"); err != nil {
+		return err
+	}
+	obj, err := s.get("copy", key)
+	if err != nil {
+		return err
+	}
+	obj.StorageClass = storageClass
+	return nil
+}
+
+// RestoreObject records a restore of key for days
+func (s *Store) RestoreObject(ctx context.Context, key string, days int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.err("RestoreObject"); err != nil {
+		return err
+	}
+	obj, err := s.get("restore", key)
+	if err != nil {
+		return err
+	}
+	obj.RestoreDays = days
+	return nil
+}
+
+// BucketFor returns Bucket
+func (s *Store) BucketFor(key string) string {
+	return Bucket
+}
+
+// ServeHTTP serves the presigned URLs of the store, so clients can upload to
+// and download from it over HTTP: serve it with httptest and set BaseURL to
+// the server's URL. A PUT stores its body at the key in the path, rejecting
+// it with 400 BadDigest when a signed SHA-256 does not match; a GET returns
+// the object. A multipart POST stores the file of a presigned POST form at its
+// key field.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPost:
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		contentType := r.FormValue("Content-Type")
+		if contentType == "" {
+			contentType = header.Header.Get("Content-Type")
+		}
+		s.Put(r.FormValue("key"), contentType, data)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if want := r.Header.Get(s3client.HeaderChecksumSHA256); want != "" {
+			sum := sha256.Sum256(data)
+			if base64.StdEncoding.EncodeToString(sum[:]) != want {
+				http.Error(w, "BadDigest", http.StatusBadRequest)
+				return
+			}
+		}
+		s.Put(key, r.Header.Get("Content-Type"), data)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		obj, ok := s.Object(key)
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.ContentType)
+		w.Write(obj.Data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	out := make(map[string]string, len(tags))
+	for k, v := range tags {
+		out[k] = v
+	}
+	return out
+}
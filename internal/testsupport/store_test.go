@@ -0,0 +1,76 @@
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/failure-uploader/internal/s3client"
+	"github.com/yourorg/failure-uploader/internal/storage"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+	s.Put("failures/myapp/prod/a/envelope.json", "application/json", []byte("{}"))
+	s.Put("failures/myapp/dev/b/envelope.json", "application/json", []byte("{}"))
+	s.Put("failures/other/prod/c/envelope.json", "application/json", []byte("{}"))
+
+	prefixes, _ := s.ListPrefixes(ctx, "failures/myapp/")
+	if want := []string{"failures/myapp/dev/", "failures/myapp/prod/"}; !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("ListPrefixes() = %v, want %v", prefixes, want)
+	}
+	if _, err := s.GetObjectBytes(ctx, "failures/missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetObjectBytes(missing) error = %v, want storage.ErrNotFound", err)
+	}
+
+	injected := errors.New("throttled")
+	s.Fail("ListKeys", injected)
+	if _, err := s.ListKeys(ctx, "failures/"); err != injected {
+		t.Errorf("ListKeys() error = %v, want the injected error", err)
+	}
+	s.Fail("ListKeys", nil)
+	if keys, err := s.ListKeys(ctx, "failures/"); err != nil || len(keys) != 3 {
+		t.Errorf("ListKeys() = %v, %v after clearing the failure", keys, err)
+	}
+}
+
+func TestStore_ServeHTTP(t *testing.T) {
+	s := NewStore()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	s.BaseURL = srv.URL
+
+	put := func(url string, signed map[string]string, body string) int {
+		req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+		for k, v := range signed {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// sha256("data")
+	digest := "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	url, signed, err := s.PresignPut(context.Background(), "failures/myapp/prod/a/files/log #1.txt", s3client.PutOptions{SHA256: digest})
+	if err != nil {
+		t.Fatalf("PresignPut() error = %v", err)
+	}
+	if status := put(url, signed, "tampered"); status != http.StatusBadRequest {
+		t.Errorf("PUT with a wrong digest status = %d, want 400", status)
+	}
+	if status := put(url, signed, "data"); status != http.StatusOK {
+		t.Fatalf("PUT status = %d", status)
+	}
+	if obj, ok := s.Object("failures/myapp/prod/a/files/log #1.txt"); !ok || string(obj.Data) != "data" {
+		t.Errorf("Object() = %+v, %v; want the uploaded data at the unescaped key", obj, ok)
+	}
+}
@@ -0,0 +1,150 @@
+package thumbs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/queue/consumer"
+	"github.com/yourorg/failure-uploader/internal/storage"
+)
+
+// Version is the schema version of queued messages
+const Version = 1
+
+// Message is the body of a queued thumbnail request
+type Message struct {
+	Version    int       `json:"version"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	FailureID  string    `json:"failureId"`
+	Project    string    `json:"project"`
+	// Keys are the image objects to thumbnail
+	Keys []string `json:"keys"`
+}
+
+// Store is the subset of S3 operations generating thumbnails needs
+type Store interface {
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+}
+
+// Publisher queues the images of completed failures for thumbnailing
+type Publisher struct {
+	client   queue.API
+	queueURL string
+}
+
+// NewPublisher creates a publisher sending to the queue at queueURL
+func NewPublisher(client queue.API, queueURL string) *Publisher {
+	return &Publisher{client: client, queueURL: queueURL}
+}
+
+// Enqueue queues the image objects at imageKeys of failureID
+func (p *Publisher) Enqueue(ctx context.Context, project, failureID string, imageKeys []string) error {
+	b, err := json.Marshal(Message{Version: Version, EnqueuedAt: time.Now().UTC(), FailureID: failureID, Project: project, Keys: imageKeys})
+	if err != nil {
+		return err
+	}
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(b)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"project": {DataType: aws.String("String"), StringValue: aws.String(project)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("enqueue thumbnails: %w", err)
+	}
+	return nil
+}
+
+// Decode parses a queued message body
+func Decode(body string) (Message, error) {
+	var m Message
+	if err := consumer.Decode(body, Version, &m); err != nil {
+		return Message{}, fmt.Errorf("parse queued thumbnails: %w", err)
+	}
+	return m, nil
+}
+
+// Worker generates the thumbnails of queued images
+type Worker struct {
+	store Store
+	size  int
+}
+
+// NewWorker creates a worker reading images from and writing thumbnails of at
+// most size pixels to store
+func NewWorker(store Store, size int) *Worker {
+	return &Worker{store: store, size: size}
+}
+
+// process generates the thumbnails of the images queued in body. Images that
+// are gone, e.g. quarantined by the malware scan, and images that cannot be
+// decoded are skipped.
+func (w *Worker) process(ctx context.Context, id, body string) error {
+	m, err := Decode(body)
+	if err != nil {
+		return consumer.Malformed(err)
+	}
+	for _, k := range m.Keys {
+		loc, ok := keys.Parse(k)
+		if !ok {
+			continue
+		}
+		src, err := w.store.GetObjectBytes(ctx, k)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("messageId", id).Str("key", k).Msg("thumbnail will be retried")
+			return err
+		}
+		thumb, err := Generate(src, w.size)
+		if err != nil {
+			metrics.Thumbnails.Inc(m.Project, "failed")
+			logging.FromContext(ctx).Warn().Err(err).Str("failureId", m.FailureID).Str("key", k).Msg("failed to generate thumbnail")
+			continue
+		}
+		if err := w.store.PutObjectBytes(ctx, loc.Prefix+Name(strings.TrimPrefix(k, loc.Prefix)), "image/png", thumb); err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("messageId", id).Str("key", k).Msg("thumbnail will be retried")
+			return err
+		}
+		metrics.Thumbnails.Inc(m.Project, "generated")
+	}
+	logging.FromContext(ctx).Info().
+		Str("messageId", id).
+		Str("failureId", m.FailureID).
+		Int("images", len(m.Keys)).
+		Dur("queued", time.Since(m.EnqueuedAt)).
+		Msg("thumbnails generated")
+	return nil
+}
+
+// consumer returns the consumer of the thumbnail queue
+func (w *Worker) consumer() consumer.Consumer {
+	return consumer.New("thumbnails", w.process)
+}
+
+// Handle processes the queued images of an SQS Lambda event. Failed messages
+// are reported as batch item failures, so SQS retries only those; malformed
+// ones are dropped.
+func (w *Worker) Handle(ctx context.Context, event events.SQSEvent) events.SQSEventResponse {
+	return w.consumer().Handle(ctx, event)
+}
+
+// Poll consumes queued images from the queue at queueURL; see consumer.Consumer.Poll
+func (w *Worker) Poll(ctx context.Context, client consumer.Receiver, queueURL string) {
+	w.consumer().Poll(ctx, client, queueURL)
+}
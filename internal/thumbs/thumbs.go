@@ -0,0 +1,152 @@
+// Package thumbs generates small PNG thumbnails of the image attachments of
+// completed failures, so triagers can glance at a screenshot without
+// downloading it. Upload-complete queues the images; a worker stores each
+// thumbnail under the failure's thumbs/ directory.
+package thumbs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"path"
+	"strings"
+
+	// Register the decoders of the supported source formats
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Dir is the directory below a failure's prefix that thumbnails are stored in
+const Dir = "thumbs/"
+
+// DefaultSize is the default bound of a thumbnail's longer side in pixels
+const DefaultSize = 320
+
+// MaxPixels bounds the dimensions of source images, so a small file declaring
+// a huge canvas cannot exhaust the worker's memory
+const MaxPixels = 40_000_000
+
+// ErrUnsupported is returned for sources that cannot be thumbnailed, such as
+// undecodable or oversized images; retrying them cannot succeed
+var ErrUnsupported = errors.New("unsupported image")
+
+// supported are the content types the standard library decodes
+var supported = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// Supported reports whether images of contentType can be thumbnailed
+func Supported(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return supported[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// Name returns the name of the thumbnail of artifact, both relative to the
+// failure's prefix
+// Format: thumbs/{artifact}.png
+func Name(artifact string) string {
+	return Dir + artifact + ".png"
+}
+
+// SourceKey returns the key of the artifact the thumbnail at key was made
+// from, reporting false for keys that are not thumbnails
+func SourceKey(key string) (string, bool) {
+	loc, ok := keys.Parse(key)
+	if !ok {
+		return "", false
+	}
+	name := strings.TrimPrefix(key, loc.Prefix)
+	if !strings.HasPrefix(name, Dir) || !strings.HasSuffix(name, ".png") || len(name) <= len(Dir)+len(".png") {
+		return "", false
+	}
+	return loc.Prefix + strings.TrimSuffix(strings.TrimPrefix(name, Dir), ".png"), true
+}
+
+// Sources returns the artifacts of envObj that get thumbnails: the screenshot
+// slot first, then attached files of a supported type. Encrypted failures
+// have none, since the service cannot read their artifacts.
+func Sources(envObj *models.Envelope) []string {
+	if envObj.Encryption != nil {
+		return nil
+	}
+	var names []string
+	if envObj.Artifacts != nil && envObj.Artifacts.Screenshot {
+		names = append(names, keys.ScreenshotName)
+	}
+	for _, f := range envObj.Request.Files {
+		if Supported(f.ContentType) {
+			names = append(names, path.Join("files", f.Filename))
+		}
+	}
+	return names
+}
+
+// Generate decodes a PNG, JPEG or GIF image and returns it as a PNG scaled
+// down to fit size×size, keeping its aspect ratio. Smaller images keep their
+// dimensions.
+func Generate(data []byte, size int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrUnsupported, cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scale(src, size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale shrinks src to fit size×size, averaging the source pixels each
+// thumbnail pixel covers
+func scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	// Work on premultiplied RGBA so transparent pixels do not darken the average
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, bl, a = r+int(p[0]), g+int(p[1]), bl+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,148 @@
+package thumbs
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+const prefix = "failures/myapp/prod/2026/10/16/f1/"
+
+type fakeSQS struct {
+	sent []string
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, aws.ToString(in.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// encodePNG returns a w×h PNG filled with c
+func encodePNG(t *testing.T, w, h int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h         int
+		wantW, wantH int
+	}{
+		{name: "landscape", w: 1280, h: 720, wantW: 320, wantH: 180},
+		{name: "portrait", w: 390, h: 844, wantW: 147, wantH: 320},
+		{name: "small", w: 100, h: 40, wantW: 100, wantH: 40},
+		{name: "sliver", w: 4000, h: 2, wantW: 320, wantH: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := Generate(encodePNG(t, tt.w, tt.h, color.NRGBA{R: 200, G: 40, B: 40, A: 255}), DefaultSize)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail is not a PNG: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+			if r, g, _, a := img.At(0, 0).RGBA(); r>>8 != 200 || g>>8 != 40 || a>>8 != 255 {
+				t.Errorf("thumbnail pixel = %v, want the source color", img.At(0, 0))
+			}
+		})
+	}
+
+	if _, err := Generate([]byte("MZ\x90\x00"), DefaultSize); err == nil {
+		t.Error("Generate(executable) succeeded")
+	}
+}
+
+func TestNames(t *testing.T) {
+	if got := Name("screenshot.png"); got != "thumbs/screenshot.png.png" {
+		t.Errorf("Name() = %q", got)
+	}
+	if src, ok := SourceKey(prefix + Name("files/photo.jpg")); !ok || src != prefix+"files/photo.jpg" {
+		t.Errorf("SourceKey() = %q, %v", src, ok)
+	}
+	for _, k := range []string{prefix + "screenshot.png", prefix + "thumbs/.png", "quarantine/" + prefix + "thumbs/a.png.png"} {
+		if src, ok := SourceKey(k); ok {
+			t.Errorf("SourceKey(%q) = %q, want no thumbnail", k, src)
+		}
+	}
+
+	envObj := &models.Envelope{
+		Artifacts: &models.ArtifactPresence{Screenshot: true},
+		Request: models.RequestInfo{Files: []models.FileInfo{
+			{Name: "photo", Filename: "photo.jpg", ContentType: "image/jpeg"},
+			{Name: "scan", Filename: "scan.heic", ContentType: "image/heic"},
+			{Name: "doc", Filename: "doc.pdf", ContentType: "application/pdf"},
+		}},
+	}
+	if got := Sources(envObj); !reflect.DeepEqual(got, []string{"screenshot.png", "files/photo.jpg"}) {
+		t.Errorf("Sources() = %v", got)
+	}
+	envObj.Encryption = &models.Encryption{Algorithm: "AES-256-GCM"}
+	if got := Sources(envObj); got != nil {
+		t.Errorf("Sources(encrypted) = %v, want none", got)
+	}
+}
+
+func TestWorker_Handle(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	store.Put(prefix+"screenshot.png", "image/png", encodePNG(t, 640, 480, color.White))
+	store.Put(prefix+"files/fake.png", "image/png", []byte("not an image"))
+
+	queue := &fakeSQS{}
+	if err := NewPublisher(queue, "https://sqs.us-east-1.amazonaws.com/123/thumbs").Enqueue(ctx, "myapp", "f1",
+		[]string{prefix + "screenshot.png", prefix + "files/fake.png", prefix + "files/gone.png"}); err != nil {
+		t.Fatal(err)
+	}
+	resp := NewWorker(store, 64).Handle(ctx, events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "m1", Body: queue.sent[0]},
+		{MessageId: "m2", Body: "not json"},
+	}})
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("BatchItemFailures = %+v, want undecodable and missing images skipped", resp.BatchItemFailures)
+	}
+
+	b, err := store.GetObjectBytes(ctx, prefix+"thumbs/screenshot.png.png")
+	if err != nil {
+		t.Fatalf("thumbnail not stored: %v", err)
+	}
+	if cfg, err := png.DecodeConfig(bytes.NewReader(b)); err != nil || cfg.Width != 64 || cfg.Height != 48 {
+		t.Errorf("thumbnail = %+v, %v; want 64x48", cfg, err)
+	}
+	if ok, _ := store.ObjectExists(ctx, prefix+"thumbs/files/fake.png.png"); ok {
+		t.Error("thumbnail stored for an undecodable image")
+	}
+}
@@ -0,0 +1,388 @@
+package tickets
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/keys"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// Prefix is the S3 prefix under which ticket records are stored
+const Prefix = "tickets/"
+
+// ErrNotFound is returned when no ticket was tracked for a failure
+var ErrNotFound = errors.New("no ticket tracked for failure")
+
+// CompletionLease is how long an unfinished completion holds off retries, after
+// which it is presumed to have crashed and may be claimed again
+const CompletionLease = time.Minute
+
+// Errors returned by Claim when a completion must not proceed
+var (
+	ErrAlreadyCompleted = errors.New("failure was completed with another idempotency key")
+	ErrKeyReused        = errors.New("idempotency key reused with a different request")
+	ErrInProgress       = errors.New("completion is in progress")
+)
+
+// State is the lifecycle state of an upload ticket
+type State string
+
+const (
+	// StateIssued tickets are waiting for upload-complete
+	StateIssued State = "issued"
+	// StateCompleted tickets were confirmed by upload-complete
+	StateCompleted State = "completed"
+	// StateExpired tickets were never completed and their uploads were deleted
+	StateExpired State = "expired"
+)
+
+// Store is the subset of S3 operations ticket tracking needs
+type Store interface {
+	PutObjectBytes(ctx context.Context, key, contentType string, data []byte) error
+	GetObjectBytes(ctx context.Context, key string) ([]byte, error)
+	ObjectExists(ctx context.Context, key string) (bool, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	DeleteObjects(ctx context.Context, keys []string) error
+}
+
+// Record tracks an upload ticket from issue until it completes or expires
+type Record struct {
+	FailureID string    `json:"failureId"`
+	Project   string    `json:"project"`
+	Env       string    `json:"env"`
+	S3Prefix  string    `json:"s3Prefix"`
+	State     State     `json:"state"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	// UserHash is the hashed client.userId, when the client sent one
+	UserHash string `json:"userHash,omitempty"`
+
+	// Request, Client and Response are the redacted ticket metadata from which
+	// the envelope can be generated; Client never holds the raw user ID
+	Request  *models.RequestInfo  `json:"request,omitempty"`
+	Client   *models.ClientInfo   `json:"client,omitempty"`
+	Response *models.ResponseInfo `json:"response,omitempty"`
+	Severity string               `json:"severity,omitempty"`
+	// Tags and Description are redacted like the request
+	Tags        map[string]string `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
+	// Artifacts are the declared artifact slots, whose sizes upload-complete enforces
+	Artifacts *models.ArtifactsInfo `json:"artifacts,omitempty"`
+
+	// Expected are the keys the client was handed to upload, bar the optional
+	// checksums.json; the auto-completion worker completes the ticket once
+	// all of them are stored
+	Expected []string `json:"expected,omitempty"`
+	// CriticalAllowed records that the ticket's caller may mark the failure
+	// critical, for completions the auto-completion worker queues without it
+	CriticalAllowed bool `json:"criticalAllowed,omitempty"`
+	// QueuedAt is when the auto-completion worker queued the ticket's completion
+	QueuedAt *time.Time `json:"queuedAt,omitempty"`
+
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiredAt   *time.Time `json:"expiredAt,omitempty"`
+
+	// Completion is the idempotency record of upload-complete
+	Completion *Completion `json:"completion,omitempty"`
+}
+
+// Completion records an upload-complete call so retries get its response
+// instead of being processed again
+type Completion struct {
+	Key         string    `json:"key"`
+	RequestHash string    `json:"requestHash"`
+	StartedAt   time.Time `json:"startedAt"`
+	// Response is the body returned to the call; empty while it is in progress
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Key returns the record key
+// Format: tickets/{failureId}.json
+func Key(failureID string) string {
+	return Prefix + failureID + ".json"
+}
+
+// Issue records a newly issued ticket
+func Issue(ctx context.Context, store Store, r Record) error {
+	r.State = StateIssued
+	return put(ctx, store, &r)
+}
+
+// Get returns the ticket tracked for failureID, or ErrNotFound
+func Get(ctx context.Context, store Store, failureID string) (*Record, error) {
+	key := Key(failureID)
+	exists, err := store.ObjectExists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return load(ctx, store, key)
+}
+
+// Complete marks the ticket for failureID completed at now, returning ErrNotFound
+// if none was tracked. Completing twice keeps the first completion.
+func Complete(ctx context.Context, store Store, failureID string, now time.Time) error {
+	r, err := Get(ctx, store, failureID)
+	if err != nil {
+		return err
+	}
+	if r.State != StateIssued {
+		return nil
+	}
+
+	r.State = StateCompleted
+	r.CompletedAt = &now
+	return put(ctx, store, r)
+}
+
+// Claim starts the completion of r under the idempotency key. When the same
+// request already completed, its stored response is returned and the caller
+// must not process it again; an error means the call must not proceed.
+// Unfinished claims older than CompletionLease are taken over.
+func Claim(ctx context.Context, store Store, r *Record, key, requestHash string, now time.Time) (json.RawMessage, error) {
+	if prior := r.Completion; prior != nil && (prior.Response != nil || now.Before(prior.StartedAt.Add(CompletionLease))) {
+		switch {
+		case prior.Key != key:
+			return nil, ErrAlreadyCompleted
+		case prior.RequestHash != requestHash:
+			return nil, ErrKeyReused
+		case prior.Response != nil:
+			return prior.Response, nil
+		default:
+			return nil, ErrInProgress
+		}
+	}
+
+	r.Completion = &Completion{Key: key, RequestHash: requestHash, StartedAt: now}
+	return nil, put(ctx, store, r)
+}
+
+// Finish stores the response of a claimed completion and marks the ticket completed
+func Finish(ctx context.Context, store Store, r *Record, response json.RawMessage, now time.Time) error {
+	r.Completion.Response = response
+	if r.State == StateIssued {
+		r.State = StateCompleted
+		r.CompletedAt = &now
+	}
+	return put(ctx, store, r)
+}
+
+// Release drops an unfinished claim, e.g. after a retryable error, so the call
+// can be retried without waiting for the lease
+func Release(ctx context.Context, store Store, r *Record) error {
+	r.Completion = nil
+	return put(ctx, store, r)
+}
+
+// SetQueued records when the auto-completion worker queued r's completion;
+// nil clears it, e.g. after the completion could not be queued
+func SetQueued(ctx context.Context, store Store, r *Record, at *time.Time) error {
+	r.QueuedAt = at
+	return put(ctx, store, r)
+}
+
+// Result summarizes a reaper run
+type Result struct {
+	// Completed and Expired count the tickets older than the maximum age settled by this run
+	Completed int
+	Expired   int
+	// DeletedObjects is the number of partial uploads removed
+	DeletedObjects int
+	Failed         int
+}
+
+// AbandonmentRate is the share of settled tickets that were never completed
+func (r Result) AbandonmentRate() float64 {
+	if r.Completed+r.Expired == 0 {
+		return 0
+	}
+	return float64(r.Expired) / float64(r.Completed+r.Expired)
+}
+
+// Reap settles every ticket issued at least maxAge ago. Uncompleted tickets have
+// their partial uploads deleted and are marked expired; records of completed
+// tickets are deleted, as are expired records once they are maxAge old.
+func Reap(ctx context.Context, store Store, maxAge time.Duration, now time.Time) (Result, error) {
+	var res Result
+
+	keys, err := store.ListKeys(ctx, Prefix)
+	if err != nil {
+		return res, fmt.Errorf("list tickets: %w", err)
+	}
+
+	for _, key := range keys {
+		r, err := load(ctx, store, key)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("skipping unreadable ticket record")
+			continue
+		}
+		if now.Before(r.IssuedAt.Add(maxAge)) {
+			continue
+		}
+
+		switch r.State {
+		case StateIssued:
+			n, err := expire(ctx, store, r, now)
+			if err != nil {
+				logging.FromContext(ctx).Error().Err(err).Str("failureId", r.FailureID).Msg("failed to reap abandoned ticket")
+				res.Failed++
+				continue
+			}
+			res.Expired++
+			res.DeletedObjects += n
+			metrics.TicketsReaped.Inc(r.Project, string(StateExpired))
+			metrics.ReapedObjects.Add(float64(n), r.Project)
+
+			logging.FromContext(ctx).Info().Str("failureId", r.FailureID).Str("project", r.Project).Int("objects", n).Msg("abandoned ticket reaped")
+		case StateCompleted:
+			if err := store.DeleteObjects(ctx, []string{key}); err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Str("failureId", r.FailureID).Msg("failed to delete completed ticket record")
+				continue
+			}
+			res.Completed++
+			metrics.TicketsReaped.Inc(r.Project, string(StateCompleted))
+		case StateExpired:
+			if r.ExpiredAt != nil && now.Before(r.ExpiredAt.Add(maxAge)) {
+				continue
+			}
+			if err := store.DeleteObjects(ctx, []string{key}); err != nil {
+				logging.FromContext(ctx).Warn().Err(err).Str("failureId", r.FailureID).Msg("failed to delete expired ticket record")
+			}
+		}
+	}
+
+	logging.FromContext(ctx).Info().
+		Int("completed", res.Completed).
+		Int("expired", res.Expired).
+		Int("deletedObjects", res.DeletedObjects).
+		Float64("abandonmentRate", res.AbandonmentRate()).
+		Int("failed", res.Failed).
+		Msg("ticket reaper run finished")
+
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d of %d abandoned tickets could not be reaped", res.Failed, res.Failed+res.Expired)
+	}
+	return res, nil
+}
+
+// expire deletes the partial uploads of r and marks it expired, returning the
+// number of objects deleted
+func expire(ctx context.Context, store Store, r *Record, now time.Time) (int, error) {
+	// Never delete outside the failure's own prefix, e.g. the whole bucket for an empty prefix
+	if r.FailureID == "" || !strings.HasSuffix(r.S3Prefix, "/"+r.FailureID+"/") {
+		return 0, fmt.Errorf("refusing to delete prefix %q", r.S3Prefix)
+	}
+
+	keys, err := store.ListKeys(ctx, r.S3Prefix)
+	if err != nil {
+		return 0, fmt.Errorf("list %s: %w", r.S3Prefix, err)
+	}
+	if len(keys) > 0 {
+		if err := store.DeleteObjects(ctx, keys); err != nil {
+			return 0, fmt.Errorf("delete %s: %w", r.S3Prefix, err)
+		}
+	}
+
+	r.State = StateExpired
+	r.ExpiredAt = &now
+	if err := put(ctx, store, r); err != nil {
+		return len(keys), fmt.Errorf("mark expired: %w", err)
+	}
+	return len(keys), nil
+}
+
+func load(ctx context.Context, store Store, key string) (*Record, error) {
+	b, err := store.GetObjectBytes(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	var r Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", key, err)
+	}
+	return &r, nil
+}
+
+func put(ctx context.Context, store Store, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// Tickets are kept in their failure's bucket
+	return store.PutObjectBytes(keys.WithScope(ctx, r.Project, r.Env), Key(r.FailureID), "application/json", b)
+}
+
+// UserIndexPrefix is the S3 prefix of the user index. It lives outside Prefix so
+// the reaper never removes it; entries are deleted when their failure is erased.
+const UserIndexPrefix = "users/"
+
+// hashedPrefix marks user identifiers that were already hashed
+const hashedPrefix = "sha256:"
+
+// HashUserID hashes a user identifier with HMAC-SHA256 under key, or plain
+// SHA-256 when key is empty. Hashed identifiers are returned unchanged, so
+// hashing twice is harmless.
+func HashUserID(key, userID string) string {
+	if userID == "" || strings.HasPrefix(userID, hashedPrefix) {
+		return userID
+	}
+	var sum []byte
+	if key == "" {
+		s := sha256.Sum256([]byte(userID))
+		sum = s[:]
+	} else {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(userID))
+		sum = mac.Sum(nil)
+	}
+	return hashedPrefix + hex.EncodeToString(sum)
+}
+
+// UserPrefix returns the user index prefix of userHash
+// Format: users/{hex hash}/
+func UserPrefix(userHash string) string {
+	return UserIndexPrefix + strings.TrimPrefix(userHash, hashedPrefix) + "/"
+}
+
+// UserKey returns the user index key of a failure
+// Format: users/{hex hash}/{failureId}.json
+func UserKey(userHash, failureID string) string {
+	return UserPrefix(userHash) + failureID + ".json"
+}
+
+// IndexUser records that the ticket's failure belongs to r.UserHash
+func IndexUser(ctx context.Context, store Store, r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return store.PutObjectBytes(keys.WithScope(ctx, r.Project, r.Env), UserKey(r.UserHash, r.FailureID), "application/json", b)
+}
+
+// UserFailures returns the ticket of every failure indexed for userHash
+func UserFailures(ctx context.Context, store Store, userHash string) ([]Record, error) {
+	keys, err := store.ListKeys(ctx, UserPrefix(userHash))
+	if err != nil {
+		return nil, fmt.Errorf("list user index: %w", err)
+	}
+	records := make([]Record, 0, len(keys))
+	for _, key := range keys {
+		r, err := load(ctx, store, key)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *r)
+	}
+	return records, nil
+}
@@ -0,0 +1,208 @@
+package tickets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/failure-uploader/internal/testsupport"
+)
+
+func prefix(failureID string) string {
+	return "failures/myapp/prod/2024-03-15/" + failureID + "/"
+}
+
+func TestComplete(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	issued := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	if err := Complete(ctx, store, "missing", issued); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Complete() error = %v, want ErrNotFound", err)
+	}
+
+	if err := Issue(ctx, store, Record{FailureID: "f1", Project: "myapp", Env: "prod", S3Prefix: prefix("f1"), IssuedAt: issued}); err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	first := issued.Add(time.Minute)
+	if err := Complete(ctx, store, "f1", first); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if err := Complete(ctx, store, "f1", first.Add(time.Hour)); err != nil {
+		t.Fatalf("second Complete() error = %v", err)
+	}
+
+	r, err := load(ctx, store, Key("f1"))
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if r.State != StateCompleted || r.CompletedAt == nil || !r.CompletedAt.Equal(first) {
+		t.Errorf("record = %+v, want completed at %v", r, first)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	if err := Issue(ctx, store, Record{FailureID: "f1", S3Prefix: prefix("f1"), IssuedAt: now}); err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	get := func() *Record {
+		r, err := Get(ctx, store, "f1")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		return r
+	}
+
+	r := get()
+	if stored, err := Claim(ctx, store, r, "k1", "h1", now); err != nil || stored != nil {
+		t.Fatalf("first Claim() = %s, %v", stored, err)
+	}
+	// A concurrent duplicate waits, a released claim can be taken at once
+	if _, err := Claim(ctx, store, get(), "k1", "h1", now.Add(time.Second)); !errors.Is(err, ErrInProgress) {
+		t.Errorf("concurrent Claim() error = %v, want ErrInProgress", err)
+	}
+	if err := Release(ctx, store, r); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	r = get()
+	if _, err := Claim(ctx, store, r, "k1", "h1", now.Add(time.Second)); err != nil {
+		t.Fatalf("Claim() after Release() error = %v", err)
+	}
+	if err := Finish(ctx, store, r, []byte(`{"status":"ok"}`), now.Add(2*time.Second)); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	r = get()
+	if r.State != StateCompleted || r.CompletedAt == nil {
+		t.Errorf("record = %+v, want completed", r)
+	}
+	later := now.Add(time.Hour)
+	if stored, err := Claim(ctx, store, r, "k1", "h1", later); err != nil || string(stored) != `{"status":"ok"}` {
+		t.Errorf("retry Claim() = %s, %v; want the stored response", stored, err)
+	}
+	if _, err := Claim(ctx, store, r, "k1", "h2", later); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("Claim() with another request error = %v, want ErrKeyReused", err)
+	}
+	if _, err := Claim(ctx, store, r, "k2", "h1", later); !errors.Is(err, ErrAlreadyCompleted) {
+		t.Errorf("Claim() with another key error = %v, want ErrAlreadyCompleted", err)
+	}
+
+	// A claim that never finished is taken over after the lease
+	if err := Issue(ctx, store, Record{FailureID: "f2", S3Prefix: prefix("f2"), IssuedAt: now}); err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	r2, _ := Get(ctx, store, "f2")
+	Claim(ctx, store, r2, "k1", "h1", now)
+	r2, _ = Get(ctx, store, "f2")
+	if _, err := Claim(ctx, store, r2, "k2", "h2", now.Add(CompletionLease)); err != nil {
+		t.Errorf("Claim() after lease error = %v", err)
+	}
+}
+
+func TestReap(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	now := time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC)
+	maxAge := 24 * time.Hour
+
+	issue := func(id string, issuedAt time.Time, files ...string) {
+		if err := Issue(ctx, store, Record{FailureID: id, Project: "myapp", Env: "prod", S3Prefix: prefix(id), IssuedAt: issuedAt}); err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		for _, f := range files {
+			store.Touch(prefix(id) + f)
+		}
+	}
+
+	issue("abandoned", now.Add(-25*time.Hour), "request.raw", "files/a.png")
+	issue("completed", now.Add(-30*time.Hour), "request.raw", "envelope.json")
+	issue("recent", now.Add(-time.Hour), "request.raw")
+	if err := Complete(ctx, store, "completed", now.Add(-29*time.Hour)); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	res, err := Reap(ctx, store, maxAge, now)
+	if err != nil {
+		t.Fatalf("Reap() error = %v", err)
+	}
+	if res.Expired != 1 || res.Completed != 1 || res.DeletedObjects != 2 {
+		t.Errorf("result = %+v, want 1 expired, 1 completed, 2 objects deleted", res)
+	}
+	if rate := res.AbandonmentRate(); rate != 0.5 {
+		t.Errorf("AbandonmentRate() = %v, want 0.5", rate)
+	}
+
+	if keys, _ := store.ListKeys(ctx, prefix("abandoned")); len(keys) != 0 {
+		t.Errorf("abandoned uploads left behind: %v", keys)
+	}
+	if keys, _ := store.ListKeys(ctx, prefix("completed")); len(keys) != 2 {
+		t.Errorf("completed uploads = %v, want untouched", keys)
+	}
+	if keys, _ := store.ListKeys(ctx, prefix("recent")); len(keys) != 1 {
+		t.Errorf("recent uploads = %v, want untouched", keys)
+	}
+	if ok, _ := store.ObjectExists(ctx, Key("completed")); ok {
+		t.Error("completed ticket record not deleted")
+	}
+	r, err := load(ctx, store, Key("abandoned"))
+	if err != nil || r.State != StateExpired {
+		t.Fatalf("abandoned record = %+v, %v, want expired", r, err)
+	}
+
+	// The expired record is kept for maxAge, then deleted without being counted again
+	if res, _ := Reap(ctx, store, maxAge, now.Add(time.Hour)); res.Expired != 0 || res.Completed != 0 {
+		t.Errorf("second run result = %+v, want nothing settled", res)
+	}
+	if ok, _ := store.ObjectExists(ctx, Key("abandoned")); !ok {
+		t.Error("expired record deleted before maxAge")
+	}
+	Reap(ctx, store, maxAge, now.Add(maxAge))
+	if ok, _ := store.ObjectExists(ctx, Key("abandoned")); ok {
+		t.Error("expired record not deleted after maxAge")
+	}
+}
+
+func TestReap_RefusesForeignPrefix(t *testing.T) {
+	ctx := context.Background()
+	store := testsupport.NewStore()
+	now := time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC)
+
+	store.Touch("failures/myapp/prod/2024-03-15/other/request.raw")
+	for _, p := range []string{"", "failures/", "failures/myapp/prod/2024-03-15/other/"} {
+		if err := Issue(ctx, store, Record{FailureID: "f1", S3Prefix: p, IssuedAt: now.Add(-48 * time.Hour)}); err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		if _, err := Reap(ctx, store, 24*time.Hour, now); err == nil {
+			t.Errorf("Reap() with prefix %q error = nil", p)
+		}
+	}
+	if ok, _ := store.ObjectExists(ctx, "failures/myapp/prod/2024-03-15/other/request.raw"); !ok {
+		t.Error("object outside the ticket's prefix was deleted")
+	}
+}
+
+func TestHashUserID(t *testing.T) {
+	plain := HashUserID("", "user-42")
+	keyed := HashUserID("secret", "user-42")
+
+	if !strings.HasPrefix(plain, "sha256:") || len(plain) != len("sha256:")+64 {
+		t.Errorf("HashUserID() = %q", plain)
+	}
+	if plain == keyed {
+		t.Error("key does not change the hash")
+	}
+	if HashUserID("secret", keyed) != keyed {
+		t.Error("hashing a hash changed it")
+	}
+	if HashUserID("secret", "") != "" {
+		t.Error("empty user ID hashed")
+	}
+	if got := UserKey(keyed, "f1"); got != "users/"+strings.TrimPrefix(keyed, "sha256:")+"/f1.json" {
+		t.Errorf("UserKey() = %q", got)
+	}
+}
@@ -0,0 +1,195 @@
+"use strict";
+
+// The dashboard is served at {base}/ui/, so the API is one level up. Relative
+// URLs keep it working behind a path prefix such as an API Gateway stage.
+const API = "../v1/";
+
+const $ = (id) => document.getElementById(id);
+
+// Credentials and the last query live in sessionStorage: they survive a reload
+// but not the tab
+const saved = ["auth-type", "credential", "project", "env", "days"];
+
+function restore() {
+  for (const id of saved) {
+    const v = sessionStorage.getItem(id);
+    if (v !== null) $(id).value = v;
+  }
+}
+
+function remember() {
+  for (const id of saved) sessionStorage.setItem(id, $(id).value);
+}
+
+function status(text, isError) {
+  $("status").textContent = text;
+  $("status").className = isError ? "error" : "";
+}
+
+function headers() {
+  const value = $("credential").value.trim();
+  if (!value) return {};
+  return $("auth-type").value === "bearer" ? { Authorization: "Bearer " + value } : { "X-Api-Key": value };
+}
+
+async function api(path, params) {
+  const url = API + path + "?" + new URLSearchParams(params);
+  const resp = await fetch(url, { headers: headers() });
+  if (!resp.ok) {
+    let msg = resp.status + " " + resp.statusText;
+    try {
+      const problem = await resp.json();
+      msg = problem.detail || problem.title || msg;
+    } catch (e) {
+      // not a problem document
+    }
+    throw new Error(msg);
+  }
+  return resp;
+}
+
+function outcome(f) {
+  if (f.statusCode) return "HTTP " + f.statusCode;
+  return f.errorClass || "no response";
+}
+
+// artifacts lists the artifact slots a failure has
+function artifacts(a) {
+  if (!a) return "";
+  return ["logs", "screenshot", "console"].filter((slot) => a[slot]).join(", ");
+}
+
+function cell(row, text, className) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (className) td.className = className;
+  row.appendChild(td);
+}
+
+async function loadFailures(event) {
+  event.preventDefault();
+  remember();
+  status("Loading…");
+  $("detail").hidden = true;
+
+  const tbody = $("failures");
+  tbody.replaceChildren();
+  try {
+    const resp = await api("failures", {
+      project: $("project").value.trim(),
+      env: $("env").value.trim(),
+      days: $("days").value,
+      limit: 200,
+    });
+    const { failures } = await resp.json();
+    for (const f of failures) {
+      const row = document.createElement("tr");
+      cell(row, new Date(f.createdAt).toLocaleString());
+      cell(row, f.method + " " + f.url, "request");
+      cell(row, outcome(f));
+      cell(row, f.severity || "", f.severity ? "severity-" + f.severity : "");
+      cell(row, [f.appVersion, f.platform].filter(Boolean).join(" "));
+      row.addEventListener("click", () => {
+        for (const r of tbody.children) r.classList.remove("selected");
+        row.classList.add("selected");
+        showFailure(f);
+      });
+      tbody.appendChild(row);
+    }
+    $("empty").hidden = failures.length > 0;
+    status(failures.length + " failure(s)");
+  } catch (e) {
+    status(e.message, true);
+  }
+}
+
+function fact(dl, name, value) {
+  if (value === undefined || value === null || value === "") return;
+  const dt = document.createElement("dt");
+  dt.textContent = name;
+  const dd = document.createElement("dd");
+  dd.textContent = value;
+  dl.append(dt, dd);
+}
+
+// Only presigned http(s) URLs become links
+function safeURL(url) {
+  try {
+    const u = new URL(url);
+    return u.protocol === "https:" || u.protocol === "http:" ? u.href : null;
+  } catch (e) {
+    return null;
+  }
+}
+
+async function showFailure(f) {
+  const params = { project: f.project, env: f.env, prefix: f.s3Prefix };
+  $("detail").hidden = false;
+  $("detail-title").textContent = f.method + " " + f.url;
+  $("curl").textContent = "";
+  $("envelope").textContent = "Loading…";
+  $("downloads").replaceChildren();
+  $("downloads-note").textContent = "";
+
+  const facts = $("detail-facts");
+  facts.replaceChildren();
+  fact(facts, "Failure", f.failureId);
+  fact(facts, "Created", new Date(f.createdAt).toLocaleString());
+  fact(facts, "Outcome", outcome(f));
+  fact(facts, "Severity", f.severity);
+  fact(facts, "Artifacts", artifacts(f.artifacts));
+  fact(facts, "Group", f.groupId);
+  fact(facts, "App", [f.appVersion, f.platform].filter(Boolean).join(" "));
+  fact(facts, "Trace", [f.traceId, f.spanId].filter(Boolean).join(" "));
+  fact(facts, "Request ID", f.requestId);
+  fact(facts, "Prefix", f.s3Prefix);
+
+  $("har").hidden = f.encrypted;
+  $("har").onclick = () => downloadHAR(f, params);
+
+  try {
+    const [detail, downloads] = await Promise.all([
+      api("failures/" + encodeURIComponent(f.failureId), params).then((r) => r.json()),
+      api("failures/" + encodeURIComponent(f.failureId) + "/downloads", params).then((r) => r.json()),
+    ]);
+    $("envelope").textContent = JSON.stringify(detail.envelope, null, 2);
+    $("curl").textContent = detail.curl || "Not available for encrypted failures.";
+
+    $("downloads-note").textContent =
+      "Links expire after " + Math.round(downloads.expiresInSeconds / 60) + " minutes." +
+      (downloads.encryption ? " Artifacts are encrypted client-side (key " + downloads.encryption.keyId + ")." : "");
+    for (const a of downloads.artifacts) {
+      const li = document.createElement("li");
+      const href = safeURL(a.url);
+      const link = document.createElement(href ? "a" : "span");
+      link.textContent = a.name;
+      if (href) {
+        link.href = href;
+        link.rel = "noopener noreferrer";
+      }
+      li.append(link, " (" + a.bytes.toLocaleString() + " bytes)");
+      $("downloads").appendChild(li);
+    }
+  } catch (e) {
+    $("envelope").textContent = "";
+    status(e.message, true);
+  }
+}
+
+// The HAR export needs credentials, so it is fetched and saved from a blob
+async function downloadHAR(f, params) {
+  try {
+    const resp = await api("failures/" + encodeURIComponent(f.failureId) + "/har", params);
+    const url = URL.createObjectURL(await resp.blob());
+    const a = document.createElement("a");
+    a.href = url;
+    a.download = f.failureId + ".har";
+    a.click();
+    URL.revokeObjectURL(url);
+  } catch (e) {
+    status(e.message, true);
+  }
+}
+
+restore();
+$("query").addEventListener("submit", loadFailures);
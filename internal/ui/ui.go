@@ -0,0 +1,41 @@
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// contentSecurityPolicy confines the dashboard to its own assets and the API;
+// artifact downloads are plain links to presigned S3 URLs
+const contentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard, a single page that lists recent failures,
+// shows envelopes and generates download links through the read API. Mount it
+// at /ui/ with the prefix stripped. The page itself needs no credentials;
+// callers enter an API key or bearer token, which stays in the browser tab.
+func Handler() http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServer(http.FS(sub))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// Redirect sends /ui to /ui/ with a relative Location, so the redirect also
+// works behind a path prefix such as an API Gateway stage
+func Redirect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", "ui/")
+	w.WriteHeader(http.StatusMovedPermanently)
+}
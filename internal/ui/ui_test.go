@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := http.StripPrefix("/ui/", Handler())
+
+	tests := []struct {
+		path, contentType, contains string
+	}{
+		{"/ui/", "text/html", `<script src="app.js"`},
+		{"/ui/app.js", "javascript", `const API = "../v1/"`},
+		{"/ui/app.css", "text/css", "body"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d", tt.path, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+			t.Errorf("GET %s Content-Type = %q", tt.path, ct)
+		}
+		if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") {
+			t.Errorf("GET %s Content-Security-Policy = %q", tt.path, csp)
+		}
+		if !strings.Contains(rec.Body.String(), tt.contains) {
+			t.Errorf("GET %s body lacks %q", tt.path, tt.contains)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/missing.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing asset status = %d, want 404", rec.Code)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Redirect(rec, httptest.NewRequest(http.MethodGet, "/ui", nil))
+
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "ui/" {
+		t.Errorf("redirect = %d %q, want 301 ui/", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,122 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// batchSize is the most keys BatchGetItem accepts per call
+const batchSize = 100
+
+// maxUnprocessedRetries bounds re-reads of keys DynamoDB throttled in a batch
+const maxUnprocessedRetries = 3
+
+// DynamoStore keeps usage in DynamoDB with one atomic counter item per principal
+// and hour, so it is shared across Lambda instances. The table needs a string
+// partition key "pk"; enable TTL on the "expiresAt" attribute to drop old hours.
+type DynamoStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoStore creates a DynamoDB-backed usage store
+func NewDynamoStore(ctx context.Context, region, table string) (*DynamoStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return &DynamoStore{client: dynamodb.NewFromConfig(cfg), table: table}, nil
+}
+
+func itemKey(principal string, hour time.Time) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "usage#" + principal + "#" + strconv.FormatInt(hour.Unix(), 10)},
+	}
+}
+
+func number(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+// Record atomically adds c to principal's item for the hour of at
+func (s *DynamoStore) Record(ctx context.Context, principal string, at time.Time, c Counts) error {
+	hour := Hour(at)
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              itemKey(principal, hour),
+		UpdateExpression: aws.String("ADD requests :r, clientErrors :ce, serverErrors :se, bytesIn :bi, bytesOut :bo SET hourStart = :h, expiresAt = :exp"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":r":   number(c.Requests),
+			":ce":  number(c.ClientErrors),
+			":se":  number(c.ServerErrors),
+			":bi":  number(c.BytesIn),
+			":bo":  number(c.BytesOut),
+			":h":   number(hour.Unix()),
+			":exp": number(hour.Add(Retention).Unix()),
+		},
+	})
+	return err
+}
+
+// Hourly reads principal's items for every hour in [from, to)
+func (s *DynamoStore) Hourly(ctx context.Context, principal string, from, to time.Time) ([]Bucket, error) {
+	var keys []map[string]types.AttributeValue
+	for h := Hour(from); h.Before(to); h = h.Add(time.Hour) {
+		keys = append(keys, itemKey(principal, h))
+	}
+
+	var out []Bucket
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		pending := keys[start:end]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > maxUnprocessedRetries {
+				return nil, fmt.Errorf("read usage: %d hours still unprocessed", len(pending))
+			}
+			res, err := s.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]types.KeysAndAttributes{
+					s.table: {Keys: pending, ConsistentRead: aws.Bool(true)},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range res.Responses[s.table] {
+				out = append(out, Bucket{
+					Hour: time.Unix(intAttr(item, "hourStart"), 0).UTC(),
+					Counts: Counts{
+						Requests:     intAttr(item, "requests"),
+						ClientErrors: intAttr(item, "clientErrors"),
+						ServerErrors: intAttr(item, "serverErrors"),
+						BytesIn:      intAttr(item, "bytesIn"),
+						BytesOut:     intAttr(item, "bytesOut"),
+					},
+				})
+			}
+			pending = res.UnprocessedKeys[s.table].Keys
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Hour.Before(out[j].Hour) })
+	return out, nil
+}
+
+func intAttr(item map[string]types.AttributeValue, name string) int64 {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
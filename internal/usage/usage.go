@@ -0,0 +1,160 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Retention is how long hourly usage is kept and the widest window that can be queried
+const Retention = 31 * 24 * time.Hour
+
+// Counts is the traffic of one principal over a period
+type Counts struct {
+	Requests     int64 `json:"requests"`
+	ClientErrors int64 `json:"clientErrors"`
+	ServerErrors int64 `json:"serverErrors"`
+	BytesIn      int64 `json:"bytesIn"`
+	BytesOut     int64 `json:"bytesOut"`
+}
+
+// Add accumulates o into c
+func (c *Counts) Add(o Counts) {
+	c.Requests += o.Requests
+	c.ClientErrors += o.ClientErrors
+	c.ServerErrors += o.ServerErrors
+	c.BytesIn += o.BytesIn
+	c.BytesOut += o.BytesOut
+}
+
+// ErrorRate is the share of requests that ended in a 4xx or 5xx response
+func (c Counts) ErrorRate() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.ClientErrors+c.ServerErrors) / float64(c.Requests)
+}
+
+// Request returns the counts for a single request with the given outcome
+func Request(status int, bytesIn, bytesOut int64) Counts {
+	c := Counts{Requests: 1, BytesIn: bytesIn, BytesOut: bytesOut}
+	switch {
+	case status >= 500:
+		c.ServerErrors = 1
+	case status >= 400:
+		c.ClientErrors = 1
+	}
+	return c
+}
+
+// Bucket is a principal's traffic in one hour
+type Bucket struct {
+	Hour time.Time `json:"hour"`
+	Counts
+}
+
+// Store aggregates usage per principal in hourly buckets
+type Store interface {
+	Record(ctx context.Context, principal string, at time.Time, c Counts) error
+	// Hourly returns the non-empty buckets for principal in [from, to), oldest first
+	Hourly(ctx context.Context, principal string, from, to time.Time) ([]Bucket, error)
+}
+
+// Hour truncates t to the start of its UTC hour
+func Hour(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// Total sums buckets
+func Total(buckets []Bucket) Counts {
+	var c Counts
+	for _, b := range buckets {
+		c.Add(b.Counts)
+	}
+	return c
+}
+
+// MemoryStore keeps usage in process, suitable for a single server
+type MemoryStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]map[time.Time]Counts
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty in-process usage store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, buckets: make(map[string]map[time.Time]Counts)}
+}
+
+// Record adds c to principal's bucket for the hour of at
+func (s *MemoryStore) Record(_ context.Context, principal string, at time.Time, c Counts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(s.now())
+
+	hours, ok := s.buckets[principal]
+	if !ok {
+		hours = make(map[time.Time]Counts)
+		s.buckets[principal] = hours
+	}
+	h := Hour(at)
+	cur := hours[h]
+	cur.Add(c)
+	hours[h] = cur
+	return nil
+}
+
+// Hourly returns principal's buckets in [from, to)
+func (s *MemoryStore) Hourly(_ context.Context, principal string, from, to time.Time) ([]Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Bucket
+	for h, c := range s.buckets[principal] {
+		if !h.Before(Hour(from)) && h.Before(to) {
+			out = append(out, Bucket{Hour: h, Counts: c})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hour.Before(out[j].Hour) })
+	return out, nil
+}
+
+// sweep drops buckets older than the retention period
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Hour {
+		return
+	}
+	s.lastSweep = now
+
+	cutoff := now.Add(-Retention)
+	for p, hours := range s.buckets {
+		for h := range hours {
+			if h.Before(cutoff) {
+				delete(hours, h)
+			}
+		}
+		if len(hours) == 0 {
+			delete(s.buckets, p)
+		}
+	}
+}
+
+// New builds a store for the configured backend ("memory" or "dynamodb")
+func New(ctx context.Context, backend, region, table string) (Store, error) {
+	switch backend {
+	case "dynamodb":
+		if table == "" {
+			return nil, fmt.Errorf("usage backend dynamodb requires a table name")
+		}
+		return NewDynamoStore(ctx, region, table)
+	case "memory", "":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown usage backend %q", backend)
+	}
+}
@@ -0,0 +1,79 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequest(t *testing.T) {
+	tests := []struct {
+		status       int
+		client, serv int64
+	}{
+		{200, 0, 0},
+		{302, 0, 0},
+		{404, 1, 0},
+		{429, 1, 0},
+		{503, 0, 1},
+	}
+	for _, tt := range tests {
+		c := Request(tt.status, 10, 20)
+		if c.Requests != 1 || c.ClientErrors != tt.client || c.ServerErrors != tt.serv || c.BytesIn != 10 || c.BytesOut != 20 {
+			t.Errorf("Request(%d) = %+v", tt.status, c)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	base := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	s.Record(ctx, "ios", base.Add(5*time.Minute), Request(200, 100, 50))
+	s.Record(ctx, "ios", base.Add(50*time.Minute), Request(500, 10, 5))
+	s.Record(ctx, "ios", base.Add(2*time.Hour), Request(400, 1, 1))
+	s.Record(ctx, "android", base, Request(200, 1, 1))
+
+	buckets, err := s.Hourly(ctx, "ios", base.Add(30*time.Minute), base.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Hourly() error = %v", err)
+	}
+	if len(buckets) != 1 || !buckets[0].Hour.Equal(base) {
+		t.Fatalf("buckets = %+v, want the 10:00 hour only", buckets)
+	}
+	if c := buckets[0].Counts; c.Requests != 2 || c.ServerErrors != 1 || c.BytesIn != 110 || c.BytesOut != 55 {
+		t.Errorf("counts = %+v", c)
+	}
+
+	all, _ := s.Hourly(ctx, "ios", base, base.Add(3*time.Hour))
+	total := Total(all)
+	if total.Requests != 3 || total.ErrorRate() != 2.0/3.0 {
+		t.Errorf("total = %+v, error rate %v", total, total.ErrorRate())
+	}
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s.now = func() time.Time { return old }
+	s.Record(ctx, "ios", old, Request(200, 0, 0))
+
+	s.now = func() time.Time { return old.Add(Retention + 2*time.Hour) }
+	s.Record(ctx, "android", s.now(), Request(200, 0, 0))
+
+	if _, ok := s.buckets["ios"]; ok {
+		t.Error("expired usage was not swept")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(context.Background(), "dynamodb", "us-east-1", ""); err == nil {
+		t.Error("dynamodb without table should fail")
+	}
+	if _, err := New(context.Background(), "redis", "us-east-1", ""); err == nil {
+		t.Error("unknown backend should fail")
+	}
+}
@@ -1,39 +1,133 @@
 package validation
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
+	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/yourorg/failure-uploader/internal/apikeys"
 	"github.com/yourorg/failure-uploader/internal/config"
+	"github.com/yourorg/failure-uploader/internal/keys"
 	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/priority"
+	"github.com/yourorg/failure-uploader/internal/profiles"
+	"github.com/yourorg/failure-uploader/internal/repro"
 )
 
 var (
 	projectRegex  = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
 	envRegex      = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+	tenantRegex   = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
 	platformRegex = regexp.MustCompile(`^(ios|android|web|desktop)$`)
 	methodRegex   = regexp.MustCompile(`^(GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS)$`)
+	fileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,255}$`)
+	keyIDRegex    = regexp.MustCompile(`^[a-zA-Z0-9._:/+=@-]{1,256}$`)
+	sha256Regex   = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
 )
 
+// idempotencyKeyRegex accepts printable ASCII without spaces, e.g. a UUID
+var idempotencyKeyRegex = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// Trace correlation IDs: 128-bit W3C or 64-bit (Jaeger, B3) trace IDs, 64-bit
+// span IDs, and request IDs of printable ASCII without spaces
+var (
+	traceIDRegex   = regexp.MustCompile(`^([0-9a-fA-F]{16}|[0-9a-fA-F]{32})$`)
+	spanIDRegex    = regexp.MustCompile(`^[0-9a-fA-F]{16}$`)
+	requestIDRegex = regexp.MustCompile(`^[\x21-\x7e]{1,128}$`)
+)
+
+// encryptionAlgorithms are the client-side ciphers a failure can declare
+var encryptionAlgorithms = map[string]bool{
+	"AES-256-GCM":        true,
+	"ChaCha20-Poly1305":  true,
+	"XChaCha20-Poly1305": true,
+}
+
 // ValidationError represents a validation error
 type ValidationError struct {
 	Field   string
 	Message string
+	// Code is set when clients can act on the failure, e.g. CodeTooManyFiles
+	Code string
 }
 
+// Field error codes for rules configured per deployment or project
+const (
+	CodeTooManyFiles          = "too_many_files"
+	CodeContentTypeDenied     = "content_type_denied"
+	CodeContentTypeNotAllowed = "content_type_not_allowed"
+)
+
 func (e ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Field, e.Message)
 }
 
-// ValidateUploadTicketRequest validates the upload ticket request
-func ValidateUploadTicketRequest(req *models.UploadTicketRequest, cfg *config.Config) []ValidationError {
+// Limits returns the effective profile for project: its entry in profs layered
+// over the global limits from cfg. profs may be nil.
+func Limits(cfg *config.Config, profs *profiles.Profiles, project string) profiles.Profile {
+	return profs.For(project, profiles.Profile{
+		MaxBodyBytes:  cfg.MaxBodyBytes,
+		MaxFileBytes:  cfg.MaxFileBytes,
+		MaxTotalBytes: cfg.MaxTotalBytes,
+		MaxFiles:      cfg.MaxFiles,
+
+		MaxLogsBytes:       cfg.MaxLogsBytes,
+		MaxScreenshotBytes: cfg.MaxScreenshotBytes,
+		MaxConsoleBytes:    cfg.MaxConsoleBytes,
+
+		DailyFailures: cfg.QuotaDailyFailures,
+		DailyBytes:    cfg.QuotaDailyBytes,
+
+		StorageBudgetBytes: cfg.StorageBudgetBytes,
+
+		ContentTypes:       profiles.SplitList(cfg.AllowedContentTypes),
+		DeniedContentTypes: profiles.SplitList(cfg.DeniedContentTypes),
+	})
+}
+
+// validateContentType checks contentType against the profile's denylist and
+// then its allowlist. An empty content type is not checked.
+func validateContentType(field, contentType string, limits profiles.Profile) []ValidationError {
+	switch {
+	case contentType == "":
+		return nil
+	case limits.DeniesContentType(contentType):
+		return []ValidationError{{Field: field, Message: "content type is denied", Code: CodeContentTypeDenied}}
+	case !limits.AllowsContentType(contentType):
+		return []ValidationError{{Field: field, Message: "not allowed for this project", Code: CodeContentTypeNotAllowed}}
+	}
+	return nil
+}
+
+// validateSHA256 checks an optional hex SHA-256 digest
+func validateSHA256(field, digest string) []ValidationError {
+	if digest != "" && !sha256Regex.MatchString(digest) {
+		return []ValidationError{{Field: field, Message: "must be a hex SHA-256 digest (64 characters)"}}
+	}
+	return nil
+}
+
+// ValidateUploadTicketRequest validates the upload ticket request against the
+// project's profile in profs, or the global limits when profs is nil
+func ValidateUploadTicketRequest(req *models.UploadTicketRequest, cfg *config.Config, profs *profiles.Profiles) []ValidationError {
 	var errors []ValidationError
+	limits := Limits(cfg, profs, req.Project)
+
+	if req.SchemaVersion < 0 {
+		errors = append(errors, ValidationError{Field: "schemaVersion", Message: "must not be negative"})
+	}
 
 	// Project validation
 	if req.Project == "" {
 		errors = append(errors, ValidationError{Field: "project", Message: "required"})
-	} else if !projectRegex.MatchString(req.Project) {
+	} else if !validProject(req.Project) {
 		errors = append(errors, ValidationError{Field: "project", Message: "invalid format (alphanumeric, underscore, hyphen, max 64 chars)"})
 	}
 
@@ -60,11 +154,18 @@ func ValidateUploadTicketRequest(req *models.UploadTicketRequest, cfg *config.Co
 	// Size validation
 	if req.Request.BodyBytes < 0 {
 		errors = append(errors, ValidationError{Field: "request.bodyBytes", Message: "cannot be negative"})
-	} else if req.Request.BodyBytes > cfg.MaxBodyBytes {
-		errors = append(errors, ValidationError{Field: "request.bodyBytes", Message: fmt.Sprintf("exceeds maximum allowed size (%d bytes)", cfg.MaxBodyBytes)})
+	} else if req.Request.BodyBytes > limits.MaxBodyBytes {
+		errors = append(errors, ValidationError{Field: "request.bodyBytes", Message: fmt.Sprintf("exceeds maximum allowed size (%d bytes)", limits.MaxBodyBytes)})
 	}
 
+	errors = append(errors, validateContentType("request.contentType", req.Request.ContentType, limits)...)
+	errors = append(errors, validateSHA256("request.sha256", req.Request.SHA256)...)
+	errors = append(errors, ValidateTrace(req.Request)...)
+
 	// Files validation
+	if limits.MaxFiles > 0 && len(req.Request.Files) > limits.MaxFiles {
+		errors = append(errors, ValidationError{Field: "request.files", Message: fmt.Sprintf("too many files (maximum %d)", limits.MaxFiles), Code: CodeTooManyFiles})
+	}
 	var totalFileBytes int64
 	for i, file := range req.Request.Files {
 		if file.Filename == "" {
@@ -72,37 +173,196 @@ func ValidateUploadTicketRequest(req *models.UploadTicketRequest, cfg *config.Co
 		}
 		if file.Bytes < 0 {
 			errors = append(errors, ValidationError{Field: fmt.Sprintf("request.files[%d].bytes", i), Message: "cannot be negative"})
-		} else if file.Bytes > cfg.MaxFileBytes {
-			errors = append(errors, ValidationError{Field: fmt.Sprintf("request.files[%d].bytes", i), Message: fmt.Sprintf("exceeds maximum allowed size (%d bytes)", cfg.MaxFileBytes)})
+		} else if file.Bytes > limits.MaxFileBytes {
+			errors = append(errors, ValidationError{Field: fmt.Sprintf("request.files[%d].bytes", i), Message: fmt.Sprintf("exceeds maximum allowed size (%d bytes)", limits.MaxFileBytes)})
 		}
+		errors = append(errors, validateContentType(fmt.Sprintf("request.files[%d].contentType", i), file.ContentType, limits)...)
+		errors = append(errors, validateSHA256(fmt.Sprintf("request.files[%d].sha256", i), file.SHA256)...)
 		totalFileBytes += file.Bytes
 	}
 
 	// Total size validation
 	totalBytes := req.Request.BodyBytes + totalFileBytes
-	if totalBytes > cfg.MaxTotalBytes {
-		errors = append(errors, ValidationError{Field: "totalBytes", Message: fmt.Sprintf("total upload size exceeds maximum (%d bytes)", cfg.MaxTotalBytes)})
+	if totalBytes > limits.MaxTotalBytes {
+		errors = append(errors, ValidationError{Field: "totalBytes", Message: fmt.Sprintf("total upload size exceeds maximum (%d bytes)", limits.MaxTotalBytes)})
+	}
+
+	// Artifact slots have their own limits and do not count towards the total
+	if req.Artifacts != nil {
+		errors = append(errors, validateArtifacts(req.Artifacts, limits)...)
 	}
 
 	// Client validation
 	if req.Client.Platform != "" && !platformRegex.MatchString(strings.ToLower(req.Client.Platform)) {
 		errors = append(errors, ValidationError{Field: "client.platform", Message: "must be one of: ios, android, web, desktop"})
+	} else if req.Client.Platform != "" && !limits.AllowsPlatform(req.Client.Platform) {
+		errors = append(errors, ValidationError{Field: "client.platform", Message: "must be one of: " + strings.Join(limits.Platforms, ", ")})
+	}
+	if len(req.Client.UserID) > maxUserIDLength {
+		errors = append(errors, ValidationError{Field: "client.userId", Message: fmt.Sprintf("too long (maximum %d characters)", maxUserIDLength)})
+	}
+
+	if req.Response != nil {
+		errors = append(errors, ValidateResponseInfo(req.Response)...)
+	}
+
+	if !priority.Valid(req.Priority) {
+		errors = append(errors, ValidationError{Field: "priority", Message: "must be one of: normal, critical"})
+	}
+	if !priority.ValidSeverity(req.Severity) {
+		errors = append(errors, ValidationError{Field: "severity", Message: "must be one of: info, warning, error, critical"})
+	}
+	errors = append(errors, ValidateTriage(req.Tags, req.Description)...)
+
+	return errors
+}
+
+// ValidateTrace checks the optional trace correlation IDs of a request. Trace
+// and span IDs must be hex and not all zeros, which W3C Trace Context reserves
+// for invalid IDs.
+func ValidateTrace(info models.RequestInfo) []ValidationError {
+	var errors []ValidationError
+	if info.TraceID != "" && (!traceIDRegex.MatchString(info.TraceID) || strings.Trim(info.TraceID, "0") == "") {
+		errors = append(errors, ValidationError{Field: "request.traceId", Message: "must be a non-zero hex trace ID (16 or 32 characters)"})
+	}
+	if info.SpanID != "" && (!spanIDRegex.MatchString(info.SpanID) || strings.Trim(info.SpanID, "0") == "") {
+		errors = append(errors, ValidationError{Field: "request.spanId", Message: "must be a non-zero hex span ID (16 characters)"})
+	}
+	if info.RequestID != "" && !requestIDRegex.MatchString(info.RequestID) {
+		errors = append(errors, ValidationError{Field: "request.requestId", Message: "must be 1-128 printable ASCII characters without spaces"})
+	}
+	return errors
+}
+
+// validateArtifacts checks the declared artifact slots against their limits
+func validateArtifacts(a *models.ArtifactsInfo, limits profiles.Profile) []ValidationError {
+	var errors []ValidationError
+	slots := []struct {
+		field string
+		info  *models.ArtifactInfo
+		limit int64
+	}{
+		{"artifacts.logs", a.Logs, limits.MaxLogsBytes},
+		{"artifacts.screenshot", a.Screenshot, limits.MaxScreenshotBytes},
+		{"artifacts.console", a.Console, limits.MaxConsoleBytes},
+	}
+	for _, slot := range slots {
+		if slot.info == nil {
+			continue
+		}
+		if slot.info.Bytes < 0 {
+			errors = append(errors, ValidationError{Field: slot.field + ".bytes", Message: "cannot be negative"})
+		} else if slot.info.Bytes > slot.limit {
+			errors = append(errors, ValidationError{Field: slot.field + ".bytes", Message: fmt.Sprintf("exceeds maximum allowed size (%d bytes)", slot.limit)})
+		}
+		errors = append(errors, validateSHA256(slot.field+".sha256", slot.info.SHA256)...)
+	}
+	return errors
+}
+
+// ArtifactLimit returns the size limit of the artifact stored as name under a
+// failure's prefix: the slot's own limit for logs.txt, screenshot.png and
+// console.json, the per-file limit for attached files and the body limit for
+// everything else
+func ArtifactLimit(name string, limits profiles.Profile) int64 {
+	switch {
+	case name == keys.LogsName:
+		return limits.MaxLogsBytes
+	case name == keys.ScreenshotName:
+		return limits.MaxScreenshotBytes
+	case name == keys.ConsoleName:
+		return limits.MaxConsoleBytes
+	case strings.HasPrefix(name, "files/"):
+		return limits.MaxFileBytes
+	}
+	return limits.MaxBodyBytes
+}
+
+// Tag and description limits
+const (
+	MaxTags              = 20
+	maxTagValueLength    = 256
+	maxDescriptionLength = 4000
+)
+
+// tagKeyRegex accepts keys like team, build.id or feature-flag; colons are
+// reserved for the key:value tag filters of listings
+var tagKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// ValidateTriage validates the optional tags and description of a failure
+func ValidateTriage(tags map[string]string, description string) []ValidationError {
+	var errors []ValidationError
+
+	if len(tags) > MaxTags {
+		errors = append(errors, ValidationError{Field: "tags", Message: fmt.Sprintf("too many tags (maximum %d)", MaxTags)})
+	}
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if !tagKeyRegex.MatchString(k) {
+			errors = append(errors, ValidationError{Field: "tags", Message: fmt.Sprintf("invalid key %q (1-64 letters, digits, '.', '_' or '-')", k)})
+			continue
+		}
+		if v := tags[k]; v == "" || !utf8.ValidString(v) || utf8.RuneCountInString(v) > maxTagValueLength {
+			errors = append(errors, ValidationError{Field: "tags." + k, Message: fmt.Sprintf("must be 1-%d characters", maxTagValueLength)})
+		}
+	}
+
+	if !utf8.ValidString(description) {
+		errors = append(errors, ValidationError{Field: "description", Message: "must be valid UTF-8"})
+	} else if utf8.RuneCountInString(description) > maxDescriptionLength {
+		errors = append(errors, ValidationError{Field: "description", Message: fmt.Sprintf("too long (maximum %d characters)", maxDescriptionLength)})
+	}
+
+	return errors
+}
+
+// Response field limits
+const (
+	maxErrorClassLength   = 128
+	maxErrorMessageLength = 1024
+	// maxDurationMs is one day; longer durations are clock errors
+	maxDurationMs = 24 * 60 * 60 * 1000
+)
+
+// ValidateResponseInfo validates how a failed request ended
+func ValidateResponseInfo(resp *models.ResponseInfo) []ValidationError {
+	var errors []ValidationError
+
+	if resp.StatusCode != 0 && (resp.StatusCode < 100 || resp.StatusCode > 599) {
+		errors = append(errors, ValidationError{Field: "response.statusCode", Message: "must be 0 (no response) or between 100 and 599"})
+	}
+	if resp.DurationMs < 0 || resp.DurationMs > maxDurationMs {
+		errors = append(errors, ValidationError{Field: "response.durationMs", Message: fmt.Sprintf("must be between 0 and %d", maxDurationMs)})
+	}
+	if len(resp.ErrorClass) > maxErrorClassLength {
+		errors = append(errors, ValidationError{Field: "response.errorClass", Message: fmt.Sprintf("too long (maximum %d characters)", maxErrorClassLength)})
+	}
+	if len(resp.ErrorMessage) > maxErrorMessageLength {
+		errors = append(errors, ValidationError{Field: "response.errorMessage", Message: fmt.Sprintf("too long (maximum %d characters)", maxErrorMessageLength)})
 	}
 
 	return errors
 }
 
 // ValidateUploadCompleteRequest validates the upload complete request
-func ValidateUploadCompleteRequest(req *models.UploadCompleteRequest) []ValidationError {
+func ValidateUploadCompleteRequest(req *models.UploadCompleteRequest, cfg *config.Config) []ValidationError {
 	var errors []ValidationError
 
+	if req.SchemaVersion < 0 {
+		errors = append(errors, ValidationError{Field: "schemaVersion", Message: "must not be negative"})
+	}
+
 	if req.FailureID == "" {
 		errors = append(errors, ValidationError{Field: "failureId", Message: "required"})
 	}
 
 	if req.Project == "" {
 		errors = append(errors, ValidationError{Field: "project", Message: "required"})
-	} else if !projectRegex.MatchString(req.Project) {
+	} else if !validProject(req.Project) {
 		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
 	}
 
@@ -114,6 +374,670 @@ func ValidateUploadCompleteRequest(req *models.UploadCompleteRequest) []Validati
 
 	if len(req.UploadedKeys) == 0 {
 		errors = append(errors, ValidationError{Field: "uploadedKeys", Message: "required"})
+	} else if len(errors) == 0 && !keysBelongTo(req.UploadedKeys, req.Project, req.Env, req.FailureID) {
+		// Only checked once the failure itself is valid, so its errors are not repeated
+		errors = append(errors, ValidationError{Field: "uploadedKeys", Message: "must all be objects of this failure"})
+	} else if req.ServerChecksums && !sameDir(req.UploadedKeys) {
+		errors = append(errors, ValidationError{Field: "uploadedKeys", Message: "must share one prefix when serverChecksums is set"})
+	}
+
+	if !priority.Valid(req.Priority) {
+		errors = append(errors, ValidationError{Field: "priority", Message: "must be one of: normal, critical"})
+	}
+
+	if req.Encryption != nil {
+		errors = append(errors, validateEncryption(req.Encryption)...)
+	} else if req.Project != "" && cfg.RequiresEncryption(req.Project) {
+		errors = append(errors, ValidationError{Field: "encryption", Message: "required for this project"})
+	}
+
+	if req.Response != nil {
+		errors = append(errors, ValidateResponseInfo(req.Response)...)
+	}
+
+	return errors
+}
+
+// ValidateIdempotencyKey validates the Idempotency-Key header of upload-complete;
+// an absent header is valid
+func ValidateIdempotencyKey(key string) []ValidationError {
+	if key != "" && !idempotencyKeyRegex.MatchString(key) {
+		return []ValidationError{{Field: "Idempotency-Key", Message: "must be 1-255 printable ASCII characters without spaces"}}
+	}
+	return nil
+}
+
+// minSizeSlack is the least an upload may exceed its declared size by, e.g. for
+// the nonce and tag added by client-side encryption
+const minSizeSlack = 4 << 10
+
+// SizeMismatch is an uploaded object larger than its ticket allows
+type SizeMismatch struct {
+	Key     string
+	Actual  int64
+	Allowed int64
+}
+
+func (m SizeMismatch) String() string {
+	return fmt.Sprintf("%s (%d bytes, %d allowed)", m.Key, m.Actual, m.Allowed)
+}
+
+// CheckUploadSizes compares the sizes of uploaded objects with the request
+// and artifact slots declared in their ticket, whose uploads are under prefix;
+// artifacts may be nil. Each object may be up to its AllowedSize.
+func CheckUploadSizes(declared *models.RequestInfo, artifacts *models.ArtifactsInfo, prefix string, sizes map[string]int64, limits profiles.Profile, tolerancePercent int) []SizeMismatch {
+	var mismatches []SizeMismatch
+	for key, size := range sizes {
+		allowed := AllowedSize(strings.TrimPrefix(key, prefix), declared, artifacts, limits, tolerancePercent)
+		if size > allowed {
+			mismatches = append(mismatches, SizeMismatch{Key: key, Actual: size, Allowed: allowed})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Key < mismatches[j].Key })
+	return mismatches
+}
+
+// AllowedSize returns the largest accepted upload of rel, an object name
+// below a failure prefix. request.raw, attached files and artifact slots may
+// exceed the size declared in their ticket by tolerancePercent, and at least
+// 4 KiB; objects declared without a size are capped at the limits.
+func AllowedSize(rel string, declared *models.RequestInfo, artifacts *models.ArtifactsInfo, limits profiles.Profile, tolerancePercent int) int64 {
+	withSlack := func(n int64) int64 {
+		return n + max(n*int64(tolerancePercent)/100, minSizeSlack)
+	}
+
+	var n int64
+	switch rel {
+	case "request.raw":
+		n = declared.BodyBytes
+	case keys.LogsName, keys.ScreenshotName, keys.ConsoleName:
+		if artifacts != nil {
+			slot := map[string]*models.ArtifactInfo{
+				keys.LogsName:       artifacts.Logs,
+				keys.ScreenshotName: artifacts.Screenshot,
+				keys.ConsoleName:    artifacts.Console,
+			}[rel]
+			if slot != nil {
+				n = slot.Bytes
+			}
+		}
+	default:
+		for _, f := range declared.Files {
+			if rel == "files/"+f.Filename {
+				n = f.Bytes
+			}
+		}
+	}
+	if n > 0 {
+		return withSlack(n)
+	}
+	return ArtifactLimit(rel, limits)
+}
+
+// validateEncryption validates a client-side encryption descriptor
+func validateEncryption(enc *models.Encryption) []ValidationError {
+	var errors []ValidationError
+
+	if enc.Algorithm == "" {
+		errors = append(errors, ValidationError{Field: "encryption.algorithm", Message: "required"})
+	} else if !encryptionAlgorithms[enc.Algorithm] {
+		errors = append(errors, ValidationError{Field: "encryption.algorithm", Message: "must be one of: AES-256-GCM, ChaCha20-Poly1305, XChaCha20-Poly1305"})
+	}
+
+	if enc.KeyID == "" {
+		errors = append(errors, ValidationError{Field: "encryption.keyId", Message: "required"})
+	} else if !keyIDRegex.MatchString(enc.KeyID) {
+		errors = append(errors, ValidationError{Field: "encryption.keyId", Message: "invalid format"})
+	}
+
+	if enc.IV == "" {
+		errors = append(errors, ValidationError{Field: "encryption.iv", Message: "required"})
+	} else if iv, err := base64.StdEncoding.DecodeString(enc.IV); err != nil || len(iv) < 8 || len(iv) > 64 {
+		errors = append(errors, ValidationError{Field: "encryption.iv", Message: "must be 8 to 64 base64-encoded bytes"})
+	}
+
+	return errors
+}
+
+// sameDir reports whether all keys live directly under the same prefix
+func sameDir(keys []string) bool {
+	dir := path.Dir(keys[0])
+	for _, k := range keys[1:] {
+		if path.Dir(k) != dir {
+			return false
+		}
+	}
+	return true
+}
+
+// keysBelongTo reports whether every key is an object of one failure prefix
+// of project/env for failureID, in any key scheme or tenant
+func keysBelongTo(uploaded []string, project, env, failureID string) bool {
+	prefix := ""
+	for _, k := range uploaded {
+		loc, ok := keys.Parse(k)
+		if !ok || strings.Contains(k, "..") || (loc.Tenant != "" && !ValidTenant(loc.Tenant)) ||
+			loc.Project != project || loc.Env != env || loc.FailureID != failureID {
+			return false
+		}
+		if prefix == "" {
+			prefix = loc.Prefix
+		} else if loc.Prefix != prefix {
+			return false
+		}
+	}
+	return true
+}
+
+// failureIDRegex matches the UUIDs the service issues as failure IDs
+var failureIDRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ValidateFailureID validates a failure ID issued by the service
+func ValidateFailureID(failureID string) []ValidationError {
+	if !failureIDRegex.MatchString(failureID) {
+		return []ValidationError{{Field: "failureId", Message: "must be a failure ID issued by the service"}}
+	}
+	return nil
+}
+
+// ValidateRestoreRequest validates a restore request for failureID
+func ValidateRestoreRequest(req *models.RestoreRequest, failureID string) []ValidationError {
+	var errors []ValidationError
+
+	if req.Project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(req.Project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+
+	if req.Env == "" {
+		errors = append(errors, ValidationError{Field: "env", Message: "required"})
+	} else if !envRegex.MatchString(req.Env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+
+	if req.S3Prefix == "" {
+		errors = append(errors, ValidationError{Field: "s3Prefix", Message: "required"})
+	} else if len(errors) == 0 && !prefixBelongsTo(req.S3Prefix, req.Project, req.Env, failureID) {
+		errors = append(errors, ValidationError{Field: "s3Prefix", Message: "must be the prefix of this failure in the given project and env"})
+	}
+
+	return errors
+}
+
+// ValidateDeleteFailure validates the query of a failure erasure. prefix must be
+// exactly the failure's prefix, so nothing outside it can be deleted.
+func ValidateDeleteFailure(project, env, prefix, failureID string) []ValidationError {
+	return validateFailureLocation(project, env, prefix, failureID)
+}
+
+// ValidateGetFailure validates the query of a failure lookup
+func ValidateGetFailure(project, env, prefix, failureID string) []ValidationError {
+	return validateFailureLocation(project, env, prefix, failureID)
+}
+
+// maxReplayHeaders bounds the header overrides of a replay
+const maxReplayHeaders = 50
+
+// headerNameRegex matches an HTTP header field name (an RFC 9110 token)
+var headerNameRegex = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]{1,128}$")
+
+// ValidateReleaseRequest validates a release of failureID's withheld artifacts
+func ValidateReleaseRequest(req *models.ReleaseRequest, failureID string) []ValidationError {
+	return ValidateRestoreRequest(&models.RestoreRequest{Project: req.Project, Env: req.Env, S3Prefix: req.S3Prefix}, failureID)
+}
+
+// ValidateReplayRequest validates a replay of failureID
+func ValidateReplayRequest(req *models.ReplayRequest, failureID string) []ValidationError {
+	errors := validateFailureLocation(req.Project, req.Env, req.S3Prefix, failureID)
+	// The prefix travels in the body as s3Prefix, as for restores
+	for i := range errors {
+		if errors[i].Field == "prefix" {
+			errors[i].Field = "s3Prefix"
+		}
+	}
+
+	if req.BaseURL != "" {
+		u, err := url.Parse(req.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errors = append(errors, ValidationError{Field: "baseUrl", Message: "must be a valid HTTP(S) URL"})
+		} else if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			errors = append(errors, ValidationError{Field: "baseUrl", Message: "must not have credentials, a query or a fragment"})
+		}
+	}
+
+	if len(req.Headers) > maxReplayHeaders {
+		errors = append(errors, ValidationError{Field: "headers", Message: fmt.Sprintf("at most %d headers", maxReplayHeaders)})
+	}
+	for name, value := range req.Headers {
+		field := "headers." + name
+		switch {
+		case !headerNameRegex.MatchString(name):
+			errors = append(errors, ValidationError{Field: field, Message: "invalid header name"})
+		case repro.IsConnectionHeader(name):
+			errors = append(errors, ValidationError{Field: field, Message: "cannot be overridden"})
+		case strings.ContainsAny(value, "\r\n\x00") || len(value) > 8192:
+			errors = append(errors, ValidationError{Field: field, Message: "invalid header value"})
+		}
+	}
+
+	return errors
+}
+
+// validateFailureLocation checks that prefix is exactly the prefix of failureID
+// in project and env
+func validateFailureLocation(project, env, prefix, failureID string) []ValidationError {
+	var errors []ValidationError
+
+	if project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+
+	if env == "" {
+		errors = append(errors, ValidationError{Field: "env", Message: "required"})
+	} else if !envRegex.MatchString(env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+
+	if prefix == "" {
+		errors = append(errors, ValidationError{Field: "prefix", Message: "required"})
+	} else if len(errors) == 0 {
+		loc, ok := keys.Parse(prefix + "envelope.json")
+		if !ok || loc.Prefix != prefix || !prefixBelongsTo(prefix, project, env, failureID) {
+			errors = append(errors, ValidationError{Field: "prefix", Message: "must be the prefix of this failure in the given project and env"})
+		}
+	}
+
+	return errors
+}
+
+// maxUserIDLength bounds client.userId before it is hashed
+const maxUserIDLength = 256
+
+// ValidateUserErasureRequest validates an erasure request for a user
+func ValidateUserErasureRequest(req *models.UserErasureRequest) []ValidationError {
+	var errors []ValidationError
+
+	if strings.TrimSpace(req.UserID) == "" {
+		errors = append(errors, ValidationError{Field: "userId", Message: "required"})
+	} else if len(req.UserID) > maxUserIDLength {
+		errors = append(errors, ValidationError{Field: "userId", Message: fmt.Sprintf("too long (maximum %d characters)", maxUserIDLength)})
+	}
+
+	return errors
+}
+
+// ValidateAckRequest validates an acknowledgment request
+func ValidateAckRequest(req *models.AckRequest) []ValidationError {
+	var errors []ValidationError
+
+	if req.Project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(req.Project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+
+	return errors
+}
+
+// prefixBelongsTo reports whether prefix is a failure prefix for project/env
+// ending in failureID, in any key scheme or tenant
+func prefixBelongsTo(prefix, project, env, failureID string) bool {
+	if failureID == "" || strings.Contains(prefix, "..") || !strings.HasSuffix(prefix, "/"+failureID+"/") {
+		return false
+	}
+	if strings.HasPrefix(prefix, keys.TenantsPrefix) {
+		loc, ok := keys.Parse(prefix + "envelope.json")
+		return ok && loc.Prefix == prefix && ValidTenant(loc.Tenant) &&
+			loc.Project == project && loc.Env == env && loc.FailureID == failureID
+	}
+	return strings.HasPrefix(prefix, "failures/"+project+"/"+env+"/") ||
+		strings.HasPrefix(prefix, "failures/v2/"+project+"/"+env+"/")
+}
+
+// validProject reports whether project can be used in object keys
+func validProject(project string) bool {
+	return projectRegex.MatchString(project) && project != keys.ReservedProject
+}
+
+// ValidTenant reports whether tenant can be used in object keys
+func ValidTenant(tenant string) bool {
+	return tenantRegex.MatchString(tenant)
+}
+
+// TenantOwns reports whether prefix is stored under tenant. With no tenant,
+// only prefixes outside every tenant's are owned.
+func TenantOwns(tenant, prefix string) bool {
+	if tenant == "" {
+		return !strings.HasPrefix(prefix, keys.TenantsPrefix)
+	}
+	return strings.HasPrefix(prefix, keys.TenantsPrefix+tenant+"/")
+}
+
+// artifactNames are the fixed artifact names accepted by proxy uploads and short links
+var artifactNames = map[string]bool{
+	"envelope.json":        true,
+	"request.raw":          true,
+	"request.headers.json": true,
+	"response.raw":         true,
+	"checksums.json":       true,
+	keys.LogsName:          true,
+	keys.ScreenshotName:    true,
+	keys.ConsoleName:       true,
+}
+
+// ValidateArtifactUpload validates the parameters of a proxied artifact upload.
+// name is either a fixed artifact name or files/{filename}.
+func ValidateArtifactUpload(project, env, prefix, failureID, name string) []ValidationError {
+	var errors []ValidationError
+
+	if project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+
+	if env == "" {
+		errors = append(errors, ValidationError{Field: "env", Message: "required"})
+	} else if !envRegex.MatchString(env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+
+	if prefix == "" {
+		errors = append(errors, ValidationError{Field: "prefix", Message: "required"})
+	} else if len(errors) == 0 && !prefixBelongsTo(prefix, project, env, failureID) {
+		errors = append(errors, ValidationError{Field: "prefix", Message: "must be the prefix of this failure in the given project and env"})
+	}
+
+	if !ValidArtifactName(name) {
+		errors = append(errors, ValidationError{Field: "name", Message: "unknown artifact"})
+	}
+
+	return errors
+}
+
+// ValidatePresignRetryRequest validates a retry of the presigning of uploads of failureID's ticket
+func ValidatePresignRetryRequest(req *models.PresignRetryRequest, failureID string) []ValidationError {
+	errors := ValidateFailureID(failureID)
+
+	if req.Project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(req.Project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+
+	if req.Env == "" {
+		errors = append(errors, ValidationError{Field: "env", Message: "required"})
+	} else if !envRegex.MatchString(req.Env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+
+	if len(req.Artifacts) == 0 {
+		errors = append(errors, ValidationError{Field: "artifacts", Message: "required"})
+	}
+	for i, name := range req.Artifacts {
+		if !ValidArtifactName(name) {
+			errors = append(errors, ValidationError{Field: fmt.Sprintf("artifacts[%d]", i), Message: "unknown artifact"})
+		}
+	}
+
+	return errors
+}
+
+// ValidArtifactName reports whether name is a fixed artifact name or files/{filename}
+func ValidArtifactName(name string) bool {
+	if artifactNames[name] {
+		return true
+	}
+	file := strings.TrimPrefix(name, "files/")
+	return file != name && file != "." && file != ".." && fileNameRegex.MatchString(file)
+}
+
+// ValidateGroupsQuery validates the query parameters for listing groups
+func ValidateGroupsQuery(project, env string) []ValidationError {
+	return ValidateProjectEnv(project, env)
+}
+
+// ValidateProjectEnv validates a required project and an optional env
+func ValidateProjectEnv(project, env string) []ValidationError {
+	var errors []ValidationError
+
+	if project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+
+	if env != "" && !envRegex.MatchString(env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+
+	return errors
+}
+
+// ParseFailureFilter validates and parses the optional severity and tag
+// filters of a failure listing. Each tag is key:value, or a bare key matching
+// any value.
+func ParseFailureFilter(severity string, tags []string) (models.FailureFilter, []ValidationError) {
+	var errors []ValidationError
+	f := models.FailureFilter{Severity: severity}
+
+	if !priority.ValidSeverity(severity) {
+		errors = append(errors, ValidationError{Field: "severity", Message: "must be one of: info, warning, error, critical"})
+	}
+	if len(tags) > MaxTags {
+		errors = append(errors, ValidationError{Field: "tag", Message: fmt.Sprintf("too many tag filters (maximum %d)", MaxTags)})
+	}
+	for _, t := range tags {
+		k, v, _ := strings.Cut(t, ":")
+		if !tagKeyRegex.MatchString(k) || utf8.RuneCountInString(v) > maxTagValueLength {
+			errors = append(errors, ValidationError{Field: "tag", Message: fmt.Sprintf("invalid filter %q (key:value or key)", t)})
+			continue
+		}
+		if f.Tags == nil {
+			f.Tags = make(map[string]string)
+		}
+		f.Tags[k] = v
+	}
+
+	return f, errors
+}
+
+// Failure listing bounds: days searched back from today and failures returned
+const (
+	DefaultListDays  = 7
+	MaxListDays      = 31
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// ValidateListFailures validates a required project and env and the optional
+// days and limit of a failure listing
+func ValidateListFailures(project, env, days, limit string) []ValidationError {
+	var errors []ValidationError
+
+	if project == "" {
+		errors = append(errors, ValidationError{Field: "project", Message: "required"})
+	} else if !validProject(project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+	if env == "" {
+		errors = append(errors, ValidationError{Field: "env", Message: "required"})
+	} else if !envRegex.MatchString(env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+	for _, f := range []struct {
+		field, value string
+		max          int
+	}{{"days", days, MaxListDays}, {"limit", limit, MaxListLimit}} {
+		if f.value == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(f.value); err != nil || n < 1 || n > f.max {
+			errors = append(errors, ValidationError{Field: f.field, Message: fmt.Sprintf("must be between 1 and %d", f.max)})
+		}
+	}
+
+	return errors
+}
+
+// Stats query windows, in days
+const (
+	DefaultStatsDays = 7
+	MaxStatsDays     = 92
+)
+
+// StatsWindow resolves a validated stats query window of YYYY-MM-DD days:
+// to defaults to today and from to DefaultStatsDays days ending with to
+func StatsWindow(from, to string, now time.Time) (time.Time, time.Time) {
+	toT, err := time.Parse(time.DateOnly, to)
+	if err != nil {
+		toT = now.UTC().Truncate(24 * time.Hour)
+	}
+	fromT, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		fromT = toT.AddDate(0, 0, 1-DefaultStatsDays)
+	}
+	return fromT, toT
+}
+
+// ValidateStatsQuery validates an optional project, env, YYYY-MM-DD window and top
+func ValidateStatsQuery(project, env, from, to, top string, now time.Time) []ValidationError {
+	var errors []ValidationError
+
+	if project != "" && !validProject(project) {
+		errors = append(errors, ValidationError{Field: "project", Message: "invalid format"})
+	}
+	if env != "" && !envRegex.MatchString(env) {
+		errors = append(errors, ValidationError{Field: "env", Message: "invalid format"})
+	}
+	if env != "" && project == "" {
+		errors = append(errors, ValidationError{Field: "env", Message: "requires project"})
+	}
+	for _, f := range [][2]string{{"from", from}, {"to", to}} {
+		if f[1] == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, f[1]); err != nil {
+			errors = append(errors, ValidationError{Field: f[0], Message: "must be a date (YYYY-MM-DD)"})
+		}
+	}
+	if top != "" {
+		if n, err := strconv.Atoi(top); err != nil || n < 1 {
+			errors = append(errors, ValidationError{Field: "top", Message: "must be a positive integer"})
+		}
+	}
+	if len(errors) > 0 {
+		return errors
+	}
+
+	fromT, toT := StatsWindow(from, to, now)
+	if toT.Before(fromT) {
+		errors = append(errors, ValidationError{Field: "from", Message: "must not be after to"})
+	} else if int(toT.Sub(fromT).Hours()/24)+1 > MaxStatsDays {
+		errors = append(errors, ValidationError{Field: "from", Message: fmt.Sprintf("window cannot exceed %d days", MaxStatsDays)})
+	}
+	return errors
+}
+
+// DefaultUsageWindow is the usage query window when from is not given
+const DefaultUsageWindow = 24 * time.Hour
+
+// UsageWindow resolves a validated usage query window: to defaults to now and
+// from to DefaultUsageWindow before to
+func UsageWindow(from, to string, now time.Time) (time.Time, time.Time) {
+	toT, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		toT = now
+	}
+	fromT, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		fromT = toT.Add(-DefaultUsageWindow)
+	}
+	return fromT.UTC(), toT.UTC()
+}
+
+// ValidateUsageQuery validates the key ID and optional RFC 3339 window of a usage
+// query; the window may span at most maxWindow
+func ValidateUsageQuery(keyID, from, to string, now time.Time, maxWindow time.Duration) []ValidationError {
+	var errors []ValidationError
+
+	if keyID == "" {
+		errors = append(errors, ValidationError{Field: "id", Message: "required"})
+	}
+
+	if from != "" {
+		if _, err := time.Parse(time.RFC3339, from); err != nil {
+			errors = append(errors, ValidationError{Field: "from", Message: "must be an RFC 3339 timestamp"})
+		}
+	}
+	if to != "" {
+		if _, err := time.Parse(time.RFC3339, to); err != nil {
+			errors = append(errors, ValidationError{Field: "to", Message: "must be an RFC 3339 timestamp"})
+		}
+	}
+	if len(errors) > 0 {
+		return errors
+	}
+
+	fromT, toT := UsageWindow(from, to, now)
+	if !fromT.Before(toT) {
+		errors = append(errors, ValidationError{Field: "from", Message: "must be before to"})
+	} else if toT.Sub(fromT) > maxWindow {
+		errors = append(errors, ValidationError{Field: "from", Message: fmt.Sprintf("window cannot exceed %s", maxWindow)})
+	}
+
+	return errors
+}
+
+// apiKeyIDRegex keeps managed key IDs safe to use in object keys
+var apiKeyIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// ValidateCreateAPIKeyRequest validates a managed API key definition
+func ValidateCreateAPIKeyRequest(req *models.CreateAPIKeyRequest) []ValidationError {
+	var errors []ValidationError
+
+	if req.ID == "" {
+		errors = append(errors, ValidationError{Field: "id", Message: "required"})
+	} else if !apiKeyIDRegex.MatchString(req.ID) || req.ID == "." || req.ID == ".." {
+		errors = append(errors, ValidationError{Field: "id", Message: "invalid format"})
+	}
+
+	if len(req.Projects) == 0 {
+		errors = append(errors, ValidationError{Field: "projects", Message: "required"})
+	}
+	for i, p := range req.Projects {
+		if p != apikeys.Wildcard && !validProject(p) {
+			errors = append(errors, ValidationError{Field: fmt.Sprintf("projects[%d]", i), Message: "invalid format"})
+		}
+	}
+
+	if len(req.Scopes) == 0 {
+		errors = append(errors, ValidationError{Field: "scopes", Message: "required"})
+	}
+	for i, s := range req.Scopes {
+		switch apikeys.Scope(s) {
+		case apikeys.ScopeTicketCreate, apikeys.ScopeFailureRead, apikeys.ScopeCritical, apikeys.ScopeAdmin:
+		default:
+			errors = append(errors, ValidationError{Field: fmt.Sprintf("scopes[%d]", i), Message: "unknown scope"})
+		}
+	}
+
+	if req.Tenant != "" && !ValidTenant(req.Tenant) {
+		errors = append(errors, ValidationError{Field: "tenant", Message: "invalid format"})
+	}
+
+	return errors
+}
+
+// ValidateRotateAPIKeyRequest validates the overlap of a key rotation
+func ValidateRotateAPIKeyRequest(req *models.RotateAPIKeyRequest) []ValidationError {
+	var errors []ValidationError
+
+	if o := req.OverlapSeconds; o != nil && (*o < 0 || time.Duration(*o)*time.Second > apikeys.MaxOverlap) {
+		errors = append(errors, ValidationError{Field: "overlapSeconds", Message: fmt.Sprintf("must be between 0 and %d", int(apikeys.MaxOverlap.Seconds()))})
 	}
 
 	return errors
@@ -1,10 +1,14 @@
 package validation
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/yourorg/failure-uploader/internal/config"
 	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/profiles"
 )
 
 func TestValidateUploadTicketRequest(t *testing.T) {
@@ -12,6 +16,10 @@ func TestValidateUploadTicketRequest(t *testing.T) {
 		MaxBodyBytes:  10 * 1024 * 1024,  // 10MB
 		MaxFileBytes:  50 * 1024 * 1024,  // 50MB
 		MaxTotalBytes: 100 * 1024 * 1024, // 100MB
+
+		MaxLogsBytes:       1024 * 1024,     // 1MB
+		MaxScreenshotBytes: 5 * 1024 * 1024, // 5MB
+		MaxConsoleBytes:    1024 * 1024,     // 1MB
 	}
 
 	tests := []struct {
@@ -159,6 +167,45 @@ func TestValidateUploadTicketRequest(t *testing.T) {
 			},
 			wantErrors: 1,
 		},
+		{
+			name: "invalid priority",
+			req: models.UploadTicketRequest{
+				Project:  "myapp",
+				Env:      "prod",
+				Priority: "urgent",
+				Request: models.RequestInfo{
+					Method: "POST",
+					URL:    "https://api.example.com/v1/submit",
+				},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "invalid severity",
+			req: models.UploadTicketRequest{
+				Project:  "myapp",
+				Env:      "prod",
+				Severity: "fatal",
+				Request: models.RequestInfo{
+					Method: "POST",
+					URL:    "https://api.example.com/v1/submit",
+				},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "negative schema version",
+			req: models.UploadTicketRequest{
+				SchemaVersion: -1,
+				Project:       "myapp",
+				Env:           "prod",
+				Request: models.RequestInfo{
+					Method: "POST",
+					URL:    "https://api.example.com/v1/submit",
+				},
+			},
+			wantErrors: 1,
+		},
 		{
 			name: "multiple errors",
 			req: models.UploadTicketRequest{
@@ -171,11 +218,86 @@ func TestValidateUploadTicketRequest(t *testing.T) {
 			},
 			wantErrors: 4, // project, env, method, url
 		},
+		{
+			name: "valid response",
+			req: models.UploadTicketRequest{
+				Project:  "myapp",
+				Env:      "prod",
+				Request:  models.RequestInfo{Method: "GET", URL: "https://api.example.com/v1/orders"},
+				Response: &models.ResponseInfo{StatusCode: 503, DurationMs: 1200, ErrorMessage: "Service Unavailable"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "no response received",
+			req: models.UploadTicketRequest{
+				Project:  "myapp",
+				Env:      "prod",
+				Request:  models.RequestInfo{Method: "GET", URL: "https://api.example.com/v1/orders"},
+				Response: &models.ResponseInfo{DurationMs: 30000, ErrorClass: "timeout", ErrorMessage: "The request timed out."},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "invalid response",
+			req: models.UploadTicketRequest{
+				Project:  "myapp",
+				Env:      "prod",
+				Request:  models.RequestInfo{Method: "GET", URL: "https://api.example.com/v1/orders"},
+				Response: &models.ResponseInfo{StatusCode: 42, DurationMs: -1, ErrorMessage: strings.Repeat("x", 1025)},
+			},
+			wantErrors: 3, // statusCode, durationMs, errorMessage
+		},
+		{
+			name: "sha256 digests",
+			req: models.UploadTicketRequest{
+				Project: "myapp",
+				Env:     "prod",
+				Request: models.RequestInfo{
+					Method: "POST",
+					URL:    "https://api.example.com/v1/submit",
+					SHA256: strings.Repeat("aB", 32),
+					Files: []models.FileInfo{
+						{Filename: "a.png", SHA256: strings.Repeat("0", 64)},
+						{Filename: "b.png", SHA256: "not-hex"},
+						{Filename: "c.png", SHA256: strings.Repeat("0", 63)},
+					},
+				},
+			},
+			wantErrors: 2, // files[1].sha256, files[2].sha256
+		},
+		{
+			name: "artifact slots",
+			req: models.UploadTicketRequest{
+				Project: "myapp",
+				Env:     "prod",
+				Request: models.RequestInfo{Method: "GET", URL: "https://api.example.com/v1/orders"},
+				Artifacts: &models.ArtifactsInfo{
+					Logs:       &models.ArtifactInfo{Bytes: 64 * 1024},
+					Screenshot: &models.ArtifactInfo{Bytes: 4 * 1024 * 1024, SHA256: strings.Repeat("0", 64)},
+					Console:    &models.ArtifactInfo{},
+				},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "artifact slots over their limits",
+			req: models.UploadTicketRequest{
+				Project: "myapp",
+				Env:     "prod",
+				Request: models.RequestInfo{Method: "GET", URL: "https://api.example.com/v1/orders"},
+				Artifacts: &models.ArtifactsInfo{
+					Logs:       &models.ArtifactInfo{Bytes: 2 * 1024 * 1024},
+					Screenshot: &models.ArtifactInfo{Bytes: -1, SHA256: "not-hex"},
+				},
+			},
+			wantErrors: 3, // logs.bytes, screenshot.bytes, screenshot.sha256
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			errs := ValidateUploadTicketRequest(&tt.req, cfg)
+			errs := ValidateUploadTicketRequest(&tt.req, cfg, nil)
 			if len(errs) != tt.wantErrors {
 				t.Errorf("ValidateUploadTicketRequest() returned %d errors, want %d", len(errs), tt.wantErrors)
 				for _, e := range errs {
@@ -186,7 +308,112 @@ func TestValidateUploadTicketRequest(t *testing.T) {
 	}
 }
 
+func TestValidateUploadTicketRequest_Profiles(t *testing.T) {
+	cfg := &config.Config{MaxBodyBytes: 1024, MaxFileBytes: 1024, MaxTotalBytes: 4096}
+	profs, err := profiles.Parse(`{
+		"tools": {"maxFileBytes": 524288000, "maxTotalBytes": 1048576000},
+		"public": {"maxFiles": 1, "platforms": ["ios"], "contentTypes": ["application/json", "image/*"]}
+	}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	video := models.FileInfo{Filename: "screen.mp4", ContentType: "video/mp4", Bytes: 400 * 1024 * 1024}
+	req := func(project, platform, contentType string, files ...models.FileInfo) models.UploadTicketRequest {
+		return models.UploadTicketRequest{
+			Project: project,
+			Env:     "prod",
+			Request: models.RequestInfo{Method: "POST", URL: "https://x", ContentType: contentType, Files: files},
+			Client:  models.ClientInfo{Platform: platform},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		req        models.UploadTicketRequest
+		wantFields []string
+	}{
+		{"large video for tools", req("tools", "desktop", "application/json", video), nil},
+		{"large video elsewhere", req("other", "desktop", "application/json", video), []string{"request.files[0].bytes", "totalBytes"}},
+		{"public allowed", req("public", "ios", "application/json", models.FileInfo{Filename: "a.png", ContentType: "image/png"}), nil},
+		{"public platform", req("public", "android", "application/json"), []string{"client.platform"}},
+		{"public content types", req("public", "ios", "text/html", models.FileInfo{Filename: "a.mp4", ContentType: "video/mp4"}),
+			[]string{"request.contentType", "request.files[0].contentType"}},
+		{"public file count", req("public", "ios", "", models.FileInfo{Filename: "a"}, models.FileInfo{Filename: "b"}), []string{"request.files"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateUploadTicketRequest(&tt.req, cfg, profs)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("errors = %v, want fields %v", errs, tt.wantFields)
+			}
+			for i, e := range errs {
+				if e.Field != tt.wantFields[i] {
+					t.Errorf("errors[%d].Field = %q, want %q", i, e.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUploadTicketRequest_GlobalFileRules(t *testing.T) {
+	cfg := &config.Config{
+		MaxBodyBytes:        1024,
+		MaxFileBytes:        1024,
+		MaxTotalBytes:       4096,
+		MaxFiles:            2,
+		AllowedContentTypes: "application/json, text/plain, image/*",
+		DeniedContentTypes:  config.DefaultDeniedContentTypes,
+	}
+	profs, err := profiles.Parse(`{"bulk": {"maxFiles": 3, "contentTypes": ["application/*"]}}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	file := func(name, contentType string) models.FileInfo {
+		return models.FileInfo{Filename: name, ContentType: contentType}
+	}
+	req := func(project string, files ...models.FileInfo) models.UploadTicketRequest {
+		return models.UploadTicketRequest{
+			Project: project,
+			Env:     "prod",
+			Request: models.RequestInfo{Method: "POST", URL: "https://x", Files: files},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		req       models.UploadTicketRequest
+		wantCodes []string
+	}{
+		{"allowed", req("myapp", file("a.png", "image/png"), file("b.log", "text/plain; charset=utf-8")), nil},
+		{"too many files", req("myapp", file("a", ""), file("b", ""), file("c", "")), []string{CodeTooManyFiles}},
+		{"profile raises file count", req("bulk", file("a", ""), file("b", ""), file("c", "")), nil},
+		{"not allowed", req("myapp", file("a.mp4", "video/mp4")), []string{CodeContentTypeNotAllowed}},
+		{"executable denied", req("myapp", file("a.exe", "application/x-msdownload")), []string{CodeContentTypeDenied}},
+		{"denied despite profile allowlist", req("bulk", file("a.sh", "application/x-sh")), []string{CodeContentTypeDenied}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateUploadTicketRequest(&tt.req, cfg, profs)
+			if len(errs) != len(tt.wantCodes) {
+				t.Fatalf("errors = %v, want codes %v", errs, tt.wantCodes)
+			}
+			for i, e := range errs {
+				if e.Code != tt.wantCodes[i] {
+					t.Errorf("errors[%d].Code = %q, want %q", i, e.Code, tt.wantCodes[i])
+				}
+			}
+		})
+	}
+}
+
 func TestValidateUploadCompleteRequest(t *testing.T) {
+	cfg := &config.Config{EncryptedProjects: "vault, payroll"}
+	const prefix = "failures/myapp/prod/2024/01/15/abc-123/"
+
 	tests := []struct {
 		name       string
 		req        models.UploadCompleteRequest
@@ -198,7 +425,7 @@ func TestValidateUploadCompleteRequest(t *testing.T) {
 				FailureID:    "abc-123",
 				Project:      "myapp",
 				Env:          "prod",
-				UploadedKeys: []string{"key1", "key2"},
+				UploadedKeys: []string{prefix + "envelope.json", prefix + "request.raw"},
 			},
 			wantErrors: 0,
 		},
@@ -207,7 +434,7 @@ func TestValidateUploadCompleteRequest(t *testing.T) {
 			req: models.UploadCompleteRequest{
 				Project:      "myapp",
 				Env:          "prod",
-				UploadedKeys: []string{"key1"},
+				UploadedKeys: []string{prefix + "envelope.json"},
 			},
 			wantErrors: 1,
 		},
@@ -225,11 +452,135 @@ func TestValidateUploadCompleteRequest(t *testing.T) {
 			req:        models.UploadCompleteRequest{},
 			wantErrors: 4, // failureId, project, env, uploadedKeys
 		},
+		{
+			name: "invalid completion response",
+			req: models.UploadCompleteRequest{
+				FailureID:        "abc-123",
+				Project:          "myapp",
+				Env:              "prod",
+				UploadedKeys:     []string{prefix + "envelope.json"},
+				GenerateEnvelope: true,
+				Response:         &models.ResponseInfo{StatusCode: 999},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "server checksums with one prefix",
+			req: models.UploadCompleteRequest{
+				FailureID:       "abc-123",
+				Project:         "myapp",
+				Env:             "prod",
+				UploadedKeys:    []string{prefix + "envelope.json", prefix + "request.raw"},
+				ServerChecksums: true,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "server checksums across prefixes",
+			req: models.UploadCompleteRequest{
+				FailureID:       "abc-123",
+				Project:         "myapp",
+				Env:             "prod",
+				UploadedKeys:    []string{prefix + "envelope.json", prefix + "files/a.txt"},
+				ServerChecksums: true,
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "keys of another project",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{prefix + "envelope.json", "failures/victim/prod/2024/01/15/abc-123/request.raw"},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "keys of another failure",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{"failures/myapp/prod/2024/01/15/def-456/envelope.json"},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "keys across prefixes of the failure",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{prefix + "envelope.json", "failures/tenant=acme/myapp/prod/dt=2024-01-15/abc-123/request.raw"},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "keys outside a failure prefix",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{"envelope.json"},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "critical priority",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{prefix + "envelope.json"},
+				Priority:     "critical",
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "encrypted",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{prefix + "envelope.json"},
+				Encryption: &models.Encryption{
+					Algorithm: "AES-256-GCM",
+					KeyID:     "arn:aws:kms:us-east-1:123456789012:key/abcd-1234",
+					IV:        "AAECAwQFBgcICQoL",
+				},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "invalid encryption descriptor",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "myapp",
+				Env:          "prod",
+				UploadedKeys: []string{prefix + "envelope.json"},
+				Encryption: &models.Encryption{
+					Algorithm: "ROT13",
+					IV:        "not base64!",
+				},
+			},
+			wantErrors: 3, // algorithm, keyId, iv
+		},
+		{
+			name: "encryption required for project",
+			req: models.UploadCompleteRequest{
+				FailureID:    "abc-123",
+				Project:      "payroll",
+				Env:          "prod",
+				UploadedKeys: []string{"failures/payroll/prod/2024/01/15/abc-123/envelope.json"},
+			},
+			wantErrors: 1,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			errs := ValidateUploadCompleteRequest(&tt.req)
+			errs := ValidateUploadCompleteRequest(&tt.req, cfg)
 			if len(errs) != tt.wantErrors {
 				t.Errorf("ValidateUploadCompleteRequest() returned %d errors, want %d", len(errs), tt.wantErrors)
 				for _, e := range errs {
@@ -239,3 +590,478 @@ func TestValidateUploadCompleteRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateRestoreRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        models.RestoreRequest
+		failureID  string
+		wantErrors int
+	}{
+		{
+			name:       "valid v1 prefix",
+			req:        models.RestoreRequest{Project: "myapp", Env: "prod", S3Prefix: "failures/myapp/prod/2024/03/15/abc-123/"},
+			failureID:  "abc-123",
+			wantErrors: 0,
+		},
+		{
+			name:       "valid v2 prefix",
+			req:        models.RestoreRequest{Project: "myapp", Env: "prod", S3Prefix: "failures/v2/myapp/prod/dt=2024-03-15/abc-123/"},
+			failureID:  "abc-123",
+			wantErrors: 0,
+		},
+		{
+			name:       "prefix of another project",
+			req:        models.RestoreRequest{Project: "myapp", Env: "prod", S3Prefix: "failures/other/prod/2024/03/15/abc-123/"},
+			failureID:  "abc-123",
+			wantErrors: 1,
+		},
+		{
+			name:       "prefix of another failure",
+			req:        models.RestoreRequest{Project: "myapp", Env: "prod", S3Prefix: "failures/myapp/prod/2024/03/15/xyz-789/"},
+			failureID:  "abc-123",
+			wantErrors: 1,
+		},
+		{
+			name:       "all missing",
+			req:        models.RestoreRequest{},
+			failureID:  "abc-123",
+			wantErrors: 3, // project, env, s3Prefix
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateRestoreRequest(&tt.req, tt.failureID)
+			if len(errs) != tt.wantErrors {
+				t.Errorf("ValidateRestoreRequest() returned %d errors, want %d", len(errs), tt.wantErrors)
+				for _, e := range errs {
+					t.Logf("  - %s", e.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDeleteFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		wantErrors int
+	}{
+		{"valid v1 prefix", "failures/myapp/prod/2024/03/15/abc-123/", 0},
+		{"valid v2 prefix", "failures/v2/myapp/prod/dt=2024-03-15/abc-123/", 0},
+		{"valid tenant prefix", "failures/tenant=acme/myapp/prod/dt=2024-03-15/abc-123/", 0},
+		{"tenant prefix of another project", "failures/tenant=acme/other/prod/dt=2024-03-15/abc-123/", 1},
+		{"tenant prefix without tenant", "failures/tenant=/myapp/prod/dt=2024-03-15/abc-123/", 1},
+		{"missing prefix", "", 1},
+		{"env prefix", "failures/myapp/prod/abc-123/", 1},
+		{"nested under another failure", "failures/myapp/prod/2024/03/15/xyz/abc-123/", 1},
+		{"another failure", "failures/myapp/prod/2024/03/15/xyz-789/", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateDeleteFailure("myapp", "prod", tt.prefix, "abc-123")
+			if len(errs) != tt.wantErrors {
+				t.Errorf("ValidateDeleteFailure() returned %d errors, want %d: %v", len(errs), tt.wantErrors, errs)
+			}
+		})
+	}
+}
+
+func TestValidateDeleteFailure_V2RootCollision(t *testing.T) {
+	// v2 prefixes of project myapp sit where the v1 prefixes of a project
+	// named v2 with env myapp would
+	errs := ValidateDeleteFailure("v2", "myapp", "failures/v2/myapp/prod/dt=2024-03-15/abc-123/", "abc-123")
+	if len(errs) == 0 || errs[0].Field != "project" {
+		t.Errorf("ValidateDeleteFailure() = %v, want the reserved project refused", errs)
+	}
+}
+
+func TestValidateReplayRequest(t *testing.T) {
+	const prefix = "failures/myapp/prod/2024/03/15/abc-123/"
+
+	tests := []struct {
+		name      string
+		req       models.ReplayRequest
+		wantField string
+	}{
+		{"valid", models.ReplayRequest{BaseURL: "https://staging.example.com/api", Headers: map[string]string{"Authorization": "Bearer x", "Accept": ""}}, ""},
+		{"ftp base url", models.ReplayRequest{BaseURL: "ftp://example.com"}, "baseUrl"},
+		{"base url with query", models.ReplayRequest{BaseURL: "https://example.com/?a=1"}, "baseUrl"},
+		{"bad header name", models.ReplayRequest{Headers: map[string]string{"X Bad": "1"}}, "headers.X Bad"},
+		{"connection header", models.ReplayRequest{Headers: map[string]string{"Host": "evil.com"}}, "headers.Host"},
+		{"header injection", models.ReplayRequest{Headers: map[string]string{"X-A": "1\r\nX-B: 2"}}, "headers.X-A"},
+		{"foreign prefix", models.ReplayRequest{S3Prefix: "failures/other/prod/2024/03/15/abc-123/"}, "s3Prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Project, tt.req.Env = "myapp", "prod"
+			if tt.req.S3Prefix == "" {
+				tt.req.S3Prefix = prefix
+			}
+			errs := ValidateReplayRequest(&tt.req, "abc-123")
+			if tt.wantField == "" {
+				if len(errs) != 0 {
+					t.Errorf("ValidateReplayRequest() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Field != tt.wantField {
+				t.Errorf("ValidateReplayRequest() = %v, want one error on %s", errs, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestValidateArtifactUpload(t *testing.T) {
+	const prefix = "failures/myapp/prod/2024/03/15/abc-123/"
+
+	tests := []struct {
+		name       string
+		project    string
+		env        string
+		prefix     string
+		artifact   string
+		wantErrors int
+	}{
+		{name: "envelope", project: "myapp", env: "prod", prefix: prefix, artifact: "envelope.json", wantErrors: 0},
+		{name: "attached file", project: "myapp", env: "prod", prefix: prefix, artifact: "files/a.jpg", wantErrors: 0},
+		{name: "screenshot slot", project: "myapp", env: "prod", prefix: prefix, artifact: "screenshot.png", wantErrors: 0},
+		{name: "unknown artifact", project: "myapp", env: "prod", prefix: prefix, artifact: "other.bin", wantErrors: 1},
+		{name: "nested file path", project: "myapp", env: "prod", prefix: prefix, artifact: "files/x/a.jpg", wantErrors: 1},
+		{name: "file traversal", project: "myapp", env: "prod", prefix: prefix, artifact: "files/..", wantErrors: 1},
+		{name: "prefix of another project", project: "other", env: "prod", prefix: prefix, artifact: "request.raw", wantErrors: 1},
+		{name: "all missing", artifact: "request.raw", wantErrors: 3}, // project, env, prefix
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateArtifactUpload(tt.project, tt.env, tt.prefix, "abc-123", tt.artifact)
+			if len(errs) != tt.wantErrors {
+				t.Errorf("ValidateArtifactUpload() returned %d errors, want %d", len(errs), tt.wantErrors)
+				for _, e := range errs {
+					t.Logf("  - %s", e.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckUploadSizes(t *testing.T) {
+	prefix := "failures/v2/myapp/prod/dt=2024-03-15/abc-123/"
+	declared := &models.RequestInfo{
+		BodyBytes: 100 << 10,
+		Files:     []models.FileInfo{{Filename: "a.png", Bytes: 1000}, {Filename: "b.png"}},
+	}
+	limits := profiles.Profile{MaxBodyBytes: 1 << 20, MaxFileBytes: 2 << 20}
+
+	got := CheckUploadSizes(declared, nil, prefix, map[string]int64{
+		prefix + "request.raw":    110 << 10, // within 10%
+		prefix + "files/a.png":    1000 + 5000,
+		prefix + "files/b.png":    2 << 20, // no declared size, at the file limit
+		prefix + "files/c.png":    3 << 20, // undeclared file
+		prefix + "envelope.json":  512,
+		prefix + "response.raw":   2 << 20,
+		prefix + "checksums.json": 0,
+	}, limits, 10)
+
+	var keys []string
+	for _, m := range got {
+		keys = append(keys, strings.TrimPrefix(m.Key, prefix))
+	}
+	want := []string{"files/a.png", "files/c.png", "response.raw"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("CheckUploadSizes() = %v, want %v", got, want)
+	}
+	if got[0].Allowed != 1000+minSizeSlack {
+		t.Errorf("files/a.png allowed %d bytes, want %d", got[0].Allowed, 1000+minSizeSlack)
+	}
+
+	if got := CheckUploadSizes(declared, nil, prefix, map[string]int64{prefix + "request.raw": 111 << 10}, limits, 10); len(got) != 1 {
+		t.Errorf("request.raw beyond tolerance: %v", got)
+	}
+}
+
+func TestCheckUploadSizes_Artifacts(t *testing.T) {
+	prefix := "failures/v2/myapp/prod/dt=2024-03-15/abc-123/"
+	limits := profiles.Profile{MaxBodyBytes: 1 << 20, MaxFileBytes: 2 << 20, MaxLogsBytes: 64 << 10, MaxScreenshotBytes: 4 << 20, MaxConsoleBytes: 64 << 10}
+	artifacts := &models.ArtifactsInfo{Screenshot: &models.ArtifactInfo{Bytes: 100 << 10}}
+
+	got := CheckUploadSizes(&models.RequestInfo{}, artifacts, prefix, map[string]int64{
+		prefix + "logs.txt":       65 << 10,  // undeclared, over the logs limit
+		prefix + "screenshot.png": 120 << 10, // beyond the declared size
+		prefix + "console.json":   60 << 10,
+		prefix + "files/logs.txt": 1 << 20, // an attached file, not the slot
+	}, limits, 10)
+
+	var keys []string
+	for _, m := range got {
+		keys = append(keys, strings.TrimPrefix(m.Key, prefix))
+	}
+	if want := []string{"logs.txt", "screenshot.png"}; strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("CheckUploadSizes() = %v, want %v", got, want)
+	}
+	if got[0].Allowed != 64<<10 || got[1].Allowed != 110<<10 {
+		t.Errorf("allowed = %d, %d; want the logs limit and the declared screenshot size with slack", got[0].Allowed, got[1].Allowed)
+	}
+}
+
+func TestValidateIdempotencyKey(t *testing.T) {
+	for key, want := range map[string]int{
+		"":                                     0,
+		"8f14e45f-ceea-467f-a0e6-1d2c3b4a5f6e": 0,
+		"retry 1":                              1,
+		"caf\u00e9":                            1,
+		strings.Repeat("k", 256):               1,
+	} {
+		if errs := ValidateIdempotencyKey(key); len(errs) != want {
+			t.Errorf("ValidateIdempotencyKey(%q) returned %d errors, want %d", key, len(errs), want)
+		}
+	}
+}
+
+func TestValidateAckRequest(t *testing.T) {
+	if errs := ValidateAckRequest(&models.AckRequest{Project: "myapp"}); len(errs) != 0 {
+		t.Errorf("valid request returned %d errors", len(errs))
+	}
+	if errs := ValidateAckRequest(&models.AckRequest{}); len(errs) != 1 {
+		t.Errorf("missing project returned %d errors, want 1", len(errs))
+	}
+	if errs := ValidateAckRequest(&models.AckRequest{Project: "bad project!"}); len(errs) != 1 {
+		t.Errorf("invalid project returned %d errors, want 1", len(errs))
+	}
+}
+
+func TestValidatePresignRetryRequest(t *testing.T) {
+	const id = "550e8400-e29b-41d4-a716-446655440000"
+	valid := models.PresignRetryRequest{Project: "myapp", Env: "prod", Artifacts: []string{"request.raw", "files/a.jpg"}}
+	if errs := ValidatePresignRetryRequest(&valid, id); len(errs) != 0 {
+		t.Errorf("valid request returned %v", errs)
+	}
+	if errs := ValidatePresignRetryRequest(&valid, "abc"); len(errs) != 1 {
+		t.Errorf("invalid failure ID returned %d errors, want 1", len(errs))
+	}
+	if errs := ValidatePresignRetryRequest(&models.PresignRetryRequest{Project: "myapp", Env: "prod"}, id); len(errs) != 1 {
+		t.Errorf("missing artifacts returned %d errors, want 1", len(errs))
+	}
+	bad := models.PresignRetryRequest{Project: "myapp", Env: "prod", Artifacts: []string{"request.raw", "../envelope.json"}}
+	if errs := ValidatePresignRetryRequest(&bad, id); len(errs) != 1 || errs[0].Field != "artifacts[1]" {
+		t.Errorf("unknown artifact returned %v, want one error on artifacts[1]", errs)
+	}
+}
+
+func TestTenantOwns(t *testing.T) {
+	tests := []struct {
+		tenant, prefix string
+		want           bool
+	}{
+		{"acme", "failures/tenant=acme/myapp/prod/dt=2024-03-15/abc-123/", true},
+		{"acme", "failures/tenant=acme-eu/myapp/prod/dt=2024-03-15/abc-123/", false},
+		{"acme", "failures/v2/myapp/prod/dt=2024-03-15/abc-123/", false},
+		{"", "failures/v2/myapp/prod/dt=2024-03-15/abc-123/", true},
+		{"", "failures/tenant=acme/myapp/prod/dt=2024-03-15/abc-123/", false},
+	}
+
+	for _, tt := range tests {
+		if got := TenantOwns(tt.tenant, tt.prefix); got != tt.want {
+			t.Errorf("TenantOwns(%q, %q) = %v, want %v", tt.tenant, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCreateAPIKeyRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        models.CreateAPIKeyRequest
+		wantErrors int
+	}{
+		{"valid", models.CreateAPIKeyRequest{ID: "web-1", Projects: []string{"myapp", "*"}, Scopes: []string{"failure:read"}}, 0},
+		{"empty", models.CreateAPIKeyRequest{}, 3},
+		{"path in id", models.CreateAPIKeyRequest{ID: "../x", Projects: []string{"myapp"}, Scopes: []string{"admin"}}, 1},
+		{"bad project and scope", models.CreateAPIKeyRequest{ID: "k", Projects: []string{"my app"}, Scopes: []string{"root"}}, 2},
+		{"reserved project", models.CreateAPIKeyRequest{ID: "k", Projects: []string{"v2"}, Scopes: []string{"failure:read"}}, 1},
+		{"tenant", models.CreateAPIKeyRequest{ID: "k", Projects: []string{"myapp"}, Scopes: []string{"admin"}, Tenant: "acme"}, 0},
+		{"bad tenant", models.CreateAPIKeyRequest{ID: "k", Projects: []string{"myapp"}, Scopes: []string{"admin"}, Tenant: "acme/x"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := ValidateCreateAPIKeyRequest(&tt.req); len(errs) != tt.wantErrors {
+				t.Errorf("ValidateCreateAPIKeyRequest() = %v, want %d errors", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestValidateRotateAPIKeyRequest(t *testing.T) {
+	for overlap, want := range map[int]int{0: 0, 3600: 0, -1: 1, 31 * 24 * 3600: 1} {
+		o := overlap
+		if errs := ValidateRotateAPIKeyRequest(&models.RotateAPIKeyRequest{OverlapSeconds: &o}); len(errs) != want {
+			t.Errorf("overlap %d: %d errors, want %d", overlap, len(errs), want)
+		}
+	}
+	if errs := ValidateRotateAPIKeyRequest(&models.RotateAPIKeyRequest{}); len(errs) != 0 {
+		t.Errorf("default overlap returned %d errors", len(errs))
+	}
+}
+
+func TestValidateUsageQuery(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		keyID      string
+		from, to   string
+		wantErrors int
+	}{
+		{"defaults", "ios", "", "", 0},
+		{"explicit window", "ios", "2024-03-14T00:00:00Z", "2024-03-15T00:00:00Z", 0},
+		{"missing key", "", "", "", 1},
+		{"bad timestamps", "ios", "yesterday", "now", 2},
+		{"reversed", "ios", "2024-03-15T00:00:00Z", "2024-03-14T00:00:00Z", 1},
+		{"too wide", "ios", "2024-01-01T00:00:00Z", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateUsageQuery(tt.keyID, tt.from, tt.to, now, 7*24*time.Hour)
+			if len(errs) != tt.wantErrors {
+				t.Errorf("ValidateUsageQuery() = %v, want %d errors", errs, tt.wantErrors)
+			}
+		})
+	}
+
+	from, to := UsageWindow("", "", now)
+	if !to.Equal(now) || !from.Equal(now.Add(-DefaultUsageWindow)) {
+		t.Errorf("UsageWindow() = %v, %v", from, to)
+	}
+}
+
+func TestValidateStatsQuery(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                        string
+		project, env, from, to, top string
+		wantErrors                  int
+	}{
+		{"defaults", "", "", "", "", "", 0},
+		{"project and env", "myapp", "prod", "2024-03-01", "2024-03-15", "5", 0},
+		{"env without project", "", "prod", "", "", "", 1},
+		{"bad dates", "myapp", "", "2024-03-01T00:00:00Z", "today", "", 2},
+		{"bad top", "myapp", "", "", "", "0", 1},
+		{"reversed", "myapp", "", "2024-03-15", "2024-03-14", "", 1},
+		{"too wide", "myapp", "", "2023-01-01", "", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateStatsQuery(tt.project, tt.env, tt.from, tt.to, tt.top, now)
+			if len(errs) != tt.wantErrors {
+				t.Errorf("ValidateStatsQuery() = %v, want %d errors", errs, tt.wantErrors)
+			}
+		})
+	}
+
+	from, to := StatsWindow("", "", now)
+	if to.Format(time.DateOnly) != "2024-03-15" || from.Format(time.DateOnly) != "2024-03-09" {
+		t.Errorf("StatsWindow() = %v, %v", from, to)
+	}
+}
+
+func TestValidateListFailures(t *testing.T) {
+	tests := []struct {
+		name                      string
+		project, env, days, limit string
+		wantErrors                int
+	}{
+		{"defaults", "myapp", "prod", "", "", 0},
+		{"bounds", "myapp", "prod", "31", "200", 0},
+		{"missing project and env", "", "", "", "", 2},
+		{"too many days", "myapp", "prod", "32", "", 1},
+		{"bad limit", "myapp", "prod", "", "ten", 1},
+		{"reserved project", "v2", "myapp", "", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateListFailures(tt.project, tt.env, tt.days, tt.limit)
+			if len(errs) != tt.wantErrors {
+				t.Errorf("ValidateListFailures() = %v, want %d errors", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestValidateTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		info models.RequestInfo
+		want []string
+	}{
+		{name: "none"},
+		{name: "w3c", info: models.RequestInfo{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", RequestID: "req-7f3a9c"}},
+		{name: "64-bit trace id", info: models.RequestInfo{TraceID: "A3CE929D0E0E4736"}},
+		{name: "not hex", info: models.RequestInfo{TraceID: "4bf92f3577b34da6a3ce929d0e0e473g", SpanID: "span-1"}, want: []string{"request.traceId", "request.spanId"}},
+		{name: "wrong length", info: models.RequestInfo{TraceID: "4bf92f3577b34da6", SpanID: "00f067aa0ba902b"}, want: []string{"request.spanId"}},
+		{name: "all zeros", info: models.RequestInfo{TraceID: strings.Repeat("0", 32), SpanID: strings.Repeat("0", 16)}, want: []string{"request.traceId", "request.spanId"}},
+		{name: "request id with spaces", info: models.RequestInfo{RequestID: "req 1"}, want: []string{"request.requestId"}},
+		{name: "request id too long", info: models.RequestInfo{RequestID: strings.Repeat("r", 129)}, want: []string{"request.requestId"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, e := range ValidateTrace(tt.info) {
+				fields = append(fields, e.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ValidateTrace() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTriage(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxTags; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	tests := []struct {
+		name        string
+		tags        map[string]string
+		description string
+		wantErrors  int
+	}{
+		{"empty", nil, "", 0},
+		{"valid", map[string]string{"team": "payments", "build.id": "1234"}, "Pay button did nothing", 0},
+		{"too many tags", tooMany, "", 1},
+		{"bad key and empty value", map[string]string{"team:x": "a", "flow": ""}, "", 2},
+		{"long value", map[string]string{"team": strings.Repeat("v", 257)}, "", 1},
+		{"long description", nil, strings.Repeat("d", 4001), 1},
+		{"invalid utf-8", nil, "\xff", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := ValidateTriage(tt.tags, tt.description); len(errs) != tt.wantErrors {
+				t.Errorf("ValidateTriage() = %v, want %d errors", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestParseFailureFilter(t *testing.T) {
+	f, errs := ParseFailureFilter("error", []string{"team:payments", "flow", "url:https://x"})
+	if len(errs) != 0 {
+		t.Fatalf("ParseFailureFilter() errors = %v", errs)
+	}
+	if f.Severity != "error" || f.Tags["team"] != "payments" || f.Tags["flow"] != "" || f.Tags["url"] != "https://x" {
+		t.Errorf("filter = %+v", f)
+	}
+
+	if _, errs := ParseFailureFilter("fatal", []string{":x", "bad key"}); len(errs) != 3 {
+		t.Errorf("ParseFailureFilter() = %v, want severity and both tags rejected", errs)
+	}
+}
@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yourorg/failure-uploader/internal/logging"
+	"github.com/yourorg/failure-uploader/internal/metrics"
+	"github.com/yourorg/failure-uploader/internal/models"
+	"github.com/yourorg/failure-uploader/internal/queue"
+	"github.com/yourorg/failure-uploader/internal/queue/consumer"
+)
+
+// Version is the schema version of queued messages
+const Version = 1
+
+// Message is the body of a queued completion awaiting verification
+type Message struct {
+	Version        int                          `json:"version"`
+	EnqueuedAt     time.Time                    `json:"enqueuedAt"`
+	Request        models.UploadCompleteRequest `json:"request"`
+	IdempotencyKey string                       `json:"idempotencyKey,omitempty"`
+	// CriticalAllowed carries whether the caller may mark the failure
+	// critical, since the consumer runs without its principal
+	CriticalAllowed bool `json:"criticalAllowed,omitempty"`
+}
+
+// Publisher enqueues completions for out-of-band verification
+type Publisher struct {
+	client   queue.API
+	queueURL string
+}
+
+// NewPublisher creates a publisher sending to the queue at queueURL
+func NewPublisher(client queue.API, queueURL string) *Publisher {
+	return &Publisher{client: client, queueURL: queueURL}
+}
+
+// Enqueue queues req, completed under idempotencyKey, for verification;
+// criticalAllowed is whether its caller may mark the failure critical
+func (p *Publisher) Enqueue(ctx context.Context, req *models.UploadCompleteRequest, idempotencyKey string, criticalAllowed bool) error {
+	b, err := json.Marshal(Message{
+		Version:         Version,
+		EnqueuedAt:      time.Now().UTC(),
+		Request:         *req,
+		IdempotencyKey:  idempotencyKey,
+		CriticalAllowed: criticalAllowed,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(b)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"project": {DataType: aws.String("String"), StringValue: aws.String(req.Project)},
+			"env":     {DataType: aws.String("String"), StringValue: aws.String(req.Env)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("enqueue verification: %w", err)
+	}
+	metrics.VerificationsQueued.Inc(req.Project)
+	return nil
+}
+
+// Decode parses a queued message body
+func Decode(body string) (Message, error) {
+	var m Message
+	if err := consumer.Decode(body, Version, &m); err != nil {
+		return Message{}, fmt.Errorf("parse queued verification: %w", err)
+	}
+	return m, nil
+}
+
+// Processor verifies and completes a queued completion. An error leaves the
+// message on the queue to be retried.
+type Processor interface {
+	ProcessVerification(ctx context.Context, m Message) error
+}
+
+// process runs the completion in body through p
+func process(ctx context.Context, p Processor, id, body string) error {
+	m, err := Decode(body)
+	if err != nil {
+		return consumer.Malformed(err)
+	}
+	if err := p.ProcessVerification(ctx, m); err != nil {
+		logging.FromContext(ctx).Warn().Err(err).Str("messageId", id).Str("failureId", m.Request.FailureID).Msg("queued verification will be retried")
+		return err
+	}
+	logging.FromContext(ctx).Info().
+		Str("messageId", id).
+		Str("failureId", m.Request.FailureID).
+		Dur("queued", time.Since(m.EnqueuedAt)).
+		Msg("queued verification processed")
+	return nil
+}
+
+// consumerOf returns the consumer processing queued completions through p
+func consumerOf(p Processor) consumer.Consumer {
+	return consumer.New("verifications", func(ctx context.Context, id, body string) error {
+		return process(ctx, p, id, body)
+	})
+}
+
+// Handle processes the queued completions of an SQS Lambda event through p.
+// Failed ones are reported as batch item failures, so only those are
+// retried; malformed messages are dropped.
+func Handle(ctx context.Context, p Processor, event events.SQSEvent) events.SQSEventResponse {
+	return consumerOf(p).Handle(ctx, event)
+}
+
+// Poll processes queued completions from the queue at queueURL through p; see consumer.Consumer.Poll
+func Poll(ctx context.Context, client consumer.Receiver, queueURL string, p Processor) {
+	consumerOf(p).Poll(ctx, client, queueURL)
+}
@@ -0,0 +1,94 @@
+// Package verify checks that the uploads of a completion are stored before
+// the failure is processed, either in upload-complete or, in async mode, from
+// an SQS queue after the completion was accepted as pending
+package verify
+
+import (
+	"context"
+	"time"
+)
+
+// Modes selectable via VERIFY_MODE
+const (
+	// ModeSync verifies the uploads in upload-complete
+	ModeSync = "sync"
+	// ModeAsync accepts upload-complete as pending and verifies the uploads
+	// out-of-band from the verification queue
+	ModeAsync = "async"
+)
+
+// Store reports which keys are not stored
+type Store interface {
+	VerifyObjectsExist(ctx context.Context, keys []string) ([]string, error)
+}
+
+// Result is the outcome of a verification
+type Result struct {
+	// Missing are the keys still not stored after the last attempt
+	Missing []string
+	// Attempts is the number of checks made
+	Attempts int
+}
+
+// Strategy verifies the uploaded keys of a completion
+type Strategy interface {
+	Verify(ctx context.Context, store Store, keys []string) (Result, error)
+}
+
+// New returns the strategy checking keys up to attempts times within window:
+// Once for a single attempt, otherwise Retry
+func New(attempts int, window time.Duration) Strategy {
+	if attempts <= 1 {
+		return Once{}
+	}
+	return Retry{Attempts: attempts, Window: window}
+}
+
+// Once checks the keys a single time
+type Once struct{}
+
+// Verify checks keys once
+func (Once) Verify(ctx context.Context, store Store, keys []string) (Result, error) {
+	missing, err := store.VerifyObjectsExist(ctx, keys)
+	return Result{Missing: missing, Attempts: 1}, err
+}
+
+// Retry re-checks missing keys with exponential backoff, riding out clients
+// that complete a few hundred milliseconds before their last PUT is visible.
+// The delays double and add up to Window, e.g. 3 attempts over 2s wait 667ms
+// and 1.33s. Errors are not retried here; the S3 client retries those.
+type Retry struct {
+	Attempts int
+	Window   time.Duration
+}
+
+// Verify checks keys, then only the missing ones, until none are missing,
+// the attempts are used up or ctx is done
+func (r Retry) Verify(ctx context.Context, store Store, keys []string) (Result, error) {
+	missing, err := store.VerifyObjectsExist(ctx, keys)
+	res := Result{Missing: missing, Attempts: 1}
+	delay := r.firstDelay()
+	for ; err == nil && len(res.Missing) > 0 && res.Attempts < r.Attempts; delay *= 2 {
+		select {
+		case <-ctx.Done():
+			return res, nil
+		case <-time.After(delay):
+		}
+		missing, err = store.VerifyObjectsExist(ctx, res.Missing)
+		if err != nil {
+			break
+		}
+		res.Missing = missing
+		res.Attempts++
+	}
+	return res, err
+}
+
+// firstDelay returns the wait before the second attempt: Window divided by
+// 2^(Attempts-1)-1, the sum of the doubling delays in units of the first
+func (r Retry) firstDelay() time.Duration {
+	if r.Attempts < 2 {
+		return 0
+	}
+	return r.Window / time.Duration(1<<(r.Attempts-1)-1)
+}
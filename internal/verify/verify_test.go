@@ -0,0 +1,139 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yourorg/failure-uploader/internal/models"
+)
+
+// appearingStore reports keys missing until they appear after a number of checks
+type appearingStore struct {
+	mu      sync.Mutex
+	appears map[string]int
+	checks  int
+	err     error
+}
+
+func (s *appearingStore) VerifyObjectsExist(_ context.Context, keys []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks++
+	if s.err != nil {
+		return nil, s.err
+	}
+	var missing []string
+	for _, k := range keys {
+		if s.appears[k] >= s.checks {
+			missing = append(missing, k)
+		}
+	}
+	return missing, nil
+}
+
+func TestRetry(t *testing.T) {
+	store := &appearingStore{appears: map[string]int{"late": 2}}
+	res, err := Retry{Attempts: 3, Window: 30 * time.Millisecond}.Verify(context.Background(), store, []string{"a", "late"})
+	if err != nil || len(res.Missing) != 0 || res.Attempts != 3 {
+		t.Errorf("Verify() = %+v, %v; want the late key found on the third attempt", res, err)
+	}
+
+	store = &appearingStore{appears: map[string]int{"never": 100}}
+	res, _ = Retry{Attempts: 3, Window: 30 * time.Millisecond}.Verify(context.Background(), store, []string{"a", "never"})
+	if len(res.Missing) != 1 || res.Missing[0] != "never" || res.Attempts != 3 {
+		t.Errorf("Verify() = %+v, want never missing after 3 attempts", res)
+	}
+}
+
+func TestRetry_StopsEarly(t *testing.T) {
+	store := &appearingStore{}
+	res, _ := Retry{Attempts: 5, Window: time.Hour}.Verify(context.Background(), store, []string{"a"})
+	if res.Attempts != 1 || store.checks != 1 {
+		t.Errorf("Verify() made %d checks, want one when nothing is missing", store.checks)
+	}
+
+	store = &appearingStore{err: errors.New("access denied")}
+	if _, err := (Retry{Attempts: 5, Window: time.Hour}).Verify(context.Background(), store, []string{"a"}); err == nil || store.checks != 1 {
+		t.Errorf("Verify() error = %v after %d checks, want errors returned at once", err, store.checks)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	store = &appearingStore{appears: map[string]int{"a": 100}}
+	res, err := Retry{Attempts: 3, Window: time.Hour}.Verify(ctx, store, []string{"a"})
+	if err != nil || len(res.Missing) != 1 {
+		t.Errorf("Verify() = %+v, %v; want the keys missing when ctx ends", res, err)
+	}
+}
+
+func TestRetry_Delays(t *testing.T) {
+	r := Retry{Attempts: 3, Window: 2100 * time.Millisecond}
+	if d := r.firstDelay(); d != 700*time.Millisecond {
+		t.Errorf("firstDelay() = %s, want 700ms so 700ms+1.4s fill the window", d)
+	}
+	if _, ok := New(1, time.Second).(Once); !ok {
+		t.Error("New(1) should check once")
+	}
+}
+
+type fakeSQS struct {
+	sent []string
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, aws.ToString(in.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+type processorFunc func(context.Context, Message) error
+
+func (f processorFunc) ProcessVerification(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+func TestHandle(t *testing.T) {
+	client := &fakeSQS{}
+	pub := NewPublisher(client, "q")
+	ctx := context.Background()
+	for _, id := range []string{"ok", "missing"} {
+		if err := pub.Enqueue(ctx, &models.UploadCompleteRequest{FailureID: id, Project: "myapp", Env: "prod"}, "key-"+id, id == "ok"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "m1", Body: client.sent[0], EventSource: "aws:sqs"},
+		{MessageId: "m2", Body: client.sent[1], EventSource: "aws:sqs"},
+		{MessageId: "m3", Body: "not json", EventSource: "aws:sqs"},
+	}}
+	var processed []Message
+	resp := Handle(ctx, processorFunc(func(_ context.Context, m Message) error {
+		processed = append(processed, m)
+		if m.Request.FailureID == "missing" {
+			return errors.New("missing_objects")
+		}
+		return nil
+	}), event)
+
+	if len(processed) != 2 || processed[0].IdempotencyKey != "key-ok" || processed[0].Request.Project != "myapp" ||
+		!processed[0].CriticalAllowed || processed[1].CriticalAllowed {
+		t.Fatalf("processed = %+v", processed)
+	}
+	if len(resp.BatchItemFailures) != 1 || resp.BatchItemFailures[0].ItemIdentifier != "m2" {
+		t.Errorf("BatchItemFailures = %+v, want only m2 retried", resp.BatchItemFailures)
+	}
+}